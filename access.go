@@ -0,0 +1,76 @@
+package imgutil
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// AccessScope is the access to an image that CheckAccess verifies: pulling (reading) it, pushing (writing) it, or both.
+type AccessScope int
+
+const (
+	PullAccess AccessScope = 1 << iota
+	PushAccess
+
+	PullPushAccess = PullAccess | PushAccess
+)
+
+func (s AccessScope) String() string {
+	var scopes []string
+	if s&PullAccess != 0 {
+		scopes = append(scopes, "pull")
+	}
+	if s&PushAccess != 0 {
+		scopes = append(scopes, "push")
+	}
+	return strings.Join(scopes, ",")
+}
+
+// ErrAccessDenied is returned by CheckAccess when the image store refuses the requested access to the image.
+type ErrAccessDenied struct {
+	Ref   string
+	Scope AccessScope
+	Cause error
+}
+
+func (e ErrAccessDenied) Error() string {
+	return fmt.Sprintf("%s access to %q denied: %s", e.Scope, e.Ref, e.Cause)
+}
+
+func (e ErrAccessDenied) Unwrap() error {
+	return e.Cause
+}
+
+// AccessChecker verifies that the image with the given name, without its scheme, can be accessed with the given scope.
+// It returns an ErrAccessDenied if the access is refused, or another error if it could not be verified.
+type AccessChecker func(name string, scope AccessScope) error
+
+var accessCheckers = struct {
+	sync.RWMutex
+	byScheme map[string]AccessChecker
+}{byScheme: map[string]AccessChecker{}}
+
+// RegisterAccessChecker makes an access checker available to CheckAccess for references with the given scheme.
+// The layout, local and remote packages register a checker for their scheme when they are imported.
+func RegisterAccessChecker(scheme string, checker AccessChecker) {
+	accessCheckers.Lock()
+	defer accessCheckers.Unlock()
+	accessCheckers.byScheme[scheme] = checker
+}
+
+// CheckAccess verifies that the image at the given reference can be pulled and/or pushed,
+// using the checker registered for its scheme, without pulling or pushing the image:
+// registries are probed with a manifest request and by initiating a blob upload, the daemon by connecting to it,
+// and layouts by reading or writing to their directory. An image that does not exist yet can still be pulled from,
+// as long as the image store allows it. References are resolved to a scheme as with NewImage.
+func CheckAccess(ref string, scope AccessScope) error {
+	scheme, name := resolveRef(ref)
+	accessCheckers.RLock()
+	checker, ok := accessCheckers.byScheme[scheme]
+	accessCheckers.RUnlock()
+	if !ok {
+		return fmt.Errorf("no access checker registered for scheme %q; import the package that provides it", scheme)
+	}
+	return checker(name, scope)
+}
@@ -0,0 +1,39 @@
+package imgutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	_ "github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestAccess(t *testing.T) {
+	spec.Run(t, "Access", testAccess, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testAccess(t *testing.T, when spec.G, it spec.S) {
+	it("describes the scope", func() {
+		h.AssertEq(t, imgutil.PullAccess.String(), "pull")
+		h.AssertEq(t, imgutil.PushAccess.String(), "push")
+		h.AssertEq(t, imgutil.PullPushAccess.String(), "pull,push")
+	})
+
+	when("#CheckAccess", func() {
+		it("uses the checker registered for the scheme", func() {
+			tmpDir, err := os.MkdirTemp("", "access-test")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(tmpDir)
+
+			h.AssertNil(t, imgutil.CheckAccess("oci:"+filepath.Join(tmpDir, "some-layout"), imgutil.PullPushAccess))
+			entries, err := os.ReadDir(tmpDir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(entries), 0)
+		})
+	})
+}
@@ -0,0 +1,142 @@
+package imgutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+)
+
+const aliasesFileName = "aliases.json"
+
+// AliasStore is a lightweight tag database in the XDG store that pins friendly names to immutable digest references.
+// For example, a builder could pin "current-run-image" to "registry.example.com/run@sha256:..." and refer to it
+// by name in FromBaseImage or WithPreviousImage without consulting a registry to resolve a tag.
+type AliasStore struct {
+	path string
+}
+
+// NewAliasStore returns an AliasStore backed by a file in the provided XDG path.
+func NewAliasStore(xdgPath string) *AliasStore {
+	return &AliasStore{path: filepath.Join(xdgPath, aliasesFileName)}
+}
+
+// Pin points the alias at the provided digest reference, replacing any previous value.
+func (s *AliasStore) Pin(alias string, ref name.Digest) error {
+	if alias == "" {
+		return fmt.Errorf("alias must not be empty")
+	}
+	aliases, err := s.read()
+	if err != nil {
+		return err
+	}
+	aliases[alias] = ref.String()
+	return s.write(aliases)
+}
+
+// Resolve returns the digest reference pinned to the alias, and whether the alias exists.
+func (s *AliasStore) Resolve(alias string) (name.Digest, bool, error) {
+	aliases, err := s.read()
+	if err != nil {
+		return name.Digest{}, false, err
+	}
+	ref, ok := aliases[alias]
+	if !ok {
+		return name.Digest{}, false, nil
+	}
+	digest, err := name.NewDigest(ref, name.WeakValidation)
+	if err != nil {
+		return name.Digest{}, false, fmt.Errorf("parsing digest reference for alias %q: %w", alias, err)
+	}
+	return digest, true, nil
+}
+
+// Remove deletes the alias if it exists.
+func (s *AliasStore) Remove(alias string) error {
+	aliases, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[alias]; !ok {
+		return nil
+	}
+	delete(aliases, alias)
+	return s.write(aliases)
+}
+
+// Aliases returns the names of all pinned aliases, sorted.
+func (s *AliasStore) Aliases() ([]string, error) {
+	aliases, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s *AliasStore) read() (map[string]string, error) {
+	aliases := make(map[string]string)
+	contents, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return aliases, nil
+		}
+		return nil, fmt.Errorf("reading aliases: %w", err)
+	}
+	if err = json.Unmarshal(contents, &aliases); err != nil {
+		return nil, fmt.Errorf("parsing aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+// write replaces the aliases file atomically, so that readers never observe a partially written file.
+func (s *AliasStore) write(aliases map[string]string) error {
+	contents, err := json.MarshalIndent(aliases, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), aliasesFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// ResolveAliases replaces the base and previous image names in the provided options with the digest references
+// pinned to them in the alias store, if one was configured with WithAliasStore.
+func ResolveAliases(options *ImageOptions) error {
+	if options.AliasStore == nil {
+		return nil
+	}
+	for _, repoName := range []*string{&options.BaseImageRepoName, &options.PreviousImageRepoName} {
+		if *repoName == "" {
+			continue
+		}
+		ref, found, err := options.AliasStore.Resolve(*repoName)
+		if err != nil {
+			return err
+		}
+		if found {
+			*repoName = ref.String()
+		}
+	}
+	return nil
+}
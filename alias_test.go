@@ -0,0 +1,82 @@
+package imgutil_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestAlias(t *testing.T) {
+	spec.Run(t, "Alias", testAlias, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testAlias(t *testing.T, when spec.G, it spec.S) {
+	var (
+		xdgPath string
+		store   *imgutil.AliasStore
+		ref     name.Digest
+		err     error
+	)
+
+	it.Before(func() {
+		xdgPath, err = os.MkdirTemp("", "alias-test")
+		h.AssertNil(t, err)
+		store = imgutil.NewAliasStore(xdgPath)
+		ref, err = name.NewDigest("some-registry.io/run@sha256:b9d056b83bb6446fee29e89a7fcf10203c562c1f59586a6e2f39c903597bda34")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(xdgPath))
+	})
+
+	when("#Pin", func() {
+		it("persists the alias for other stores using the same path", func() {
+			h.AssertNil(t, store.Pin("current-run-image", ref))
+
+			resolved, found, err := imgutil.NewAliasStore(xdgPath).Resolve("current-run-image")
+			h.AssertNil(t, err)
+			h.AssertEq(t, found, true)
+			h.AssertEq(t, resolved.String(), ref.String())
+
+			aliases, err := store.Aliases()
+			h.AssertNil(t, err)
+			h.AssertEq(t, aliases, []string{"current-run-image"})
+		})
+	})
+
+	when("#Remove", func() {
+		it("forgets the alias", func() {
+			h.AssertNil(t, store.Pin("current-run-image", ref))
+			h.AssertNil(t, store.Remove("current-run-image"))
+
+			_, found, err := store.Resolve("current-run-image")
+			h.AssertNil(t, err)
+			h.AssertEq(t, found, false)
+		})
+	})
+
+	when("#ResolveAliases", func() {
+		it("replaces aliased image names with pinned digest references", func() {
+			h.AssertNil(t, store.Pin("current-run-image", ref))
+			options := &imgutil.ImageOptions{}
+			for _, op := range []imgutil.ImageOption{
+				imgutil.WithAliasStore(store),
+				imgutil.FromBaseImage("current-run-image"),
+				imgutil.WithPreviousImage("some-app-image"),
+			} {
+				op(options)
+			}
+
+			h.AssertNil(t, imgutil.ResolveAliases(options))
+			h.AssertEq(t, options.BaseImageRepoName, ref.String())
+			h.AssertEq(t, options.PreviousImageRepoName, "some-app-image")
+		})
+	})
+}
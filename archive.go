@@ -0,0 +1,423 @@
+package imgutil
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ArchiveFormat is the format of an image archive written by SaveTo or read by LoadFrom.
+type ArchiveFormat int
+
+const (
+	// DockerArchive is the format produced by `docker save` and consumed by `docker load`.
+	DockerArchive ArchiveFormat = iota
+	// OCIArchive is a tar of an OCI image layout directory.
+	OCIArchive
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case DockerArchive:
+		return "docker-archive"
+	case OCIArchive:
+		return "oci-archive"
+	default:
+		return fmt.Sprintf("ArchiveFormat(%d)", int(f))
+	}
+}
+
+// WriteArchive streams the image to w as an archive of the given format, tagged with refName.
+// The output is deterministic: entries are written in a fixed order with normalized metadata,
+// so the same image always produces the same bytes.
+// Layers are written compressed, exactly as returned by the image.
+func WriteArchive(w io.Writer, image v1.Image, refName string, format ArchiveFormat) error {
+	tw := tar.NewWriter(w)
+	var err error
+	switch format {
+	case DockerArchive:
+		err = writeDockerArchive(tw, image, refName)
+	case OCIArchive:
+		err = writeOCIArchive(tw, image, refName)
+	default:
+		err = fmt.Errorf("unsupported archive format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+func writeDockerArchive(tw *tar.Writer, image v1.Image, refName string) error {
+	configName, err := image.ConfigName()
+	if err != nil {
+		return err
+	}
+	rawConfig, err := image.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	configPath := configName.Hex + ".json"
+	if err = addBytesToArchive(tw, configPath, rawConfig); err != nil {
+		return err
+	}
+
+	layers, err := image.Layers()
+	if err != nil {
+		return err
+	}
+	layerPaths := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return err
+		}
+		layerPath := digest.Hex + ".tar.gz"
+		if err = addLayerToArchive(tw, layerPath, layer); err != nil {
+			return err
+		}
+		layerPaths = append(layerPaths, layerPath)
+	}
+
+	var repoTags []string
+	if refName != "" {
+		repoTags = append(repoTags, refName)
+	}
+	manifest, err := canonicalJSON([]tarball.Descriptor{{
+		Config:   configPath,
+		RepoTags: repoTags,
+		Layers:   layerPaths,
+	}})
+	if err != nil {
+		return err
+	}
+	return addBytesToArchive(tw, "manifest.json", manifest)
+}
+
+func writeOCIArchive(tw *tar.Writer, image v1.Image, refName string) error {
+	if err := addBytesToArchive(tw, "oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return err
+	}
+	desc, err := addImageBlobsToArchive(tw, image, map[v1.Hash]bool{})
+	if err != nil {
+		return err
+	}
+	return addIndexJSONToArchive(tw, desc, refName)
+}
+
+// WriteIndexArchive streams the index to w as an OCI archive, tagged with refName,
+// containing the index manifest and the manifests, configs and layers of all of its children.
+// Like WriteArchive, the output is deterministic.
+func WriteIndexArchive(w io.Writer, index v1.ImageIndex, refName string) error {
+	tw := tar.NewWriter(w)
+	if err := addBytesToArchive(tw, "oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return err
+	}
+	desc, err := addIndexBlobsToArchive(tw, index, map[v1.Hash]bool{})
+	if err != nil {
+		return err
+	}
+	if err = addIndexJSONToArchive(tw, desc, refName); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// addImageBlobsToArchive adds the config, layers and manifest of the image to the archive blobs,
+// skipping blobs already written, and returns the descriptor of the manifest.
+func addImageBlobsToArchive(tw *tar.Writer, image v1.Image, written map[v1.Hash]bool) (v1.Descriptor, error) {
+	configName, err := image.ConfigName()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if !written[configName] {
+		rawConfig, err := image.RawConfigFile()
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		if err = addBytesToArchive(tw, blobPath(configName), rawConfig); err != nil {
+			return v1.Descriptor{}, err
+		}
+		written[configName] = true
+	}
+
+	layers, err := image.Layers()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	for _, layer := range layers {
+		digest, err := layer.Digest()
+		if err != nil {
+			return v1.Descriptor{}, err
+		}
+		if written[digest] {
+			continue
+		}
+		if err = addLayerToArchive(tw, blobPath(digest), layer); err != nil {
+			return v1.Descriptor{}, err
+		}
+		written[digest] = true
+	}
+
+	digest, err := image.Digest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	rawManifest, err := image.RawManifest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	mediaType, err := image.MediaType()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if !written[digest] {
+		if err = addBytesToArchive(tw, blobPath(digest), rawManifest); err != nil {
+			return v1.Descriptor{}, err
+		}
+		written[digest] = true
+	}
+	return v1.Descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(rawManifest)),
+		Digest:    digest,
+	}, nil
+}
+
+// addIndexBlobsToArchive adds the blobs of each child of the index, then the index manifest itself,
+// and returns the descriptor of the index manifest.
+func addIndexBlobsToArchive(tw *tar.Writer, index v1.ImageIndex, written map[v1.Hash]bool) (v1.Descriptor, error) {
+	indexManifest, err := getIndexManifest(index)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	for _, child := range indexManifest.Manifests {
+		switch {
+		case child.MediaType.IsImage():
+			image, err := index.Image(child.Digest)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			if _, err = addImageBlobsToArchive(tw, image, written); err != nil {
+				return v1.Descriptor{}, err
+			}
+		case child.MediaType.IsIndex():
+			childIndex, err := index.ImageIndex(child.Digest)
+			if err != nil {
+				return v1.Descriptor{}, err
+			}
+			if _, err = addIndexBlobsToArchive(tw, childIndex, written); err != nil {
+				return v1.Descriptor{}, err
+			}
+		default:
+			return v1.Descriptor{}, fmt.Errorf("unsupported media type %q for manifest %s", child.MediaType, child.Digest)
+		}
+	}
+
+	digest, err := index.Digest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	rawManifest, err := index.RawManifest()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	mediaType, err := index.MediaType()
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	if !written[digest] {
+		if err = addBytesToArchive(tw, blobPath(digest), rawManifest); err != nil {
+			return v1.Descriptor{}, err
+		}
+		written[digest] = true
+	}
+	return v1.Descriptor{
+		MediaType: mediaType,
+		Size:      int64(len(rawManifest)),
+		Digest:    digest,
+	}, nil
+}
+
+// addIndexJSONToArchive adds the index.json of the archive, which refers to the given manifest by refName.
+func addIndexJSONToArchive(tw *tar.Writer, desc v1.Descriptor, refName string) error {
+	if refName != "" {
+		// set both the OCI annotation and the one read by the containerd importer, as `docker save` does
+		desc.Annotations = map[string]string{
+			"io.containerd.image.name": refName,
+			OCIRefNameAnnotation:       refName,
+		}
+	}
+	index, err := canonicalJSON(v1.IndexManifest{
+		SchemaVersion: 2,
+		MediaType:     types.OCIImageIndex,
+		Manifests:     []v1.Descriptor{desc},
+	})
+	if err != nil {
+		return err
+	}
+	return addBytesToArchive(tw, "index.json", index)
+}
+
+func blobPath(digest v1.Hash) string {
+	return strings.Join([]string{"blobs", digest.Algorithm, digest.Hex}, "/")
+}
+
+func archiveHeader(path string, size int64) *tar.Header {
+	return &tar.Header{
+		Name:     path,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  NormalizedDateTime,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatPAX,
+	}
+}
+
+func addBytesToArchive(tw *tar.Writer, path string, contents []byte) error {
+	if err := tw.WriteHeader(archiveHeader(path, int64(len(contents)))); err != nil {
+		return err
+	}
+	_, err := tw.Write(contents)
+	return err
+}
+
+func addLayerToArchive(tw *tar.Writer, path string, layer v1.Layer) error {
+	size, err := layer.Size()
+	if err != nil {
+		return err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err = tw.WriteHeader(archiveHeader(path, size)); err != nil {
+		return err
+	}
+	n, err := io.Copy(tw, rc)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("layer %s: expected %d bytes; got %d", path, size, n)
+	}
+	return nil
+}
+
+// ReadArchive reads an image archive in either DockerArchive or OCIArchive format from r.
+// Because layers must be randomly accessible, the archive is staged in stagingDir,
+// which must remain available for as long as the returned image is in use.
+func ReadArchive(r io.Reader, stagingDir string) (v1.Image, error) {
+	archivePath := filepath.Join(stagingDir, "archive.tar")
+	if err := writeFile(archivePath, r); err != nil {
+		return nil, fmt.Errorf("staging archive: %w", err)
+	}
+	format, err := detectArchiveFormat(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if format == DockerArchive {
+		return tarball.ImageFromPath(archivePath, nil)
+	}
+	layoutPath := filepath.Join(stagingDir, "layout")
+	if err = extractArchive(archivePath, layoutPath); err != nil {
+		return nil, fmt.Errorf("staging archive: %w", err)
+	}
+	if err = os.Remove(archivePath); err != nil {
+		return nil, err
+	}
+	return imageFromLayoutDir(layoutPath)
+}
+
+func detectArchiveFormat(archivePath string) (ArchiveFormat, error) {
+	f, err := os.Open(filepath.Clean(archivePath))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return 0, fmt.Errorf("archive is neither a %s nor an %s", DockerArchive, OCIArchive)
+		}
+		if err != nil {
+			return 0, err
+		}
+		switch path.Clean(hdr.Name) {
+		case "index.json", "oci-layout":
+			return OCIArchive, nil
+		case "manifest.json":
+			return DockerArchive, nil
+		}
+	}
+}
+
+func imageFromLayoutDir(path string) (v1.Image, error) {
+	layoutPath, err := layout.FromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := layoutPath.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	indexManifest, err := getIndexManifest(index)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexManifest.Manifests) != 1 {
+		return nil, fmt.Errorf("expected archive to contain 1 image; found %d", len(indexManifest.Manifests))
+	}
+	return index.Image(indexManifest.Manifests[0].Digest)
+}
+
+func extractArchive(archivePath, dest string) error {
+	f, err := os.Open(filepath.Clean(archivePath))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		target := filepath.Join(dest, filepath.FromSlash(path.Clean("/"+hdr.Name))) // #nosec G305 -- cleaned against root
+		if err = os.MkdirAll(filepath.Dir(target), 0750); err != nil {
+			return err
+		}
+		if err = writeFile(target, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader) error {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = io.Copy(f, r); err != nil { // #nosec G110
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,93 @@
+package imgutil_test
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestArchive(t *testing.T) {
+	spec.Run(t, "Archive", testArchive, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testArchive(t *testing.T, when spec.G, it spec.S) {
+	var (
+		image      v1.Image
+		stagingDir string
+		err        error
+	)
+
+	it.Before(func() {
+		image, err = random.Image(1024, 2)
+		h.AssertNil(t, err)
+		stagingDir, err = os.MkdirTemp("", "archive-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(stagingDir))
+	})
+
+	for _, format := range []imgutil.ArchiveFormat{imgutil.DockerArchive, imgutil.OCIArchive} {
+		format := format
+		when(format.String(), func() {
+			it("round trips the image", func() {
+				var buf bytes.Buffer
+				h.AssertNil(t, imgutil.WriteArchive(&buf, image, "some/image:tag", format))
+
+				loaded, err := imgutil.ReadArchive(&buf, stagingDir)
+				h.AssertNil(t, err)
+
+				expected, err := image.ConfigName()
+				h.AssertNil(t, err)
+				actual, err := loaded.ConfigName()
+				h.AssertNil(t, err)
+				h.AssertEq(t, actual, expected)
+
+				expectedLayers, err := image.Layers()
+				h.AssertNil(t, err)
+				actualLayers, err := loaded.Layers()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(actualLayers), len(expectedLayers))
+			})
+
+			it("produces the same bytes every time", func() {
+				var first, second bytes.Buffer
+				h.AssertNil(t, imgutil.WriteArchive(&first, image, "some/image:tag", format))
+				h.AssertNil(t, imgutil.WriteArchive(&second, image, "some/image:tag", format))
+				h.AssertEq(t, first.Bytes(), second.Bytes())
+			})
+		})
+	}
+
+	it("errors when the archive format is not recognized", func() {
+		_, err := imgutil.ReadArchive(bytes.NewReader([]byte("not a tar")), stagingDir)
+		h.AssertNotNil(t, err)
+	})
+
+	when("#LoadFrom", func() {
+		it("replaces the working image", func() {
+			var buf bytes.Buffer
+			h.AssertNil(t, imgutil.WriteArchive(&buf, image, "", imgutil.OCIArchive))
+
+			other, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			core := &imgutil.CNBImageCore{Image: other}
+			h.AssertNil(t, core.LoadFrom(&buf))
+
+			expected, err := image.Digest()
+			h.AssertNil(t, err)
+			actual, err := core.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, expected)
+		})
+	})
+}
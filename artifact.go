@@ -0,0 +1,142 @@
+package imgutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// EmptyJSONMediaType is the media type of the OCI empty descriptor,
+// used as the config of artifacts that have no config, whose content is `{}`.
+const EmptyJSONMediaType types.MediaType = "application/vnd.oci.empty.v1+json"
+
+// emptyJSON is the content of the OCI empty descriptor.
+var emptyJSON = []byte("{}")
+
+// artifactManifest is an image manifest with the artifactType of OCI 1.1, which v1.Manifest does not have.
+type artifactManifest struct {
+	v1.Manifest
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// artifactImage is an OCI 1.1 artifact with the empty config, whose type is given by the artifactType of its manifest.
+type artifactImage struct {
+	manifest artifactManifest
+	layers   map[v1.Hash]v1.Layer
+}
+
+// NewArtifact returns an artifact of the given type holding the given layers, with the OCI empty descriptor as its config.
+func NewArtifact(artifactType string, layers ...v1.Layer) (v1.Image, error) {
+	configDigest, configSize, err := v1.SHA256(bytes.NewReader(emptyJSON))
+	if err != nil {
+		return nil, err
+	}
+	artifact := &artifactImage{
+		manifest: artifactManifest{
+			Manifest: v1.Manifest{
+				SchemaVersion: 2,
+				MediaType:     types.OCIManifestSchema1,
+				Config:        v1.Descriptor{MediaType: EmptyJSONMediaType, Digest: configDigest, Size: configSize},
+				Layers:        []v1.Descriptor{},
+			},
+			ArtifactType: artifactType,
+		},
+		layers: map[v1.Hash]v1.Layer{},
+	}
+	for _, layer := range layers {
+		desc, err := partial.Descriptor(layer)
+		if err != nil {
+			return nil, err
+		}
+		artifact.manifest.Layers = append(artifact.manifest.Layers, *desc)
+		artifact.layers[desc.Digest] = layer
+	}
+	return partial.CompressedToImage(artifact)
+}
+
+func (a *artifactImage) MediaType() (types.MediaType, error) {
+	return a.manifest.MediaType, nil
+}
+
+func (a *artifactImage) RawConfigFile() ([]byte, error) {
+	return emptyJSON, nil
+}
+
+func (a *artifactImage) RawManifest() ([]byte, error) {
+	return json.Marshal(a.manifest)
+}
+
+func (a *artifactImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	layer, ok := a.layers[h]
+	if !ok {
+		return nil, fmt.Errorf("layer %s not found in artifact", h)
+	}
+	return layer, nil
+}
+
+// ReferrerArtifact returns the artifact with the given subject, as it is pushed to be listed as a referrer of the subject.
+// If an artifact type is given, it is set as the artifactType of artifacts with the empty config,
+// and as the media type of the config of other artifacts, as specified by OCI 1.1.
+// Other fields of the manifest of the artifact, such as its artifactType, are kept.
+func ReferrerArtifact(artifact v1.Image, artifactType string, subject v1.Descriptor) (v1.Image, error) {
+	raw, err := artifact.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest of artifact: %w", err)
+	}
+	if artifactType != "" {
+		var config v1.Descriptor
+		if err = json.Unmarshal(fields["config"], &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config of artifact: %w", err)
+		}
+		if config.MediaType == EmptyJSONMediaType {
+			fields["artifactType"], err = json.Marshal(artifactType)
+		} else {
+			config.MediaType = types.MediaType(artifactType)
+			fields["config"], err = json.Marshal(config)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fields["subject"], err = json.Marshal(v1.Descriptor{
+		MediaType: subject.MediaType,
+		Digest:    subject.Digest,
+		Size:      subject.Size,
+	}); err != nil {
+		return nil, err
+	}
+	if raw, err = json.Marshal(fields); err != nil {
+		return nil, err
+	}
+	return &rawManifestImage{Image: artifact, raw: raw}, nil
+}
+
+// rawManifestImage is an image whose manifest is replaced with the given one, referring to the same config and layers.
+type rawManifestImage struct {
+	v1.Image
+	raw []byte
+}
+
+func (i *rawManifestImage) RawManifest() ([]byte, error) {
+	return i.raw, nil
+}
+
+func (i *rawManifestImage) Manifest() (*v1.Manifest, error) {
+	return v1.ParseManifest(bytes.NewReader(i.raw))
+}
+
+func (i *rawManifestImage) Digest() (v1.Hash, error) {
+	return partial.Digest(i)
+}
+
+func (i *rawManifestImage) Size() (int64, error) {
+	return partial.Size(i)
+}
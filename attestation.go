@@ -0,0 +1,126 @@
+package imgutil
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// AttestationReferenceTypeAnnotation marks a manifest in an index as an attestation, following the buildx convention.
+	AttestationReferenceTypeAnnotation = "vnd.docker.reference.type"
+	// AttestationReferenceDigestAnnotation holds the digest of the image an attestation manifest refers to.
+	AttestationReferenceDigestAnnotation = "vnd.docker.reference.digest"
+	// AttestationManifestType is the value of the reference type annotation for attestation manifests.
+	AttestationManifestType = "attestation-manifest"
+
+	// InTotoMediaType is the media type of layers holding an in-toto statement.
+	InTotoMediaType types.MediaType = "application/vnd.in-toto+json"
+	// DSSEMediaType is the media type of layers holding a DSSE envelope, e.g. a signed in-toto statement.
+	DSSEMediaType types.MediaType = "application/vnd.dsse.envelope.v1+json"
+	// InTotoPredicateTypeAnnotation holds the predicate type of the in-toto statement in a layer.
+	InTotoPredicateTypeAnnotation = "in-toto.io/predicate-type"
+
+	unknownPlatform = "unknown"
+)
+
+// Attestation is an in-toto statement, or a DSSE envelope wrapping one, to be stored in an attestation manifest.
+type Attestation struct {
+	PredicateType string
+	Contents      []byte
+	// MediaType defaults to InTotoMediaType.
+	MediaType types.MediaType
+}
+
+// NewAttestationImage returns a non-runnable image with one layer for each of the given attestations,
+// suitable to be added to an index with AddAttestation.
+func NewAttestationImage(attestations ...Attestation) (v1.Image, error) {
+	image, err := mutate.ConfigFile(mutate.MediaType(empty.Image, types.OCIManifestSchema1), &v1.ConfigFile{
+		Architecture: unknownPlatform,
+		OS:           unknownPlatform,
+		RootFS:       v1.RootFS{Type: "layers"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	image = mutate.ConfigMediaType(image, types.OCIConfigJSON)
+	for _, attestation := range attestations {
+		mediaType := attestation.MediaType
+		if mediaType == "" {
+			mediaType = InTotoMediaType
+		}
+		if image, err = mutate.Append(image, mutate.Addendum{
+			Layer:       static.NewLayer(attestation.Contents, mediaType),
+			MediaType:   mediaType,
+			Annotations: map[string]string{InTotoPredicateTypeAnnotation: attestation.PredicateType},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return image, nil
+}
+
+// AddAttestation adds the attestation manifest to the index, linked to the subject image with the given digest.
+// The attestation manifest has an `unknown/unknown` platform, so that runtimes never select it.
+func (h *CNBIndex) AddAttestation(subject name.Digest, attestation v1.Image) error {
+	if _, err := h.getDescriptorFrom(subject); err != nil {
+		return err
+	}
+	digest, err := attestation.Digest()
+	if err != nil {
+		return err
+	}
+	before := h.ImageIndex
+	h.ImageIndex = mutate.AppendManifests(h.ImageIndex, mutate.IndexAddendum{
+		Add: attestation,
+		Descriptor: v1.Descriptor{
+			Platform: &v1.Platform{OS: unknownPlatform, Architecture: unknownPlatform},
+			Annotations: map[string]string{
+				AttestationReferenceTypeAnnotation:   AttestationManifestType,
+				AttestationReferenceDigestAnnotation: subject.DigestStr(),
+			},
+		},
+	})
+	h.recordChange(before, IndexChange{Operation: AddManifestOperation, Digest: digest})
+	return nil
+}
+
+// Attestations returns the descriptors of the attestation manifests linked to the subject image with the given digest.
+func (h *CNBIndex) Attestations(subject name.Digest) ([]v1.Descriptor, error) {
+	indexManifest, err := getIndexManifest(h.ImageIndex)
+	if err != nil {
+		return nil, err
+	}
+	var attestations []v1.Descriptor
+	for _, desc := range indexManifest.Manifests {
+		if isAttestationFor(desc, subject.DigestStr()) {
+			attestations = append(attestations, copyDescriptor(desc))
+		}
+	}
+	return attestations, nil
+}
+
+func isAttestation(desc v1.Descriptor) bool {
+	return desc.Annotations[AttestationReferenceTypeAnnotation] == AttestationManifestType
+}
+
+func isAttestationFor(desc v1.Descriptor, subject string) bool {
+	return isAttestation(desc) && desc.Annotations[AttestationReferenceDigestAnnotation] == subject
+}
+
+// attestationsOf matches the attestation manifests linked to the subject images matched by the given matcher.
+func attestationsOf(indexManifest *v1.IndexManifest, subjects match.Matcher) match.Matcher {
+	matched := map[string]bool{}
+	for _, desc := range indexManifest.Manifests {
+		if !isAttestation(desc) && subjects(desc) {
+			matched[desc.Digest.String()] = true
+		}
+	}
+	return func(desc v1.Descriptor) bool {
+		return isAttestation(desc) && matched[desc.Annotations[AttestationReferenceDigestAnnotation]]
+	}
+}
@@ -0,0 +1,155 @@
+package imgutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Canonicalize re-encodes the given JSON document canonically: object keys are sorted,
+// HTML characters are not escaped, numbers are kept as written, and there is no insignificant whitespace.
+// Documents that are equal once decoded have the same canonical encoding, regardless of the encoder that produced them.
+func Canonicalize(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("failed to decode JSON: unexpected data after top-level value")
+	}
+	return encodeCanonical(v)
+}
+
+// canonicalJSON returns the canonical JSON encoding of v.
+func canonicalJSON(v interface{}) ([]byte, error) {
+	data, err := encodeCanonical(v)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(data)
+}
+
+func encodeCanonical(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// CanonicalImage returns an image with the same contents as the given image,
+// whose config and manifest are encoded with Canonicalize so that its digest is reproducible.
+// The manifest is only computed when needed, so the layers of the image are not read until then.
+func CanonicalImage(image v1.Image) (v1.Image, error) {
+	if _, ok := image.(*canonicalImage); ok {
+		return image, nil
+	}
+	rawConfig, err := image.RawConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if rawConfig, err = Canonicalize(rawConfig); err != nil {
+		return nil, fmt.Errorf("failed to canonicalize config: %w", err)
+	}
+	sum := sha256.Sum256(rawConfig)
+	return &canonicalImage{
+		Image:      image,
+		rawConfig:  rawConfig,
+		configName: v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(sum[:])},
+	}, nil
+}
+
+type canonicalImage struct {
+	v1.Image
+	rawConfig  []byte
+	configName v1.Hash
+
+	once        sync.Once
+	manifest    *v1.Manifest
+	rawManifest []byte
+	err         error
+}
+
+func (i *canonicalImage) computeManifest() error {
+	i.once.Do(func() {
+		var manifest *v1.Manifest
+		if manifest, i.err = getManifest(i.Image); i.err != nil {
+			return
+		}
+		manifest = manifest.DeepCopy()
+		manifest.Config.Digest = i.configName
+		manifest.Config.Size = int64(len(i.rawConfig))
+		if i.rawManifest, i.err = canonicalJSON(manifest); i.err != nil {
+			return
+		}
+		i.manifest = manifest
+	})
+	return i.err
+}
+
+func (i *canonicalImage) ConfigName() (v1.Hash, error) {
+	return i.configName, nil
+}
+
+func (i *canonicalImage) ConfigFile() (*v1.ConfigFile, error) {
+	return v1.ParseConfigFile(bytes.NewReader(i.rawConfig))
+}
+
+func (i *canonicalImage) RawConfigFile() ([]byte, error) {
+	return i.rawConfig, nil
+}
+
+func (i *canonicalImage) Manifest() (*v1.Manifest, error) {
+	if err := i.computeManifest(); err != nil {
+		return nil, err
+	}
+	return i.manifest.DeepCopy(), nil
+}
+
+func (i *canonicalImage) RawManifest() ([]byte, error) {
+	if err := i.computeManifest(); err != nil {
+		return nil, err
+	}
+	return i.rawManifest, nil
+}
+
+func (i *canonicalImage) Digest() (v1.Hash, error) {
+	if err := i.computeManifest(); err != nil {
+		return v1.Hash{}, err
+	}
+	sum := sha256.Sum256(i.rawManifest)
+	return v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(sum[:])}, nil
+}
+
+func (i *canonicalImage) Size() (int64, error) {
+	if err := i.computeManifest(); err != nil {
+		return 0, err
+	}
+	return int64(len(i.rawManifest)), nil
+}
+
+func (i *canonicalImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	if h == i.configName {
+		return static.NewLayer(i.rawConfig, i.configMediaType()), nil
+	}
+	return i.Image.LayerByDigest(h)
+}
+
+func (i *canonicalImage) configMediaType() (mediaType types.MediaType) {
+	if manifest, err := getManifest(i.Image); err == nil {
+		mediaType = manifest.Config.MediaType
+	}
+	return mediaType
+}
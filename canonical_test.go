@@ -0,0 +1,92 @@
+package imgutil_test
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestCanonical(t *testing.T) {
+	spec.Run(t, "Canonical", testCanonical, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testCanonical(t *testing.T, when spec.G, it spec.S) {
+	when("#Canonicalize", func() {
+		it("sorts keys, removes whitespace and does not escape HTML", func() {
+			canonical, err := imgutil.Canonicalize([]byte(`{ "b": [1.50, 2], "a": {"d": "<&>", "c": null} }`))
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(canonical), `{"a":{"c":null,"d":"<&>"},"b":[1.50,2]}`)
+		})
+
+		it("is idempotent", func() {
+			canonical, err := imgutil.Canonicalize([]byte(`{"b":"<","a":1}`))
+			h.AssertNil(t, err)
+			again, err := imgutil.Canonicalize(canonical)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(again), string(canonical))
+		})
+
+		it("fails on invalid JSON", func() {
+			_, err := imgutil.Canonicalize([]byte(`{"a":1} {"b":2}`))
+			h.AssertError(t, err, "failed to decode JSON")
+		})
+	})
+
+	when("#CanonicalImage", func() {
+		var image v1.Image
+
+		it.Before(func() {
+			var err error
+			image, err = random.Image(1024, 2)
+			h.AssertNil(t, err)
+			image, err = mutate.Config(image, v1.Config{Labels: map[string]string{"url": "https://example.com?a=1&b=2"}})
+			h.AssertNil(t, err)
+		})
+
+		it("encodes the config and manifest canonically", func() {
+			canonical, err := imgutil.CanonicalImage(image)
+			h.AssertNil(t, err)
+			h.AssertNil(t, validate.Image(canonical))
+
+			rawConfig, err := canonical.RawConfigFile()
+			h.AssertNil(t, err)
+			expectedConfig, err := imgutil.Canonicalize(rawConfig)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(rawConfig), string(expectedConfig))
+			h.AssertEq(t, strings.Contains(string(rawConfig), "a=1&b=2"), true)
+
+			rawManifest, err := canonical.RawManifest()
+			h.AssertNil(t, err)
+			expectedManifest, err := imgutil.Canonicalize(rawManifest)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(rawManifest), string(expectedManifest))
+		})
+
+		it("has the same digest regardless of how the image was encoded", func() {
+			configFile, err := image.ConfigFile()
+			h.AssertNil(t, err)
+			reencoded, err := mutate.ConfigFile(image, configFile)
+			h.AssertNil(t, err)
+
+			first, err := imgutil.CanonicalImage(image)
+			h.AssertNil(t, err)
+			second, err := imgutil.CanonicalImage(reencoded)
+			h.AssertNil(t, err)
+
+			firstDigest, err := first.Digest()
+			h.AssertNil(t, err)
+			secondDigest, err := second.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, firstDigest, secondDigest)
+		})
+	})
+}
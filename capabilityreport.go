@@ -0,0 +1,100 @@
+package imgutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CapabilityWarningKind classifies a CapabilityWarning.
+type CapabilityWarningKind string
+
+const (
+	// CapabilityIgnored means the option has no effect for the image, e.g. an option of another backend.
+	CapabilityIgnored CapabilityWarningKind = "ignored"
+	// CapabilityUnsupported means the option is not fully supported in the requested combination,
+	// so that the saved image may not be what was asked for.
+	CapabilityUnsupported CapabilityWarningKind = "unsupported"
+)
+
+// CapabilityWarning reports an option that is not fully supported for an image, found when the image is created.
+type CapabilityWarning struct {
+	// Option is the field of ImageOptions set by the option, e.g. LayerEncrypter for WithLayerEncryption.
+	Option  string                `json:"option"`
+	Kind    CapabilityWarningKind `json:"kind"`
+	Message string                `json:"message"`
+}
+
+func (w CapabilityWarning) String() string {
+	return fmt.Sprintf("%s is %s: %s", w.Option, w.Kind, w.Message)
+}
+
+// CapabilityReport lists the options requested for an image that are not fully supported by its backend,
+// so that callers can act on them (e.g. warn users) instead of finding out that an option had no effect after saving.
+// See WithStrictCapabilities to fail instead.
+type CapabilityReport struct {
+	Warnings []CapabilityWarning `json:"warnings"`
+}
+
+// OK reports whether every requested option is supported.
+func (r CapabilityReport) OK() bool {
+	return len(r.Warnings) == 0
+}
+
+// ErrCapabilityWarnings is returned by image constructors, in strict mode, when options are not fully supported.
+type ErrCapabilityWarnings struct {
+	Report CapabilityReport
+}
+
+func (e ErrCapabilityWarnings) Error() string {
+	warnings := make([]string, len(e.Report.Warnings))
+	for idx, warning := range e.Report.Warnings {
+		warnings[idx] = warning.String()
+	}
+	return "unsupported options: " + strings.Join(warnings, "; ")
+}
+
+// WithStrictCapabilities causes image constructors to fail with an ErrCapabilityWarnings
+// if the capability report of the image has warnings.
+func WithStrictCapabilities() func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.StrictCapabilities = true
+	}
+}
+
+// CheckCapabilities sets the capability report in the options, with the warnings found for any backend with the given
+// capabilities followed by those found by the backend, and returns an ErrCapabilityWarnings in strict mode if there are any.
+// Implementations call it in their constructor before NewCNBImage, which makes the report available from CapabilityReport.
+func CheckCapabilities(options *ImageOptions, capabilities Capabilities, backendWarnings ...CapabilityWarning) error {
+	var warnings []CapabilityWarning
+	if options.LayerCompression == Zstd && options.MediaTypes == DockerTypes {
+		warnings = append(warnings, CapabilityWarning{
+			Option:  "LayerCompression",
+			Kind:    CapabilityUnsupported,
+			Message: "zstd layers require OCI media types",
+		})
+	}
+	if options.GzipLevel != 0 && options.LayerCompression == Zstd {
+		warnings = append(warnings, CapabilityWarning{
+			Option:  "GzipLevel",
+			Kind:    CapabilityIgnored,
+			Message: "layers are compressed with zstd",
+		})
+	}
+	if options.SBOMsAsReferrers && !capabilities.CanPush {
+		warnings = append(warnings, CapabilityWarning{
+			Option:  "SBOMsAsReferrers",
+			Kind:    CapabilityIgnored,
+			Message: "referrers are only pushed to registries; SBOMs are added as layers",
+		})
+	}
+	options.CapabilityReport = CapabilityReport{Warnings: append(warnings, backendWarnings...)}
+	if options.StrictCapabilities && !options.CapabilityReport.OK() {
+		return ErrCapabilityWarnings{Report: options.CapabilityReport}
+	}
+	return nil
+}
+
+// CapabilityReport returns the options requested for the image that are not fully supported; see CheckCapabilities.
+func (i *CNBImageCore) CapabilityReport() CapabilityReport {
+	return i.capabilityReport
+}
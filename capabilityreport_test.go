@@ -0,0 +1,62 @@
+package imgutil_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestCapabilityReport(t *testing.T) {
+	spec.Run(t, "CapabilityReport", testCapabilityReport, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testCapabilityReport(t *testing.T, when spec.G, it spec.S) {
+	when("#CheckCapabilities", func() {
+		it("reports the options that are not supported together", func() {
+			options := &imgutil.ImageOptions{LayerCompression: imgutil.Zstd, MediaTypes: imgutil.DockerTypes, GzipLevel: 9}
+			h.AssertNil(t, imgutil.CheckCapabilities(options, imgutil.Capabilities{CanPush: true}))
+			h.AssertEq(t, options.CapabilityReport, imgutil.CapabilityReport{Warnings: []imgutil.CapabilityWarning{
+				{Option: "LayerCompression", Kind: imgutil.CapabilityUnsupported, Message: "zstd layers require OCI media types"},
+				{Option: "GzipLevel", Kind: imgutil.CapabilityIgnored, Message: "layers are compressed with zstd"},
+			}})
+		})
+
+		it("reports the options the backend does not support", func() {
+			options := &imgutil.ImageOptions{}
+			options.SBOMsAsReferrers = true
+			backendWarning := imgutil.CapabilityWarning{Option: "LayerEncrypter", Kind: imgutil.CapabilityIgnored, Message: "some-message"}
+			h.AssertNil(t, imgutil.CheckCapabilities(options, imgutil.Capabilities{}, backendWarning))
+			h.AssertEq(t, len(options.CapabilityReport.Warnings), 2)
+			h.AssertEq(t, options.CapabilityReport.Warnings[0].Option, "SBOMsAsReferrers")
+			h.AssertEq(t, options.CapabilityReport.Warnings[1], backendWarning)
+		})
+
+		it("fails in strict mode if there are warnings", func() {
+			options := &imgutil.ImageOptions{LayerCompression: imgutil.Zstd, MediaTypes: imgutil.DockerTypes}
+			imgutil.WithStrictCapabilities()(options)
+			err := imgutil.CheckCapabilities(options, imgutil.Capabilities{})
+			var capabilityErr imgutil.ErrCapabilityWarnings
+			h.AssertEq(t, errors.As(err, &capabilityErr), true)
+			h.AssertError(t, err, "unsupported options: LayerCompression is unsupported: zstd layers require OCI media types")
+
+			options = &imgutil.ImageOptions{StrictCapabilities: true}
+			h.AssertNil(t, imgutil.CheckCapabilities(options, imgutil.Capabilities{}))
+			h.AssertEq(t, options.CapabilityReport.OK(), true)
+		})
+	})
+
+	when("#CapabilityReport", func() {
+		it("returns the report of the options", func() {
+			options := &imgutil.ImageOptions{LayerCompression: imgutil.Zstd, MediaTypes: imgutil.DockerTypes}
+			h.AssertNil(t, imgutil.CheckCapabilities(options, imgutil.Capabilities{}))
+			image, err := imgutil.NewCNBImage(*options)
+			h.AssertNil(t, err)
+			h.AssertEq(t, image.CapabilityReport(), options.CapabilityReport)
+		})
+	})
+}
@@ -0,0 +1,94 @@
+// Command imgutild serves core imgutil operations over a local HTTP API, so that platforms that are not written in Go
+// can inspect and copy images, and edit and push image indexes, without shelling out to another tool.
+// It is a thin layer over the library: requests and responses are JSON documents, and image references use the
+// schemes of imgutil.NewImageFromRef, e.g. `oci:/path/to/layout`, `docker-daemon:some/image` or `some/image`.
+//
+// The API acts with the credentials and files of the user running it, so it listens on the loopback interface
+// or on a unix socket only, and only accepts JSON requests that do not come from web pages.
+// On the loopback interface, requests must also be made to a loopback host and carry the token of the server
+// in an `Authorization: Bearer <token>` header: the token is read from the IMGUTILD_TOKEN environment variable,
+// or generated and written to the file given with -token-file. On a unix socket, which only its owner can connect to,
+// a token is only required if IMGUTILD_TOKEN is set.
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:7474", "loopback `address` to listen on")
+	socket := flag.String("socket", "", "unix socket `path` to listen on instead of addr")
+	tokenFile := flag.String("token-file", "", "`path` of the file the generated token is written to, when IMGUTILD_TOKEN is not set")
+	flag.Parse()
+
+	opts := serverOptions{token: os.Getenv("IMGUTILD_TOKEN"), checkHost: *socket == ""}
+	if opts.token == "" && *socket == "" {
+		if *tokenFile == "" {
+			log.Fatal("a token is required on the loopback interface: set IMGUTILD_TOKEN, or -token-file to generate one")
+		}
+		token, err := generateToken(*tokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.token = token
+	}
+
+	listener, err := listen(*addr, *socket)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("imgutild listening on %s", listener.Addr())
+	if err = http.Serve(listener, newServer(opts)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// generateToken returns a random token, which is written to a file at path that only the user can read.
+func generateToken(path string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(token), 0600); err != nil {
+		return "", fmt.Errorf("writing token file: %w", err)
+	}
+	return token, nil
+}
+
+func listen(addr, socket string) (net.Listener, error) {
+	if socket != "" {
+		if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			return nil, err
+		}
+		if err = os.Chmod(socket, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); (ip == nil || !ip.IsLoopback()) && !strings.EqualFold(host, "localhost") {
+		return nil, fmt.Errorf("refusing to listen on %q: use a loopback address or a unix socket", addr)
+	}
+	return net.Listen("tcp", addr)
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	"github.com/buildpacks/imgutil/local"
+	"github.com/buildpacks/imgutil/remote"
+)
+
+// serverOptions protect the API, which reads and writes images and files as the user running the server,
+// from other local users and from web pages, which browsers let send requests to loopback addresses.
+type serverOptions struct {
+	// token, if set, must be sent by clients as a bearer token in the Authorization header
+	token string
+	// checkHost rejects requests whose Host header is not a loopback host, so that pages cannot reach the server
+	// through a name of their own that they rebind to the loopback address
+	checkHost bool
+}
+
+func newServer(opts serverOptions) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/inspect", handle(inspect))
+	mux.HandleFunc("/v1/copy", handle(copyImage))
+	mux.HandleFunc("/v1/index/edit", handle(editIndex))
+	mux.HandleFunc("/v1/index/push", handle(pushIndex))
+	return guard(opts, mux)
+}
+
+// guard rejects requests that are not made to a loopback host, come from a web page, or do not carry the token.
+func guard(opts serverOptions, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case opts.checkHost && !isLoopbackHost(r.Host):
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "requests must be made to a loopback host"})
+		case r.Header.Get("Origin") != "":
+			writeJSON(w, http.StatusForbidden, errorResponse{Error: "requests from web pages are not allowed"})
+		case opts.token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+opts.token)) != 1:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSON(w, http.StatusUnauthorized, errorResponse{Error: "a valid bearer token is required"})
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// isLoopbackHost reports whether the host, with an optional port, is `localhost` or a loopback address.
+func isLoopbackHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = strings.Trim(hostport, "[]")
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// errBadRequest marks errors caused by the content of the request.
+type errBadRequest struct {
+	error
+}
+
+// handle decodes the JSON request for an operation, and encodes its result or error as the JSON response.
+func handle[Req, Resp any](op func(Req) (Resp, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "only POST is allowed"})
+			return
+		}
+		// requiring JSON makes browsers send a preflight request for cross-origin requests, which is not answered
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			writeJSON(w, http.StatusUnsupportedMediaType, errorResponse{Error: "the request must have the application/json content type"})
+			return
+		}
+		var req Req
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("decoding request: %s", err)})
+			return
+		}
+		resp, err := op(req)
+		if err != nil {
+			writeJSON(w, statusFor(err), errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func statusFor(err error) int {
+	var (
+		badRequest errBadRequest
+		denied     imgutil.ErrAccessDenied
+	)
+	switch {
+	case errors.As(err, &badRequest):
+		return http.StatusBadRequest
+	case errors.As(err, &denied):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// inspect
+
+type inspectRequest struct {
+	Ref string `json:"ref"`
+}
+
+type inspectResponse struct {
+	Ref          string            `json:"ref"`
+	Kind         string            `json:"kind"`
+	Found        bool              `json:"found"`
+	Identifier   string            `json:"identifier,omitempty"`
+	OS           string            `json:"os"`
+	Architecture string            `json:"architecture"`
+	Variant      string            `json:"variant,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	DiffIDs      []string          `json:"diffIDs"`
+}
+
+func inspect(req inspectRequest) (inspectResponse, error) {
+	if req.Ref == "" {
+		return inspectResponse{}, errBadRequest{errors.New("ref is required")}
+	}
+	image, err := imgutil.NewImageFromRef(req.Ref)
+	if err != nil {
+		return inspectResponse{}, err
+	}
+	defer cleanup(image)
+
+	resp := inspectResponse{Ref: req.Ref, Kind: image.Kind(), Found: image.Found(), DiffIDs: []string{}}
+	if resp.Found {
+		identifier, err := image.Identifier()
+		if err != nil {
+			return inspectResponse{}, err
+		}
+		resp.Identifier = identifier.String()
+	}
+	configFile, err := image.UnderlyingImage().ConfigFile()
+	if err != nil {
+		return inspectResponse{}, err
+	}
+	resp.OS, resp.Architecture, resp.Variant = configFile.OS, configFile.Architecture, configFile.Variant
+	resp.Labels = configFile.Config.Labels
+	for _, diffID := range configFile.RootFS.DiffIDs {
+		resp.DiffIDs = append(resp.DiffIDs, diffID.String())
+	}
+	return resp, nil
+}
+
+// copy
+
+type copyRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	// Insecure causes a destination registry to be accessed without TLS verification.
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+type copyResponse struct {
+	Digest string `json:"digest"`
+}
+
+func copyImage(req copyRequest) (copyResponse, error) {
+	if req.Source == "" || req.Destination == "" {
+		return copyResponse{}, errBadRequest{errors.New("source and destination are required")}
+	}
+	source, err := imgutil.NewImageFromRef(req.Source)
+	if err != nil {
+		return copyResponse{}, err
+	}
+	defer cleanup(source)
+	if !source.Found() {
+		return copyResponse{}, errBadRequest{fmt.Errorf("image %q not found", req.Source)}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "imgutild.copy.")
+	if err != nil {
+		return copyResponse{}, err
+	}
+	defer os.RemoveAll(tmpDir)
+	image, err := readableImage(source, tmpDir)
+	if err != nil {
+		return copyResponse{}, err
+	}
+	if err = writeImage(image, req.Destination, req.Insecure); err != nil {
+		return copyResponse{}, err
+	}
+	digest, err := image.Digest()
+	if err != nil {
+		return copyResponse{}, err
+	}
+	return copyResponse{Digest: digest.String()}, nil
+}
+
+// readableImage returns the image with all of its layers readable. The layers of daemon images are only available
+// through `docker save`, so daemon images are read back from the archive they are saved to.
+func readableImage(image imgutil.Image, stagingDir string) (v1.Image, error) {
+	if image.Kind() != "local" {
+		return image.UnderlyingImage(), nil
+	}
+	path, err := image.SaveFile()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(path)
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return imgutil.ReadArchive(f, stagingDir)
+}
+
+// writeImage writes the image as it is to the destination, so that its digest is preserved.
+// Images are pushed to registries with the transport, retries and registry settings of remote images.
+func writeImage(image v1.Image, ref string, insecure bool) error {
+	scheme, destination := imgutil.ParseRef(ref)
+	switch scheme {
+	case imgutil.LayoutScheme:
+		layoutImage, err := layout.NewImage(destination, layout.FromBaseImageInstance(image))
+		if err != nil {
+			return err
+		}
+		return layoutImage.Save()
+	case imgutil.LocalScheme:
+		dockerClient, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			return err
+		}
+		return local.NewExtractDestination(destination, dockerClient).WriteImage(image)
+	default:
+		destinationRef, err := name.ParseReference(destination, name.WeakValidation)
+		if err != nil {
+			return errBadRequest{err}
+		}
+		var ops []imgutil.ImageOption
+		if insecure {
+			ops = append(ops, remote.WithRegistrySetting(destinationRef.Context().RegistryStr(), true))
+		}
+		if err = remote.CheckAccess(destination, authn.DefaultKeychain, imgutil.PushAccess, ops...); err != nil {
+			return err
+		}
+		extractDestination, err := remote.NewExtractDestination(destination, authn.DefaultKeychain, ops...)
+		if err != nil {
+			return err
+		}
+		return extractDestination.WriteImage(image)
+	}
+}
+
+// indexes
+
+type editIndexRequest struct {
+	// Name is the name of the index, which is stored under XDGPath.
+	Name    string `json:"name"`
+	XDGPath string `json:"xdgPath"`
+	// Add holds the references of the images to add to the index.
+	Add []string `json:"add,omitempty"`
+	// Remove holds the digest references of the manifests to remove from the index.
+	Remove []string `json:"remove,omitempty"`
+	// Annotations holds the annotations to set, by manifest digest reference.
+	Annotations map[string]map[string]string `json:"annotations,omitempty"`
+}
+
+type editIndexResponse struct {
+	Changes []imgutil.IndexChange `json:"changes"`
+}
+
+func editIndex(req editIndexRequest) (editIndexResponse, error) {
+	if req.Name == "" || req.XDGPath == "" {
+		return editIndexResponse{}, errBadRequest{errors.New("name and xdgPath are required")}
+	}
+	index, err := layout.NewIndex(req.Name,
+		imgutil.WithXDGRuntimePath(req.XDGPath),
+		imgutil.FromBaseIndex(imgutil.StorePath(req.XDGPath, req.Name)),
+	)
+	if err != nil {
+		return editIndexResponse{}, err
+	}
+	for _, ref := range req.Add {
+		image, err := imgutil.NewImageFromRef(ref)
+		if err != nil {
+			return editIndexResponse{}, err
+		}
+		index.AddManifest(image.UnderlyingImage())
+		cleanup(image)
+	}
+	for _, ref := range req.Remove {
+		digest, err := name.NewDigest(ref, name.WeakValidation)
+		if err != nil {
+			return editIndexResponse{}, errBadRequest{err}
+		}
+		if err = index.RemoveManifest(digest); err != nil {
+			return editIndexResponse{}, err
+		}
+	}
+	for ref, annotations := range req.Annotations {
+		digest, err := name.NewDigest(ref, name.WeakValidation)
+		if err != nil {
+			return editIndexResponse{}, errBadRequest{err}
+		}
+		if err = index.SetAnnotations(digest, annotations); err != nil {
+			return editIndexResponse{}, err
+		}
+	}
+	changes := index.PendingChanges()
+	if err = index.SaveDir(); err != nil {
+		return editIndexResponse{}, err
+	}
+	return editIndexResponse{Changes: changes}, nil
+}
+
+type pushIndexRequest struct {
+	Name     string   `json:"name"`
+	XDGPath  string   `json:"xdgPath"`
+	Tags     []string `json:"tags,omitempty"`
+	Purge    bool     `json:"purge,omitempty"`
+	Insecure bool     `json:"insecure,omitempty"`
+}
+
+type pushIndexResponse struct{}
+
+func pushIndex(req pushIndexRequest) (pushIndexResponse, error) {
+	if req.Name == "" || req.XDGPath == "" {
+		return pushIndexResponse{}, errBadRequest{errors.New("name and xdgPath are required")}
+	}
+	path := imgutil.StorePath(req.XDGPath, req.Name)
+	if _, err := os.Stat(path); err != nil {
+		return pushIndexResponse{}, errBadRequest{fmt.Errorf("index %q not found: %w", req.Name, err)}
+	}
+	index, err := layout.NewIndex(req.Name,
+		imgutil.WithXDGRuntimePath(req.XDGPath),
+		imgutil.FromBaseIndex(path),
+		imgutil.WithKeychain(authn.DefaultKeychain),
+	)
+	if err != nil {
+		return pushIndexResponse{}, err
+	}
+	ops := []imgutil.IndexOption{imgutil.WithTags(req.Tags...), imgutil.WithPurge(req.Purge)}
+	if req.Insecure {
+		ops = append(ops, imgutil.WithInsecure())
+	}
+	return pushIndexResponse{}, index.Push(ops...)
+}
+
+// cleanup removes the intermediate files of images that create them, such as daemon images.
+func cleanup(image imgutil.Image) {
+	if c, ok := image.(interface{ Cleanup() error }); ok {
+		_ = c.Cleanup()
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestServer(t *testing.T) {
+	spec.Run(t, "Server", testServer, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testServer(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server     *httptest.Server
+		tmpDir     string
+		layoutPath string
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(newServer(serverOptions{token: "some-token", checkHost: true}))
+		var err error
+		tmpDir, err = os.MkdirTemp("", "imgutild-test")
+		h.AssertNil(t, err)
+
+		base, err := random.Image(100, 2)
+		h.AssertNil(t, err)
+		layoutPath = filepath.Join(tmpDir, "some-image")
+		image, err := layout.NewImage(layoutPath, layout.FromBaseImageInstance(base))
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.SetLabel("some-key", "some-value"))
+		h.AssertNil(t, image.Save())
+	})
+
+	it.After(func() {
+		server.Close()
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	send := func(path string, req interface{}, resp interface{}, headers map[string]string) int {
+		body, err := json.Marshal(req)
+		h.AssertNil(t, err)
+		httpReq, err := http.NewRequest(http.MethodPost, server.URL+path, bytes.NewReader(body))
+		h.AssertNil(t, err)
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Authorization", "Bearer some-token")
+		for key, value := range headers {
+			if key == "Host" {
+				httpReq.Host = value
+				continue
+			}
+			httpReq.Header.Set(key, value)
+		}
+		res, err := http.DefaultClient.Do(httpReq)
+		h.AssertNil(t, err)
+		defer res.Body.Close()
+		h.AssertNil(t, json.NewDecoder(res.Body).Decode(resp))
+		return res.StatusCode
+	}
+
+	post := func(path string, req interface{}, resp interface{}) int {
+		return send(path, req, resp, nil)
+	}
+
+	when("requests are not from a local client", func() {
+		it("rejects requests without the token", func() {
+			var resp errorResponse
+			h.AssertEq(t, send("/v1/inspect", inspectRequest{Ref: "oci:" + layoutPath}, &resp, map[string]string{"Authorization": "Bearer other-token"}), http.StatusUnauthorized)
+		})
+
+		it("rejects requests that are not JSON", func() {
+			var resp errorResponse
+			h.AssertEq(t, send("/v1/inspect", inspectRequest{Ref: "oci:" + layoutPath}, &resp, map[string]string{"Content-Type": "text/plain"}), http.StatusUnsupportedMediaType)
+		})
+
+		it("rejects requests made to another host", func() {
+			var resp errorResponse
+			h.AssertEq(t, send("/v1/inspect", inspectRequest{Ref: "oci:" + layoutPath}, &resp, map[string]string{"Host": "attacker.example.com:7474"}), http.StatusForbidden)
+		})
+
+		it("rejects requests from web pages", func() {
+			var resp errorResponse
+			h.AssertEq(t, send("/v1/inspect", inspectRequest{Ref: "oci:" + layoutPath}, &resp, map[string]string{"Origin": "http://attacker.example.com"}), http.StatusForbidden)
+		})
+	})
+
+	when("/v1/inspect", func() {
+		it("describes the image", func() {
+			var resp inspectResponse
+			h.AssertEq(t, post("/v1/inspect", inspectRequest{Ref: "oci:" + layoutPath}, &resp), http.StatusOK)
+			h.AssertEq(t, resp.Kind, "layout")
+			h.AssertEq(t, resp.Found, true)
+			h.AssertEq(t, resp.Labels["some-key"], "some-value")
+			h.AssertEq(t, len(resp.DiffIDs), 2)
+		})
+
+		it("rejects a request without a reference", func() {
+			var resp errorResponse
+			h.AssertEq(t, post("/v1/inspect", inspectRequest{}, &resp), http.StatusBadRequest)
+			h.AssertEq(t, resp.Error, "ref is required")
+		})
+	})
+
+	when("/v1/copy and /v1/index", func() {
+		it("copies the image to a registry and adds it to an index that is pushed", func() {
+			reg := httptest.NewServer(registry.New())
+			defer reg.Close()
+			u, err := url.Parse(reg.URL)
+			h.AssertNil(t, err)
+			// the registry only accepts an index whose manifests are in the same repository
+			destination := u.Host + "/some/repo:image"
+
+			var copied copyResponse
+			h.AssertEq(t, post("/v1/copy", copyRequest{Source: "oci:" + layoutPath, Destination: destination}, &copied), http.StatusOK)
+
+			var inspected inspectResponse
+			h.AssertEq(t, post("/v1/inspect", inspectRequest{Ref: destination}, &inspected), http.StatusOK)
+			h.AssertEq(t, inspected.Labels["some-key"], "some-value")
+
+			xdgPath := filepath.Join(tmpDir, "manifests")
+			indexName := u.Host + "/some/repo:latest"
+			var edited editIndexResponse
+			h.AssertEq(t, post("/v1/index/edit", editIndexRequest{Name: indexName, XDGPath: xdgPath, Add: []string{destination}}, &edited), http.StatusOK)
+			h.AssertEq(t, len(edited.Changes), 1)
+			h.AssertEq(t, edited.Changes[0].Operation, imgutil.AddManifestOperation)
+
+			var pushed pushIndexResponse
+			h.AssertEq(t, post("/v1/index/push", pushIndexRequest{Name: indexName, XDGPath: xdgPath}, &pushed), http.StatusOK)
+
+			ref, err := name.ParseReference(indexName)
+			h.AssertNil(t, err)
+			index, err := ggcrremote.Index(ref)
+			h.AssertNil(t, err)
+			manifest, err := index.IndexManifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(manifest.Manifests), 1)
+			h.AssertEq(t, manifest.Manifests[0].Digest.String(), copied.Digest)
+		})
+
+		it("edits indexes stored under their previous name", func() {
+			xdgPath := filepath.Join(tmpDir, "manifests")
+			var edited editIndexResponse
+			h.AssertEq(t, post("/v1/index/edit", editIndexRequest{Name: "con", XDGPath: xdgPath, Add: []string{"oci:" + layoutPath}}, &edited), http.StatusOK)
+			// indexes were stored under their unescaped name before names were made safe on Windows
+			h.AssertNil(t, os.Rename(filepath.Join(xdgPath, imgutil.MakeFileSafeName("con")), filepath.Join(xdgPath, "con")))
+
+			annotations := map[string]map[string]string{"con@" + edited.Changes[0].Digest.String(): {"some-key": "some-value"}}
+			h.AssertEq(t, post("/v1/index/edit", editIndexRequest{Name: "con", XDGPath: xdgPath, Annotations: annotations}, &edited), http.StatusOK)
+			h.AssertEq(t, len(edited.Changes), 1)
+			h.AssertEq(t, edited.Changes[0].Operation, imgutil.SetAnnotationsOperation)
+		})
+	})
+}
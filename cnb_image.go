@@ -4,12 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/mutate"
-	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 // CNBImageCore wraps a v1.Image and provides most of the methods necessary for the image to satisfy the Image interface.
@@ -25,6 +26,22 @@ type CNBImageCore struct {
 	preferredMediaTypes MediaTypes
 	preserveHistory     bool
 	previousImage       v1.Image
+	layerCompression    Compression
+	gzipLevel           int
+	tempFiles           *TempFiles
+	diffIDProvider      DiffIDProvider
+	strictInvariants    bool
+	validateRebase      bool
+	layerEncrypter      LayerEncrypter
+	capabilityReport    CapabilityReport
+	canonicalJSON       bool
+	// baseImage is the image the working image was created from or last rebased on, if any
+	baseImage v1.Image
+	// baseLayerCount is the number of layers at the bottom of the working image that came from the base image
+	baseLayerCount int
+	// buildOnlyDiffIDs are the layers whose build-only marker was removed from the history when the image was saved,
+	// which TrimBuildLayers still removes
+	buildOnlyDiffIDs map[v1.Hash]bool
 }
 
 var _ v1.Image = &CNBImageCore{}
@@ -58,6 +75,20 @@ func (i *CNBImageCore) Entrypoint() ([]string, error) {
 	return configFile.Config.Entrypoint, nil
 }
 
+// ExposedPorts returns the ports exposed in the config, sorted.
+func (i *CNBImageCore) ExposedPorts() ([]string, error) {
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return nil, err
+	}
+	var ports []string
+	for port := range configFile.Config.ExposedPorts {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	return ports, nil
+}
+
 func (i *CNBImageCore) Env(key string) (string, error) {
 	configFile, err := getConfigFile(i.Image)
 	if err != nil {
@@ -77,7 +108,7 @@ func (i *CNBImageCore) GetAnnotateRefName() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return manifest.Annotations["org.opencontainers.image.ref.name"], nil
+	return manifest.Annotations[OCIRefNameAnnotation], nil
 }
 
 func (i *CNBImageCore) GetLayer(diffID string) (io.ReadCloser, error) {
@@ -85,17 +116,13 @@ func (i *CNBImageCore) GetLayer(diffID string) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, err
 	}
-	configFile, err := i.ConfigFile()
+	hash, found, err := layerDiffID(i.Image, layerHash)
 	if err != nil {
 		return nil, err
 	}
-	if !contains(configFile.RootFS.DiffIDs, layerHash) {
+	if !found {
 		return nil, ErrLayerNotFound{DiffID: layerHash.String()}
 	}
-	hash, err := v1.NewHash(diffID)
-	if err != nil {
-		return nil, err
-	}
 	layer, err := i.LayerByDiffID(hash)
 	if err != nil {
 		return nil, err
@@ -144,6 +171,24 @@ func (i *CNBImageCore) ManifestSize() (int64, error) {
 	return i.Image.Size()
 }
 
+func (i *CNBImageCore) LayerSizes() ([]int64, error) {
+	manifest, err := i.Image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, len(manifest.Layers))
+	for idx, layer := range manifest.Layers {
+		sizes[idx] = layer.Size
+	}
+	return sizes, nil
+}
+
+// TotalSize returns the sum of the sizes of the manifest, the config and the layers.
+// It is not named Size, which the image has as a v1.Image and which returns the size of the manifest.
+func (i *CNBImageCore) TotalSize() (int64, error) {
+	return ImageSize(i.Image)
+}
+
 // TBD Deprecated: OS
 func (i *CNBImageCore) OS() (string, error) {
 	configFile, err := getConfigFile(i.Image)
@@ -211,6 +256,40 @@ func (i *CNBImageCore) Variant() (string, error) {
 	return configFile.Variant, nil
 }
 
+// StopSignal returns the stop signal in the config.
+func (i *CNBImageCore) StopSignal() (string, error) {
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return "", err
+	}
+	return configFile.Config.StopSignal, nil
+}
+
+// User returns the user the image runs as, from the config.
+func (i *CNBImageCore) User() (string, error) {
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return "", err
+	}
+	return configFile.Config.User, nil
+}
+
+// Volumes returns a copy of the volumes in the config.
+func (i *CNBImageCore) Volumes() (map[string]struct{}, error) {
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return nil, err
+	}
+	if configFile.Config.Volumes == nil {
+		return nil, nil
+	}
+	volumes := make(map[string]struct{}, len(configFile.Config.Volumes))
+	for volume := range configFile.Config.Volumes {
+		volumes[volume] = struct{}{}
+	}
+	return volumes, nil
+}
+
 // TBD Deprecated: WorkingDir
 func (i *CNBImageCore) WorkingDir() (string, error) {
 	configFile, err := getConfigFile(i.Image)
@@ -222,7 +301,7 @@ func (i *CNBImageCore) WorkingDir() (string, error) {
 
 func (i *CNBImageCore) AnnotateRefName(refName string) error {
 	return i.SetAnnotations(map[string]string{
-		"org.opencontainers.image.ref.name": refName,
+		OCIRefNameAnnotation: refName,
 	})
 }
 
@@ -243,7 +322,7 @@ func (i *CNBImageCore) SetAnnotations(annotations map[string]string) error {
 		return fmt.Errorf("failed to add annotations")
 	}
 	i.Image = image
-	return nil
+	return i.checkInvariants("SetAnnotations")
 }
 
 // TBD Deprecated: SetArchitecture
@@ -267,6 +346,24 @@ func (i *CNBImageCore) SetEntrypoint(ep ...string) error {
 	})
 }
 
+// SetExposedPorts replaces the ports exposed in the config; calling it without ports removes them all.
+func (i *CNBImageCore) SetExposedPorts(ports ...string) error {
+	var exposedPorts map[string]struct{}
+	for _, port := range ports {
+		normalized, err := NormalizePort(port)
+		if err != nil {
+			return err
+		}
+		if exposedPorts == nil {
+			exposedPorts = make(map[string]struct{}, len(ports))
+		}
+		exposedPorts[normalized] = struct{}{}
+	}
+	return i.MutateConfigFile(func(c *v1.ConfigFile) {
+		c.Config.ExposedPorts = exposedPorts
+	})
+}
+
 func (i *CNBImageCore) SetEnv(key, val string) error {
 	return i.MutateConfigFile(func(c *v1.ConfigFile) {
 		ignoreCase := c.OS == "windows"
@@ -332,6 +429,34 @@ func (i *CNBImageCore) SetVariant(variant string) error {
 	})
 }
 
+// SetStopSignal sets the stop signal in the config.
+func (i *CNBImageCore) SetStopSignal(signal string) error {
+	return i.MutateConfigFile(func(c *v1.ConfigFile) {
+		c.Config.StopSignal = signal
+	})
+}
+
+// SetUser sets the user the image runs as, in the config.
+func (i *CNBImageCore) SetUser(user string) error {
+	return i.MutateConfigFile(func(c *v1.ConfigFile) {
+		c.Config.User = user
+	})
+}
+
+// SetVolumes replaces the volumes in the config; an empty map removes them all.
+func (i *CNBImageCore) SetVolumes(volumes map[string]struct{}) error {
+	var copied map[string]struct{}
+	if len(volumes) > 0 {
+		copied = make(map[string]struct{}, len(volumes))
+		for volume := range volumes {
+			copied[volume] = struct{}{}
+		}
+	}
+	return i.MutateConfigFile(func(c *v1.ConfigFile) {
+		c.Config.Volumes = copied
+	})
+}
+
 // TBD Deprecated: SetWorkingDir
 func (i *CNBImageCore) SetWorkingDir(dir string) error {
 	return i.MutateConfigFile(func(c *v1.ConfigFile) {
@@ -352,14 +477,29 @@ func (i *CNBImageCore) AddLayerWithDiffID(path, _ string) error {
 }
 
 func (i *CNBImageCore) AddLayerWithDiffIDAndHistory(path, _ string, history v1.History) error {
-	layer, err := tarball.LayerFromFile(path)
+	layer, err := i.layerCompression.layerFromFile(path, i.diffIDProvider, i.gzipLevel)
 	if err != nil {
 		return err
 	}
 	return i.AddLayerWithHistory(layer, history)
 }
 
+// AddLayerWithDiffIDAndMediaType adds the blob at the given path, e.g. a pre-compressed gzip or zstd layer, with the given diff ID and media type.
+// The blob is not recompressed, so the digest of the layer is the digest of the blob; see LayerFromBlob.
+func (i *CNBImageCore) AddLayerWithDiffIDAndMediaType(path, diffID string, mediaType types.MediaType) error {
+	layer, err := LayerFromBlob(path, diffID, mediaType)
+	if err != nil {
+		return err
+	}
+	return i.AddLayerWithHistory(layer, emptyHistory)
+}
+
 func (i *CNBImageCore) AddLayerWithHistory(layer v1.Layer, history v1.History) error {
+	return i.addLayerWithHistoryAndAnnotations(layer, history, nil)
+}
+
+// addLayerWithHistoryAndAnnotations adds the layer with the given annotations on its descriptor in the manifest.
+func (i *CNBImageCore) addLayerWithHistoryAndAnnotations(layer v1.Layer, history v1.History, annotations map[string]string) error {
 	var err error
 	// ensure existing history
 	if err = i.MutateConfigFile(func(c *v1.ConfigFile) {
@@ -369,19 +509,34 @@ func (i *CNBImageCore) AddLayerWithHistory(layer v1.Layer, history v1.History) e
 	}
 
 	if !i.preserveHistory {
-		history = emptyHistory
+		history = zeroHistory(history, emptyHistory.Created)
 	}
 	history.Created = v1.Time{Time: i.createdAt}
+	if l, ok := layer.(*estargzLayer); ok && len(annotations) != 0 {
+		// the given annotations replace those of the descriptor of the layer, which must be kept
+		merged := make(map[string]string, len(l.annotations)+len(annotations))
+		for k, v := range l.annotations {
+			merged[k] = v
+		}
+		for k, v := range annotations {
+			merged[k] = v
+		}
+		annotations = merged
+	}
 
 	i.Image, err = mutate.Append(
 		i.Image,
 		mutate.Addendum{
-			Layer:     layer,
-			History:   history,
-			MediaType: i.preferredMediaTypes.LayerType(),
+			Layer:       layer,
+			History:     history,
+			MediaType:   layerMediaType(layer, i.preferredMediaTypes.LayerType()),
+			Annotations: annotations,
 		},
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return i.checkInvariants("AddLayer")
 }
 
 func (i *CNBImageCore) AddOrReuseLayerWithHistory(path string, diffID string, history v1.History) error {
@@ -403,26 +558,36 @@ func (i *CNBImageCore) PreviousImageHasLayer(diffID string) (bool, error) {
 	if err != nil {
 		return false, fmt.Errorf("failed to get layer hash: %w", err)
 	}
-	prevConfigFile, err := getConfigFile(i.previousImage)
+	_, found, err := layerDiffID(i.previousImage, layerHash)
 	if err != nil {
-		return false, fmt.Errorf("failed to get previous image config: %w", err)
+		return false, fmt.Errorf("failed to get previous image layers: %w", err)
 	}
-	return contains(prevConfigFile.RootFS.DiffIDs, layerHash), nil
+	return found, nil
 }
 
 func (i *CNBImageCore) Rebase(baseTopLayerDiffID string, withNewBase Image) error {
 	newBase := withNewBase.UnderlyingImage() // FIXME: when all imgutil.Images are v1.Images, we can remove this part
 	var err error
+	if i.validateRebase {
+		if err = validateRebase(i.Image, newBase); err != nil {
+			return err
+		}
+	}
 	i.Image, err = mutate.Rebase(i.Image, i.newV1ImageFacade(baseTopLayerDiffID), newBase)
 	if err != nil {
 		return err
 	}
+	if err = i.checkInvariants("Rebase"); err != nil {
+		return err
+	}
 
 	// ensure new config matches provided image
 	newBaseConfigFile, err := getConfigFile(newBase)
 	if err != nil {
 		return err
 	}
+	i.baseImage = newBase
+	i.baseLayerCount = len(newBaseConfigFile.RootFS.DiffIDs)
 	return i.MutateConfigFile(func(c *v1.ConfigFile) {
 		c.Architecture = newBaseConfigFile.Architecture
 		c.OS = newBaseConfigFile.OS
@@ -489,6 +654,9 @@ func getLayerIndex(forDiffID string, fromImage v1.Image) (int, error) {
 	if err != nil {
 		return -1, fmt.Errorf("failed to get config file: %w", err)
 	}
+	if layerHash, _, err = layerDiffID(fromImage, layerHash); err != nil {
+		return -1, fmt.Errorf("failed to get layers: %w", err)
+	}
 	for idx, configHash := range configFile.RootFS.DiffIDs {
 		if layerHash.String() == configHash.String() {
 			return idx, nil
@@ -522,6 +690,9 @@ func (i *CNBImageCore) ReuseLayerWithHistory(diffID string, history v1.History)
 	if err != nil {
 		return fmt.Errorf("failed to get layer hash: %w", err)
 	}
+	if layerHash, _, err = layerDiffID(i.previousImage, layerHash); err != nil {
+		return fmt.Errorf("failed to get previous image layers: %w", err)
+	}
 	layer, err := i.previousImage.LayerByDiffID(layerHash)
 	if err != nil {
 		return fmt.Errorf("failed to get layer by diffID: %w", err)
@@ -529,17 +700,73 @@ func (i *CNBImageCore) ReuseLayerWithHistory(diffID string, history v1.History)
 	if i.preserveHistory {
 		history.Created = v1.Time{Time: i.createdAt}
 	} else {
-		history = emptyHistory
+		history = zeroHistory(history, emptyHistory.Created)
 	}
 	i.Image, err = mutate.Append(
 		i.Image,
 		mutate.Addendum{
-			Layer:     layer,
-			History:   history,
-			MediaType: i.preferredMediaTypes.LayerType(),
+			Layer:       layer,
+			History:     history,
+			MediaType:   layerMediaType(layer, i.preferredMediaTypes.LayerType()),
+			Annotations: encryptionAnnotations(layer),
 		},
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	return i.checkInvariants("ReuseLayer")
+}
+
+// ReuseBaseImageLayers replaces the layers of the working image that came from the base image
+// with the layers of the previous image that have the same diff IDs, keeping their history and annotations.
+// The previous image is typically saved where the working image will be saved, so its layers need not be copied there.
+func (i *CNBImageCore) ReuseBaseImageLayers() error {
+	if i.previousImage == nil {
+		return errors.New("failed to reuse base image layers because no previous image was provided")
+	}
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return err
+	}
+	manifest, err := getManifest(i.Image)
+	if err != nil {
+		return err
+	}
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return err
+	}
+	if len(manifest.Layers) != len(layers) || len(configFile.RootFS.DiffIDs) != len(layers) {
+		return fmt.Errorf("manifest has %d layers; image has %d", len(manifest.Layers), len(layers))
+	}
+	prevConfigFile, err := getConfigFile(i.previousImage)
+	if err != nil {
+		return fmt.Errorf("failed to get previous image config: %w", err)
+	}
+
+	var (
+		reused      bool
+		annotations = make([]map[string]string, len(layers))
+	)
+	for idx := 0; idx < len(layers); idx++ {
+		annotations[idx] = manifest.Layers[idx].Annotations
+		diffID := configFile.RootFS.DiffIDs[idx]
+		if idx >= i.baseLayerCount || !contains(prevConfigFile.RootFS.DiffIDs, diffID) {
+			continue
+		}
+		if layers[idx], err = i.previousImage.LayerByDiffID(diffID); err != nil {
+			return fmt.Errorf("failed to get previous image layer by diffID: %w", err)
+		}
+		reused = true
+	}
+	if !reused {
+		return nil
+	}
+	history := NormalizedHistory(configFile.History, len(layers))
+	if i.Image, err = i.withLayers(configFile, layers, history, annotations); err != nil {
+		return err
+	}
+	return i.checkInvariants("ReuseBaseImageLayers")
 }
 
 // helpers
@@ -552,9 +779,36 @@ func (i *CNBImageCore) MutateConfigFile(withFunc func(c *v1.ConfigFile)) error {
 	}
 	withFunc(configFile)
 	i.Image, err = mutate.ConfigFile(i.Image, configFile)
-	return err
+	if err != nil {
+		return err
+	}
+	return i.checkInvariants("MutateConfigFile")
+}
+
+// LoadFrom replaces the working image with the image read from an archive in either DockerArchive or OCIArchive format.
+// The archive is staged in a temporary directory, as layers are read lazily; it is removed by Cleanup.
+func (i *CNBImageCore) LoadFrom(r io.Reader) error {
+	stagingDir, err := i.tempFiles.MkdirTemp("imgutil.archive.*")
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	image, err := ReadArchive(r, stagingDir)
+	if err != nil {
+		_ = i.tempFiles.Discard(stagingDir)
+		return err
+	}
+	i.Image = image
+	return i.checkInvariants("LoadFrom")
 }
 
+// Cleanup removes the intermediate files created for the image, unless they are kept for debugging.
+// Layers backed by those files can no longer be read afterwards, so it should be called once the image is no longer in use.
+func (i *CNBImageCore) Cleanup() error {
+	return i.tempFiles.Cleanup()
+}
+
+// SetCreatedAtAndHistory normalizes the image before it is saved, so that saving the same contents produces the same digest.
+// With WithCanonicalJSON, the config and manifest are also encoded canonically.
 func (i *CNBImageCore) SetCreatedAtAndHistory() error {
 	var err error
 	// set created at
@@ -572,16 +826,23 @@ func (i *CNBImageCore) SetCreatedAtAndHistory() error {
 			for j := range c.History {
 				c.History[j].Created = v1.Time{Time: i.createdAt}
 			}
+			i.stripBuildOnlyMarkers(c)
 		})
 	} else {
 		// zero history
 		err = i.MutateConfigFile(func(c *v1.ConfigFile) {
 			c.History = NormalizedHistory(c.History, len(c.RootFS.DiffIDs))
 			for j := range c.History {
-				c.History[j] = v1.History{Created: v1.Time{Time: i.createdAt}}
+				c.History[j] = zeroHistory(c.History[j], v1.Time{Time: i.createdAt})
 			}
+			i.stripBuildOnlyMarkers(c)
 		})
 	}
+	if err != nil || !i.canonicalJSON {
+		return err
+	}
+	// encode the config and manifest canonically, so that the digest does not depend on how they were encoded
+	i.Image, err = CanonicalImage(i.Image)
 	return err
 }
 
@@ -0,0 +1,177 @@
+package imgutil_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestCNBImage(t *testing.T) {
+	spec.Run(t, "CNBImage", testCNBImage, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testCNBImage(t *testing.T, when spec.G, it spec.S) {
+	when("#SetStopSignal", func() {
+		it("keeps the stop signal through layer mutations and media type changes", func() {
+			image, err := imgutil.NewCNBImage(imgutil.ImageOptions{MediaTypes: imgutil.DockerTypes})
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.SetStopSignal("SIGQUIT"))
+
+			for idx := 0; idx < 3; idx++ {
+				layer, err := random.Layer(100, types.DockerLayer)
+				h.AssertNil(t, err)
+				h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{}))
+			}
+			h.AssertNil(t, image.SquashLayers(""))
+			h.AssertNil(t, image.SetCreatedAtAndHistory())
+			converted, _, err := imgutil.EnsureMediaTypesAndLayers(image, imgutil.OCITypes, imgutil.PreserveLayers)
+			h.AssertNil(t, err)
+
+			signal, err := image.StopSignal()
+			h.AssertNil(t, err)
+			h.AssertEq(t, signal, "SIGQUIT")
+			configFile, err := converted.ConfigFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, configFile.Config.StopSignal, "SIGQUIT")
+		})
+	})
+
+	when("#SetCreatedAtAndHistory", func() {
+		var base v1.Image
+
+		it.Before(func() {
+			var err error
+			base, err = random.Image(100, 1)
+			h.AssertNil(t, err)
+			base, err = mutate.Config(base, v1.Config{Labels: map[string]string{"url": "https://example.com?a=1&b=2"}})
+			h.AssertNil(t, err)
+		})
+
+		it("keeps the default encoding of the config", func() {
+			image, err := imgutil.NewCNBImage(imgutil.ImageOptions{BaseImage: base})
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.SetCreatedAtAndHistory())
+
+			rawConfig, err := image.RawConfigFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, strings.Contains(string(rawConfig), `a=1\u0026b=2`), true)
+		})
+
+		it("encodes the config and manifest canonically with WithCanonicalJSON", func() {
+			options := &imgutil.ImageOptions{BaseImage: base}
+			imgutil.WithCanonicalJSON()(options)
+			image, err := imgutil.NewCNBImage(*options)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.SetCreatedAtAndHistory())
+
+			rawConfig, err := image.RawConfigFile()
+			h.AssertNil(t, err)
+			expectedConfig, err := imgutil.Canonicalize(rawConfig)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(rawConfig), string(expectedConfig))
+			h.AssertEq(t, strings.Contains(string(rawConfig), "a=1&b=2"), true)
+			rawManifest, err := image.RawManifest()
+			h.AssertNil(t, err)
+			expectedManifest, err := imgutil.Canonicalize(rawManifest)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(rawManifest), string(expectedManifest))
+		})
+	})
+
+	when("#Inspect", func() {
+		it("returns the manifest, config, history and platform of the image as JSON", func() {
+			image, err := imgutil.NewCNBImage(imgutil.ImageOptions{
+				Platform: imgutil.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			})
+			h.AssertNil(t, err)
+			layer, err := random.Layer(100, types.DockerLayer)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{}))
+
+			out, err := image.Inspect()
+			h.AssertNil(t, err)
+			var inspection imgutil.ImageInspection
+			h.AssertNil(t, json.Unmarshal([]byte(out), &inspection))
+
+			digest, err := image.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, inspection.Digest, digest.String())
+			h.AssertEq(t, inspection.Platform, &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})
+			h.AssertEq(t, len(inspection.Manifest.Layers), 1)
+			h.AssertEq(t, inspection.Config.Architecture, "arm64")
+			history, err := image.History()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(inspection.History), len(history))
+		})
+	})
+
+	when("#TotalSize", func() {
+		it("adds up the sizes of the manifest, the config and the layers", func() {
+			base, err := random.Image(100, 2)
+			h.AssertNil(t, err)
+			image, err := imgutil.NewCNBImage(imgutil.ImageOptions{BaseImage: base})
+			h.AssertNil(t, err)
+
+			layerSizes, err := image.LayerSizes()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(layerSizes), 2)
+			manifest, err := image.Manifest()
+			h.AssertNil(t, err)
+			manifestSize, err := image.ManifestSize()
+			h.AssertNil(t, err)
+			total, err := image.TotalSize()
+			h.AssertNil(t, err)
+			h.AssertEq(t, total, manifestSize+manifest.Config.Size+layerSizes[0]+layerSizes[1])
+
+			layers, err := base.Layers()
+			h.AssertNil(t, err)
+			size, err := layers[1].Size()
+			h.AssertNil(t, err)
+			h.AssertEq(t, layerSizes[1], size)
+		})
+	})
+
+	when("#DiffSummary", func() {
+		it("summarizes the layers, config and labels added to the base image", func() {
+			base, err := random.Image(100, 2)
+			h.AssertNil(t, err)
+			base, err = mutate.Config(base, v1.Config{
+				Entrypoint: []string{"/bin/sh"},
+				Labels:     map[string]string{"kept": "value", "changed": "old", "removed": "value"},
+			})
+			h.AssertNil(t, err)
+			image, err := imgutil.NewCNBImage(imgutil.ImageOptions{BaseImage: base})
+			h.AssertNil(t, err)
+
+			layer, err := random.Layer(100, types.DockerLayer)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{}))
+			h.AssertNil(t, image.SetEntrypoint("/cnb/lifecycle/launcher"))
+			h.AssertNil(t, image.SetWorkingDir("/workspace"))
+			h.AssertNil(t, image.SetLabel("changed", "new"))
+			h.AssertNil(t, image.SetLabel("added", "value"))
+			h.AssertNil(t, image.RemoveLabel("removed"))
+
+			summary, err := image.DiffSummary()
+			h.AssertNil(t, err)
+			layerSize, err := layer.Size()
+			h.AssertNil(t, err)
+			h.AssertEq(t, summary.NewLayers, 1)
+			h.AssertEq(t, summary.NewLayersSize, layerSize)
+			h.AssertEq(t, summary.ChangedConfigFields, []string{"Entrypoint", "WorkingDir"})
+			h.AssertEq(t, summary.AddedLabels, map[string]string{"added": "value"})
+			h.AssertEq(t, summary.ChangedLabels, map[string]string{"changed": "new"})
+			h.AssertEq(t, summary.RemovedLabels, []string{"removed"})
+		})
+	})
+}
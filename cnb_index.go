@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -20,9 +22,15 @@ import (
 
 var (
 	ErrManifestUndefined = errors.New("encountered unexpected error while parsing image: manifest or index manifest is nil")
-	ErrUnknownMediaType  = func(format types.MediaType) error {
-		return fmt.Errorf("unsupported media type encountered in image: '%s'", format)
-	}
+	// ErrUnknownMediaType returns an ErrUnsupportedMediaType for the given media type.
+	//
+	// Deprecated: use ErrUnsupportedMediaType, which can be matched with errors.As.
+	ErrUnknownMediaType = func(format types.MediaType) error {
+		return ErrUnsupportedMediaType{MediaType: format}
+	}
+	// ErrPushToDigestReference is returned by Push for an index named by a digest reference when no tag is provided,
+	// as an index cannot be changed in place: it can only be pushed under a new tag of the same repository.
+	ErrPushToDigestReference = errors.New("cannot push an index to a digest reference; provide the tags to push it to with WithTags")
 )
 
 type CNBIndex struct {
@@ -33,8 +41,32 @@ type CNBIndex struct {
 	// push options
 	KeyChain authn.Keychain
 	RepoName string
+
+	// lockTimeout is how long SaveDir and DeleteDir wait for other writers to release the index directory
+	lockTimeout time.Duration
+	// registrySettings are the settings of the registries given with WithRegistriesConfig, used by Push
+	registrySettings map[string]RegistrySetting
+	// remoteOptions are the remote options given with remote.WithIndexRemoteOptions, which configure the transport of Push
+	remoteOptions RemoteOptions
+	// canonicalJSON causes the index manifest to be encoded canonically when it is pushed; see WithIndexCanonicalJSON
+	canonicalJSON bool
+	logger        Logger
+	metrics       MetricsHook
+
+	// artifactType is the artifactType of the index manifest, kept apart from ImageIndex as v1.IndexManifest has no field for it
+	artifactType string
+
+	// savedIndex is the index as it was created or last saved, restored by ResetPendingChanges
+	savedIndex        v1.ImageIndex
+	savedArtifactType string
+	pendingChanges    []IndexChange
+	// savedDigest is the digest of index.json in the store when the index was created or last saved,
+	// which SaveDir checks so that it does not overwrite the changes of another writer
+	savedDigest v1.Hash
 }
 
+// getDescriptorFrom returns a deep copy of the descriptor with the given digest;
+// changes to it are only made to the index by replaceDescriptor.
 func (h *CNBIndex) getDescriptorFrom(digest name.Digest) (v1.Descriptor, error) {
 	indexManifest, err := getIndexManifest(h.ImageIndex)
 	if err != nil {
@@ -42,10 +74,58 @@ func (h *CNBIndex) getDescriptorFrom(digest name.Digest) (v1.Descriptor, error)
 	}
 	for _, current := range indexManifest.Manifests {
 		if current.Digest.String() == digest.Identifier() {
-			return current, nil
+			return copyDescriptor(current), nil
 		}
 	}
-	return v1.Descriptor{}, fmt.Errorf("failed to find image with digest %s in index", digest.Identifier())
+	return v1.Descriptor{}, ErrManifestNotFound{Digest: digest.Identifier()}
+}
+
+// Found reports if the index exists in the local store, i.e. it was saved with SaveDir and not deleted since.
+func (h *CNBIndex) Found() bool {
+	_, err := os.Stat(filepath.Join(StorePath(h.XdgPath, h.RepoName), "index.json"))
+	return err == nil
+}
+
+// Valid returns true if the index is well-formed.
+func (h *CNBIndex) Valid() bool {
+	return h.validate() == nil
+}
+
+// validate checks that the index has an index media type, and that each of its manifests
+// has a parseable digest, a size, a known media type, and a platform with both os and architecture if any,
+// where WebAssembly os values are only used with the wasm architecture.
+func (h *CNBIndex) validate() error {
+	mediaType, err := h.ImageIndex.MediaType()
+	if err != nil {
+		return err
+	}
+	if !mediaType.IsIndex() {
+		return ErrUnsupportedMediaType{MediaType: mediaType}
+	}
+	indexManifest, err := getIndexManifest(h.ImageIndex)
+	if err != nil {
+		return err
+	}
+	for _, desc := range indexManifest.Manifests {
+		if _, err = v1.NewHash(desc.Digest.String()); err != nil {
+			return fmt.Errorf("invalid digest for manifest: %w", err)
+		}
+		if desc.Size <= 0 {
+			return fmt.Errorf("invalid size %d for manifest %s", desc.Size, desc.Digest)
+		}
+		if !desc.MediaType.IsImage() && !desc.MediaType.IsIndex() {
+			return fmt.Errorf("invalid media type '%s' for manifest %s", desc.MediaType, desc.Digest)
+		}
+		if desc.Platform != nil && (desc.Platform.OS == "" || desc.Platform.Architecture == "") {
+			return fmt.Errorf("invalid platform '%s' for manifest %s", desc.Platform, desc.Digest)
+		}
+		if desc.Platform != nil {
+			if err = validatePlatform(desc.Platform.OS, desc.Platform.Architecture); err != nil {
+				return fmt.Errorf("%w for manifest %s", err, desc.Digest)
+			}
+		}
+	}
+	return nil
 }
 
 // OS returns `OS` of an existing Image.
@@ -101,6 +181,7 @@ func (h *CNBIndex) OSVersion(digest name.Digest) (osVersion string, err error) {
 
 // OSFeatures returns the `OSFeatures` of an Image with given Digest.
 // Returns an error if no Image/Index found with given Digest.
+// The returned slice is a copy; changing it does not change the index.
 func (h *CNBIndex) OSFeatures(digest name.Digest) (osFeatures []string, err error) {
 	desc, err := h.getDescriptorFrom(digest)
 	if err != nil {
@@ -115,6 +196,7 @@ func (h *CNBIndex) OSFeatures(digest name.Digest) (osFeatures []string, err erro
 // Annotations return the `Annotations` of an Image with given Digest.
 // Returns an error if no Image/Index found with given Digest.
 // For Docker images and Indexes it returns an error.
+// The returned map is a copy; use SetAnnotations to change the index.
 func (h *CNBIndex) Annotations(digest name.Digest) (annotations map[string]string, err error) {
 	desc, err := h.getDescriptorFrom(digest)
 	if err != nil {
@@ -126,7 +208,8 @@ func (h *CNBIndex) Annotations(digest name.Digest) (annotations map[string]strin
 // setters
 
 func (h *CNBIndex) SetAnnotations(digest name.Digest, annotations map[string]string) (err error) {
-	return h.replaceDescriptor(digest, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
+	change := IndexChange{Operation: SetAnnotationsOperation, Annotations: copyMap(annotations)}
+	return h.replaceDescriptor(digest, change, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
 		if len(descriptor.Annotations) == 0 {
 			descriptor.Annotations = make(map[string]string)
 		}
@@ -139,32 +222,52 @@ func (h *CNBIndex) SetAnnotations(digest name.Digest, annotations map[string]str
 }
 
 func (h *CNBIndex) SetArchitecture(digest name.Digest, arch string) (err error) {
-	return h.replaceDescriptor(digest, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
+	change := IndexChange{Operation: SetArchitectureOperation, Value: arch}
+	return h.replaceDescriptor(digest, change, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
 		descriptor.Platform.Architecture = arch
 		return descriptor, nil
 	})
 }
 
 func (h *CNBIndex) SetOS(digest name.Digest, os string) (err error) {
-	return h.replaceDescriptor(digest, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
+	change := IndexChange{Operation: SetOSOperation, Value: os}
+	return h.replaceDescriptor(digest, change, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
 		descriptor.Platform.OS = os
 		return descriptor, nil
 	})
 }
 
 func (h *CNBIndex) SetVariant(digest name.Digest, osVariant string) (err error) {
-	return h.replaceDescriptor(digest, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
+	change := IndexChange{Operation: SetVariantOperation, Value: osVariant}
+	return h.replaceDescriptor(digest, change, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
 		descriptor.Platform.Variant = osVariant
 		return descriptor, nil
 	})
 }
 
-func (h *CNBIndex) replaceDescriptor(digest name.Digest, withFun func(descriptor v1.Descriptor) (v1.Descriptor, error)) (err error) {
+// SetPlatform sets the os, architecture, variant and os version of the Image with the given digest to those of the platform,
+// keeping any other platform fields (e.g. os features).
+func (h *CNBIndex) SetPlatform(digest name.Digest, platform Platform) (err error) {
+	change := IndexChange{Operation: SetPlatformOperation, Platform: &platform}
+	return h.replaceDescriptor(digest, change, func(descriptor v1.Descriptor) (v1.Descriptor, error) {
+		descriptor.Platform.OS = platform.OS
+		descriptor.Platform.Architecture = platform.Architecture
+		descriptor.Platform.Variant = platform.Variant
+		descriptor.Platform.OSVersion = platform.OSVersion
+		return descriptor, nil
+	})
+}
+
+func (h *CNBIndex) replaceDescriptor(digest name.Digest, change IndexChange, withFun func(descriptor v1.Descriptor) (v1.Descriptor, error)) (err error) {
+	before := h.ImageIndex
 	desc, err := h.getDescriptorFrom(digest)
 	if err != nil {
 		return err
 	}
-	mediaType := desc.MediaType
+	mediaType, err := h.ImageIndex.MediaType()
+	if err != nil {
+		return err
+	}
 	if desc.Platform == nil {
 		desc.Platform = &v1.Platform{}
 	}
@@ -186,16 +289,101 @@ func (h *CNBIndex) replaceDescriptor(digest name.Digest, withFun func(descriptor
 	if mediaTypeAfter != mediaType {
 		h.ImageIndex = mutate.IndexMediaType(h.ImageIndex, mediaType)
 	}
+	change.Digest = desc.Digest
+	h.recordChange(before, change)
 	return nil
 }
 
+// ConvertToOCI converts a Docker manifest list to an OCI image index, which has a place for the annotations set with
+// SetAnnotations, so that they are kept by registries and tools that follow the Docker manifest list schema.
+// The annotations of the index and its manifests are carried over; the manifests it refers to are not changed.
+// An OCI image index is left as it is.
+func (h *CNBIndex) ConvertToOCI() error {
+	mediaType, err := h.ImageIndex.MediaType()
+	if err != nil {
+		return err
+	}
+	if mediaType == types.OCIImageIndex {
+		return nil
+	}
+	if mediaType != types.DockerManifestList {
+		return ErrUnsupportedMediaType{MediaType: mediaType}
+	}
+	before := h.ImageIndex
+	h.ImageIndex = mutate.IndexMediaType(h.ImageIndex, types.OCIImageIndex)
+	h.recordChange(before, IndexChange{Operation: ConvertToOCIOperation, Value: string(types.OCIImageIndex)})
+	return nil
+}
+
+// ArtifactType returns the artifactType of the index manifest, or "" if it has none.
+func (h *CNBIndex) ArtifactType() string {
+	return h.artifactType
+}
+
+// Subject returns the descriptor of the manifest the index refers to, or nil if it has none.
+func (h *CNBIndex) Subject() (*v1.Descriptor, error) {
+	indexManifest, err := getIndexManifest(h.ImageIndex)
+	if err != nil {
+		return nil, err
+	}
+	if indexManifest.Subject == nil {
+		return nil, nil
+	}
+	return indexManifest.Subject.DeepCopy(), nil
+}
+
+// SetArtifactType sets the artifactType of the index manifest. Only OCI indexes have an artifactType.
+func (h *CNBIndex) SetArtifactType(artifactType string) error {
+	if err := h.requireOCI("artifactType"); err != nil {
+		return err
+	}
+	before := h.ImageIndex
+	h.artifactType = artifactType
+	h.recordChange(before, IndexChange{Operation: SetArtifactTypeOperation, Value: artifactType})
+	return nil
+}
+
+// SetSubject sets the manifest the index refers to, e.g. the image an index of attestations is about.
+// Only OCI indexes have a subject.
+func (h *CNBIndex) SetSubject(subject v1.Descriptor) error {
+	if err := h.requireOCI("subject"); err != nil {
+		return err
+	}
+	if subject.MediaType == "" || subject.Digest == (v1.Hash{}) || subject.Size <= 0 {
+		return errors.New("subject must have a mediaType, digest and size")
+	}
+	before := h.ImageIndex
+	h.ImageIndex = mutate.Subject(h.ImageIndex, subject).(v1.ImageIndex)
+	h.recordChange(before, IndexChange{Operation: SetSubjectOperation, Digest: subject.Digest})
+	return nil
+}
+
+func (h *CNBIndex) requireOCI(field string) error {
+	mediaType, err := h.ImageIndex.MediaType()
+	if err != nil {
+		return err
+	}
+	if mediaType != types.OCIImageIndex {
+		return fmt.Errorf("cannot set the %s of index %s: only OCI indexes have one, got media type %s", field, h.RepoName, mediaType)
+	}
+	return nil
+}
+
+// taggableIndex returns the index to write to a registry or a layout, with its artifactType.
+func (h *CNBIndex) taggableIndex(indexManifest *v1.IndexManifest) *TaggableIndex {
+	taggableIndex := NewTaggableIndex(indexManifest)
+	taggableIndex.ArtifactType = h.artifactType
+	taggableIndex.Canonical = h.canonicalJSON
+	return taggableIndex
+}
+
 func (h *CNBIndex) Image(hash v1.Hash) (v1.Image, error) {
 	index, err := h.IndexManifest()
 	if err != nil {
 		return nil, err
 	}
 	if !indexContains(index.Manifests, hash) {
-		return nil, fmt.Errorf("failed to find image with digest %s in index", hash.String())
+		return nil, ErrManifestNotFound{Digest: hash.String()}
 	}
 	return h.ImageIndex.Image(hash)
 }
@@ -210,22 +398,77 @@ func indexContains(manifests []v1.Descriptor, hash v1.Hash) bool {
 }
 
 // AddManifest adds an image to the index.
+// The change is made in memory; it is written to the local store, under the index lock, by SaveDir.
 func (h *CNBIndex) AddManifest(image v1.Image) {
+	before := h.ImageIndex
 	desc, _ := descriptor(image)
 	h.ImageIndex = mutate.AppendManifests(h.ImageIndex, mutate.IndexAddendum{
 		Add:        image,
 		Descriptor: desc,
 	})
+	digest, _ := image.Digest()
+	h.recordChange(before, IndexChange{Operation: AddManifestOperation, Digest: digest})
+}
+
+// ReplaceManifest adds an image to the index, removing the images (and their attestations) for the same platform,
+// so that an image can be updated for one platform while the others are kept. Images for the same OS and architecture
+// with an os.version of another Windows build (see OSVersionMatches) are kept, e.g. to update the Windows Server 2022 image
+// of an index that also has a Windows Server 2019 image.
+func (h *CNBIndex) ReplaceManifest(image v1.Image) error {
+	desc, err := descriptor(image)
+	if err != nil {
+		return err
+	}
+	indexManifest, err := getIndexManifest(h.ImageIndex)
+	if err != nil {
+		return err
+	}
+	for _, existing := range indexManifest.Manifests {
+		if !existing.MediaType.IsImage() || existing.Platform == nil || desc.Platform == nil || isAttestation(existing) {
+			continue
+		}
+		if !sameOS(existing.Platform.OS, desc.Platform.OS) || existing.Platform.Architecture != desc.Platform.Architecture ||
+			existing.Platform.Variant != desc.Platform.Variant || !sameOSVersionBuild(existing.Platform.OSVersion, desc.Platform.OSVersion) {
+			continue
+		}
+		if err = h.removeManifest(existing.Digest); err != nil {
+			return err
+		}
+	}
+	h.AddManifest(image)
+	return nil
+}
+
+// BestMatch returns the descriptor of the image in the index that best matches the platform; see BestMatch.
+func (h *CNBIndex) BestMatch(platform Platform) (v1.Descriptor, error) {
+	return BestMatch(h.ImageIndex, platform)
 }
 
 // SaveDir will locally save the index.
-func (h *CNBIndex) SaveDir() error {
-	layoutPath := filepath.Join(h.XdgPath, MakeFileSafeName(h.RepoName)) // FIXME: do we create an OCI-layout compatible directory structure?
-	var (
-		path layout.Path
-		err  error
-	)
+// It holds the index lock while writing, so concurrent writers to the same index do not corrupt it; see LockDir.
+// As the index is read and changed before it is saved, it fails with ErrIndexModified if another writer saved the index
+// in the meantime, instead of losing their changes.
+func (h *CNBIndex) SaveDir() (err error) {
+	layoutPath := storeDir(h.XdgPath, h.RepoName) // FIXME: do we create an OCI-layout compatible directory structure?
+	end := StartOperation(h.metrics, OperationLayoutWrite, layoutPath)
+	defer func() { end(0, err) }()
+	unlock, err := LockDir(layoutPath, h.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	stored, err := storedIndexDigest(StorePath(h.XdgPath, h.RepoName))
+	if err != nil {
+		return err
+	}
+	if stored != (v1.Hash{}) && stored != h.savedDigest {
+		return ErrIndexModified{Path: layoutPath}
+	}
+
+	var path layout.Path
 
+	Debugf(h.logger, "saving index %s to %s", h.RepoName, layoutPath)
 	if _, err = os.Stat(layoutPath); !os.IsNotExist(err) {
 		// We need to always init an empty index when saving
 		if err = os.RemoveAll(layoutPath); err != nil {
@@ -252,9 +495,41 @@ func (h *CNBIndex) SaveDir() error {
 	if len(errs.Errors) != 0 {
 		return errs
 	}
+	if index.Subject != nil || h.artifactType != "" {
+		// appending descriptors only writes the manifests to index.json
+		raw, err := h.taggableIndex(index).RawManifest()
+		if err != nil {
+			return err
+		}
+		if err = path.WriteFile("index.json", raw, 0644); err != nil {
+			return err
+		}
+	}
+	// the index is now found under its current name, so a copy saved under its previous name is stale
+	if err = removeLegacyStorePath(h.XdgPath, h.RepoName); err != nil {
+		return err
+	}
+	if h.savedDigest, err = storedIndexDigest(layoutPath); err != nil {
+		return err
+	}
+	h.markSaved()
 	return nil
 }
 
+// storedIndexDigest returns the digest of index.json of the index stored at path, or the zero hash if there is none.
+func storedIndexDigest(path string) (v1.Hash, error) {
+	f, err := os.Open(filepath.Join(path, "index.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return v1.Hash{}, nil
+		}
+		return v1.Hash{}, err
+	}
+	defer f.Close()
+	digest, _, err := v1.SHA256(f)
+	return digest, err
+}
+
 func appendManifest(desc v1.Descriptor, path layout.Path, errs *SaveError) {
 	if err := path.RemoveDescriptors(match.Digests(desc.Digest)); err != nil {
 		errs.Errors = append(errs.Errors, SaveDiagnostic{
@@ -288,7 +563,7 @@ func (h *CNBIndex) Push(ops ...IndexOption) error {
 
 	if pushOps.MediaType != "" {
 		if !pushOps.MediaType.IsIndex() {
-			return ErrUnknownMediaType(pushOps.MediaType)
+			return ErrUnsupportedMediaType{MediaType: pushOps.MediaType}
 		}
 		existingType, err := h.ImageIndex.MediaType()
 		if err != nil {
@@ -299,6 +574,16 @@ func (h *CNBIndex) Push(ops ...IndexOption) error {
 		}
 	}
 
+	registrySettings := h.registrySettings
+	if pushOps.RegistrySettings != nil {
+		registrySettings = pushOps.RegistrySettings
+	}
+	_, reg := LookupRegistrySetting(h.RepoName, registrySettings)
+	if reg.Blocked {
+		return ErrBlockedRegistry{RepoName: h.RepoName}
+	}
+	reg.Insecure = pushOps.Insecure || reg.Insecure
+
 	ref, err := name.ParseReference(
 		h.RepoName,
 		name.WeakValidation,
@@ -308,42 +593,134 @@ func (h *CNBIndex) Push(ops ...IndexOption) error {
 		return err
 	}
 
-	indexManifest, err := getIndexManifest(h.ImageIndex)
+	pushedIndex := h.ImageIndex
+	if len(pushOps.Platforms) > 0 {
+		if pushedIndex, err = withPlatforms(h.ImageIndex, pushOps.Platforms); err != nil {
+			return err
+		}
+	}
+
+	if pushOps.ValidateBeforePush {
+		violations, err := ValidateIndexSpec(pushedIndex)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			return ErrSpecViolations{Name: h.RepoName, Violations: violations}
+		}
+	}
+
+	indexManifest, err := getIndexManifest(pushedIndex)
 	if err != nil {
 		return err
 	}
 
-	var taggableIndex = NewTaggableIndex(indexManifest)
-	multiWriteTagables := map[name.Reference]remote.Taggable{
-		ref: taggableIndex,
+	var taggableIndex = h.taggableIndex(indexManifest)
+	multiWriteTagables := map[name.Reference]remote.Taggable{}
+	if _, isDigest := ref.(name.Digest); isDigest {
+		// the index is only pushed to the given tags
+		if len(pushOps.DestinationTags) == 0 {
+			return ErrPushToDigestReference
+		}
+	} else {
+		multiWriteTagables[ref] = taggableIndex
 	}
 	for _, tag := range pushOps.DestinationTags {
 		multiWriteTagables[ref.Context().Tag(tag)] = taggableIndex
 	}
 
+	for taggedRef := range multiWriteTagables {
+		Debugf(h.logger, "pushing index %s with %d manifests to %s", taggedRef.Name(), len(indexManifest.Manifests), taggedRef.Context().RegistryStr())
+	}
 	// Note: this will only push the index manifest, assuming that all the images it refers to exists in the registry
+	end := StartOperation(h.metrics, OperationPush, h.RepoName)
 	err = remote.MultiWrite(
 		multiWriteTagables,
 		remote.WithAuthFromKeychain(h.KeyChain),
-		remote.WithTransport(GetTransport(pushOps.Insecure)),
+		remote.WithTransport(registryTransport(reg, h.remoteOptions, h.logger)),
 	)
+	end(0, err)
 	if err != nil {
 		return err
 	}
 
+	if !pushOps.PreserveOtherPlatforms {
+		h.ImageIndex = pushedIndex
+	}
 	if pushOps.Purge {
-		return h.DeleteDir()
+		if err = h.DeleteDir(); err != nil {
+			return err
+		}
+		h.markSaved()
+		return nil
 	}
 	return h.SaveDir()
 }
 
+// withPlatforms returns the index with only the manifests that satisfy one of the given platforms.
+func withPlatforms(index v1.ImageIndex, platforms []v1.Platform) (v1.ImageIndex, error) {
+	indexManifest, err := getIndexManifest(index)
+	if err != nil {
+		return nil, err
+	}
+	matches := func(desc v1.Descriptor) bool {
+		if desc.Platform == nil || isAttestation(desc) {
+			return false
+		}
+		for _, platform := range platforms {
+			if desc.Platform.Satisfies(platform) {
+				return true
+			}
+		}
+		return false
+	}
+	var found bool
+	for _, desc := range indexManifest.Manifests {
+		if matches(desc) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, ErrPlatformsNotFound{Platforms: platforms}
+	}
+	// attestations are kept with their subject
+	attestations := attestationsOf(indexManifest, matches)
+	return mutate.RemoveManifests(index, func(desc v1.Descriptor) bool {
+		return !matches(desc) && !attestations(desc)
+	}), nil
+}
+
 // Inspect Displays IndexManifest.
-func (h *CNBIndex) Inspect() (string, error) {
-	rawManifest, err := h.RawManifest()
+func (h *CNBIndex) Inspect(ops ...IndexOption) (string, error) {
+	var inspectOps = &IndexOptions{}
+	for _, op := range ops {
+		if err := op(inspectOps); err != nil {
+			return "", err
+		}
+	}
+	if inspectOps.InspectTemplate == nil && inspectOps.InspectFormat != InspectTable {
+		rawManifest, err := h.RawManifest()
+		if err != nil {
+			return "", err
+		}
+		return string(rawManifest), nil
+	}
+	indexManifest, err := getIndexManifest(h.ImageIndex)
 	if err != nil {
 		return "", err
 	}
-	return string(rawManifest), nil
+	var out strings.Builder
+	if inspectOps.InspectTemplate != nil {
+		if err = inspectOps.InspectTemplate.Execute(&out, indexManifest); err != nil {
+			return "", fmt.Errorf("rendering inspect template: %w", err)
+		}
+		return out.String(), nil
+	}
+	if err = writeIndexTable(&out, indexManifest); err != nil {
+		return "", err
+	}
+	return out.String(), nil
 }
 
 // RemoveManifest removes an image with a given digest from the index.
@@ -352,21 +729,76 @@ func (h *CNBIndex) RemoveManifest(digest name.Digest) (err error) {
 	if err != nil {
 		return err
 	}
-	h.ImageIndex = mutate.RemoveManifests(h.ImageIndex, match.Digests(hash))
-	_, err = h.ImageIndex.Digest() // force compute
-	return err
+	return h.removeManifest(hash)
 }
 
-// DeleteDir removes the index from the local filesystem if it exists.
+func (h *CNBIndex) removeManifest(hash v1.Hash) error {
+	indexManifest, err := getIndexManifest(h.ImageIndex)
+	if err != nil {
+		return err
+	}
+	// attestations are removed with their subject
+	attestations := attestationsOf(indexManifest, match.Digests(hash))
+	before := h.ImageIndex
+	h.ImageIndex = mutate.RemoveManifests(h.ImageIndex, func(desc v1.Descriptor) bool {
+		return desc.Digest == hash || attestations(desc)
+	})
+	if _, err = h.ImageIndex.Digest(); err != nil { // force compute
+		return err
+	}
+	h.recordChange(before, IndexChange{Operation: RemoveManifestOperation, Digest: hash})
+	return nil
+}
+
+// PendingChanges returns the changes made to the index since it was created or last saved, in the order they were made.
+func (h *CNBIndex) PendingChanges() []IndexChange {
+	changes := make([]IndexChange, len(h.pendingChanges))
+	for idx, change := range h.pendingChanges {
+		change.Annotations = copyMap(change.Annotations)
+		changes[idx] = change
+	}
+	return changes
+}
+
+// ResetPendingChanges discards the changes made to the index since it was created or last saved.
+func (h *CNBIndex) ResetPendingChanges() {
+	if h.savedIndex != nil {
+		h.ImageIndex = h.savedIndex
+	}
+	h.artifactType = h.savedArtifactType
+	h.pendingChanges = nil
+}
+
+// markSaved makes the index as it is the one restored by ResetPendingChanges.
+func (h *CNBIndex) markSaved() {
+	h.savedIndex, h.savedArtifactType, h.pendingChanges = h.ImageIndex, h.artifactType, nil
+}
+
+// recordChange records a change to the index, remembering the index before the first pending change so it can be restored.
+func (h *CNBIndex) recordChange(before v1.ImageIndex, change IndexChange) {
+	if h.savedIndex == nil {
+		h.savedIndex = before
+	}
+	h.pendingChanges = append(h.pendingChanges, change)
+}
+
+// DeleteDir removes the index, and its lock file, from the local filesystem if it exists.
 func (h *CNBIndex) DeleteDir() error {
-	layoutPath := filepath.Join(h.XdgPath, MakeFileSafeName(h.RepoName))
-	if _, err := os.Stat(layoutPath); err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
+	layoutPath := storeDir(h.XdgPath, h.RepoName)
+	unlock, err := LockDir(layoutPath, h.lockTimeout)
+	if err != nil {
 		return err
 	}
-	return os.RemoveAll(layoutPath)
+	defer unlock()
+
+	if err = removeLegacyStorePath(h.XdgPath, h.RepoName); err != nil {
+		return err
+	}
+	if err = os.RemoveAll(layoutPath); err != nil {
+		return err
+	}
+	h.savedDigest = v1.Hash{}
+	return RemoveLockFile(layoutPath)
 }
 
 func getIndexManifest(ii v1.ImageIndex) (mfest *v1.IndexManifest, err error) {
@@ -380,8 +812,11 @@ func getIndexManifest(ii v1.ImageIndex) (mfest *v1.IndexManifest, err error) {
 // descriptor returns a v1.Descriptor filled with a v1.Platform created from reading
 // the image config file.
 func descriptor(image v1.Image) (v1.Descriptor, error) {
-	// Get the image configuration file
-	cfg, _ := GetConfigFile(image)
+	// Get the image configuration file; artifacts whose config cannot be read have no platform
+	cfg, err := GetConfigFile(image)
+	if err != nil {
+		return v1.Descriptor{}, nil
+	}
 	platform := v1.Platform{}
 	platform.Architecture = cfg.Architecture
 	platform.OS = cfg.OS
@@ -0,0 +1,194 @@
+package imgutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/compression"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Compression is the algorithm used to compress layers added to an image from a file.
+type Compression int
+
+const (
+	// Gzip is the default layer compression.
+	Gzip Compression = iota
+	// Zstd compresses layers with zstd, which is only supported for images with OCI media types.
+	Zstd
+	// EStargz writes layers as eStargz: seekable gzip with a table of contents, which lets the containerd stargz snapshotter
+	// pull them lazily. They have the gzip media type, so runtimes without eStargz support read them as regular gzip layers.
+	EStargz
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Zstd:
+		return string(compression.ZStd)
+	case EStargz:
+		return "estargz"
+	default:
+		return string(compression.GZip)
+	}
+}
+
+// layerFromFile returns a layer for the tar at the given path, compressed with c; see LayerFromFile for the provider.
+// A gzip level of zero keeps the default level.
+func (c Compression) layerFromFile(path string, provider DiffIDProvider, gzipLevel int) (v1.Layer, error) {
+	switch c {
+	case Zstd:
+		return LayerFromFile(path, provider, tarball.WithCompression(compression.ZStd), tarball.WithMediaType(types.OCILayerZStd))
+	case EStargz:
+		return estargzLayerFromFile(path, provider, gzipLevel)
+	default:
+		return LayerFromFile(path, provider, GzipLayerOptions(gzipLevel)...)
+	}
+}
+
+// GzipLayerOptions returns the options to create gzip-compressed layers with the given level; zero keeps the default level.
+func GzipLayerOptions(level int) []tarball.LayerOption {
+	if level == 0 {
+		return nil
+	}
+	return []tarball.LayerOption{tarball.WithCompressionLevel(level)}
+}
+
+// layerMediaType returns the requested layer media type,
+// unless the layer is zstd-compressed or encrypted, in which case its own media type is kept as the requested type would not describe it.
+// Likewise, layers added from a blob with an explicit media type (see LayerFromBlob) keep it unless it is a gzip type.
+func layerMediaType(layer v1.Layer, requestedType types.MediaType) types.MediaType {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return requestedType
+	}
+	if mediaType == types.OCILayerZStd || IsEncryptedMediaType(mediaType) {
+		return mediaType
+	}
+	if _, isBlob := layer.(*blobLayer); isBlob && blobCompressions[mediaType] != compression.GZip {
+		return mediaType
+	}
+	return requestedType
+}
+
+// LayerFromBlob returns a layer for the blob at the given path, with the given diff ID and media type.
+// The blob must be compressed as the media type describes (e.g. gzip for types.OCILayer, zstd for types.OCILayerZStd);
+// it is used as-is, without being recompressed, so the digest of the layer is the digest of the blob.
+// The diff ID is not verified, and the blob is only read when the digest or contents of the layer are needed.
+func LayerFromBlob(path string, diffID string, mediaType types.MediaType) (v1.Layer, error) {
+	hash, err := v1.NewHash(diffID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diff ID %q: %w", diffID, err)
+	}
+	if !mediaType.IsLayer() {
+		return nil, fmt.Errorf("media type %q is not a layer media type", mediaType)
+	}
+	if expected, ok := blobCompressions[mediaType]; ok {
+		actual, err := blobCompression(path)
+		if err != nil {
+			return nil, err
+		}
+		if actual != expected {
+			return nil, fmt.Errorf("layer %s has %s compression but its media type %q requires %s compression", path, actual, mediaType, expected)
+		}
+	}
+	layer, err := partial.CompressedToLayer(&blob{path: path, diffID: hash, mediaType: mediaType})
+	if err != nil {
+		return nil, err
+	}
+	return &blobLayer{Layer: layer}, nil
+}
+
+// blobLayer is a layer created by LayerFromBlob.
+type blobLayer struct {
+	v1.Layer
+}
+
+// blobCompressions are the compressions required by the known layer media types.
+var blobCompressions = map[types.MediaType]compression.Compression{
+	types.DockerLayer:                    compression.GZip,
+	types.DockerForeignLayer:             compression.GZip,
+	types.DockerUncompressedLayer:        compression.None,
+	types.OCILayer:                       compression.GZip,
+	types.OCIRestrictedLayer:             compression.GZip,
+	types.OCILayerZStd:                   compression.ZStd,
+	types.OCIUncompressedLayer:           compression.None,
+	types.OCIUncompressedRestrictedLayer: compression.None,
+}
+
+func blobCompression(path string) (compression.Compression, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	switch {
+	case bytes.HasPrefix(magic[:n], gzipMagic):
+		return compression.GZip, nil
+	case bytes.HasPrefix(magic[:n], zstdMagic):
+		return compression.ZStd, nil
+	default:
+		return compression.None, nil
+	}
+}
+
+// blob is a partial.CompressedLayer read from a file, whose digest and size are computed once, when first needed.
+type blob struct {
+	path      string
+	diffID    v1.Hash
+	mediaType types.MediaType
+
+	once   sync.Once
+	digest v1.Hash
+	size   int64
+	err    error
+}
+
+func (b *blob) compute() error {
+	b.once.Do(func() {
+		var f *os.File
+		if f, b.err = os.Open(filepath.Clean(b.path)); b.err != nil {
+			return
+		}
+		defer f.Close()
+		b.digest, b.size, b.err = v1.SHA256(f)
+	})
+	return b.err
+}
+
+func (b *blob) Digest() (v1.Hash, error) {
+	if err := b.compute(); err != nil {
+		return v1.Hash{}, err
+	}
+	return b.digest, nil
+}
+
+func (b *blob) Size() (int64, error) {
+	if err := b.compute(); err != nil {
+		return -1, err
+	}
+	return b.size, nil
+}
+
+func (b *blob) Compressed() (io.ReadCloser, error) {
+	return os.Open(filepath.Clean(b.path))
+}
+
+func (b *blob) DiffID() (v1.Hash, error) {
+	return b.diffID, nil
+}
+
+func (b *blob) MediaType() (types.MediaType, error) {
+	return b.mediaType, nil
+}
@@ -0,0 +1,259 @@
+package imgutil_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestCompressionLevel(t *testing.T) {
+	spec.Run(t, "CompressionLevel", testCompressionLevel, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testCompressionLevel(t *testing.T, when spec.G, it spec.S) {
+	var layerPath string
+
+	it.Before(func() {
+		tmpDir := t.TempDir()
+		layerPath = filepath.Join(tmpDir, "layer.tar")
+		f, err := os.Create(layerPath)
+		h.AssertNil(t, err)
+		defer f.Close()
+		tw := tar.NewWriter(f)
+		contents := bytes.Repeat([]byte("some compressible contents, "), 1<<14)
+		h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "file", Mode: 0644, Size: int64(len(contents))}))
+		_, err = tw.Write(contents)
+		h.AssertNil(t, err)
+		h.AssertNil(t, tw.Close())
+	})
+
+	compressedSize := func(ops ...imgutil.ImageOption) int64 {
+		options := imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}}
+		for _, op := range ops {
+			op(&options)
+		}
+		image, err := imgutil.NewCNBImage(options)
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.AddLayer(layerPath))
+		layers, err := image.Layers()
+		h.AssertNil(t, err)
+		size, err := layers[0].Size()
+		h.AssertNil(t, err)
+		return size
+	}
+
+	when("#WithGzipLevel", func() {
+		it("compresses layers with the given level", func() {
+			fastest := compressedSize(imgutil.WithGzipLevel(1))
+			smallest := compressedSize(imgutil.WithGzipLevel(9))
+			h.AssertEq(t, smallest < fastest, true)
+		})
+
+		it("does not change the diff ID", func() {
+			options := imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}}
+			imgutil.WithGzipLevel(1)(&options)
+			image, err := imgutil.NewCNBImage(options)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayer(layerPath))
+			defaultImage, err := imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}})
+			h.AssertNil(t, err)
+			h.AssertNil(t, defaultImage.AddLayer(layerPath))
+
+			topLayer, err := image.TopLayer()
+			h.AssertNil(t, err)
+			defaultTopLayer, err := defaultImage.TopLayer()
+			h.AssertNil(t, err)
+			h.AssertEq(t, topLayer, defaultTopLayer)
+		})
+
+		it("rejects invalid levels when the option is applied", func() {
+			for _, level := range []int{gzip.HuffmanOnly, gzip.DefaultCompression, gzip.NoCompression, gzip.BestCompression + 1} {
+				options := imgutil.ImageOptions{}
+				imgutil.WithGzipLevel(level)(&options)
+				h.AssertError(t, options.Err(), "invalid gzip level")
+			}
+			for _, level := range []int{gzip.BestSpeed, gzip.BestCompression} {
+				options := imgutil.ImageOptions{}
+				imgutil.WithGzipLevel(level)(&options)
+				h.AssertNil(t, options.Err())
+			}
+		})
+	})
+
+	when("EStargz", func() {
+		it("writes layers with a table of contents and its digest annotation", func() {
+			options := imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}, LayerCompression: imgutil.EStargz}
+			image, err := imgutil.NewCNBImage(options)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayer(layerPath))
+
+			manifest, err := image.UnderlyingImage().Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(manifest.Layers), 1)
+			tocDigest, ok := manifest.Layers[0].Annotations[imgutil.EStargzTOCDigestAnnotation]
+			h.AssertEq(t, ok, true)
+			_, err = v1.NewHash(tocDigest)
+			h.AssertNil(t, err)
+
+			layers, err := image.Layers()
+			h.AssertNil(t, err)
+			rc, err := layers[0].Uncompressed()
+			h.AssertNil(t, err)
+			defer rc.Close()
+			var names []string
+			tr := tar.NewReader(rc)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				h.AssertNil(t, err)
+				names = append(names, hdr.Name)
+			}
+			h.AssertContains(t, names, "file", "stargz.index.json")
+
+			compressed, err := layers[0].Compressed()
+			h.AssertNil(t, err)
+			defer compressed.Close()
+			blob, err := io.ReadAll(compressed)
+			h.AssertNil(t, err)
+			reader, err := estargz.Open(io.NewSectionReader(bytes.NewReader(blob), 0, int64(len(blob))))
+			h.AssertNil(t, err)
+			_, ok = reader.Lookup("file")
+			h.AssertEq(t, ok, true)
+		})
+
+		it("reuses layers of the previous image by the diff ID of their tar", func() {
+			options := imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}, LayerCompression: imgutil.EStargz}
+			previous, err := imgutil.NewCNBImage(options)
+			h.AssertNil(t, err)
+			diffID, err := imgutil.ComputeDiffID(layerPath)
+			h.AssertNil(t, err)
+			h.AssertNil(t, previous.AddLayerWithDiffIDAndHistory(layerPath, diffID.String(), v1.History{CreatedBy: "some-history"}))
+			previousManifest, err := previous.UnderlyingImage().Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, previousManifest.Layers[0].Annotations[imgutil.EStargzSourceDiffIDAnnotation], diffID.String())
+
+			options.PreviousImage = previous.UnderlyingImage()
+			image, err := imgutil.NewCNBImage(options)
+			h.AssertNil(t, err)
+			hasLayer, err := image.PreviousImageHasLayer(diffID.String())
+			h.AssertNil(t, err)
+			h.AssertEq(t, hasLayer, true)
+			h.AssertNil(t, image.ReuseLayer(diffID.String()))
+
+			manifest, err := image.UnderlyingImage().Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Layers[0].Digest, previousManifest.Layers[0].Digest)
+			h.AssertEq(t, manifest.Layers[0].Annotations, previousManifest.Layers[0].Annotations)
+			rc, err := image.GetLayer(diffID.String())
+			h.AssertNil(t, err)
+			h.AssertNil(t, rc.Close())
+		})
+	})
+}
+
+func TestLayerFromBlob(t *testing.T) {
+	spec.Run(t, "LayerFromBlob", testLayerFromBlob, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testLayerFromBlob(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tarPath  string
+		gzipPath string
+		diffID   string
+		image    *imgutil.CNBImageCore
+	)
+
+	it.Before(func() {
+		tmpDir := t.TempDir()
+		tarPath = filepath.Join(tmpDir, "layer.tar")
+		f, err := os.Create(tarPath)
+		h.AssertNil(t, err)
+		tw := tar.NewWriter(f)
+		h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "file", Mode: 0644, Size: 8}))
+		_, err = tw.Write([]byte("contents"))
+		h.AssertNil(t, err)
+		h.AssertNil(t, tw.Close())
+		h.AssertNil(t, f.Close())
+		hash, err := imgutil.ComputeDiffID(tarPath)
+		h.AssertNil(t, err)
+		diffID = hash.String()
+
+		contents, err := os.ReadFile(tarPath)
+		h.AssertNil(t, err)
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+		h.AssertNil(t, err)
+		_, err = zw.Write(contents)
+		h.AssertNil(t, err)
+		h.AssertNil(t, zw.Close())
+		gzipPath = filepath.Join(tmpDir, "layer.tar.gz")
+		h.AssertNil(t, os.WriteFile(gzipPath, buf.Bytes(), 0600))
+
+		image, err = imgutil.NewCNBImage(imgutil.ImageOptions{
+			Platform:   imgutil.Platform{OS: "linux", Architecture: "amd64"},
+			MediaTypes: imgutil.OCITypes,
+		})
+		h.AssertNil(t, err)
+	})
+
+	when("#AddLayerWithDiffIDAndMediaType", func() {
+		it("adds a pre-compressed blob without recompressing it", func() {
+			h.AssertNil(t, image.AddLayerWithDiffIDAndMediaType(gzipPath, diffID, types.OCILayer))
+
+			f, err := os.Open(gzipPath)
+			h.AssertNil(t, err)
+			defer f.Close()
+			expectedDigest, expectedSize, err := v1.SHA256(f)
+			h.AssertNil(t, err)
+
+			manifest, err := image.Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Layers[0].Digest, expectedDigest)
+			h.AssertEq(t, manifest.Layers[0].Size, expectedSize)
+			h.AssertEq(t, manifest.Layers[0].MediaType, types.OCILayer)
+			topLayer, err := image.TopLayer()
+			h.AssertNil(t, err)
+			h.AssertEq(t, topLayer, diffID)
+
+			contents, err := image.ReadFile("/file")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "contents")
+		})
+
+		it("keeps uncompressed media types", func() {
+			h.AssertNil(t, image.AddLayerWithDiffIDAndMediaType(tarPath, diffID, types.OCIUncompressedLayer))
+
+			manifest, err := image.Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Layers[0].MediaType, types.OCIUncompressedLayer)
+			h.AssertEq(t, manifest.Layers[0].Digest.String(), diffID)
+		})
+
+		it("fails if the blob is not compressed as its media type requires", func() {
+			err := image.AddLayerWithDiffIDAndMediaType(tarPath, diffID, types.OCILayer)
+			h.AssertError(t, err, "has none compression but its media type")
+			err = image.AddLayerWithDiffIDAndMediaType(gzipPath, diffID, types.OCILayerZStd)
+			h.AssertError(t, err, "has gzip compression but its media type")
+		})
+
+		it("fails for non-layer media types", func() {
+			err := image.AddLayerWithDiffIDAndMediaType(gzipPath, diffID, types.OCIManifestSchema1)
+			h.AssertError(t, err, "is not a layer media type")
+		})
+	})
+}
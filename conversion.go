@@ -0,0 +1,133 @@
+package imgutil
+
+import (
+	"errors"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// MediaTypeConversion is what SetMediaType changed in an index.
+type MediaTypeConversion struct {
+	// From and To are the media types of the index before and after the conversion.
+	From types.MediaType
+	To   types.MediaType
+	// Manifests are the images that were converted with WithConvertManifests, in the order they were converted.
+	Manifests []ManifestConversion
+}
+
+// ManifestConversion is an image of an index converted to other media types, and so given a new digest, by SetMediaType.
+type ManifestConversion struct {
+	From v1.Descriptor
+	To   v1.Descriptor
+}
+
+// WithConvertManifests causes SetMediaType to also convert the images of the index to the media types of the index.
+func WithConvertManifests() func(options *IndexOptions) error {
+	return func(o *IndexOptions) error {
+		o.ConvertManifests = true
+		return nil
+	}
+}
+
+// SetMediaType converts the index between a Docker manifest list and an OCI image index.
+// With WithConvertManifests, the images it refers to are converted too: their manifests, configs and layers are given the
+// media types of the index, which gives them new digests, and they are replaced in place, keeping their
+// platforms and annotations. Nested indexes and attestation manifests are left as they are.
+// As with AddManifest, the converted images are only referenced: they must be written where the index is pushed, e.g.
+// from Image with the digests reported in the returned MediaTypeConversion.
+// A subject, artifactType or annotations, which a Docker manifest list has no place for, are an error rather than being dropped.
+func (h *CNBIndex) SetMediaType(mediaType types.MediaType, ops ...IndexOption) (MediaTypeConversion, error) {
+	options := &IndexOptions{}
+	for _, op := range ops {
+		if err := op(options); err != nil {
+			return MediaTypeConversion{}, err
+		}
+	}
+	if mediaType != types.OCIImageIndex && mediaType != types.DockerManifestList {
+		return MediaTypeConversion{}, ErrUnsupportedMediaType{MediaType: mediaType}
+	}
+	indexManifest, err := getIndexManifest(h.ImageIndex)
+	if err != nil {
+		return MediaTypeConversion{}, err
+	}
+	if mediaType == types.DockerManifestList && (indexManifest.Subject != nil || h.artifactType != "") {
+		return MediaTypeConversion{}, errors.New("cannot convert an index with a subject or artifactType to a Docker manifest list")
+	}
+	if mediaType == types.DockerManifestList && len(indexManifest.Annotations) > 0 {
+		return MediaTypeConversion{}, errors.New("cannot convert an index with annotations to a Docker manifest list")
+	}
+
+	conversion := MediaTypeConversion{From: indexManifest.MediaType, To: mediaType}
+	converted := h.ImageIndex
+	if options.ConvertManifests {
+		requestedTypes := MediaTypesOf(mediaType)
+		addenda := make([]mutate.IndexAddendum, 0, len(indexManifest.Manifests))
+		for _, desc := range indexManifest.Manifests {
+			if !isConvertibleImage(desc) || MediaTypesOf(desc.MediaType) == requestedTypes {
+				addenda = append(addenda, mutate.IndexAddendum{Add: keptManifest{desc: desc}})
+				continue
+			}
+			image, err := h.ImageIndex.Image(desc.Digest)
+			if err != nil {
+				return MediaTypeConversion{}, err
+			}
+			image, _, err = EnsureMediaTypesAndLayers(image, requestedTypes, func(_ int, layer v1.Layer) (v1.Layer, error) {
+				return layer, nil
+			})
+			if err != nil {
+				return MediaTypeConversion{}, err
+			}
+			convertedDesc, err := partial.Descriptor(image)
+			if err != nil {
+				return MediaTypeConversion{}, err
+			}
+			convertedDesc.Platform = desc.Platform
+			convertedDesc.Annotations = desc.Annotations
+			addenda = append(addenda, mutate.IndexAddendum{Add: image, Descriptor: *convertedDesc})
+			conversion.Manifests = append(conversion.Manifests, ManifestConversion{From: desc, To: *convertedDesc})
+		}
+		if len(conversion.Manifests) > 0 {
+			// every manifest is added again, in order, so that the converted images keep their position in the index
+			converted = mutate.AppendManifests(mutate.RemoveManifests(converted, func(v1.Descriptor) bool { return true }), addenda...)
+		}
+	}
+	if conversion.From == conversion.To && len(conversion.Manifests) == 0 {
+		return conversion, nil
+	}
+
+	before := h.ImageIndex
+	h.ImageIndex = mutate.IndexMediaType(converted, mediaType)
+	h.recordChange(before, IndexChange{Operation: SetMediaTypeOperation, Value: string(mediaType)})
+	return conversion, nil
+}
+
+// keptManifest is a manifest of an index that SetMediaType adds again as it is, known only by its descriptor;
+// the image or index it refers to is still read from the index.
+type keptManifest struct {
+	desc v1.Descriptor
+}
+
+func (m keptManifest) Descriptor() (*v1.Descriptor, error) {
+	desc := m.desc
+	return &desc, nil
+}
+
+func (m keptManifest) MediaType() (types.MediaType, error) {
+	return m.desc.MediaType, nil
+}
+
+func (m keptManifest) Digest() (v1.Hash, error) {
+	return m.desc.Digest, nil
+}
+
+func (m keptManifest) Size() (int64, error) {
+	return m.desc.Size, nil
+}
+
+// isConvertibleImage reports whether the descriptor is of an image that SetMediaType can convert.
+func isConvertibleImage(desc v1.Descriptor) bool {
+	return (desc.MediaType == types.OCIManifestSchema1 || desc.MediaType == types.DockerManifestSchema2) && !isAttestation(desc)
+}
@@ -0,0 +1,145 @@
+package imgutil_test
+
+import (
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestSetMediaType(t *testing.T) {
+	spec.Run(t, "SetMediaType", testSetMediaType, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testSetMediaType(t *testing.T, when spec.G, it spec.S) {
+	var (
+		index  *imgutil.CNBIndex
+		digest v1.Hash
+	)
+
+	it.Before(func() {
+		var err error
+		index, err = imgutil.NewCNBIndex("some/index", imgutil.IndexOptions{MediaType: types.DockerManifestList})
+		h.AssertNil(t, err)
+		image, err := random.Image(100, 2)
+		h.AssertNil(t, err)
+		image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: "linux", Architecture: "arm64"})
+		h.AssertNil(t, err)
+		index.AddManifest(image)
+		digest, err = image.Digest()
+		h.AssertNil(t, err)
+	})
+
+	it("converts the index only by default", func() {
+		conversion, err := index.SetMediaType(types.OCIImageIndex)
+		h.AssertNil(t, err)
+		h.AssertEq(t, conversion.From, types.DockerManifestList)
+		h.AssertEq(t, conversion.To, types.OCIImageIndex)
+		h.AssertEq(t, len(conversion.Manifests), 0)
+
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, indexManifest.MediaType, types.OCIImageIndex)
+		h.AssertEq(t, indexManifest.Manifests[0].Digest, digest)
+		h.AssertEq(t, index.PendingChanges()[1].Operation, imgutil.SetMediaTypeOperation)
+	})
+
+	it("converts the images of the index with WithConvertManifests", func() {
+		conversion, err := index.SetMediaType(types.OCIImageIndex, imgutil.WithConvertManifests())
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(conversion.Manifests), 1)
+		converted := conversion.Manifests[0]
+		h.AssertEq(t, converted.From.Digest, digest)
+		h.AssertNotEq(t, converted.To.Digest, digest)
+		h.AssertEq(t, converted.To.MediaType, types.OCIManifestSchema1)
+		h.AssertEq(t, converted.To.Platform, &v1.Platform{OS: "linux", Architecture: "arm64"})
+
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, indexManifest.MediaType, types.OCIImageIndex)
+		h.AssertEq(t, indexManifest.Manifests[0].Digest, converted.To.Digest)
+
+		image, err := index.Image(converted.To.Digest)
+		h.AssertNil(t, err)
+		manifest, err := image.Manifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, manifest.Config.MediaType, types.OCIConfigJSON)
+		for _, layer := range manifest.Layers {
+			h.AssertEq(t, layer.MediaType, types.OCILayer)
+		}
+	})
+
+	it("converts the images in place, keeping the position of the others", func() {
+		ociImage, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		ociImage = mutate.MediaType(ociImage, types.OCIManifestSchema1)
+		ociImage = mutate.ConfigMediaType(ociImage, types.OCIConfigJSON)
+		index.AddManifest(ociImage)
+		ociDigest, err := ociImage.Digest()
+		h.AssertNil(t, err)
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		index.AddManifest(image)
+		lastDigest, err := image.Digest()
+		h.AssertNil(t, err)
+
+		conversion, err := index.SetMediaType(types.OCIImageIndex, imgutil.WithConvertManifests())
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(conversion.Manifests), 2)
+		h.AssertEq(t, conversion.Manifests[0].From.Digest, digest)
+		h.AssertEq(t, conversion.Manifests[1].From.Digest, lastDigest)
+
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(indexManifest.Manifests), 3)
+		h.AssertEq(t, indexManifest.Manifests[0].Digest, conversion.Manifests[0].To.Digest)
+		h.AssertEq(t, indexManifest.Manifests[1].Digest, ociDigest)
+		h.AssertEq(t, indexManifest.Manifests[2].Digest, conversion.Manifests[1].To.Digest)
+		_, err = index.Image(ociDigest)
+		h.AssertNil(t, err)
+	})
+
+	it("does nothing when the index and its images have the media types already", func() {
+		_, err := index.SetMediaType(types.DockerManifestList, imgutil.WithConvertManifests())
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(index.PendingChanges()), 1)
+	})
+
+	it("fails to convert an index with a subject to a Docker manifest list", func() {
+		_, err := index.SetMediaType(types.OCIImageIndex)
+		h.AssertNil(t, err)
+		subject, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		desc, err := partial.Descriptor(subject)
+		h.AssertNil(t, err)
+		h.AssertNil(t, index.SetSubject(*desc))
+
+		_, err = index.SetMediaType(types.DockerManifestList)
+		h.AssertError(t, err, "with a subject or artifactType")
+	})
+
+	it("fails to convert an index with annotations to a Docker manifest list", func() {
+		base := mutate.Annotations(mutate.IndexMediaType(empty.Index, types.OCIImageIndex), map[string]string{"some-key": "some-value"}).(v1.ImageIndex)
+		annotated, err := imgutil.NewCNBIndex("some/index", imgutil.IndexOptions{BaseIndex: base})
+		h.AssertNil(t, err)
+
+		_, err = annotated.SetMediaType(types.DockerManifestList)
+		h.AssertError(t, err, "with annotations")
+	})
+
+	it("fails with a media type that is not an index", func() {
+		_, err := index.SetMediaType(types.OCIManifestSchema1)
+		var unknown imgutil.ErrUnsupportedMediaType
+		h.AssertEq(t, errors.As(err, &unknown), true)
+	})
+}
@@ -0,0 +1,305 @@
+package imgutil
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const diffIDsFileName = "diffids.json"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// DiffIDProvider returns the diff ID of the layer tar at the given path.
+// When one is configured with WithDiffIDProvider, layers added from a file get their diff ID from it,
+// and are only read when their contents or digest are needed, e.g., when the image is pushed.
+type DiffIDProvider interface {
+	DiffID(path string) (v1.Hash, error)
+}
+
+// DiffIDCache is a DiffIDProvider that records the diff IDs of layer files in the XDG store,
+// so that they are not computed again for files that have not changed between runs.
+// A file is considered unchanged if its size and modification time are the same as when its diff ID was computed.
+type DiffIDCache struct {
+	path string
+	mu   sync.Mutex
+}
+
+type diffIDEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	DiffID  string    `json:"diffID"`
+}
+
+// NewDiffIDCache returns a DiffIDCache backed by a file in the provided XDG path.
+func NewDiffIDCache(xdgPath string) *DiffIDCache {
+	return &DiffIDCache{path: filepath.Join(xdgPath, diffIDsFileName)}
+}
+
+// DiffID returns the recorded diff ID of the layer file, or computes and records it if the file changed or is not known.
+func (c *DiffIDCache) DiffID(path string) (v1.Hash, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entries, err := c.read()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	if entry, ok := entries[path]; ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		if diffID, err := v1.NewHash(entry.DiffID); err == nil {
+			return diffID, nil
+		}
+	}
+
+	diffID, err := ComputeDiffID(path)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	entries[path] = diffIDEntry{Size: info.Size(), ModTime: info.ModTime(), DiffID: diffID.String()}
+	return diffID, c.write(entries)
+}
+
+func (c *DiffIDCache) read() (map[string]diffIDEntry, error) {
+	entries := make(map[string]diffIDEntry)
+	contents, err := os.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, fmt.Errorf("reading diff IDs: %w", err)
+	}
+	if err = json.Unmarshal(contents, &entries); err != nil {
+		// the cache is rebuilt rather than failing the build
+		return make(map[string]diffIDEntry), nil
+	}
+	return entries, nil
+}
+
+// write replaces the cache file atomically, dropping the entries of files that no longer exist.
+func (c *DiffIDCache) write(entries map[string]diffIDEntry) error {
+	for path := range entries {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			delete(entries, path)
+		}
+	}
+	contents, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.path), 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), diffIDsFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// ComputeDiffID returns the digest of the uncompressed contents of the layer tar at the given path,
+// which may be uncompressed, gzip-compressed or zstd-compressed.
+func ComputeDiffID(path string) (v1.Hash, error) {
+	rc, err := openUncompressed(path)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	if rc == nil {
+		layer, err := tarball.LayerFromFile(path)
+		if err != nil {
+			return v1.Hash{}, err
+		}
+		return layer.DiffID()
+	}
+	defer rc.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, rc); err != nil { // #nosec G110
+		return v1.Hash{}, err
+	}
+	return v1.Hash{Algorithm: "sha256", Hex: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// openUncompressed returns a reader of the uncompressed contents of the uncompressed or gzip-compressed tar at the given path.
+// It returns nil for zstd-compressed tars, which must be read as layers.
+func openUncompressed(path string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		f.Close()
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return readCloser{Reader: zr, close: func() error {
+			zr.Close()
+			return f.Close()
+		}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		f.Close()
+		return nil, nil
+	}
+	return readCloser{Reader: br, close: f.Close}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+// IsCompressedLayerFile reports whether the layer tar at the given path is gzip-compressed or zstd-compressed.
+func IsCompressedLayerFile(path string) (bool, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(zstdMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return bytes.HasPrefix(magic[:n], gzipMagic) || bytes.HasPrefix(magic[:n], zstdMagic), nil
+}
+
+// LayerFromFile returns a layer for the tar at the given path, created with the given options.
+// If a DiffIDProvider is given, the diff ID of the layer is obtained from it,
+// and the file is only read when the contents, digest or size of the layer are needed.
+func LayerFromFile(path string, provider DiffIDProvider, opts ...tarball.LayerOption) (v1.Layer, error) {
+	if provider == nil {
+		return tarball.LayerFromFile(path, opts...)
+	}
+	diffID, err := provider.DiffID(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff ID of layer %s: %w", path, err)
+	}
+	mediaType, err := mediaTypeFor(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &lazyLayer{
+		path:      path,
+		diffID:    diffID,
+		mediaType: mediaType,
+		open:      func() (v1.Layer, error) { return tarball.LayerFromFile(path, opts...) },
+	}, nil
+}
+
+// mediaTypeFor returns the media type of layers created with the given options,
+// which does not depend on their contents, by creating an empty one.
+func mediaTypeFor(opts []tarball.LayerOption) (types.MediaType, error) {
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}, opts...)
+	if err != nil {
+		return "", err
+	}
+	return layer.MediaType()
+}
+
+// lazyLayer is a layer with a known diff ID, which is created when its digest, size or compressed contents are needed.
+// Its uncompressed contents are read from the file directly.
+type lazyLayer struct {
+	path      string
+	diffID    v1.Hash
+	mediaType types.MediaType
+	open      func() (v1.Layer, error)
+
+	once  sync.Once
+	layer v1.Layer
+	err   error
+}
+
+func (l *lazyLayer) get() (v1.Layer, error) {
+	l.once.Do(func() {
+		l.layer, l.err = l.open()
+	})
+	return l.layer, l.err
+}
+
+func (l *lazyLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *lazyLayer) Digest() (v1.Hash, error) {
+	layer, err := l.get()
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	return layer.Digest()
+}
+
+func (l *lazyLayer) Compressed() (io.ReadCloser, error) {
+	layer, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return layer.Compressed()
+}
+
+func (l *lazyLayer) Uncompressed() (io.ReadCloser, error) {
+	rc, err := openUncompressed(l.path)
+	if err != nil || rc != nil {
+		return rc, err
+	}
+	layer, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return layer.Uncompressed()
+}
+
+func (l *lazyLayer) Size() (int64, error) {
+	layer, err := l.get()
+	if err != nil {
+		return -1, err
+	}
+	return layer.Size()
+}
+
+func (l *lazyLayer) MediaType() (types.MediaType, error) {
+	return l.mediaType, nil
+}
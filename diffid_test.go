@@ -0,0 +1,139 @@
+package imgutil_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestDiffID(t *testing.T) {
+	spec.Run(t, "DiffID", testDiffID, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testDiffID(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "diffid-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	writeLayer := func(name, contents string, compress bool) string {
+		path := filepath.Join(tmpDir, name)
+		f, err := os.Create(path)
+		h.AssertNil(t, err)
+		defer f.Close()
+		var tw *tar.Writer
+		if compress {
+			zw := gzip.NewWriter(f)
+			defer zw.Close()
+			tw = tar.NewWriter(zw)
+		} else {
+			tw = tar.NewWriter(f)
+		}
+		h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "file", Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err = tw.Write([]byte(contents))
+		h.AssertNil(t, err)
+		h.AssertNil(t, tw.Close())
+		return path
+	}
+
+	expectedDiffID := func(path string) v1.Hash {
+		layer, err := tarball.LayerFromFile(path)
+		h.AssertNil(t, err)
+		diffID, err := layer.DiffID()
+		h.AssertNil(t, err)
+		return diffID
+	}
+
+	when("#ComputeDiffID", func() {
+		it("returns the digest of the uncompressed contents", func() {
+			for _, compress := range []bool{false, true} {
+				path := writeLayer("layer.tar", "some-contents", compress)
+				diffID, err := imgutil.ComputeDiffID(path)
+				h.AssertNil(t, err)
+				h.AssertEq(t, diffID, expectedDiffID(path))
+			}
+		})
+	})
+
+	when("#DiffIDCache", func() {
+		it("reuses the diff IDs of unchanged files across caches in the same XDG path", func() {
+			xdgPath := filepath.Join(tmpDir, "xdg")
+			path := writeLayer("layer.tar", "some-contents", false)
+			expected := expectedDiffID(path)
+
+			diffID, err := imgutil.NewDiffIDCache(xdgPath).DiffID(path)
+			h.AssertNil(t, err)
+			h.AssertEq(t, diffID, expected)
+
+			// rewriting the file with contents of the same size and the same modification time is not detected
+			info, err := os.Stat(path)
+			h.AssertNil(t, err)
+			writeLayer("layer.tar", "other-content", false)
+			h.AssertNil(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+			diffID, err = imgutil.NewDiffIDCache(xdgPath).DiffID(path)
+			h.AssertNil(t, err)
+			h.AssertEq(t, diffID, expected)
+		})
+
+		it("computes the diff ID again when the file changes", func() {
+			cache := imgutil.NewDiffIDCache(filepath.Join(tmpDir, "xdg"))
+			path := writeLayer("layer.tar", "some-contents", false)
+			_, err := cache.DiffID(path)
+			h.AssertNil(t, err)
+
+			writeLayer("layer.tar", "other-content", false)
+			later := time.Now().Add(time.Minute)
+			h.AssertNil(t, os.Chtimes(path, later, later))
+			diffID, err := cache.DiffID(path)
+			h.AssertNil(t, err)
+			h.AssertEq(t, diffID, expectedDiffID(path))
+		})
+	})
+
+	when("#WithDiffIDProvider", func() {
+		it("adds layers with the diff ID from the provider, producing the same image", func() {
+			path := writeLayer("layer.tar", "some-contents", false)
+			platform := imgutil.Platform{OS: "linux", Architecture: "amd64"}
+			withProvider, err := imgutil.NewCNBImage(imgutil.ImageOptions{
+				Platform:       platform,
+				DiffIDProvider: imgutil.NewDiffIDCache(filepath.Join(tmpDir, "xdg")),
+			})
+			h.AssertNil(t, err)
+			h.AssertNil(t, withProvider.AddLayer(path))
+			withoutProvider, err := imgutil.NewCNBImage(imgutil.ImageOptions{Platform: platform})
+			h.AssertNil(t, err)
+			h.AssertNil(t, withoutProvider.AddLayer(path))
+
+			topLayer, err := withProvider.TopLayer()
+			h.AssertNil(t, err)
+			h.AssertEq(t, topLayer, expectedDiffID(path).String())
+			contents, err := withProvider.ReadFile("/file")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "some-contents")
+
+			actual, err := withProvider.Digest()
+			h.AssertNil(t, err)
+			expected, err := withoutProvider.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, expected)
+		})
+	})
+}
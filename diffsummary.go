@@ -0,0 +1,107 @@
+package imgutil
+
+import (
+	"reflect"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// DiffSummary summarizes what an image adds to its base image, e.g. for platforms to log what a build added.
+type DiffSummary struct {
+	// NewLayers is the number of layers above the base image layers.
+	NewLayers int
+	// NewLayersSize is the total (compressed) size of the new layers, in bytes.
+	NewLayersSize int64
+	// ChangedConfigFields lists the fields of the config (e.g. "Entrypoint", "Env") that differ from the base image, sorted.
+	// Labels are reported separately.
+	ChangedConfigFields []string
+	// AddedLabels and ChangedLabels hold the labels that are new or have a different value than in the base image.
+	AddedLabels   map[string]string
+	ChangedLabels map[string]string
+	// RemovedLabels lists the labels of the base image that the image does not have, sorted.
+	RemovedLabels []string
+}
+
+// DiffSummary returns a summary of what the working image adds to its base image (or to the image it was rebased on),
+// or to an empty image if no base image was provided.
+// It is meant to be called after the image is saved, as computing the size of the new layers may compress them otherwise.
+func (i *CNBImageCore) DiffSummary() (DiffSummary, error) {
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return DiffSummary{}, err
+	}
+	baseConfig := v1.Config{}
+	if i.baseImage != nil {
+		baseConfigFile, err := getConfigFile(i.baseImage)
+		if err != nil {
+			return DiffSummary{}, err
+		}
+		baseConfig = baseConfigFile.Config
+	}
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return DiffSummary{}, err
+	}
+
+	summary := DiffSummary{
+		ChangedConfigFields: changedConfigFields(baseConfig, configFile.Config),
+		AddedLabels:         map[string]string{},
+		ChangedLabels:       map[string]string{},
+	}
+	for idx := i.baseLayerCount; idx < len(layers); idx++ {
+		size, err := layers[idx].Size()
+		if err != nil {
+			return DiffSummary{}, err
+		}
+		summary.NewLayers++
+		summary.NewLayersSize += size
+	}
+	for k, v := range configFile.Config.Labels {
+		baseValue, ok := baseConfig.Labels[k]
+		switch {
+		case !ok:
+			summary.AddedLabels[k] = v
+		case baseValue != v:
+			summary.ChangedLabels[k] = v
+		}
+	}
+	for k := range baseConfig.Labels {
+		if _, ok := configFile.Config.Labels[k]; !ok {
+			summary.RemovedLabels = append(summary.RemovedLabels, k)
+		}
+	}
+	sort.Strings(summary.RemovedLabels)
+	return summary, nil
+}
+
+// changedConfigFields returns the names of the fields, other than labels, that differ between the configs.
+// Empty and missing values are considered equal.
+func changedConfigFields(base, config v1.Config) []string {
+	var changed []string
+	baseValue, value := reflect.ValueOf(base), reflect.ValueOf(config)
+	for idx := 0; idx < value.NumField(); idx++ {
+		field := value.Type().Field(idx)
+		if field.Name == "Labels" {
+			continue
+		}
+		a, b := baseValue.Field(idx), value.Field(idx)
+		if isEmptyValue(a) && isEmptyValue(b) {
+			continue
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			changed = append(changed, field.Name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
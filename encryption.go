@@ -0,0 +1,315 @@
+package imgutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Layer encryption follows the conventions of ocicrypt (github.com/containers/ocicrypt):
+// the media type of an encrypted layer is that of the plain layer with EncryptedMediaTypeSuffix,
+// its descriptor records the wrapped keys in annotations prefixed with EncryptionKeysAnnotationPrefix,
+// and the diff ID in the config is that of the plain layer.
+const (
+	// EncryptedMediaTypeSuffix is appended to the media type of encrypted layers, e.g. application/vnd.oci.image.layer.v1.tar+gzip+encrypted.
+	EncryptedMediaTypeSuffix = "+encrypted"
+	// EncryptionKeysAnnotationPrefix prefixes the annotations holding the wrapped layer keys, one per key wrapping protocol, e.g. org.opencontainers.image.enc.keys.jwe.
+	EncryptionKeysAnnotationPrefix = "org.opencontainers.image.enc.keys."
+	// EncryptionPubOptsAnnotation holds the public options of the layer encryption, such as the cipher.
+	EncryptionPubOptsAnnotation = "org.opencontainers.image.enc.pubopts"
+)
+
+// LayerEncryptionFinalizer returns the annotations to set on the descriptor of an encrypted layer.
+// It is called after the encrypted contents have been read in full, as they may depend on them (e.g. an HMAC).
+type LayerEncryptionFinalizer func() (map[string]string, error)
+
+// LayerEncrypter encrypts layers when an image is saved; see WithLayerEncryption.
+// It can be implemented with ocicrypt's EncryptLayer.
+type LayerEncrypter interface {
+	// EncryptLayer returns a reader of the encrypted contents of the plain (compressed) layer read from r,
+	// whose descriptor is given, and a finalizer returning the annotations to set on the descriptor of the encrypted layer,
+	// which must include at least one annotation prefixed with EncryptionKeysAnnotationPrefix.
+	EncryptLayer(desc v1.Descriptor, r io.Reader) (io.Reader, LayerEncryptionFinalizer, error)
+}
+
+// LayerDecrypter decrypts the encrypted layers of base and previous images when their contents are read; see WithLayerDecryption.
+// It can be implemented with ocicrypt's DecryptLayer.
+type LayerDecrypter interface {
+	// DecryptLayer returns a reader of the plain (compressed) contents of the encrypted layer read from r,
+	// whose descriptor, with its encryption annotations, is given.
+	DecryptLayer(desc v1.Descriptor, r io.Reader) (io.ReadCloser, error)
+}
+
+// IsEncryptedMediaType reports whether the media type is that of an encrypted layer.
+func IsEncryptedMediaType(mediaType types.MediaType) bool {
+	return strings.HasSuffix(string(mediaType), EncryptedMediaTypeSuffix)
+}
+
+// EncryptLayers encrypts the layers of the working image that are not encrypted yet, if a LayerEncrypter was provided.
+// Implementations call it when saving the image, after any other change, as the encrypted layers are written to temporary files.
+// The layers can still be read from the working image afterwards, e.g. with GetLayer.
+func (i *CNBImageCore) EncryptLayers() error {
+	if i.layerEncrypter == nil {
+		return nil
+	}
+	manifest, err := getManifest(i.Image)
+	if err != nil {
+		return err
+	}
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return err
+	}
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return err
+	}
+	if len(layers) != len(manifest.Layers) {
+		return fmt.Errorf("expected %d layers; got %d", len(manifest.Layers), len(layers))
+	}
+	var (
+		annotations = make([]map[string]string, len(layers))
+		encrypted   bool
+	)
+	for idx, layer := range layers {
+		desc := manifest.Layers[idx]
+		annotations[idx] = desc.Annotations
+		if IsEncryptedMediaType(desc.MediaType) {
+			continue
+		}
+		if layers[idx], annotations[idx], err = i.encryptLayer(layer, desc); err != nil {
+			return fmt.Errorf("failed to encrypt layer %s: %w", desc.Digest, err)
+		}
+		encrypted = true
+	}
+	if !encrypted {
+		return nil
+	}
+	history := NormalizedHistory(configFile.History, len(layers))
+	if i.Image, err = i.withLayers(configFile, layers, history, annotations); err != nil {
+		return err
+	}
+	return i.checkInvariants("EncryptLayers")
+}
+
+// encryptLayer writes the encrypted contents of the layer to a temporary file,
+// returning a layer for it that still reads the plain contents of the original layer, and its annotations.
+func (i *CNBImageCore) encryptLayer(layer v1.Layer, desc v1.Descriptor) (v1.Layer, map[string]string, error) {
+	rc, err := layer.Compressed()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rc.Close()
+	r, finalize, err := i.layerEncrypter.EncryptLayer(desc, rc)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := i.tempFiles.CreateTemp("imgutil.encrypted.*.layer")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	if _, err = io.Copy(f, r); err != nil {
+		return nil, nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, nil, err
+	}
+	encryptionAnnotations, err := finalize()
+	if err != nil {
+		return nil, nil, err
+	}
+	annotations := make(map[string]string, len(desc.Annotations)+len(encryptionAnnotations))
+	for k, v := range desc.Annotations {
+		annotations[k] = v
+	}
+	var hasKeys bool
+	for k, v := range encryptionAnnotations {
+		annotations[k] = v
+		hasKeys = hasKeys || strings.HasPrefix(k, EncryptionKeysAnnotationPrefix)
+	}
+	if !hasKeys {
+		return nil, nil, fmt.Errorf("no %s* annotation was provided for the encrypted layer", EncryptionKeysAnnotationPrefix)
+	}
+
+	diffID, err := layer.DiffID()
+	if err != nil {
+		return nil, nil, err
+	}
+	encryptedLayer, err := partial.CompressedToLayer(&blob{
+		path:      f.Name(),
+		diffID:    diffID,
+		mediaType: desc.MediaType + EncryptedMediaTypeSuffix,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &plainReadableLayer{Layer: encryptedLayer, plain: layer}, annotations, nil
+}
+
+// plainReadableLayer is an encrypted layer whose plain contents are available from the layer it was encrypted from.
+type plainReadableLayer struct {
+	v1.Layer
+	plain v1.Layer
+}
+
+func (l *plainReadableLayer) Uncompressed() (io.ReadCloser, error) {
+	return l.plain.Uncompressed()
+}
+
+// decryptingImage is an image whose encrypted layers are decrypted when their uncompressed contents are read.
+// Its manifest, and the digests and compressed contents of its layers, are those of the encrypted image,
+// so that encrypted layers are saved as-is when they are kept.
+type decryptingImage struct {
+	v1.Image
+	decrypter LayerDecrypter
+}
+
+// withLayerDecryption returns the image with its encrypted layers decrypted by the decrypter when read,
+// if one is provided and the image has encrypted layers.
+func withLayerDecryption(image v1.Image, decrypter LayerDecrypter) (v1.Image, error) {
+	if image == nil || decrypter == nil {
+		return image, nil
+	}
+	manifest, err := getManifest(image)
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range manifest.Layers {
+		if IsEncryptedMediaType(desc.MediaType) {
+			return &decryptingImage{Image: image, decrypter: decrypter}, nil
+		}
+	}
+	return image, nil
+}
+
+// encryptionAnnotations returns the annotations of the layer if it is an encrypted layer read from another image,
+// so that the keys needed to decrypt it are kept when the layer is reused.
+func encryptionAnnotations(layer v1.Layer) map[string]string {
+	if l, ok := layer.(*encryptedLayer); ok {
+		return l.desc.Annotations
+	}
+	return nil
+}
+
+func (i *decryptingImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for idx, layer := range layers {
+		if layers[idx], err = i.decrypting(layer); err != nil {
+			return nil, err
+		}
+	}
+	return layers, nil
+}
+
+func (i *decryptingImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.decrypting(layer)
+}
+
+func (i *decryptingImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDiffID(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.decrypting(layer)
+}
+
+// decrypting returns the layer, wrapped to be decrypted when read if it is encrypted.
+func (i *decryptingImage) decrypting(layer v1.Layer) (v1.Layer, error) {
+	if encrypted, ok := layer.(*encryptedLayer); ok {
+		withDecrypter := *encrypted
+		withDecrypter.decrypter = i.decrypter
+		return &withDecrypter, nil
+	}
+	mediaType, err := layer.MediaType()
+	if err != nil || !IsEncryptedMediaType(mediaType) {
+		return layer, err
+	}
+	digest, err := layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := getManifest(i.Image)
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return nil, err
+	}
+	for idx, desc := range manifest.Layers {
+		if desc.Digest == digest && idx < len(configFile.RootFS.DiffIDs) {
+			return &encryptedLayer{Layer: layer, desc: desc, diffID: configFile.RootFS.DiffIDs[idx], decrypter: i.decrypter}, nil
+		}
+	}
+	return nil, errors.New("failed to find descriptor of encrypted layer " + digest.String())
+}
+
+// encryptedLayer is an encrypted layer with the descriptor and diff ID recorded for it in its image,
+// as neither can be recovered from its contents. Its uncompressed contents can only be read with a decrypter.
+type encryptedLayer struct {
+	v1.Layer
+	desc      v1.Descriptor
+	diffID    v1.Hash
+	decrypter LayerDecrypter
+}
+
+func (l *encryptedLayer) DiffID() (v1.Hash, error) {
+	return l.diffID, nil
+}
+
+func (l *encryptedLayer) Uncompressed() (io.ReadCloser, error) {
+	if l.decrypter == nil {
+		return nil, fmt.Errorf("layer %s is encrypted and no decrypter was provided", l.desc.Digest)
+	}
+	plain, err := partial.CompressedToLayer(&decryptedBlob{layer: l})
+	if err != nil {
+		return nil, err
+	}
+	return plain.Uncompressed()
+}
+
+// decryptedBlob is the plain (compressed) contents of an encrypted layer, used to read its uncompressed contents.
+type decryptedBlob struct {
+	layer *encryptedLayer
+}
+
+func (b *decryptedBlob) Compressed() (io.ReadCloser, error) {
+	rc, err := b.layer.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	plain, err := b.layer.decrypter.DecryptLayer(b.layer.desc, rc)
+	if err != nil {
+		rc.Close()
+		return nil, fmt.Errorf("failed to decrypt layer %s: %w", b.layer.desc.Digest, err)
+	}
+	return readCloser{Reader: plain, close: func() error {
+		plain.Close()
+		return rc.Close()
+	}}, nil
+}
+
+func (b *decryptedBlob) Digest() (v1.Hash, error) {
+	return v1.Hash{}, errors.New("the digest of a decrypted layer is unknown")
+}
+
+func (b *decryptedBlob) Size() (int64, error) {
+	return -1, errors.New("the size of a decrypted layer is unknown")
+}
+
+func (b *decryptedBlob) MediaType() (types.MediaType, error) {
+	return types.MediaType(strings.TrimSuffix(string(b.layer.desc.MediaType), EncryptedMediaTypeSuffix)), nil
+}
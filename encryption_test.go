@@ -0,0 +1,197 @@
+package imgutil_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ggcrlayout "github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestEncryption(t *testing.T) {
+	spec.Run(t, "Encryption", testEncryption, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+const testKeyAnnotation = imgutil.EncryptionKeysAnnotationPrefix + "test"
+
+// xorCrypter "encrypts" layers by XORing them with a key byte, which it records in an annotation.
+type xorCrypter struct {
+	key byte
+}
+
+func (c *xorCrypter) EncryptLayer(_ v1.Descriptor, r io.Reader) (io.Reader, imgutil.LayerEncryptionFinalizer, error) {
+	return &xorReader{r: r, key: c.key}, func() (map[string]string, error) {
+		return map[string]string{testKeyAnnotation: string([]byte{c.key})}, nil
+	}, nil
+}
+
+func (c *xorCrypter) DecryptLayer(desc v1.Descriptor, r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(&xorReader{r: r, key: desc.Annotations[testKeyAnnotation][0]}), nil
+}
+
+type xorReader struct {
+	r   io.Reader
+	key byte
+}
+
+func (x *xorReader) Read(p []byte) (int, error) {
+	n, err := x.r.Read(p)
+	for i := 0; i < n; i++ {
+		p[i] ^= x.key
+	}
+	return n, err
+}
+
+func testEncryption(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir    string
+		layerPath string
+		diffID    string
+		crypter   *xorCrypter
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "encryption-test")
+		h.AssertNil(t, err)
+
+		layerPath = filepath.Join(tmpDir, "layer.tar")
+		f, err := os.Create(layerPath)
+		h.AssertNil(t, err)
+		tw := tar.NewWriter(f)
+		h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: "secret", Mode: 0644, Size: 6}))
+		_, err = tw.Write([]byte("secret"))
+		h.AssertNil(t, err)
+		h.AssertNil(t, tw.Close())
+		h.AssertNil(t, f.Close())
+		hash, err := imgutil.ComputeDiffID(layerPath)
+		h.AssertNil(t, err)
+		diffID = hash.String()
+
+		crypter = &xorCrypter{key: 0x5a}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	savedManifest := func(path string) (v1.Image, *v1.Manifest) {
+		layoutPath, err := ggcrlayout.FromPath(path)
+		h.AssertNil(t, err)
+		index, err := layoutPath.ImageIndex()
+		h.AssertNil(t, err)
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		image, err := index.Image(indexManifest.Manifests[0].Digest)
+		h.AssertNil(t, err)
+		manifest, err := image.Manifest()
+		h.AssertNil(t, err)
+		return image, manifest
+	}
+
+	saveEncrypted := func() string {
+		path := filepath.Join(tmpDir, "encrypted")
+		image, err := layout.NewImage(path,
+			layout.WithDefaultPlatform(imgutil.Platform{OS: "linux", Architecture: "amd64"}),
+			imgutil.WithLayerEncryption(crypter),
+		)
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.AddLayer(layerPath))
+		h.AssertNil(t, image.Save())
+
+		rc, err := image.GetLayer(diffID)
+		h.AssertNil(t, err)
+		defer rc.Close()
+		_, err = io.ReadAll(rc)
+		h.AssertNil(t, err)
+		return path
+	}
+
+	when("#WithLayerEncryption", func() {
+		it("saves encrypted layers with the ocicrypt media types and annotations", func() {
+			path := saveEncrypted()
+
+			image, manifest := savedManifest(path)
+			h.AssertEq(t, len(manifest.Layers), 1)
+			h.AssertEq(t, manifest.Layers[0].MediaType, types.OCILayer+imgutil.EncryptedMediaTypeSuffix)
+			h.AssertEq(t, manifest.Layers[0].Annotations[testKeyAnnotation], string([]byte{crypter.key}))
+
+			configFile, err := image.ConfigFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, configFile.RootFS.DiffIDs[0].String(), diffID)
+
+			layer, err := image.LayerByDigest(manifest.Layers[0].Digest)
+			h.AssertNil(t, err)
+			rc, err := layer.Compressed()
+			h.AssertNil(t, err)
+			defer rc.Close()
+			contents, err := io.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, bytes.HasPrefix(contents, []byte{0x1f, 0x8b}), false)
+		})
+
+		it("fails if the encrypter provides no keys", func() {
+			image, err := layout.NewImage(filepath.Join(tmpDir, "no-keys"),
+				layout.WithDefaultPlatform(imgutil.Platform{OS: "linux", Architecture: "amd64"}),
+				imgutil.WithLayerEncryption(&keylessEncrypter{}),
+			)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayer(layerPath))
+			h.AssertError(t, image.Save(), "annotation was provided for the encrypted layer")
+		})
+	})
+
+	when("#WithLayerDecryption", func() {
+		it("reads encrypted base layers and keeps them encrypted", func() {
+			basePath := saveEncrypted()
+			_, baseManifest := savedManifest(basePath)
+
+			path := filepath.Join(tmpDir, "app")
+			image, err := layout.NewImage(path, layout.FromBaseImagePath(basePath), imgutil.WithLayerDecryption(crypter))
+			h.AssertNil(t, err)
+			contents, err := image.ReadFile("/secret")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "secret")
+			h.AssertNil(t, image.Save())
+
+			_, manifest := savedManifest(path)
+			h.AssertEq(t, manifest.Layers[0], baseManifest.Layers[0])
+		})
+
+		it("keeps the annotations of reused encrypted layers", func() {
+			previousPath := saveEncrypted()
+			_, previousManifest := savedManifest(previousPath)
+
+			path := filepath.Join(tmpDir, "app")
+			image, err := layout.NewImage(path,
+				layout.WithDefaultPlatform(imgutil.Platform{OS: "linux", Architecture: "amd64"}),
+				layout.WithPreviousImage(previousPath),
+				imgutil.WithLayerDecryption(crypter),
+			)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.ReuseLayer(diffID))
+			h.AssertNil(t, image.Save())
+
+			_, manifest := savedManifest(path)
+			h.AssertEq(t, manifest.Layers[0].Digest, previousManifest.Layers[0].Digest)
+			h.AssertEq(t, manifest.Layers[0].Annotations[testKeyAnnotation], string([]byte{crypter.key}))
+		})
+	})
+}
+
+type keylessEncrypter struct{}
+
+func (keylessEncrypter) EncryptLayer(_ v1.Descriptor, r io.Reader) (io.Reader, imgutil.LayerEncryptionFinalizer, error) {
+	return r, func() (map[string]string, error) { return nil, nil }, nil
+}
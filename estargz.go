@@ -0,0 +1,210 @@
+package imgutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// EStargzTOCDigestAnnotation is set on the descriptor of eStargz layers to the digest of their table of contents.
+const EStargzTOCDigestAnnotation = estargz.TOCJSONDigestAnnotation
+
+// EStargzSourceDiffIDAnnotation is set on the descriptor of eStargz layers to the diff ID of the tar they were built from.
+// eStargz layers are rewritten with the entries of their table of contents, so their diff ID is not that of the tar;
+// the annotation lets them be found by the diff ID of the tar, e.g. by ReuseLayer and PreviousImageHasLayer.
+const EStargzSourceDiffIDAnnotation = "io.buildpacks.imgutil.estargz.source-diff-id"
+
+// estargzLayerFromFile returns an eStargz layer built from the tar at the given path, compressed with the given gzip level;
+// zero keeps the default level of layers. If a DiffIDProvider is given, the diff ID of the tar is obtained from it.
+func estargzLayerFromFile(path string, provider DiffIDProvider, gzipLevel int) (v1.Layer, error) {
+	if gzipLevel == 0 {
+		gzipLevel = gzip.BestSpeed
+	}
+	var (
+		sourceDiffID v1.Hash
+		err          error
+	)
+	if provider != nil {
+		sourceDiffID, err = provider.DiffID(path)
+	} else {
+		sourceDiffID, err = ComputeDiffID(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get diff ID of layer %s: %w", path, err)
+	}
+	var (
+		once      sync.Once
+		tocDigest digest.Digest
+	)
+	opener := func() (io.ReadCloser, error) {
+		blob, err := buildEstargz(path, gzipLevel)
+		if err != nil {
+			return nil, err
+		}
+		once.Do(func() { tocDigest = blob.TOCDigest() })
+		return blob, nil
+	}
+	// the layer is built when it is created, to compute its digest and diff ID, which sets the digest of its table of contents
+	layer, err := tarball.LayerFromOpener(opener, tarball.WithCompressionLevel(gzipLevel))
+	if err != nil {
+		return nil, err
+	}
+	return &estargzLayer{
+		Layer: layer,
+		annotations: map[string]string{
+			EStargzTOCDigestAnnotation:    tocDigest.String(),
+			EStargzSourceDiffIDAnnotation: sourceDiffID.String(),
+		},
+	}, nil
+}
+
+// buildEstargz returns the eStargz blob built from the tar at the given path; closing it closes the file.
+func buildEstargz(path string, gzipLevel int) (*estargzBlob, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	compression := &estargzCompression{
+		GzipCompressor:   estargz.NewGzipCompressorWithLevel(gzipLevel),
+		GzipDecompressor: &estargz.GzipDecompressor{},
+		level:            gzipLevel,
+	}
+	blob, err := estargz.Build(io.NewSectionReader(f, 0, info.Size()), estargz.WithCompression(compression))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &estargzBlob{Blob: blob, file: f}, nil
+}
+
+type estargzBlob struct {
+	*estargz.Blob
+	file *os.File
+}
+
+func (b *estargzBlob) Close() error {
+	err := b.Blob.Close()
+	if fErr := b.file.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
+
+// estargzLayer is an eStargz layer, whose descriptor has the digest of its table of contents and the diff ID of its tar.
+type estargzLayer struct {
+	v1.Layer
+	annotations map[string]string
+}
+
+func (l *estargzLayer) Descriptor() (*v1.Descriptor, error) {
+	digest, err := l.Digest()
+	if err != nil {
+		return nil, err
+	}
+	size, err := l.Size()
+	if err != nil {
+		return nil, err
+	}
+	mediaType, err := l.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	return &v1.Descriptor{MediaType: mediaType, Size: size, Digest: digest, Annotations: l.annotations}, nil
+}
+
+// layerDiffID returns the diff ID, in the config of the image, of the layer with the given diff ID
+// or of the eStargz layer built from a tar with the given diff ID; see EStargzSourceDiffIDAnnotation.
+// It returns false if the image has no such layer.
+func layerDiffID(image v1.Image, diffID v1.Hash) (v1.Hash, bool, error) {
+	configFile, err := getConfigFile(image)
+	if err != nil {
+		return v1.Hash{}, false, err
+	}
+	if contains(configFile.RootFS.DiffIDs, diffID) {
+		return diffID, true, nil
+	}
+	manifest, err := getManifest(image)
+	if err != nil {
+		return v1.Hash{}, false, err
+	}
+	for idx, layer := range manifest.Layers {
+		if idx < len(configFile.RootFS.DiffIDs) && layer.Annotations[EStargzSourceDiffIDAnnotation] == diffID.String() {
+			return configFile.RootFS.DiffIDs[idx], true, nil
+		}
+	}
+	return v1.Hash{}, false, nil
+}
+
+// estargzCompression is the gzip compression of eStargz layers. It writes the footer itself,
+// as the footer written by estargz relies on the exact output of compress/gzip, which differs across Go versions.
+type estargzCompression struct {
+	*estargz.GzipCompressor
+	*estargz.GzipDecompressor
+	level int
+}
+
+func (c *estargzCompression) WriteTOCAndFooter(w io.Writer, off int64, toc *estargz.JTOC, diffHash hash.Hash) (digest.Digest, error) {
+	tocJSON, err := json.MarshalIndent(toc, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	gz, err := gzip.NewWriterLevel(w, c.level)
+	if err != nil {
+		return "", err
+	}
+	gw := io.Writer(gz)
+	if diffHash != nil {
+		gw = io.MultiWriter(gz, diffHash)
+	}
+	tw := tar.NewWriter(gw)
+	if err = tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: estargz.TOCTarName, Size: int64(len(tocJSON))}); err != nil {
+		return "", err
+	}
+	if _, err = tw.Write(tocJSON); err != nil {
+		return "", err
+	}
+	if err = tw.Close(); err != nil {
+		return "", err
+	}
+	if err = gz.Close(); err != nil {
+		return "", err
+	}
+	if _, err = w.Write(estargzFooter(off)); err != nil {
+		return "", err
+	}
+	return digest.FromBytes(tocJSON), nil
+}
+
+// estargzFooter returns the footer of an eStargz layer: an empty gzip member of estargz.FooterSize bytes,
+// whose extra field records the offset of the table of contents.
+func estargzFooter(tocOff int64) []byte {
+	subfield := fmt.Sprintf("%016xSTARGZ", tocOff)
+	footer := bytes.NewBuffer(make([]byte, 0, estargz.FooterSize))
+	// gzip header with the FEXTRA flag, no modification time and an unknown OS
+	footer.Write([]byte{0x1f, 0x8b, 8, 1 << 2, 0, 0, 0, 0, 0, 255})
+	_ = binary.Write(footer, binary.LittleEndian, uint16(4+len(subfield)))
+	footer.Write([]byte{'S', 'G'})
+	_ = binary.Write(footer, binary.LittleEndian, uint16(len(subfield)))
+	footer.WriteString(subfield)
+	// an empty final stored deflate block, followed by the CRC-32 and size of the empty contents
+	footer.Write([]byte{1, 0, 0, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0})
+	return footer.Bytes()
+}
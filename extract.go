@@ -0,0 +1,73 @@
+package imgutil
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ExtractDestination persists a single image, as-is, to an image store.
+// Implementations must not mutate the image so that its digest (or, for the daemon, its config digest) is preserved.
+type ExtractDestination interface {
+	WriteImage(image v1.Image) error
+}
+
+// ExtractImage selects the child of the provided index that matches the given platform
+// and writes it to the destination as a standalone image.
+// It returns the digest of the extracted image manifest.
+func ExtractImage(index v1.ImageIndex, platform Platform, dest ExtractDestination) (v1.Hash, error) {
+	image, err := ImageFromIndex(index, platform)
+	if err != nil {
+		return v1.Hash{}, err
+	}
+	if err = dest.WriteImage(image); err != nil {
+		return v1.Hash{}, fmt.Errorf("failed to write image: %w", err)
+	}
+	return image.Digest()
+}
+
+// ImageFromIndex returns the image in the index that matches the given platform.
+// The OS and architecture must always match; the variant and OS version are only compared when requested.
+// It returns an ErrPlatformNotFound if no image matches.
+func ImageFromIndex(index v1.ImageIndex, platform Platform) (v1.Image, error) {
+	indexManifest, err := getIndexManifest(index)
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range indexManifest.Manifests {
+		if !desc.MediaType.IsImage() || desc.Platform == nil {
+			continue
+		}
+		if platform.Matches(*desc.Platform) {
+			return index.Image(desc.Digest)
+		}
+	}
+	return nil, ErrPlatformNotFound{Platform: platform}
+}
+
+// Matches reports whether the given descriptor platform satisfies the requested platform.
+// Empty variant and OS version values in the requested platform match any value,
+// and the wasi and wasip1 os values, which are both used for WASI preview 1 images, match each other.
+func (p Platform) Matches(other v1.Platform) bool {
+	if !sameOS(p.OS, other.OS) || p.Architecture != other.Architecture {
+		return false
+	}
+	if p.Variant != "" && p.Variant != other.Variant {
+		return false
+	}
+	if p.OSVersion != "" && p.OSVersion != other.OSVersion {
+		return false
+	}
+	return true
+}
+
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	if p.OSVersion != "" {
+		s += " (" + p.OSVersion + ")"
+	}
+	return s
+}
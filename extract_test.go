@@ -0,0 +1,89 @@
+package imgutil_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestExtract(t *testing.T) {
+	spec.Run(t, "Extract", testExtract, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testExtract(t *testing.T, when spec.G, it spec.S) {
+	var (
+		index    v1.ImageIndex
+		amd64    v1.Image
+		arm64    v1.Image
+		tempDir  string
+		err      error
+		platform = func(os, arch, variant string) *v1.Platform {
+			return &v1.Platform{OS: os, Architecture: arch, Variant: variant}
+		}
+	)
+
+	it.Before(func() {
+		amd64, err = random.Image(1024, 1)
+		h.AssertNil(t, err)
+		arm64, err = random.Image(1024, 1)
+		h.AssertNil(t, err)
+		index = mutate.AppendManifests(empty.Index,
+			mutate.IndexAddendum{Add: amd64, Descriptor: v1.Descriptor{Platform: platform("linux", "amd64", "")}},
+			mutate.IndexAddendum{Add: arm64, Descriptor: v1.Descriptor{Platform: platform("linux", "arm64", "v8")}},
+		)
+
+		tempDir, err = os.MkdirTemp("", "extract-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tempDir))
+	})
+
+	when("#ImageFromIndex", func() {
+		it("selects the image matching the platform", func() {
+			img, err := imgutil.ImageFromIndex(index, imgutil.Platform{OS: "linux", Architecture: "arm64"})
+			h.AssertNil(t, err)
+
+			expected, err := arm64.Digest()
+			h.AssertNil(t, err)
+			actual, err := img.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, expected)
+		})
+
+		it("errors when no image matches the platform", func() {
+			_, err := imgutil.ImageFromIndex(index, imgutil.Platform{OS: "linux", Architecture: "arm64", Variant: "v7"})
+			h.AssertError(t, err, "failed to find image matching platform linux/arm64/v7")
+			var notFound imgutil.ErrPlatformNotFound
+			h.AssertEq(t, errors.As(err, &notFound), true)
+			h.AssertEq(t, notFound.Platform, imgutil.Platform{OS: "linux", Architecture: "arm64", Variant: "v7"})
+		})
+	})
+
+	when("#ExtractImage", func() {
+		it("writes the selected image to a layout path preserving its digest", func() {
+			digest, err := imgutil.ExtractImage(index, imgutil.Platform{OS: "linux", Architecture: "amd64"}, layout.NewExtractDestination(tempDir))
+			h.AssertNil(t, err)
+
+			expected, err := amd64.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, digest, expected)
+
+			indexManifest := h.ReadIndexManifest(t, tempDir)
+			h.AssertEq(t, len(indexManifest.Manifests), 1)
+			h.AssertEq(t, indexManifest.Manifests[0].Digest, expected)
+		})
+	})
+}
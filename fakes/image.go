@@ -2,17 +2,22 @@ package fakes
 
 import (
 	"archive/tar"
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	registryName "github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 	"github.com/google/go-containerregistry/pkg/v1/types"
 	"github.com/pkg/errors"
 
@@ -47,6 +52,7 @@ type Image struct {
 	layersMap        map[string]string
 	prevLayersMap    map[string]string
 	reusedLayers     []string
+	reusedBaseLayers bool
 	labels           map[string]string
 	env              map[string]string
 	topLayerSha      string
@@ -62,10 +68,16 @@ type Image struct {
 	createdAt        time.Time
 	layerDir         string
 	workingDir       string
+	user             string
+	stopSignal       string
+	volumes          map[string]struct{}
+	exposedPorts     []string
 	savedNames       map[string]bool
 	manifestSize     int64
 	refName          string
 	savedAnnotations map[string]string
+	squashedFrom     []string
+	sboms            map[string][]byte
 }
 
 func (i *Image) CreatedAt() (time.Time, error) {
@@ -204,6 +216,34 @@ func (i *Image) SetAnnotations(_ map[string]string) error {
 	return nil
 }
 
+func (i *Image) SetExposedPorts(ports ...string) error {
+	i.exposedPorts = nil
+	for _, port := range ports {
+		normalized, err := imgutil.NormalizePort(port)
+		if err != nil {
+			return err
+		}
+		i.exposedPorts = append(i.exposedPorts, normalized)
+	}
+	sort.Strings(i.exposedPorts)
+	return nil
+}
+
+func (i *Image) SetVolumes(volumes map[string]struct{}) error {
+	i.volumes = volumes
+	return nil
+}
+
+func (i *Image) SetStopSignal(signal string) error {
+	i.stopSignal = signal
+	return nil
+}
+
+func (i *Image) SetUser(user string) error {
+	i.user = user
+	return nil
+}
+
 func (i *Image) SetWorkingDir(dir string) error {
 	i.workingDir = dir
 	return nil
@@ -258,6 +298,10 @@ func (i *Image) AddLayerWithDiffIDAndHistory(path, diffID string, history v1.His
 	return nil
 }
 
+func (i *Image) AddLayerWithDiffIDAndMediaType(path, diffID string, _ types.MediaType) error {
+	return i.AddLayerWithDiffID(path, diffID)
+}
+
 func shaForFile(path string) (string, error) {
 	rc, err := os.Open(filepath.Clean(path))
 	if err != nil {
@@ -286,6 +330,34 @@ func (i *Image) GetLayer(sha string) (io.ReadCloser, error) {
 	return os.Open(filepath.Clean(path))
 }
 
+func (i *Image) ReadFile(path string) ([]byte, error) {
+	layers, err := i.v1Layers()
+	if err != nil {
+		return nil, err
+	}
+	return imgutil.ReadFileFromLayers(layers, path)
+}
+
+func (i *Image) WalkFiles(fn imgutil.WalkFunc) error {
+	layers, err := i.v1Layers()
+	if err != nil {
+		return err
+	}
+	return imgutil.WalkLayers(layers, fn)
+}
+
+func (i *Image) v1Layers() ([]v1.Layer, error) {
+	var layers []v1.Layer
+	for _, path := range i.layers {
+		layer, err := tarball.LayerFromFile(path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	return layers, nil
+}
+
 func (i *Image) ReuseLayer(sha string) error {
 	prevLayer, ok := i.prevLayersMap[sha]
 	if !ok {
@@ -296,6 +368,11 @@ func (i *Image) ReuseLayer(sha string) error {
 	return nil
 }
 
+func (i *Image) ReuseBaseImageLayers() error {
+	i.reusedBaseLayers = true
+	return nil
+}
+
 func (i *Image) ReuseLayerWithHistory(sha string, history v1.History) error {
 	if err := i.ReuseLayer(sha); err != nil {
 		return err
@@ -304,6 +381,50 @@ func (i *Image) ReuseLayerWithHistory(sha string, history v1.History) error {
 	return nil
 }
 
+func (i *Image) AddSBOM(mediaType string, content io.Reader) error {
+	sbom, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	if i.sboms == nil {
+		i.sboms = map[string][]byte{}
+	}
+	i.sboms[mediaType] = sbom
+	return nil
+}
+
+func (i *Image) SquashLayers(fromDiffID string) error {
+	i.squashedFrom = append(i.squashedFrom, fromDiffID)
+	return nil
+}
+
+func (i *Image) TrimBuildLayers() error {
+	var (
+		layers  []string
+		history []v1.History
+	)
+	for idx, path := range i.layers {
+		if idx < len(i.history) && i.history[idx].Comment == imgutil.BuildOnlyLayerMarker {
+			for diffID, layerPath := range i.layersMap {
+				if layerPath == path {
+					delete(i.layersMap, diffID)
+				}
+			}
+			continue
+		}
+		layers = append(layers, path)
+		if idx < len(i.history) {
+			history = append(history, i.history[idx])
+		}
+	}
+	if len(i.history) > len(i.layers) {
+		history = append(history, i.history[len(i.layers):]...)
+	}
+	i.layers = layers
+	i.history = history
+	return nil
+}
+
 func (i *Image) Save(additionalNames ...string) error {
 	return i.SaveAs(i.Name(), additionalNames...)
 }
@@ -328,7 +449,7 @@ func (i *Image) SaveAs(name string, additionalNames ...string) error {
 
 	allNames := append([]string{name}, additionalNames...)
 	if i.refName != "" {
-		i.savedAnnotations["org.opencontainers.image.ref.name"] = i.refName
+		i.savedAnnotations[imgutil.OCIRefNameAnnotation] = i.refName
 	}
 
 	var errs []imgutil.SaveDiagnostic
@@ -385,6 +506,11 @@ func (i *Image) Valid() bool {
 	return !i.deleted
 }
 
+// Validate finds no problem in fake images, which have no blobs to check.
+func (i *Image) Validate() (imgutil.ValidationReport, error) {
+	return imgutil.ValidationReport{}, nil
+}
+
 func (i *Image) AnnotateRefName(refName string) error {
 	i.refName = refName
 	return nil
@@ -420,10 +546,40 @@ func (i *Image) ConfigLayerPath() string {
 	return i.layers[1]
 }
 
+// SquashedFrom returns the diff IDs SquashLayers was called with, in order.
+func (i *Image) SquashedFrom() []string {
+	return i.squashedFrom
+}
+
+// SBOMs returns the contents of the SBOMs added with AddSBOM, by media type.
+func (i *Image) SBOMs() map[string][]byte {
+	return i.sboms
+}
+
 func (i *Image) ReusedLayers() []string {
 	return i.reusedLayers
 }
 
+func (i *Image) ReusedBaseLayers() bool {
+	return i.reusedBaseLayers
+}
+
+func (i *Image) ExposedPorts() ([]string, error) {
+	return i.exposedPorts, nil
+}
+
+func (i *Image) Volumes() (map[string]struct{}, error) {
+	return i.volumes, nil
+}
+
+func (i *Image) StopSignal() (string, error) {
+	return i.stopSignal, nil
+}
+
+func (i *Image) User() (string, error) {
+	return i.user, nil
+}
+
 func (i *Image) WorkingDir() (string, error) {
 	return i.workingDir, nil
 }
@@ -537,6 +693,87 @@ func (i *Image) ManifestSize() (int64, error) {
 	return i.manifestSize, nil
 }
 
+func (i *Image) Manifest() (*v1.Manifest, error) {
+	layers, err := i.v1Layers()
+	if err != nil {
+		return nil, err
+	}
+	rawConfigFile, err := json.Marshal(i.configFile())
+	if err != nil {
+		return nil, err
+	}
+	configDigest, configSize, err := v1.SHA256(bytes.NewReader(rawConfigFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &v1.Manifest{
+		SchemaVersion: 2,
+		MediaType:     types.DockerManifestSchema2,
+		Config:        v1.Descriptor{MediaType: types.DockerConfigJSON, Size: configSize, Digest: configDigest},
+	}
+	for _, layer := range layers {
+		desc, err := partial.Descriptor(layer)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Layers = append(manifest.Layers, *desc)
+	}
+	return manifest, nil
+}
+
+func (i *Image) Inspect() (string, error) {
+	manifest, err := i.Manifest()
+	if err != nil {
+		return "", err
+	}
+	configFile := i.configFile()
+	out, err := json.MarshalIndent(imgutil.ImageInspection{
+		Platform: configFile.Platform(),
+		Manifest: manifest,
+		Config:   configFile,
+		History:  i.history,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// configFile returns the config file of the image, with the platform and history it was given.
+func (i *Image) configFile() *v1.ConfigFile {
+	return &v1.ConfigFile{
+		Architecture: i.architecture,
+		OS:           i.os,
+		OSVersion:    i.osVersion,
+		Variant:      i.variant,
+		History:      i.history,
+	}
+}
+
+func (i *Image) LayerSizes() ([]int64, error) {
+	manifest, err := i.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	var sizes []int64
+	for _, layer := range manifest.Layers {
+		sizes = append(sizes, layer.Size)
+	}
+	return sizes, nil
+}
+
+func (i *Image) TotalSize() (int64, error) {
+	manifest, err := i.Manifest()
+	if err != nil {
+		return 0, err
+	}
+	total := i.manifestSize + manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		total += layer.Size
+	}
+	return total, nil
+}
+
 func (i *Image) SavedAnnotations() map[string]string {
 	return i.savedAnnotations
 }
@@ -0,0 +1,85 @@
+package imgutil
+
+// PlatformFallback returns the platforms to try, in order of preference, when an image index has no image
+// for the requested platform. See remote.WithPlatformFallback.
+type PlatformFallback func(requested Platform) []Platform
+
+// archAliases maps architecture names that are used interchangeably to the name used in image platforms.
+var archAliases = map[string]Platform{
+	"aarch64": {Architecture: "arm64"},
+	"x86_64":  {Architecture: "amd64"},
+	"x86-64":  {Architecture: "amd64"},
+	"armhf":   {Architecture: "arm", Variant: "v7"},
+	"armel":   {Architecture: "arm", Variant: "v6"},
+	"i386":    {Architecture: "386"},
+}
+
+// ArchAliasFallback falls back to the platform that is known by another name: e.g. arm/v8 is arm64,
+// aarch64 and x86_64 are arm64 and amd64, and WASI preview 1 images are recorded as either wasip1/wasm or wasi/wasm.
+// For arm64, the v8 variant is tried with and without being recorded.
+func ArchAliasFallback(requested Platform) []Platform {
+	var fallbacks []Platform
+	if alias, ok := archAliases[requested.Architecture]; ok {
+		fallback := requested
+		fallback.Architecture = alias.Architecture
+		if alias.Variant != "" {
+			fallback.Variant = alias.Variant
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+	if alias, ok := wasiOSAliases[requested.OS]; ok && requested.IsWasm() {
+		fallback := requested
+		fallback.OS = alias
+		fallbacks = append(fallbacks, fallback)
+	}
+	if requested.Architecture == "arm" && requested.Variant == "v8" {
+		fallback := requested
+		fallback.Architecture, fallback.Variant = "arm64", "v8"
+		fallbacks = append(fallbacks, fallback)
+	}
+	for _, fallback := range fallbacks {
+		if fallback.Architecture == "arm64" && fallback.Variant == "" {
+			withVariant := fallback
+			withVariant.Variant = "v8"
+			fallbacks = append(fallbacks, withVariant)
+			break
+		}
+	}
+	return fallbacks
+}
+
+// AnyVariantFallback falls back to any variant of the requested architecture, when a variant is requested.
+func AnyVariantFallback(requested Platform) []Platform {
+	if requested.Variant == "" {
+		return nil
+	}
+	fallback := requested
+	fallback.Variant = ""
+	return []Platform{fallback}
+}
+
+// ChainPlatformFallbacks returns a fallback that tries the platforms returned by each of the given fallbacks in order,
+// without duplicates. Each fallback is applied to the requested platform and to the platforms returned by the previous ones,
+// so that e.g. chaining ArchAliasFallback and AnyVariantFallback falls back from arm/v8 to arm64 with any variant.
+func ChainPlatformFallbacks(fallbacks ...PlatformFallback) PlatformFallback {
+	return func(requested Platform) []Platform {
+		seen := map[Platform]bool{requested: true}
+		candidates := []Platform{requested}
+		var result []Platform
+		for _, fallback := range fallbacks {
+			for _, candidate := range candidates {
+				for _, platform := range fallback(candidate) {
+					if !seen[platform] {
+						seen[platform] = true
+						result = append(result, platform)
+					}
+				}
+			}
+			candidates = append([]Platform{requested}, result...)
+		}
+		return result
+	}
+}
+
+// DefaultPlatformFallback falls back to aliases of the requested architecture, then to any variant of those architectures.
+var DefaultPlatformFallback = ChainPlatformFallbacks(ArchAliasFallback, AnyVariantFallback)
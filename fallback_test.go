@@ -0,0 +1,58 @@
+package imgutil_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestPlatformFallback(t *testing.T) {
+	spec.Run(t, "PlatformFallback", testPlatformFallback, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testPlatformFallback(t *testing.T, when spec.G, it spec.S) {
+	linux := func(arch, variant string) imgutil.Platform {
+		return imgutil.Platform{OS: "linux", Architecture: arch, Variant: variant}
+	}
+
+	when("#ArchAliasFallback", func() {
+		it("falls back from arm/v8 to arm64", func() {
+			h.AssertEq(t, imgutil.ArchAliasFallback(linux("arm", "v8")), []imgutil.Platform{linux("arm64", "v8")})
+		})
+
+		it("falls back from alternative architecture names", func() {
+			h.AssertEq(t, imgutil.ArchAliasFallback(linux("aarch64", "")), []imgutil.Platform{linux("arm64", ""), linux("arm64", "v8")})
+			h.AssertEq(t, imgutil.ArchAliasFallback(linux("x86_64", "")), []imgutil.Platform{linux("amd64", "")})
+		})
+
+		it("falls back between the wasi and wasip1 os", func() {
+			h.AssertEq(t, imgutil.ArchAliasFallback(imgutil.Platform{OS: "wasip1", Architecture: "wasm"}), []imgutil.Platform{{OS: "wasi", Architecture: "wasm"}})
+			h.AssertEq(t, imgutil.ArchAliasFallback(imgutil.Platform{OS: "wasi", Architecture: "wasm"}), []imgutil.Platform{{OS: "wasip1", Architecture: "wasm"}})
+		})
+
+		it("has no fallback for canonical names", func() {
+			h.AssertEq(t, len(imgutil.ArchAliasFallback(linux("amd64", ""))), 0)
+		})
+	})
+
+	when("#AnyVariantFallback", func() {
+		it("falls back to any variant", func() {
+			h.AssertEq(t, imgutil.AnyVariantFallback(linux("arm", "v7")), []imgutil.Platform{linux("arm", "")})
+			h.AssertEq(t, len(imgutil.AnyVariantFallback(linux("arm", ""))), 0)
+		})
+	})
+
+	when("#DefaultPlatformFallback", func() {
+		it("tries aliases, then any variant", func() {
+			h.AssertEq(t, imgutil.DefaultPlatformFallback(linux("arm", "v8")), []imgutil.Platform{
+				linux("arm64", "v8"),
+				linux("arm", ""),
+				linux("arm64", ""),
+			})
+		})
+	})
+}
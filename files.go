@@ -0,0 +1,240 @@
+package imgutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq"
+
+	// maxLinkHops bounds how many symbolic and hard links ReadFile follows, to guard against link cycles.
+	maxLinkHops = 40
+)
+
+// WalkFunc is called by WalkFiles for each file in the image.
+// The path is absolute and uses forward slashes; contents are only valid until the function returns.
+// Returning fs.SkipAll stops the walk without error.
+type WalkFunc func(path string, header *tar.Header, contents io.Reader) error
+
+// WalkFiles calls fn for each file visible in the image filesystem, reading the layers from the top down.
+// Files that are overwritten or deleted by a higher layer are skipped, and whiteouts are not reported.
+func (i *CNBImageCore) WalkFiles(fn WalkFunc) error {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return err
+	}
+	return WalkLayers(layers, fn)
+}
+
+// ReadFile returns the contents of the file at the given absolute path in the image filesystem,
+// following symbolic and hard links. The layers are read from the top down until the file is found,
+// so files from upper layers are found without reading the whole image.
+func (i *CNBImageCore) ReadFile(filePath string) ([]byte, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	return ReadFileFromLayers(layers, filePath)
+}
+
+// WalkLayers implements WalkFiles for the given layers, ordered from the bottom to the top of the image.
+func WalkLayers(layers []v1.Layer, fn WalkFunc) error {
+	shadows := newShadowTracker()
+	for idx := len(layers) - 1; idx >= 0; idx-- {
+		err := forEachEntry(layers[idx], func(_ int, hdr *tar.Header, r io.Reader) error {
+			name := cleanEntryName(hdr.Name)
+			if name == "" || !shadows.visit(name) {
+				return nil
+			}
+			if _, kind := whiteoutTarget(name); kind != notWhiteout {
+				return nil
+			}
+			return fn("/"+name, hdr, r)
+		})
+		if errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		shadows.nextLayer()
+	}
+	return nil
+}
+
+// ReadFileFromLayers implements ReadFile for the given layers, ordered from the bottom to the top of the image.
+func ReadFileFromLayers(layers []v1.Layer, filePath string) ([]byte, error) {
+	target := cleanEntryName(filePath)
+	for hops := 0; hops <= maxLinkHops; hops++ {
+		var (
+			found    bool
+			contents []byte
+			link     string
+		)
+		err := WalkLayers(layers, func(name string, hdr *tar.Header, r io.Reader) error {
+			if cleanEntryName(name) != target {
+				return nil
+			}
+			found = true
+			switch hdr.Typeflag {
+			case tar.TypeSymlink:
+				link = hdr.Linkname
+				if !path.IsAbs(link) {
+					link = path.Join(path.Dir(name), link)
+				}
+			case tar.TypeLink:
+				link = "/" + hdr.Linkname
+			case tar.TypeDir:
+				return fmt.Errorf("%s is a directory", name)
+			default:
+				var buf bytes.Buffer
+				if _, err := io.Copy(&buf, r); err != nil { // #nosec G110
+					return err
+				}
+				contents = buf.Bytes()
+			}
+			return fs.SkipAll
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, ErrFileNotFound{Path: filePath}
+		}
+		if link == "" {
+			return contents, nil
+		}
+		target = cleanEntryName(link)
+	}
+	return nil, fmt.Errorf("too many links when reading %s", filePath)
+}
+
+type whiteoutKind int
+
+const (
+	notWhiteout whiteoutKind = iota
+	deletion
+	opaqueDir
+)
+
+// whiteoutTarget reports whether the entry is a whiteout, and the path it deletes or makes opaque.
+func whiteoutTarget(name string) (string, whiteoutKind) {
+	dir, base := path.Dir(name), path.Base(name)
+	switch {
+	case base == opaqueWhiteout:
+		return dir, opaqueDir
+	case strings.HasPrefix(base, whiteoutPrefix):
+		return path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)), deletion
+	default:
+		return "", notWhiteout
+	}
+}
+
+// shadowTracker tracks which paths are shadowed by higher layers while the layers of an image are read from the top down.
+type shadowTracker struct {
+	seen    map[string]bool
+	deleted map[string]bool
+	opaque  map[string]bool
+	// whiteouts in the current layer only apply to lower layers
+	layerDeleted map[string]bool
+	layerOpaque  map[string]bool
+}
+
+func newShadowTracker() *shadowTracker {
+	return &shadowTracker{
+		seen:         map[string]bool{},
+		deleted:      map[string]bool{},
+		opaque:       map[string]bool{},
+		layerDeleted: map[string]bool{},
+		layerOpaque:  map[string]bool{},
+	}
+}
+
+// visit records an entry of the current layer and reports whether it is visible,
+// i.e. neither overwritten nor deleted by a higher layer.
+func (s *shadowTracker) visit(name string) bool {
+	if s.seen[name] || s.hidden(name) {
+		return false
+	}
+	s.seen[name] = true
+	switch target, kind := whiteoutTarget(name); kind {
+	case deletion:
+		s.layerDeleted[target] = true
+	case opaqueDir:
+		s.layerOpaque[target] = true
+	}
+	return true
+}
+
+func (s *shadowTracker) hidden(name string) bool {
+	for dir := name; dir != "." && dir != "/" && dir != ""; dir = path.Dir(dir) {
+		if s.deleted[dir] || (dir != name && s.opaque[dir]) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextLayer applies the whiteouts of the current layer, before the layer below it is read.
+func (s *shadowTracker) nextLayer() {
+	for name := range s.layerDeleted {
+		s.deleted[name] = true
+	}
+	for name := range s.layerOpaque {
+		s.opaque[name] = true
+	}
+	s.layerDeleted, s.layerOpaque = map[string]bool{}, map[string]bool{}
+}
+
+// EntryLister is implemented by layers that can list their entries, and read the contents of some of them,
+// without reading the whole layer, such as the eStargz layers of remote images read with remote.WithLazyLayers.
+// WalkFiles and ReadFile use it when it is available. ForEachEntry returns an ErrUnsupported, before calling fn,
+// if the layer cannot be listed this way after all; the layer is then read in full.
+type EntryLister interface {
+	ForEachEntry(fn func(hdr *tar.Header, contents io.Reader) error) error
+}
+
+func forEachEntry(layer v1.Layer, fn func(n int, hdr *tar.Header, r io.Reader) error) error {
+	if lister, ok := layer.(EntryLister); ok {
+		var n int
+		err := lister.ForEachEntry(func(hdr *tar.Header, r io.Reader) error {
+			n++
+			return fn(n-1, hdr, r)
+		})
+		if !errors.As(err, &ErrUnsupported{}) {
+			return err
+		}
+	}
+	rc, err := layer.Uncompressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+	for n := 0; ; n++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(n, hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func cleanEntryName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,155 @@
+package imgutil_test
+
+import (
+	"archive/tar"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestFiles(t *testing.T) {
+	spec.Run(t, "Files", testFiles, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+type testEntry struct {
+	name     string
+	contents string
+	typeflag byte
+	linkname string
+}
+
+func testFiles(t *testing.T, when spec.G, it spec.S) {
+	var (
+		image  *imgutil.CNBImageCore
+		tmpDir string
+		err    error
+	)
+
+	createLayer := func(entries ...testEntry) string {
+		f, err := os.CreateTemp(tmpDir, "layer.*.tar")
+		h.AssertNil(t, err)
+		defer f.Close()
+		tw := tar.NewWriter(f)
+		for _, entry := range entries {
+			hdr := &tar.Header{Name: entry.name, Mode: 0644, Typeflag: entry.typeflag, Linkname: entry.linkname}
+			if hdr.Typeflag == 0 {
+				hdr.Typeflag = tar.TypeReg
+				hdr.Size = int64(len(entry.contents))
+			}
+			h.AssertNil(t, tw.WriteHeader(hdr))
+			_, err = tw.Write([]byte(entry.contents))
+			h.AssertNil(t, err)
+		}
+		h.AssertNil(t, tw.Close())
+		return f.Name()
+	}
+
+	it.Before(func() {
+		tmpDir, err = os.MkdirTemp("", "files-test")
+		h.AssertNil(t, err)
+
+		image, err = imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}})
+		h.AssertNil(t, err)
+		for _, entries := range [][]testEntry{
+			{
+				{name: "cnb/", typeflag: tar.TypeDir},
+				{name: "cnb/order.toml", contents: "base order"},
+				{name: "cnb/stack.toml", contents: "base stack"},
+				{name: "etc/dir/a", contents: "a"},
+				{name: "etc/dir/b", contents: "b"},
+			},
+			{
+				{name: "/cnb/order.toml", contents: "new order"},
+				{name: "cnb/.wh.stack.toml"},
+				{name: "etc/dir/.wh..wh..opq"},
+				{name: "etc/dir/c", contents: "c"},
+				{name: "cnb/order-link", typeflag: tar.TypeSymlink, linkname: "order.toml"},
+				{name: "cnb/order-hardlink", typeflag: tar.TypeLink, linkname: "cnb/order.toml"},
+				{name: "cnb/loop", typeflag: tar.TypeSymlink, linkname: "/cnb/loop"},
+			},
+		} {
+			h.AssertNil(t, image.AddLayer(createLayer(entries...)))
+		}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, image.Cleanup())
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#ReadFile", func() {
+		it("returns the file from the highest layer", func() {
+			contents, err := image.ReadFile("/cnb/order.toml")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "new order")
+		})
+
+		it("follows links", func() {
+			contents, err := image.ReadFile("/cnb/order-link")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "new order")
+
+			contents, err = image.ReadFile("/cnb/order-hardlink")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "new order")
+		})
+
+		it("honors whiteouts", func() {
+			_, err := image.ReadFile("/cnb/stack.toml")
+			h.AssertError(t, err, `failed to find file "/cnb/stack.toml" in image`)
+			h.AssertEq(t, errors.Is(err, fs.ErrNotExist), true)
+
+			_, err = image.ReadFile("/etc/dir/a")
+			h.AssertEq(t, errors.As(err, &imgutil.ErrFileNotFound{}), true)
+
+			contents, err := image.ReadFile("/etc/dir/c")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "c")
+		})
+
+		it("fails on link cycles and directories", func() {
+			_, err := image.ReadFile("/cnb/loop")
+			h.AssertError(t, err, "too many links")
+
+			_, err = image.ReadFile("/cnb")
+			h.AssertError(t, err, "is a directory")
+		})
+	})
+
+	when("#WalkFiles", func() {
+		it("visits each visible file once", func() {
+			var paths []string
+			h.AssertNil(t, image.WalkFiles(func(path string, _ *tar.Header, _ io.Reader) error {
+				paths = append(paths, path)
+				return nil
+			}))
+			sort.Strings(paths)
+			h.AssertEq(t, paths, []string{
+				"/cnb",
+				"/cnb/loop",
+				"/cnb/order-hardlink",
+				"/cnb/order-link",
+				"/cnb/order.toml",
+				"/etc/dir/c",
+			})
+		})
+
+		it("stops when the function returns fs.SkipAll", func() {
+			var count int
+			h.AssertNil(t, image.WalkFiles(func(string, *tar.Header, io.Reader) error {
+				count++
+				return fs.SkipAll
+			}))
+			h.AssertEq(t, count, 1)
+		})
+	})
+}
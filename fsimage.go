@@ -0,0 +1,196 @@
+package imgutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// FilesystemFormat is the format of a filesystem image written by ExportFilesystem.
+type FilesystemFormat int
+
+const (
+	// Ext4Filesystem is an ext4 filesystem, written with mkfs.ext4 from e2fsprogs 1.47.1 or later.
+	Ext4Filesystem FilesystemFormat = iota
+	// EROFSFilesystem is a read-only EROFS filesystem, written with mkfs.erofs from erofs-utils 1.7 or later.
+	EROFSFilesystem
+)
+
+func (f FilesystemFormat) String() string {
+	switch f {
+	case Ext4Filesystem:
+		return "ext4"
+	case EROFSFilesystem:
+		return "erofs"
+	default:
+		return fmt.Sprintf("FilesystemFormat(%d)", int(f))
+	}
+}
+
+type FilesystemOption func(*FilesystemOptions)
+
+type FilesystemOptions struct {
+	// Size is the size of an ext4 filesystem image in bytes.
+	// If not positive, the image is sized to fit the root filesystem with some free space.
+	Size int64
+	// Label is the volume label of the filesystem.
+	Label   string
+	TempDir string
+}
+
+// WithFilesystemSize sets the size, in bytes, of an ext4 filesystem image. EROFS images are always sized to fit.
+func WithFilesystemSize(size int64) FilesystemOption {
+	return func(o *FilesystemOptions) {
+		o.Size = size
+	}
+}
+
+// WithFilesystemLabel sets the volume label of the filesystem image.
+func WithFilesystemLabel(label string) FilesystemOption {
+	return func(o *FilesystemOptions) {
+		o.Label = label
+	}
+}
+
+// WithFilesystemTempDir causes the root filesystem to be staged in the given directory
+// instead of the default directory for temporary files.
+func WithFilesystemTempDir(path string) FilesystemOption {
+	return func(o *FilesystemOptions) {
+		o.TempDir = path
+	}
+}
+
+// WriteRootFS writes the root filesystem of the image to w as a tar,
+// with the layers merged and the files deleted by higher layers, and the whiteouts themselves, left out.
+func WriteRootFS(w io.Writer, image v1.Image) error {
+	layers, err := image.Layers()
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	if err = writeMergedLayers(tw, layers, false); err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExportFilesystem writes the root filesystem of the image to path as a filesystem image of the given format,
+// so that the image can be used as the root disk of a microVM (e.g. with Firecracker or Kata Containers) without a container runtime.
+// The output only depends on the image: the filesystem UUID is derived from the image digest,
+// and timestamps come from the image (its creation time, or NormalizedDateTime) rather than the clock.
+// The filesystem is created by the mkfs tool for the format, which must be on the PATH.
+func ExportFilesystem(image v1.Image, path string, format FilesystemFormat, ops ...FilesystemOption) error {
+	options := &FilesystemOptions{}
+	for _, op := range ops {
+		op(options)
+	}
+
+	configFile, err := getConfigFile(image)
+	if err != nil {
+		return err
+	}
+	if configFile.OS == "windows" {
+		return ErrUnsupported{Kind: "filesystem", Operation: "exporting a windows image", Reason: "windows images do not have a root filesystem that can be booted"}
+	}
+	digest, err := image.Digest()
+	if err != nil {
+		return err
+	}
+	epoch := NormalizedDateTime
+	if !configFile.Created.IsZero() {
+		epoch = configFile.Created.UTC()
+	}
+
+	tempFiles := NewTempFiles(options.TempDir, false)
+	defer tempFiles.Cleanup()
+	rootFS, err := tempFiles.CreateTemp("imgutil.rootfs.*.tar")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer rootFS.Close()
+	if err = WriteRootFS(rootFS, image); err != nil {
+		return fmt.Errorf("writing root filesystem: %w", err)
+	}
+	if err = rootFS.Close(); err != nil {
+		return err
+	}
+	fi, err := os.Stat(rootFS.Name())
+	if err != nil {
+		return err
+	}
+
+	// mkfs tools refuse to overwrite, or write into, an existing file
+	if err = os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	uuid := filesystemUUID(digest)
+	timestamp := strconv.FormatInt(epoch.Unix(), 10)
+	var cmd *exec.Cmd
+	switch format {
+	case Ext4Filesystem:
+		size := options.Size
+		if size <= 0 {
+			size = ext4SizeFor(fi.Size())
+		}
+		args := []string{
+			"-t", "ext4", "-q", "-F",
+			"-b", "4096", "-I", "256",
+			"-U", uuid,
+			"-E", "hash_seed=" + uuid + ",lazy_itable_init=0,lazy_journal_init=0,nodiscard",
+			"-d", rootFS.Name(),
+		}
+		if options.Label != "" {
+			args = append(args, "-L", options.Label)
+		}
+		args = append(args, path, strconv.FormatInt(size/1024, 10)+"k")
+		cmd = exec.Command("mkfs.ext4", args...) // #nosec G204
+		// E2FSPROGS_FAKE_TIME fixes the superblock and journal timestamps
+		cmd.Env = append(os.Environ(), "E2FSPROGS_FAKE_TIME="+timestamp, "SOURCE_DATE_EPOCH="+timestamp)
+	case EROFSFilesystem:
+		args := []string{"--quiet", "-T" + timestamp, "-U", uuid, "--tar=f"}
+		if options.Label != "" {
+			args = append(args, "-L", options.Label)
+		}
+		args = append(args, path, rootFS.Name())
+		cmd = exec.Command("mkfs.erofs", args...) // #nosec G204
+		cmd.Env = append(os.Environ(), "SOURCE_DATE_EPOCH="+timestamp)
+	default:
+		return fmt.Errorf("unsupported filesystem format: %s", format)
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err = cmd.Run(); err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("creating %s filesystem with %s: %w: %s", format, cmd.Path, err, bytes.TrimSpace(output.Bytes()))
+	}
+	return nil
+}
+
+// filesystemUUID returns a UUID derived from the image digest: the first 16 bytes of the SHA-256 of the digest,
+// with the version and variant bits of a version 5 UUID set. It is not a version 5 UUID, which is the SHA-1 of a namespace and name,
+// but tools that check the version bits accept it as one.
+func filesystemUUID(digest v1.Hash) string {
+	sum := sha256.Sum256([]byte(digest.String()))
+	b := sum[:16]
+	b[6] = (b[6] & 0x0f) | 0x50
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// ext4SizeFor returns the size of an ext4 filesystem that fits a root filesystem of the given tar size,
+// leaving room for metadata, the journal and some free space, rounded up to a whole number of MiB.
+func ext4SizeFor(tarSize int64) int64 {
+	const mib = 1 << 20
+	size := tarSize + tarSize/4 + 64*mib
+	return (size + mib - 1) / mib * mib
+}
@@ -0,0 +1,149 @@
+package imgutil_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestFilesystem(t *testing.T) {
+	spec.Run(t, "Filesystem", testFilesystem, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testFilesystem(t *testing.T, when spec.G, it spec.S) {
+	var (
+		image  v1.Image
+		tmpDir string
+	)
+
+	createLayer := func(files ...string) string {
+		f, err := os.CreateTemp(tmpDir, "layer.*.tar")
+		h.AssertNil(t, err)
+		defer f.Close()
+		tw := tar.NewWriter(f)
+		for _, file := range files {
+			h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: file, Mode: 0644, Size: int64(len(file)), ModTime: imgutil.NormalizedDateTime}))
+			_, err = tw.Write([]byte(file))
+			h.AssertNil(t, err)
+		}
+		h.AssertNil(t, tw.Close())
+		return f.Name()
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "filesystem-test")
+		h.AssertNil(t, err)
+
+		cnbImage, err := imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}})
+		h.AssertNil(t, err)
+		for _, files := range [][]string{
+			{"etc/os-release", "app/a", "app/b"},
+			{"app/.wh.a", "app/c"},
+			{"app/b"},
+		} {
+			h.AssertNil(t, cnbImage.AddLayer(createLayer(files...)))
+		}
+		image = cnbImage.UnderlyingImage()
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#WriteRootFS", func() {
+		it("writes the merged layers without whiteouts", func() {
+			var buf bytes.Buffer
+			h.AssertNil(t, imgutil.WriteRootFS(&buf, image))
+
+			var names []string
+			tr := tar.NewReader(&buf)
+			for {
+				hdr, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				h.AssertNil(t, err)
+				names = append(names, hdr.Name)
+			}
+			h.AssertEq(t, names, []string{"etc/os-release", "app/c", "app/b"})
+		})
+	})
+
+	when("#ExportFilesystem", func() {
+		exportTwice := func(format imgutil.FilesystemFormat) string {
+			first := filepath.Join(tmpDir, "first."+format.String())
+			second := filepath.Join(tmpDir, "second."+format.String())
+			h.AssertNil(t, imgutil.ExportFilesystem(image, first, format, imgutil.WithFilesystemLabel("rootfs")))
+			h.AssertNil(t, imgutil.ExportFilesystem(image, second, format, imgutil.WithFilesystemLabel("rootfs")))
+
+			firstContents, err := os.ReadFile(first)
+			h.AssertNil(t, err)
+			secondContents, err := os.ReadFile(second)
+			h.AssertNil(t, err)
+			h.AssertEq(t, bytes.Equal(firstContents, secondContents), true)
+			return first
+		}
+
+		it("writes a deterministic ext4 image", func() {
+			requireTool(t, "mke2fs", "-V", 1, 47, 1)
+
+			path := exportTwice(imgutil.Ext4Filesystem)
+			output, err := exec.Command("debugfs", "-R", "cat /app/c", path).Output() // #nosec G204
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(output), "app/c")
+		})
+
+		it("writes a deterministic erofs image", func() {
+			requireTool(t, "mkfs.erofs", "--version", 1, 7, 0)
+
+			exportTwice(imgutil.EROFSFilesystem)
+		})
+
+		it("rejects windows images", func() {
+			windowsImage, err := imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "windows", Architecture: "amd64"}})
+			h.AssertNil(t, err)
+			err = imgutil.ExportFilesystem(windowsImage.UnderlyingImage(), filepath.Join(tmpDir, "windows.ext4"), imgutil.Ext4Filesystem)
+			h.AssertError(t, err, "windows")
+		})
+	})
+}
+
+// requireTool skips the test unless the tool reports, when run with versionFlag, a version of at least major.minor.patch.
+func requireTool(t *testing.T, tool, versionFlag string, major, minor, patch int) {
+	t.Helper()
+	output, err := exec.Command(tool, versionFlag).CombinedOutput() // #nosec G204
+	if err != nil {
+		t.Skipf("%s is not available: %s", tool, err)
+	}
+	match := regexp.MustCompile(`(\d+)\.(\d+)(?:\.(\d+))?`).FindSubmatch(output)
+	if match == nil {
+		t.Skipf("cannot determine the version of %s", tool)
+	}
+	var version [3]int
+	for i := range version {
+		version[i], _ = strconv.Atoi(string(match[i+1]))
+	}
+	if version[0] != major {
+		if version[0] < major {
+			t.Skipf("%s %s is older than %d.%d.%d", tool, match[0], major, minor, patch)
+		}
+		return
+	}
+	if version[1] < minor || (version[1] == minor && version[2] < patch) {
+		t.Skipf("%s %s is older than %d.%d.%d", tool, match[0], major, minor, patch)
+	}
+}
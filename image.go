@@ -3,6 +3,7 @@ package imgutil
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"strings"
 	"time"
 
@@ -20,6 +21,8 @@ type Image interface {
 	// Found reports if image exists in the image store with `Name()`.
 	Found() bool
 	Identifier() (Identifier, error)
+	// Inspect returns the digest, media type, platform, manifest, config and history of the image as a JSON ImageInspection.
+	Inspect() (string, error)
 	// Kind exposes the type of image that backs the imgutil.Image implementation.
 	// It could be `local`, `remote`, or `layout`.
 	Kind() string
@@ -27,6 +30,8 @@ type Image interface {
 	UnderlyingImage() v1.Image
 	// Valid returns true if the image is well-formed (e.g. all manifest layers exist on the registry).
 	Valid() bool
+	// Validate deeply checks the image, e.g. that its layers match their descriptors, and returns every problem found.
+	Validate() (ValidationReport, error)
 
 	// setters
 
@@ -46,8 +51,13 @@ type WithEditableManifest interface {
 	Annotations() (map[string]string, error)
 	Digest() (v1.Hash, error)
 	GetAnnotateRefName() (string, error)
+	Manifest() (*v1.Manifest, error)
+	// ManifestSize returns the size of the manifest, as Size does for a v1.Image.
 	ManifestSize() (int64, error)
 	MediaType() (types.MediaType, error)
+	// TotalSize returns the sum of the sizes of the manifest, the config and the layers of the image, as stored by the backend.
+	// It is not named Size because images are also v1.Image, whose Size is the size of the manifest.
+	TotalSize() (int64, error)
 
 	// setters
 
@@ -62,6 +72,8 @@ type WithEditableConfig interface {
 	CreatedAt() (time.Time, error)
 	Entrypoint() ([]string, error)
 	Env(key string) (string, error)
+	// ExposedPorts returns the ports the image exposes, sorted, in the form "port/protocol", e.g. "8080/tcp".
+	ExposedPorts() ([]string, error)
 	History() ([]v1.History, error)
 	Label(string) (string, error)
 	Labels() (map[string]string, error)
@@ -69,7 +81,13 @@ type WithEditableConfig interface {
 	OSFeatures() ([]string, error)
 	OSVersion() (string, error)
 	RemoveLabel(string) error
+	// StopSignal returns the signal sent to stop containers of the image, e.g. "SIGTERM", or "" for the runtime default.
+	StopSignal() (string, error)
+	// User returns the user (and optionally group) that the image runs as, e.g. "cnb" or "1000:1000".
+	User() (string, error)
 	Variant() (string, error)
+	// Volumes returns the mount points declared as volumes in the image, e.g. "/data".
+	Volumes() (map[string]struct{}, error)
 	WorkingDir() (string, error)
 
 	// setters
@@ -78,12 +96,18 @@ type WithEditableConfig interface {
 	SetCmd(...string) error
 	SetEntrypoint(...string) error
 	SetEnv(string, string) error
+	// SetExposedPorts replaces the ports the image exposes. Ports without a protocol, e.g. "8080", are exposed over tcp.
+	SetExposedPorts(...string) error
 	SetHistory([]v1.History) error
 	SetLabel(string, string) error
 	SetOS(string) error
 	SetOSFeatures([]string) error
 	SetOSVersion(string) error
+	SetStopSignal(string) error
+	SetUser(string) error
 	SetVariant(string) error
+	// SetVolumes replaces the mount points declared as volumes in the image.
+	SetVolumes(map[string]struct{}) error
 	SetWorkingDir(string) error
 }
 
@@ -92,18 +116,40 @@ type WithEditableLayers interface {
 
 	// GetLayer retrieves layer by diff id. Returns a reader of the uncompressed contents of the layer.
 	GetLayer(diffID string) (io.ReadCloser, error)
+	// LayerSizes returns the compressed sizes of the layers, from the bottom up, as in the manifest of the image.
+	// For images in a daemon, the layers that are only in the daemon are downloaded to compute them.
+	LayerSizes() ([]int64, error)
+	// ReadFile returns the contents of the file at the given absolute path in the image filesystem,
+	// searching the layers from the top down. Returns ErrFileNotFound if the file does not exist.
+	ReadFile(path string) ([]byte, error)
 	// TopLayer returns the diff id for the top layer
 	TopLayer() (string, error)
+	// WalkFiles calls fn for each file visible in the image filesystem, honoring whiteouts.
+	WalkFiles(fn WalkFunc) error
 
 	// setters
 
 	AddLayer(path string) error
 	AddLayerWithDiffID(path, diffID string) error
 	AddLayerWithDiffIDAndHistory(path, diffID string, history v1.History) error
+	// AddLayerWithDiffIDAndMediaType adds a blob that is already compressed as described by the media type, without recompressing it,
+	// so that its digest is preserved.
+	AddLayerWithDiffIDAndMediaType(path, diffID string, mediaType types.MediaType) error
 	AddOrReuseLayerWithHistory(path, diffID string, history v1.History) error
+	// AddSBOM stores the SBOM with the given media type in the image, as a layer annotated with SBOMMediaTypeAnnotation,
+	// or, for backends that support it, as a referrer artifact attached when the image is saved.
+	AddSBOM(mediaType string, content io.Reader) error
 	Rebase(string, Image) error
 	ReuseLayer(diffID string) error
 	ReuseLayerWithHistory(diffID string, history v1.History) error
+	// ReuseBaseImageLayers takes the layers that came from the base image from the previous image instead, where it has them,
+	// so that they need not be read from the base image when saving. Only descriptors are compared; no layer is read.
+	ReuseBaseImageLayers() error
+	// SquashLayers collapses all layers above the layer with the given diff ID into a single layer,
+	// or all the layers of the image if the diff ID is empty.
+	SquashLayers(fromDiffID string) error
+	// TrimBuildLayers removes the layers added with a history marked by BuildOnlyHistory.
+	TrimBuildLayers() error
 }
 
 type Identifier fmt.Stringer
@@ -140,3 +186,28 @@ type ErrLayerNotFound struct {
 func (e ErrLayerNotFound) Error() string {
 	return fmt.Sprintf("failed to find layer with diff ID %q", e.DiffID)
 }
+
+// ErrFileNotFound is returned when a file does not exist in the image filesystem.
+type ErrFileNotFound struct {
+	Path string
+}
+
+func (e ErrFileNotFound) Error() string {
+	return fmt.Sprintf("failed to find file %q in image", e.Path)
+}
+
+func (e ErrFileNotFound) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
+
+// ErrUnsupported is returned when a backend cannot perform an operation
+// because the underlying image store is unable to represent the result.
+type ErrUnsupported struct {
+	Kind      string
+	Operation string
+	Reason    string
+}
+
+func (e ErrUnsupported) Error() string {
+	return fmt.Sprintf("%s does not support %s: %s", e.Kind, e.Operation, e.Reason)
+}
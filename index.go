@@ -1,20 +1,35 @@
 package imgutil
 
 import (
+	"fmt"
+
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 )
 
 // ImageIndex an Interface with list of Methods required for creation and manipulation of v1.IndexManifest
 type ImageIndex interface {
 	// getters
+	//
+	// Descriptor fields are returned as copies, so changing the returned values does not change the index.
 
+	// Found reports if the index exists in the local store with the name it was created with.
+	Found() bool
+	// Valid returns true if the index is well-formed (e.g. all manifests have parseable digests and sane platforms).
+	Valid() bool
 	Annotations(digest name.Digest) (annotations map[string]string, err error)
+	// Attestations returns the descriptors of the attestation manifests linked to the image with the given digest.
+	Attestations(digest name.Digest) ([]v1.Descriptor, error)
 	Architecture(digest name.Digest) (arch string, err error)
 	OS(digest name.Digest) (os string, err error)
 	OSFeatures(digest name.Digest) (osFeatures []string, err error)
 	OSVersion(digest name.Digest) (osVersion string, err error)
 	Variant(digest name.Digest) (osVariant string, err error)
+	// ArtifactType returns the artifactType of the index manifest, per the OCI 1.1 spec, or "" if it has none.
+	ArtifactType() string
+	// Subject returns the descriptor of the manifest the index refers to, per the OCI 1.1 spec, or nil if it has none.
+	Subject() (*v1.Descriptor, error)
 
 	// setters
 
@@ -22,14 +37,112 @@ type ImageIndex interface {
 	SetArchitecture(digest name.Digest, arch string) (err error)
 	SetOS(digest name.Digest, os string) (err error)
 	SetVariant(digest name.Digest, osVariant string) (err error)
+	// SetPlatform sets the os, architecture, variant and os version of the manifest with the given digest at once.
+	SetPlatform(digest name.Digest, platform Platform) (err error)
+	// SetArtifactType sets the artifactType of the index manifest, e.g. for an index of attestations; it requires an OCI index.
+	SetArtifactType(artifactType string) error
+	// SetSubject sets the manifest the index refers to, e.g. the image an index of attestations is about; it requires an OCI index.
+	SetSubject(subject v1.Descriptor) error
+	// ConvertToOCI converts a Docker manifest list to an OCI image index, carrying over its annotations.
+	ConvertToOCI() error
+	// SetMediaType converts the index, and with WithConvertManifests the images it refers to, to the given index media type.
+	SetMediaType(mediaType types.MediaType, ops ...IndexOption) (MediaTypeConversion, error)
 
 	// misc
 
-	Inspect() (string, error)
+	// Inspect returns the index manifest, raw by default, or rendered as set with WithInspectFormat or WithInspectTemplate.
+	Inspect(ops ...IndexOption) (string, error)
 	AddManifest(image v1.Image)
+	// AddAttestation adds a non-runnable attestation manifest linked to the image with the given digest.
+	AddAttestation(digest name.Digest, attestation v1.Image) error
 	RemoveManifest(digest name.Digest) error
+	// ReplaceManifest adds an image, removing the images for the same platform, including the Windows build of its os.version.
+	ReplaceManifest(image v1.Image) error
+	// BestMatch returns the descriptor of the image that best matches the platform, following the os.version rules of Windows hosts.
+	BestMatch(platform Platform) (v1.Descriptor, error)
+	// PendingChanges returns the changes made to the index since it was created or last saved, in the order they were made.
+	PendingChanges() []IndexChange
+	// ResetPendingChanges discards the changes made to the index since it was created or last saved.
+	ResetPendingChanges()
 
 	Push(ops ...IndexOption) error
 	SaveDir() error
 	DeleteDir() error
 }
+
+// IndexOperation identifies the kind of change made to an image index.
+type IndexOperation string
+
+const (
+	AddManifestOperation     IndexOperation = "add-manifest"
+	RemoveManifestOperation  IndexOperation = "remove-manifest"
+	SetAnnotationsOperation  IndexOperation = "set-annotations"
+	SetArchitectureOperation IndexOperation = "set-architecture"
+	SetOSOperation           IndexOperation = "set-os"
+	SetVariantOperation      IndexOperation = "set-variant"
+	SetPlatformOperation     IndexOperation = "set-platform"
+	SetArtifactTypeOperation IndexOperation = "set-artifact-type"
+	SetSubjectOperation      IndexOperation = "set-subject"
+	ConvertToOCIOperation    IndexOperation = "convert-to-oci"
+	SetMediaTypeOperation    IndexOperation = "set-media-type"
+)
+
+// IndexChange is a change made to an image index that has not been saved yet.
+type IndexChange struct {
+	Operation IndexOperation
+	// Digest is the digest of the manifest that was changed, or of the subject set by SetSubject.
+	Digest v1.Hash
+	// Annotations are the annotations added by SetAnnotations.
+	Annotations map[string]string `json:",omitempty"`
+	// Value is the architecture, os, variant or artifact type set by the corresponding setter,
+	// or the media type the index was converted to.
+	Value string `json:",omitempty"`
+	// Platform is the platform set by SetPlatform.
+	Platform *Platform `json:",omitempty"`
+}
+
+// ErrManifestNotFound is returned when an index has no manifest with the requested digest.
+type ErrManifestNotFound struct {
+	Digest string
+}
+
+func (e ErrManifestNotFound) Error() string {
+	return fmt.Sprintf("failed to find image with digest %s in index", e.Digest)
+}
+
+// ErrIndexModified is returned by SaveDir when the index in the store was saved by another writer
+// since the index being saved was loaded, so that saving it would lose their changes.
+type ErrIndexModified struct {
+	Path string
+}
+
+func (e ErrIndexModified) Error() string {
+	return fmt.Sprintf("index at %s was modified by another writer since it was loaded; load it again and reapply the changes", e.Path)
+}
+
+// ErrPlatformNotFound is returned by BestMatch and ImageFromIndex when an index has no image for the requested platform.
+type ErrPlatformNotFound struct {
+	Platform Platform
+}
+
+func (e ErrPlatformNotFound) Error() string {
+	return fmt.Sprintf("failed to find image matching platform %s in index", e.Platform)
+}
+
+// ErrPlatformsNotFound is returned when an index has no manifest for any of the platforms it is filtered by, e.g. with WithPlatforms.
+type ErrPlatformsNotFound struct {
+	Platforms []v1.Platform
+}
+
+func (e ErrPlatformsNotFound) Error() string {
+	return fmt.Sprintf("failed to find manifests for platforms %v in index", e.Platforms)
+}
+
+// ErrUnsupportedMediaType is returned when an index or image has, or is given, a media type that is not supported for it.
+type ErrUnsupportedMediaType struct {
+	MediaType types.MediaType
+}
+
+func (e ErrUnsupportedMediaType) Error() string {
+	return fmt.Sprintf("unsupported media type encountered in image: '%s'", e.MediaType)
+}
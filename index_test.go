@@ -0,0 +1,277 @@
+package imgutil_test
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestIndexErrors(t *testing.T) {
+	spec.Run(t, "IndexErrors", testIndexErrors, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testIndexErrors(t *testing.T, when spec.G, it spec.S) {
+	var index *imgutil.CNBIndex
+
+	it.Before(func() {
+		var err error
+		index, err = imgutil.NewCNBIndex("some/index", imgutil.IndexOptions{BaseIndex: empty.Index})
+		h.AssertNil(t, err)
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		index.AddManifest(image)
+	})
+
+	it("returns an ErrManifestNotFound for a digest that is not in the index", func() {
+		missing, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		hash, err := missing.Digest()
+		h.AssertNil(t, err)
+
+		_, err = index.Image(hash)
+		var notFound imgutil.ErrManifestNotFound
+		h.AssertEq(t, errors.As(err, &notFound), true)
+		h.AssertEq(t, notFound.Digest, hash.String())
+
+		digest, err := name.NewDigest("some/index@" + hash.String())
+		h.AssertNil(t, err)
+		_, err = index.Annotations(digest)
+		h.AssertEq(t, errors.As(err, &notFound), true)
+	})
+
+	it("returns an ErrPlatformsNotFound when no manifest matches the platforms to push", func() {
+		err := index.Push(imgutil.WithPlatforms([]v1.Platform{{OS: "plan9", Architecture: "amd64"}}, true))
+		var notFound imgutil.ErrPlatformsNotFound
+		h.AssertEq(t, errors.As(err, &notFound), true)
+		h.AssertEq(t, notFound.Platforms, []v1.Platform{{OS: "plan9", Architecture: "amd64"}})
+	})
+
+	it("returns an ErrUnsupportedMediaType for a media type that is not an index", func() {
+		err := index.Push(imgutil.WithMediaType(types.OCIManifestSchema1))
+		var unknown imgutil.ErrUnsupportedMediaType
+		h.AssertEq(t, errors.As(err, &unknown), true)
+		h.AssertEq(t, unknown.MediaType, types.OCIManifestSchema1)
+	})
+
+	it("returns an ErrUnsupportedMediaType from the ErrUnknownMediaType constructor", func() {
+		err := imgutil.ErrUnknownMediaType(types.OCIManifestSchema1) //nolint:staticcheck // kept for compatibility
+		h.AssertError(t, err, "unsupported media type encountered in image: 'application/vnd.oci.image.manifest.v1+json'")
+		var unknown imgutil.ErrUnsupportedMediaType
+		h.AssertEq(t, errors.As(err, &unknown), true)
+	})
+}
+
+func TestNewIndexFromImages(t *testing.T) {
+	spec.Run(t, "NewIndexFromImages", testNewIndexFromImages, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testNewIndexFromImages(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "index-from-images-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	newImage := func(platform imgutil.Platform) imgutil.Image {
+		image, err := layout.NewImage(filepath.Join(tmpDir, platform.Architecture), layout.WithDefaultPlatform(platform))
+		h.AssertNil(t, err)
+		return image
+	}
+
+	it("adds the images with the platforms of their configs", func() {
+		amd64 := newImage(imgutil.Platform{OS: "linux", Architecture: "amd64"})
+		arm64 := newImage(imgutil.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})
+
+		index, err := imgutil.NewIndexFromImages("some/index", []imgutil.Image{amd64, arm64})
+		h.AssertNil(t, err)
+
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(indexManifest.Manifests), 2)
+		for idx, image := range []imgutil.Image{amd64, arm64} {
+			digest, err := image.UnderlyingImage().Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, indexManifest.Manifests[idx].Digest, digest)
+		}
+		h.AssertEq(t, indexManifest.Manifests[0].Platform, &v1.Platform{OS: "linux", Architecture: "amd64"})
+		h.AssertEq(t, indexManifest.Manifests[1].Platform, &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})
+	})
+
+	it("fails for an image without a platform", func() {
+		image := newImage(imgutil.Platform{})
+		h.AssertNil(t, image.SetOS(""))
+		h.AssertNil(t, image.SetArchitecture(""))
+
+		_, err := imgutil.NewIndexFromImages("some/index", []imgutil.Image{image})
+		h.AssertError(t, err, "its config has no os and architecture")
+	})
+}
+
+func TestIndexSubject(t *testing.T) {
+	spec.Run(t, "IndexSubject", testIndexSubject, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testIndexSubject(t *testing.T, when spec.G, it spec.S) {
+	const artifactType = "application/vnd.example.attestations"
+
+	var (
+		tmpDir  string
+		subject v1.Descriptor
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "index-subject-test")
+		h.AssertNil(t, err)
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		desc, err := partial.Descriptor(image)
+		h.AssertNil(t, err)
+		subject = *desc
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("saves the subject and artifactType to the index manifest", func() {
+		index, err := layout.NewIndex("some/attestations", imgutil.WithXDGRuntimePath(tmpDir))
+		h.AssertNil(t, err)
+		h.AssertNil(t, index.SetSubject(subject))
+		h.AssertNil(t, index.SetArtifactType(artifactType))
+		h.AssertEq(t, len(index.PendingChanges()), 2)
+		h.AssertNil(t, index.SaveDir())
+
+		raw, err := os.ReadFile(filepath.Join(tmpDir, imgutil.MakeFileSafeName("some/attestations"), "index.json"))
+		h.AssertNil(t, err)
+		var saved struct {
+			ArtifactType string         `json:"artifactType"`
+			Subject      *v1.Descriptor `json:"subject"`
+		}
+		h.AssertNil(t, json.Unmarshal(raw, &saved))
+		h.AssertEq(t, saved.ArtifactType, artifactType)
+		h.AssertEq(t, saved.Subject.Digest, subject.Digest)
+
+		reloaded, err := layout.NewIndex("other/attestations", imgutil.FromBaseIndex(filepath.Join(tmpDir, imgutil.MakeFileSafeName("some/attestations"))))
+		h.AssertNil(t, err)
+		h.AssertEq(t, reloaded.ArtifactType(), artifactType)
+		reloadedSubject, err := reloaded.Subject()
+		h.AssertNil(t, err)
+		h.AssertEq(t, reloadedSubject.Digest, subject.Digest)
+	})
+
+	it("does not take the digest of the index from its subject", func() {
+		index, err := imgutil.NewCNBIndex("some/attestations", imgutil.IndexOptions{BaseIndex: empty.Index})
+		h.AssertNil(t, err)
+		h.AssertNil(t, index.SetSubject(subject))
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+
+		taggable := imgutil.NewTaggableIndex(indexManifest)
+		taggable.ArtifactType = artifactType
+		digest, err := taggable.Digest()
+		h.AssertNil(t, err)
+		h.AssertNotEq(t, digest, subject.Digest)
+		raw, err := taggable.RawManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, digest.Hex, fmt.Sprintf("%x", sha256.Sum256(raw)))
+	})
+
+	it("restores the artifactType and subject when pending changes are reset", func() {
+		index, err := imgutil.NewCNBIndex("some/attestations", imgutil.IndexOptions{BaseIndex: empty.Index})
+		h.AssertNil(t, err)
+		h.AssertNil(t, index.SetSubject(subject))
+		h.AssertNil(t, index.SetArtifactType(artifactType))
+
+		index.ResetPendingChanges()
+		h.AssertEq(t, index.ArtifactType(), "")
+		reset, err := index.Subject()
+		h.AssertNil(t, err)
+		h.AssertEq(t, reset == nil, true)
+	})
+
+	it("fails for a docker manifest list", func() {
+		index, err := imgutil.NewCNBIndex("some/attestations", imgutil.IndexOptions{MediaType: types.DockerManifestList})
+		h.AssertNil(t, err)
+		h.AssertError(t, index.SetSubject(subject), "only OCI indexes have one")
+		h.AssertError(t, index.SetArtifactType(artifactType), "only OCI indexes have one")
+	})
+}
+
+func TestIndexConvertToOCI(t *testing.T) {
+	spec.Run(t, "IndexConvertToOCI", testIndexConvertToOCI, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testIndexConvertToOCI(t *testing.T, when spec.G, it spec.S) {
+	var (
+		index  *imgutil.CNBIndex
+		digest name.Digest
+	)
+
+	it.Before(func() {
+		var err error
+		index, err = imgutil.NewCNBIndex("some/index", imgutil.IndexOptions{MediaType: types.DockerManifestList})
+		h.AssertNil(t, err)
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		index.AddManifest(image)
+		hash, err := image.Digest()
+		h.AssertNil(t, err)
+		digest, err = name.NewDigest("some/index@" + hash.String())
+		h.AssertNil(t, err)
+		h.AssertNil(t, index.SetAnnotations(digest, map[string]string{"some-key": "some-value"}))
+	})
+
+	it("converts a docker manifest list to an OCI index with its annotations", func() {
+		h.AssertNil(t, index.ConvertToOCI())
+
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, indexManifest.MediaType, types.OCIImageIndex)
+		annotations, err := index.Annotations(digest)
+		h.AssertNil(t, err)
+		h.AssertEq(t, annotations, map[string]string{"some-key": "some-value"})
+		changes := index.PendingChanges()
+		h.AssertEq(t, changes[len(changes)-1].Operation, imgutil.ConvertToOCIOperation)
+	})
+
+	it("keeps the media type of the index when its manifests are changed", func() {
+		h.AssertNil(t, index.ConvertToOCI())
+		h.AssertNil(t, index.SetOS(digest, "linux"))
+
+		mediaType, err := index.MediaType()
+		h.AssertNil(t, err)
+		h.AssertEq(t, mediaType, types.OCIImageIndex)
+	})
+
+	it("leaves an OCI index as it is", func() {
+		h.AssertNil(t, index.ConvertToOCI())
+		changes := len(index.PendingChanges())
+
+		h.AssertNil(t, index.ConvertToOCI())
+		h.AssertEq(t, len(index.PendingChanges()), changes)
+	})
+}
@@ -0,0 +1,90 @@
+package imgutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ImageInspection is the document returned, as JSON, by Image.Inspect.
+type ImageInspection struct {
+	Digest    string          `json:"digest"`
+	MediaType types.MediaType `json:"mediaType"`
+	Platform  *v1.Platform    `json:"platform,omitempty"`
+	Manifest  *v1.Manifest    `json:"manifest"`
+	Config    *v1.ConfigFile  `json:"config"`
+	History   []v1.History    `json:"history"`
+}
+
+// Inspect returns the digest, media type, platform, manifest, config and history of the image as an indented JSON
+// ImageInspection, as ImageIndex.Inspect does for indexes.
+func (i *CNBImageCore) Inspect() (string, error) {
+	inspection, err := InspectImage(i.Image)
+	if err != nil {
+		return "", err
+	}
+	out, err := json.MarshalIndent(inspection, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// InspectImage returns the ImageInspection of the image.
+func InspectImage(image v1.Image) (ImageInspection, error) {
+	digest, err := image.Digest()
+	if err != nil {
+		return ImageInspection{}, err
+	}
+	mediaType, err := image.MediaType()
+	if err != nil {
+		return ImageInspection{}, err
+	}
+	manifest, err := getManifest(image)
+	if err != nil {
+		return ImageInspection{}, err
+	}
+	configFile, err := getConfigFile(image)
+	if err != nil {
+		return ImageInspection{}, err
+	}
+	return ImageInspection{
+		Digest:    digest.String(),
+		MediaType: mediaType,
+		Platform:  configFile.Platform(),
+		Manifest:  manifest,
+		Config:    configFile,
+		History:   configFile.History,
+	}, nil
+}
+
+// InspectFormat is the format of the output of ImageIndex.Inspect.
+type InspectFormat string
+
+const (
+	// InspectRaw is the index manifest as stored, in JSON.
+	InspectRaw InspectFormat = "raw"
+	// InspectTable is a table with a row per manifest, with its platform, digest, media type and size.
+	InspectTable InspectFormat = "table"
+)
+
+// writeIndexTable writes the manifests of the index as a table, listing attestations, which have no runnable platform, as such.
+func writeIndexTable(w io.Writer, indexManifest *v1.IndexManifest) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "PLATFORM\tDIGEST\tMEDIA TYPE\tSIZE")
+	for _, desc := range indexManifest.Manifests {
+		platform := "-"
+		switch {
+		case isAttestation(desc):
+			platform = "attestation"
+		case desc.Platform != nil:
+			platform = desc.Platform.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", platform, desc.Digest, desc.MediaType, desc.Size)
+	}
+	return tw.Flush()
+}
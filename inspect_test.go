@@ -0,0 +1,72 @@
+package imgutil_test
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestIndexInspect(t *testing.T) {
+	spec.Run(t, "IndexInspect", testIndexInspect, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testIndexInspect(t *testing.T, when spec.G, it spec.S) {
+	var (
+		index  *imgutil.CNBIndex
+		digest v1.Hash
+	)
+
+	it.Before(func() {
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		image, err = mutate.ConfigFile(image, &v1.ConfigFile{OS: "linux", Architecture: "arm64", Variant: "v8"})
+		h.AssertNil(t, err)
+		digest, err = image.Digest()
+		h.AssertNil(t, err)
+		index, err = imgutil.NewCNBIndex("some/index", imgutil.IndexOptions{BaseIndex: empty.Index})
+		h.AssertNil(t, err)
+		index.AddManifest(image)
+	})
+
+	it("returns the raw index manifest by default", func() {
+		out, err := index.Inspect()
+		h.AssertNil(t, err)
+		rawManifest, err := index.RawManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, out, string(rawManifest))
+	})
+
+	it("returns a table with a row per manifest", func() {
+		out, err := index.Inspect(imgutil.WithInspectFormat(imgutil.InspectTable))
+		h.AssertNil(t, err)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		h.AssertEq(t, len(lines), 2)
+		h.AssertEq(t, strings.Fields(lines[0]), []string{"PLATFORM", "DIGEST", "MEDIA", "TYPE", "SIZE"})
+		h.AssertEq(t, strings.Fields(lines[1])[:2], []string{"linux/arm64/v8", digest.String()})
+	})
+
+	it("renders the index manifest with a template", func() {
+		out, err := index.Inspect(imgutil.WithInspectTemplate(`{{range .Manifests}}{{.Platform.Architecture}} {{.Digest}}{{end}}`))
+		h.AssertNil(t, err)
+		h.AssertEq(t, out, "arm64 "+digest.String())
+	})
+
+	it("fails with an invalid template", func() {
+		_, err := index.Inspect(imgutil.WithInspectTemplate(`{{range .Manifests}}`))
+		h.AssertError(t, err, "parsing inspect template")
+	})
+
+	it("fails with an unknown format", func() {
+		_, err := index.Inspect(imgutil.WithInspectFormat("yaml"))
+		h.AssertError(t, err, "unsupported inspect format 'yaml'")
+	})
+}
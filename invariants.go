@@ -0,0 +1,60 @@
+package imgutil
+
+import (
+	"fmt"
+)
+
+// ErrInvariantViolation is returned, when strict invariants are enabled with WithStrictInvariants,
+// by the mutation that left the working image inconsistent.
+type ErrInvariantViolation struct {
+	Operation string
+	Reason    string
+}
+
+func (e ErrInvariantViolation) Error() string {
+	return fmt.Sprintf("image invariant violated by %s: %s", e.Operation, e.Reason)
+}
+
+// checkInvariants verifies, if strict invariants are enabled, that the manifest layers, the config diff IDs
+// and the config history of the working image describe the same layers, in the same order.
+// The operation is the name of the mutation that was just made, to report where an inconsistency was introduced.
+func (i *CNBImageCore) checkInvariants(operation string) error {
+	if !i.strictInvariants {
+		return nil
+	}
+	manifest, err := getManifest(i.Image)
+	if err != nil {
+		return err
+	}
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return err
+	}
+	violation := func(format string, args ...interface{}) error {
+		return ErrInvariantViolation{Operation: operation, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if len(manifest.Layers) != len(configFile.RootFS.DiffIDs) {
+		return violation("manifest has %d layers; config has %d diff IDs", len(manifest.Layers), len(configFile.RootFS.DiffIDs))
+	}
+	if len(configFile.History) > 0 {
+		var nonEmpty int
+		for _, h := range configFile.History {
+			if !h.EmptyLayer {
+				nonEmpty++
+			}
+		}
+		if nonEmpty != len(configFile.RootFS.DiffIDs) {
+			return violation("config history has %d entries for non-empty layers; config has %d diff IDs", nonEmpty, len(configFile.RootFS.DiffIDs))
+		}
+	}
+	for idx, desc := range manifest.Layers {
+		if desc.Digest.Hex == "" {
+			return violation("manifest layer %d has no digest", idx)
+		}
+		if configFile.RootFS.DiffIDs[idx].Hex == "" {
+			return violation("config diff ID %d is empty", idx)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package imgutil_test
+
+import (
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestInvariants(t *testing.T) {
+	spec.Run(t, "Invariants", testInvariants, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testInvariants(t *testing.T, when spec.G, it spec.S) {
+	newImage := func(ops ...imgutil.ImageOption) *imgutil.CNBImageCore {
+		options := imgutil.ImageOptions{}
+		for _, op := range ops {
+			op(&options)
+		}
+		image, err := imgutil.NewCNBImage(options)
+		h.AssertNil(t, err)
+		for idx := 0; idx < 2; idx++ {
+			layer, err := random.Layer(100, types.OCILayer)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{CreatedBy: "some-layer"}))
+		}
+		return image
+	}
+
+	when("strict invariants are enabled", func() {
+		it("allows consistent mutations", func() {
+			image := newImage(imgutil.WithStrictInvariants())
+			h.AssertNil(t, image.SetLabel("some-key", "some-value"))
+			h.AssertNil(t, image.SquashLayers(""))
+			h.AssertNil(t, image.SetHistory([]v1.History{{CreatedBy: "squashed"}}))
+		})
+
+		it("fails the mutation that leaves the history out of step with the layers", func() {
+			image := newImage(imgutil.WithStrictInvariants())
+			err := image.SetHistory([]v1.History{{CreatedBy: "only-one"}})
+			var violation imgutil.ErrInvariantViolation
+			h.AssertEq(t, errors.As(err, &violation), true)
+			h.AssertEq(t, violation.Operation, "MutateConfigFile")
+			h.AssertError(t, err, "config history has 1 entries for non-empty layers; config has 2 diff IDs")
+		})
+
+		it("fails the mutation that leaves the diff IDs out of step with the manifest layers", func() {
+			image := newImage(imgutil.WithStrictInvariants())
+			err := image.MutateConfigFile(func(c *v1.ConfigFile) {
+				c.RootFS.DiffIDs = c.RootFS.DiffIDs[:1]
+				c.History = c.History[:1]
+			})
+			h.AssertError(t, err, "manifest has 2 layers; config has 1 diff IDs")
+		})
+	})
+
+	when("strict invariants are not enabled", func() {
+		it("does not check mutations", func() {
+			image := newImage()
+			h.AssertNil(t, image.SetHistory([]v1.History{{CreatedBy: "only-one"}}))
+		})
+	})
+}
@@ -0,0 +1,47 @@
+package layout
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// CheckAccess verifies that the image can be read from and/or written to the layout at path.
+// Read access is probed by opening the layout index, if the layout exists; write access by creating a file
+// in the layout directory, or in its closest existing parent if the layout does not exist yet.
+// It returns an imgutil.ErrAccessDenied if the file system refuses the access.
+func CheckAccess(path string, scope imgutil.AccessScope) error {
+	if scope&imgutil.PullAccess != 0 {
+		f, err := os.Open(filepath.Join(path, "index.json"))
+		if err == nil {
+			f.Close()
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return accessError(path, imgutil.PullAccess, err)
+		}
+	}
+	if scope&imgutil.PushAccess != 0 {
+		dir := path
+		for {
+			if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+		f, err := os.CreateTemp(dir, ".imgutil-access-check-*")
+		if err != nil {
+			return accessError(path, imgutil.PushAccess, err)
+		}
+		f.Close()
+		return os.Remove(f.Name())
+	}
+	return nil
+}
+
+func accessError(path string, scope imgutil.AccessScope, err error) error {
+	if errors.Is(err, os.ErrPermission) {
+		return imgutil.ErrAccessDenied{Ref: path, Scope: scope, Cause: err}
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+package layout_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestCapabilityReport(t *testing.T) {
+	spec.Run(t, "CapabilityReport", testCapabilityReport, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testCapabilityReport(t *testing.T, when spec.G, it spec.S) {
+	when("#NewImage", func() {
+		it("reports the options that are ignored for layout images", func() {
+			image, err := layout.NewImage(filepath.Join(t.TempDir(), "some-image"), remote.WithSBOMsAsReferrers())
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(image.CapabilityReport().Warnings), 1)
+			h.AssertEq(t, image.CapabilityReport().Warnings[0].Option, "SBOMsAsReferrers")
+		})
+
+		it("fails in strict mode", func() {
+			_, err := layout.NewImage(filepath.Join(t.TempDir(), "some-image"),
+				layout.WithCompression(imgutil.Zstd),
+				layout.WithMediaTypes(imgutil.DockerTypes),
+				imgutil.WithStrictCapabilities(),
+			)
+			h.AssertEq(t, errors.As(err, &imgutil.ErrCapabilityWarnings{}), true)
+		})
+	})
+}
@@ -0,0 +1,28 @@
+package layout
+
+import (
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/buildpacks/imgutil"
+)
+
+var _ imgutil.ExtractDestination = (*ExtractDestination)(nil)
+
+// ExtractDestination writes an extracted image to an OCI layout directory, preserving its digest.
+type ExtractDestination struct {
+	path string
+}
+
+// NewExtractDestination returns an imgutil.ExtractDestination that saves the image at the given layout path,
+// replacing any image or index already stored there.
+func NewExtractDestination(path string) *ExtractDestination {
+	return &ExtractDestination{path: path}
+}
+
+func (d *ExtractDestination) WriteImage(image v1.Image) error {
+	layoutPath, err := initEmptyIndexAt(d.path)
+	if err != nil {
+		return err
+	}
+	return layoutPath.AppendImage(image)
+}
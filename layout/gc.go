@@ -0,0 +1,131 @@
+package layout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// GCReport describes the blobs removed from a layout directory by GC.
+type GCReport struct {
+	Path string
+	// Removed are the blobs that were not referenced by the layout, which were removed.
+	Removed []string
+	// ReclaimedBytes is the total size of the removed blobs.
+	ReclaimedBytes int64
+}
+
+// GC removes the blobs of the layout at the given path that are not referenced by `index.json`,
+// directly or through the indexes and image manifests it references, e.g., the layers of images that were replaced.
+// Temporary files left by writes are not removed, see RepairLayout.
+// As the blobs of an image are written before it is added to `index.json`, GC holds the layout lock,
+// waiting for writers that save with the layout package to finish; see imgutil.LockDir.
+func GC(path string) (GCReport, error) {
+	report := GCReport{Path: path}
+	unlock, err := imgutil.LockDir(path, 0)
+	if err != nil {
+		return report, err
+	}
+	defer unlock()
+
+	index, err := readDescriptorIndex(filepath.Join(path, "index.json"))
+	if err != nil {
+		return report, fmt.Errorf("failed to read index: %w", err)
+	}
+	referenced := map[v1.Hash]bool{}
+	for _, desc := range index.Manifests {
+		if err = markReferenced(path, desc, referenced); err != nil {
+			return report, err
+		}
+	}
+
+	blobsDir := filepath.Join(path, "blobs")
+	algorithms, err := os.ReadDir(blobsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return report, nil
+		}
+		return report, err
+	}
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+		blobs, err := os.ReadDir(filepath.Join(blobsDir, algorithm.Name()))
+		if err != nil {
+			return report, err
+		}
+		for _, blob := range blobs {
+			hash, err := v1.NewHash(algorithm.Name() + ":" + blob.Name())
+			if err != nil || referenced[hash] || blob.IsDir() {
+				continue
+			}
+			info, err := blob.Info()
+			if err != nil {
+				return report, err
+			}
+			file := filepath.Join(blobsDir, algorithm.Name(), blob.Name())
+			if err = os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return report, err
+			}
+			report.Removed = append(report.Removed, file)
+			report.ReclaimedBytes += info.Size()
+		}
+	}
+	sort.Strings(report.Removed)
+	return report, nil
+}
+
+// markReferenced records the blob for the descriptor as referenced,
+// and recurses into the manifests referenced by indexes and the config, layers and subject referenced by image manifests.
+// Missing blobs are allowed, as sparse images do not contain layer blobs.
+func markReferenced(path string, desc v1.Descriptor, referenced map[v1.Hash]bool) error {
+	if referenced[desc.Digest] {
+		return nil
+	}
+	referenced[desc.Digest] = true
+	if !desc.MediaType.IsIndex() && !desc.MediaType.IsImage() {
+		return nil
+	}
+
+	contents, err := os.ReadFile(filepath.Join(path, "blobs", desc.Digest.Algorithm, desc.Digest.Hex))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var children []v1.Descriptor
+	if desc.MediaType.IsIndex() {
+		var index v1.IndexManifest
+		if err = json.Unmarshal(contents, &index); err != nil {
+			return fmt.Errorf("failed to parse index %s: %w", desc.Digest, err)
+		}
+		children = index.Manifests
+		if index.Subject != nil {
+			children = append(children, *index.Subject)
+		}
+	} else {
+		var manifest v1.Manifest
+		if err = json.Unmarshal(contents, &manifest); err != nil {
+			return fmt.Errorf("failed to parse manifest %s: %w", desc.Digest, err)
+		}
+		children = append([]v1.Descriptor{manifest.Config}, manifest.Layers...)
+		if manifest.Subject != nil {
+			children = append(children, *manifest.Subject)
+		}
+	}
+	for _, child := range children {
+		if err = markReferenced(path, child, referenced); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package layout_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	ggcrlayout "github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/match"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestGC(t *testing.T) {
+	spec.Run(t, "GC", testGC, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testGC(t *testing.T, when spec.G, it spec.S) {
+	var (
+		layoutDir  string
+		layoutPath ggcrlayout.Path
+		err        error
+	)
+
+	it.Before(func() {
+		layoutDir, err = os.MkdirTemp("", "layout-gc-test")
+		h.AssertNil(t, err)
+		layoutPath, err = ggcrlayout.Write(layoutDir, empty.Index)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(layoutDir))
+	})
+
+	blobsOf := func(image v1.Image) []string {
+		var digests []v1.Hash
+		layers, err := image.Layers()
+		h.AssertNil(t, err)
+		for _, layer := range layers {
+			digest, err := layer.Digest()
+			h.AssertNil(t, err)
+			digests = append(digests, digest)
+		}
+		configName, err := image.ConfigName()
+		h.AssertNil(t, err)
+		digest, err := image.Digest()
+		h.AssertNil(t, err)
+		var blobs []string
+		for _, d := range append(digests, configName, digest) {
+			blobs = append(blobs, filepath.Join(layoutDir, "blobs", d.Algorithm, d.Hex))
+		}
+		return blobs
+	}
+
+	it("removes the blobs of images that are no longer referenced", func() {
+		removed, err := random.Image(1024, 2)
+		h.AssertNil(t, err)
+		kept, err := random.Image(1024, 2)
+		h.AssertNil(t, err)
+		h.AssertNil(t, layoutPath.AppendImage(removed))
+		h.AssertNil(t, layoutPath.AppendImage(kept))
+		removedDigest, err := removed.Digest()
+		h.AssertNil(t, err)
+		h.AssertNil(t, layoutPath.RemoveDescriptors(match.Digests(removedDigest)))
+		tempFile := filepath.Join(layoutDir, "blobs", "sha256", "some-temp-file")
+		h.AssertNil(t, os.WriteFile(tempFile, []byte("partial"), 0600))
+
+		report, err := layout.GC(layoutDir)
+		h.AssertNil(t, err)
+
+		h.AssertEq(t, len(report.Removed), 4)
+		for _, blob := range blobsOf(removed) {
+			_, err = os.Stat(blob)
+			h.AssertEq(t, os.IsNotExist(err), true)
+		}
+		h.AssertEq(t, report.ReclaimedBytes > 2048, true)
+		_, err = os.Stat(tempFile)
+		h.AssertNil(t, err)
+
+		keptDigest, err := kept.Digest()
+		h.AssertNil(t, err)
+		image, err := layoutPath.Image(keptDigest)
+		h.AssertNil(t, err)
+		h.AssertNil(t, validate.Image(image))
+	})
+
+	it("keeps the blobs of images in nested indexes", func() {
+		nested, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		h.AssertNil(t, layoutPath.AppendIndex(mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: nested})))
+
+		report, err := layout.GC(layoutDir)
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(report.Removed), 0)
+		for _, blob := range blobsOf(nested) {
+			_, err = os.Stat(blob)
+			h.AssertNil(t, err)
+		}
+	})
+
+	it("fails for a directory that is not a layout", func() {
+		_, err := layout.GC(t.TempDir())
+		h.AssertError(t, err, "failed to read index")
+	})
+}
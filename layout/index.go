@@ -22,6 +22,7 @@ func NewIndex(repoName string, ops ...imgutil.IndexOption) (*imgutil.CNBIndex, e
 	if options.BaseIndex == nil && options.BaseIndexRepoName != "" { // options.BaseIndex supersedes options.BaseIndexRepoName
 		options.BaseIndex, err = newV1Index(
 			options.BaseIndexRepoName,
+			options.LayoutIndexOptions,
 		)
 		if err != nil {
 			return nil, err
@@ -32,10 +33,27 @@ func NewIndex(repoName string, ops ...imgutil.IndexOption) (*imgutil.CNBIndex, e
 }
 
 // newV1Index creates a layout image index from the given path.
-func newV1Index(path string) (v1.ImageIndex, error) {
+// The layout is locked while index.json is read, so that a concurrent writer is not observed mid-save:
+// the lock is shared with other readers, unless the layout is repaired first.
+func newV1Index(path string, options imgutil.LayoutIndexOptions) (v1.ImageIndex, error) {
 	if !imageExists(path) {
 		return nil, nil
 	}
+	lock := imgutil.RLockDir
+	if options.Repair {
+		lock = imgutil.LockDir
+	}
+	unlock, err := lock(path, options.LockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if options.Repair {
+		if _, err = repairLayout(path); err != nil {
+			return nil, err
+		}
+	}
 	layoutPath, err := FromPath(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load layout from path: %w", err)
@@ -309,6 +309,31 @@ func testIndex(t *testing.T, when spec.G, it spec.S) {
 					h.AssertEq(t, index.Manifests[0].Platform.Variant, "v6")
 				})
 
+				it("platform is written on disk with SetPlatform", func() {
+					h.AssertNil(t, idx.SetPlatform(digest1, imgutil.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1040"}))
+					h.AssertEq(t, idx.PendingChanges()[0].Operation, imgutil.SetPlatformOperation)
+					h.AssertNil(t, idx.SaveDir())
+
+					index := h.ReadIndexManifest(t, localPath)
+					h.AssertEq(t, len(index.Manifests), 1)
+					h.AssertEq(t, index.Manifests[0].Platform.OS, "windows")
+					h.AssertEq(t, index.Manifests[0].Platform.Architecture, "amd64")
+					h.AssertEq(t, index.Manifests[0].Platform.OSVersion, "10.0.17763.1040")
+				})
+
+				it("changing the values returned by getters does not change the index", func() {
+					h.AssertNil(t, idx.SetAnnotations(digest1, map[string]string{"some-key": "some-value"}))
+					h.AssertNil(t, idx.SetPlatform(digest1, imgutil.Platform{OS: "linux", Architecture: "amd64"}))
+
+					annotations, err := idx.Annotations(digest1)
+					h.AssertNil(t, err)
+					annotations["some-key"] = "other-value"
+
+					annotations, err = idx.Annotations(digest1)
+					h.AssertNil(t, err)
+					h.AssertEq(t, annotations["some-key"], "some-value")
+				})
+
 				it("annotations are written on disk", func() {
 					annotations := map[string]string{
 						"some-key": "some-value",
@@ -593,6 +618,34 @@ func testIndex(t *testing.T, when spec.G, it spec.S) {
 					h.AssertPathDoesNotExists(t, path.Join(tmpDir, imgutil.MakeFileSafeName(repoName)))
 				})
 			})
+
+			when("#WithPlatforms", func() {
+				var arm64 = []v1.Platform{{OS: "linux", Architecture: "arm64"}}
+
+				it("index is pushed to the registry with only the requested platforms", func() {
+					err = idx.Push(imgutil.WithPlatforms(arm64, false))
+					h.AssertNil(t, err)
+					h.AssertRemoteImageIndex(t, repoName, types.OCIImageIndex, 1)
+
+					index := h.ReadIndexManifest(t, path.Join(tmpDir, imgutil.MakeFileSafeName(repoName)))
+					h.AssertEq(t, len(index.Manifests), 1)
+					h.AssertEq(t, index.Manifests[0].Platform.Architecture, "arm64")
+				})
+
+				it("other platforms are kept in local storage if requested", func() {
+					err = idx.Push(imgutil.WithPlatforms(arm64, true))
+					h.AssertNil(t, err)
+					h.AssertRemoteImageIndex(t, repoName, types.OCIImageIndex, 1)
+
+					index := h.ReadIndexManifest(t, path.Join(tmpDir, imgutil.MakeFileSafeName(repoName)))
+					h.AssertEq(t, len(index.Manifests), expectedNumberOfManifests)
+				})
+
+				it("error when no manifest matches the requested platforms", func() {
+					err = idx.Push(imgutil.WithPlatforms([]v1.Platform{{OS: "windows"}}, false))
+					h.AssertError(t, err, "failed to find manifests for platforms")
+				})
+			})
 		})
 	})
 
@@ -651,6 +704,173 @@ func testIndex(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#Found", func() {
+		it("returns true when the index is saved on disk", func() {
+			idx = setupIndex(t, "busybox-multi-platform", imgutil.WithXDGRuntimePath(tmpDir), imgutil.FromBaseIndex(baseIndexPath))
+			h.AssertEq(t, idx.Found(), true)
+
+			h.AssertNil(t, idx.DeleteDir())
+			h.AssertEq(t, idx.Found(), false)
+		})
+
+		it("returns false when the index was not saved", func() {
+			idx, err = layout.NewIndex(newRepoName(), imgutil.WithXDGRuntimePath(tmpDir))
+			h.AssertNil(t, err)
+			h.AssertEq(t, idx.Found(), false)
+		})
+	})
+
+	when("#Valid", func() {
+		it("returns true for a well-formed index", func() {
+			idx = setupIndex(t, "busybox-multi-platform", imgutil.WithXDGRuntimePath(tmpDir), imgutil.FromBaseIndex(baseIndexPath))
+			h.AssertEq(t, idx.Valid(), true)
+		})
+
+		it("returns false when a manifest has an incomplete platform", func() {
+			idx = setupIndex(t, "busybox-multi-platform", imgutil.WithXDGRuntimePath(tmpDir), imgutil.FromBaseIndex(baseIndexPath))
+			digest, err := name.NewDigest("busybox@sha256:f5b920213fc6498c0c5eaee7e04f8424202b565bb9e5e4de9e617719fb7bd873")
+			h.AssertNil(t, err)
+			h.AssertNil(t, idx.SetArchitecture(digest, ""))
+			h.AssertEq(t, idx.Valid(), false)
+		})
+	})
+
+	when("#AddAttestation", func() {
+		var (
+			subject     name.Digest
+			attestation v1.Image
+		)
+
+		it.Before(func() {
+			idx = setupIndex(t, "busybox-multi-platform", imgutil.WithXDGRuntimePath(tmpDir), imgutil.FromBaseIndex(baseIndexPath))
+			localPath = filepath.Join(tmpDir, "busybox-multi-platform")
+			subject, err = name.NewDigest("busybox@sha256:f5b920213fc6498c0c5eaee7e04f8424202b565bb9e5e4de9e617719fb7bd873")
+			h.AssertNil(t, err)
+
+			attestation, err = imgutil.NewAttestationImage(imgutil.Attestation{
+				PredicateType: "https://slsa.dev/provenance/v0.2",
+				Contents:      []byte(`{"_type":"https://in-toto.io/Statement/v0.1"}`),
+			})
+			h.AssertNil(t, err)
+		})
+
+		it("adds an attestation manifest linked to the subject", func() {
+			h.AssertNil(t, idx.AddAttestation(subject, attestation))
+			h.AssertNil(t, idx.SaveDir())
+
+			index := h.ReadIndexManifest(t, localPath)
+			h.AssertEq(t, len(index.Manifests), 3)
+			desc := index.Manifests[2]
+			h.AssertEq(t, desc.Platform.OS, "unknown")
+			h.AssertEq(t, desc.Platform.Architecture, "unknown")
+			h.AssertEq(t, desc.Annotations[imgutil.AttestationReferenceTypeAnnotation], imgutil.AttestationManifestType)
+			h.AssertEq(t, desc.Annotations[imgutil.AttestationReferenceDigestAnnotation], subject.DigestStr())
+
+			attestations, err := idx.Attestations(subject)
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(attestations), 1)
+			h.AssertEq(t, attestations[0].Digest, desc.Digest)
+			h.AssertEq(t, idx.Valid(), true)
+		})
+
+		it("removes the attestation manifest with its subject", func() {
+			h.AssertNil(t, idx.AddAttestation(subject, attestation))
+			h.AssertNil(t, idx.RemoveManifest(subject))
+			h.AssertNil(t, idx.SaveDir())
+
+			index := h.ReadIndexManifest(t, localPath)
+			h.AssertEq(t, len(index.Manifests), 1)
+			h.AssertEq(t, index.Manifests[0].Digest.String(), "sha256:e18f2c12bb4ea582045415243370a3d9cf3874265aa2867f21a35e630ebe45a7")
+		})
+
+		it("error when the subject is not in the index", func() {
+			digest, err := name.NewDigest("busybox@sha256:b9d056b83bb6446fee29e89a7fcf10203c562c1f59586a6e2f39c903597bda34")
+			h.AssertNil(t, err)
+			err = idx.AddAttestation(digest, attestation)
+			h.AssertError(t, err, "failed to find image with digest")
+		})
+	})
+
+	when("#PendingChanges", func() {
+		var digest name.Digest
+
+		it.Before(func() {
+			idx = setupIndex(t, "busybox-multi-platform", imgutil.WithXDGRuntimePath(tmpDir), imgutil.FromBaseIndex(baseIndexPath))
+			localPath = filepath.Join(tmpDir, "busybox-multi-platform")
+			digest, err = name.NewDigest("busybox@sha256:f5b920213fc6498c0c5eaee7e04f8424202b565bb9e5e4de9e617719fb7bd873")
+			h.AssertNil(t, err)
+		})
+
+		it("returns the changes made since the index was saved", func() {
+			h.AssertEq(t, len(idx.PendingChanges()), 0)
+
+			h.AssertNil(t, idx.SetAnnotations(digest, map[string]string{"some-key": "some-value"}))
+			h.AssertNil(t, idx.SetOS(digest, "some-os"))
+			h.AssertNil(t, idx.RemoveManifest(digest))
+
+			changes := idx.PendingChanges()
+			h.AssertEq(t, len(changes), 3)
+			h.AssertEq(t, changes[0].Operation, imgutil.SetAnnotationsOperation)
+			h.AssertEq(t, changes[0].Digest.String(), digest.DigestStr())
+			h.AssertEq(t, changes[0].Annotations, map[string]string{"some-key": "some-value"})
+			h.AssertEq(t, changes[1].Operation, imgutil.SetOSOperation)
+			h.AssertEq(t, changes[1].Value, "some-os")
+			h.AssertEq(t, changes[2].Operation, imgutil.RemoveManifestOperation)
+
+			h.AssertNil(t, idx.SaveDir())
+			h.AssertEq(t, len(idx.PendingChanges()), 0)
+		})
+
+		when("#ResetPendingChanges", func() {
+			it("discards the changes made since the index was saved", func() {
+				h.AssertNil(t, idx.SetAnnotations(digest, map[string]string{"some-key": "some-value"}))
+				h.AssertNil(t, idx.RemoveManifest(digest))
+
+				idx.ResetPendingChanges()
+				h.AssertEq(t, len(idx.PendingChanges()), 0)
+
+				annotations, err := idx.Annotations(digest)
+				h.AssertNil(t, err)
+				_, ok := annotations["some-key"]
+				h.AssertEq(t, ok, false)
+
+				h.AssertNil(t, idx.SaveDir())
+				index := h.ReadIndexManifest(t, localPath)
+				h.AssertEq(t, len(index.Manifests), 2)
+			})
+
+			it("restores the platform and annotations of changed manifests", func() {
+				before, err := idx.Annotations(digest)
+				h.AssertNil(t, err)
+
+				h.AssertNil(t, idx.SetAnnotations(digest, map[string]string{"some-key": "some-value"}))
+				h.AssertNil(t, idx.SetPlatform(digest, imgutil.Platform{OS: "some-os", Architecture: "some-arch"}))
+				h.AssertNil(t, idx.SetAnnotations(digest, map[string]string{"other-key": "other-value"}))
+
+				idx.ResetPendingChanges()
+
+				osName, err := idx.OS(digest)
+				h.AssertNil(t, err)
+				h.AssertEq(t, osName, "linux")
+				annotations, err := idx.Annotations(digest)
+				h.AssertNil(t, err)
+				h.AssertEq(t, annotations, before)
+			})
+
+			it("keeps the changes that were saved", func() {
+				h.AssertNil(t, idx.SetOS(digest, "some-os"))
+				h.AssertNil(t, idx.SaveDir())
+				h.AssertNil(t, idx.RemoveManifest(digest))
+
+				idx.ResetPendingChanges()
+
+				osName, err := idx.OS(digest)
+				h.AssertNil(t, err)
+				h.AssertEq(t, osName, "some-os")
+			})
+		})
+	})
+
 	when("#Inspect", func() {
 		var indexString string
 		when("index exists on disk", func() {
@@ -3,6 +3,7 @@ package layout
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -16,7 +17,12 @@ type Image struct {
 	*imgutil.CNBImageCore
 	repoPath          string
 	saveWithoutLayers bool
+	durableWrites     bool
 	preserveDigest    bool
+	progressHandler   imgutil.ProgressHandler
+	lockTimeout       time.Duration
+	logger            imgutil.Logger
+	metrics           imgutil.MetricsHook
 }
 
 func (i *Image) Kind() string {
@@ -1,7 +1,9 @@
 package layout_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -399,6 +401,103 @@ func testImage(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#ExposedPorts", func() {
+		var image *layout.Image
+
+		it.Before(func() {
+			image, err = layout.NewImage(imagePath)
+			h.AssertNil(t, err)
+		})
+
+		it("exposed ports are saved on disk in OCI layout format", func() {
+			h.AssertNil(t, image.SetExposedPorts("8080", "53/udp"))
+			h.AssertNil(t, image.Save())
+
+			_, configFile := h.ReadManifestAndConfigFile(t, imagePath)
+			h.AssertEq(t, configFile.Config.ExposedPorts, map[string]struct{}{"8080/tcp": {}, "53/udp": {}})
+
+			imageLoaded, err := layout.NewImage(imagePath, layout.FromBaseImagePath(imagePath))
+			h.AssertNil(t, err)
+			ports, err := imageLoaded.ExposedPorts()
+			h.AssertNil(t, err)
+			h.AssertEq(t, ports, []string{"53/udp", "8080/tcp"})
+		})
+
+		it("errors on an invalid port", func() {
+			h.AssertError(t, image.SetExposedPorts("http"), `invalid port number in "http"`)
+		})
+	})
+
+	when("#Volumes", func() {
+		var image *layout.Image
+
+		it.Before(func() {
+			image, err = layout.NewImage(imagePath)
+			h.AssertNil(t, err)
+		})
+
+		it("volumes are saved on disk in OCI layout format", func() {
+			volumes := map[string]struct{}{"/data": {}, "/cache": {}}
+			h.AssertNil(t, image.SetVolumes(volumes))
+			h.AssertNil(t, image.Save())
+
+			_, configFile := h.ReadManifestAndConfigFile(t, imagePath)
+			h.AssertEq(t, configFile.Config.Volumes, volumes)
+
+			imageLoaded, err := layout.NewImage(imagePath, layout.FromBaseImagePath(imagePath))
+			h.AssertNil(t, err)
+			loaded, err := imageLoaded.Volumes()
+			h.AssertNil(t, err)
+			h.AssertEq(t, loaded, volumes)
+		})
+	})
+
+	when("#StopSignal", func() {
+		var image *layout.Image
+
+		it.Before(func() {
+			image, err = layout.NewImage(imagePath)
+			h.AssertNil(t, err)
+		})
+
+		it("stop signal is saved on disk in OCI layout format", func() {
+			h.AssertNil(t, image.SetStopSignal("SIGQUIT"))
+			h.AssertNil(t, image.Save())
+
+			_, configFile := h.ReadManifestAndConfigFile(t, imagePath)
+			h.AssertEq(t, configFile.Config.StopSignal, "SIGQUIT")
+
+			imageLoaded, err := layout.NewImage(imagePath, layout.FromBaseImagePath(imagePath))
+			h.AssertNil(t, err)
+			signal, err := imageLoaded.StopSignal()
+			h.AssertNil(t, err)
+			h.AssertEq(t, signal, "SIGQUIT")
+		})
+	})
+
+	when("#User", func() {
+		var image *layout.Image
+
+		it.Before(func() {
+			image, err = layout.NewImage(imagePath)
+			h.AssertNil(t, err)
+		})
+
+		it("user is saved on disk in OCI layout format", func() {
+			h.AssertNil(t, image.SetUser("cnb"))
+			h.AssertNil(t, image.Save())
+
+			_, configFile := h.ReadManifestAndConfigFile(t, imagePath)
+			h.AssertEq(t, configFile.Config.User, "cnb")
+
+			imageLoaded, err := layout.NewImage(imagePath, layout.FromBaseImagePath(imagePath))
+			h.AssertNil(t, err)
+			user, err := imageLoaded.User()
+			h.AssertNil(t, err)
+			h.AssertEq(t, user, "cnb")
+		})
+	})
+
 	when("#EntryPoint", func() {
 		var image *layout.Image
 
@@ -654,7 +753,66 @@ func testImage(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#Inspect", func() {
+		it("returns the manifest, config and history of the base image as saved on disk", func() {
+			image, err := layout.NewImage(imagePath, layout.FromBaseImagePath(sparseBaseImagePath))
+			h.AssertNil(t, err)
+
+			out, err := image.Inspect()
+			h.AssertNil(t, err)
+			var inspection imgutil.ImageInspection
+			h.AssertNil(t, json.Unmarshal([]byte(out), &inspection))
+
+			digest, err := image.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, inspection.Digest, digest.String())
+			h.AssertEq(t, inspection.MediaType, types.DockerManifestSchema2)
+			h.AssertEq(t, len(inspection.Manifest.Layers), 1)
+			h.AssertEq(t, inspection.Config.RootFS.DiffIDs[0].String(), "sha256:40cf597a9181e86497f4121c604f9f0ab208950a98ca21db883f26b0a548a2eb")
+		})
+	})
+
 	when("#Save", func() {
+		when("#WithDurableWrites", func() {
+			it("saves the image", func() {
+				image, err := layout.NewImage(imagePath, layout.FromBaseImagePath(fullBaseImagePath), layout.WithDurableWrites())
+				h.AssertNil(t, err)
+
+				path, diffID, _ := h.RandomLayer(t, tmpDir)
+				h.AssertNil(t, image.AddLayerWithDiffID(path, diffID))
+				h.AssertNil(t, image.Save())
+
+				// expected blobs: manifest, config, base layer, new layer
+				h.AssertBlobsLen(t, imagePath, 4)
+				index := h.ReadIndexManifest(t, imagePath)
+				h.AssertEq(t, len(index.Manifests), 1)
+			})
+		})
+
+		when("#WithCompression", func() {
+			it("writes zstd layers that can be read back", func() {
+				image, err := layout.NewImage(imagePath, layout.WithCompression(imgutil.Zstd))
+				h.AssertNil(t, err)
+
+				path, diffID, _ := h.RandomLayer(t, tmpDir)
+				h.AssertNil(t, image.AddLayerWithDiffID(path, diffID))
+				h.AssertNil(t, image.Save())
+
+				index := h.ReadIndexManifest(t, imagePath)
+				manifest := h.ReadManifest(t, index.Manifests[0].Digest, imagePath)
+				h.AssertEq(t, len(manifest.Layers), 1)
+				h.AssertEq(t, manifest.Layers[0].MediaType, types.OCILayerZStd)
+
+				savedImage, err := layout.NewImage(imagePath, layout.FromBaseImagePath(imagePath))
+				h.AssertNil(t, err)
+				rc, err := savedImage.GetLayer(diffID)
+				h.AssertNil(t, err)
+				defer rc.Close()
+				_, err = io.Copy(io.Discard, rc)
+				h.AssertNil(t, err)
+			})
+		})
+
 		when("#FromBaseImageInstance with full image", func() {
 			when("additional names are provided", func() {
 				it("creates an image and save it to both path provided", func() {
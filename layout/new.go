@@ -2,6 +2,7 @@ package layout
 
 import (
 	"fmt"
+	"strings"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 
@@ -13,13 +14,24 @@ func NewImage(path string, ops ...imgutil.ImageOption) (*Image, error) {
 	for _, op := range ops {
 		op(options)
 	}
+	if err := options.Err(); err != nil {
+		return nil, err
+	}
 
 	options.Platform = processPlatformOption(options.Platform)
+	if options.LongPaths {
+		path = imgutil.LongPath(path)
+		options.BaseImageRepoName = imgutil.LongPath(options.BaseImageRepoName)
+		options.PreviousImageRepoName = imgutil.LongPath(options.PreviousImageRepoName)
+	}
 
-	var err error
+	err := imgutil.CheckCapabilities(options, capabilities)
+	if err != nil {
+		return nil, err
+	}
 
 	if options.BaseImage == nil && options.BaseImageRepoName != "" { // options.BaseImage supersedes options.BaseImageRepoName
-		options.BaseImage, err = newImageFromPath(options.BaseImageRepoName, options.Platform)
+		options.BaseImage, err = newImageFromPath(options.BaseImageRepoName, options.Platform, options.Repair, options.VerifyBlobs)
 		if err != nil {
 			return nil, err
 		}
@@ -33,7 +45,7 @@ func NewImage(path string, ops ...imgutil.ImageOption) (*Image, error) {
 	}
 
 	if options.PreviousImageRepoName != "" {
-		options.PreviousImage, err = newImageFromPath(options.PreviousImageRepoName, options.Platform)
+		options.PreviousImage, err = newImageFromPath(options.PreviousImageRepoName, options.Platform, options.Repair, options.VerifyBlobs)
 		if err != nil {
 			return nil, err
 		}
@@ -54,7 +66,12 @@ func NewImage(path string, ops ...imgutil.ImageOption) (*Image, error) {
 		CNBImageCore:      cnbImage,
 		repoPath:          path,
 		saveWithoutLayers: options.WithoutLayers,
+		durableWrites:     options.DurableWrites,
 		preserveDigest:    options.PreserveDigest,
+		lockTimeout:       options.LockTimeout,
+		progressHandler:   options.ProgressHandler,
+		logger:            options.Logger,
+		metrics:           options.MetricsHook,
 	}, nil
 }
 
@@ -72,10 +89,15 @@ func processPlatformOption(requestedPlatform imgutil.Platform) imgutil.Platform
 // newImageFromPath creates a layout image from the given path.
 // * If an image index for multiple platforms exists, it will try to select the image according to the platform provided.
 // * If the image does not exist, then nothing is returned.
-func newImageFromPath(path string, withPlatform imgutil.Platform) (v1.Image, error) {
+// * If repair is requested, partial blobs and temporary files left by interrupted writes are removed first.
+// * If verify is requested, the blobs of the image are checked against their digests; see WithVerifyBlobs.
+func newImageFromPath(path string, withPlatform imgutil.Platform, repair, verify bool) (v1.Image, error) {
 	if !imageExists(path) {
 		return nil, nil
 	}
+	if err := checkLayoutOnOpen(path, repair); err != nil {
+		return nil, err
+	}
 
 	layoutPath, err := FromPath(path)
 	if err != nil {
@@ -85,40 +107,86 @@ func newImageFromPath(path string, withPlatform imgutil.Platform) (v1.Image, err
 	if err != nil {
 		return nil, fmt.Errorf("failed to load index: %w", err)
 	}
-	image, err := imageFromIndex(index, withPlatform)
+	if verify {
+		index = &verifiedIndex{imageIndex: index}
+	}
+	image, err := imageFromIndex(path, index, withPlatform)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load image from index: %w", err)
 	}
 	return image, nil
 }
 
-// imageFromIndex creates a v1.Image from the given Image Index, selecting the image manifest
-// that matches the given OS and architecture.
-func imageFromIndex(index v1.ImageIndex, platform imgutil.Platform) (v1.Image, error) {
+// ErrPlatformNotFound is returned when the base or previous image is read from a layout containing several images,
+// none of which matches the requested platform.
+type ErrPlatformNotFound struct {
+	Path     string
+	Platform imgutil.Platform
+	// Available are the platforms of the images in the layout.
+	Available []imgutil.Platform
+}
+
+func (e ErrPlatformNotFound) Error() string {
+	available := make([]string, 0, len(e.Available))
+	for _, platform := range e.Available {
+		available = append(available, platform.String())
+	}
+	return fmt.Sprintf("failed to find image matching platform %s in layout %q; available platforms: %s",
+		e.Platform, e.Path, strings.Join(available, ", "))
+}
+
+// imageFromIndex creates a v1.Image from the given Image Index.
+// If the index has a single image, it is selected; otherwise, the first image that matches the given platform is selected.
+// Empty variant and OS version values in the platform match any value, and attestation manifests are ignored.
+// The platform of an image is read from its config when it is not recorded in its descriptor.
+func imageFromIndex(path string, index v1.ImageIndex, platform imgutil.Platform) (v1.Image, error) {
 	manifestList, err := index.IndexManifest()
 	if err != nil {
 		return nil, err
 	}
-	if len(manifestList.Manifests) == 0 {
+	var manifests []v1.Descriptor
+	for _, m := range manifestList.Manifests {
+		if m.Annotations[imgutil.AttestationReferenceTypeAnnotation] != imgutil.AttestationManifestType {
+			manifests = append(manifests, m)
+		}
+	}
+	if len(manifests) == 0 {
 		return nil, fmt.Errorf("failed to find manifest at index")
 	}
+	if len(manifests) == 1 {
+		return index.Image(manifests[0].Digest)
+	}
 
-	// find manifest for platform
-	var manifest v1.Descriptor
-	if len(manifestList.Manifests) == 1 {
-		manifest = manifestList.Manifests[0]
-	} else {
-		for _, m := range manifestList.Manifests {
-			if m.Platform.OS == platform.OS &&
-				m.Platform.Architecture == platform.Architecture &&
-				m.Platform.Variant == platform.Variant &&
-				m.Platform.OSVersion == platform.OSVersion {
-				manifest = m
-				break
+	notFound := ErrPlatformNotFound{Path: path, Platform: platform}
+	for _, m := range manifests {
+		if !m.MediaType.IsImage() {
+			continue
+		}
+		var candidate v1.Platform
+		if m.Platform != nil {
+			candidate = *m.Platform
+		} else {
+			image, err := index.Image(m.Digest)
+			if err != nil {
+				return nil, err
+			}
+			configFile, err := image.ConfigFile()
+			if err != nil {
+				return nil, err
+			}
+			if configPlatform := configFile.Platform(); configPlatform != nil {
+				candidate = *configPlatform
 			}
 		}
-		return nil, fmt.Errorf("failed to find manifest matching platform %v", platform)
+		if platform.Matches(candidate) {
+			return index.Image(m.Digest)
+		}
+		notFound.Available = append(notFound.Available, imgutil.Platform{
+			OS:           candidate.OS,
+			Architecture: candidate.Architecture,
+			Variant:      candidate.Variant,
+			OSVersion:    candidate.OSVersion,
+		})
 	}
-
-	return index.Image(manifest.Digest)
+	return nil, notFound
 }
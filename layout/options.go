@@ -16,6 +16,86 @@ func FromBaseImageInstance(image v1.Image) func(*imgutil.ImageOptions) {
 	}
 }
 
+// WithCompression sets the algorithm used to compress layers added to the image.
+// Zstd-compressed layers are written with the `application/vnd.oci.image.layer.v1.tar+zstd` media type.
+// EStargz layers are written with the TOC digest annotation, so that they can be pulled lazily by the stargz snapshotter.
+func WithCompression(compression imgutil.Compression) func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.LayerCompression = compression
+	}
+}
+
+// WithDurableWrites (layout only) if provided will cause the image blobs, `index.json`, and their parent directories
+// to be flushed to stable storage when the image is saved, so that a power loss cannot corrupt the layout.
+// This makes saving slower, so it is not the default.
+func WithDurableWrites() func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.DurableWrites = true
+	}
+}
+
+// WithLongPaths (layout only) if provided will cause the image, base image, and previous image paths to be accessed
+// as extended-length paths on Windows, so that deeply nested layouts are not subject to the MAX_PATH limit.
+// It has no effect on other operating systems. See imgutil.LongPath.
+func WithLongPaths() func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.LongPaths = true
+	}
+}
+
+// WithProgressHandler registers a handler that is notified as layer data is written to the layout directory,
+// so that callers can render progress for layer writes.
+func WithProgressHandler(handler imgutil.ProgressHandler) func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.ProgressHandler = handler
+	}
+}
+
+// WithRepair (layout only) if provided will cause temporary files and partial blobs left by interrupted writes
+// to be removed from the base and previous image layouts when they are opened.
+// Repairing scans every blob of the layout; without it, the layout is not scanned and partial blobs fail when they are read.
+// Use CheckLayout to find the leftovers without removing them.
+func WithRepair() func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.Repair = true
+	}
+}
+
+// WithIndexRepair is the same as WithRepair, for the base index layout opened by NewIndex.
+func WithIndexRepair() func(*imgutil.IndexOptions) error {
+	return func(o *imgutil.IndexOptions) error {
+		o.LayoutIndexOptions.Repair = true
+		return nil
+	}
+}
+
+// WithVerifyBlobs (layout only) if provided will cause the blobs read from the base and previous image layouts
+// to be checked against their digests, so that a corrupted blob, e.g. in a layout shared as a cache, fails with an
+// ErrCorruptBlob instead of being built upon. Manifests and configs are checked when the image is opened, and layers
+// when they are read. See VerifyImage to check a whole layout.
+func WithVerifyBlobs() func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.VerifyBlobs = true
+	}
+}
+
+// WithLockTimeout (layout only) sets how long saving waits for other processes writing to the same layout path
+// to release their lock, before failing with an imgutil.ErrLockTimeout. The default is imgutil.DefaultLockTimeout.
+func WithLockTimeout(timeout time.Duration) func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.LockTimeout = timeout
+	}
+}
+
+// WithIndexLockTimeout is the same as WithLockTimeout, for loading the base index with NewIndex
+// and for SaveDir and DeleteDir on the returned index.
+func WithIndexLockTimeout(timeout time.Duration) func(*imgutil.IndexOptions) error {
+	return func(o *imgutil.IndexOptions) error {
+		o.LayoutIndexOptions.LockTimeout = timeout
+		return nil
+	}
+}
+
 // WithoutLayersWhenSaved (layout only) if provided will cause the image to be written without layers in the `blobs` directory.
 func WithoutLayersWhenSaved() func(*imgutil.ImageOptions) {
 	return func(o *imgutil.ImageOptions) {
@@ -0,0 +1,118 @@
+package layout_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	ggcrlayout "github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestMultiPlatformBase(t *testing.T) {
+	spec.Run(t, "MultiPlatformBase", testMultiPlatformBase, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testMultiPlatformBase(t *testing.T, when spec.G, it spec.S) {
+	var (
+		basePath string
+		digests  map[string]v1.Hash
+	)
+
+	imageFor := func(platform v1.Platform) v1.Image {
+		image, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS = platform.OS
+		configFile.Architecture = platform.Architecture
+		configFile.Variant = platform.Variant
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		return image
+	}
+
+	it.Before(func() {
+		var err error
+		basePath, err = os.MkdirTemp("", "layout-multi-platform-test")
+		h.AssertNil(t, err)
+		layoutPath, err := ggcrlayout.Write(basePath, empty.Index)
+		h.AssertNil(t, err)
+
+		digests = map[string]v1.Hash{}
+		for _, platform := range []v1.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			{OS: "linux", Architecture: "arm", Variant: "v7"},
+		} {
+			image := imageFor(platform)
+			var opts []ggcrlayout.Option
+			if platform.Architecture != "arm" { // the platform is read from the config when it is not in the descriptor
+				opts = append(opts, ggcrlayout.WithPlatform(platform))
+			}
+			h.AssertNil(t, layoutPath.AppendImage(image, opts...))
+			digests[platform.Architecture], err = image.Digest()
+			h.AssertNil(t, err)
+		}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(basePath))
+	})
+
+	it("selects the image matching the default platform", func() {
+		for _, tc := range []struct {
+			platform imgutil.Platform
+			expected string
+		}{
+			{imgutil.Platform{}, "amd64"}, // linux/amd64 is the default platform
+			{imgutil.Platform{OS: "linux", Architecture: "arm64"}, "arm64"},
+			{imgutil.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, "arm"},
+		} {
+			var opts []imgutil.ImageOption
+			if tc.platform != (imgutil.Platform{}) {
+				opts = append(opts, layout.WithDefaultPlatform(tc.platform))
+			}
+			image, err := layout.NewImage(t.TempDir(), append(opts, layout.FromBaseImagePath(basePath))...)
+			h.AssertNil(t, err)
+			layers, err := image.Layers()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(layers), 1)
+
+			baseImage, err := ggcrlayout.Path(basePath).Image(digests[tc.expected])
+			h.AssertNil(t, err)
+			baseLayers, err := baseImage.Layers()
+			h.AssertNil(t, err)
+			actual, err := layers[0].DiffID()
+			h.AssertNil(t, err)
+			expected, err := baseLayers[0].DiffID()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, expected)
+		}
+	})
+
+	it("returns an error listing the available platforms when no image matches", func() {
+		_, err := layout.NewImage(t.TempDir(),
+			layout.WithDefaultPlatform(imgutil.Platform{OS: "linux", Architecture: "s390x"}),
+			layout.FromBaseImagePath(basePath),
+		)
+		var notFound layout.ErrPlatformNotFound
+		h.AssertEq(t, errors.As(err, &notFound), true)
+		h.AssertEq(t, notFound.Platform, imgutil.Platform{OS: "linux", Architecture: "s390x"})
+		h.AssertEq(t, notFound.Available, []imgutil.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			{OS: "linux", Architecture: "arm", Variant: "v7"},
+		})
+		h.AssertError(t, err, "available platforms: linux/amd64, linux/arm64/v8, linux/arm/v7")
+	})
+}
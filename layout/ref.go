@@ -0,0 +1,61 @@
+package layout
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// capabilities are the capabilities of layout images.
+var capabilities = imgutil.Capabilities{CanRebase: true, CanSetAnnotations: true}
+
+func init() {
+	imgutil.RegisterScheme(imgutil.LayoutScheme, func(name string, ops ...imgutil.ImageOption) (imgutil.Image, error) {
+		return NewImageFromRef(name, ops...)
+	}, capabilities)
+	imgutil.RegisterAccessChecker(imgutil.LayoutScheme, func(name string, scope imgutil.AccessScope) error {
+		path, _, err := parseRef(name)
+		if err != nil {
+			return err
+		}
+		return CheckAccess(path, scope)
+	})
+}
+
+// NewImageFromRef returns the image in the layout at `path@digest`, or at `path` if no digest is given,
+// in which case the image is selected for the platform as with FromBaseImagePath.
+// The image is saved back to the layout at path.
+func NewImageFromRef(ref string, ops ...imgutil.ImageOption) (*Image, error) {
+	path, digest, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	if digest == (v1.Hash{}) {
+		return NewImage(path, append([]imgutil.ImageOption{FromBaseImagePath(path)}, ops...)...)
+	}
+	layoutPath, err := FromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load layout from path: %w", err)
+	}
+	image, err := layoutPath.Image(digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load image %s from layout %s: %w", digest, path, err)
+	}
+	return NewImage(path, append([]imgutil.ImageOption{FromBaseImageInstance(image)}, ops...)...)
+}
+
+// parseRef splits a `path@digest` reference; the digest is optional.
+func parseRef(ref string) (string, v1.Hash, error) {
+	idx := strings.LastIndex(ref, "@")
+	if idx < 0 {
+		return ref, v1.Hash{}, nil
+	}
+	digest, err := v1.NewHash(ref[idx+1:])
+	if err != nil {
+		return "", v1.Hash{}, fmt.Errorf("invalid digest in layout reference %q: %w", ref, err)
+	}
+	return ref[:idx], digest, nil
+}
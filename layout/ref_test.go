@@ -0,0 +1,55 @@
+package layout_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRef(t *testing.T) {
+	spec.Run(t, "Ref", testRef, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testRef(t *testing.T, when spec.G, it spec.S) {
+	const busyboxDigest = "sha256:f75f3d1a317fc82c793d567de94fc8df2bece37acd5f2bd364a0d91a0d1f3dab"
+	// references to layouts must be paths, so the relative path starts with the current directory
+	var layoutPath = "." + string(filepath.Separator) + filepath.Join("testdata", "layout", "busybox")
+
+	when("#NewImageFromRef", func() {
+		it("reads the image with the given digest from the layout", func() {
+			image, err := imgutil.NewImageFromRef("oci:" + layoutPath + "@" + busyboxDigest)
+			h.AssertNil(t, err)
+			h.AssertEq(t, image.Kind(), "layout")
+			h.AssertEq(t, image.Name(), layoutPath)
+
+			digest, err := image.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, digest.String(), busyboxDigest)
+		})
+
+		it("reads the image for the platform when no digest is given", func() {
+			image, err := layout.NewImageFromRef(layoutPath)
+			h.AssertNil(t, err)
+
+			digest, err := image.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, digest.String(), busyboxDigest)
+		})
+
+		it("fails when the digest is not in the layout", func() {
+			_, err := imgutil.NewImageFromRef("oci:" + layoutPath + "@sha256:b9d056b83bb6446fee29e89a7fcf10203c562c1f59586a6e2f39c903597bda34")
+			h.AssertError(t, err, "failed to load image")
+		})
+
+		it("fails when the digest is invalid", func() {
+			_, err := imgutil.NewImageFromRef("oci:" + layoutPath + "@sha256:invalid")
+			h.AssertError(t, err, "invalid digest in layout reference")
+		})
+	})
+}
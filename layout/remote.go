@@ -0,0 +1,253 @@
+package layout
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// SparseFromRemote writes a sparse layout of the image or index with the provided reference to path:
+// the manifests and configs of the image, or of the images for every platform of the index, without their layer blobs.
+// The `index.json` of the layout is the manifest of the index, so that the layout can be loaded with NewIndex,
+// and its digest is preserved; for an image, it references the image.
+// The registry is accessed with the keychain provided with imgutil.WithKeychain (or authn.DefaultKeychain),
+// and over HTTP if imgutil.WithInsecure is provided, with the transport and retries of the remote package, which must be imported.
+func SparseFromRemote(ref, path string, ops ...imgutil.IndexOption) (Path, error) {
+	desc, err := getRemote(ref, ops)
+	if err != nil {
+		return Path{}, err
+	}
+
+	layoutPath, err := Write(path, empty.Index)
+	if err != nil {
+		return Path{}, err
+	}
+	if !desc.MediaType.IsIndex() {
+		image, err := desc.Image()
+		if err != nil {
+			return Path{}, err
+		}
+		if err = layoutPath.writeImageWithoutLayers(image, map[string]string{}); err != nil {
+			return Path{}, err
+		}
+		return layoutPath, nil
+	}
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return Path{}, err
+	}
+	if err = layoutPath.writeIndexWithoutLayers(index); err != nil {
+		return Path{}, err
+	}
+	rawIndex, err := index.RawManifest()
+	if err != nil {
+		return Path{}, err
+	}
+	if err = layoutPath.WriteFile("index.json", rawIndex, 0644); err != nil {
+		return Path{}, err
+	}
+	return layoutPath, nil
+}
+
+// fromRemoteJobs is the number of layers downloaded in parallel by FromRemote.
+const fromRemoteJobs = 4
+
+// FromRemote writes a full layout of the image or index with the provided reference to path, as SparseFromRemote does,
+// but with the layer blobs of the image, or of the images for every platform of the index, downloaded in parallel.
+// Blobs already in the layout with the expected size are not downloaded again, so that an interrupted download
+// can be resumed by calling FromRemote again with the same path. The `index.json` of the layout is written last.
+// Foreign layers, which are not stored in the registry, are not downloaded.
+func FromRemote(ref, path string, ops ...imgutil.IndexOption) (Path, error) {
+	desc, err := getRemote(ref, ops)
+	if err != nil {
+		return Path{}, err
+	}
+
+	layoutPath, err := Write(path, empty.Index)
+	if err != nil {
+		return Path{}, err
+	}
+	if !desc.MediaType.IsIndex() {
+		image, err := desc.Image()
+		if err != nil {
+			return Path{}, err
+		}
+		if err = layoutPath.downloadLayers(image); err != nil {
+			return Path{}, err
+		}
+		if err = layoutPath.writeImageWithoutLayers(image, map[string]string{}); err != nil {
+			return Path{}, err
+		}
+		return layoutPath, nil
+	}
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return Path{}, err
+	}
+	images, err := imagesOf(index)
+	if err != nil {
+		return Path{}, err
+	}
+	if err = layoutPath.downloadLayers(images...); err != nil {
+		return Path{}, err
+	}
+	if err = layoutPath.writeIndexWithoutLayers(index); err != nil {
+		return Path{}, err
+	}
+	rawIndex, err := index.RawManifest()
+	if err != nil {
+		return Path{}, err
+	}
+	if err = layoutPath.WriteFile("index.json", rawIndex, 0644); err != nil {
+		return Path{}, err
+	}
+	return layoutPath, nil
+}
+
+// getRemote returns the descriptor of the image or index with the provided reference,
+// accessing the registry with the keychain and insecure options, and with the transport and retries of the remote package,
+// which must be imported.
+func getRemote(ref string, ops []imgutil.IndexOption) (*remote.Descriptor, error) {
+	options := &imgutil.IndexOptions{}
+	for _, op := range ops {
+		if err := op(options); err != nil {
+			return nil, err
+		}
+	}
+	keychain := options.Keychain
+	if keychain == nil {
+		keychain = authn.DefaultKeychain
+	}
+	desc, err := imgutil.GetDescriptor(ref, keychain, func(o *imgutil.ImageOptions) {
+		o.RegistrySettings = make(map[string]imgutil.RegistrySetting, len(options.RegistrySettings)+1)
+		for prefix, setting := range options.RegistrySettings {
+			o.RegistrySettings[prefix] = setting
+		}
+		if options.Insecure {
+			setting := o.RegistrySettings[ref]
+			setting.Insecure = true
+			o.RegistrySettings[ref] = setting
+		}
+		o.Logger = options.Logger
+		o.RetryPolicy.Logger = options.Logger
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+	return desc, nil
+}
+
+// imagesOf returns the images of the index and of its nested indexes.
+func imagesOf(index v1.ImageIndex) ([]v1.Image, error) {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var images []v1.Image
+	for _, desc := range manifest.Manifests {
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			childImages, err := imagesOf(child)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, childImages...)
+		case desc.MediaType.IsImage():
+			image, err := index.Image(desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// downloadLayers writes the layer blobs of the images, fromRemoteJobs at a time, skipping foreign layers,
+// layers shared by several images, and blobs already in the layout with the expected size.
+func (l Path) downloadLayers(images ...v1.Image) error {
+	var (
+		g    errgroup.Group
+		seen = map[v1.Hash]bool{}
+	)
+	g.SetLimit(fromRemoteJobs)
+	for _, image := range images {
+		manifest, err := image.Manifest()
+		if err != nil {
+			_ = g.Wait()
+			return err
+		}
+		for _, desc := range manifest.Layers {
+			if seen[desc.Digest] || len(desc.URLs) > 0 {
+				continue
+			}
+			seen[desc.Digest] = true
+			if fi, err := os.Stat(l.append("blobs", desc.Digest.Algorithm, desc.Digest.Hex)); err == nil && fi.Size() == desc.Size {
+				continue
+			}
+			layer, err := image.LayerByDigest(desc.Digest)
+			if err != nil {
+				_ = g.Wait()
+				return err
+			}
+			digest := desc.Digest
+			g.Go(func() error {
+				if err := l.writeLayer(layer); err != nil {
+					return fmt.Errorf("failed to download layer %s: %w", digest, err)
+				}
+				return nil
+			})
+		}
+	}
+	return g.Wait()
+}
+
+// writeIndexWithoutLayers writes the manifests and configs of the images of the index, and of its nested indexes,
+// as blobs of the layout.
+func (l Path) writeIndexWithoutLayers(index v1.ImageIndex) error {
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range manifest.Manifests {
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err = l.writeIndexWithoutLayers(child); err != nil {
+				return err
+			}
+			raw, err := child.RawManifest()
+			if err != nil {
+				return err
+			}
+			if err = l.WriteBlob(desc.Digest, io.NopCloser(bytes.NewReader(raw))); err != nil {
+				return err
+			}
+		case desc.MediaType.IsImage():
+			image, err := index.Image(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err = l.writeImage(image); err != nil {
+				return fmt.Errorf("failed to write image %s: %w", desc.Digest, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package layout_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestSparseFromRemote(t *testing.T) {
+	spec.Run(t, "SparseFromRemote", testSparseFromRemote, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testSparseFromRemote(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server    *httptest.Server
+		host      string
+		layoutDir string
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+		layoutDir, err = os.MkdirTemp("", "sparse-from-remote-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		server.Close()
+		h.AssertNil(t, os.RemoveAll(layoutDir))
+	})
+
+	it("writes the manifests and configs of every platform, without layers", func() {
+		var addenda []mutate.IndexAddendum
+		for _, arch := range []string{"amd64", "arm64"} {
+			image, err := random.Image(100, 2)
+			h.AssertNil(t, err)
+			addenda = append(addenda, mutate.IndexAddendum{
+				Add:        image,
+				Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: arch}},
+			})
+		}
+		index := mutate.AppendManifests(empty.Index, addenda...)
+		ref, err := name.ParseReference(host + "/some/index")
+		h.AssertNil(t, err)
+		h.AssertNil(t, remote.WriteIndex(ref, index))
+
+		layoutPath, err := layout.SparseFromRemote(ref.String(), layoutDir, imgutil.WithInsecure())
+		h.AssertNil(t, err)
+
+		localIndex, err := layoutPath.ImageIndex()
+		h.AssertNil(t, err)
+		localDigest, err := localIndex.Digest()
+		h.AssertNil(t, err)
+		digest, err := index.Digest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, localDigest, digest)
+
+		for _, addendum := range addenda {
+			expectedDigest, err := addendum.Add.(v1.Image).Digest()
+			h.AssertNil(t, err)
+			image, err := localIndex.Image(expectedDigest)
+			h.AssertNil(t, err)
+			configFile, err := image.ConfigFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(configFile.RootFS.DiffIDs), 2)
+
+			layers, err := addendum.Add.(v1.Image).Layers()
+			h.AssertNil(t, err)
+			for _, layer := range layers {
+				layerDigest, err := layer.Digest()
+				h.AssertNil(t, err)
+				_, err = layoutPath.Blob(layerDigest)
+				h.AssertNotNil(t, err)
+			}
+		}
+	})
+
+	it("writes a single image", func() {
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		ref, err := name.ParseReference(host + "/some/image")
+		h.AssertNil(t, err)
+		h.AssertNil(t, remote.Write(ref, image))
+
+		layoutPath, err := layout.SparseFromRemote(ref.String(), layoutDir, imgutil.WithInsecure())
+		h.AssertNil(t, err)
+
+		digest, err := image.Digest()
+		h.AssertNil(t, err)
+		localImage, err := layoutPath.Image(digest)
+		h.AssertNil(t, err)
+		_, err = localImage.ConfigFile()
+		h.AssertNil(t, err)
+	})
+}
+
+func TestFromRemote(t *testing.T) {
+	spec.Run(t, "FromRemote", testFromRemote, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testFromRemote(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server       *httptest.Server
+		host         string
+		layoutDir    string
+		mu           sync.Mutex
+		blobRequests []string
+	)
+
+	it.Before(func() {
+		handler := registry.New()
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/blobs/") {
+				mu.Lock()
+				blobRequests = append(blobRequests, path.Base(r.URL.Path))
+				mu.Unlock()
+			}
+			handler.ServeHTTP(w, r)
+		}))
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+		layoutDir, err = os.MkdirTemp("", "from-remote-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		server.Close()
+		h.AssertNil(t, os.RemoveAll(layoutDir))
+	})
+
+	it("writes the layers of every platform and only downloads the missing ones again", func() {
+		var (
+			addenda []mutate.IndexAddendum
+			layers  []v1.Layer
+		)
+		for _, arch := range []string{"amd64", "arm64"} {
+			image, err := random.Image(100, 2)
+			h.AssertNil(t, err)
+			imageLayers, err := image.Layers()
+			h.AssertNil(t, err)
+			layers = append(layers, imageLayers...)
+			addenda = append(addenda, mutate.IndexAddendum{
+				Add:        image,
+				Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: arch}},
+			})
+		}
+		index := mutate.AppendManifests(empty.Index, addenda...)
+		ref, err := name.ParseReference(host + "/some/index")
+		h.AssertNil(t, err)
+		h.AssertNil(t, remote.WriteIndex(ref, index))
+
+		layoutPath, err := layout.FromRemote(ref.String(), layoutDir, imgutil.WithInsecure())
+		h.AssertNil(t, err)
+		localIndex, err := layoutPath.ImageIndex()
+		h.AssertNil(t, err)
+		validateImages := func() {
+			for _, addendum := range addenda {
+				digest, err := addendum.Add.(v1.Image).Digest()
+				h.AssertNil(t, err)
+				image, err := localIndex.Image(digest)
+				h.AssertNil(t, err)
+				h.AssertNil(t, validate.Image(image))
+			}
+		}
+		validateImages()
+
+		missing, err := layers[1].Digest()
+		h.AssertNil(t, err)
+		h.AssertNil(t, os.Remove(filepath.Join(layoutDir, "blobs", missing.Algorithm, missing.Hex)))
+		mu.Lock()
+		blobRequests = nil
+		mu.Unlock()
+
+		_, err = layout.FromRemote(ref.String(), layoutDir, imgutil.WithInsecure())
+		h.AssertNil(t, err)
+		for _, layer := range layers {
+			digest, err := layer.Digest()
+			h.AssertNil(t, err)
+			if digest == missing {
+				h.AssertContains(t, blobRequests, digest.String())
+			} else {
+				h.AssertDoesNotContain(t, blobRequests, digest.String())
+			}
+		}
+		validateImages()
+	})
+}
@@ -0,0 +1,175 @@
+package layout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// RepairReport describes the leftovers of interrupted writes found in a layout directory.
+type RepairReport struct {
+	Path string
+	// TempFiles are temporary files left behind by blob writes that did not complete.
+	TempFiles []string
+	// PartialBlobs are blobs whose size does not match the size recorded in the descriptors that reference them.
+	PartialBlobs []string
+	// Repaired reports whether the temporary files and partial blobs were removed.
+	Repaired bool
+}
+
+// NeedsRepair reports whether any leftovers of interrupted writes were found.
+func (r RepairReport) NeedsRepair() bool {
+	return len(r.TempFiles) > 0 || len(r.PartialBlobs) > 0
+}
+
+// CheckLayout looks for temporary files and partial blobs left in the layout at the given path by interrupted writes.
+// It does not modify the layout.
+func CheckLayout(path string) (RepairReport, error) {
+	report := RepairReport{Path: path}
+	blobsDir := filepath.Join(path, "blobs")
+	algorithms, err := os.ReadDir(blobsDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return report, nil
+		}
+		return report, err
+	}
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+		blobs, err := os.ReadDir(filepath.Join(blobsDir, algorithm.Name()))
+		if err != nil {
+			return report, err
+		}
+		for _, blob := range blobs {
+			if _, err := v1.NewHash(algorithm.Name() + ":" + blob.Name()); err != nil {
+				report.TempFiles = append(report.TempFiles, filepath.Join(blobsDir, algorithm.Name(), blob.Name()))
+			}
+		}
+	}
+
+	index, err := readDescriptorIndex(filepath.Join(path, "index.json"))
+	if err != nil {
+		return report, fmt.Errorf("failed to read index: %w", err)
+	}
+	partial := map[string]bool{}
+	visited := map[v1.Hash]bool{}
+	for _, desc := range index.Manifests {
+		if err = checkDescriptor(path, desc, partial, visited); err != nil {
+			return report, err
+		}
+	}
+	for blob := range partial {
+		report.PartialBlobs = append(report.PartialBlobs, blob)
+	}
+	sort.Strings(report.PartialBlobs)
+	return report, nil
+}
+
+// RepairLayout removes the temporary files and partial blobs left in the layout at the given path by interrupted writes.
+// Images that reference removed layer blobs can still be read as sparse images, but their layers are no longer available.
+// It holds the layout lock, so that the files of writes in progress are not removed; see imgutil.LockDir.
+func RepairLayout(path string) (RepairReport, error) {
+	unlock, err := imgutil.LockDir(path, 0)
+	if err != nil {
+		return RepairReport{Path: path}, err
+	}
+	defer unlock()
+	return repairLayout(path)
+}
+
+// repairLayout is RepairLayout, for callers that hold the layout lock.
+func repairLayout(path string) (RepairReport, error) {
+	report, err := CheckLayout(path)
+	if err != nil || !report.NeedsRepair() {
+		return report, err
+	}
+	for _, file := range append(append([]string{}, report.TempFiles...), report.PartialBlobs...) {
+		if err = os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return report, err
+		}
+	}
+	report.Repaired = true
+	return report, nil
+}
+
+// checkLayoutOnOpen removes the leftovers of interrupted writes when repair is requested.
+// Otherwise the layout is not scanned, so that opening it stays cheap, and partial blobs surface as read errors.
+func checkLayoutOnOpen(path string, repair bool) error {
+	if !repair {
+		return nil
+	}
+	_, err := RepairLayout(path)
+	return err
+}
+
+// checkDescriptor records the blob for the descriptor as partial if its size does not match,
+// and recurses into the manifests referenced by indexes and the config and layers referenced by image manifests.
+// Missing blobs are allowed, as sparse images do not contain layer blobs.
+func checkDescriptor(path string, desc v1.Descriptor, partial map[string]bool, visited map[v1.Hash]bool) error {
+	if visited[desc.Digest] {
+		return nil
+	}
+	visited[desc.Digest] = true
+
+	blob := filepath.Join(path, "blobs", desc.Digest.Algorithm, desc.Digest.Hex)
+	info, err := os.Stat(blob)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if info.Size() != desc.Size {
+		partial[blob] = true
+		return nil
+	}
+
+	switch {
+	case desc.MediaType.IsIndex():
+		index, err := readDescriptorIndex(blob)
+		if err != nil {
+			return err
+		}
+		for _, child := range index.Manifests {
+			if err = checkDescriptor(path, child, partial, visited); err != nil {
+				return err
+			}
+		}
+	case desc.MediaType.IsImage():
+		contents, err := os.ReadFile(filepath.Clean(blob))
+		if err != nil {
+			return err
+		}
+		var manifest v1.Manifest
+		if err = json.Unmarshal(contents, &manifest); err != nil {
+			return fmt.Errorf("failed to parse manifest %s: %w", desc.Digest, err)
+		}
+		for _, child := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+			if err = checkDescriptor(path, child, partial, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readDescriptorIndex(path string) (*v1.IndexManifest, error) {
+	contents, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	var index v1.IndexManifest
+	if err = json.Unmarshal(contents, &index); err != nil {
+		return nil, err
+	}
+	return &index, nil
+}
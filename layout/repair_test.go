@@ -0,0 +1,92 @@
+package layout_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRepair(t *testing.T) {
+	spec.Run(t, "Repair", testRepair, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testRepair(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir    string
+		imagePath string
+		layerBlob string
+		err       error
+	)
+
+	it.Before(func() {
+		tmpDir, err = os.MkdirTemp("", "layout-repair-test")
+		h.AssertNil(t, err)
+		imagePath = filepath.Join(tmpDir, "image")
+
+		image, err := layout.NewImage(imagePath)
+		h.AssertNil(t, err)
+		path, _, _ := h.RandomLayer(t, tmpDir)
+		h.AssertNil(t, image.AddLayer(path))
+		h.AssertNil(t, image.Save())
+
+		layers, err := image.Layers()
+		h.AssertNil(t, err)
+		digest, err := layers[0].Digest()
+		h.AssertNil(t, err)
+		layerBlob = filepath.Join(imagePath, "blobs", digest.Algorithm, digest.Hex)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("the layout is complete", func() {
+		it("reports nothing to repair", func() {
+			report, err := layout.CheckLayout(imagePath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, report.NeedsRepair(), false)
+		})
+	})
+
+	when("an interrupted write left a temporary file and a partial blob", func() {
+		var tempFile string
+
+		it.Before(func() {
+			tempFile = filepath.Join(imagePath, "blobs", "sha256", "1234567890")
+			h.AssertNil(t, os.WriteFile(tempFile, []byte("partial"), 0600))
+			h.AssertNil(t, os.Truncate(layerBlob, 10))
+		})
+
+		it("reports them", func() {
+			report, err := layout.CheckLayout(imagePath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, report.TempFiles, []string{tempFile})
+			h.AssertEq(t, report.PartialBlobs, []string{layerBlob})
+			h.AssertEq(t, report.Repaired, false)
+		})
+
+		it("leaves them when the layout is opened without repair", func() {
+			_, err := layout.NewImage(filepath.Join(tmpDir, "other"), layout.FromBaseImagePath(imagePath))
+			h.AssertNil(t, err)
+			h.AssertPathExists(t, tempFile)
+			h.AssertPathExists(t, layerBlob)
+		})
+
+		it("removes them when the layout is opened with repair", func() {
+			_, err := layout.NewImage(filepath.Join(tmpDir, "other"), layout.FromBaseImagePath(imagePath), layout.WithRepair())
+			h.AssertNil(t, err)
+			h.AssertPathDoesNotExists(t, tempFile)
+			h.AssertPathDoesNotExists(t, layerBlob)
+
+			report, err := layout.CheckLayout(imagePath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, report.NeedsRepair(), false)
+		})
+	})
+}
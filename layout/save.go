@@ -18,6 +18,10 @@ func (i *Image) SaveAs(name string, additionalNames ...string) error {
 		}
 	}
 
+	if err := i.EncryptLayers(); err != nil {
+		return err
+	}
+
 	refName, err := i.GetAnnotateRefName()
 	if err != nil {
 		return err
@@ -26,20 +30,23 @@ func (i *Image) SaveAs(name string, additionalNames ...string) error {
 	if i.saveWithoutLayers {
 		ops = append(ops, WithoutLayers())
 	}
+	if i.durableWrites {
+		ops = append(ops, WithSync())
+	}
 
 	var (
 		pathsToSave = append([]string{name}, additionalNames...)
 		diagnostics []imgutil.SaveDiagnostic
 	)
+	var size int64
+	if i.metrics != nil {
+		size, _ = i.TotalSize()
+	}
 	for _, path := range pathsToSave {
-		layoutPath, err := initEmptyIndexAt(path)
+		end := imgutil.StartOperation(i.metrics, imgutil.OperationLayoutWrite, path)
+		err = i.saveTo(path, ops)
+		end(size, err)
 		if err != nil {
-			return err
-		}
-		if err = layoutPath.AppendImage(
-			i.Image,
-			ops...,
-		); err != nil {
 			diagnostics = append(diagnostics, imgutil.SaveDiagnostic{ImageName: i.Name(), Cause: err})
 		}
 	}
@@ -50,6 +57,26 @@ func (i *Image) SaveAs(name string, additionalNames ...string) error {
 	return nil
 }
 
+// saveTo appends the image to the layout at path, holding the layout lock so that concurrent writers
+// do not lose each other's updates to index.json.
+func (i *Image) saveTo(path string, ops []AppendOption) error {
+	unlock, err := imgutil.LockDir(path, i.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	layoutPath, err := initEmptyIndexAt(path)
+	if err != nil {
+		return err
+	}
+	imgutil.Debugf(i.logger, "writing %s to %s", i.Name(), path)
+	return layoutPath.AppendImage(
+		imgutil.ImageWithProgress(i.Image, i.progressHandler),
+		ops...,
+	)
+}
+
 func initEmptyIndexAt(path string) (Path, error) {
 	return Write(path, empty.Index)
 }
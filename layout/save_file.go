@@ -1,8 +1,28 @@
 package layout
 
-import "errors"
+import (
+	"errors"
+	"io"
+
+	"github.com/buildpacks/imgutil"
+)
 
 func (i *Image) SaveFile() (string, error) {
 	// TODO issue https://github.com/buildpacks/imgutil/issues/170
 	return "", errors.New("not yet implemented")
 }
+
+// SaveTo streams the image to w as an archive of the given format.
+// The image is tagged with its ref name annotation, if any.
+func (i *Image) SaveTo(w io.Writer, format imgutil.ArchiveFormat) error {
+	if !i.preserveDigest {
+		if err := i.SetCreatedAtAndHistory(); err != nil {
+			return err
+		}
+	}
+	refName, err := i.GetAnnotateRefName()
+	if err != nil {
+		return err
+	}
+	return imgutil.WriteArchive(w, i.Image, refName, format)
+}
@@ -49,21 +49,18 @@ func newImageFacadeFrom(original v1.Image, withMediaTypes imgutil.MediaTypes) (v
 		diffIDMap: make(map[v1.Hash]v1.Layer),
 		digestMap: make(map[v1.Hash]v1.Layer),
 	}
+	if len(originalLayers) != len(configFile.RootFS.DiffIDs) || len(originalLayers) != len(manifestFile.Layers) {
+		return nil, fmt.Errorf("image has %d layers, %d diff IDs and %d layer descriptors", len(originalLayers), len(configFile.RootFS.DiffIDs), len(manifestFile.Layers))
+	}
 	for idx, l := range originalLayers {
 		layer, err := newLayerOrFacadeFrom(*configFile, *manifestFile, idx, l)
 		if err != nil {
 			return nil, err
 		}
-		diffID, err := layer.DiffID()
-		if err != nil {
-			return nil, err
-		}
-		facade.diffIDMap[diffID] = layer
-		digest, err := layer.Digest()
-		if err != nil {
-			return nil, err
-		}
-		facade.digestMap[digest] = layer
+		// the diff IDs are taken from the config rather than computed from the layers,
+		// which would require reading them, and is not possible for encrypted layers
+		facade.diffIDMap[configFile.RootFS.DiffIDs[idx]] = layer
+		facade.digestMap[manifestFile.Layers[idx].Digest] = layer
 	}
 
 	return facade, nil
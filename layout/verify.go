@@ -0,0 +1,271 @@
+package layout
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ErrCorruptBlob is returned when a blob read from a layout does not match the digest it is referenced with.
+type ErrCorruptBlob struct {
+	Digest v1.Hash
+	// Actual is the digest of the content that was read.
+	Actual v1.Hash
+}
+
+func (e ErrCorruptBlob) Error() string {
+	return fmt.Sprintf("blob %s is corrupt: its content has digest %s", e.Digest, e.Actual)
+}
+
+// VerifyReport describes the blobs of a layout directory that do not match the digests they are referenced with.
+type VerifyReport struct {
+	Path string
+	// CorruptBlobs are blobs whose content does not match the digest or size recorded in the descriptors that reference them.
+	CorruptBlobs []string
+	// MissingBlobs are blobs referenced by descriptors that are not in the layout, such as the layers of sparse images.
+	MissingBlobs []string
+}
+
+// Corrupt reports whether any corrupt blob was found. Missing blobs are not corruption, as sparse images do not contain layers.
+func (r VerifyReport) Corrupt() bool {
+	return len(r.CorruptBlobs) > 0
+}
+
+// VerifyImage reads every blob referenced by the layout at the given path, from the manifests of index.json to the configs
+// and layers of its images, and checks it against the digest and size it is referenced with.
+// The descriptors in corrupt manifests and indexes are not followed. It does not modify the layout.
+func VerifyImage(path string) (VerifyReport, error) {
+	report := VerifyReport{Path: path}
+	index, err := readDescriptorIndex(filepath.Join(path, "index.json"))
+	if err != nil {
+		return report, fmt.Errorf("failed to read index: %w", err)
+	}
+	visited := map[v1.Hash]bool{}
+	for _, desc := range index.Manifests {
+		if err = verifyDescriptor(path, desc, &report, visited); err != nil {
+			return report, err
+		}
+	}
+	sort.Strings(report.CorruptBlobs)
+	sort.Strings(report.MissingBlobs)
+	return report, nil
+}
+
+// verifyDescriptor checks the blob for the descriptor, and recurses into the manifests referenced by indexes
+// and the config and layers referenced by image manifests.
+func verifyDescriptor(path string, desc v1.Descriptor, report *VerifyReport, visited map[v1.Hash]bool) error {
+	if visited[desc.Digest] {
+		return nil
+	}
+	visited[desc.Digest] = true
+
+	blob := filepath.Join(path, "blobs", desc.Digest.Algorithm, desc.Digest.Hex)
+	err := verifyBlob(blob, desc)
+	var corrupt ErrCorruptBlob
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		report.MissingBlobs = append(report.MissingBlobs, blob)
+		return nil
+	case errors.As(err, &corrupt):
+		report.CorruptBlobs = append(report.CorruptBlobs, blob)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	switch {
+	case desc.MediaType.IsIndex():
+		index, err := readDescriptorIndex(blob)
+		if err != nil {
+			return err
+		}
+		for _, child := range index.Manifests {
+			if err = verifyDescriptor(path, child, report, visited); err != nil {
+				return err
+			}
+		}
+	case desc.MediaType.IsImage():
+		contents, err := os.ReadFile(filepath.Clean(blob))
+		if err != nil {
+			return err
+		}
+		var manifest v1.Manifest
+		if err = json.Unmarshal(contents, &manifest); err != nil {
+			return fmt.Errorf("failed to parse manifest %s: %w", desc.Digest, err)
+		}
+		for _, child := range append([]v1.Descriptor{manifest.Config}, manifest.Layers...) {
+			if err = verifyDescriptor(path, child, report, visited); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func verifyBlob(blob string, desc v1.Descriptor) error {
+	f, err := os.Open(filepath.Clean(blob))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader, err := newVerifyingReader(f, desc.Digest, desc.Size)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// verifyingReader fails with an ErrCorruptBlob at the end of a blob whose content does not match its digest and size.
+type verifyingReader struct {
+	io.ReadCloser
+	hasher   hash.Hash
+	expected v1.Hash
+	// size is the expected size of the blob, or -1 if it is not known
+	size int64
+	read int64
+}
+
+func newVerifyingReader(rc io.ReadCloser, expected v1.Hash, size int64) (*verifyingReader, error) {
+	hasher, err := v1.Hasher(expected.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{ReadCloser: rc, hasher: hasher, expected: expected, size: size}, nil
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.hasher.Write(p[:n])
+	r.read += int64(n)
+	if errors.Is(err, io.EOF) {
+		actual := v1.Hash{Algorithm: r.expected.Algorithm, Hex: hex.EncodeToString(r.hasher.Sum(nil))}
+		if actual != r.expected || (r.size >= 0 && r.read != r.size) {
+			return n, ErrCorruptBlob{Digest: r.expected, Actual: actual}
+		}
+	}
+	return n, err
+}
+
+// verifiedImage is an image read from a layout whose layers are checked against their digests and diff IDs as they are read.
+type verifiedImage struct {
+	v1.Image
+}
+
+// imageIndex is embedded instead of v1.ImageIndex, as a field named ImageIndex would hide the ImageIndex method.
+type imageIndex = v1.ImageIndex
+
+// verifiedIndex is an index read from a layout whose images are checked against their digests.
+type verifiedIndex struct {
+	imageIndex
+}
+
+// Image returns the image with the given digest, once its manifest and config are checked against their digests,
+// with its layers checked as they are read.
+func (i *verifiedIndex) Image(digest v1.Hash) (v1.Image, error) {
+	image, err := i.imageIndex.Image(digest)
+	if err != nil {
+		return nil, err
+	}
+	rawManifest, err := image.RawManifest()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkDigest(rawManifest, digest); err != nil {
+		return nil, err
+	}
+	manifest, err := image.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	rawConfig, err := image.RawConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	if err = checkDigest(rawConfig, manifest.Config.Digest); err != nil {
+		return nil, err
+	}
+	return &verifiedImage{Image: image}, nil
+}
+
+func checkDigest(contents []byte, expected v1.Hash) error {
+	actual, _, err := v1.SHA256(bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+	if actual != expected {
+		return ErrCorruptBlob{Digest: expected, Actual: actual}
+	}
+	return nil
+}
+
+func (i *verifiedImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	verified := make([]v1.Layer, len(layers))
+	for idx, layer := range layers {
+		verified[idx] = &verifiedLayer{Layer: layer}
+	}
+	return verified, nil
+}
+
+func (i *verifiedImage) LayerByDigest(digest v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	return &verifiedLayer{Layer: layer}, nil
+}
+
+func (i *verifiedImage) LayerByDiffID(diffID v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDiffID(diffID)
+	if err != nil {
+		return nil, err
+	}
+	return &verifiedLayer{Layer: layer}, nil
+}
+
+// verifiedLayer checks the compressed content of the layer against its digest and size,
+// and the uncompressed content against its diff ID, when they are read to the end.
+type verifiedLayer struct {
+	v1.Layer
+}
+
+func (l *verifiedLayer) Compressed() (io.ReadCloser, error) {
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		return nil, err
+	}
+	size, err := l.Layer.Size()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	return newVerifyingReader(rc, digest, size)
+}
+
+func (l *verifiedLayer) Uncompressed() (io.ReadCloser, error) {
+	diffID, err := l.Layer.DiffID()
+	if err != nil {
+		return nil, err
+	}
+	rc, err := l.Layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	return newVerifyingReader(rc, diffID, -1)
+}
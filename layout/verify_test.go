@@ -0,0 +1,120 @@
+package layout_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestVerify(t *testing.T) {
+	spec.Run(t, "Verify", testVerify, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testVerify(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir     string
+		imagePath  string
+		layerBlob  string
+		configBlob string
+		err        error
+	)
+
+	it.Before(func() {
+		tmpDir, err = os.MkdirTemp("", "layout-verify-test")
+		h.AssertNil(t, err)
+		imagePath = filepath.Join(tmpDir, "image")
+
+		image, err := layout.NewImage(imagePath)
+		h.AssertNil(t, err)
+		path, _, _ := h.RandomLayer(t, tmpDir)
+		h.AssertNil(t, image.AddLayer(path))
+		h.AssertNil(t, image.Save())
+
+		manifest, err := image.Manifest()
+		h.AssertNil(t, err)
+		layerBlob = filepath.Join(imagePath, "blobs", "sha256", manifest.Layers[0].Digest.Hex)
+		configBlob = filepath.Join(imagePath, "blobs", "sha256", manifest.Config.Digest.Hex)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	// corrupt changes the first byte of the blob, keeping its size.
+	corrupt := func(blob string) {
+		contents, err := os.ReadFile(blob)
+		h.AssertNil(t, err)
+		contents[0] ^= 0xff
+		h.AssertNil(t, os.WriteFile(blob, contents, 0600))
+	}
+
+	when("the layout is intact", func() {
+		it("reports nothing", func() {
+			report, err := layout.VerifyImage(imagePath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, report.Corrupt(), false)
+			h.AssertEq(t, len(report.MissingBlobs), 0)
+		})
+
+		it("reads the base image", func() {
+			image, err := layout.NewImage(filepath.Join(tmpDir, "other"), layout.FromBaseImagePath(imagePath), layout.WithVerifyBlobs())
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.Save())
+		})
+	})
+
+	when("a layer is corrupt", func() {
+		it.Before(func() {
+			corrupt(layerBlob)
+		})
+
+		it("reports it", func() {
+			report, err := layout.VerifyImage(imagePath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, report.Corrupt(), true)
+			h.AssertEq(t, report.CorruptBlobs, []string{layerBlob})
+		})
+
+		it("fails to save an image built on it", func() {
+			image, err := layout.NewImage(filepath.Join(tmpDir, "other"), layout.FromBaseImagePath(imagePath), layout.WithVerifyBlobs())
+			h.AssertNil(t, err)
+			err = image.Save()
+			var saveErr imgutil.SaveError
+			h.AssertEq(t, errors.As(err, &saveErr), true)
+			var corruptBlob layout.ErrCorruptBlob
+			h.AssertEq(t, errors.As(saveErr.Errors[0].Cause, &corruptBlob), true)
+			h.AssertEq(t, corruptBlob.Digest.Hex, filepath.Base(layerBlob))
+		})
+	})
+
+	when("the config is corrupt", func() {
+		it.Before(func() {
+			corrupt(configBlob)
+		})
+
+		it("fails to open the base image", func() {
+			_, err := layout.NewImage(filepath.Join(tmpDir, "other"), layout.FromBaseImagePath(imagePath), layout.WithVerifyBlobs())
+			var corruptBlob layout.ErrCorruptBlob
+			h.AssertEq(t, errors.As(err, &corruptBlob), true)
+		})
+	})
+
+	when("a layer is missing", func() {
+		it("reports it without reporting corruption", func() {
+			h.AssertNil(t, os.Remove(layerBlob))
+
+			report, err := layout.VerifyImage(imagePath)
+			h.AssertNil(t, err)
+			h.AssertEq(t, report.Corrupt(), false)
+			h.AssertEq(t, report.MissingBlobs, []string{layerBlob})
+		})
+	})
+}
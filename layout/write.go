@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 
 	"github.com/google/go-containerregistry/pkg/logs"
 	"github.com/google/go-containerregistry/pkg/v1/stream"
@@ -21,6 +22,7 @@ type AppendOption func(*appendOptions)
 type appendOptions struct {
 	withoutLayers bool
 	annotations   map[string]string
+	sync          bool
 }
 
 func WithoutLayers() AppendOption {
@@ -35,6 +37,14 @@ func WithAnnotations(annotations map[string]string) AppendOption {
 	}
 }
 
+// WithSync causes the blobs of the image, `index.json`, and their parent directories to be flushed to stable storage
+// once the image is appended, so that the layout is not left corrupted if the machine loses power.
+func WithSync() AppendOption {
+	return func(i *appendOptions) {
+		i.sync = true
+	}
+}
+
 // AppendImage mimics GGCR's AppendImage in that it appends an image to a `layout.Path`,
 // but the image appended does not include any layers in the `blobs` directory.
 // The returned image will return layers when Layers(), LayerByDiffID(), or LayerByDigest() are called,
@@ -50,10 +60,80 @@ func (l Path) AppendImage(img v1.Image, ops ...AppendOption) error {
 		annotations = o.annotations
 	}
 
+	var err error
 	if o.withoutLayers {
-		return l.writeImageWithoutLayers(img, annotations)
+		err = l.writeImageWithoutLayers(img, annotations)
+	} else {
+		err = l.appendImage(img, annotations)
+	}
+	if err != nil || !o.sync {
+		return err
+	}
+	return l.syncImage(img, !o.withoutLayers)
+}
+
+// syncImage flushes the files written for the image, and the directories containing them, to stable storage.
+func (l Path) syncImage(img v1.Image, withLayers bool) error {
+	var digests []v1.Hash
+	if withLayers {
+		layers, err := img.Layers()
+		if err != nil {
+			return err
+		}
+		for _, layer := range layers {
+			d, err := layer.Digest()
+			if err != nil {
+				return err
+			}
+			digests = append(digests, d)
+		}
+	}
+	cfgName, err := img.ConfigName()
+	if err != nil {
+		return err
+	}
+	d, err := img.Digest()
+	if err != nil {
+		return err
+	}
+	digests = append(digests, cfgName, d)
+
+	var toSync []string
+	for _, digest := range digests {
+		toSync = append(toSync, l.append("blobs", digest.Algorithm, digest.Hex))
+	}
+	toSync = append(toSync, l.append("index.json"), l.append("oci-layout"))
+	for _, path := range toSync {
+		if err := syncFile(path, false); err != nil {
+			return err
+		}
+	}
+	for _, dir := range []string{l.append("blobs", d.Algorithm), l.append("blobs"), l.append()} {
+		if err := syncFile(dir, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func syncFile(path string, isDir bool) error {
+	if isDir && runtime.GOOS == "windows" {
+		// directories cannot be flushed on Windows, where metadata updates are journaled by the file system
+		return nil
+	}
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// sparse images have no layer blobs
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	if err = f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", path, err)
 	}
-	return l.appendImage(img, annotations)
+	return f.Close()
 }
 
 // writeImageWithoutLayers is the same implementation of ggcr layout writeImage method, removing the writeLayer code
@@ -0,0 +1,22 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// CheckAccess verifies that images can be pulled from and/or pushed to the daemon, by connecting to it.
+// The daemon does not restrict access to individual images, so the image name is only used to report errors.
+// It returns an imgutil.ErrAccessDenied if the daemon socket cannot be accessed.
+func CheckAccess(repoName string, dockerClient DockerClient, scope imgutil.AccessScope) error {
+	if _, err := dockerClient.ServerVersion(context.Background()); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return imgutil.ErrAccessDenied{Ref: repoName, Scope: scope, Cause: err}
+		}
+		return err
+	}
+	return nil
+}
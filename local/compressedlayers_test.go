@@ -0,0 +1,112 @@
+package local_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/system"
+	"github.com/google/go-containerregistry/pkg/compression"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestCompressedLayers(t *testing.T) {
+	spec.Run(t, "CompressedLayers", testCompressedLayers, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// apiVersionClient is a DockerClient that reports the given API version and whether it uses the containerd image store.
+type apiVersionClient struct {
+	local.DockerClient
+	apiVersion string
+	containerd bool
+}
+
+func (c apiVersionClient) ServerVersion(context.Context) (types.Version, error) {
+	return types.Version{Os: "linux", Arch: "amd64", APIVersion: c.apiVersion}, nil
+}
+
+func (c apiVersionClient) Info(context.Context) (system.Info, error) {
+	if c.containerd {
+		return system.Info{DriverStatus: [][2]string{{"driver-type", "io.containerd.snapshotter.v1"}}}, nil
+	}
+	return system.Info{}, nil
+}
+
+func testCompressedLayers(t *testing.T, when spec.G, it spec.S) {
+	var layerPath, zstdLayerPath string
+
+	it.Before(func() {
+		var err error
+		layerPath, err = h.CreateSingleFileLayerTar("/foo", "foo", "linux")
+		h.AssertNil(t, err)
+		zstdLayerPath, err = h.CreateSingleFileLayerTar("/bar", "bar", "linux")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.Remove(layerPath))
+		h.AssertNil(t, os.Remove(zstdLayerPath))
+	})
+
+	// layerEntries returns the names of the layer entries of the tar saved for an image with a gzip and a zstd layer.
+	layerEntries := func(dockerClient local.DockerClient) []string {
+		img, err := local.NewImage("some-image", dockerClient, local.WithCompressedLayers(), imgutil.WithTempDir(t.TempDir()))
+		h.AssertNil(t, err)
+		h.AssertNil(t, img.AddLayer(layerPath))
+		zstdLayer, err := tarball.LayerFromFile(zstdLayerPath, tarball.WithCompression(compression.ZStd), tarball.WithMediaType(v1types.OCILayerZStd))
+		h.AssertNil(t, err)
+		h.AssertNil(t, img.AddLayerWithHistory(zstdLayer, v1.History{}))
+
+		path, err := img.SaveFile()
+		h.AssertNil(t, err)
+		defer os.Remove(path)
+		f, err := os.Open(filepath.Clean(path))
+		h.AssertNil(t, err)
+		defer f.Close()
+		var names []string
+		tr := tar.NewReader(f)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			h.AssertNil(t, err)
+			if strings.HasPrefix(hdr.Name, "/sha256:") {
+				names = append(names, filepath.Ext(hdr.Name))
+			}
+		}
+		return names
+	}
+
+	it("names zstd layers with their extension for daemons that load them", func() {
+		h.AssertEq(t, layerEntries(apiVersionClient{apiVersion: "1.43"}), []string{".gz", ".zst"})
+		h.AssertEq(t, layerEntries(apiVersionClient{apiVersion: "1.41", containerd: true}), []string{".gz", ".zst"})
+	})
+
+	it("sends zstd layers uncompressed to daemons that do not load them", func() {
+		h.AssertEq(t, layerEntries(apiVersionClient{apiVersion: "1.41"}), []string{".gz", ".tar"})
+	})
+
+	it("sends all layers uncompressed to daemons that do not load compressed layers", func() {
+		h.AssertEq(t, layerEntries(apiVersionClient{apiVersion: "1.21"}), []string{".tar", ".tar"})
+
+		_, err := local.NewImage("some-image", apiVersionClient{apiVersion: "1.21"}, local.WithCompressedLayers(), imgutil.WithStrictCapabilities())
+		var warnings imgutil.ErrCapabilityWarnings
+		h.AssertEq(t, errors.As(err, &warnings), true)
+		h.AssertError(t, err, "CompressedLayers")
+	})
+}
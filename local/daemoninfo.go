@@ -0,0 +1,62 @@
+package local
+
+import (
+	"context"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/system"
+)
+
+// CachingClient is a DockerClient that asks the daemon for its info and version once, and answers later calls with
+// the results, so that the many images of a batch workload saved with the same client do not each ask the daemon
+// whether it uses the containerd image store, is podman or runs on a given platform. Errors are not cached.
+// It is safe for concurrent use.
+type CachingClient struct {
+	DockerClient
+	mu      sync.Mutex
+	info    *system.Info
+	version *types.Version
+}
+
+// NewCachingClient returns a CachingClient for the provided client.
+func NewCachingClient(dockerClient DockerClient) *CachingClient {
+	return &CachingClient{DockerClient: dockerClient}
+}
+
+// SetDaemonInfo sets the info and version that the client answers with, e.g. ones fetched once by the caller,
+// so that the daemon is not asked for them at all.
+func (c *CachingClient) SetDaemonInfo(info system.Info, version types.Version) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info = &info
+	c.version = &version
+}
+
+func (c *CachingClient) Info(ctx context.Context) (system.Info, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.info != nil {
+		return *c.info, nil
+	}
+	info, err := c.DockerClient.Info(ctx)
+	if err != nil {
+		return system.Info{}, err
+	}
+	c.info = &info
+	return info, nil
+}
+
+func (c *CachingClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.version != nil {
+		return *c.version, nil
+	}
+	version, err := c.DockerClient.ServerVersion(ctx)
+	if err != nil {
+		return types.Version{}, err
+	}
+	c.version = &version
+	return version, nil
+}
@@ -0,0 +1,88 @@
+package local_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/system"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestDaemonInfo(t *testing.T) {
+	spec.Run(t, "DaemonInfo", testDaemonInfo, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// infoCountingClient is a DockerClient that counts the calls for its info and version, failing while err is set.
+type infoCountingClient struct {
+	local.DockerClient
+	infoCalls    int
+	versionCalls int
+	err          error
+}
+
+func (c *infoCountingClient) Info(context.Context) (system.Info, error) {
+	c.infoCalls++
+	if c.err != nil {
+		return system.Info{}, c.err
+	}
+	return system.Info{DriverStatus: [][2]string{{"driver-type", "io.containerd.snapshotter.v1"}}}, nil
+}
+
+func (c *infoCountingClient) ServerVersion(context.Context) (types.Version, error) {
+	c.versionCalls++
+	if c.err != nil {
+		return types.Version{}, c.err
+	}
+	return types.Version{Os: "linux", Arch: "amd64"}, nil
+}
+
+func testDaemonInfo(t *testing.T, when spec.G, it spec.S) {
+	when("#CachingClient", func() {
+		it("asks the daemon once for images created with the same client", func() {
+			inner := &infoCountingClient{}
+			dockerClient := local.NewCachingClient(inner)
+			for _, name := range []string{"some/image", "other/image"} {
+				image, err := local.NewImage(name, dockerClient, local.WithOCILoadFormat())
+				h.AssertNil(t, err)
+				h.AssertNil(t, image.Cleanup())
+			}
+			h.AssertEq(t, inner.versionCalls, 1)
+			h.AssertEq(t, inner.infoCalls, 1)
+		})
+
+		it("does not ask the daemon for the info it is given", func() {
+			inner := &infoCountingClient{}
+			dockerClient := local.NewCachingClient(inner)
+			dockerClient.SetDaemonInfo(system.Info{}, types.Version{Os: "linux", Arch: "arm64"})
+
+			image, err := local.NewImage("some/image", dockerClient)
+			h.AssertNil(t, err)
+			arch, err := image.Architecture()
+			h.AssertNil(t, err)
+			h.AssertEq(t, arch, "arm64")
+			h.AssertEq(t, inner.versionCalls, 0)
+			h.AssertEq(t, inner.infoCalls, 0)
+		})
+
+		it("does not cache errors", func() {
+			inner := &infoCountingClient{err: errors.New("some-error")}
+			dockerClient := local.NewCachingClient(inner)
+			_, err := dockerClient.ServerVersion(context.Background())
+			h.AssertError(t, err, "some-error")
+
+			inner.err = nil
+			version, err := dockerClient.ServerVersion(context.Background())
+			h.AssertNil(t, err)
+			h.AssertEq(t, version.Os, "linux")
+			_, err = dockerClient.ServerVersion(context.Background())
+			h.AssertNil(t, err)
+			h.AssertEq(t, inner.versionCalls, 2)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package local_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestDockerHost(t *testing.T) {
+	spec.Run(t, "DockerHost", testDockerHost, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testDockerHost(t *testing.T, when spec.G, it spec.S) {
+	when("#NewDockerClient", func() {
+		it("reaches ssh hosts through the docker CLI of the host", func() {
+			dockerClient, err := local.NewDockerClient("ssh://user@build-machine")
+			h.AssertNil(t, err)
+			defer dockerClient.Close()
+			h.AssertEq(t, dockerClient.DaemonHost(), "http://docker.example.com")
+		})
+
+		it("uses other hosts as they are", func() {
+			dockerClient, err := local.NewDockerClient("tcp://build-machine:2375")
+			h.AssertNil(t, err)
+			defer dockerClient.Close()
+			h.AssertEq(t, dockerClient.DaemonHost(), "tcp://build-machine:2375")
+		})
+	})
+
+	when("#WithDockerHost", func() {
+		it("uses a client for the daemon at the host", func() {
+			var requests atomic.Int64
+			daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Api-Version", "1.41")
+				if strings.HasSuffix(req.URL.Path, "/version") {
+					h.AssertNil(t, json.NewEncoder(w).Encode(types.Version{Os: "linux", Arch: "arm64"}))
+				}
+			}))
+			defer daemon.Close()
+
+			image, err := local.NewImage("some-image", nil, local.WithDockerHost("tcp://"+strings.TrimPrefix(daemon.URL, "http://")))
+			h.AssertNil(t, err)
+			defer image.Cleanup()
+			h.AssertEq(t, requests.Load() > 0, true)
+			arch, err := image.Architecture()
+			h.AssertNil(t, err)
+			h.AssertEq(t, arch, "arm64")
+		})
+	})
+}
@@ -0,0 +1,250 @@
+package local_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/errdefs"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestDownload(t *testing.T) {
+	spec.Run(t, "Download", testDownload, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// savingClient is a DockerClient whose daemon holds the given images by ID, and counts the images saved from it.
+type savingClient struct {
+	local.DockerClient
+	images map[string]v1.Image
+	saved  []string
+}
+
+func (c *savingClient) ServerVersion(context.Context) (types.Version, error) {
+	return types.Version{Os: "linux", Arch: "amd64"}, nil
+}
+
+func (c *savingClient) ImageInspectWithRaw(_ context.Context, ref string) (types.ImageInspect, []byte, error) {
+	img, ok := c.images[ref]
+	if !ok {
+		return types.ImageInspect{}, nil, errdefs.NotFound(errors.New("no such image: " + ref))
+	}
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return types.ImageInspect{}, nil, err
+	}
+	inspect := types.ImageInspect{ID: ref, Os: "linux", Architecture: "amd64", RootFS: types.RootFS{Type: "layers"}}
+	for _, diffID := range configFile.RootFS.DiffIDs {
+		inspect.RootFS.Layers = append(inspect.RootFS.Layers, diffID.String())
+	}
+	return inspect, nil, nil
+}
+
+func (c *savingClient) ImageHistory(context.Context, string) ([]image.HistoryResponseItem, error) {
+	return nil, nil
+}
+
+func (c *savingClient) ImageSave(_ context.Context, refs []string) (io.ReadCloser, error) {
+	c.saved = append(c.saved, refs...)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(tarball.Write(name.MustParseReference("some-image"), c.images[refs[0]], pw))
+	}()
+	return pr, nil
+}
+
+func testDownload(t *testing.T, when spec.G, it spec.S) {
+	var (
+		dockerClient *savingClient
+		baseID       string
+		previousID   string
+		appLayer     v1.Layer
+		tmpDir       string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "download-test")
+		h.AssertNil(t, err)
+
+		baseImage, err := random.Image(100, 2)
+		h.AssertNil(t, err)
+		appLayer, err = random.Layer(100, v1types.DockerLayer)
+		h.AssertNil(t, err)
+		previousImage, err := mutate.AppendLayers(baseImage, appLayer)
+		h.AssertNil(t, err)
+
+		baseDigest, err := baseImage.ConfigName()
+		h.AssertNil(t, err)
+		previousDigest, err := previousImage.ConfigName()
+		h.AssertNil(t, err)
+		baseID, previousID = baseDigest.String(), previousDigest.String()
+		dockerClient = &savingClient{images: map[string]v1.Image{baseID: baseImage, previousID: previousImage}}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("does not download the base image when the previous image has its layers", func() {
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(baseID), local.WithPreviousImage(previousID), imgutil.WithTempDir(tmpDir))
+		h.AssertNil(t, err)
+		appDiffID, err := appLayer.DiffID()
+		h.AssertNil(t, err)
+		h.AssertNil(t, img.ReuseLayer(appDiffID.String()))
+
+		_, err = img.SaveFile()
+		h.AssertNil(t, err)
+		h.AssertEq(t, dockerClient.saved, []string{previousID})
+	})
+
+	it("downloads the image once for several layers", func() {
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(baseID), imgutil.WithTempDir(tmpDir))
+		h.AssertNil(t, err)
+		layers, err := img.Layers()
+		h.AssertNil(t, err)
+		for _, layer := range layers {
+			diffID, err := layer.DiffID()
+			h.AssertNil(t, err)
+			rc, err := img.GetLayer(diffID.String())
+			h.AssertNil(t, err)
+			h.AssertNil(t, rc.Close())
+		}
+		h.AssertEq(t, dockerClient.saved, []string{baseID})
+	})
+
+	it("downloads the base layers to report the manifest and sizes", func() {
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(baseID), imgutil.WithTempDir(tmpDir))
+		h.AssertNil(t, err)
+
+		manifest, err := img.Manifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(manifest.Layers), 2)
+		for _, layer := range manifest.Layers {
+			h.AssertEq(t, layer.Size > 0, true)
+			h.AssertEq(t, layer.Digest == v1.Hash{}, false)
+		}
+		sizes, err := img.LayerSizes()
+		h.AssertNil(t, err)
+		h.AssertEq(t, sizes, []int64{manifest.Layers[0].Size, manifest.Layers[1].Size})
+		total, err := img.TotalSize()
+		h.AssertNil(t, err)
+		h.AssertEq(t, total > manifest.Config.Size+sizes[0]+sizes[1], true)
+		h.AssertEq(t, dockerClient.saved, []string{baseID})
+	})
+
+	it("downloads the base layers to inspect the image", func() {
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(baseID), imgutil.WithTempDir(tmpDir))
+		h.AssertNil(t, err)
+
+		out, err := img.Inspect()
+		h.AssertNil(t, err)
+		var inspection imgutil.ImageInspection
+		h.AssertNil(t, json.Unmarshal([]byte(out), &inspection))
+		manifest, err := img.Manifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(inspection.Manifest.Layers), 2)
+		h.AssertEq(t, inspection.Manifest.Layers[0].Digest, manifest.Layers[0].Digest)
+		h.AssertEq(t, inspection.Manifest.Layers[1].Digest, manifest.Layers[1].Digest)
+		h.AssertEq(t, inspection.Platform, &v1.Platform{OS: "linux", Architecture: "amd64"})
+		h.AssertEq(t, len(inspection.Config.RootFS.DiffIDs), 2)
+		h.AssertEq(t, dockerClient.saved, []string{baseID})
+	})
+
+	it("does not download the image to get an added layer", func() {
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(baseID), imgutil.WithTempDir(tmpDir))
+		h.AssertNil(t, err)
+		layerPath := filepath.Join(tmpDir, "some-layer.tar")
+		rc, err := appLayer.Uncompressed()
+		h.AssertNil(t, err)
+		contents, err := io.ReadAll(rc)
+		h.AssertNil(t, err)
+		h.AssertNil(t, os.WriteFile(layerPath, contents, 0600))
+		h.AssertNil(t, img.AddLayer(layerPath))
+
+		appDiffID, err := appLayer.DiffID()
+		h.AssertNil(t, err)
+		rc, err = img.GetLayer(appDiffID.String())
+		h.AssertNil(t, err)
+		h.AssertNil(t, rc.Close())
+		h.AssertEq(t, len(dockerClient.saved), 0)
+	})
+
+	when("#WithLayerCache", func() {
+		readLayers := func(img *local.Image) {
+			layers, err := img.Layers()
+			h.AssertNil(t, err)
+			for _, layer := range layers {
+				diffID, err := layer.DiffID()
+				h.AssertNil(t, err)
+				rc, err := img.GetLayer(diffID.String())
+				h.AssertNil(t, err)
+				h.AssertNil(t, rc.Close())
+			}
+		}
+
+		it("reads the layers extracted for a previous image from the cache", func() {
+			cacheDir := filepath.Join(tmpDir, "cache")
+			img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(previousID), local.WithLayerCache(cacheDir, 0))
+			h.AssertNil(t, err)
+			readLayers(img)
+			h.AssertNil(t, img.Cleanup())
+
+			img, err = local.NewImage("other-image", dockerClient, local.FromBaseImage(baseID), local.WithPreviousImage(previousID), local.WithLayerCache(cacheDir, 0))
+			h.AssertNil(t, err)
+			readLayers(img)
+			appDiffID, err := appLayer.DiffID()
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.ReuseLayer(appDiffID.String()))
+			_, err = img.SaveFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, dockerClient.saved, []string{previousID})
+		})
+
+		it("keeps reading the cached layers after they are evicted", func() {
+			cacheDir := filepath.Join(tmpDir, "cache")
+			img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(previousID), local.WithLayerCache(cacheDir, 0))
+			h.AssertNil(t, err)
+			readLayers(img)
+			h.AssertNil(t, img.Cleanup())
+
+			img, err = local.NewImage("other-image", dockerClient, local.FromBaseImage(previousID), local.WithLayerCache(cacheDir, 0), imgutil.WithTempDir(tmpDir))
+			h.AssertNil(t, err)
+			readLayers(img)
+			h.AssertEq(t, dockerClient.saved, []string{previousID})
+
+			h.AssertNil(t, os.RemoveAll(filepath.Join(cacheDir, "layers")))
+			_, err = img.SaveFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, dockerClient.saved, []string{previousID})
+		})
+
+		it("evicts the least recently used layers beyond the maximum size", func() {
+			cacheDir := filepath.Join(tmpDir, "cache")
+			img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(previousID), local.WithLayerCache(cacheDir, 1))
+			h.AssertNil(t, err)
+			readLayers(img)
+
+			entries, err := os.ReadDir(filepath.Join(cacheDir, "layers"))
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(entries), 0)
+		})
+	})
+}
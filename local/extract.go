@@ -0,0 +1,34 @@
+package local
+
+import (
+	"context"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+
+	"github.com/buildpacks/imgutil"
+)
+
+var _ imgutil.ExtractDestination = (*ExtractDestination)(nil)
+
+// ExtractDestination loads an extracted image into a docker daemon.
+// The daemon does not store manifests, so only the image ID (the config digest) is preserved.
+type ExtractDestination struct {
+	repoName string
+	store    *Store
+}
+
+// NewExtractDestination returns an imgutil.ExtractDestination that loads the image into the daemon as `repoName`.
+func NewExtractDestination(repoName string, dockerClient DockerClient) *ExtractDestination {
+	return &ExtractDestination{
+		repoName: tryNormalizing(repoName),
+		store:    NewStore(dockerClient),
+	}
+}
+
+func (d *ExtractDestination) WriteImage(image v1.Image) error {
+	inspect, err := d.store.doSave(image, d.repoName)
+	if err != nil {
+		return err
+	}
+	return d.store.dockerClient.ImageTag(context.Background(), inspect.ID, d.repoName)
+}
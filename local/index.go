@@ -0,0 +1,166 @@
+package local
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/buildpacks/imgutil"
+)
+
+var _ imgutil.ImageIndex = (*ImageIndex)(nil)
+
+// ImageIndex is an image index that lives in the local XDG store, alongside a docker daemon.
+// Only a daemon using the containerd image store can store an index, so:
+//   - the index itself is read from and saved to the XDG store (see SaveDir, DeleteDir, Inspect);
+//   - images already in the daemon can be added to the index as children (see AddDaemonImage);
+//   - children of the index can be pulled through into the daemon as standalone images (see LoadImage);
+//   - the index is stored in the daemon when it uses the containerd image store (see SaveToDaemon),
+//     and is otherwise published by pushing it to a registry (see Push);
+//   - operations the daemon cannot represent return an imgutil.ErrUnsupported.
+type ImageIndex struct {
+	*imgutil.CNBIndex
+	dockerClient DockerClient
+	tempFiles    *imgutil.TempFiles
+}
+
+// NewIndex returns a new ImageIndex backed by the XDG store that can load its children into the daemon.
+// Unless a media type is requested, new indexes use Docker media types.
+// When FromBaseIndex is provided, the index is read from the XDG store using that name.
+func NewIndex(repoName string, dockerClient DockerClient, ops ...imgutil.IndexOption) (*ImageIndex, error) {
+	options := &imgutil.IndexOptions{}
+	for _, op := range ops {
+		if err := op(options); err != nil {
+			return nil, err
+		}
+	}
+	if options.MediaType == "" {
+		options.MediaType = types.DockerManifestList
+	}
+
+	var err error
+
+	if options.BaseIndex == nil && options.BaseIndexRepoName != "" { // options.BaseIndex supersedes options.BaseIndexRepoName
+		options.BaseIndex, err = newV1Index(imgutil.StorePath(options.XdgPath, options.BaseIndexRepoName))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cnbIndex, err := imgutil.NewCNBIndex(repoName, *options)
+	if err != nil {
+		return nil, err
+	}
+	return &ImageIndex{
+		CNBIndex:     cnbIndex,
+		dockerClient: dockerClient,
+		tempFiles:    imgutil.NewTempFiles("", false),
+	}, nil
+}
+
+// newV1Index reads an image index from the XDG store, returning nothing if it does not exist.
+func newV1Index(path string) (v1.ImageIndex, error) {
+	if _, err := os.Stat(filepath.Join(path, "index.json")); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	layoutPath, err := layout.FromPath(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load layout from path: %w", err)
+	}
+	return layoutPath.ImageIndex()
+}
+
+// LoadImage pulls the child image with the given digest through into the daemon, tagged as `repoName`.
+// The child is read from wherever the index is backed (the XDG store or the registry it was created from).
+func (h *ImageIndex) LoadImage(digest name.Digest, repoName string) error {
+	hash, err := v1.NewHash(digest.Identifier())
+	if err != nil {
+		return err
+	}
+	image, err := h.Image(hash)
+	if err != nil {
+		return err
+	}
+	return NewExtractDestination(repoName, h.dockerClient).WriteImage(image)
+}
+
+// AddDaemonImage adds the image in the daemon with the given identifier, usually its image ID, to the index.
+// The image is exported from the daemon and staged on disk until Cleanup is called,
+// so that the index can be saved without a round trip through a registry.
+func (h *ImageIndex) AddDaemonImage(identifier string) error {
+	stagingDir, err := h.tempFiles.MkdirTemp("imgutil.local.index.")
+	if err != nil {
+		return fmt.Errorf("creating staging directory: %w", err)
+	}
+	rc, err := h.dockerClient.ImageSave(context.Background(), []string{identifier})
+	if err != nil {
+		_ = h.tempFiles.Discard(stagingDir)
+		return fmt.Errorf("saving image %q from daemon: %w", identifier, err)
+	}
+	defer rc.Close()
+	image, err := imgutil.ReadArchive(rc, stagingDir)
+	if err != nil {
+		_ = h.tempFiles.Discard(stagingDir)
+		return fmt.Errorf("reading image %q from daemon: %w", identifier, err)
+	}
+	h.AddManifest(image)
+	return nil
+}
+
+// SaveToDaemon stores the index, with all of its children, in the daemon as `repoName`.
+// It returns an imgutil.ErrUnsupported unless the daemon uses the containerd image store,
+// as other daemons cannot store image indexes; use SaveDir to persist the index to the XDG store,
+// or Push to publish it to a registry.
+func (h *ImageIndex) SaveToDaemon() error {
+	if !usesContainerdStorage(h.dockerClient) {
+		return imgutil.ErrUnsupported{
+			Kind:      "local",
+			Operation: "saving an image index",
+			Reason:    "the docker daemon does not use the containerd image store",
+		}
+	}
+	repoName := tryNormalizing(h.RepoName)
+	store := NewStore(h.dockerClient)
+	ctx := context.Background()
+	done := make(chan error, 1)
+
+	// stream the archive to the daemon as it is produced, as when saving an image
+	pr, pw := io.Pipe()
+	go func() {
+		err := store.loadImage(ctx, pr)
+		pr.CloseWithError(err)
+		done <- err
+	}()
+	bw := bufio.NewWriterSize(pw, tarBufferSize)
+	err := imgutil.WriteIndexArchive(bw, h.ImageIndex, repoName)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		pw.CloseWithError(err)
+		<-done
+		return err
+	}
+	pw.Close()
+	if err = <-done; err != nil {
+		return fmt.Errorf("loading index %q. first error: %w", repoName, err)
+	}
+	return nil
+}
+
+// Cleanup removes the files staged for images added with AddDaemonImage.
+// The index must not be saved after Cleanup is called.
+func (h *ImageIndex) Cleanup() error {
+	return h.tempFiles.Cleanup()
+}
@@ -0,0 +1,311 @@
+package local_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/system"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestDaemonIndex(t *testing.T) {
+	spec.Run(t, "DaemonIndex", testDaemonIndex, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// loadingClient is a savingClient that records the archives loaded into it,
+// and reports whether it uses the containerd image store.
+type loadingClient struct {
+	*savingClient
+	containerd bool
+	loaded     [][]byte
+}
+
+func (c *loadingClient) Info(context.Context) (system.Info, error) {
+	info := system.Info{}
+	if c.containerd {
+		info.DriverStatus = [][2]string{{"driver-type", "io.containerd.snapshotter.v1"}}
+	}
+	return info, nil
+}
+
+func (c *loadingClient) ImageLoad(_ context.Context, input io.Reader, _ bool) (types.ImageLoadResponse, error) {
+	contents, err := io.ReadAll(input)
+	if err != nil {
+		return types.ImageLoadResponse{}, err
+	}
+	c.loaded = append(c.loaded, contents)
+	return types.ImageLoadResponse{Body: io.NopCloser(bytes.NewBufferString(`{"stream":"Loaded"}`))}, nil
+}
+
+// taggingClient is a loadingClient that reports every loaded image under the same ID, and records the tags it is asked to create.
+type taggingClient struct {
+	*loadingClient
+	tags map[string]string
+}
+
+func (c *taggingClient) ImageInspectWithRaw(_ context.Context, _ string) (types.ImageInspect, []byte, error) {
+	return types.ImageInspect{ID: "sha256:loaded"}, nil, nil
+}
+
+func (c *taggingClient) ImageTag(_ context.Context, source, target string) error {
+	c.tags[target] = source
+	return nil
+}
+
+func testDaemonIndex(t *testing.T, when spec.G, it spec.S) {
+	var (
+		dockerClient *loadingClient
+		amd64Image   v1.Image
+		arm64Image   v1.Image
+		index        *local.ImageIndex
+		tmpDir       string
+	)
+
+	withPlatform := func(image v1.Image, arch string) v1.Image {
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS = "linux"
+		configFile.Architecture = arch
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		return image
+	}
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "daemon-index")
+		h.AssertNil(t, err)
+
+		image, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		amd64Image = withPlatform(image, "amd64")
+		image, err = random.Image(1024, 1)
+		h.AssertNil(t, err)
+		arm64Image = withPlatform(image, "arm64")
+
+		dockerClient = &loadingClient{
+			savingClient: &savingClient{images: map[string]v1.Image{
+				"sha256:amd64": amd64Image,
+				"sha256:arm64": arm64Image,
+			}},
+		}
+		index, err = local.NewIndex("some-index", dockerClient, imgutil.WithXDGRuntimePath(tmpDir))
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, index.Cleanup())
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#NewIndex", func() {
+		it("uses Docker media types by default", func() {
+			mediaType, err := index.ImageIndex.MediaType()
+			h.AssertNil(t, err)
+			h.AssertEq(t, mediaType, v1types.DockerManifestList)
+		})
+
+		it("uses the requested media type", func() {
+			ociIndex, err := local.NewIndex("some-oci-index", dockerClient,
+				imgutil.WithXDGRuntimePath(tmpDir),
+				imgutil.WithMediaType(v1types.OCIImageIndex),
+			)
+			h.AssertNil(t, err)
+			mediaType, err := ociIndex.ImageIndex.MediaType()
+			h.AssertNil(t, err)
+			h.AssertEq(t, mediaType, v1types.OCIImageIndex)
+		})
+
+		when("#FromBaseIndex", func() {
+			it("reads the index from the XDG store", func() {
+				h.AssertNil(t, index.AddDaemonImage("sha256:amd64"))
+				h.AssertNil(t, index.SaveDir())
+
+				loaded, err := local.NewIndex("other-index", dockerClient,
+					imgutil.WithXDGRuntimePath(tmpDir),
+					imgutil.FromBaseIndex("some-index"),
+				)
+				h.AssertNil(t, err)
+				digest, err := amd64Image.Digest()
+				h.AssertNil(t, err)
+				indexManifest, err := loaded.ImageIndex.IndexManifest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(indexManifest.Manifests), 1)
+				h.AssertEq(t, indexManifest.Manifests[0].Digest, digest)
+			})
+
+			it("reads an index saved under its previous name", func() {
+				legacy, err := local.NewIndex("Some-Index", dockerClient, imgutil.WithXDGRuntimePath(tmpDir))
+				h.AssertNil(t, err)
+				h.AssertNil(t, legacy.AddDaemonImage("sha256:amd64"))
+				h.AssertNil(t, legacy.SaveDir())
+				h.AssertNil(t, legacy.Cleanup())
+				h.AssertNil(t, os.Rename(filepath.Join(tmpDir, imgutil.MakeFileSafeName("Some-Index")), filepath.Join(tmpDir, "Some-Index")))
+
+				loaded, err := local.NewIndex("other-index", dockerClient,
+					imgutil.WithXDGRuntimePath(tmpDir),
+					imgutil.FromBaseIndex("Some-Index"),
+				)
+				h.AssertNil(t, err)
+				indexManifest, err := loaded.ImageIndex.IndexManifest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(indexManifest.Manifests), 1)
+			})
+
+			it("starts from an empty index when none is stored", func() {
+				loaded, err := local.NewIndex("other-index", dockerClient,
+					imgutil.WithXDGRuntimePath(tmpDir),
+					imgutil.FromBaseIndex("missing-index"),
+				)
+				h.AssertNil(t, err)
+				indexManifest, err := loaded.ImageIndex.IndexManifest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(indexManifest.Manifests), 0)
+			})
+		})
+	})
+
+	when("#LoadImage", func() {
+		it("loads the child into the daemon with the given name", func() {
+			h.AssertNil(t, index.AddDaemonImage("sha256:arm64"))
+			client := &taggingClient{loadingClient: dockerClient, tags: map[string]string{}}
+			loader, err := local.NewIndex("some-index", client,
+				imgutil.WithXDGRuntimePath(tmpDir),
+				imgutil.FromBaseIndexInstance(index.ImageIndex),
+			)
+			h.AssertNil(t, err)
+
+			digest, err := arm64Image.Digest()
+			h.AssertNil(t, err)
+			ref, err := name.NewDigest("some-index@" + digest.String())
+			h.AssertNil(t, err)
+			h.AssertNil(t, loader.LoadImage(ref, "some-arm64-image"))
+			h.AssertEq(t, len(dockerClient.loaded), 1)
+			h.AssertEq(t, client.tags["index.docker.io/library/some-arm64-image:latest"], "sha256:loaded")
+		})
+
+		it("fails for a digest that is not in the index", func() {
+			digest, err := arm64Image.Digest()
+			h.AssertNil(t, err)
+			ref, err := name.NewDigest("some-index@" + digest.String())
+			h.AssertNil(t, err)
+			err = index.LoadImage(ref, "some-arm64-image")
+			h.AssertNotNil(t, err)
+			h.AssertEq(t, len(dockerClient.loaded), 0)
+		})
+	})
+
+	when("#AddDaemonImage", func() {
+		it("adds images from the daemon by ID", func() {
+			h.AssertNil(t, index.AddDaemonImage("sha256:amd64"))
+			h.AssertNil(t, index.AddDaemonImage("sha256:arm64"))
+
+			for image, arch := range map[v1.Image]string{amd64Image: "amd64", arm64Image: "arm64"} {
+				digest, err := image.Digest()
+				h.AssertNil(t, err)
+				child, err := index.Image(digest)
+				h.AssertNil(t, err)
+				configFile, err := child.ConfigFile()
+				h.AssertNil(t, err)
+				h.AssertEq(t, configFile.Architecture, arch)
+			}
+			h.AssertEq(t, dockerClient.saved, []string{"sha256:amd64", "sha256:arm64"})
+
+			h.AssertNil(t, index.SaveDir())
+		})
+	})
+
+	when("#SaveToDaemon", func() {
+		it.Before(func() {
+			h.AssertNil(t, index.AddDaemonImage("sha256:amd64"))
+			h.AssertNil(t, index.AddDaemonImage("sha256:arm64"))
+		})
+
+		when("the daemon uses the containerd image store", func() {
+			it.Before(func() {
+				dockerClient.containerd = true
+			})
+
+			it("loads the index and its children", func() {
+				h.AssertNil(t, index.SaveToDaemon())
+				h.AssertEq(t, len(dockerClient.loaded), 1)
+
+				layoutDir := filepath.Join(tmpDir, "loaded")
+				extractTar(t, dockerClient.loaded[0], layoutDir)
+				layoutPath, err := layout.FromPath(layoutDir)
+				h.AssertNil(t, err)
+				outer, err := layoutPath.ImageIndex()
+				h.AssertNil(t, err)
+				outerManifest, err := outer.IndexManifest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(outerManifest.Manifests), 1)
+				h.AssertEq(t, outerManifest.Manifests[0].Annotations["io.containerd.image.name"], "index.docker.io/library/some-index:latest")
+
+				loadedIndex, err := outer.ImageIndex(outerManifest.Manifests[0].Digest)
+				h.AssertNil(t, err)
+				loadedDigest, err := loadedIndex.Digest()
+				h.AssertNil(t, err)
+				expectedDigest, err := index.ImageIndex.Digest()
+				h.AssertNil(t, err)
+				h.AssertEq(t, loadedDigest, expectedDigest)
+
+				for _, image := range []v1.Image{amd64Image, arm64Image} {
+					digest, err := image.Digest()
+					h.AssertNil(t, err)
+					child, err := loadedIndex.Image(digest)
+					h.AssertNil(t, err)
+					layers, err := child.Layers()
+					h.AssertNil(t, err)
+					_, err = layers[0].Compressed()
+					h.AssertNil(t, err)
+				}
+			})
+		})
+
+		when("the daemon does not use the containerd image store", func() {
+			it("returns an ErrUnsupported", func() {
+				err := index.SaveToDaemon()
+				var unsupported imgutil.ErrUnsupported
+				h.AssertEq(t, errors.As(err, &unsupported), true)
+				h.AssertEq(t, len(dockerClient.loaded), 0)
+			})
+		})
+	})
+}
+
+func extractTar(t *testing.T, contents []byte, dest string) {
+	t.Helper()
+	tr := tar.NewReader(bytes.NewReader(contents))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return
+		}
+		h.AssertNil(t, err)
+		path := filepath.Join(dest, filepath.FromSlash(hdr.Name))
+		h.AssertNil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		f, err := os.Create(path)
+		h.AssertNil(t, err)
+		_, err = io.Copy(f, tr) // #nosec G110
+		h.AssertNil(t, err)
+		h.AssertNil(t, f.Close())
+	}
+}
@@ -0,0 +1,90 @@
+package local
+
+import (
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+)
+
+// inspectCache holds the results of inspecting images in the daemon, including their history,
+// so that an image referred to more than once, e.g. as both the base and the previous image, is only inspected once.
+// Images that are not found are cached as well.
+// The cache is shared with the store of the image, so that the image inspected after it is saved is cached too,
+// and its history is only requested if it is needed.
+type inspectCache struct {
+	dockerClient DockerClient
+	mu           sync.Mutex
+	entries      map[string]inspectEntry
+}
+
+type inspectEntry struct {
+	inspect    *types.ImageInspect
+	history    []image.HistoryResponseItem
+	hasHistory bool
+}
+
+func newInspectCache(dockerClient DockerClient) *inspectCache {
+	return &inspectCache{
+		dockerClient: dockerClient,
+		entries:      make(map[string]inspectEntry),
+	}
+}
+
+// get returns the inspect and history of the image with the given name, which are nil if there is no such image.
+func (c *inspectCache) get(repoName string) (*types.ImageInspect, []image.HistoryResponseItem, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[repoName]
+	if !ok {
+		inspect, err := getInspect(repoName, c.dockerClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry = inspectEntry{inspect: inspect}
+	}
+	if entry.inspect != nil && !entry.hasHistory {
+		history, err := getHistory(repoName, entry.inspect.ID, c.dockerClient)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry.history, entry.hasHistory = history, true
+	}
+	c.entries[repoName] = entry
+	return entry.inspect, entry.history, nil
+}
+
+// inspect returns the inspect of the image with the given name, which is nil if there is no such image,
+// without requesting its history.
+func (c *inspectCache) inspect(repoName string) (*types.ImageInspect, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[repoName]; ok {
+		return entry.inspect, nil
+	}
+	inspect, err := getInspect(repoName, c.dockerClient)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[repoName] = inspectEntry{inspect: inspect}
+	if inspect != nil {
+		c.entries[inspect.ID] = inspectEntry{inspect: inspect}
+	}
+	return inspect, nil
+}
+
+// forget discards the cached results for the given names, e.g. after they are tagged to another image.
+func (c *inspectCache) forget(repoNames ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, repoName := range repoNames {
+		delete(c.entries, repoName)
+	}
+}
+
+// reset discards the cached results, e.g. after the image is saved or deleted.
+func (c *inspectCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[string]inspectEntry)
+}
@@ -0,0 +1,130 @@
+package local_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/system"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestInspectCache(t *testing.T) {
+	spec.Run(t, "InspectCache", testInspectCache, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// countingClient is a listingClient that counts the calls made to inspect images and get their history.
+type countingClient struct {
+	listingClient
+	inspects  int
+	histories int
+}
+
+func (c *countingClient) ImageInspectWithRaw(ctx context.Context, ref string) (types.ImageInspect, []byte, error) {
+	c.inspects++
+	return c.listingClient.ImageInspectWithRaw(ctx, ref)
+}
+
+func (c *countingClient) ImageHistory(ctx context.Context, ref string) ([]image.HistoryResponseItem, error) {
+	c.histories++
+	return c.listingClient.ImageHistory(ctx, ref)
+}
+
+// reloadingClient is a countingClient that loads images, which are then found by any name other than the ID of the existing image.
+type reloadingClient struct {
+	*countingClient
+	loaded bool
+}
+
+const loadedImageID = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+
+func (c *reloadingClient) Info(context.Context) (system.Info, error) {
+	return system.Info{}, nil
+}
+
+func (c *reloadingClient) ImageLoad(_ context.Context, input io.Reader, _ bool) (types.ImageLoadResponse, error) {
+	if _, err := io.Copy(io.Discard, input); err != nil {
+		return types.ImageLoadResponse{}, err
+	}
+	c.loaded = true
+	c.images = append(c.images, image.Summary{ID: loadedImageID})
+	return types.ImageLoadResponse{Body: io.NopCloser(strings.NewReader(`{"stream":"Loaded image"}`))}, nil
+}
+
+func (c *reloadingClient) ImageInspectWithRaw(ctx context.Context, ref string) (types.ImageInspect, []byte, error) {
+	if c.loaded && ref != someImageID {
+		ref = loadedImageID
+	}
+	return c.countingClient.ImageInspectWithRaw(ctx, ref)
+}
+
+func (c *reloadingClient) ImageTag(context.Context, string, string) error {
+	return nil
+}
+
+func (c *reloadingClient) ImageRemove(context.Context, string, image.RemoveOptions) ([]image.DeleteResponse, error) {
+	return nil, nil
+}
+
+func testInspectCache(t *testing.T, when spec.G, it spec.S) {
+	var dockerClient *countingClient
+
+	it.Before(func() {
+		dockerClient = &countingClient{listingClient: listingClient{images: []image.Summary{
+			{ID: someImageID, Labels: map[string]string{"which": "some-image"}},
+		}}}
+	})
+
+	it("inspects an image used as both the base and the previous image once", func() {
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(someImageID), local.WithPreviousImage(someImageID))
+		h.AssertNil(t, err)
+		h.AssertEq(t, img.Found(), true)
+		h.AssertEq(t, dockerClient.inspects, 1)
+		h.AssertEq(t, dockerClient.histories, 1)
+	})
+
+	it("inspects the saved image once when it is saved and deleted", func() {
+		client := &reloadingClient{countingClient: dockerClient}
+		img, err := local.NewImage("some-image", client, local.FromBaseImage(someImageID))
+		h.AssertNil(t, err)
+		h.AssertEq(t, dockerClient.inspects, 1)
+
+		h.AssertNil(t, img.Save())
+		identifier, err := img.Identifier()
+		h.AssertNil(t, err)
+		h.AssertEq(t, "sha256:"+identifier.String(), loadedImageID)
+		h.AssertEq(t, dockerClient.inspects, 2)
+
+		h.AssertNil(t, img.Delete())
+		h.AssertEq(t, dockerClient.inspects, 2)
+		h.AssertEq(t, dockerClient.histories, 1)
+	})
+
+	when("#Refresh", func() {
+		it("inspects the image again", func() {
+			img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(someImageID))
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.Refresh())
+			h.AssertEq(t, img.Found(), true)
+			h.AssertEq(t, dockerClient.inspects, 2)
+		})
+
+		it("reports the image as not found once it is removed from the daemon", func() {
+			img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(someImageID))
+			h.AssertNil(t, err)
+			h.AssertEq(t, img.Found(), true)
+
+			dockerClient.images = nil
+			h.AssertNil(t, img.Refresh())
+			h.AssertEq(t, img.Found(), false)
+		})
+	})
+}
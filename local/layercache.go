@@ -0,0 +1,157 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+const layerCacheDirName = "layers"
+
+// layerCache keeps the layer tars extracted from the daemon in the XDG store, named by diff ID,
+// so that later images, possibly in other processes, do not need to save the image from the daemon again to read them.
+// When the cached layers exceed the maximum size, the least recently used layers are evicted.
+type layerCache struct {
+	dir     string
+	maxSize int64
+}
+
+func newLayerCache(xdgPath string, maxSize int64) *layerCache {
+	if xdgPath == "" {
+		return nil
+	}
+	return &layerCache{dir: filepath.Join(xdgPath, layerCacheDirName), maxSize: maxSize}
+}
+
+func (c *layerCache) path(diffID v1.Hash) string {
+	return filepath.Join(c.dir, diffID.Algorithm+"-"+diffID.Hex+".tar")
+}
+
+// get returns the path of the cached layer with the given diff ID, marking it as recently used, if there is one.
+func (c *layerCache) get(diffID v1.Hash) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	path := c.path(diffID)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	now := time.Now()
+	_ = os.Chtimes(path, now, now)
+	return path, true
+}
+
+// checkout links, or copies, the cached layer with the given diff ID into the given directory, marking it as recently used,
+// and returns the path of the link, if the layer is cached. The layer can be read from there even after it is evicted.
+func (c *layerCache) checkout(diffID v1.Hash, toDir string) (string, bool) {
+	path, ok := c.get(diffID)
+	if !ok {
+		return "", false
+	}
+	linkPath := filepath.Join(toDir, filepath.Base(path))
+	if err := linkOrCopy(path, linkPath); err != nil {
+		// the layer was evicted since it was found
+		return "", false
+	}
+	return linkPath, true
+}
+
+// put adds the layer tar at the given path to the cache, as a hard link if possible, or as a copy otherwise.
+// The layer is written to a temporary file first, so that other processes never read a partial layer.
+func (c *layerCache) put(diffID v1.Hash, fromPath string) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+	tmp.Close()
+	if err = os.Remove(tmpPath); err != nil {
+		return err
+	}
+	if err = linkOrCopy(fromPath, tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, c.path(diffID))
+}
+
+// linkOrCopy hard links the file at fromPath to toPath if possible, or copies it otherwise.
+func linkOrCopy(fromPath, toPath string) error {
+	if err := os.Link(fromPath, toPath); err == nil {
+		return nil
+	}
+	return copyFile(fromPath, toPath)
+}
+
+func copyFile(fromPath, toPath string) error {
+	src, err := os.Open(filepath.Clean(fromPath))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(filepath.Clean(toPath), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// evict removes the least recently used layers until the cached layers take at most the maximum size.
+// Layers that were checked out by a store remain readable by it, as they are linked or copied out of the cache.
+// A maximum size that is not positive means the cache is unbounded.
+func (c *layerCache) evict() error {
+	if c == nil || c.maxSize <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var (
+		layers []os.FileInfo
+		total  int64
+	)
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".tmp-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed concurrently
+		}
+		layers = append(layers, info)
+		total += info.Size()
+	}
+	sort.Slice(layers, func(i, j int) bool {
+		return layers[i].ModTime().Before(layers[j].ModTime())
+	})
+	for _, layer := range layers {
+		if total <= c.maxSize {
+			break
+		}
+		if err = os.Remove(filepath.Join(c.dir, layer.Name())); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("evicting cached layer: %w", err)
+		}
+		total -= layer.Size()
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package local_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	ggcrlayout "github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestSaveAsOCILayout(t *testing.T) {
+	spec.Run(t, "SaveAsOCILayout", testSaveAsOCILayout, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testSaveAsOCILayout(t *testing.T, when spec.G, it spec.S) {
+	var (
+		dockerClient *savingClient
+		baseImage    v1.Image
+		baseID       string
+		tmpDir       string
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "oci-layout-test")
+		h.AssertNil(t, err)
+		baseImage, err = random.Image(100, 2)
+		h.AssertNil(t, err)
+		baseDigest, err := baseImage.ConfigName()
+		h.AssertNil(t, err)
+		baseID = baseDigest.String()
+		dockerClient = &savingClient{images: map[string]v1.Image{baseID: baseImage}}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("writes the image with its daemon layers compressed and OCI media types", func() {
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage(baseID), imgutil.WithTempDir(tmpDir))
+		h.AssertNil(t, err)
+		layoutDir := filepath.Join(tmpDir, "layout")
+		h.AssertNil(t, img.SaveAsOCILayout(layoutDir))
+
+		layoutPath, err := ggcrlayout.FromPath(layoutDir)
+		h.AssertNil(t, err)
+		index, err := layoutPath.ImageIndex()
+		h.AssertNil(t, err)
+		indexManifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(indexManifest.Manifests), 1)
+		h.AssertEq(t, indexManifest.Manifests[0].Annotations[layout.ImageRefNameKey], "some-image")
+
+		saved, err := layoutPath.Image(indexManifest.Manifests[0].Digest)
+		h.AssertNil(t, err)
+		h.AssertNil(t, validate.Image(saved))
+		h.AssertOCIMediaTypes(t, saved)
+		savedConfig, err := saved.ConfigFile()
+		h.AssertNil(t, err)
+		baseConfig, err := baseImage.ConfigFile()
+		h.AssertNil(t, err)
+		h.AssertEq(t, savedConfig.RootFS.DiffIDs, baseConfig.RootFS.DiffIDs)
+		h.AssertEq(t, dockerClient.saved, []string{baseID})
+	})
+}
@@ -1,12 +1,14 @@
 package local
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
 
 	"github.com/buildpacks/imgutil"
 )
@@ -16,8 +18,11 @@ type Image struct {
 	*imgutil.CNBImageCore
 	repoName       string
 	store          *Store
+	inspects       *inspectCache
 	lastIdentifier string
 	daemonOS       string
+	// hostClient is the client created for the daemon given with WithDockerHost, or by imgutil.NewImageFromRef, closed by Cleanup
+	hostClient io.Closer
 }
 
 func (i *Image) Kind() string {
@@ -47,6 +52,79 @@ func (i *Image) Valid() bool {
 	return true
 }
 
+// Validate deeply checks the image, downloading the layers of the image that are only in the daemon to check them.
+func (i *Image) Validate() (imgutil.ValidationReport, error) {
+	if err := i.ensureLayers(); err != nil {
+		return imgutil.ValidationReport{}, err
+	}
+	image, err := i.store.withDownloadedLayers(i)
+	if err != nil {
+		return imgutil.ValidationReport{}, err
+	}
+	violations, err := imgutil.ValidateImageSpec(image)
+	if err != nil {
+		return imgutil.ValidationReport{}, err
+	}
+	return imgutil.ValidationReport{Violations: violations}, nil
+}
+
+// Manifest returns the manifest the image has when it is written as an OCI layout or archive.
+// The layers of the image that are only in the daemon are downloaded, as the daemon does not provide their digests and sizes.
+func (i *Image) Manifest() (*v1.Manifest, error) {
+	image, err := i.downloadedImage()
+	if err != nil {
+		return nil, err
+	}
+	return image.Manifest()
+}
+
+// LayerSizes returns the compressed sizes of the layers in the manifest returned by Manifest.
+func (i *Image) LayerSizes() ([]int64, error) {
+	manifest, err := i.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, len(manifest.Layers))
+	for idx, layer := range manifest.Layers {
+		sizes[idx] = layer.Size
+	}
+	return sizes, nil
+}
+
+// TotalSize returns the sum of the sizes of the manifest returned by Manifest, the config and the layers.
+func (i *Image) TotalSize() (int64, error) {
+	image, err := i.downloadedImage()
+	if err != nil {
+		return 0, err
+	}
+	return imgutil.ImageSize(image)
+}
+
+// Inspect returns the ImageInspection of the image as indented JSON, with the manifest returned by Manifest.
+func (i *Image) Inspect() (string, error) {
+	image, err := i.downloadedImage()
+	if err != nil {
+		return "", err
+	}
+	inspection, err := imgutil.InspectImage(image)
+	if err != nil {
+		return "", err
+	}
+	out, err := json.MarshalIndent(inspection, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// downloadedImage returns the working image with the layers that are only in the daemon replaced by their downloaded counterparts.
+func (i *Image) downloadedImage() (v1.Image, error) {
+	if err := i.ensureLayers(); err != nil {
+		return nil, err
+	}
+	return i.store.withDownloadedLayers(i.CNBImageCore)
+}
+
 // GetLayer returns an io.ReadCloser with uncompressed layer data.
 // The layer will always have data, even if that means downloading ALL the image layers from the daemon.
 func (i *Image) GetLayer(diffID string) (io.ReadCloser, error) {
@@ -66,7 +144,7 @@ func (i *Image) GetLayer(diffID string) (io.ReadCloser, error) {
 		// this avoids downloading ALL the image layers from the daemon
 		// if the layer is available locally
 		// (e.g., it was added using AddLayer).
-		if size, err := layer.Size(); err != nil && size != -1 {
+		if size, err := layer.Size(); err == nil && size != -1 {
 			return layer.Uncompressed()
 		}
 	}
@@ -89,13 +167,62 @@ func contains(diffIDs []v1.Hash, hash v1.Hash) bool {
 	return false
 }
 
+// ensureLayers makes sure the data of all the layers of the working image is in the store,
+// taking it from the layer cache if there is one, and downloading it from the daemon with `docker save`
+// only if some layer is still missing.
+// Previous images are downloaded first, as they usually contain the base layers as well,
+// so that the base image only needs to be downloaded for the layers they do not have.
 func (i *Image) ensureLayers() error {
-	if err := i.store.downloadLayersFor(i.lastIdentifier); err != nil {
-		return fmt.Errorf("failed to fetch base layers: %w", err)
+	missing, err := i.missingDaemonLayers()
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 && i.store.layerCache != nil {
+		diffIDs := make([]v1.Hash, len(missing))
+		for idx, layer := range missing {
+			diffIDs[idx] = layer.diffID
+		}
+		if _, err = i.store.addCachedLayers(diffIDs...); err != nil {
+			return err
+		}
+		if missing, err = i.missingDaemonLayers(); err != nil {
+			return err
+		}
+	}
+	for _, layer := range missing {
+		if layer.download == nil || layer.downloaded() {
+			continue
+		}
+		if err = layer.download(); err != nil {
+			return fmt.Errorf("failed to fetch previous image layers: %w", err)
+		}
+	}
+	for _, layer := range missing {
+		if !layer.downloaded() {
+			if err = i.store.downloadLayersFor(i.lastIdentifier); err != nil {
+				return fmt.Errorf("failed to fetch base layers: %w", err)
+			}
+			return nil
+		}
 	}
 	return nil
 }
 
+// missingDaemonLayers returns the layers of the working image that only exist in the daemon.
+func (i *Image) missingDaemonLayers() ([]*v1LayerFacade, error) {
+	layers, err := i.CNBImageCore.Layers()
+	if err != nil {
+		return nil, err
+	}
+	var missing []*v1LayerFacade
+	for _, layer := range layers {
+		if facade, isDaemonLayer := layer.(*v1LayerFacade); isDaemonLayer && !facade.downloaded() {
+			missing = append(missing, facade)
+		}
+	}
+	return missing, nil
+}
+
 func (i *Image) SetOS(osVal string) error {
 	if osVal != i.daemonOS {
 		return errors.New("invalid os: must match the daemon")
@@ -129,6 +256,23 @@ func (i *Image) AddLayerWithDiffIDAndHistory(path, _ string, history v1.History)
 	return i.AddLayerWithHistory(layer, history)
 }
 
+// AddLayerWithDiffIDAndMediaType adds the blob at the given path with the given diff ID, without reading it.
+// The daemon stores layers uncompressed, so the media type only determines the compression the blob must have.
+func (i *Image) AddLayerWithDiffIDAndMediaType(path, diffID string, mediaType types.MediaType) error {
+	if _, err := imgutil.LayerFromBlob(path, diffID, mediaType); err != nil {
+		return err
+	}
+	hash, err := v1.NewHash(diffID)
+	if err != nil {
+		return err
+	}
+	layer, err := i.store.addLayerWithDiffIDProvider(path, knownDiffID(hash))
+	if err != nil {
+		return err
+	}
+	return i.AddLayerWithHistory(layer, emptyHistory)
+}
+
 func (i *Image) AddOrReuseLayerWithHistory(path string, diffID string, history v1.History) error {
 	prevLayerExists, err := i.PreviousImageHasLayer(diffID)
 	if err != nil {
@@ -140,6 +284,42 @@ func (i *Image) AddOrReuseLayerWithHistory(path string, diffID string, history v
 	return i.ReuseLayerWithHistory(diffID, history)
 }
 
+// ReuseBaseImageLayers does nothing for the daemon, as the previous image is in the daemon too,
+// so its layers are no cheaper to save than those of the base image:
+// with the docker image store, the layers of the base image are not sent to the daemon when the image is saved;
+// with the containerd image store and podman, which require every layer, they are downloaded from the daemon and sent back,
+// whichever of the two images they are taken from.
+func (i *Image) ReuseBaseImageLayers() error {
+	return nil
+}
+
+// SquashLayers collapses all layers above the layer with the given diff ID into a single layer.
+// The layers of the image are downloaded from the daemon if needed, as their contents must be read.
+func (i *Image) SquashLayers(fromDiffID string) error {
+	if err := i.ensureLayers(); err != nil {
+		return err
+	}
+	return i.CNBImageCore.SquashLayers(fromDiffID)
+}
+
+// ReadFile returns the contents of the file at the given path in the image filesystem.
+// The layers of the image are downloaded from the daemon if needed, as their contents must be read.
+func (i *Image) ReadFile(path string) ([]byte, error) {
+	if err := i.ensureLayers(); err != nil {
+		return nil, err
+	}
+	return i.CNBImageCore.ReadFile(path)
+}
+
+// WalkFiles calls fn for each file visible in the image filesystem.
+// The layers of the image are downloaded from the daemon if needed, as their contents must be read.
+func (i *Image) WalkFiles(fn imgutil.WalkFunc) error {
+	if err := i.ensureLayers(); err != nil {
+		return err
+	}
+	return i.CNBImageCore.WalkFiles(fn)
+}
+
 func (i *Image) Rebase(baseTopLayerDiffID string, withNewBase imgutil.Image) error {
 	if err := i.ensureLayers(); err != nil {
 		return err
@@ -152,6 +332,7 @@ func (i *Image) Save(additionalNames ...string) error {
 	if err != nil {
 		return err
 	}
+	i.inspects.reset()
 	i.lastIdentifier, err = i.store.Save(i, i.Name(), additionalNames...)
 	return err
 }
@@ -161,6 +342,7 @@ func (i *Image) SaveAs(name string, additionalNames ...string) error {
 	if err != nil {
 		return err
 	}
+	i.inspects.reset()
 	i.lastIdentifier, err = i.store.Save(i, name, additionalNames...)
 	return err
 }
@@ -169,6 +351,56 @@ func (i *Image) SaveFile() (string, error) {
 	return i.store.SaveFile(i, i.Name())
 }
 
+// SaveTo streams the image to w in the format produced by `docker save`.
+// Only imgutil.DockerArchive is supported, as the daemon does not provide compressed layers.
+func (i *Image) SaveTo(w io.Writer, format imgutil.ArchiveFormat) error {
+	if format != imgutil.DockerArchive {
+		return imgutil.ErrUnsupported{Kind: i.Kind(), Operation: "saving to an " + format.String(), Reason: "the docker daemon does not provide compressed layers"}
+	}
+	if err := i.SetCreatedAtAndHistory(); err != nil {
+		return err
+	}
+	return i.store.SaveTo(w, i, i.Name())
+}
+
+// SaveAsOCILayout writes the image to an OCI layout directory at path, replacing any image there, so that tools can read it
+// without a registry or daemon. The layers are read from the daemon and compressed, and the image is converted to OCI media types
+// and annotated with its name.
+func (i *Image) SaveAsOCILayout(path string) error {
+	if err := i.SetCreatedAtAndHistory(); err != nil {
+		return err
+	}
+	return i.store.SaveToLayout(path, i, i.Name())
+}
+
+// Cleanup removes the intermediate files created for the image, including layers extracted from the daemon,
+// unless they are kept for debugging, and closes the client created for the daemon given with WithDockerHost.
+func (i *Image) Cleanup() error {
+	err := errors.Join(i.CNBImageCore.Cleanup(), i.store.tempFiles.Cleanup())
+	if i.hostClient != nil {
+		err = errors.Join(err, i.hostClient.Close())
+	}
+	return err
+}
+
+// Delete removes the image last loaded or saved from the daemon, and discards the cached results of inspecting images.
 func (i *Image) Delete() error {
 	return i.store.Delete(i.lastIdentifier)
 }
+
+// Refresh discards the daemon state cached by the image, such as the results of inspecting its base and previous images,
+// and inspects the image last loaded or saved again, so that Found reports false if it was removed from the daemon since.
+func (i *Image) Refresh() error {
+	i.inspects.reset()
+	if i.lastIdentifier == "" {
+		return nil
+	}
+	inspect, _, err := i.inspects.get(i.lastIdentifier)
+	if err != nil {
+		return err
+	}
+	if inspect == nil {
+		i.lastIdentifier = ""
+	}
+	return nil
+}
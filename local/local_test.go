@@ -998,6 +998,106 @@ func testImage(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#SetExposedPorts", func() {
+		var repoName = newTestImageName()
+
+		it.After(func() {
+			h.AssertNil(t, h.DockerRmi(dockerClient, repoName))
+		})
+
+		it("sets the exposed ports", func() {
+			img, err := local.NewImage(repoName, dockerClient)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.SetExposedPorts("8080", "53/udp"))
+			h.AssertNil(t, img.Save())
+
+			inspect, _, err := dockerClient.ImageInspectWithRaw(context.TODO(), repoName)
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(inspect.Config.ExposedPorts), 2)
+			_, ok := inspect.Config.ExposedPorts["8080/tcp"]
+			h.AssertEq(t, ok, true)
+
+			loaded, err := local.NewImage(repoName, dockerClient, local.FromBaseImage(repoName))
+			h.AssertNil(t, err)
+			ports, err := loaded.ExposedPorts()
+			h.AssertNil(t, err)
+			h.AssertEq(t, ports, []string{"53/udp", "8080/tcp"})
+		})
+	})
+
+	when("#SetVolumes", func() {
+		var repoName = newTestImageName()
+
+		it.After(func() {
+			h.AssertNil(t, h.DockerRmi(dockerClient, repoName))
+		})
+
+		it("sets the volumes", func() {
+			img, err := local.NewImage(repoName, dockerClient)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.SetVolumes(map[string]struct{}{"/data": {}}))
+			h.AssertNil(t, img.Save())
+
+			inspect, _, err := dockerClient.ImageInspectWithRaw(context.TODO(), repoName)
+			h.AssertNil(t, err)
+			h.AssertEq(t, inspect.Config.Volumes, map[string]struct{}{"/data": {}})
+		})
+	})
+
+	when("#SetStopSignal", func() {
+		var repoName = newTestImageName()
+
+		it.After(func() {
+			h.AssertNil(t, h.DockerRmi(dockerClient, repoName))
+		})
+
+		it("sets the stop signal", func() {
+			img, err := local.NewImage(repoName, dockerClient)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.SetStopSignal("SIGQUIT"))
+			h.AssertNil(t, img.Save())
+
+			inspect, _, err := dockerClient.ImageInspectWithRaw(context.TODO(), repoName)
+			h.AssertNil(t, err)
+			h.AssertEq(t, inspect.Config.StopSignal, "SIGQUIT")
+
+			loaded, err := local.NewImage(repoName, dockerClient, local.FromBaseImage(repoName))
+			h.AssertNil(t, err)
+			signal, err := loaded.StopSignal()
+			h.AssertNil(t, err)
+			h.AssertEq(t, signal, "SIGQUIT")
+		})
+	})
+
+	when("#SetUser", func() {
+		var repoName = newTestImageName()
+
+		it.After(func() {
+			h.AssertNil(t, h.DockerRmi(dockerClient, repoName))
+		})
+
+		it("sets the user", func() {
+			img, err := local.NewImage(repoName, dockerClient)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.SetUser("cnb:cnb"))
+			h.AssertNil(t, img.Save())
+
+			inspect, _, err := dockerClient.ImageInspectWithRaw(context.TODO(), repoName)
+			h.AssertNil(t, err)
+			h.AssertEq(t, inspect.Config.User, "cnb:cnb")
+
+			loaded, err := local.NewImage(repoName, dockerClient, local.FromBaseImage(repoName))
+			h.AssertNil(t, err)
+			user, err := loaded.User()
+			h.AssertNil(t, err)
+			h.AssertEq(t, user, "cnb:cnb")
+		})
+	})
+
 	when("#SetWorkingDir", func() {
 		var repoName = newTestImageName()
 
@@ -1907,6 +2007,24 @@ func testImage(t *testing.T, when spec.G, it spec.S) {
 				h.AssertEq(t, strings.TrimSpace(label), "newValue")
 			})
 
+			when("#WithOCILoadFormat", func() {
+				it("saves the image with the base image layers", func() {
+					img, err := local.NewImage(repoName, dockerClient, local.FromBaseImage(runnableBaseImageName), local.WithOCILoadFormat())
+					h.AssertNil(t, err)
+					h.AssertNil(t, img.SetLabel("mykey", "newValue"))
+					h.AssertNil(t, img.AddLayer(tarPath))
+
+					h.AssertNil(t, img.Save())
+
+					inspect, _, err := dockerClient.ImageInspectWithRaw(context.TODO(), repoName)
+					h.AssertNil(t, err)
+					h.AssertEq(t, strings.TrimSpace(inspect.Config.Labels["mykey"]), "newValue")
+					baseInspect, _, err := dockerClient.ImageInspectWithRaw(context.TODO(), runnableBaseImageName)
+					h.AssertNil(t, err)
+					h.AssertEq(t, len(inspect.RootFS.Layers), len(baseInspect.RootFS.Layers)+1)
+				})
+			})
+
 			it("zeroes times and client specific fields", func() {
 				err := img.SetLabel("mykey", "newValue")
 				h.AssertNil(t, err)
@@ -2155,6 +2273,48 @@ func testImage(t *testing.T, when spec.G, it spec.S) {
 
 			it("creates an archive that can be imported and has correct diffIDs", saveFileTest)
 		})
+
+		when("#WithCompressedLayers", func() {
+			it.Before(func() {
+				var err error
+
+				img, err = local.NewImage(repoName, dockerClient, local.WithCompressedLayers())
+				h.AssertNil(t, err)
+
+				tarPath1, err = h.CreateSingleFileLayerTar("/foo", "foo", daemonOS)
+				h.AssertNil(t, err)
+
+				tarPath2, err = h.CreateSingleFileLayerTar("/bar", "bar", daemonOS)
+				h.AssertNil(t, err)
+			})
+
+			it("creates an archive that can be imported and has correct diffIDs", saveFileTest)
+
+			it("writes compressed layer entries", func() {
+				h.AssertNil(t, img.AddLayer(tarPath1))
+
+				path, err := img.SaveFile()
+				h.AssertNil(t, err)
+				defer os.Remove(path)
+
+				f, err := os.Open(path)
+				h.AssertNil(t, err)
+				defer f.Close()
+				var layerNames []string
+				tr := tar.NewReader(f)
+				for {
+					hdr, err := tr.Next()
+					if err == io.EOF {
+						break
+					}
+					h.AssertNil(t, err)
+					if strings.HasSuffix(hdr.Name, ".tar.gz") {
+						layerNames = append(layerNames, hdr.Name)
+					}
+				}
+				h.AssertEq(t, len(layerNames), 1)
+			})
+		})
 	})
 
 	when("#Found", func() {
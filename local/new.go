@@ -3,10 +3,14 @@ package local
 import (
 	"context"
 	"fmt"
+	"net/http"
+
+	"github.com/docker/cli/cli/connhelper"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 
 	"github.com/buildpacks/imgutil"
@@ -14,19 +18,94 @@ import (
 
 // NewImage returns a new image that can be modified and saved to a docker daemon
 // via a tarball in legacy format.
+// Batch workloads creating many images with the same client can share a CachingClient,
+// so that the daemon is only asked for its info and version once.
 func NewImage(repoName string, dockerClient DockerClient, ops ...imgutil.ImageOption) (*Image, error) {
 	options := &imgutil.ImageOptions{}
 	for _, op := range ops {
 		op(options)
 	}
+	if err := options.Err(); err != nil {
+		return nil, err
+	}
 
-	var err error
+	err := imgutil.ResolveAliases(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var hostClient *client.Client
+	if options.DockerHost != "" {
+		if hostClient, err = NewDockerClient(options.DockerHost); err != nil {
+			return nil, err
+		}
+		// the daemon is asked for its info once for the image, rather than on every save
+		dockerClient = NewCachingClient(hostClient)
+	}
+	image, err := newImage(repoName, dockerClient, options)
+	if err != nil {
+		if hostClient != nil {
+			hostClient.Close()
+		}
+		return nil, err
+	}
+	if hostClient != nil {
+		image.hostClient = hostClient
+	}
+	return image, nil
+}
+
+// NewDockerClient returns a client for the daemon at the provided host, negotiating the API version.
+// Besides the hosts supported by the docker client, such as unix:// and tcp://, ssh://[user@]host[:port][/socket path] hosts
+// are reached by running `docker system dial-stdio` on the host with the ssh command, as the docker CLI does.
+func NewDockerClient(host string) (*client.Client, error) {
+	helper, err := connhelper.GetConnectionHelper(host)
+	if err != nil {
+		return nil, err
+	}
+	if helper == nil {
+		return client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+	}
+	httpClient := &http.Client{Transport: &http.Transport{DialContext: helper.Dialer}}
+	return client.NewClientWithOpts(
+		client.WithHTTPClient(httpClient),
+		client.WithHost(helper.Host),
+		client.WithDialContext(helper.Dialer),
+		client.WithAPIVersionNegotiation(),
+	)
+}
+
+func newImage(repoName string, dockerClient DockerClient, options *imgutil.ImageOptions) (*Image, error) {
+	var (
+		gzipLayers, zstdLayers bool
+		err                    error
+	)
+	if options.CompressedLayers {
+		if gzipLayers, zstdLayers, err = loadableCompressions(dockerClient, options.PodmanCompatibility); err != nil {
+			return nil, err
+		}
+	}
+	warnings := capabilityWarnings(options, dockerClient)
+	if options.CompressedLayers && !gzipLayers {
+		warnings = append(warnings, imgutil.CapabilityWarning{
+			Option:  "CompressedLayers",
+			Kind:    imgutil.CapabilityIgnored,
+			Message: fmt.Sprintf("the daemon does not load compressed layers before API version %s, so layers are sent uncompressed", minGzipLayersAPIVersion),
+		})
+	}
+	if err = imgutil.CheckCapabilities(options, capabilities, warnings...); err != nil {
+		return nil, err
+	}
 	options.Platform, err = processPlatformOption(options.Platform, dockerClient)
 	if err != nil {
 		return nil, err
 	}
 
-	previousImage, err := processImageOption(options.PreviousImageRepoName, dockerClient, true)
+	tempFiles := imgutil.NewTempFiles(options.TempDir, options.KeepIntermediates)
+	inspects := newInspectCache(dockerClient)
+	// the layers downloaded for the previous and the base image are shared, as the images usually have layers in common
+	layers := make(map[v1.Hash]annotatedLayer)
+	previousImage, err := processImageOption(options.PreviousImageRepoName, inspects, layers, true, tempFiles)
 	if err != nil {
 		return nil, err
 	}
@@ -38,32 +117,73 @@ func NewImage(repoName string, dockerClient DockerClient, ops ...imgutil.ImageOp
 		baseIdentifier string
 		store          *Store
 	)
-	baseImage, err := processImageOption(options.BaseImageRepoName, dockerClient, false)
+	baseImage, err := processImageOption(options.BaseImageRepoName, inspects, layers, false, tempFiles)
 	if err != nil {
 		return nil, err
 	}
+	if options.TrustStore != nil || options.ExpectedDigest != (v1.Hash{}) {
+		if err = checkBaseImageDigests(options, inspects, baseImage.image != nil); err != nil {
+			return nil, err
+		}
+	}
 	if baseImage.image != nil {
 		options.BaseImage = baseImage.image
 		baseIdentifier = baseImage.identifier
 		store = baseImage.layerStore
 	} else {
 		store = NewStore(dockerClient)
+		store.onDiskLayersByDiffID = layers
 	}
 
 	cnbImage, err := imgutil.NewCNBImage(*options)
 	if err != nil {
 		return nil, err
 	}
+	store.inspects = inspects
+	store.compressLayers = gzipLayers
+	store.zstdLayers = zstdLayers
+	store.gzipLevel = options.GzipLevel
+	store.diffIDProvider = options.DiffIDProvider
+	store.ociLoadFormat = options.OCILoadFormat
+	store.podman = options.PodmanCompatibility
+	store.tempFiles = tempFiles
+	store.logger = options.Logger
+	store.metrics = options.MetricsHook
+	store.layerCache = newLayerCache(options.LayerCacheXDGPath, options.LayerCacheMaxSize)
+	if previousImage.layerStore != nil {
+		previousImage.layerStore.layerCache = store.layerCache
+	}
 
 	return &Image{
 		CNBImageCore:   cnbImage,
 		repoName:       repoName,
 		store:          store,
+		inspects:       inspects,
 		lastIdentifier: baseIdentifier,
 		daemonOS:       options.Platform.OS,
 	}, nil
 }
 
+// capabilityWarnings returns the warnings for the options that have no effect when saving to the daemon.
+func capabilityWarnings(options *imgutil.ImageOptions, dockerClient DockerClient) []imgutil.CapabilityWarning {
+	var warnings []imgutil.CapabilityWarning
+	if options.LayerEncrypter != nil {
+		warnings = append(warnings, imgutil.CapabilityWarning{
+			Option:  "LayerEncrypter",
+			Kind:    imgutil.CapabilityIgnored,
+			Message: "the daemon cannot store encrypted layers",
+		})
+	}
+	if options.OCILoadFormat && !options.PodmanCompatibility && !usesContainerdStorage(dockerClient) {
+		warnings = append(warnings, imgutil.CapabilityWarning{
+			Option:  "OCILoadFormat",
+			Kind:    imgutil.CapabilityIgnored,
+			Message: "the daemon uses the classic image store, which is sent images in docker save format",
+		})
+	}
+	return warnings
+}
+
 func defaultPlatform(dockerClient DockerClient) (imgutil.Platform, error) {
 	daemonInfo, err := dockerClient.ServerVersion(context.Background())
 	if err != nil {
@@ -96,18 +216,20 @@ type imageResult struct {
 	layerStore *Store
 }
 
-func processImageOption(repoName string, dockerClient DockerClient, downloadLayersOnAccess bool) (imageResult, error) {
+func processImageOption(repoName string, inspects *inspectCache, layers map[v1.Hash]annotatedLayer, downloadLayersOnAccess bool, tempFiles *imgutil.TempFiles) (imageResult, error) {
 	if repoName == "" {
 		return imageResult{}, nil
 	}
-	inspect, history, err := getInspectAndHistory(repoName, dockerClient)
+	inspect, history, err := inspects.get(repoName)
 	if err != nil {
 		return imageResult{}, err
 	}
 	if inspect == nil {
 		return imageResult{}, nil
 	}
-	layerStore := NewStore(dockerClient)
+	layerStore := NewStore(inspects.dockerClient)
+	layerStore.onDiskLayersByDiffID = layers
+	layerStore.tempFiles = tempFiles
 	v1Image, err := newV1ImageFacadeFromInspect(*inspect, history, layerStore, downloadLayersOnAccess)
 	if err != nil {
 		return imageResult{}, err
@@ -119,17 +241,108 @@ func processImageOption(repoName string, dockerClient DockerClient, downloadLaye
 	}, nil
 }
 
-func getInspectAndHistory(repoName string, dockerClient DockerClient) (*types.ImageInspect, []image.HistoryResponseItem, error) {
+// checkBaseImageDigests checks the digests the base image was pulled with, in the repository of the base image name,
+// against the expected digest and the trust store; with the containerd image store, the image ID is the manifest digest
+// and is checked as well.
+func checkBaseImageDigests(options *imgutil.ImageOptions, inspects *inspectCache, found bool) error {
+	if !found {
+		if err := imgutil.CheckExpectedBaseImageDigest(options); err != nil {
+			return err
+		}
+		return imgutil.CheckTrustedBaseImage(options)
+	}
+	inspect, _, err := inspects.get(options.BaseImageRepoName)
+	if err != nil {
+		return err
+	}
+	ref, err := name.ParseReference(options.BaseImageRepoName, name.WeakValidation)
+	if err != nil {
+		return err
+	}
+	var digests []v1.Hash
+	for _, repoDigest := range inspect.RepoDigests {
+		digestRef, err := name.NewDigest(repoDigest, name.WeakValidation)
+		if err != nil || digestRef.Context().Name() != ref.Context().Name() {
+			continue
+		}
+		if digest, err := v1.NewHash(digestRef.DigestStr()); err == nil {
+			digests = append(digests, digest)
+		}
+	}
+	if id, err := v1.NewHash(inspect.ID); err == nil {
+		digests = append(digests, id)
+	}
+	if err = imgutil.CheckExpectedBaseImageDigest(options, digests...); err != nil {
+		return err
+	}
+	return imgutil.CheckTrustedBaseImage(options, digests...)
+}
+
+func getInspect(repoName string, dockerClient DockerClient) (*types.ImageInspect, error) {
 	inspect, _, err := dockerClient.ImageInspectWithRaw(context.Background(), repoName)
 	if err != nil {
-		if client.IsErrNotFound(err) {
-			return nil, nil, nil
+		if !client.IsErrNotFound(err) {
+			return nil, fmt.Errorf("inspecting image %q: %w", repoName, err)
 		}
-		return nil, nil, fmt.Errorf("inspecting image %q: %w", repoName, err)
+		imageID, err := findByRepoDigest(repoName, dockerClient)
+		if err != nil || imageID == "" {
+			return nil, err
+		}
+		if inspect, _, err = dockerClient.ImageInspectWithRaw(context.Background(), imageID); err != nil {
+			return nil, fmt.Errorf("inspecting image %q: %w", repoName, err)
+		}
+	}
+	return &inspect, nil
+}
+
+func getHistory(repoName, imageID string, dockerClient DockerClient) ([]image.HistoryResponseItem, error) {
+	history, err := dockerClient.ImageHistory(context.Background(), imageID)
+	if err != nil {
+		return nil, fmt.Errorf("get history for image %q: %w", repoName, err)
+	}
+	return history, nil
+}
+
+// ImageLister is implemented by daemon clients that can list images, such as *client.Client.
+// When the DockerClient is also an ImageLister, images referred to by digest are found by their repo digests
+// even if the daemon does not resolve the reference itself, e.g. when the image was pulled from another repository.
+type ImageLister interface {
+	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+}
+
+// findByRepoDigest returns the ID of the image in the daemon with the digest of the given digest reference,
+// preferring an image with a repo digest in the same repository. It returns "" if the reference is not a digest reference,
+// the client cannot list images, or there is no such image.
+func findByRepoDigest(repoName string, dockerClient DockerClient) (string, error) {
+	ref, err := name.NewDigest(repoName, name.WeakValidation)
+	if err != nil {
+		return "", nil
 	}
-	history, err := dockerClient.ImageHistory(context.Background(), repoName)
+	lister, ok := dockerClient.(ImageLister)
+	if !ok {
+		return "", nil
+	}
+	summaries, err := lister.ImageList(context.Background(), image.ListOptions{})
 	if err != nil {
-		return nil, nil, fmt.Errorf("get history for image %q: %w", repoName, err)
+		return "", fmt.Errorf("listing images to find %q: %w", repoName, err)
+	}
+	var found string
+	for _, summary := range summaries {
+		if summary.ID == ref.DigestStr() && found == "" {
+			found = summary.ID // with containerd storage, the image ID is the manifest digest
+		}
+		for _, repoDigest := range summary.RepoDigests {
+			other, err := name.NewDigest(repoDigest, name.WeakValidation)
+			if err != nil || other.DigestStr() != ref.DigestStr() {
+				continue
+			}
+			if other.Context().Name() == ref.Context().Name() {
+				return summary.ID, nil
+			}
+			if found == "" {
+				found = summary.ID
+			}
+		}
 	}
-	return &inspect, history, nil
+	return found, nil
 }
@@ -8,6 +8,67 @@ import (
 	"github.com/buildpacks/imgutil"
 )
 
+// WithCompressedLayers if provided will cause the image to be sent to the daemon with gzip-compressed layers.
+// Layers that are already compressed, such as those of remote base images, are sent as-is,
+// which makes the tar loaded into the daemon considerably smaller than with uncompressed layers.
+// Layers that only exist in the daemon are still sent uncompressed, as are zstd layers if the daemon cannot load them
+// (before API version 1.42, unless it uses the containerd image store).
+// Daemons before API version 1.22 cannot load compressed layers: all layers are then sent uncompressed,
+// and the option is reported as ignored by the capability report, which fails the constructor with imgutil.WithStrictCapabilities.
+func WithCompressedLayers() func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.CompressedLayers = true
+	}
+}
+
+// WithOCILoadFormat if provided will cause the image to be sent to the daemon as an OCI layout tar
+// when the daemon uses the containerd image store, preserving the original compressed layers and manifest digest.
+// Daemons using the classic image store are always sent a tar in legacy `docker save` format.
+func WithOCILoadFormat() func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.OCILoadFormat = true
+	}
+}
+
+// WithPodmanCompatibility if provided will cause the image to be saved in a way that podman's docker-compatible API supports:
+// all the layers of the image are sent, as podman cannot load an image whose base layers are omitted,
+// and, with WithOCILoadFormat, the image is sent as an OCI layout tar.
+// See IsPodman to detect podman, and NewPodmanClient to connect to it.
+func WithPodmanCompatibility() func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.PodmanCompatibility = true
+	}
+}
+
+// WithLayerCache causes the layers that are extracted from the daemon, when the contents of daemon images are needed,
+// to be cached in the provided XDG path, so that later images, e.g. in the next build, read them from the cache
+// instead of saving the image from the daemon again. The least recently used layers are evicted when the cache
+// exceeds maxSize bytes; a maxSize that is not positive means the cache is unbounded.
+func WithLayerCache(xdgPath string, maxSize int64) func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.LayerCacheXDGPath = xdgPath
+		o.LayerCacheMaxSize = maxSize
+	}
+}
+
+// WithDockerHost causes NewImage to create its own client for the daemon at the provided host, e.g. unix:///var/run/docker.sock,
+// tcp://build-machine:2376 or ssh://user@build-machine (see NewDockerClient), instead of using the client it is given,
+// so that a process can save images to several daemons concurrently. The client is closed by Cleanup.
+func WithDockerHost(host string) func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.DockerHost = host
+	}
+}
+
+// WithExpectedDigest causes NewImage to fail with an imgutil.ErrUnexpectedBaseImageDigest unless the base image
+// given with FromBaseImage was pulled with the provided digest, in the repository of the base image name,
+// or, with the containerd image store, has it as its ID. A base image that is not found in the daemon fails as well.
+func WithExpectedDigest(digest v1.Hash) func(*imgutil.ImageOptions) {
+	return func(o *imgutil.ImageOptions) {
+		o.ExpectedDigest = digest
+	}
+}
+
 // FIXME: the following functions are defined in this package for backwards compatibility,
 // and should eventually be deprecated.
 
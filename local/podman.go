@@ -0,0 +1,62 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/client"
+)
+
+// podmanEngineComponent is the name of the component reported in the version of podman's docker-compatible API.
+const podmanEngineComponent = "Podman Engine"
+
+// IsPodman reports whether the daemon is podman, serving its docker-compatible API.
+func IsPodman(dockerClient DockerClient) bool {
+	version, err := dockerClient.ServerVersion(context.Background())
+	if err != nil {
+		return false
+	}
+	for _, component := range version.Components {
+		if component.Name == podmanEngineComponent {
+			return true
+		}
+	}
+	return false
+}
+
+// PodmanHost returns the host of the podman API socket, e.g. `unix:///run/user/1000/podman/podman.sock`.
+// It is taken from `CONTAINER_HOST` if set, as podman does; otherwise the socket of the rootless service
+// of the current user is preferred to the socket of the rootful service.
+func PodmanHost() (string, error) {
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host, nil
+	}
+	var candidates []string
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, "podman", "podman.sock"))
+	}
+	if uid := os.Getuid(); uid > 0 {
+		candidates = append(candidates, filepath.Join("/run", "user", strconv.Itoa(uid), "podman", "podman.sock"))
+	}
+	candidates = append(candidates, filepath.Join("/run", "podman", "podman.sock"))
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			return "unix://" + candidate, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find podman socket; looked for %s", strings.Join(candidates, ", "))
+}
+
+// NewPodmanClient returns a client for the podman API socket found by PodmanHost.
+// Images created with it should use WithPodmanCompatibility.
+func NewPodmanClient() (*client.Client, error) {
+	host, err := PodmanHost()
+	if err != nil {
+		return nil, err
+	}
+	return client.NewClientWithOpts(client.WithHost(host), client.WithAPIVersionNegotiation())
+}
@@ -0,0 +1,67 @@
+package local_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestPodman(t *testing.T) {
+	spec.Run(t, "Podman", testPodman, spec.Sequential(), spec.Report(report.Terminal{}))
+}
+
+// versionClient is a DockerClient that only reports its version.
+type versionClient struct {
+	local.DockerClient
+	version types.Version
+	err     error
+}
+
+func (c versionClient) ServerVersion(context.Context) (types.Version, error) {
+	return c.version, c.err
+}
+
+func testPodman(t *testing.T, when spec.G, it spec.S) {
+	when("#IsPodman", func() {
+		it("detects podman from the components of the version", func() {
+			podman := versionClient{version: types.Version{Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "4.9.3"}}}}
+			h.AssertEq(t, local.IsPodman(podman), true)
+
+			docker := versionClient{version: types.Version{Components: []types.ComponentVersion{{Name: "Engine", Version: "26.1.0"}}}}
+			h.AssertEq(t, local.IsPodman(docker), false)
+
+			h.AssertEq(t, local.IsPodman(versionClient{err: errors.New("some-error")}), false)
+		})
+	})
+
+	when("#PodmanHost", func() {
+		it("uses CONTAINER_HOST when it is set", func() {
+			t.Setenv("CONTAINER_HOST", "unix:///some/podman.sock")
+			host, err := local.PodmanHost()
+			h.AssertNil(t, err)
+			h.AssertEq(t, host, "unix:///some/podman.sock")
+		})
+
+		it("finds the rootless socket in the runtime directory", func() {
+			runtimeDir := t.TempDir()
+			socket := filepath.Join(runtimeDir, "podman", "podman.sock")
+			h.AssertNil(t, os.MkdirAll(filepath.Dir(socket), 0750))
+			h.AssertNil(t, os.WriteFile(socket, nil, 0600))
+			t.Setenv("CONTAINER_HOST", "")
+			t.Setenv("XDG_RUNTIME_DIR", runtimeDir)
+
+			host, err := local.PodmanHost()
+			h.AssertNil(t, err)
+			h.AssertEq(t, host, "unix://"+socket)
+		})
+	})
+}
@@ -0,0 +1,66 @@
+package local
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/docker/docker/client"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// capabilities are the capabilities of local images.
+var capabilities = imgutil.Capabilities{CanRebase: true}
+
+func init() {
+	imgutil.RegisterScheme(imgutil.LocalScheme, func(name string, ops ...imgutil.ImageOption) (imgutil.Image, error) {
+		dockerClient, err := newClientFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		if IsPodman(dockerClient) {
+			ops = append(ops, WithPodmanCompatibility())
+		}
+		image, err := NewImageFromRef(name, dockerClient, ops...)
+		if err != nil {
+			dockerClient.Close()
+			return nil, err
+		}
+		if image.hostClient != nil {
+			// the image uses the daemon given with WithDockerHost instead
+			dockerClient.Close()
+			return image, nil
+		}
+		// the client is only used by the image, so it is closed by Cleanup
+		image.hostClient = dockerClient
+		return image, nil
+	}, capabilities)
+	imgutil.RegisterAccessChecker(imgutil.LocalScheme, func(name string, scope imgutil.AccessScope) error {
+		dockerClient, err := newClientFromEnv()
+		if err != nil {
+			return err
+		}
+		defer dockerClient.Close()
+		return CheckAccess(name, dockerClient, scope)
+	})
+}
+
+// newClientFromEnv returns a client configured from the environment, as with `docker` itself,
+// or, if `DOCKER_HOST` is not set and there is no docker socket, a client for the podman socket if there is one.
+func newClientFromEnv() (*client.Client, error) {
+	if os.Getenv(client.EnvOverrideHost) == "" && runtime.GOOS != "windows" {
+		if _, err := os.Stat("/var/run/docker.sock"); os.IsNotExist(err) {
+			if podmanClient, err := NewPodmanClient(); err == nil {
+				return podmanClient, nil
+			}
+		}
+	}
+	return client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+}
+
+// NewImageFromRef returns the image with the given name in the daemon, which is saved back to it.
+// When the image is created through imgutil.NewImageFromRef, the daemon is configured from the environment, as with `docker` itself,
+// falling back to podman's socket when there is no docker socket; podman compatibility is then enabled as needed.
+func NewImageFromRef(ref string, dockerClient DockerClient, ops ...imgutil.ImageOption) (*Image, error) {
+	return NewImage(ref, dockerClient, append([]imgutil.ImageOption{FromBaseImage(ref)}, ops...)...)
+}
@@ -0,0 +1,99 @@
+package local_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/errdefs"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRepoDigest(t *testing.T) {
+	spec.Run(t, "RepoDigest", testRepoDigest, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+const (
+	someImageID  = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	otherImageID = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	someDigest   = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+)
+
+// listingClient is a DockerClient whose daemon only resolves images by ID, and lists them with their repo digests.
+type listingClient struct {
+	local.DockerClient
+	images []image.Summary
+}
+
+func (c listingClient) ServerVersion(context.Context) (types.Version, error) {
+	return types.Version{Os: "linux", Arch: "amd64"}, nil
+}
+
+func (c listingClient) ImageInspectWithRaw(_ context.Context, ref string) (types.ImageInspect, []byte, error) {
+	for _, summary := range c.images {
+		if summary.ID == ref {
+			return types.ImageInspect{
+				ID:           summary.ID,
+				Os:           "linux",
+				Architecture: "amd64",
+				Config:       &container.Config{Labels: summary.Labels},
+				RootFS:       types.RootFS{Type: "layers"},
+			}, nil, nil
+		}
+	}
+	return types.ImageInspect{}, nil, errdefs.NotFound(errors.New("no such image: " + ref))
+}
+
+func (c listingClient) ImageHistory(context.Context, string) ([]image.HistoryResponseItem, error) {
+	return nil, nil
+}
+
+func (c listingClient) ImageList(context.Context, image.ListOptions) ([]image.Summary, error) {
+	return c.images, nil
+}
+
+func testRepoDigest(t *testing.T, when spec.G, it spec.S) {
+	it("finds a base image referred to by digest from the repo digests of the daemon images", func() {
+		dockerClient := listingClient{images: []image.Summary{
+			{ID: otherImageID, RepoDigests: []string{"other.io/some/repo@" + someDigest}, Labels: map[string]string{"which": "other-repo"}},
+			{ID: someImageID, RepoDigests: []string{"some.io/some/repo@" + someDigest}, Labels: map[string]string{"which": "same-repo"}},
+		}}
+
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage("some.io/some/repo@"+someDigest))
+		h.AssertNil(t, err)
+		label, err := img.Label("which")
+		h.AssertNil(t, err)
+		h.AssertEq(t, label, "same-repo")
+	})
+
+	it("falls back to an image with the digest in another repository", func() {
+		dockerClient := listingClient{images: []image.Summary{
+			{ID: otherImageID, RepoDigests: []string{"other.io/some/repo@" + someDigest}, Labels: map[string]string{"which": "other-repo"}},
+		}}
+
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage("some.io/some/repo@"+someDigest))
+		h.AssertNil(t, err)
+		label, err := img.Label("which")
+		h.AssertNil(t, err)
+		h.AssertEq(t, label, "other-repo")
+	})
+
+	it("does not find images by tag", func() {
+		dockerClient := listingClient{images: []image.Summary{
+			{ID: someImageID, RepoDigests: []string{"some.io/some/repo@" + someDigest}, Labels: map[string]string{"which": "same-repo"}},
+		}}
+
+		img, err := local.NewImage("some-image", dockerClient, local.FromBaseImage("some.io/some/repo:latest"))
+		h.AssertNil(t, err)
+		label, err := img.Label("which")
+		h.AssertNil(t, err)
+		h.AssertEq(t, label, "")
+	})
+}
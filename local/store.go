@@ -2,6 +2,7 @@ package local
 
 import (
 	"archive/tar"
+	"bufio"
 	"context"
 	"crypto/sha256"
 	"encoding/json"
@@ -15,12 +16,14 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/system"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/api/types/versions"
 	"github.com/docker/docker/pkg/jsonmessage"
 	registryName "github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/tarball"
-	"golang.org/x/sync/errgroup"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
 
 	"github.com/buildpacks/imgutil"
 )
@@ -32,8 +35,19 @@ type Store struct {
 	// required
 	dockerClient DockerClient
 	// optional
+	compressLayers       bool
+	zstdLayers           bool
+	gzipLevel            int
+	diffIDProvider       imgutil.DiffIDProvider
+	podman               bool
+	ociLoadFormat        bool
 	downloadOnce         *sync.Once
 	onDiskLayersByDiffID map[v1.Hash]annotatedLayer
+	tempFiles            *imgutil.TempFiles
+	layerCache           *layerCache
+	inspects             *inspectCache
+	logger               imgutil.Logger
+	metrics              imgutil.MetricsHook
 }
 
 // DockerClient is subset of client.CommonAPIClient required by this package.
@@ -57,6 +71,7 @@ func NewStore(dockerClient DockerClient) *Store {
 	return &Store{
 		dockerClient:         dockerClient,
 		downloadOnce:         &sync.Once{},
+		inspects:             newInspectCache(dockerClient),
 		onDiskLayersByDiffID: make(map[v1.Hash]annotatedLayer),
 	}
 }
@@ -64,8 +79,8 @@ func NewStore(dockerClient DockerClient) *Store {
 // images
 
 func (s *Store) Contains(identifier string) bool {
-	_, _, err := s.dockerClient.ImageInspectWithRaw(context.Background(), identifier)
-	return err == nil
+	inspect, err := s.inspects.inspect(identifier)
+	return err == nil && inspect != nil
 }
 
 func (s *Store) Delete(identifier string) error {
@@ -77,6 +92,7 @@ func (s *Store) Delete(identifier string) error {
 		PruneChildren: true,
 	}
 	_, err := s.dockerClient.ImageRemove(context.Background(), identifier, options)
+	s.inspects.reset()
 	return err
 }
 
@@ -88,7 +104,7 @@ func (s *Store) Save(image *Image, withName string, withAdditionalNames ...strin
 	)
 
 	// save
-	canOmitBaseLayers := !usesContainerdStorage(s.dockerClient)
+	canOmitBaseLayers := !s.podman && !usesContainerdStorage(s.dockerClient)
 	if canOmitBaseLayers {
 		// During the first save attempt some layers may be excluded.
 		// The docker daemon allows this if the given set of layers already exists in the daemon in the given order.
@@ -115,6 +131,7 @@ func (s *Store) Save(image *Image, withName string, withAdditionalNames ...strin
 			errs = append(errs, imgutil.SaveDiagnostic{ImageName: n, Cause: err})
 		}
 	}
+	s.inspects.forget(withAdditionalNames...)
 	if len(errs) > 0 {
 		return "", imgutil.SaveError{Errors: errs}
 	}
@@ -138,7 +155,7 @@ func usesContainerdStorage(docker DockerClient) bool {
 	}
 
 	for _, driverStatus := range info.DriverStatus {
-		if driverStatus[0] == "driver-type" && driverStatus[1] == "io.containerd.snapshotter.v1" {
+		if len(driverStatus) == 2 && driverStatus[0] == "driver-type" && driverStatus[1] == "io.containerd.snapshotter.v1" {
 			return true
 		}
 	}
@@ -146,57 +163,179 @@ func usesContainerdStorage(docker DockerClient) bool {
 	return false
 }
 
+// Daemons load layers compressed with gzip from image tars since API version 1.22 (Docker 1.10),
+// and layers compressed with zstd since API version 1.42 (Docker 23.0).
+const (
+	minGzipLayersAPIVersion = "1.22"
+	minZstdLayersAPIVersion = "1.42"
+)
+
+// loadableCompressions reports whether the daemon loads layers compressed with gzip, and with zstd, from image tars.
+// Podman and daemons using the containerd image store load zstd layers whatever their API version.
+func loadableCompressions(docker DockerClient, podman bool) (gzip, zstd bool, err error) {
+	version, err := docker.ServerVersion(context.Background())
+	if err != nil {
+		return false, false, err
+	}
+	if versions.LessThan(version.APIVersion, minGzipLayersAPIVersion) {
+		return false, false, nil
+	}
+	return true, podman || !versions.LessThan(version.APIVersion, minZstdLayersAPIVersion) || usesContainerdStorage(docker), nil
+}
+
+// tarBufferSize bounds how much of the image tar is held in memory while it is streamed to its destination.
+const tarBufferSize = 1 << 20
+
 func (s *Store) doSave(image v1.Image, withName string) (types.ImageInspect, error) {
 	ctx := context.Background()
-	done := make(chan error)
+	done := make(chan error, 1)
 
-	var err error
+	// Stream the tar to the daemon as it is produced, so that the whole image is never buffered in memory.
 	pr, pw := io.Pipe()
-	defer pw.Close()
-
 	go func() {
-		var res types.ImageLoadResponse
-		res, err = s.dockerClient.ImageLoad(ctx, pr, true)
-		if err != nil {
-			done <- err
-			return
-		}
-
-		// only return the response error after the response is drained and closed
-		responseErr := checkResponseError(res.Body)
-		drainCloseErr := ensureReaderClosed(res.Body)
-		if responseErr != nil {
-			done <- responseErr
-			return
-		}
-		if drainCloseErr != nil {
-			done <- drainCloseErr
-		}
-
-		done <- nil
+		err := s.loadImage(ctx, pr)
+		// unblock the tar producer if the daemon stopped reading early
+		pr.CloseWithError(err)
+		done <- err
 	}()
 
-	tw := tar.NewWriter(pw)
-	defer tw.Close()
-
-	if err = s.addImageToTar(tw, image, withName); err != nil {
+	imgutil.Debugf(s.logger, "loading %s into the daemon", withName)
+	writeTar := s.writeImageTar
+	if s.ociLoadFormat && (s.podman || usesContainerdStorage(s.dockerClient)) {
+		writeTar = s.writeOCIImageTar
+	}
+	end := imgutil.StartOperation(s.metrics, imgutil.OperationDaemonLoad, withName)
+	tarball := &countingWriter{w: pw}
+	if err := writeTar(tarball, image, withName); err != nil {
+		pw.CloseWithError(err)
+		<-done
+		end(0, err)
 		return types.ImageInspect{}, err
 	}
-	tw.Close()
 	pw.Close()
-	err = <-done
-	if err != nil {
+	if err := <-done; err != nil {
+		end(0, err)
 		return types.ImageInspect{}, fmt.Errorf("loading image %q. first error: %w", withName, err)
 	}
+	end(tarball.n, nil)
 
-	inspect, _, err := s.dockerClient.ImageInspectWithRaw(context.Background(), withName)
+	// the name now refers to the loaded image, which is cached for later inspects, e.g. when the image is deleted
+	s.inspects.forget(withName)
+	inspect, err := s.inspects.inspect(withName)
 	if err != nil {
-		if client.IsErrNotFound(err) {
-			return types.ImageInspect{}, fmt.Errorf("saving image %q: %w", withName, err)
-		}
 		return types.ImageInspect{}, err
 	}
-	return inspect, nil
+	if inspect == nil {
+		return types.ImageInspect{}, fmt.Errorf("saving image %q: no such image in the daemon", withName)
+	}
+	return *inspect, nil
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// LoadImage loads an image from another source, e.g. an OCI layout, into the daemon, tagged with withName,
+// and returns its identifier. It is sent as an OCI archive, which keeps its digest, if the daemon uses the containerd image store,
+// and as a docker archive otherwise.
+func LoadImage(dockerClient DockerClient, image v1.Image, withName string) (string, error) {
+	store := NewStore(dockerClient)
+	store.ociLoadFormat = true
+	inspect, err := store.doSave(image, tryNormalizing(withName))
+	if err != nil {
+		return "", err
+	}
+	return inspect.ID, nil
+}
+
+// loadImage sends the tar read from the provided reader to the daemon,
+// returning any error embedded in the daemon response after the response is drained and closed.
+func (s *Store) loadImage(ctx context.Context, input io.Reader) error {
+	res, err := s.dockerClient.ImageLoad(ctx, input, true)
+	if err != nil {
+		return err
+	}
+	responseErr := checkResponseError(res.Body)
+	drainCloseErr := ensureReaderClosed(res.Body)
+	if responseErr != nil {
+		return responseErr
+	}
+	return drainCloseErr
+}
+
+// writeImageTar writes the image as a docker-load tar to w, through a buffer of at most tarBufferSize bytes.
+func (s *Store) writeImageTar(w io.Writer, image v1.Image, withName string) error {
+	bw := bufio.NewWriterSize(w, tarBufferSize)
+	tw := tar.NewWriter(bw)
+	if err := s.addImageToTar(tw, image, withName); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeOCIImageTar writes the image as an OCI layout tar, which the containerd image store loads as-is.
+// Layers that only exist in the daemon are replaced with their downloaded counterparts,
+// so they must have been downloaded beforehand.
+func (s *Store) writeOCIImageTar(w io.Writer, image v1.Image, withName string) error {
+	image, err := s.withDownloadedLayers(image)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(w, tarBufferSize)
+	if err = imgutil.WriteArchive(bw, image, withName, imgutil.OCIArchive); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// withDownloadedLayers returns the image with any daemon layers replaced by layers from the store.
+// If the image has no daemon layers, it is returned unchanged so that its manifest digest is preserved.
+func (s *Store) withDownloadedLayers(image v1.Image) (v1.Image, error) {
+	layers, err := image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	var replaced bool
+	for idx, layer := range layers {
+		if _, isDaemonLayer := layer.(*v1LayerFacade); !isDaemonLayer {
+			continue
+		}
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return nil, err
+		}
+		if layers[idx], err = s.LayerByDiffID(diffID); err != nil {
+			return nil, err
+		}
+		replaced = true
+	}
+	if !replaced {
+		return image, nil
+	}
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	mediaType, err := image.MediaType()
+	if err != nil {
+		return nil, err
+	}
+	requestedTypes := imgutil.DockerTypes
+	if mediaType == v1types.OCIManifestSchema1 {
+		requestedTypes = imgutil.OCITypes
+	}
+	return imageFrom(layers, configFile.DeepCopy(), requestedTypes)
 }
 
 func (s *Store) addImageToTar(tw *tar.Writer, image v1.Image, withName string) error {
@@ -239,6 +378,12 @@ func (s *Store) addImageToTar(tw *tar.Writer, image v1.Image, withName string) e
 }
 
 func (s *Store) addLayerToTar(tw *tar.Writer, layer v1.Layer, blankIdx int) (string, error) {
+	if _, isDaemonLayer := layer.(*v1LayerFacade); s.compressLayers && !isDaemonLayer {
+		if extension, ok := s.compressedLayerExtension(layer); ok {
+			return addCompressedLayerToTar(tw, layer, extension)
+		}
+	}
+
 	// If the layer is a previous image layer that hasn't been downloaded yet,
 	// cause ALL the previous image layers to be downloaded by grabbing the ReadCloser.
 	layerReader, err := layer.Uncompressed()
@@ -248,14 +393,18 @@ func (s *Store) addLayerToTar(tw *tar.Writer, layer v1.Layer, blankIdx int) (str
 	defer layerReader.Close()
 
 	var layerName string
-	size, err := layer.Size()
-	if err != nil {
-		return "", err
-	}
-	if size == -1 { // it's a base (always empty) layer
-		layerName = fmt.Sprintf("blank_%d", blankIdx)
-		hdr := &tar.Header{Name: layerName, Mode: 0644, Size: 0}
-		return layerName, tw.WriteHeader(hdr)
+	// only daemon layers can be blank; the size of other layers is not needed, and may be costly to compute
+	if facade, isDaemonLayer := layer.(*v1LayerFacade); isDaemonLayer {
+		size, err := facade.Size()
+		if err != nil {
+			return "", err
+		}
+		if size == -1 { // it's a base (always empty) layer
+			imgutil.Debugf(s.logger, "omitting layer %s, which the daemon has", facade.diffID)
+			layerName = fmt.Sprintf("blank_%d", blankIdx)
+			hdr := &tar.Header{Name: layerName, Mode: 0644, Size: 0}
+			return layerName, tw.WriteHeader(hdr)
+		}
 	}
 	// it's a populated layer
 	layerDiffID, err := layer.DiffID()
@@ -263,6 +412,7 @@ func (s *Store) addLayerToTar(tw *tar.Writer, layer v1.Layer, blankIdx int) (str
 		return "", err
 	}
 	layerName = fmt.Sprintf("/%s.tar", layerDiffID.String())
+	imgutil.Debugf(s.logger, "loading layer %s", layerDiffID)
 
 	uncompressedSize, err := s.getLayerSize(layer)
 	if err != nil {
@@ -279,6 +429,53 @@ func (s *Store) addLayerToTar(tw *tar.Writer, layer v1.Layer, blankIdx int) (str
 	return layerName, nil
 }
 
+// compressedLayerExtension returns the extension of the entry of the layer when it is sent compressed,
+// or false if the layer must be sent uncompressed, because its blob is not compressed with gzip or zstd,
+// or is compressed with zstd, which the daemon does not load.
+func (s *Store) compressedLayerExtension(layer v1.Layer) (string, bool) {
+	mediaType, err := layer.MediaType()
+	if err != nil {
+		return "", false
+	}
+	switch mediaType {
+	case v1types.DockerLayer, v1types.OCILayer, v1types.OCIRestrictedLayer:
+		return ".tar.gz", true
+	case v1types.OCILayerZStd:
+		return ".tar.zst", s.zstdLayers
+	default:
+		return "", false
+	}
+}
+
+// addCompressedLayerToTar adds the compressed layer to the tar, in an entry with the extension of its compression.
+// The daemon detects the compression when loading the image,
+// so layers that are already compressed (e.g., from a remote base image) can be copied without recompressing them.
+func addCompressedLayerToTar(tw *tar.Writer, layer v1.Layer, extension string) (string, error) {
+	layerDigest, err := layer.Digest()
+	if err != nil {
+		return "", err
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return "", err
+	}
+	layerReader, err := layer.Compressed()
+	if err != nil {
+		return "", err
+	}
+	defer layerReader.Close()
+
+	layerName := fmt.Sprintf("/%s%s", layerDigest.String(), extension)
+	hdr := &tar.Header{Name: layerName, Mode: 0644, Size: size}
+	if err = tw.WriteHeader(hdr); err != nil {
+		return "", err
+	}
+	if _, err = io.Copy(tw, layerReader); err != nil {
+		return "", err
+	}
+	return layerName, nil
+}
+
 // getLayerSize returns the uncompressed layer size.
 // This is needed because the daemon expects uncompressed layer size and a v1.Layer reports compressed layer size;
 // in a future where we send OCI layout tars to the daemon we should be able to remove this method
@@ -344,7 +541,7 @@ func ensureReaderClosed(r io.ReadCloser) error {
 func (s *Store) SaveFile(image *Image, withName string) (string, error) {
 	withName = tryNormalizing(withName)
 
-	f, err := os.CreateTemp("", "imgutil.local.image.export.*.tar")
+	f, err := os.CreateTemp(s.tempFiles.Dir(), "imgutil.local.image.export.*.tar")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temporary file: %w", err)
 	}
@@ -363,31 +560,51 @@ func (s *Store) SaveFile(image *Image, withName string) (string, error) {
 		return "", err
 	}
 
-	errs, _ := errgroup.WithContext(context.Background())
-	pr, pw := io.Pipe()
+	if err = s.writeImageTar(f, image, withName); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
 
-	// File writer
-	errs.Go(func() error {
-		defer pr.Close()
-		_, err = f.ReadFrom(pr)
+// SaveTo writes the image to w in the format produced by `docker save`.
+func (s *Store) SaveTo(w io.Writer, image *Image, withName string) error {
+	if err := image.ensureLayers(); err != nil {
 		return err
-	})
-
-	// Tar producer
-	errs.Go(func() error {
-		defer pw.Close()
-
-		tw := tar.NewWriter(pw)
-		defer tw.Close()
+	}
+	return s.writeImageTar(w, image, tryNormalizing(withName))
+}
 
-		return s.addImageToTar(tw, image, withName)
-	})
+// SaveToLayout writes the image to an OCI layout directory at path, with OCI media types and its name as ref name annotation,
+// holding the layout lock while writing; see imgutil.LockDir.
+func (s *Store) SaveToLayout(path string, image *Image, withName string) error {
+	if err := image.ensureLayers(); err != nil {
+		return err
+	}
+	ociImage, err := s.withDownloadedLayers(image)
+	if err != nil {
+		return err
+	}
+	if ociImage, _, err = imgutil.EnsureMediaTypesAndLayers(ociImage, imgutil.OCITypes, imgutil.PreserveLayers); err != nil {
+		return err
+	}
 
-	err = errs.Wait()
+	unlock, err := imgutil.LockDir(path, 0)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return f.Name(), nil
+	defer unlock()
+	end := imgutil.StartOperation(s.metrics, imgutil.OperationLayoutWrite, path)
+	imgutil.Debugf(s.logger, "writing %s to %s", withName, path)
+	layoutPath, err := layout.Write(path, empty.Index)
+	if err == nil {
+		err = layoutPath.AppendImage(ociImage, layout.WithAnnotations(map[string]string{imgutil.OCIRefNameAnnotation: withName}))
+	}
+	var size int64
+	if err == nil {
+		size, _ = imgutil.ImageSize(ociImage)
+	}
+	end(size, err)
+	return err
 }
 
 // layers
@@ -400,7 +617,7 @@ func (s *Store) downloadLayersFor(identifier string) error {
 	return err
 }
 
-func (s *Store) doDownloadLayersFor(identifier string) error {
+func (s *Store) doDownloadLayersFor(identifier string) (err error) {
 	if identifier == "" {
 		return nil
 	}
@@ -412,10 +629,16 @@ func (s *Store) doDownloadLayersFor(identifier string) error {
 	}
 	defer ensureReaderClosed(imageReader)
 
-	tmpDir, err := os.MkdirTemp("", "imgutil.local.image.")
+	tmpDir, err := s.tempFiles.MkdirTemp("imgutil.local.image.")
 	if err != nil {
 		return fmt.Errorf("failed to create temp dir: %w", err)
 	}
+	// the extracted layers are read lazily, so the directory is only removed here on failure
+	defer func() {
+		if err != nil {
+			_ = s.tempFiles.Discard(tmpDir)
+		}
+	}()
 
 	err = untar(imageReader, tmpDir)
 	if err != nil {
@@ -455,11 +678,58 @@ func (s *Store) doDownloadLayersFor(identifier string) error {
 
 	for idx := range configFile.RootFS.DiffIDs {
 		layerPath := filepath.Join(tmpDir, manifest[0].Layers[idx])
-		if _, err := s.AddLayer(layerPath); err != nil {
+		layer, err := s.AddLayer(layerPath)
+		if err != nil {
 			return err
 		}
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return err
+		}
+		if err = s.layerCache.put(diffID, layerPath); err != nil {
+			return fmt.Errorf("caching layer %s: %w", diffID, err)
+		}
 	}
-	return nil
+	return s.layerCache.evict()
+}
+
+// addCachedLayers adds the layers with the given diff IDs that are in the layer cache to the store,
+// and reports whether all of them are now in the store.
+func (s *Store) addCachedLayers(diffIDs ...v1.Hash) (bool, error) {
+	all := true
+	var tmpDir string
+	for _, diffID := range diffIDs {
+		if s.findLayer(diffID) != nil {
+			continue
+		}
+		if _, ok := s.layerCache.get(diffID); !ok {
+			all = false
+			continue
+		}
+		if tmpDir == "" {
+			var err error
+			// the cached layers are checked out into the store, as the layer cache may evict them while they are still read
+			if tmpDir, err = s.tempFiles.MkdirTemp("imgutil.local.cached."); err != nil {
+				return false, fmt.Errorf("failed to create temp dir: %w", err)
+			}
+		}
+		path, ok := s.layerCache.checkout(diffID, tmpDir)
+		if !ok {
+			all = false
+			continue
+		}
+		if _, err := s.addLayerWithDiffIDProvider(path, knownDiffID(diffID)); err != nil {
+			return false, err
+		}
+	}
+	return all, nil
+}
+
+// knownDiffID is a DiffIDProvider for a layer file whose diff ID is known, such as a layer in the layer cache.
+type knownDiffID v1.Hash
+
+func (d knownDiffID) DiffID(string) (v1.Hash, error) {
+	return v1.Hash(d), nil
 }
 
 func untar(r io.Reader, dest string) error {
@@ -529,7 +799,7 @@ func cleanPath(dest, header string) (string, error) {
 func (s *Store) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
 	layer := s.findLayer(h)
 	if layer == nil {
-		return nil, fmt.Errorf("failed to find layer with diff ID %q", h.String())
+		return nil, imgutil.ErrLayerNotFound{DiffID: h.String()}
 	}
 	return layer, nil
 }
@@ -543,7 +813,10 @@ func (s *Store) findLayer(withHash v1.Hash) v1.Layer {
 }
 
 func (s *Store) AddLayer(fromPath string) (v1.Layer, error) {
-	layer, err := tarball.LayerFromFile(fromPath)
+	if s.diffIDProvider != nil {
+		return s.addLayerWithDiffIDProvider(fromPath, s.diffIDProvider)
+	}
+	layer, err := tarball.LayerFromFile(fromPath, imgutil.GzipLayerOptions(s.gzipLevel)...)
 	if err != nil {
 		return nil, err
 	}
@@ -578,3 +851,33 @@ func (s *Store) AddLayer(fromPath string) (v1.Layer, error) {
 	}
 	return layer, nil
 }
+
+// addLayerWithDiffIDProvider adds the layer without reading it, as its diff ID is obtained from the provider
+// and, unless it is compressed, its uncompressed size is the size of the file.
+func (s *Store) addLayerWithDiffIDProvider(fromPath string, provider imgutil.DiffIDProvider) (v1.Layer, error) {
+	layer, err := imgutil.LayerFromFile(fromPath, provider, imgutil.GzipLayerOptions(s.gzipLevel)...)
+	if err != nil {
+		return nil, err
+	}
+	diffID, err := layer.DiffID()
+	if err != nil {
+		return nil, err
+	}
+	uncompressedSize := int64(-1)
+	compressed, err := imgutil.IsCompressedLayerFile(fromPath)
+	if err != nil {
+		return nil, err
+	}
+	if !compressed {
+		fi, err := os.Stat(fromPath)
+		if err != nil {
+			return nil, err
+		}
+		uncompressedSize = fi.Size()
+	}
+	s.onDiskLayersByDiffID[diffID] = annotatedLayer{
+		layer:            layer,
+		uncompressedSize: uncompressedSize,
+	}
+	return layer, nil
+}
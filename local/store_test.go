@@ -0,0 +1,200 @@
+package local_test
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/system"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	v1types "github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/layout"
+	"github.com/buildpacks/imgutil/local"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestStore(t *testing.T) {
+	spec.Run(t, "Store", testStore, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// streamingClient is a DockerClient whose daemon reads the tar loaded into it as it is streamed,
+// stopping with stopErr once it has read stopAfter bytes, if set.
+type streamingClient struct {
+	local.DockerClient
+	stopAfter int64
+	stopErr   error
+	read      int64
+	readErr   error
+}
+
+func (c *streamingClient) Info(context.Context) (system.Info, error) {
+	return system.Info{}, nil
+}
+
+func (c *streamingClient) ImageLoad(_ context.Context, input io.Reader, _ bool) (types.ImageLoadResponse, error) {
+	if c.stopErr != nil {
+		c.read, c.readErr = io.CopyN(io.Discard, input, c.stopAfter)
+		return types.ImageLoadResponse{}, c.stopErr
+	}
+	c.read, c.readErr = io.Copy(io.Discard, input)
+	return types.ImageLoadResponse{}, c.readErr
+}
+
+// entriesClient is a DockerClient whose daemon records the entries of the tars loaded into it.
+type entriesClient struct {
+	local.DockerClient
+	containerd bool
+	entries    []string
+	loaded     bool
+}
+
+func (c *entriesClient) Info(context.Context) (system.Info, error) {
+	info := system.Info{}
+	if c.containerd {
+		info.DriverStatus = [][2]string{{"driver-type", "io.containerd.snapshotter.v1"}}
+	}
+	return info, nil
+}
+
+func (c *entriesClient) ImageLoad(_ context.Context, input io.Reader, _ bool) (types.ImageLoadResponse, error) {
+	tr := tar.NewReader(input)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return types.ImageLoadResponse{}, err
+		}
+		c.entries = append(c.entries, hdr.Name)
+	}
+	c.loaded = true
+	return types.ImageLoadResponse{Body: io.NopCloser(strings.NewReader(`{"stream":"Loaded image"}`))}, nil
+}
+
+func (c *entriesClient) ImageInspectWithRaw(context.Context, string) (types.ImageInspect, []byte, error) {
+	if !c.loaded {
+		return types.ImageInspect{}, nil, errors.New("no such image")
+	}
+	return types.ImageInspect{ID: "some-id"}, nil, nil
+}
+
+// failingLayer is a layer whose uncompressed contents fail with err after `after` bytes.
+type failingLayer struct {
+	v1.Layer
+	after int64
+	err   error
+}
+
+func (l *failingLayer) Uncompressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Uncompressed()
+	if err != nil {
+		return nil, err
+	}
+	return &failingReader{ReadCloser: rc, remaining: l.after, err: l.err}, nil
+}
+
+type failingReader struct {
+	io.ReadCloser
+	remaining int64
+	err       error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		return 0, r.err
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+func testStore(t *testing.T, when spec.G, it spec.S) {
+	// loadImage loads the image into the daemon, failing the test if the load does not return in time.
+	loadImage := func(dockerClient local.DockerClient, image v1.Image) error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := local.LoadImage(dockerClient, image, "some/image")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(30 * time.Second):
+			t.Fatal("loading the image did not return")
+			return nil
+		}
+	}
+
+	when("#LoadImage", func() {
+		var image v1.Image
+
+		it.Before(func() {
+			var err error
+			// the first layer is larger than the buffer of the stream, so that it reaches the daemon before the second one is read
+			image, err = random.Image(2*1024*1024, 1)
+			h.AssertNil(t, err)
+			layer, err := random.Layer(2*1024*1024, v1types.DockerLayer)
+			h.AssertNil(t, err)
+			image, err = mutate.AppendLayers(image, &failingLayer{Layer: layer, after: 1024 * 1024, err: errors.New("some-read-error")})
+			h.AssertNil(t, err)
+		})
+
+		it("fails when the image fails mid-stream", func() {
+			dockerClient := &streamingClient{}
+			err := loadImage(dockerClient, image)
+			h.AssertError(t, err, "some-read-error")
+			h.AssertEq(t, dockerClient.read > 0, true)
+			h.AssertError(t, dockerClient.readErr, "some-read-error")
+		})
+
+		it("fails when the daemon stops reading", func() {
+			dockerClient := &streamingClient{stopAfter: 512, stopErr: context.Canceled}
+			err := loadImage(dockerClient, image)
+			h.AssertError(t, err, context.Canceled.Error())
+			h.AssertEq(t, dockerClient.read, int64(512))
+		})
+
+		when("the image is in a layout", func() {
+			var layoutImage *layout.Image
+
+			it.Before(func() {
+				tmpDir := t.TempDir()
+				var err error
+				layoutImage, err = layout.NewImage(filepath.Join(tmpDir, "image"))
+				h.AssertNil(t, err)
+				path, _, _ := h.RandomLayer(t, tmpDir)
+				h.AssertNil(t, layoutImage.AddLayer(path))
+				h.AssertNil(t, layoutImage.Save())
+			})
+
+			it("loads it as a docker archive into a daemon with the classic image store", func() {
+				dockerClient := &entriesClient{}
+				h.AssertNil(t, loadImage(dockerClient, layoutImage))
+				h.AssertContains(t, dockerClient.entries, "manifest.json")
+				h.AssertDoesNotContain(t, dockerClient.entries, "index.json")
+			})
+
+			it("loads it as an OCI archive into a daemon with the containerd image store", func() {
+				dockerClient := &entriesClient{containerd: true}
+				h.AssertNil(t, loadImage(dockerClient, layoutImage))
+				h.AssertContains(t, dockerClient.entries, "index.json")
+				h.AssertContains(t, dockerClient.entries, "oci-layout")
+			})
+		})
+	})
+}
@@ -184,11 +184,16 @@ type v1LayerFacade struct {
 	diffID           v1.Hash
 	uncompressed     func() (io.ReadCloser, error)
 	uncompressedSize func() (int64, error)
+	// download, if set, downloads the layers of the image the layer belongs to
+	download func() error
+	// downloaded reports if the layer data is in the store
+	downloaded func() bool
 }
 
 func newEmptyLayer(diffID v1.Hash, store *Store) *v1LayerFacade {
 	return &v1LayerFacade{
-		diffID: diffID,
+		diffID:     diffID,
+		downloaded: func() bool { return store.findLayer(diffID) != nil },
 		uncompressed: func() (io.ReadCloser, error) {
 			layer, err := store.LayerByDiffID(diffID)
 			if err == nil {
@@ -208,15 +213,23 @@ func newEmptyLayer(diffID v1.Hash, store *Store) *v1LayerFacade {
 
 func newDownloadableEmptyLayer(diffID v1.Hash, store *Store, imageID string) *v1LayerFacade {
 	return &v1LayerFacade{
-		diffID: diffID,
+		diffID:     diffID,
+		download:   func() error { return store.downloadLayersFor(imageID) },
+		downloaded: func() bool { return store.findLayer(diffID) != nil },
 		uncompressed: func() (io.ReadCloser, error) {
 			layer, err := store.LayerByDiffID(diffID)
 			if err == nil {
 				return layer.Uncompressed()
 			}
-			if err = store.downloadLayersFor(imageID); err != nil {
+			cached, err := store.addCachedLayers(diffID)
+			if err != nil {
 				return nil, err
 			}
+			if !cached {
+				if err = store.downloadLayersFor(imageID); err != nil {
+					return nil, err
+				}
+			}
 			layer, err = store.LayerByDiffID(diffID)
 			if err == nil {
 				return layer.Uncompressed()
@@ -0,0 +1,123 @@
+package imgutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// DefaultLockTimeout is how long LockDir waits for a lock held by another process when no timeout is provided.
+const DefaultLockTimeout = time.Minute
+
+const lockRetryInterval = 50 * time.Millisecond
+
+// ErrLockTimeout is returned when a layout directory could not be locked before the timeout expired,
+// because another process (or another writer in this process) holds its lock.
+type ErrLockTimeout struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e ErrLockTimeout) Error() string {
+	return fmt.Sprintf("timed out after %s waiting for lock on %s", e.Timeout, e.Path)
+}
+
+// LockDir takes an advisory, exclusive lock on the layout directory at path, waiting up to timeout
+// (or DefaultLockTimeout, if zero) for other holders to release it. The lock is held on a sibling "<path>.lock" file,
+// so that it survives the directory being removed and rewritten; it only excludes other callers of LockDir and RLockDir.
+// The returned function releases the lock.
+func LockDir(path string, timeout time.Duration) (func() error, error) {
+	lockPath := lockPathFor(path)
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+		return nil, err
+	}
+	return lockFile(path, timeout, false, func() (*os.File, error) {
+		return os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	})
+}
+
+// RLockDir takes an advisory, shared lock on the layout directory at path for reading it, as LockDir does,
+// so that readers do not wait for each other but are not interleaved with writers.
+// The lock file is not created when it does not exist, so that read-only directories can be read:
+// a layout that was never locked has no writer to wait for.
+func RLockDir(path string, timeout time.Duration) (func() error, error) {
+	lockPath := lockPathFor(path)
+	unlock, err := lockFile(path, timeout, true, func() (*os.File, error) {
+		return os.Open(filepath.Clean(lockPath))
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return func() error { return nil }, nil
+	}
+	return unlock, err
+}
+
+// RemoveLockFile removes the lock file of the layout directory at path, for a holder of LockDir that removes the directory.
+// Waiters that then take the lock notice that the file was removed and lock a new one.
+// On Windows, where files that are open cannot be removed, the lock file is kept.
+func RemoveLockFile(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	if err := os.Remove(lockPathFor(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// lockPathFor returns the path of the lock file of the directory, as a LongPath so that it can be created next to
+// directories with long names on Windows.
+func lockPathFor(path string) string {
+	return LongPath(filepath.Clean(path) + ".lock")
+}
+
+// lockFile locks the file returned by open, retrying until the timeout expires.
+// The lock is taken again if the lock file was removed or replaced while waiting for it.
+func lockFile(path string, timeout time.Duration, shared bool, open func() (*os.File, error)) (func() error, error) {
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := open()
+		if err != nil {
+			return nil, fmt.Errorf("opening lock file: %w", err)
+		}
+		locked, err := tryLockFile(f, shared)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+		if locked {
+			if isCurrentLockFile(f, lockPathFor(path)) {
+				return func() error {
+					unlockErr := unlockFile(f)
+					if err := f.Close(); unlockErr == nil {
+						unlockErr = err
+					}
+					return unlockErr
+				}, nil
+			}
+			_ = unlockFile(f)
+			f.Close()
+			continue
+		}
+		f.Close()
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout{Path: path, Timeout: timeout}
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// isCurrentLockFile reports whether the locked file is still the lock file at lockPath, and was not removed by RemoveLockFile.
+func isCurrentLockFile(f *os.File, lockPath string) bool {
+	locked, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	current, err := os.Stat(lockPath)
+	return err == nil && os.SameFile(locked, current)
+}
@@ -0,0 +1,14 @@
+//go:build !unix && !windows
+
+package imgutil
+
+import "os"
+
+// tryLockFile always succeeds on platforms without file locking.
+func tryLockFile(_ *os.File, _ bool) (bool, error) {
+	return true, nil
+}
+
+func unlockFile(_ *os.File) error {
+	return nil
+}
@@ -0,0 +1,144 @@
+package imgutil_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestLock(t *testing.T) {
+	spec.Run(t, "Lock", testLock, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testLock(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "lock-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	when("#LockDir", func() {
+		it("waits for the holder to release the lock", func() {
+			path := filepath.Join(tmpDir, "some-index")
+			unlock, err := imgutil.LockDir(path, time.Second)
+			h.AssertNil(t, err)
+
+			_, err = imgutil.LockDir(path, 100*time.Millisecond)
+			var timeoutErr imgutil.ErrLockTimeout
+			h.AssertEq(t, errors.As(err, &timeoutErr), true)
+			h.AssertEq(t, timeoutErr.Path, path)
+
+			released := make(chan struct{})
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				h.AssertNil(t, unlock())
+				close(released)
+			}()
+			unlockAgain, err := imgutil.LockDir(path, 5*time.Second)
+			h.AssertNil(t, err)
+			<-released
+			h.AssertNil(t, unlockAgain())
+		})
+
+		it("takes the lock again when the lock file is removed while waiting", func() {
+			path := filepath.Join(tmpDir, "some-index")
+			unlock, err := imgutil.LockDir(path, time.Second)
+			h.AssertNil(t, err)
+
+			released := make(chan struct{})
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				h.AssertNil(t, imgutil.RemoveLockFile(path))
+				h.AssertNil(t, unlock())
+				close(released)
+			}()
+			unlockAgain, err := imgutil.LockDir(path, 5*time.Second)
+			h.AssertNil(t, err)
+			<-released
+			h.AssertPathExists(t, path+".lock")
+			h.AssertNil(t, unlockAgain())
+		})
+	})
+
+	when("#RLockDir", func() {
+		it("is shared by readers and excludes writers", func() {
+			path := filepath.Join(tmpDir, "some-index")
+			h.AssertNil(t, os.WriteFile(path+".lock", nil, 0600))
+			unlock, err := imgutil.RLockDir(path, time.Second)
+			h.AssertNil(t, err)
+			unlockReader, err := imgutil.RLockDir(path, 100*time.Millisecond)
+			h.AssertNil(t, err)
+			h.AssertNil(t, unlockReader())
+
+			_, err = imgutil.LockDir(path, 100*time.Millisecond)
+			var timeoutErr imgutil.ErrLockTimeout
+			h.AssertEq(t, errors.As(err, &timeoutErr), true)
+			h.AssertNil(t, unlock())
+		})
+
+		it("does not create the lock file", func() {
+			path := filepath.Join(tmpDir, "some-index")
+			unlock, err := imgutil.RLockDir(path, time.Second)
+			h.AssertNil(t, err)
+			h.AssertNil(t, unlock())
+			h.AssertPathDoesNotExists(t, path+".lock")
+		})
+	})
+
+	when("#SaveDir", func() {
+		it("fails with ErrLockTimeout while another writer holds the index lock", func() {
+			index, err := layout.NewIndex("some-index", imgutil.WithXDGRuntimePath(tmpDir), layout.WithIndexLockTimeout(100*time.Millisecond))
+			h.AssertNil(t, err)
+
+			unlock, err := imgutil.LockDir(filepath.Join(tmpDir, "some-index"), time.Second)
+			h.AssertNil(t, err)
+			err = index.SaveDir()
+			var timeoutErr imgutil.ErrLockTimeout
+			h.AssertEq(t, errors.As(err, &timeoutErr), true)
+
+			h.AssertNil(t, unlock())
+			h.AssertNil(t, index.SaveDir())
+			h.AssertEq(t, index.Found(), true)
+		})
+
+		it("fails with ErrIndexModified when another writer saved the index since it was loaded", func() {
+			index, err := layout.NewIndex("some-index", imgutil.WithXDGRuntimePath(tmpDir))
+			h.AssertNil(t, err)
+			other, err := layout.NewIndex("some-index", imgutil.WithXDGRuntimePath(tmpDir))
+			h.AssertNil(t, err)
+			h.AssertNil(t, other.SetArtifactType("application/vnd.example+json"))
+			h.AssertNil(t, other.SaveDir())
+
+			var modifiedErr imgutil.ErrIndexModified
+			h.AssertEq(t, errors.As(index.SaveDir(), &modifiedErr), true)
+			h.AssertNil(t, other.SaveDir())
+		})
+	})
+
+	when("#DeleteDir", func() {
+		it("removes the lock file of the index", func() {
+			index, err := layout.NewIndex("some-index", imgutil.WithXDGRuntimePath(tmpDir))
+			h.AssertNil(t, err)
+			h.AssertNil(t, index.SaveDir())
+			h.AssertPathExists(t, filepath.Join(tmpDir, "some-index.lock"))
+
+			h.AssertNil(t, index.DeleteDir())
+			h.AssertPathDoesNotExists(t, filepath.Join(tmpDir, "some-index.lock"))
+		})
+	})
+}
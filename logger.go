@@ -0,0 +1,30 @@
+package imgutil
+
+// Logger receives debug messages about what images and indexes do, e.g. the registries they access,
+// the requests they retry and the layers they push, which are otherwise not reported.
+type Logger interface {
+	Debugf(format string, v ...interface{})
+}
+
+// WithLogger sets the logger that image constructors and the images they return report to.
+func WithLogger(logger Logger) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.Logger = logger
+		o.RetryPolicy.Logger = logger
+	}
+}
+
+// WithIndexLogger sets the logger that index constructors and the indexes they return report to.
+func WithIndexLogger(logger Logger) func(*IndexOptions) error {
+	return func(o *IndexOptions) error {
+		o.Logger = logger
+		return nil
+	}
+}
+
+// Debugf reports a debug message to the logger, if it is not nil.
+func Debugf(logger Logger, format string, v ...interface{}) {
+	if logger != nil {
+		logger.Debugf(format, v...)
+	}
+}
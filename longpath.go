@@ -0,0 +1,10 @@
+package imgutil
+
+// LongPath returns the path in a form that is not subject to the 260 character MAX_PATH limit on Windows,
+// by converting it to an absolute, extended-length (`\\?\`) path.
+// Extended-length paths are not normalized by Windows, so they must not contain `.` or `..` elements or forward slashes;
+// LongPath takes care of this for the provided path, but callers must only join clean relative paths onto the result.
+// On other operating systems the path is returned unchanged.
+func LongPath(path string) string {
+	return longPath(path)
+}
@@ -0,0 +1,21 @@
+package imgutil
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+func longPath(path string) string {
+	if path == "" || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNC path: \\server\share -> \\?\UNC\server\share
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
@@ -0,0 +1,283 @@
+package imgutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ManifestCache is an on-disk cache of the manifests and image configs fetched from registries, so that repeated builds
+// against the same base image or index do not fetch them again. Manifests and configs fetched by digest are cached
+// indefinitely, as their content cannot change; the digests that tags resolve to are cached for the TTL of the cache.
+// Cached responses are served without contacting the registry, and so without checking access to the repository:
+// a cache should not be shared between users with different access to registries.
+// A ManifestCache is safe for concurrent use, also by several processes sharing the directory.
+type ManifestCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+
+	mu sync.Mutex
+	// configs are the digests of the configs of the cached image manifests, which are the only blobs that are cached
+	configs map[string]bool
+}
+
+// NewManifestCache returns a cache stored in the given directory, which is created if needed.
+// Tags are resolved from the cache for the given TTL after they were fetched; with a TTL of 0, they are always fetched.
+func NewManifestCache(dir string, ttl time.Duration) (*ManifestCache, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("creating manifest cache: %w", err)
+	}
+	return &ManifestCache{
+		dir:     dir,
+		ttl:     ttl,
+		now:     time.Now,
+		configs: map[string]bool{},
+	}, nil
+}
+
+// Transport returns a transport that answers requests for cached manifests and configs from the cache, and sends other
+// requests with the inner transport, caching the manifests and configs it fetches. If the cache is nil, the inner
+// transport is returned.
+func (c *ManifestCache) Transport(inner http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return inner
+	}
+	return &manifestCacheTransport{cache: c, inner: inner}
+}
+
+type manifestCacheTransport struct {
+	cache *ManifestCache
+	inner http.RoundTripper
+}
+
+// cachedBlob is a cached manifest or config, stored as JSON.
+type cachedBlob struct {
+	MediaType types.MediaType `json:"mediaType"`
+	Content   []byte          `json:"content"`
+}
+
+// cachedTag is the digest a tag resolved to when it was fetched.
+type cachedTag struct {
+	Digest  string    `json:"digest"`
+	Fetched time.Time `json:"fetched"`
+}
+
+func (t *manifestCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	repo, kind, reference, ok := parseRegistryPath(req.URL.Path)
+	if !ok {
+		return t.inner.RoundTrip(req)
+	}
+	repo = req.URL.Host + "/" + repo
+	_, refErr := v1.NewHash(reference)
+	isDigest := refErr == nil
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		if kind == "manifests" && !isDigest {
+			// the tag is pushed or deleted
+			t.cache.removeTag(repo, reference)
+		}
+		return t.inner.RoundTrip(req)
+	}
+	if kind == "blobs" && !t.cache.isConfig(repo, reference) {
+		return t.inner.RoundTrip(req)
+	}
+
+	digest := reference
+	if !isDigest {
+		if digest, ok = t.cache.tag(repo, reference); !ok {
+			return t.fetch(req, repo, kind, reference, isDigest)
+		}
+	}
+	if blob, ok := t.cache.blob(repo, digest); ok {
+		if kind == "manifests" {
+			t.cache.recordConfig(repo, blob)
+		}
+		return blob.response(req, digest), nil
+	}
+	return t.fetch(req, repo, kind, reference, isDigest)
+}
+
+// fetch sends the request with the inner transport, caching the manifest or config it returns.
+func (t *manifestCacheTransport) fetch(req *http.Request, repo, kind, reference string, isDigest bool) (*http.Response, error) {
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || req.Method != http.MethodGet {
+		return resp, err
+	}
+	content, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(content))
+
+	digest, _, err := v1.SHA256(bytes.NewReader(content))
+	if err != nil || (isDigest && digest.String() != reference) {
+		return resp, nil
+	}
+	blob := cachedBlob{MediaType: types.MediaType(resp.Header.Get("Content-Type")), Content: content}
+	if err = t.cache.putBlob(repo, digest.String(), blob); err != nil {
+		return resp, nil
+	}
+	if kind == "manifests" {
+		t.cache.recordConfig(repo, blob)
+		if !isDigest {
+			_ = t.cache.putTag(repo, reference, digest.String())
+		}
+	}
+	return resp, nil
+}
+
+// parseRegistryPath splits a path of the distribution API such as /v2/<repo>/manifests/<reference>.
+func parseRegistryPath(path string) (repo, kind, reference string, ok bool) {
+	if !strings.HasPrefix(path, "/v2/") {
+		return "", "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/v2/"), "/")
+	if len(parts) < 3 {
+		return "", "", "", false
+	}
+	kind = parts[len(parts)-2]
+	if kind != "manifests" && kind != "blobs" {
+		return "", "", "", false
+	}
+	return strings.Join(parts[:len(parts)-2], "/"), kind, parts[len(parts)-1], true
+}
+
+func (c *ManifestCache) path(kind, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, kind, hex.EncodeToString(sum[:])+".json")
+}
+
+func (c *ManifestCache) blob(repo, digest string) (cachedBlob, bool) {
+	var blob cachedBlob
+	if !c.read(c.path("blobs", repo+"@"+digest), &blob) {
+		return cachedBlob{}, false
+	}
+	if actual, _, err := v1.SHA256(bytes.NewReader(blob.Content)); err != nil || actual.String() != digest {
+		return cachedBlob{}, false
+	}
+	return blob, true
+}
+
+func (c *ManifestCache) putBlob(repo, digest string, blob cachedBlob) error {
+	return c.write(c.path("blobs", repo+"@"+digest), blob)
+}
+
+func (c *ManifestCache) tag(repo, tag string) (string, bool) {
+	if c.ttl <= 0 {
+		return "", false
+	}
+	var entry cachedTag
+	if !c.read(c.path("tags", repo+":"+tag), &entry) || c.now().Sub(entry.Fetched) >= c.ttl {
+		return "", false
+	}
+	return entry.Digest, true
+}
+
+func (c *ManifestCache) putTag(repo, tag, digest string) error {
+	return c.write(c.path("tags", repo+":"+tag), cachedTag{Digest: digest, Fetched: c.now()})
+}
+
+func (c *ManifestCache) removeTag(repo, tag string) {
+	_ = os.Remove(c.path("tags", repo+":"+tag))
+}
+
+// Forget removes the digest the tag of the reference resolved to from the cache, so that it is fetched again,
+// e.g. after an image was pushed to the tag, as images are not pushed through the transport of the cache.
+// References by digest are left cached, as their content cannot change. Forget does nothing if the cache is nil.
+func (c *ManifestCache) Forget(ref name.Reference) {
+	if c == nil {
+		return
+	}
+	if tag, ok := ref.(name.Tag); ok {
+		c.removeTag(tag.RegistryStr()+"/"+tag.RepositoryStr(), tag.TagStr())
+	}
+}
+
+// recordConfig records the config of the image manifest as cacheable.
+func (c *ManifestCache) recordConfig(repo string, blob cachedBlob) {
+	var manifest v1.Manifest
+	if err := json.Unmarshal(blob.Content, &manifest); err != nil || manifest.Config.Digest == (v1.Hash{}) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.configs[repo+"@"+manifest.Config.Digest.String()] = true
+}
+
+func (c *ManifestCache) isConfig(repo, digest string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.configs[repo+"@"+digest]
+}
+
+func (c *ManifestCache) read(path string, v interface{}) bool {
+	contents, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(contents, v) == nil
+}
+
+// write stores the entry through a temporary file, so that concurrent readers never see a partial entry.
+func (c *ManifestCache) write(path string, v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b cachedBlob) response(req *http.Request, digest string) *http.Response {
+	header := http.Header{}
+	if b.MediaType != "" {
+		header.Set("Content-Type", string(b.MediaType))
+	}
+	header.Set("Docker-Content-Digest", digest)
+	header.Set("Content-Length", strconv.Itoa(len(b.Content)))
+	body := b.Content
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusOK, http.StatusText(http.StatusOK)),
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(b.Content)),
+		Request:       req,
+	}
+}
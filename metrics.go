@@ -0,0 +1,92 @@
+package imgutil
+
+import (
+	"time"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Names of the operations reported to a MetricsHook.
+const (
+	// OperationPull is the fetch of a base or previous image from a registry.
+	OperationPull = "pull"
+	// OperationPush is the save of an image or index to a registry, once per name it is saved as.
+	OperationPush = "push"
+	// OperationDaemonLoad is the load of an image into a docker daemon.
+	OperationDaemonLoad = "daemon-load"
+	// OperationLayoutWrite is the write of an image or index to an OCI layout directory.
+	OperationLayoutWrite = "layout-write"
+)
+
+// Operation is an operation of an image or index that accesses a registry, a daemon or a layout.
+type Operation struct {
+	// Name is one of the Operation constants, e.g. OperationPush.
+	Name string
+	// Ref is the name of the image or index, or the path of the layout.
+	Ref string
+}
+
+// OperationResult is how an Operation ended.
+type OperationResult struct {
+	Duration time.Duration
+	// Bytes is the compressed size of the image pulled, pushed or written to a layout, or the size of the tarball loaded
+	// into a daemon. It is 0 for indexes and for operations that failed.
+	Bytes int64
+	Err   error
+}
+
+// MetricsHook is told when images and indexes start and end operations, e.g. to record how long pulls and pushes take.
+// Its methods may be called concurrently.
+type MetricsHook interface {
+	OnOperationStart(op Operation)
+	OnOperationEnd(op Operation, result OperationResult)
+}
+
+// WithMetricsHook sets the hook that image constructors and the images they return report their operations to.
+func WithMetricsHook(hook MetricsHook) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.MetricsHook = hook
+	}
+}
+
+// WithIndexMetricsHook sets the hook that the indexes returned by index constructors report their operations to.
+func WithIndexMetricsHook(hook MetricsHook) func(*IndexOptions) error {
+	return func(o *IndexOptions) error {
+		o.MetricsHook = hook
+		return nil
+	}
+}
+
+// StartOperation reports the start of the operation to the hook, if it is not nil,
+// and returns the function to call with the bytes it read or wrote and its error when it ends.
+func StartOperation(hook MetricsHook, name, ref string) func(bytes int64, err error) {
+	if hook == nil {
+		return func(int64, error) {}
+	}
+	op := Operation{Name: name, Ref: ref}
+	start := time.Now()
+	hook.OnOperationStart(op)
+	return func(bytes int64, err error) {
+		if err != nil {
+			bytes = 0
+		}
+		hook.OnOperationEnd(op, OperationResult{Duration: time.Since(start), Bytes: bytes, Err: err})
+	}
+}
+
+// ImageSize returns the compressed size of the image: that of its manifest, config and layers.
+func ImageSize(image v1.Image) (int64, error) {
+	manifest, err := image.Manifest()
+	if err != nil {
+		return 0, err
+	}
+	size, err := image.Size()
+	if err != nil {
+		return 0, err
+	}
+	size += manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	return size, nil
+}
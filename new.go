@@ -3,9 +3,9 @@ package imgutil
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"time"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
@@ -17,16 +17,32 @@ import (
 )
 
 func NewCNBImage(options ImageOptions) (*CNBImageCore, error) {
+	var err error
+	if options.BaseImage, err = withLayerDecryption(options.BaseImage, options.LayerDecrypter); err != nil {
+		return nil, err
+	}
+	if options.PreviousImage, err = withLayerDecryption(options.PreviousImage, options.LayerDecrypter); err != nil {
+		return nil, err
+	}
+
 	image := &CNBImageCore{
 		Image:               options.BaseImage, // the working image
 		createdAt:           getCreatedAt(options),
 		preferredMediaTypes: GetPreferredMediaTypes(options),
 		preserveHistory:     options.PreserveHistory,
 		previousImage:       options.PreviousImage,
+		layerCompression:    options.LayerCompression,
+		gzipLevel:           options.GzipLevel,
+		tempFiles:           NewTempFiles(options.TempDir, options.KeepIntermediates),
+		diffIDProvider:      options.DiffIDProvider,
+		strictInvariants:    options.StrictInvariants,
+		validateRebase:      options.ValidateRebase,
+		layerEncrypter:      options.LayerEncrypter,
+		capabilityReport:    options.CapabilityReport,
+		canonicalJSON:       options.CanonicalJSON,
 	}
 
 	// ensure base image
-	var err error
 	if image.Image == nil {
 		image.Image, err = emptyV1(options.Platform, image.preferredMediaTypes)
 		if err != nil {
@@ -34,6 +50,18 @@ func NewCNBImage(options ImageOptions) (*CNBImageCore, error) {
 		}
 	}
 
+	configFile, err := getConfigFile(image.Image)
+	if err != nil {
+		return nil, err
+	}
+	if options.BaseImage != nil {
+		image.baseImage = options.BaseImage
+		image.baseLayerCount = len(configFile.RootFS.DiffIDs)
+	}
+	if err = validatePlatform(configFile.OS, configFile.Architecture); err != nil {
+		return nil, err
+	}
+
 	// ensure windows
 	if err = prepareNewWindowsImageIfNeeded(image); err != nil {
 		return nil, err
@@ -168,6 +196,11 @@ func EnsureMediaTypesAndLayers(image v1.Image, requestedTypes MediaTypes, mutate
 		if err != nil {
 			return nil, false, fmt.Errorf("failed to mutate layer: %w", err)
 		}
+		if _, isEncrypted := layer.(*encryptedLayer); !isEncrypted && idx < len(beforeManifest.Layers) && idx < len(beforeConfig.RootFS.DiffIDs) &&
+			IsEncryptedMediaType(beforeManifest.Layers[idx].MediaType) {
+			// the diff ID of an encrypted layer cannot be computed from its contents
+			layer = &encryptedLayer{Layer: layer, desc: beforeManifest.Layers[idx], diffID: beforeConfig.RootFS.DiffIDs[idx]}
+		}
 		layersToAdd = append(layersToAdd, layer)
 	}
 
@@ -198,6 +231,10 @@ func EnsureMediaTypesAndLayers(image v1.Image, requestedTypes MediaTypes, mutate
 	if err != nil {
 		return nil, false, err
 	}
+	for idx := range additions {
+		// encrypted layers cannot be read without the keys in their annotations
+		additions[idx].Annotations = encryptionAnnotations(additions[idx].Layer)
+	}
 	retImage, err = mutate.Append(retImage, additions...)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to append layers: %w", err)
@@ -225,8 +262,8 @@ func layersAddendum(layers []v1.Layer, history []v1.History, requestedType types
 	}
 	var err error
 	for idx, l := range layers {
-		layerType := requestedType
-		if requestedType == "" {
+		layerType := layerMediaType(l, requestedType)
+		if layerType == "" {
 			// try to get a non-empty media type
 			if layerType, err = l.MediaType(); err != nil {
 				layerType = ""
@@ -274,15 +311,20 @@ func prepareNewWindowsImageIfNeeded(image *CNBImageCore) error {
 		return err
 	}
 
-	layerFile, err := os.CreateTemp("", "imgutil.local.image.windowsbaselayer")
+	layerFile, err := image.tempFiles.CreateTemp("imgutil.local.image.windowsbaselayer")
 	if err != nil {
 		return fmt.Errorf("creating temp file: %w", err)
 	}
-	defer layerFile.Close()
+	defer func() {
+		layerFile.Close()
+		if err != nil {
+			_ = image.tempFiles.Discard(layerFile.Name())
+		}
+	}()
 
 	hasher := sha256.New()
 	multiWriter := io.MultiWriter(layerFile, hasher)
-	if _, err := io.Copy(multiWriter, layerReader); err != nil {
+	if _, err = io.Copy(multiWriter, layerReader); err != nil {
 		return fmt.Errorf("copying base layer: %w", err)
 	}
 
@@ -304,10 +346,71 @@ func NewCNBIndex(repoName string, options IndexOptions) (*CNBIndex, error) {
 	}
 
 	index := &CNBIndex{
-		RepoName:   repoName,
-		ImageIndex: options.BaseIndex,
-		XdgPath:    options.XdgPath,
-		KeyChain:   options.Keychain,
+		RepoName:    repoName,
+		ImageIndex:  options.BaseIndex,
+		XdgPath:     options.XdgPath,
+		KeyChain:    options.Keychain,
+		lockTimeout: options.LayoutIndexOptions.LockTimeout,
+		savedIndex:  options.BaseIndex,
+
+		registrySettings: options.RemoteIndexOptions.RegistrySettings,
+		remoteOptions:    options.RemoteIndexOptions.RemoteOptions,
+		canonicalJSON:    options.CanonicalJSON,
+		logger:           options.Logger,
+		metrics:          options.MetricsHook,
+	}
+	index.artifactType = artifactTypeOf(options.BaseIndex)
+	index.savedArtifactType = index.artifactType
+	var err error
+	if index.savedDigest, err = storedIndexDigest(StorePath(options.XdgPath, repoName)); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// artifactTypeOf returns the artifactType of the index manifest, which v1.IndexManifest does not have a field for.
+func artifactTypeOf(index v1.ImageIndex) string {
+	raw, err := index.RawManifest()
+	if err != nil {
+		return ""
+	}
+	var manifest struct {
+		ArtifactType string `json:"artifactType"`
+	}
+	if err = json.Unmarshal(raw, &manifest); err != nil {
+		return ""
+	}
+	return manifest.ArtifactType
+}
+
+// NewIndexFromImages returns a new index with the given images, each with the platform of its config (os, architecture, variant,
+// os.version and os.features), so that the platforms do not need to be set with SetOS, SetArchitecture, etc.
+// The images are referenced as they are, so they should be saved where the index is pushed before it is.
+// An image without an os and architecture in its config is an error, as it could not be selected from the index.
+func NewIndexFromImages(repoName string, images []Image, ops ...IndexOption) (*CNBIndex, error) {
+	options := &IndexOptions{}
+	for _, op := range ops {
+		if err := op(options); err != nil {
+			return nil, err
+		}
+	}
+	index, err := NewCNBIndex(repoName, *options)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		underlying := image.UnderlyingImage()
+		if underlying == nil {
+			return nil, fmt.Errorf("image %s cannot be added to an index: it has no underlying image", image.Name())
+		}
+		desc, err := descriptor(underlying)
+		if err != nil {
+			return nil, err
+		}
+		if desc.Platform == nil || desc.Platform.OS == "" || desc.Platform.Architecture == "" {
+			return nil, fmt.Errorf("image %s cannot be added to an index: its config has no os and architecture", image.Name())
+		}
+		index.AddManifest(underlying)
 	}
 	return index, nil
 }
@@ -1,9 +1,14 @@
 package imgutil
 
 import (
+	"compress/gzip"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"text/template"
 	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
@@ -14,33 +19,159 @@ import (
 type ImageOption func(*ImageOptions)
 
 type ImageOptions struct {
+	AliasStore            *AliasStore
 	BaseImageRepoName     string
 	PreviousImageRepoName string
 	Config                *v1.Config
 	CreatedAt             time.Time
+	LayerCompression      Compression
+	GzipLevel             int
 	MediaTypes            MediaTypes
 	Platform              Platform
 	PreserveHistory       bool
+	ProgressHandler       ProgressHandler
+	TempDir               string
+	KeepIntermediates     bool
+	DiffIDProvider        DiffIDProvider
+	StrictInvariants      bool
+	ValidateRebase        bool
+	// CanonicalJSON, if set with WithCanonicalJSON, causes the config and manifest to be encoded canonically when the image is saved.
+	CanonicalJSON  bool
+	LayerEncrypter LayerEncrypter
+	LayerDecrypter LayerDecrypter
+	TrustStore     TrustStore
+	// ExpectedDigest, if set, is the digest the base image must resolve to; see CheckExpectedBaseImageDigest.
+	ExpectedDigest v1.Hash
+	// StrictCapabilities causes constructors to fail if the capability report has warnings; see CheckCapabilities.
+	StrictCapabilities bool
+	// Logger, if set with WithLogger, receives debug messages.
+	Logger Logger
+	// MetricsHook, if set with WithMetricsHook, is told about pulls, pushes, daemon loads and layout writes.
+	MetricsHook MetricsHook
 	LayoutOptions
+	LocalOptions
 	RemoteOptions
 
 	// These options must be specified in each implementation's image constructor
-	BaseImage     v1.Image
-	PreviousImage v1.Image
+	BaseImage        v1.Image
+	PreviousImage    v1.Image
+	CapabilityReport CapabilityReport
+
+	// errs are the errors of options given invalid values; see Err.
+	errs []error
+}
+
+// Err returns an error if any option was given an invalid value.
+// Image constructors call it once the options are applied, so that invalid values fail before any work is done.
+func (o *ImageOptions) Err() error {
+	return errors.Join(o.errs...)
 }
 
 type LayoutOptions struct {
+	DurableWrites  bool
+	LongPaths      bool
 	PreserveDigest bool
+	Repair         bool
+	VerifyBlobs    bool
 	WithoutLayers  bool
+	// LockTimeout is how long saving waits for other writers to release the layout directory; see LockDir.
+	LockTimeout time.Duration
+}
+
+type LocalOptions struct {
+	CompressedLayers    bool
+	OCILoadFormat       bool
+	PodmanCompatibility bool
+	// LayerCacheXDGPath, if set, is the XDG path where layers extracted from the daemon are cached,
+	// up to LayerCacheMaxSize bytes (unbounded if not positive).
+	LayerCacheXDGPath string
+	LayerCacheMaxSize int64
+	// DockerHost, if set, is the daemon the image is saved to, with a client created for the image instead of the one provided.
+	DockerHost string
 }
 
 type RemoteOptions struct {
 	RegistrySettings    map[string]RegistrySetting
 	AddEmptyLayerOnSave bool
+	// Mirrors are registry hosts (optionally with a path prefix) that are tried, in order,
+	// before the canonical registry when fetching base and previous images.
+	Mirrors     []string
+	RetryPolicy RetryPolicy
+	// RateLimitPolicy controls how requests rejected by registries with 429 Too Many Requests are sent again.
+	RateLimitPolicy RateLimitPolicy
+	// SBOMsAsReferrers causes SBOMs added with AddSBOM to be attached to the saved image as referrer artifacts
+	// instead of being stored as layers.
+	SBOMsAsReferrers bool
+	// TokenCache, if set, is shared by remote operations to reuse the tokens obtained from registries.
+	TokenCache *TokenCache
+	// ManifestCache, if set, is where the manifests and configs of the base and previous images are cached on disk.
+	ManifestCache *ManifestCache
+	// PinBaseImage causes the base image tag to be resolved to a digest once, when the image is created,
+	// so that the base image does not change if the tag is moved while the image is built.
+	PinBaseImage bool
+	// PlatformFallback, if set, provides the platforms to try when the base or previous image is an index
+	// without an image for the requested platform.
+	PlatformFallback PlatformFallback
+	// LazyLayers causes the layers of the base and previous images to be read with range requests as they are consumed.
+	LazyLayers bool
+	// ValidateBeforePush causes the image to be checked against the OCI image spec before it is pushed; see ValidateImageSpec.
+	ValidateBeforePush bool
+	// Verifier, if set, is called with the descriptor of the base image before it is used.
+	Verifier Verifier
+	// Transport, if set, is used instead of the default transport to access registries.
+	Transport http.RoundTripper
+	// UploadConcurrency, if positive, is the number of blobs uploaded in parallel when an image is saved.
+	UploadConcurrency int
+	// UploadChunkSize, if positive, is the size of the chunks in which the layers of at least ChunkedUploadThreshold bytes
+	// are uploaded when an image is saved, resuming from the last chunk received by the registry when a chunk fails.
+	UploadChunkSize int64
+	// ChunkedUploadThreshold is the size from which layers are uploaded in chunks of UploadChunkSize bytes.
+	ChunkedUploadThreshold int64
+	// UploadRateLimiter, if set, limits the bandwidth of all uploads to registries.
+	UploadRateLimiter *RateLimiter
+	// DownloadRateLimiter, if set, limits the bandwidth of all downloads from registries.
+	DownloadRateLimiter *RateLimiter
+	// DownloadBudget, if set, caps the total number of bytes downloaded from registries.
+	DownloadBudget *ByteBudget
+	// RootCAs, if set, are the certificate authorities trusted for registry connections, instead of the system ones.
+	RootCAs *x509.CertPool
+	// CAFile, if set, is the path to a PEM bundle of certificate authorities trusted in addition to the system ones.
+	CAFile string
+	// RegistriesConfig, if set, is the path to a registries configuration file merged with the RegistrySettings
+	// by image constructors; see RegistriesConfig.
+	RegistriesConfig string
+}
+
+// RetryPolicy controls how remote registry operations are retried when they fail with a transient error.
+// A zero value means the implementation default is used.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// Backoff is the initial wait between attempts; it doubles (with jitter) after each failed attempt.
+	Backoff time.Duration
+	// Logger, if set, is told about each retry. WithLogger sets it.
+	Logger Logger
+}
+
+// RateLimitPolicy controls how requests rejected by registries with 429 Too Many Requests are sent again,
+// after the wait asked for by their Retry-After header. A zero value means the implementation default is used.
+type RateLimitPolicy struct {
+	// MaxAttempts is the total number of attempts of a rate limited request, including the first one.
+	MaxAttempts int
+	// MaxWait is the longest wait asked for by a registry that is honored; the request fails instead of waiting longer.
+	MaxWait time.Duration
 }
 
 type RegistrySetting struct {
 	Insecure bool
+	// Proxy, if set, is the URL of the HTTP proxy used to access the registry, which may include credentials.
+	Proxy *url.URL
+	// Blocked causes accessing the registry to fail with an ErrBlockedRegistry.
+	Blocked bool
+	// Mirrors are tried, in order, before the registry when reading images from it; see RegistrySetting.MirrorRepoNames.
+	Mirrors []RegistryMirror
+	// MirrorByDigestOnly restricts the use of Mirrors to digest references.
+	MirrorByDigestOnly bool
 }
 
 // FromBaseImage loads the provided image as the manifest, config, and layers for the working image.
@@ -51,6 +182,110 @@ func FromBaseImage(name string) func(*ImageOptions) {
 	}
 }
 
+// WithTempDir causes intermediate files, such as layers extracted from the daemon, to be created in the given directory
+// instead of the default directory for temporary files.
+func WithTempDir(path string) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.TempDir = path
+	}
+}
+
+// WithGzipLevel sets the level used to gzip-compress layers added to the image from a file,
+// from gzip.BestSpeed (1) to gzip.BestCompression (9). Lower levels export faster, higher levels produce smaller layers.
+// It applies wherever such layers are compressed: when writing a layout, pushing to a registry, or sending compressed layers to the daemon.
+// Other levels, including gzip.NoCompression, gzip.HuffmanOnly and gzip.DefaultCompression, cause the image constructor to fail;
+// see ImageOptions.Err. Not providing the option keeps the default level.
+func WithGzipLevel(level int) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		if level < gzip.BestSpeed || level > gzip.BestCompression {
+			o.errs = append(o.errs, fmt.Errorf("invalid gzip level %d: must be between %d and %d", level, gzip.BestSpeed, gzip.BestCompression))
+			return
+		}
+		o.GzipLevel = level
+	}
+}
+
+// WithDiffIDProvider causes the diff IDs of layers added to the image from a file to be obtained from the given provider,
+// such as a DiffIDCache, instead of being computed by reading the file as it is added.
+func WithDiffIDProvider(provider DiffIDProvider) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.DiffIDProvider = provider
+	}
+}
+
+// WithCanonicalJSON causes the config and manifest of the image to be encoded with Canonicalize when it is saved,
+// so that its digest does not depend on how they were encoded, e.g. by the Go version that built the base image.
+// It is not the default as re-encoding changes the digest of images whose JSON is not already canonical.
+func WithCanonicalJSON() func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.CanonicalJSON = true
+	}
+}
+
+// WithStrictInvariants causes the working image to be checked after each mutation, so that a mutation leaving
+// the manifest layers, config diff IDs and history out of step fails with an ErrInvariantViolation,
+// rather than producing an image that is rejected later by a registry or runtime. It is intended for debugging and tests.
+func WithStrictInvariants() func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.StrictInvariants = true
+	}
+}
+
+// WithRebaseValidation causes Rebase to check that the image can safely be rebased onto the new base before rebasing it:
+// the image must not be labeled as not rebasable, the os, architecture, variant and os version must match,
+// and the stack ID and distribution labels must match where both images have them.
+// Otherwise Rebase fails with an ErrRebaseMismatch listing the differences.
+func WithRebaseValidation() func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.ValidateRebase = true
+	}
+}
+
+// WithLayerEncryption causes the layers of the image to be encrypted by the given encrypter when the image is saved,
+// following the ocicrypt conventions: encrypted layers have media types with EncryptedMediaTypeSuffix
+// and the annotations returned by the encrypter. Layers that are already encrypted are kept as they are.
+// The daemon cannot store encrypted layers, so the option is ignored for local images.
+func WithLayerEncryption(encrypter LayerEncrypter) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.LayerEncrypter = encrypter
+	}
+}
+
+// WithLayerDecryption causes the encrypted layers of the base and previous images to be decrypted by the given decrypter
+// when their contents are read, e.g. by GetLayer or when they are loaded into the daemon.
+// Encrypted layers that are kept in the image are saved as they are, with their encryption annotations.
+func WithLayerDecryption(decrypter LayerDecrypter) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.LayerDecrypter = decrypter
+	}
+}
+
+// WithKeepIntermediates causes intermediate files to be left in place when the image is cleaned up,
+// so that they can be inspected for debugging.
+func WithKeepIntermediates() func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.KeepIntermediates = true
+	}
+}
+
+// WithAliasStore resolves the base and previous image names against the aliases pinned in the given store.
+// Names that are not aliases are used as provided.
+func WithAliasStore(store *AliasStore) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.AliasStore = store
+	}
+}
+
+// WithTrustStore causes image constructors to fail with an ErrUntrustedBaseImage unless the base image given with FromBaseImage
+// resolves to a digest approved by the store, for supply-chain-locked builds. Remote images read the base image
+// by the digest that was checked, even if its tag is moved meanwhile; local images check the repo digests of the daemon image.
+// A base image that is not found is not approved either, so that the image is not silently created from scratch.
+func WithTrustStore(store TrustStore) func(*ImageOptions) {
+	return func(o *ImageOptions) {
+		o.TrustStore = store
+	}
+}
+
 // WithConfig lets a caller provided a `config` object for the working image.
 func WithConfig(c *v1.Config) func(*ImageOptions) {
 	return func(o *ImageOptions) {
@@ -104,9 +339,18 @@ type IndexOption func(options *IndexOptions) error
 type IndexOptions struct {
 	BaseIndexRepoName string
 	MediaType         types.MediaType
+	// ConvertManifests, if set with WithConvertManifests, causes SetMediaType to convert the images of the index too.
+	ConvertManifests bool
+	// CanonicalJSON, if set with WithIndexCanonicalJSON, causes the index manifest to be encoded canonically when it is pushed.
+	CanonicalJSON bool
+	// Logger, if set with WithIndexLogger, receives debug messages.
+	Logger Logger
+	// MetricsHook, if set with WithIndexMetricsHook, is told about pushes and layout writes.
+	MetricsHook MetricsHook
 	LayoutIndexOptions
 	RemoteIndexOptions
 	IndexPushOptions
+	IndexInspectOptions
 
 	// These options must be specified in each implementation's image index constructor
 	BaseIndex v1.ImageIndex
@@ -114,11 +358,26 @@ type IndexOptions struct {
 
 type LayoutIndexOptions struct {
 	XdgPath string
+	Repair  bool
+	// LockTimeout is how long loading, saving and deleting wait for other writers to release the index directory; see LockDir.
+	LockTimeout time.Duration
+	// StoreRoot and Project, if a store root is provided with WithStoreRoot, select the XdgPath of the index; see StoreRoot.
+	StoreRoot string
+	Project   string
 }
 
 type RemoteIndexOptions struct {
 	Keychain authn.Keychain
 	Insecure bool
+	// Verifier, if set, is called with the descriptor of the base index before it is used.
+	Verifier Verifier
+	// RegistrySettings, if set with WithRegistriesConfig, are the settings of the registries the index is loaded from and pushed to.
+	RegistrySettings map[string]RegistrySetting
+	// ManifestCache, if set, is where the manifests of the base index are cached on disk.
+	ManifestCache *ManifestCache
+	// RemoteOptions, if set with remote.WithIndexRemoteOptions, configure the transport the index is loaded and pushed with
+	// as they do for remote images: custom transport, proxies, certificate authorities, token cache, rate limit retries and bandwidth limits.
+	RemoteOptions RemoteOptions
 }
 
 // FromBaseIndex sets the name to use when loading the index.
@@ -143,13 +402,21 @@ func FromBaseIndexInstance(index v1.ImageIndex) func(options *IndexOptions) erro
 func WithMediaType(mediaType types.MediaType) func(options *IndexOptions) error {
 	return func(o *IndexOptions) error {
 		if !mediaType.IsIndex() {
-			return fmt.Errorf("unsupported media type encountered: '%s'", mediaType)
+			return ErrUnsupportedMediaType{MediaType: mediaType}
 		}
 		o.MediaType = mediaType
 		return nil
 	}
 }
 
+// WithIndexCanonicalJSON causes the index manifest to be encoded with Canonicalize when it is pushed, as WithCanonicalJSON does for images.
+func WithIndexCanonicalJSON() func(options *IndexOptions) error {
+	return func(o *IndexOptions) error {
+		o.CanonicalJSON = true
+		return nil
+	}
+}
+
 // WithXDGRuntimePath Saves the Index to the '`xdgPath`/manifests'
 func WithXDGRuntimePath(xdgPath string) func(options *IndexOptions) error {
 	return func(o *IndexOptions) error {
@@ -174,9 +441,29 @@ func WithInsecure() func(options *IndexOptions) error {
 	}
 }
 
+// WithRegistriesConfig applies the registries configuration in the file at the provided path (see RegistriesConfig)
+// when the index is loaded and pushed: insecure registries are accessed without TLS verification, blocked ones fail
+// with an ErrBlockedRegistry, and the base index is read from the mirrors of its registry if one serves it.
+func WithRegistriesConfig(path string) func(options *IndexOptions) error {
+	return func(o *IndexOptions) error {
+		settings, err := MergeRegistriesConfig(path, o.RegistrySettings)
+		if err != nil {
+			return err
+		}
+		o.RegistrySettings = settings
+		return nil
+	}
+}
+
 type IndexPushOptions struct {
 	Purge           bool
 	DestinationTags []string
+	// Platforms, if not empty, restricts the pushed index to the manifests for these platforms.
+	Platforms []v1.Platform
+	// PreserveOtherPlatforms keeps the manifests for the other platforms in the local index after pushing.
+	PreserveOtherPlatforms bool
+	// ValidateBeforePush causes the index to be checked against the OCI image spec before it is pushed; see ValidateIndexSpec.
+	ValidateBeforePush bool
 }
 
 // WithPurge if true deletes the index from the local filesystem after pushing
@@ -187,7 +474,28 @@ func WithPurge(purge bool) func(options *IndexOptions) error {
 	}
 }
 
-// WithTags sets the destination tags for the index when pushed
+// WithPlatforms pushes only the manifests that satisfy one of the given platforms.
+// Platform fields that are left empty match any value, e.g. linux/arm64 matches the v8 variant.
+// The manifests for other platforms are removed from the local index as well, unless preserveOthers is true.
+func WithPlatforms(platforms []v1.Platform, preserveOthers bool) func(options *IndexOptions) error {
+	return func(a *IndexOptions) error {
+		a.Platforms = platforms
+		a.PreserveOtherPlatforms = preserveOthers
+		return nil
+	}
+}
+
+// WithValidateBeforePush causes Push to fail with an ErrSpecViolations, listing every violation found by ValidateIndexSpec,
+// instead of pushing an index that does not conform to the OCI image spec.
+func WithValidateBeforePush() func(options *IndexOptions) error {
+	return func(a *IndexOptions) error {
+		a.ValidateBeforePush = true
+		return nil
+	}
+}
+
+// WithTags sets the destination tags for the index when pushed.
+// An index named by a digest reference is only pushed to these tags, in the repository of the reference.
 func WithTags(tags ...string) func(options *IndexOptions) error {
 	return func(a *IndexOptions) error {
 		a.DestinationTags = tags
@@ -195,6 +503,39 @@ func WithTags(tags ...string) func(options *IndexOptions) error {
 	}
 }
 
+type IndexInspectOptions struct {
+	// InspectFormat is the format of the output of Inspect, the raw index manifest by default.
+	InspectFormat InspectFormat
+	// InspectTemplate, if set with WithInspectTemplate, renders the index manifest instead of InspectFormat.
+	InspectTemplate *template.Template
+}
+
+// WithInspectFormat sets the format of the output of Inspect; see InspectFormat.
+func WithInspectFormat(format InspectFormat) func(options *IndexOptions) error {
+	return func(a *IndexOptions) error {
+		switch format {
+		case InspectRaw, InspectTable:
+		default:
+			return fmt.Errorf("unsupported inspect format '%s'", format)
+		}
+		a.InspectFormat = format
+		return nil
+	}
+}
+
+// WithInspectTemplate causes Inspect to render the v1.IndexManifest of the index with the given Go template,
+// e.g. `{{range .Manifests}}{{.Digest}}{{"\n"}}{{end}}`.
+func WithInspectTemplate(text string) func(options *IndexOptions) error {
+	return func(a *IndexOptions) error {
+		tmpl, err := template.New("inspect").Parse(text)
+		if err != nil {
+			return fmt.Errorf("parsing inspect template: %w", err)
+		}
+		a.InspectTemplate = tmpl
+		return nil
+	}
+}
+
 func GetTransport(insecure bool) http.RoundTripper {
 	if insecure {
 		return &http.Transport{
@@ -0,0 +1,105 @@
+package imgutil
+
+import (
+	"strconv"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// Windows containers only run on hosts of the same build, identified by the first three components of the os.version
+// (e.g. 10.0.17763 for Windows Server 2019 and 10.0.20348 for Windows Server 2022); the fourth component,
+// the update build revision, may differ. An index for Windows therefore usually has an image per build for each architecture.
+
+// OSVersionMatches reports whether an image with the available os.version can be used for the requested one,
+// following the rules of Windows hosts: the major, minor and build components must be the same.
+// A requested os.version with fewer components (e.g. "10.0.17763") matches any image with that prefix,
+// and an empty requested os.version matches any image.
+func OSVersionMatches(requested, available string) bool {
+	if requested == "" {
+		return true
+	}
+	req, avail := strings.Split(requested, "."), strings.Split(available, ".")
+	n := min(len(req), 3)
+	if len(avail) < n {
+		return false
+	}
+	for idx := 0; idx < n; idx++ {
+		if req[idx] != avail[idx] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameOSVersionBuild reports whether the os.versions have the same major, minor and build components,
+// i.e. whether images with them target the same Windows hosts.
+func sameOSVersionBuild(a, b string) bool {
+	return osVersionBuild(a) == osVersionBuild(b)
+}
+
+func osVersionBuild(osVersion string) string {
+	parts := strings.SplitN(osVersion, ".", 4)
+	return strings.Join(parts[:min(len(parts), 3)], ".")
+}
+
+// osVersionRevision returns the update build revision of the os.version, or -1 if it has none.
+func osVersionRevision(osVersion string) int {
+	parts := strings.Split(osVersion, ".")
+	if len(parts) < 4 {
+		return -1
+	}
+	revision, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return -1
+	}
+	return revision
+}
+
+// BestMatch returns the descriptor of the image in the index that best matches the requested platform.
+// The OS and architecture must match, as well as the variant if it is requested.
+// If an os.version is requested, images are matched as by OSVersionMatches, preferring the image with the same os.version,
+// then the one with the highest update build revision, as Windows hosts do; otherwise the first matching image is returned.
+func BestMatch(index v1.ImageIndex, platform Platform) (v1.Descriptor, error) {
+	indexManifest, err := getIndexManifest(index)
+	if err != nil {
+		return v1.Descriptor{}, err
+	}
+	var (
+		best  v1.Descriptor
+		found bool
+	)
+	for _, desc := range indexManifest.Manifests {
+		if !desc.MediaType.IsImage() || desc.Platform == nil || isAttestation(desc) {
+			continue
+		}
+		candidate := desc.Platform
+		if !sameOS(platform.OS, candidate.OS) || platform.Architecture != candidate.Architecture {
+			continue
+		}
+		if platform.Variant != "" && platform.Variant != candidate.Variant {
+			continue
+		}
+		if !OSVersionMatches(platform.OSVersion, candidate.OSVersion) {
+			continue
+		}
+		if !found || betterOSVersionMatch(platform.OSVersion, candidate.OSVersion, best.Platform.OSVersion) {
+			best, found = desc, true
+		}
+	}
+	if !found {
+		return v1.Descriptor{}, ErrPlatformNotFound{Platform: platform}
+	}
+	return copyDescriptor(best), nil
+}
+
+// betterOSVersionMatch reports whether the candidate os.version is a better match for the requested one than the current best.
+func betterOSVersionMatch(requested, candidate, best string) bool {
+	if requested == "" || best == requested {
+		return false
+	}
+	if candidate == requested {
+		return true
+	}
+	return osVersionRevision(candidate) > osVersionRevision(best)
+}
@@ -0,0 +1,109 @@
+package imgutil_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestOSVersion(t *testing.T) {
+	spec.Run(t, "OSVersion", testOSVersion, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testOSVersion(t *testing.T, when spec.G, it spec.S) {
+	windowsImage := func(osVersion string) v1.Image {
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS = "windows"
+		configFile.Architecture = "amd64"
+		configFile.OSVersion = osVersion
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		return image
+	}
+
+	newIndex := func(osVersions ...string) *imgutil.CNBIndex {
+		index, err := imgutil.NewCNBIndex("some/index", imgutil.IndexOptions{BaseIndex: empty.Index})
+		h.AssertNil(t, err)
+		for _, osVersion := range osVersions {
+			index.AddManifest(windowsImage(osVersion))
+		}
+		return index
+	}
+
+	osVersionsOf := func(index *imgutil.CNBIndex) []string {
+		manifest, err := index.IndexManifest()
+		h.AssertNil(t, err)
+		var osVersions []string
+		for _, desc := range manifest.Manifests {
+			osVersions = append(osVersions, desc.Platform.OSVersion)
+		}
+		return osVersions
+	}
+
+	when("#OSVersionMatches", func() {
+		it("matches os versions of the same build", func() {
+			h.AssertEq(t, imgutil.OSVersionMatches("10.0.17763.3532", "10.0.17763.1"), true)
+			h.AssertEq(t, imgutil.OSVersionMatches("10.0.17763", "10.0.17763.3532"), true)
+			h.AssertEq(t, imgutil.OSVersionMatches("", "10.0.20348.1"), true)
+			h.AssertEq(t, imgutil.OSVersionMatches("10.0.17763.3532", "10.0.20348.3532"), false)
+			h.AssertEq(t, imgutil.OSVersionMatches("10.0.17763", "10.0"), false)
+		})
+	})
+
+	when("#BestMatch", func() {
+		it("prefers the same os version, then the latest revision of the build", func() {
+			index := newIndex("10.0.17763.1000", "10.0.17763.3532", "10.0.20348.1000", "10.0.17763.2000")
+
+			desc, err := index.BestMatch(imgutil.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.1000"})
+			h.AssertNil(t, err)
+			h.AssertEq(t, desc.Platform.OSVersion, "10.0.17763.1000")
+
+			desc, err = index.BestMatch(imgutil.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.9999"})
+			h.AssertNil(t, err)
+			h.AssertEq(t, desc.Platform.OSVersion, "10.0.17763.3532")
+
+			desc, err = index.BestMatch(imgutil.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.20348"})
+			h.AssertNil(t, err)
+			h.AssertEq(t, desc.Platform.OSVersion, "10.0.20348.1000")
+
+			_, err = index.BestMatch(imgutil.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.26100.1"})
+			h.AssertError(t, err, "failed to find image matching platform")
+			var notFound imgutil.ErrPlatformNotFound
+			h.AssertEq(t, errors.As(err, &notFound), true)
+			h.AssertEq(t, notFound.Platform.OSVersion, "10.0.26100.1")
+		})
+	})
+
+	when("#ReplaceManifest", func() {
+		it("only replaces the image for the same Windows build", func() {
+			index := newIndex("10.0.17763.1000", "10.0.20348.1000")
+
+			replacement := windowsImage("10.0.20348.2000")
+			h.AssertNil(t, index.ReplaceManifest(replacement))
+
+			h.AssertEq(t, osVersionsOf(index), []string{"10.0.17763.1000", "10.0.20348.2000"})
+			digest, err := replacement.Digest()
+			h.AssertNil(t, err)
+			changes := index.PendingChanges()
+			h.AssertEq(t, changes[len(changes)-1].Digest, digest)
+			ref, err := name.NewDigest("some/index@" + digest.String())
+			h.AssertNil(t, err)
+			osVersion, err := index.OSVersion(ref)
+			h.AssertNil(t, err)
+			h.AssertEq(t, osVersion, "10.0.20348.2000")
+		})
+	})
+}
@@ -0,0 +1,134 @@
+package imgutil
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// DescriptorGetter returns the descriptor of the image or index at the given reference in a registry,
+// accessed with the remote options of the given image options. The images and indexes it refers to are fetched with the same transport.
+type DescriptorGetter func(ref string, keychain authn.Keychain, ops ...ImageOption) (*remote.Descriptor, error)
+
+var (
+	descriptorGetterMu sync.RWMutex
+	descriptorGetter   DescriptorGetter
+)
+
+// RegisterDescriptorGetter makes the getter used by GetDescriptor to fetch manifests from registries available.
+// The remote package registers a getter using its transport and retries when it is imported.
+func RegisterDescriptorGetter(getter DescriptorGetter) {
+	descriptorGetterMu.Lock()
+	defer descriptorGetterMu.Unlock()
+	descriptorGetter = getter
+}
+
+// GetDescriptor returns the descriptor of the image or index at the given reference in a registry,
+// with the getter registered with RegisterDescriptorGetter. The remote package must be imported for registries to be available.
+func GetDescriptor(ref string, keychain authn.Keychain, ops ...ImageOption) (*remote.Descriptor, error) {
+	descriptorGetterMu.RLock()
+	getter := descriptorGetter
+	descriptorGetterMu.RUnlock()
+	if getter == nil {
+		return nil, errors.New("no descriptor getter registered for registries; import the remote package")
+	}
+	return getter(ref, keychain, ops...)
+}
+
+// Platforms returns the platforms available for the image at the given reference in a registry:
+// the platform of the image, or the platforms of the images in the index, without duplicates and in the order of the index.
+// Attestation manifests are not platform-specific images and are skipped.
+// The remote package must be imported for registries to be available.
+func Platforms(ref string, keychain authn.Keychain) ([]Platform, error) {
+	desc, err := GetDescriptor(ref, keychain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s: %w", ref, err)
+	}
+
+	var platforms []Platform
+	seen := map[Platform]bool{}
+	add := func(platform Platform) {
+		if !seen[platform] {
+			seen[platform] = true
+			platforms = append(platforms, platform)
+		}
+	}
+	if !desc.MediaType.IsIndex() {
+		image, err := desc.Image()
+		if err != nil {
+			return nil, err
+		}
+		platform, err := platformOf(image)
+		if err != nil {
+			return nil, err
+		}
+		add(platform)
+		return platforms, nil
+	}
+	index, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	if err = indexPlatforms(index, add); err != nil {
+		return nil, err
+	}
+	return platforms, nil
+}
+
+// indexPlatforms calls add with the platform of each image in the index, including those of nested indexes.
+// The platform of an image is read from its config when it is not recorded in its descriptor.
+func indexPlatforms(index v1.ImageIndex, add func(Platform)) error {
+	indexManifest, err := index.IndexManifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range indexManifest.Manifests {
+		switch {
+		case isAttestation(desc):
+			continue
+		case desc.MediaType.IsIndex():
+			child, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				return err
+			}
+			if err = indexPlatforms(child, add); err != nil {
+				return err
+			}
+		case desc.Platform != nil && desc.Platform.OS != "":
+			add(Platform{
+				Architecture: desc.Platform.Architecture,
+				OS:           desc.Platform.OS,
+				Variant:      desc.Platform.Variant,
+				OSVersion:    desc.Platform.OSVersion,
+			})
+		case desc.MediaType.IsImage():
+			image, err := index.Image(desc.Digest)
+			if err != nil {
+				return err
+			}
+			platform, err := platformOf(image)
+			if err != nil {
+				return err
+			}
+			add(platform)
+		}
+	}
+	return nil
+}
+
+func platformOf(image v1.Image) (Platform, error) {
+	configFile, err := getConfigFile(image)
+	if err != nil {
+		return Platform{}, err
+	}
+	return Platform{
+		Architecture: configFile.Architecture,
+		OS:           configFile.OS,
+		Variant:      configFile.Variant,
+		OSVersion:    configFile.OSVersion,
+	}, nil
+}
@@ -0,0 +1,151 @@
+package imgutil
+
+import (
+	"io"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+)
+
+// ProgressEvent reports how much of a layer has been transferred to or from an image store.
+type ProgressEvent struct {
+	// Digest is the digest of the (compressed) layer being transferred.
+	Digest v1.Hash
+	// Total is the size of the layer in bytes, or -1 if it is unknown.
+	Total int64
+	// Complete is the number of bytes transferred so far.
+	Complete int64
+}
+
+// ProgressHandler receives progress events; it may be called concurrently for different layers.
+type ProgressHandler func(ProgressEvent)
+
+// ImageWithProgress wraps the provided image so that reading the compressed contents of any of its layers
+// reports progress to the handler. If the handler is nil, the image is returned unchanged.
+func ImageWithProgress(image v1.Image, handler ProgressHandler) v1.Image {
+	if handler == nil {
+		return image
+	}
+	return &progressImage{Image: image, handler: handler}
+}
+
+// PulledImageWithProgress wraps the provided image, read from an image store, so that downloading any of its layers
+// reports progress to the handler, whether the layer is read compressed or uncompressed.
+// If the handler is nil, the image is returned unchanged.
+func PulledImageWithProgress(image v1.Image, handler ProgressHandler) v1.Image {
+	if handler == nil {
+		return image
+	}
+	return &progressImage{Image: image, handler: handler, pulled: true}
+}
+
+// LayerWithProgress wraps the provided layer so that reading its compressed contents reports progress to the handler.
+// If the handler is nil, the layer is returned unchanged.
+// A layer that can be mounted from another repository remains mountable.
+func LayerWithProgress(layer v1.Layer, handler ProgressHandler) v1.Layer {
+	if handler == nil {
+		return layer
+	}
+	return layerWithProgress(layer, handler, false)
+}
+
+func layerWithProgress(layer v1.Layer, handler ProgressHandler, pulled bool) v1.Layer {
+	if mountable, ok := layer.(*remote.MountableLayer); ok {
+		return &remote.MountableLayer{Layer: &progressLayer{Layer: mountable.Layer, handler: handler, pulled: pulled}, Reference: mountable.Reference}
+	}
+	return &progressLayer{Layer: layer, handler: handler, pulled: pulled}
+}
+
+type progressImage struct {
+	v1.Image
+	handler ProgressHandler
+	pulled  bool
+}
+
+func (i *progressImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	wrapped := make([]v1.Layer, len(layers))
+	for idx, layer := range layers {
+		wrapped[idx] = layerWithProgress(layer, i.handler, i.pulled)
+	}
+	return wrapped, nil
+}
+
+func (i *progressImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return layerWithProgress(layer, i.handler, i.pulled), nil
+}
+
+func (i *progressImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDiffID(h)
+	if err != nil {
+		return nil, err
+	}
+	return layerWithProgress(layer, i.handler, i.pulled), nil
+}
+
+type progressLayer struct {
+	v1.Layer
+	handler ProgressHandler
+	// pulled layers are downloaded in their compressed form even when they are read uncompressed,
+	// so their uncompressed contents are decompressed from the compressed reader that reports progress.
+	pulled bool
+}
+
+// compressedOnly hides the Uncompressed method of a layer, so that partial.CompressedToLayer derives it from Compressed.
+type compressedOnly struct {
+	partial.CompressedLayer
+}
+
+func (l *progressLayer) Uncompressed() (io.ReadCloser, error) {
+	if !l.pulled {
+		return l.Layer.Uncompressed()
+	}
+	layer, err := partial.CompressedToLayer(compressedOnly{l})
+	if err != nil {
+		return nil, err
+	}
+	return layer.Uncompressed()
+}
+
+func (l *progressLayer) Compressed() (io.ReadCloser, error) {
+	rc, err := l.Layer.Compressed()
+	if err != nil {
+		return nil, err
+	}
+	digest, err := l.Layer.Digest()
+	if err != nil {
+		digest = v1.Hash{}
+	}
+	size, err := l.Layer.Size()
+	if err != nil {
+		size = -1
+	}
+	return &progressReader{
+		ReadCloser: rc,
+		event:      ProgressEvent{Digest: digest, Total: size},
+		handler:    l.handler,
+	}, nil
+}
+
+type progressReader struct {
+	io.ReadCloser
+	event   ProgressEvent
+	handler ProgressHandler
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.event.Complete += int64(n)
+		r.handler(r.event)
+	}
+	return n, err
+}
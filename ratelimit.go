@@ -0,0 +1,147 @@
+package imgutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimitChunk is the most a limited reader reads at once, so that concurrent transfers interleave smoothly.
+const rateLimitChunk = 32 * 1024
+
+// RateLimiter limits the bandwidth of transfers with a token bucket. It can be shared by concurrent transfers,
+// e.g. the blob uploads of an image, so that their combined rate stays under the limit.
+type RateLimiter struct {
+	mu          sync.Mutex
+	bytesPerSec float64
+	burst       float64
+	tokens      float64
+	last        time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing bytesPerSec bytes per second, which must be positive,
+// in bursts of up to a tenth of a second of transfer.
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	burst := float64(max(bytesPerSec/10, rateLimitChunk))
+	return &RateLimiter{bytesPerSec: float64(bytesPerSec), burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait blocks until n more bytes can be transferred without exceeding the limit, or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.bytesPerSec)
+	l.last = now
+	// the bytes are reserved right away, so that later callers wait for them as well
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+	if deficit <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(deficit / l.bytesPerSec * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Reader returns a reader of r that reads no faster than the limit allows.
+func (l *RateLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &rateLimitedReader{ctx: ctx, r: r, limiter: l}
+}
+
+type rateLimitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *RateLimiter
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.Wait(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// ByteBudget caps the total number of bytes transferred by an operation, e.g. all the downloads made to build an image,
+// so that unexpectedly large transfers fail fast instead of running to completion. It can be shared by concurrent transfers.
+type ByteBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// NewByteBudget returns a ByteBudget allowing up to limit bytes to be transferred.
+func NewByteBudget(limit int64) *ByteBudget {
+	return &ByteBudget{limit: limit}
+}
+
+// Limit returns the number of bytes the budget allows.
+func (b *ByteBudget) Limit() int64 {
+	return b.limit
+}
+
+// Used returns the number of bytes transferred so far.
+func (b *ByteBudget) Used() int64 {
+	return b.used.Load()
+}
+
+// Check returns an ErrByteBudgetExceeded if transferring n more bytes would exceed the budget, without using them,
+// e.g. to fail before a transfer of known length starts.
+func (b *ByteBudget) Check(n int64) error {
+	if used := b.used.Load(); used+n > b.limit {
+		return ErrByteBudgetExceeded{Limit: b.limit, Requested: used + n}
+	}
+	return nil
+}
+
+// Use records that n more bytes were transferred, returning an ErrByteBudgetExceeded if the budget is now exceeded.
+func (b *ByteBudget) Use(n int64) error {
+	if used := b.used.Add(n); used > b.limit {
+		return ErrByteBudgetExceeded{Limit: b.limit, Requested: used}
+	}
+	return nil
+}
+
+// Reader returns a reader of r that uses the budget for the bytes it reads, failing once the budget is exceeded.
+func (b *ByteBudget) Reader(r io.Reader) io.Reader {
+	return &budgetReader{r: r, budget: b}
+}
+
+type budgetReader struct {
+	r      io.Reader
+	budget *ByteBudget
+}
+
+func (r *budgetReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if useErr := r.budget.Use(int64(n)); useErr != nil {
+			return n, useErr
+		}
+	}
+	return n, err
+}
+
+// ErrByteBudgetExceeded is returned when a transfer would exceed the ByteBudget of its operation.
+// Requested is the total number of bytes the operation would have transferred with it.
+type ErrByteBudgetExceeded struct {
+	Limit     int64
+	Requested int64
+}
+
+func (e ErrByteBudgetExceeded) Error() string {
+	return fmt.Sprintf("byte budget of %d bytes exceeded: %d bytes requested", e.Limit, e.Requested)
+}
@@ -0,0 +1,82 @@
+package imgutil_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRateLimiter(t *testing.T) {
+	spec.Run(t, "RateLimiter", testRateLimiter, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func TestByteBudget(t *testing.T) {
+	spec.Run(t, "ByteBudget", testByteBudget, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testRateLimiter(t *testing.T, when spec.G, it spec.S) {
+	when("#Reader", func() {
+		it("shares the limit between concurrent readers", func() {
+			limiter := imgutil.NewRateLimiter(4 << 20)
+			start := time.Now()
+			var wg sync.WaitGroup
+			for idx := 0; idx < 2; idx++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					n, err := io.Copy(io.Discard, limiter.Reader(context.Background(), bytes.NewReader(make([]byte, 1<<20))))
+					h.AssertNil(t, err)
+					h.AssertEq(t, n, int64(1<<20))
+				}()
+			}
+			wg.Wait()
+			// 2MiB at 4MiB/s, less the initial burst of 0.4MiB
+			h.AssertEq(t, time.Since(start) > 350*time.Millisecond, true)
+		})
+	})
+
+	when("#Wait", func() {
+		it("returns when the context is done", func() {
+			limiter := imgutil.NewRateLimiter(1024)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			h.AssertError(t, limiter.Wait(ctx, 1<<20), "context deadline exceeded")
+		})
+	})
+}
+
+func testByteBudget(t *testing.T, when spec.G, it spec.S) {
+	when("#Check", func() {
+		it("fails without using the bytes if they would exceed the budget", func() {
+			budget := imgutil.NewByteBudget(100)
+			h.AssertNil(t, budget.Use(60))
+			h.AssertNil(t, budget.Check(40))
+			var budgetErr imgutil.ErrByteBudgetExceeded
+			h.AssertEq(t, errors.As(budget.Check(41), &budgetErr), true)
+			h.AssertEq(t, budgetErr, imgutil.ErrByteBudgetExceeded{Limit: 100, Requested: 101})
+			h.AssertEq(t, budget.Used(), int64(60))
+		})
+	})
+
+	when("#Reader", func() {
+		it("fails once the readers together exceed the budget", func() {
+			budget := imgutil.NewByteBudget(1 << 10)
+			n, err := io.Copy(io.Discard, budget.Reader(bytes.NewReader(make([]byte, 1<<9))))
+			h.AssertNil(t, err)
+			h.AssertEq(t, n, int64(1<<9))
+
+			_, err = io.Copy(io.Discard, budget.Reader(bytes.NewReader(make([]byte, 1<<10))))
+			h.AssertError(t, err, "byte budget of 1024 bytes exceeded")
+		})
+	})
+}
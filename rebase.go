@@ -0,0 +1,74 @@
+package imgutil
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// RebaseMismatch describes a property that differs between the image being rebased and its new base,
+// such that the rebased image is unlikely to work.
+type RebaseMismatch struct {
+	// Field is the config field or label that differs, e.g. "os" or StackIDLabel.
+	Field string
+	Old   string
+	New   string
+}
+
+// ErrRebaseMismatch is returned by Rebase, when rebase validation is enabled with WithRebaseValidation,
+// if the image cannot safely be rebased onto the new base. The image is left unchanged.
+type ErrRebaseMismatch struct {
+	Mismatches []RebaseMismatch
+}
+
+func (e ErrRebaseMismatch) Error() string {
+	var details []string
+	for _, m := range e.Mismatches {
+		details = append(details, fmt.Sprintf("%s: %q != %q", m.Field, m.Old, m.New))
+	}
+	return fmt.Sprintf("image cannot be rebased: %s", strings.Join(details, ", "))
+}
+
+// validateRebase compares the working image, which carries the properties of its current base,
+// with the new base, returning an ErrRebaseMismatch if the image is not rebasable or the platforms, stacks or distributions differ.
+// Labels that are missing from either image are not compared.
+func validateRebase(image v1.Image, newBase v1.Image) error {
+	oldConfig, err := getConfigFile(image)
+	if err != nil {
+		return err
+	}
+	newConfig, err := getConfigFile(newBase)
+	if err != nil {
+		return err
+	}
+
+	var mismatches []RebaseMismatch
+	if oldConfig.Config.Labels[RebasableLabel] == "false" {
+		mismatches = append(mismatches, RebaseMismatch{Field: RebasableLabel, Old: "false"})
+	}
+	for _, field := range []struct {
+		name     string
+		old, new string
+	}{
+		{"os", oldConfig.OS, newConfig.OS},
+		{"architecture", oldConfig.Architecture, newConfig.Architecture},
+		{"variant", oldConfig.Variant, newConfig.Variant},
+		{"os.version", oldConfig.OSVersion, newConfig.OSVersion},
+	} {
+		if field.old != field.new {
+			mismatches = append(mismatches, RebaseMismatch{Field: field.name, Old: field.old, New: field.new})
+		}
+	}
+	for _, label := range []string{StackIDLabel, DistroNameLabel, DistroVersionLabel} {
+		oldValue, newValue := oldConfig.Config.Labels[label], newConfig.Config.Labels[label]
+		if oldValue != "" && newValue != "" && oldValue != newValue {
+			mismatches = append(mismatches, RebaseMismatch{Field: label, Old: oldValue, New: newValue})
+		}
+	}
+
+	if len(mismatches) > 0 {
+		return ErrRebaseMismatch{Mismatches: mismatches}
+	}
+	return nil
+}
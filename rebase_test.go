@@ -0,0 +1,107 @@
+package imgutil_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRebaseValidation(t *testing.T) {
+	spec.Run(t, "RebaseValidation", testRebaseValidation, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testRebaseValidation(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "rebase-validation-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	newBase := func(name string, mutateConfig func(*v1.ConfigFile)) *layout.Image {
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile = configFile.DeepCopy()
+		configFile.OS = "linux"
+		configFile.Architecture = "amd64"
+		configFile.Config.Labels = map[string]string{
+			imgutil.StackIDLabel:       "some-stack",
+			imgutil.DistroNameLabel:    "ubuntu",
+			imgutil.DistroVersionLabel: "22.04",
+		}
+		mutateConfig(configFile)
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		base, err := layout.NewImage(filepath.Join(tmpDir, name), layout.FromBaseImageInstance(image))
+		h.AssertNil(t, err)
+		return base
+	}
+
+	newAppImage := func(ops ...imgutil.ImageOption) (*layout.Image, string) {
+		oldBase := newBase("old-base", func(*v1.ConfigFile) {})
+		topLayer, err := oldBase.TopLayer()
+		h.AssertNil(t, err)
+		underlying := oldBase.UnderlyingImage()
+		ops = append([]imgutil.ImageOption{layout.FromBaseImageInstance(underlying)}, ops...)
+		app, err := layout.NewImage(filepath.Join(tmpDir, "app"), ops...)
+		h.AssertNil(t, err)
+		return app, topLayer
+	}
+
+	it("rebases onto a compatible base", func() {
+		app, topLayer := newAppImage(imgutil.WithRebaseValidation())
+		newBase := newBase("new-base", func(c *v1.ConfigFile) {
+			c.Config.Labels[imgutil.DistroVersionLabel] = ""
+		})
+		h.AssertNil(t, app.Rebase(topLayer, newBase))
+	})
+
+	it("reports the differences between the current and the new base", func() {
+		app, topLayer := newAppImage(imgutil.WithRebaseValidation())
+		newBase := newBase("new-base", func(c *v1.ConfigFile) {
+			c.Architecture = "arm64"
+			c.Config.Labels[imgutil.DistroVersionLabel] = "24.04"
+		})
+		err := app.Rebase(topLayer, newBase)
+
+		var mismatch imgutil.ErrRebaseMismatch
+		h.AssertEq(t, errors.As(err, &mismatch), true)
+		h.AssertEq(t, mismatch.Mismatches, []imgutil.RebaseMismatch{
+			{Field: "architecture", Old: "amd64", New: "arm64"},
+			{Field: imgutil.DistroVersionLabel, Old: "22.04", New: "24.04"},
+		})
+	})
+
+	it("fails for an image that is not rebasable", func() {
+		app, topLayer := newAppImage(imgutil.WithRebaseValidation())
+		h.AssertNil(t, app.SetLabel(imgutil.RebasableLabel, "false"))
+		err := app.Rebase(topLayer, newBase("new-base", func(*v1.ConfigFile) {}))
+		h.AssertError(t, err, imgutil.RebasableLabel)
+	})
+
+	it("does not validate unless requested", func() {
+		app, topLayer := newAppImage()
+		newBase := newBase("new-base", func(c *v1.ConfigFile) {
+			c.Config.Labels[imgutil.StackIDLabel] = "other-stack"
+		})
+		h.AssertNil(t, app.Rebase(topLayer, newBase))
+	})
+}
@@ -0,0 +1,286 @@
+package imgutil
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RegistriesConfig is a per-registry configuration read from a file in the format of the registries.conf (version 2)
+// files of containers/image, e.g.
+//
+//	[[registry]]
+//	prefix = "registry.example.com/team"
+//	insecure = true
+//	mirror-by-digest-only = true
+//
+//	[[registry.mirror]]
+//	location = "mirror.example.com/team"
+//	insecure = true
+//
+//	[[registry]]
+//	location = "blocked.example.com"
+//	blocked = true
+//
+// Each [[registry]] table applies to the image names starting with its prefix (its location if no prefix is given),
+// as the names are given; the setting with the longest matching prefix applies. Rewriting a prefix to another location
+// is not supported, and other tables and keys, such as unqualified-search-registries, are ignored.
+type RegistriesConfig struct {
+	// Registries are the settings of the registries, by prefix.
+	Registries map[string]RegistrySetting
+}
+
+// RegistryMirror is a mirror of a registry, whose location replaces the prefix of the registry in image names.
+type RegistryMirror struct {
+	Location string
+	Insecure bool
+}
+
+// ErrBlockedRegistry is returned when accessing an image in a registry blocked by its RegistrySetting.
+type ErrBlockedRegistry struct {
+	RepoName string
+}
+
+func (e ErrBlockedRegistry) Error() string {
+	return fmt.Sprintf("registry of %s is blocked", e.RepoName)
+}
+
+// LoadRegistriesConfig reads the registries configuration from the file at the provided path.
+func LoadRegistriesConfig(path string) (*RegistriesConfig, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("reading registries config: %w", err)
+	}
+	config, err := ParseRegistriesConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing registries config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// registryTable is a [[registry]] table being parsed.
+type registryTable struct {
+	prefix   string
+	location string
+	line     int
+	setting  RegistrySetting
+}
+
+// ParseRegistriesConfig parses a registries configuration; see RegistriesConfig for the supported format.
+func ParseRegistriesConfig(data []byte) (*RegistriesConfig, error) {
+	var (
+		tables  []*registryTable
+		table   string
+		scanner = bufio.NewScanner(bytes.NewReader(data))
+		lineNum int
+	)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "["):
+			table = strings.TrimSpace(strings.Trim(line, "[]"))
+			switch table {
+			case "registry":
+				tables = append(tables, &registryTable{line: lineNum})
+			case "registry.mirror":
+				if len(tables) == 0 {
+					return nil, fmt.Errorf("line %d: [[registry.mirror]] outside of a [[registry]] table", lineNum)
+				}
+				current := tables[len(tables)-1]
+				current.setting.Mirrors = append(current.setting.Mirrors, RegistryMirror{})
+			case "registries.search", "registries.insecure", "registries.block":
+				return nil, fmt.Errorf("line %d: version 1 table [%s] is not supported", lineNum, table)
+			}
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected a key = value pair", lineNum)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		// values of ignored keys may be arrays spanning several lines
+		if strings.HasPrefix(value, "[") {
+			for !strings.Contains(value, "]") && scanner.Scan() {
+				lineNum++
+				value += stripComment(scanner.Text())
+			}
+		}
+		if len(tables) == 0 || (table != "registry" && table != "registry.mirror") {
+			continue
+		}
+		if err := setRegistryKey(tables[len(tables)-1], table, key, value); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	config := &RegistriesConfig{Registries: make(map[string]RegistrySetting, len(tables))}
+	for _, t := range tables {
+		prefix := t.prefix
+		if prefix == "" {
+			prefix = t.location
+		}
+		switch {
+		case prefix == "":
+			return nil, fmt.Errorf("line %d: registry has neither a prefix nor a location", t.line)
+		case t.location != "" && t.location != prefix:
+			return nil, fmt.Errorf("line %d: rewriting prefix %s to location %s is not supported", t.line, prefix, t.location)
+		}
+		for _, mirror := range t.setting.Mirrors {
+			if mirror.Location == "" {
+				return nil, fmt.Errorf("line %d: a mirror of %s has no location", t.line, prefix)
+			}
+		}
+		if _, ok := config.Registries[prefix]; ok {
+			return nil, fmt.Errorf("line %d: registry %s is configured more than once", t.line, prefix)
+		}
+		config.Registries[prefix] = t.setting
+	}
+	return config, nil
+}
+
+func setRegistryKey(t *registryTable, table, key, value string) error {
+	if table == "registry.mirror" {
+		mirror := &t.setting.Mirrors[len(t.setting.Mirrors)-1]
+		switch key {
+		case "location":
+			return parseRegistryValue(key, value, &mirror.Location)
+		case "insecure":
+			return parseRegistryValue(key, value, &mirror.Insecure)
+		}
+		return nil
+	}
+	switch key {
+	case "prefix":
+		return parseRegistryValue(key, value, &t.prefix)
+	case "location":
+		return parseRegistryValue(key, value, &t.location)
+	case "insecure":
+		return parseRegistryValue(key, value, &t.setting.Insecure)
+	case "blocked":
+		return parseRegistryValue(key, value, &t.setting.Blocked)
+	case "mirror-by-digest-only":
+		return parseRegistryValue(key, value, &t.setting.MirrorByDigestOnly)
+	}
+	return nil
+}
+
+func parseRegistryValue(key, value string, dst interface{}) error {
+	switch dst := dst.(type) {
+	case *string:
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return fmt.Errorf("%s must be a quoted string; got %s", key, value)
+		}
+		*dst = strings.TrimSuffix(unquoted, "/")
+	case *bool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("%s must be true or false; got %s", key, value)
+		}
+		*dst = value == "true"
+	}
+	return nil
+}
+
+// stripComment removes the comment from the line, if any, ignoring # characters in quoted strings.
+func stripComment(line string) string {
+	inString := false
+	for idx := 0; idx < len(line); idx++ {
+		switch line[idx] {
+		case '\\':
+			if inString {
+				idx++
+			}
+		case '"':
+			inString = !inString
+		case '#':
+			if !inString {
+				return line[:idx]
+			}
+		}
+	}
+	return line
+}
+
+// MergeRegistriesConfig reads the registries configuration in the file at the provided path, if one is given,
+// and merges the given settings with it; see MergeRegistrySettings. It is used by the image and index options
+// that take a registries configuration, so that they read it the same way.
+func MergeRegistriesConfig(path string, given map[string]RegistrySetting) (map[string]RegistrySetting, error) {
+	if path == "" {
+		return given, nil
+	}
+	config, err := LoadRegistriesConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return config.MergeRegistrySettings(given), nil
+}
+
+// MergeRegistrySettings returns the settings of the configuration merged with the given ones, which take precedence,
+// except that a registry is insecure or blocked if either says so, and that mirrors are listed in both.
+// Insecure mirrors are added as insecure registries.
+func (c *RegistriesConfig) MergeRegistrySettings(given map[string]RegistrySetting) map[string]RegistrySetting {
+	merged := make(map[string]RegistrySetting, len(c.Registries)+len(given))
+	for prefix, setting := range c.Registries {
+		merged[prefix] = setting
+	}
+	for _, setting := range c.Registries {
+		for _, mirror := range setting.Mirrors {
+			if mirror.Insecure {
+				mirrorSetting := merged[mirror.Location]
+				mirrorSetting.Insecure = true
+				merged[mirror.Location] = mirrorSetting
+			}
+		}
+	}
+	for prefix, setting := range given {
+		if configured, ok := merged[prefix]; ok {
+			setting.Insecure = setting.Insecure || configured.Insecure
+			setting.Blocked = setting.Blocked || configured.Blocked
+			setting.MirrorByDigestOnly = setting.MirrorByDigestOnly || configured.MirrorByDigestOnly
+			setting.Mirrors = append(append([]RegistryMirror{}, configured.Mirrors...), setting.Mirrors...)
+			if setting.Proxy == nil {
+				setting.Proxy = configured.Proxy
+			}
+		}
+		merged[prefix] = setting
+	}
+	return merged
+}
+
+// LookupRegistrySetting returns the setting with the longest prefix of the image name, and that prefix,
+// or a zero setting if no prefix matches.
+func LookupRegistrySetting(repoName string, settings map[string]RegistrySetting) (string, RegistrySetting) {
+	var (
+		matched string
+		setting RegistrySetting
+	)
+	for prefix, s := range settings {
+		if strings.HasPrefix(repoName, prefix) && len(prefix) >= len(matched) {
+			matched, setting = prefix, s
+		}
+	}
+	return matched, setting
+}
+
+// MirrorRepoNames returns the names of the image in the mirrors of the setting with the given prefix, in order,
+// replacing the prefix with the locations of the mirrors. Tags are not mirrored if MirrorByDigestOnly is set.
+func (s RegistrySetting) MirrorRepoNames(repoName, prefix string) []string {
+	if s.MirrorByDigestOnly && !strings.Contains(repoName, "@") {
+		return nil
+	}
+	var names []string
+	for _, mirror := range s.Mirrors {
+		names = append(names, mirror.Location+strings.TrimPrefix(repoName, prefix))
+	}
+	return names
+}
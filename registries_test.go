@@ -0,0 +1,110 @@
+package imgutil_test
+
+import (
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRegistriesConfig(t *testing.T) {
+	spec.Run(t, "RegistriesConfig", testRegistriesConfig, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testRegistriesConfig(t *testing.T, when spec.G, it spec.S) {
+	when("#ParseRegistriesConfig", func() {
+		it("parses the registries and their mirrors", func() {
+			config, err := imgutil.ParseRegistriesConfig([]byte(`
+unqualified-search-registries = [
+  "docker.io", # the default
+]
+
+[[registry]]
+prefix = "registry.example.com/team" # a comment
+insecure = true
+mirror-by-digest-only = true
+
+[[registry.mirror]]
+location = "mirror.example.com/team/"
+insecure = true
+
+[[registry.mirror]]
+location = "other-mirror.example.com/team"
+
+[[registry]]
+location = "blocked.example.com"
+blocked = true
+
+[aliases]
+"ubuntu" = "docker.io/library/ubuntu"
+`))
+			h.AssertNil(t, err)
+			h.AssertEq(t, config.Registries, map[string]imgutil.RegistrySetting{
+				"registry.example.com/team": {
+					Insecure:           true,
+					MirrorByDigestOnly: true,
+					Mirrors: []imgutil.RegistryMirror{
+						{Location: "mirror.example.com/team", Insecure: true},
+						{Location: "other-mirror.example.com/team"},
+					},
+				},
+				"blocked.example.com": {Blocked: true},
+			})
+		})
+
+		it("fails when a prefix is rewritten to another location", func() {
+			_, err := imgutil.ParseRegistriesConfig([]byte("[[registry]]\nprefix = \"a.example.com\"\nlocation = \"b.example.com\"\n"))
+			h.AssertError(t, err, "line 1: rewriting prefix a.example.com to location b.example.com is not supported")
+		})
+
+		it("fails for version 1 files", func() {
+			_, err := imgutil.ParseRegistriesConfig([]byte("[registries.insecure]\nregistries = [\"a.example.com\"]\n"))
+			h.AssertError(t, err, "version 1 table [registries.insecure] is not supported")
+		})
+	})
+
+	when("#MergeRegistrySettings", func() {
+		it("merges the given settings and adds insecure mirrors", func() {
+			config := &imgutil.RegistriesConfig{Registries: map[string]imgutil.RegistrySetting{
+				"registry.example.com": {Insecure: true, Mirrors: []imgutil.RegistryMirror{{Location: "mirror.example.com", Insecure: true}}},
+			}}
+			merged := config.MergeRegistrySettings(map[string]imgutil.RegistrySetting{
+				"registry.example.com": {Blocked: true},
+				"other.example.com":    {Insecure: true},
+			})
+			h.AssertEq(t, merged, map[string]imgutil.RegistrySetting{
+				"registry.example.com": {Insecure: true, Blocked: true, Mirrors: []imgutil.RegistryMirror{{Location: "mirror.example.com", Insecure: true}}},
+				"mirror.example.com":   {Insecure: true},
+				"other.example.com":    {Insecure: true},
+			})
+		})
+	})
+
+	when("#LookupRegistrySetting", func() {
+		it("returns the setting with the longest matching prefix", func() {
+			settings := map[string]imgutil.RegistrySetting{
+				"registry.example.com":      {Insecure: true},
+				"registry.example.com/team": {Blocked: true},
+			}
+			prefix, setting := imgutil.LookupRegistrySetting("registry.example.com/team/app:latest", settings)
+			h.AssertEq(t, prefix, "registry.example.com/team")
+			h.AssertEq(t, setting, imgutil.RegistrySetting{Blocked: true})
+
+			prefix, _ = imgutil.LookupRegistrySetting("other.example.com/app", settings)
+			h.AssertEq(t, prefix, "")
+		})
+	})
+
+	when("RegistrySetting#MirrorRepoNames", func() {
+		it("replaces the prefix with the mirror locations", func() {
+			setting := imgutil.RegistrySetting{Mirrors: []imgutil.RegistryMirror{{Location: "mirror.example.com/team"}}}
+			h.AssertEq(t, setting.MirrorRepoNames("registry.example.com/app:latest", "registry.example.com"), []string{"mirror.example.com/team/app:latest"})
+
+			setting.MirrorByDigestOnly = true
+			h.AssertEq(t, len(setting.MirrorRepoNames("registry.example.com/app:latest", "registry.example.com")), 0)
+		})
+	})
+}
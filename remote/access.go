@@ -0,0 +1,62 @@
+package remote
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// CheckAccess verifies that the image can be pulled from and/or pushed to its registry with the credentials from the keychain.
+// Pull access is probed by requesting the image manifest; the image does not need to exist.
+// Push access is probed by initiating a blob upload to the repository, which is not completed.
+// It returns an imgutil.ErrAccessDenied if the registry refuses the access. It fails before accessing the registry
+// if one of the options was given an invalid value or the registries configuration cannot be read, as image constructors do.
+func CheckAccess(repoName string, keychain authn.Keychain, scope imgutil.AccessScope, ops ...imgutil.ImageOption) error {
+	options, err := newOptions(ops)
+	if err != nil {
+		return err
+	}
+	reg := getRegistrySetting(repoName, options.RegistrySettings)
+	ref, auth, err := referenceForRepoName(keychain, repoName, reg)
+	if err != nil {
+		return err
+	}
+	httpTransport := getTransport(reg, options.RemoteOptions, options.Logger)
+
+	if scope&imgutil.PullAccess != 0 {
+		err = withRetry(options.RetryPolicy, func() error {
+			_, err := remote.Head(ref, retryOptions(options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(httpTransport))...)
+			return err
+		})
+		if err != nil && !hasStatus(err, http.StatusNotFound) {
+			return accessError(repoName, imgutil.PullAccess, err)
+		}
+	}
+	if scope&imgutil.PushAccess != 0 {
+		err = withRetry(options.RetryPolicy, func() error {
+			return remote.CheckPushPermission(ref, keychain, httpTransport)
+		})
+		if err != nil {
+			return accessError(repoName, imgutil.PushAccess, err)
+		}
+	}
+	return nil
+}
+
+// accessError returns an imgutil.ErrAccessDenied if the registry refused the request, or the error otherwise.
+func accessError(repoName string, scope imgutil.AccessScope, err error) error {
+	if hasStatus(err, http.StatusUnauthorized) || hasStatus(err, http.StatusForbidden) {
+		return imgutil.ErrAccessDenied{Ref: repoName, Scope: scope, Cause: err}
+	}
+	return err
+}
+
+func hasStatus(err error, statusCode int) bool {
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr) && transportErr.StatusCode == statusCode
+}
@@ -0,0 +1,81 @@
+package remote_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestAccess(t *testing.T) {
+	spec.Run(t, "Access", testAccess, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testAccess(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server *httptest.Server
+		host   string
+	)
+
+	it.Before(func() {
+		reg := registry.New()
+		// repositories under "private/" cannot be read, and repositories under "readonly/" cannot be written
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case strings.HasPrefix(r.URL.Path, "/v2/private/"):
+				w.WriteHeader(http.StatusForbidden)
+			case strings.HasPrefix(r.URL.Path, "/v2/readonly/") && r.Method == http.MethodPost:
+				w.WriteHeader(http.StatusForbidden)
+			default:
+				reg.ServeHTTP(w, r)
+			}
+		}))
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	it("fails for invalid options", func() {
+		err := remote.CheckAccess(host+"/public/image", authn.DefaultKeychain, imgutil.PullAccess, imgutil.WithGzipLevel(10))
+		h.AssertError(t, err, "invalid gzip level")
+	})
+
+	it("allows pulling and pushing an image that does not exist yet", func() {
+		h.AssertNil(t, remote.CheckAccess(host+"/public/image", authn.DefaultKeychain, imgutil.PullPushAccess))
+	})
+
+	it("reports denied pull access", func() {
+		err := remote.CheckAccess(host+"/private/image", authn.DefaultKeychain, imgutil.PullAccess)
+		var denied imgutil.ErrAccessDenied
+		h.AssertEq(t, errors.As(err, &denied), true)
+		h.AssertEq(t, denied.Scope, imgutil.PullAccess)
+	})
+
+	it("reports denied push access", func() {
+		h.AssertNil(t, remote.CheckAccess(host+"/readonly/image", authn.DefaultKeychain, imgutil.PullAccess))
+
+		err := remote.CheckAccess(host+"/readonly/image", authn.DefaultKeychain, imgutil.PullPushAccess)
+		var denied imgutil.ErrAccessDenied
+		h.AssertEq(t, errors.As(err, &denied), true)
+		h.AssertEq(t, denied.Scope, imgutil.PushAccess)
+	})
+
+	it("is available through imgutil.CheckAccess", func() {
+		h.AssertNil(t, imgutil.CheckAccess("docker://"+host+"/public/image", imgutil.PullPushAccess))
+	})
+}
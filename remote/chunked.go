@@ -0,0 +1,236 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// uploadLargeLayers uploads the layers of the image of at least the chunked upload threshold in chunks,
+// before the image is written, so that remote.Write finds them in the repository and only uploads the other blobs.
+// Layers that already exist in the repository or are mounted from another repository on the same registry are skipped.
+func (i *Image) uploadLargeLayers(ref name.Reference, auth authn.Authenticator, reg imgutil.RegistrySetting, image v1.Image) error {
+	if i.remoteOptions.UploadChunkSize <= 0 {
+		return nil
+	}
+	layers, err := image.Layers()
+	if err != nil {
+		return err
+	}
+	var client *http.Client
+	for _, layer := range layers {
+		if mountable, ok := layer.(*remote.MountableLayer); ok && mountable.Reference.Context().RegistryStr() == ref.Context().RegistryStr() {
+			continue
+		}
+		desc, err := partial.Descriptor(layer)
+		if err != nil {
+			return err
+		}
+		if desc.Size < i.remoteOptions.ChunkedUploadThreshold || len(desc.URLs) > 0 {
+			continue
+		}
+		if client == nil {
+			rt, err := transport.NewWithContext(context.Background(), ref.Context().Registry, auth,
+				getTransport(reg, i.remoteOptions, i.logger), []string{ref.Scope(transport.PushScope)})
+			if err != nil {
+				return err
+			}
+			client = &http.Client{Transport: rt}
+		}
+		imgutil.Debugf(i.logger, "uploading layer %s (%d bytes) in chunks of %d bytes", desc.Digest, desc.Size, i.remoteOptions.UploadChunkSize)
+		upload := &chunkedUpload{
+			client:    client,
+			repo:      ref.Context(),
+			digest:    desc.Digest,
+			size:      desc.Size,
+			chunkSize: i.remoteOptions.UploadChunkSize,
+			policy:    i.retryPolicy,
+		}
+		if err = upload.run(layer); err != nil {
+			return fmt.Errorf("uploading layer %s in chunks: %w", desc.Digest, err)
+		}
+	}
+	return nil
+}
+
+// chunkedUpload uploads a blob with the chunked upload protocol of the distribution spec,
+// holding one chunk in memory so that it can be sent again, from the offset the registry reports, when it fails.
+type chunkedUpload struct {
+	client    *http.Client
+	repo      name.Repository
+	digest    v1.Hash
+	size      int64
+	chunkSize int64
+	policy    imgutil.RetryPolicy
+
+	location string
+	offset   int64
+}
+
+func (u *chunkedUpload) run(layer v1.Layer) error {
+	exists, err := u.exists()
+	if err != nil || exists {
+		return err
+	}
+	if err = withRetry(u.policy, u.start); err != nil {
+		return err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	chunk := make([]byte, min(u.chunkSize, u.size))
+	for u.offset < u.size {
+		start := u.offset
+		n, err := io.ReadFull(rc, chunk[:min(u.chunkSize, u.size-start)])
+		if err != nil {
+			return err
+		}
+		if err = withRetry(u.policy, func() error { return u.patch(chunk[:n], start) }); err != nil {
+			return err
+		}
+	}
+	return withRetry(u.policy, u.commit)
+}
+
+func (u *chunkedUpload) url(path string) string {
+	return fmt.Sprintf("%s://%s/v2/%s/%s", u.repo.Registry.Scheme(), u.repo.RegistryStr(), u.repo.RepositoryStr(), path)
+}
+
+func (u *chunkedUpload) exists() (bool, error) {
+	var exists bool
+	err := withRetry(u.policy, func() error {
+		resp, err := u.client.Head(u.url("blobs/" + u.digest.String()))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		exists = resp.StatusCode == http.StatusOK
+		return transport.CheckError(resp, http.StatusOK, http.StatusNotFound)
+	})
+	return exists, err
+}
+
+func (u *chunkedUpload) start() error {
+	resp, err := u.client.Post(u.url("blobs/uploads/"), "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err = transport.CheckError(resp, http.StatusAccepted); err != nil {
+		return err
+	}
+	return u.setLocation(resp)
+}
+
+// patch sends the chunk starting at the given offset of the blob. If the upload is ahead of the offset,
+// because the registry received part of the chunk in a failed attempt, only the rest of the chunk is sent.
+func (u *chunkedUpload) patch(chunk []byte, start int64) error {
+	skip := u.offset - start
+	if skip < 0 || skip > int64(len(chunk)) {
+		return fmt.Errorf("upload is at offset %d, outside of the chunk at offset %d", u.offset, start)
+	}
+	if skip == int64(len(chunk)) {
+		return nil
+	}
+	body := chunk[skip:]
+	req, err := http.NewRequest(http.MethodPatch, u.location, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", u.offset, u.offset+int64(len(body))-1))
+	resp, err := u.client.Do(req)
+	if err != nil {
+		u.resume()
+		return err
+	}
+	defer resp.Body.Close()
+	if err = transport.CheckError(resp, http.StatusAccepted, http.StatusNoContent); err != nil {
+		u.resume()
+		return err
+	}
+	u.offset += int64(len(body))
+	return u.setLocation(resp)
+}
+
+// resume asks the registry how much of the blob it received, so that the next attempt sends the rest.
+// If the registry does not report it, the next attempt sends the chunk again from the last known offset.
+func (u *chunkedUpload) resume() {
+	resp, err := u.client.Get(u.location)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return
+	}
+	if offset, ok := uploadedBytes(resp.Header.Get("Range")); ok {
+		imgutil.Debugf(u.policy.Logger, "resuming upload of layer %s at offset %d", u.digest, offset)
+		u.offset = offset
+		_ = u.setLocation(resp)
+	}
+}
+
+func (u *chunkedUpload) commit() error {
+	location, err := url.Parse(u.location)
+	if err != nil {
+		return err
+	}
+	query := location.Query()
+	query.Set("digest", u.digest.String())
+	location.RawQuery = query.Encode()
+	req, err := http.NewRequest(http.MethodPut, location.String(), http.NoBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return transport.CheckError(resp, http.StatusCreated)
+}
+
+// setLocation sets the URL of the upload to the location of the response, which may be relative to the request.
+func (u *chunkedUpload) setLocation(resp *http.Response) error {
+	location, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("missing upload location: %w", err)
+	}
+	u.location = location.String()
+	return nil
+}
+
+// uploadedBytes returns the number of bytes received by the registry from the Range header of an upload, e.g. 0-1023.
+// Registries report an empty upload as 0-0, which is taken to mean that no bytes were received.
+func uploadedBytes(header string) (int64, bool) {
+	_, end, found := strings.Cut(header, "-")
+	if !found {
+		return 0, false
+	}
+	if header == "0-0" {
+		return 0, true
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return last + 1, true
+}
@@ -0,0 +1,97 @@
+package remote_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/google/go-containerregistry/pkg/v1/validate"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestChunkedUploads(t *testing.T) {
+	spec.Run(t, "ChunkedUploads", testChunkedUploads, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testChunkedUploads(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server    *httptest.Server
+		host      string
+		mu        sync.Mutex
+		ranges    []string
+		failPatch int
+	)
+
+	it.Before(func() {
+		handler := registry.New()
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if req.Method == http.MethodPatch && req.Header.Get("Content-Range") != "" {
+				mu.Lock()
+				ranges = append(ranges, req.Header.Get("Content-Range"))
+				fail := len(ranges) == failPatch
+				mu.Unlock()
+				if fail {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+			handler.ServeHTTP(w, req)
+		}))
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	// saveImage saves an image with a small layer and a large one, and returns the compressed size of the large layer
+	saveImage := func() int64 {
+		image, err := remote.NewImage(host+"/chunked/app", authn.DefaultKeychain, remote.WithChunkedUploads(32<<10, 64<<10))
+		h.AssertNil(t, err)
+		small, err := random.Layer(1<<10, types.OCILayer)
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.AddLayerWithHistory(small, v1.History{}))
+		large, err := random.Layer(100<<10, types.OCILayer)
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.AddLayerWithHistory(large, v1.History{}))
+		h.AssertNil(t, image.Save())
+
+		ref, err := name.ParseReference(host + "/chunked/app")
+		h.AssertNil(t, err)
+		saved, err := ggcrremote.Image(ref)
+		h.AssertNil(t, err)
+		h.AssertNil(t, validate.Image(saved))
+		size, err := large.Size()
+		h.AssertNil(t, err)
+		return size
+	}
+
+	it("uploads large layers in chunks", func() {
+		size := saveImage()
+		h.AssertEq(t, len(ranges), int((size+32<<10-1)/(32<<10)))
+		h.AssertEq(t, ranges[0], "0-32767")
+		h.AssertEq(t, ranges[1], "32768-65535")
+	})
+
+	it("resumes the upload from the failed chunk", func() {
+		failPatch = 2
+		size := saveImage()
+		h.AssertEq(t, len(ranges), int((size+32<<10-1)/(32<<10))+1)
+		h.AssertEq(t, ranges[:3], []string{"0-32767", "32768-65535", "32768-65535"})
+	})
+}
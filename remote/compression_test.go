@@ -0,0 +1,65 @@
+package remote_test
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestCompression(t *testing.T) {
+	spec.Run(t, "Compression", testCompression, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testCompression(t *testing.T, when spec.G, it spec.S) {
+	when("#WithLayerCompression", func() {
+		it("pushes zstd layers with the zstd media type", func() {
+			server, _ := flakyRegistry(0)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			repoName := u.Host + "/compression/image"
+
+			tmpDir, err := os.MkdirTemp("", "compression-test")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(tmpDir)
+			layerPath, diffID, _ := h.RandomLayer(t, tmpDir)
+
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.WithLayerCompression(imgutil.Zstd))
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.AddLayerWithDiffID(layerPath, diffID))
+			h.AssertNil(t, img.Save())
+
+			ref, err := name.ParseReference(repoName)
+			h.AssertNil(t, err)
+			pushed, err := ggcrremote.Image(ref)
+			h.AssertNil(t, err)
+			manifest, err := pushed.Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(manifest.Layers), 1)
+			h.AssertEq(t, manifest.Layers[0].MediaType, types.OCILayerZStd)
+
+			layers, err := pushed.Layers()
+			h.AssertNil(t, err)
+			actualDiffID, err := layers[0].DiffID()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actualDiffID.String(), diffID)
+			rc, err := layers[0].Uncompressed()
+			h.AssertNil(t, err)
+			defer rc.Close()
+			_, err = io.Copy(io.Discard, rc)
+			h.AssertNil(t, err)
+		})
+	})
+}
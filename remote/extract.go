@@ -0,0 +1,48 @@
+package remote
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/buildpacks/imgutil"
+)
+
+var _ imgutil.ExtractDestination = (*ExtractDestination)(nil)
+
+// ExtractDestination pushes an extracted image to a registry, preserving its digest.
+type ExtractDestination struct {
+	repoName string
+	keychain authn.Keychain
+	options  imgutil.ImageOptions
+}
+
+// NewExtractDestination returns an imgutil.ExtractDestination that pushes the image to `repoName` as it is,
+// with the registry settings, retry policy and transport of the given options, as images are saved.
+// It fails if one of the options was given an invalid value or the registries configuration cannot be read.
+func NewExtractDestination(repoName string, keychain authn.Keychain, ops ...imgutil.ImageOption) (*ExtractDestination, error) {
+	options, err := newOptions(ops)
+	if err != nil {
+		return nil, err
+	}
+	return &ExtractDestination{repoName: repoName, keychain: keychain, options: *options}, nil
+}
+
+func (d *ExtractDestination) WriteImage(image v1.Image) error {
+	reg := getRegistrySetting(d.repoName, d.options.RegistrySettings)
+	ref, auth, err := referenceForRepoName(d.keychain, d.repoName, reg)
+	if err != nil {
+		return err
+	}
+	remoteOpts := retryOptions(d.options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, d.options.RemoteOptions, d.options.Logger)))
+	if d.options.UploadConcurrency > 0 {
+		remoteOpts = append(remoteOpts, remote.WithJobs(d.options.UploadConcurrency))
+	}
+	if err = withRetry(d.options.RetryPolicy, func() error {
+		return remote.Write(ref, image, remoteOpts...)
+	}); err != nil {
+		return err
+	}
+	d.options.ManifestCache.Forget(ref)
+	return nil
+}
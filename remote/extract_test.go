@@ -0,0 +1,66 @@
+package remote_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestExtractDestination(t *testing.T) {
+	spec.Run(t, "ExtractDestination", testExtractDestination, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testExtractDestination(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server *httptest.Server
+		host   string
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	it("pushes the image with its digest and the transport of the options", func() {
+		image, err := random.Image(100, 2)
+		h.AssertNil(t, err)
+		rt := &countingTransport{}
+		dest, err := remote.NewExtractDestination(host+"/extract/image", authn.DefaultKeychain, remote.WithTransport(rt))
+		h.AssertNil(t, err)
+		h.AssertNil(t, dest.WriteImage(image))
+		h.AssertEq(t, rt.requests.Load() > 0, true)
+
+		ref, err := name.ParseReference(host + "/extract/image")
+		h.AssertNil(t, err)
+		pushed, err := ggcrremote.Image(ref)
+		h.AssertNil(t, err)
+		pushedDigest, err := pushed.Digest()
+		h.AssertNil(t, err)
+		digest, err := image.Digest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, pushedDigest, digest)
+	})
+
+	it("fails for invalid options", func() {
+		_, err := remote.NewExtractDestination(host+"/extract/image", authn.DefaultKeychain, imgutil.WithGzipLevel(10))
+		h.AssertError(t, err, "invalid gzip level")
+	})
+}
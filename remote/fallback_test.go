@@ -0,0 +1,86 @@
+package remote_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestPlatformFallback(t *testing.T) {
+	spec.Run(t, "PlatformFallback", testPlatformFallback, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testPlatformFallback(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server  *httptest.Server
+		repoRef string
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		repoRef = u.Host + "/some/base:latest"
+
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile = configFile.DeepCopy()
+		configFile.OS, configFile.Architecture = "linux", "arm64"
+		configFile.Config.Labels = map[string]string{"some-key": "arm64"}
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+			Add:        image,
+			Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "arm64"}},
+		})
+		ref, err := name.ParseReference(repoRef)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.WriteIndex(ref, index))
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	armV8 := imgutil.Platform{OS: "linux", Architecture: "arm", Variant: "v8"}
+
+	it("selects the image for a fallback platform", func() {
+		img, err := remote.NewImage("some-image", authn.DefaultKeychain,
+			remote.FromBaseImage(repoRef),
+			remote.WithDefaultPlatform(armV8),
+			remote.WithPlatformFallback(imgutil.DefaultPlatformFallback),
+		)
+		h.AssertNil(t, err)
+		label, err := img.Label("some-key")
+		h.AssertNil(t, err)
+		h.AssertEq(t, label, "arm64")
+	})
+
+	it("does not find the image without a fallback policy", func() {
+		img, err := remote.NewImage("some-image", authn.DefaultKeychain,
+			remote.FromBaseImage(repoRef),
+			remote.WithDefaultPlatform(armV8),
+		)
+		h.AssertNil(t, err)
+		label, err := img.Label("some-key")
+		h.AssertNil(t, err)
+		h.AssertEq(t, label, "")
+	})
+}
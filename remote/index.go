@@ -1,7 +1,9 @@
 package remote
 
 import (
-	"github.com/google/go-containerregistry/pkg/authn"
+	"fmt"
+	"net/http"
+
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
@@ -10,6 +12,8 @@ import (
 )
 
 // NewIndex returns a new ImageIndex from the registry that can be modified and saved to the local file system.
+// If repoName is a digest reference (repo@sha256:...) and no base index is provided, the index with that digest is loaded,
+// so that it can be edited and pushed under a new tag with imgutil.WithTags; it cannot be pushed to its digest reference.
 func NewIndex(repoName string, ops ...imgutil.IndexOption) (*imgutil.CNBIndex, error) {
 	options := &imgutil.IndexOptions{}
 	for _, op := range ops {
@@ -17,14 +21,21 @@ func NewIndex(repoName string, ops ...imgutil.IndexOption) (*imgutil.CNBIndex, e
 			return nil, err
 		}
 	}
+	if options.BaseIndex == nil && options.BaseIndexRepoName == "" {
+		if ref, err := name.ParseReference(repoName, name.WeakValidation); err == nil {
+			if _, isDigest := ref.(name.Digest); isDigest {
+				options.BaseIndexRepoName = repoName
+			}
+		}
+	}
 
 	var err error
 
 	if options.BaseIndex == nil && options.BaseIndexRepoName != "" { // options.BaseIndex supersedes options.BaseIndexRepoName
 		options.BaseIndex, err = newV1Index(
 			options.BaseIndexRepoName,
-			options.Keychain,
-			options.Insecure,
+			options.RemoteIndexOptions,
+			options.Logger,
 		)
 		if err != nil {
 			return nil, err
@@ -34,18 +45,72 @@ func NewIndex(repoName string, ops ...imgutil.IndexOption) (*imgutil.CNBIndex, e
 	return imgutil.NewCNBIndex(repoName, *options)
 }
 
-func newV1Index(repoName string, keychain authn.Keychain, insecure bool) (v1.ImageIndex, error) {
+func newV1Index(repoName string, options imgutil.RemoteIndexOptions, logger imgutil.Logger) (v1.ImageIndex, error) {
+	prefix, reg := imgutil.LookupRegistrySetting(repoName, options.RegistrySettings)
+	if reg.Blocked {
+		return nil, imgutil.ErrBlockedRegistry{RepoName: repoName}
+	}
 	ref, err := name.ParseReference(repoName, name.WeakValidation)
 	if err != nil {
 		return nil, err
 	}
+	var desc *remote.Descriptor
+	for _, mirrorRepoName := range reg.MirrorRepoNames(repoName, prefix) {
+		imgutil.Debugf(logger, "fetching index %s from mirror %s", ref.Name(), mirrorRepoName)
+		if desc, err = indexFromMirror(ref, mirrorRepoName, options, logger); err == nil {
+			break
+		}
+		imgutil.Debugf(logger, "skipping mirror %s: %s", mirrorRepoName, err)
+	}
+	if desc == nil {
+		imgutil.Debugf(logger, "fetching index %s from %s", ref.Name(), ref.Context().RegistryStr())
+		desc, err = remote.Get(
+			ref,
+			remote.WithAuthFromKeychain(options.Keychain),
+			remote.WithTransport(getIndexReadTransport(reg, options, logger)),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.Verifier != nil {
+		if err = options.Verifier(desc.Descriptor); err != nil {
+			return nil, imgutil.ErrVerificationFailed{Name: repoName, Digest: desc.Digest, Err: err}
+		}
+	}
+	return desc.ImageIndex()
+}
+
+// indexFromMirror returns the descriptor of the index served by the mirror,
+// which must have the digest of `ref` if it is a digest reference.
+func indexFromMirror(ref name.Reference, mirrorRepoName string, options imgutil.RemoteIndexOptions, logger imgutil.Logger) (*remote.Descriptor, error) {
+	_, reg := imgutil.LookupRegistrySetting(mirrorRepoName, options.RegistrySettings)
+	if reg.Blocked {
+		return nil, imgutil.ErrBlockedRegistry{RepoName: mirrorRepoName}
+	}
+	mirrorRef, err := name.ParseReference(mirrorRepoName, name.WeakValidation)
+	if err != nil {
+		return nil, err
+	}
 	desc, err := remote.Get(
-		ref,
-		remote.WithAuthFromKeychain(keychain),
-		remote.WithTransport(imgutil.GetTransport(insecure)),
+		mirrorRef,
+		remote.WithAuthFromKeychain(options.Keychain),
+		remote.WithTransport(getIndexReadTransport(reg, options, logger)),
 	)
 	if err != nil {
 		return nil, err
 	}
-	return desc.ImageIndex()
+	if canonical, ok := ref.(name.Digest); ok && desc.Digest.String() != canonical.DigestStr() {
+		return nil, fmt.Errorf("mirror %q returned digest %s for %q; expected %s", mirrorRepoName, desc.Digest, ref.Name(), canonical.DigestStr())
+	}
+	return desc, nil
+}
+
+// getIndexReadTransport returns the read transport of remote images for the registry of an index,
+// configured with the remote options given with WithIndexRemoteOptions and the cache given with WithIndexManifestCache.
+func getIndexReadTransport(reg imgutil.RegistrySetting, options imgutil.RemoteIndexOptions, logger imgutil.Logger) http.RoundTripper {
+	reg.Insecure = options.Insecure || reg.Insecure
+	remoteOptions := options.RemoteOptions
+	remoteOptions.ManifestCache = options.ManifestCache
+	return getReadTransport(reg, remoteOptions, logger)
 }
@@ -0,0 +1,99 @@
+package remote_test
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestIndexDigest(t *testing.T) {
+	spec.Run(t, "IndexDigest", testIndexDigest, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testIndexDigest(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server    *httptest.Server
+		host      string
+		xdgPath   string
+		digestRef name.Digest
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+		xdgPath, err = os.MkdirTemp("", "index-digest-test")
+		h.AssertNil(t, err)
+
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: image})
+		ref, err := name.ParseReference(host + "/digest/index:v1")
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.WriteIndex(ref, index))
+		digest, err := index.Digest()
+		h.AssertNil(t, err)
+		digestRef = ref.Context().Digest(digest.String())
+	})
+
+	it.After(func() {
+		server.Close()
+		h.AssertNil(t, os.RemoveAll(xdgPath))
+	})
+
+	newIndex := func() *imgutil.CNBIndex {
+		index, err := remote.NewIndex(digestRef.String(), imgutil.WithKeychain(authn.DefaultKeychain), imgutil.WithXDGRuntimePath(xdgPath))
+		h.AssertNil(t, err)
+		return index
+	}
+
+	it("loads the index with the digest", func() {
+		index := newIndex()
+		digest, err := index.Digest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, digest.String(), digestRef.DigestStr())
+	})
+
+	it("pushes the edited index to the given tags only", func() {
+		index := newIndex()
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(digestRef.Context().Tag("other"), image))
+		index.AddManifest(image)
+
+		h.AssertNil(t, index.Push(imgutil.WithTags("v2")))
+
+		pushed, err := ggcrremote.Index(digestRef.Context().Tag("v2"))
+		h.AssertNil(t, err)
+		manifest, err := pushed.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(manifest.Manifests), 2)
+		original, err := ggcrremote.Index(digestRef.Context().Tag("v1"))
+		h.AssertNil(t, err)
+		manifest, err = original.IndexManifest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(manifest.Manifests), 1)
+	})
+
+	it("does not push to the digest reference", func() {
+		index := newIndex()
+		h.AssertEq(t, errors.Is(index.Push(), imgutil.ErrPushToDigestReference), true)
+	})
+}
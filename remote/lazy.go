@@ -0,0 +1,432 @@
+package remote
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/containerd/stargz-snapshotter/estargz"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// lazyChunkSize is the size of the range requests made to read the layers of lazy images sequentially.
+const lazyChunkSize = 1 << 20
+
+// errRangesUnsupported is returned when the registry answers a range request with the whole blob.
+var errRangesUnsupported = errors.New("the registry does not support range requests")
+
+// lazyImage is a remote image whose layers are read with HTTP range requests as their contents are consumed,
+// so that a reader that stops early, such as ReadFile finding a file, does not download the rest of the layer.
+// The layers of eStargz images can also be listed from their table of contents, and single files read from them.
+type lazyImage struct {
+	v1.Image
+	blobs *blobClient
+}
+
+func newLazyImage(image v1.Image, ref name.Reference, auth authn.Authenticator, reg imgutil.RegistrySetting, options imgutil.RemoteOptions, logger imgutil.Logger) v1.Image {
+	return &lazyImage{Image: image, blobs: &blobClient{ref: ref, auth: auth, reg: reg, options: options, logger: logger}}
+}
+
+// recordLayerOrigins records the repository the image was read from as the origin of its layers,
+// so that they are mounted from there when the image is saved to another repository on the same registry,
+// even if they are not remote.MountableLayer anymore, e.g. because they are lazy or were wrapped,
+// or are mountable from another registry, e.g. because the image was read from a mirror.
+func recordLayerOrigins(origins map[v1.Hash]name.Reference, image v1.Image, repoName string, reg imgutil.RegistrySetting) error {
+	if image == nil {
+		return nil
+	}
+	var origin name.Reference
+	if lazy, ok := image.(*lazyImage); ok {
+		origin = lazy.blobs.ref
+	} else {
+		opts := []name.Option{name.WeakValidation}
+		if reg.Insecure {
+			opts = append(opts, name.Insecure)
+		}
+		var err error
+		if origin, err = name.ParseReference(repoName, opts...); err != nil {
+			return nil // the layers are then uploaded as usual
+		}
+	}
+	configFile, err := image.ConfigFile()
+	if err != nil {
+		return err
+	}
+	for _, diffID := range configFile.RootFS.DiffIDs {
+		origins[diffID] = origin
+	}
+	return nil
+}
+
+func (i *lazyImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for idx, layer := range layers {
+		if layers[idx], err = i.lazy(layer); err != nil {
+			return nil, err
+		}
+	}
+	return layers, nil
+}
+
+func (i *lazyImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.lazy(layer)
+}
+
+func (i *lazyImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	layer, err := i.Image.LayerByDiffID(h)
+	if err != nil {
+		return nil, err
+	}
+	return i.lazy(layer)
+}
+
+func (i *lazyImage) lazy(layer v1.Layer) (v1.Layer, error) {
+	desc, err := partial.Descriptor(layer)
+	if err != nil {
+		return nil, err
+	}
+	if len(desc.URLs) > 0 {
+		return layer, nil // foreign layers are not stored in the registry
+	}
+	lazy := &lazyLayer{Layer: layer, desc: *desc, blob: &blobSource{client: i.blobs, digest: desc.Digest, size: desc.Size}}
+	if _, ok := desc.Annotations[imgutil.EStargzTOCDigestAnnotation]; ok {
+		return &lazyEStargzLayer{lazyLayer: lazy}, nil
+	}
+	return lazy, nil
+}
+
+// lazyLayer is a layer of a lazy image. Its digest, diff ID, size and media type are those of the remote layer.
+type lazyLayer struct {
+	v1.Layer
+	desc v1.Descriptor
+	blob *blobSource
+}
+
+func (l *lazyLayer) Descriptor() (*v1.Descriptor, error) {
+	return &l.desc, nil
+}
+
+// Compressed reads the blob in chunks, verifying its digest once it is read in full.
+// If the registry does not support range requests, the blob is streamed from the remote layer instead.
+func (l *lazyLayer) Compressed() (io.ReadCloser, error) {
+	return &chunkReader{blob: l.blob, remote: l.Layer, hash: sha256.New()}, nil
+}
+
+func (l *lazyLayer) Uncompressed() (io.ReadCloser, error) {
+	layer, err := partial.CompressedToLayer(&lazyBlob{l})
+	if err != nil {
+		return nil, err
+	}
+	return layer.Uncompressed()
+}
+
+// lazyBlob is the compressed contents of a lazy layer, from which its uncompressed contents are read.
+type lazyBlob struct {
+	layer *lazyLayer
+}
+
+func (b *lazyBlob) Compressed() (io.ReadCloser, error) {
+	return b.layer.Compressed()
+}
+
+func (b *lazyBlob) Digest() (v1.Hash, error) {
+	return b.layer.desc.Digest, nil
+}
+
+func (b *lazyBlob) Size() (int64, error) {
+	return b.layer.desc.Size, nil
+}
+
+func (b *lazyBlob) MediaType() (types.MediaType, error) {
+	return b.layer.desc.MediaType, nil
+}
+
+// chunkReader reads a blob sequentially with range requests of lazyChunkSize bytes.
+type chunkReader struct {
+	blob   *blobSource
+	remote v1.Layer
+	hash   hash.Hash
+	offset int64
+	chunk  []byte
+	buf    []byte
+	stream io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if r.stream == nil && r.offset == 0 && r.blob.rangesUnsupported.Load() {
+		var err error
+		if r.stream, err = r.remote.Compressed(); err != nil {
+			return 0, err
+		}
+	}
+	if r.stream != nil {
+		return r.stream.Read(p)
+	}
+	if len(r.buf) == 0 {
+		if r.offset >= r.blob.size {
+			if actual := fmt.Sprintf("sha256:%x", r.hash.Sum(nil)); actual != r.blob.digest.String() {
+				return 0, fmt.Errorf("error verifying sha256 checksum after reading %d bytes; got %q, want %q", r.offset, actual, r.blob.digest)
+			}
+			return 0, io.EOF
+		}
+		if r.chunk == nil {
+			r.chunk = make([]byte, lazyChunkSize)
+		}
+		chunk := r.chunk[:min(int64(lazyChunkSize), r.blob.size-r.offset)]
+		n, err := r.blob.ReadAt(chunk, r.offset)
+		if errors.Is(err, errRangesUnsupported) && r.offset == 0 {
+			if r.stream, err = r.remote.Compressed(); err != nil {
+				return 0, err
+			}
+			return r.stream.Read(p)
+		}
+		if n < len(chunk) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		r.hash.Write(chunk)
+		r.offset += int64(n)
+		r.buf = chunk
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	if r.stream != nil {
+		return r.stream.Close()
+	}
+	return nil
+}
+
+// lazyEStargzLayer is a lazy eStargz layer, whose entries are listed from its table of contents.
+type lazyEStargzLayer struct {
+	*lazyLayer
+}
+
+// ForEachEntry lists the entries of the layer from its table of contents, after verifying the digest of the table of contents
+// against the layer annotation. The contents of regular files are only read, by range requests, if fn reads them.
+// Whiteouts are reported as entries, as in the layer tar, but the table of contents itself is not.
+func (l *lazyEStargzLayer) ForEachEntry(fn func(hdr *tar.Header, contents io.Reader) error) error {
+	reader, err := estargz.Open(io.NewSectionReader(l.blob, 0, l.blob.size))
+	if err != nil {
+		// estargz does not wrap the errors of the reader
+		if l.blob.rangesUnsupported.Load() {
+			return imgutil.ErrUnsupported{Kind: "registry", Operation: "listing layer entries", Reason: err.Error()}
+		}
+		return fmt.Errorf("failed to open eStargz layer %s: %w", l.desc.Digest, err)
+	}
+	tocDigest, err := digest.Parse(l.desc.Annotations[imgutil.EStargzTOCDigestAnnotation])
+	if err != nil {
+		return err
+	}
+	if _, err = reader.VerifyTOC(tocDigest); err != nil {
+		return fmt.Errorf("failed to verify eStargz layer %s: %w", l.desc.Digest, err)
+	}
+
+	root, ok := reader.Lookup("")
+	if !ok {
+		return nil
+	}
+	var entries []*estargz.TOCEntry
+	var collect func(dir *estargz.TOCEntry)
+	collect = func(dir *estargz.TOCEntry) {
+		dir.ForeachChild(func(_ string, entry *estargz.TOCEntry) bool {
+			entries = append(entries, entry)
+			if entry.Type == "dir" {
+				collect(entry)
+			}
+			return true
+		})
+	}
+	collect(root)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	for _, entry := range entries {
+		hdr, err := tarHeader(entry)
+		if err != nil {
+			return err
+		}
+		var contents io.Reader = eofReader{}
+		if hdr.Typeflag == tar.TypeReg && hdr.Size > 0 {
+			name := entry.Name
+			contents = &lazyFile{open: func() (io.Reader, error) { return reader.OpenFile(name) }}
+		}
+		if err = fn(hdr, contents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tarHeader returns the tar header for an entry of the table of contents of an eStargz layer.
+func tarHeader(entry *estargz.TOCEntry) (*tar.Header, error) {
+	hdr := &tar.Header{
+		Name:     entry.Name,
+		Mode:     entry.Mode,
+		Uid:      entry.UID,
+		Gid:      entry.GID,
+		Uname:    entry.Uname,
+		Gname:    entry.Gname,
+		ModTime:  entry.ModTime(),
+		Devmajor: int64(entry.DevMajor),
+		Devminor: int64(entry.DevMinor),
+	}
+	for key, value := range entry.Xattrs {
+		if hdr.PAXRecords == nil {
+			hdr.PAXRecords = make(map[string]string)
+		}
+		hdr.PAXRecords["SCHILY.xattr."+key] = string(value)
+	}
+	switch entry.Type {
+	case "dir":
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case "reg":
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = entry.Size
+	case "symlink":
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = entry.LinkName
+	case "hardlink":
+		hdr.Typeflag = tar.TypeLink
+		hdr.Linkname = entry.LinkName
+	case "char":
+		hdr.Typeflag = tar.TypeChar
+	case "block":
+		hdr.Typeflag = tar.TypeBlock
+	case "fifo":
+		hdr.Typeflag = tar.TypeFifo
+	default:
+		return nil, fmt.Errorf("unsupported eStargz entry type %q for %s", entry.Type, path.Clean("/"+entry.Name))
+	}
+	return hdr, nil
+}
+
+// lazyFile opens the contents of a file when they are first read.
+type lazyFile struct {
+	open   func() (io.Reader, error)
+	reader io.Reader
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	if f.reader == nil {
+		reader, err := f.open()
+		if err != nil {
+			return 0, err
+		}
+		f.reader = reader
+	}
+	return f.reader.Read(p)
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
+
+// blobSource reads ranges of a blob of a lazy image.
+type blobSource struct {
+	client            *blobClient
+	digest            v1.Hash
+	size              int64
+	rangesUnsupported atomic.Bool
+}
+
+// ReadAt reads len(p) bytes of the blob at the given offset with a range request.
+// It returns errRangesUnsupported if the registry answers with the whole blob.
+func (b *blobSource) ReadAt(p []byte, off int64) (int, error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), b.size)
+	httpClient, err := b.client.get()
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	err = withRetry(b.client.options.RetryPolicy, func() error {
+		req, err := http.NewRequest(http.MethodGet, b.client.blobURL(b.digest), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			b.rangesUnsupported.Store(true)
+			return errRangesUnsupported
+		}
+		if err = transport.CheckError(resp, http.StatusPartialContent); err != nil {
+			return err
+		}
+		n, err = io.ReadFull(resp.Body, p[:end-off])
+		return err
+	})
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// blobClient makes the requests for the blobs of a lazy image, authenticated for pulling from its repository.
+type blobClient struct {
+	ref     name.Reference
+	auth    authn.Authenticator
+	reg     imgutil.RegistrySetting
+	options imgutil.RemoteOptions
+	logger  imgutil.Logger
+
+	once   sync.Once
+	client *http.Client
+	err    error
+}
+
+func (c *blobClient) get() (*http.Client, error) {
+	c.once.Do(func() {
+		var rt http.RoundTripper
+		rt, c.err = transport.NewWithContext(context.Background(), c.ref.Context().Registry, c.auth,
+			getTransport(c.reg, c.options, c.logger), []string{c.ref.Scope(transport.PullScope)})
+		c.client = &http.Client{Transport: rt}
+	})
+	return c.client, c.err
+}
+
+func (c *blobClient) blobURL(digest v1.Hash) string {
+	repo := c.ref.Context()
+	return fmt.Sprintf("%s://%s/v2/%s/blobs/%s", repo.Registry.Scheme(), repo.RegistryStr(), repo.RepositoryStr(), digest)
+}
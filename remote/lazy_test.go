@@ -0,0 +1,244 @@
+package remote_test
+
+import (
+	"archive/tar"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestLazyLayers(t *testing.T) {
+	spec.Run(t, "LazyLayers", testLazyLayers, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// rangeRegistry serves range requests for blobs, which the registry package does not support,
+// and records the bytes of blobs it serves and the repositories blobs are mounted from.
+type rangeRegistry struct {
+	handler     http.Handler
+	ranges      bool
+	blobBytes   atomic.Int64
+	mu          sync.Mutex
+	mountedFrom []string
+}
+
+var (
+	blobPath   = regexp.MustCompile(`^/v2/.+/blobs/sha256:[0-9a-f]{64}$`)
+	uploadPath = regexp.MustCompile(`^/v2/.+/blobs/uploads/$`)
+	rangeValue = regexp.MustCompile(`^bytes=(\d+)-(\d+)$`)
+)
+
+func (r *rangeRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	// as the registry stores blobs for all repositories together, blobs are reported missing from the app repository
+	if req.Method == http.MethodHead && strings.HasPrefix(req.URL.Path, "/v2/lazy/app/blobs/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if req.Method == http.MethodPost && uploadPath.MatchString(req.URL.Path) {
+		if from := req.URL.Query().Get("from"); from != "" {
+			// mounts from other registries are recorded with the registry they are requested from
+			if origin := req.URL.Query().Get("origin"); origin != "" && origin != req.Host {
+				from = origin + "/" + from
+			}
+			r.mu.Lock()
+			r.mountedFrom = append(r.mountedFrom, from)
+			r.mu.Unlock()
+		}
+	}
+	if req.Method != http.MethodGet || !blobPath.MatchString(req.URL.Path) {
+		r.handler.ServeHTTP(w, req)
+		return
+	}
+	rec := httptest.NewRecorder()
+	r.handler.ServeHTTP(rec, req)
+	body := rec.Body.Bytes()
+	match := rangeValue.FindStringSubmatch(req.Header.Get("Range"))
+	if rec.Code != http.StatusOK || !r.ranges || match == nil {
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.Code)
+		n, _ := w.Write(body)
+		r.blobBytes.Add(int64(n))
+		return
+	}
+	start, _ := strconv.Atoi(match[1])
+	end, _ := strconv.Atoi(match[2])
+	end = min(end, len(body)-1)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(body)))
+	w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+	w.WriteHeader(http.StatusPartialContent)
+	n, _ := w.Write(body[start : end+1])
+	r.blobBytes.Add(int64(n))
+}
+
+func testLazyLayers(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server   *httptest.Server
+		reg      *rangeRegistry
+		host     string
+		tmpDir   string
+		baseName string
+	)
+
+	it.Before(func() {
+		reg = &rangeRegistry{handler: registry.New(), ranges: true}
+		server = httptest.NewServer(reg)
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+		baseName = host + "/lazy/base"
+		tmpDir, err = os.MkdirTemp("", "lazy-layers")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		server.Close()
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	// saveBase saves a base image with a layer holding a large incompressible file followed by a small one.
+	saveBase := func(ops ...imgutil.ImageOption) int64 {
+		layerPath := filepath.Join(tmpDir, "layer.tar")
+		f, err := os.Create(layerPath)
+		h.AssertNil(t, err)
+		tw := tar.NewWriter(f)
+		big := make([]byte, 4<<20)
+		_, err = rand.Read(big)
+		h.AssertNil(t, err)
+		for _, file := range []struct {
+			name     string
+			contents []byte
+		}{{"big", big}, {"small", []byte("small contents")}} {
+			h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0644, Size: int64(len(file.contents)), Typeflag: tar.TypeReg}))
+			_, err = tw.Write(file.contents)
+			h.AssertNil(t, err)
+		}
+		h.AssertNil(t, tw.Close())
+		h.AssertNil(t, f.Close())
+
+		base, err := remote.NewImage(baseName, authn.DefaultKeychain, ops...)
+		h.AssertNil(t, err)
+		h.AssertNil(t, base.AddLayer(layerPath))
+		h.AssertNil(t, base.Save())
+		layers, err := base.UnderlyingImage().Layers()
+		h.AssertNil(t, err)
+		size, err := layers[0].Size()
+		h.AssertNil(t, err)
+		reg.blobBytes.Store(0)
+		return size
+	}
+
+	newLazyImage := func() *remote.Image {
+		image, err := remote.NewImage(host+"/lazy/app", authn.DefaultKeychain, remote.FromBaseImage(baseName), remote.WithLazyLayers())
+		h.AssertNil(t, err)
+		return image
+	}
+
+	when("#GetLayer", func() {
+		it("only downloads the chunks that are read", func() {
+			layerSize := saveBase()
+			image := newLazyImage()
+			topLayer, err := image.TopLayer()
+			h.AssertNil(t, err)
+
+			rc, err := image.GetLayer(topLayer)
+			h.AssertNil(t, err)
+			tr := tar.NewReader(rc)
+			hdr, err := tr.Next()
+			h.AssertNil(t, err)
+			h.AssertEq(t, hdr.Name, "big")
+			h.AssertNil(t, rc.Close())
+			h.AssertEq(t, reg.blobBytes.Load() < layerSize/2, true)
+
+			rc, err = image.GetLayer(topLayer)
+			h.AssertNil(t, err)
+			_, err = io.Copy(io.Discard, rc)
+			h.AssertNil(t, err)
+			h.AssertNil(t, rc.Close())
+		})
+
+		when("the registry does not support range requests", func() {
+			it("reads the layers in full", func() {
+				saveBase()
+				reg.ranges = false
+				image := newLazyImage()
+
+				contents, err := image.ReadFile("/small")
+				h.AssertNil(t, err)
+				h.AssertEq(t, string(contents), "small contents")
+			})
+		})
+	})
+
+	when("#ReadFile", func() {
+		it("reads a file of an eStargz layer without downloading the others", func() {
+			layerSize := saveBase(remote.WithLayerCompression(imgutil.EStargz))
+			image := newLazyImage()
+
+			contents, err := image.ReadFile("/small")
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(contents), "small contents")
+			h.AssertEq(t, reg.blobBytes.Load() < layerSize/2, true)
+
+			contents, err = image.ReadFile("/big")
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(contents), 4<<20)
+		})
+	})
+
+	when("#Save", func() {
+		it("mounts the base image layers instead of uploading them", func() {
+			saveBase()
+			image := newLazyImage()
+			h.AssertNil(t, image.Save())
+			h.AssertEq(t, reg.mountedFrom, []string{"lazy/base"})
+		})
+
+		it("mounts the layers of a base image read from a mirror from the base repository", func() {
+			saveBase()
+			baseRef, err := name.ParseReference(baseName)
+			h.AssertNil(t, err)
+			base, err := ggcrremote.Image(baseRef)
+			h.AssertNil(t, err)
+			digest, err := base.Digest()
+			h.AssertNil(t, err)
+			mirror, _ := flakyRegistry(0)
+			defer mirror.Close()
+			u, err := url.Parse(mirror.URL)
+			h.AssertNil(t, err)
+			mirrorRef, err := name.ParseReference(u.Host + "/lazy/base")
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(mirrorRef, base))
+
+			image, err := remote.NewImage(host+"/lazy/app", authn.DefaultKeychain,
+				remote.FromBaseImage(baseName+"@"+digest.String()),
+				remote.WithMirrors([]string{u.Host}),
+			)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.Save())
+			h.AssertEq(t, reg.mountedFrom, []string{"lazy/base"})
+		})
+	})
+}
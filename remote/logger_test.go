@@ -0,0 +1,76 @@
+package remote_test
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestLogger(t *testing.T) {
+	spec.Run(t, "Logger", testLogger, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Debugf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func (l *recordingLogger) contains(substring string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, message := range l.messages {
+		if strings.Contains(message, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+func testLogger(t *testing.T, when spec.G, it spec.S) {
+	when("#WithLogger", func() {
+		it("reports retries and the layers pushed", func() {
+			server, _ := flakyRegistry(2)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			repoName := u.Host + "/logger/image"
+
+			logger := &recordingLogger{}
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain,
+				imgutil.WithLogger(logger),
+				remote.WithRetryPolicy(3, time.Millisecond),
+			)
+			h.AssertNil(t, err)
+			layer, err := random.Layer(1024, types.OCILayer)
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.AddLayerWithHistory(layer, v1.History{}))
+			h.AssertNil(t, img.Save())
+
+			digest, err := layer.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, logger.contains("attempt 1 of 3 failed, retrying"), true)
+			h.AssertEq(t, logger.contains("pushing "+repoName), true)
+			h.AssertEq(t, logger.contains("pushing layer "+digest.String()), true)
+		})
+	})
+}
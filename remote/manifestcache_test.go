@@ -0,0 +1,189 @@
+package remote_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestManifestCache(t *testing.T) {
+	spec.Run(t, "ManifestCache", testManifestCache, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// countingRegistry returns a registry that counts the GET requests for manifests and blobs.
+func countingRegistry() (*httptest.Server, func() (manifests, blobs int)) {
+	var (
+		mu                        sync.Mutex
+		manifestCount, blobsCount int
+	)
+	reg := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			switch {
+			case strings.Contains(r.URL.Path, "/manifests/"):
+				manifestCount++
+			case strings.Contains(r.URL.Path, "/blobs/"):
+				blobsCount++
+			}
+			mu.Unlock()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	return server, func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return manifestCount, blobsCount
+	}
+}
+
+func testManifestCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		cacheDir string
+		repoName string
+		requests func() (int, int)
+	)
+
+	it.Before(func() {
+		var err error
+		cacheDir, err = os.MkdirTemp("", "manifest-cache-test")
+		h.AssertNil(t, err)
+		var server *httptest.Server
+		server, requests = countingRegistry()
+		it.After(server.Close)
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		repoName = u.Host + "/manifest-cache/image"
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(cacheDir))
+	})
+
+	when("#WithManifestCache", func() {
+		it.Before(func() {
+			pushRandomImage(t, repoName)
+		})
+
+		it("reads the base image manifest and config from the cache", func() {
+			cache, err := imgutil.NewManifestCache(cacheDir, time.Hour)
+			h.AssertNil(t, err)
+
+			first, err := remote.NewImage("some/image", authn.DefaultKeychain, remote.FromBaseImage(repoName), remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+			manifests, blobs := requests()
+			h.AssertEq(t, manifests > 0, true)
+			h.AssertEq(t, blobs > 0, true)
+
+			// a new cache reads the entries stored in the directory
+			cache, err = imgutil.NewManifestCache(cacheDir, time.Hour)
+			h.AssertNil(t, err)
+			second, err := remote.NewImage("some/image", authn.DefaultKeychain, remote.FromBaseImage(repoName), remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+			h.AssertEq(t, second.UnderlyingImage() != nil, true)
+			afterManifests, afterBlobs := requests()
+			h.AssertEq(t, afterManifests, manifests)
+			h.AssertEq(t, afterBlobs, blobs)
+
+			firstDigest, err := first.Digest()
+			h.AssertNil(t, err)
+			secondDigest, err := second.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, secondDigest, firstDigest)
+		})
+
+		it("fetches the tag again once its TTL has passed", func() {
+			cache, err := imgutil.NewManifestCache(cacheDir, time.Nanosecond)
+			h.AssertNil(t, err)
+
+			_, err = remote.NewImage("some/image", authn.DefaultKeychain, remote.FromBaseImage(repoName), remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+			manifests, _ := requests()
+			_, err = remote.NewImage("some/image", authn.DefaultKeychain, remote.FromBaseImage(repoName), remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+			afterManifests, _ := requests()
+			h.AssertEq(t, afterManifests, manifests+1)
+		})
+
+		it("fetches the tag again once it is pushed", func() {
+			cache, err := imgutil.NewManifestCache(cacheDir, time.Hour)
+			h.AssertNil(t, err)
+			_, err = remote.NewImage("some/image", authn.DefaultKeychain, remote.FromBaseImage(repoName), remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+
+			pushed, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+			h.AssertNil(t, pushed.SetLabel("some-label", "some-value"))
+			h.AssertNil(t, pushed.Save())
+
+			rebuilt, err := remote.NewImage("some/image", authn.DefaultKeychain, remote.FromBaseImage(repoName), remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+			label, err := rebuilt.Label("some-label")
+			h.AssertNil(t, err)
+			h.AssertEq(t, label, "some-value")
+		})
+
+		it("does not push through the cache", func() {
+			cache, err := imgutil.NewManifestCache(cacheDir, time.Hour)
+			h.AssertNil(t, err)
+			saved, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.FromBaseImage(repoName))
+			h.AssertNil(t, err)
+			h.AssertNil(t, saved.Save())
+			image, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.FromBaseImage(repoName), remote.WithManifestCache(cache))
+			h.AssertNil(t, err)
+
+			// the tag is moved to another image, while the cache still has the digest of the image to save
+			pushRandomImage(t, repoName)
+			h.AssertNil(t, image.Save())
+
+			digest, err := image.Digest()
+			h.AssertNil(t, err)
+			ref, err := name.ParseReference(repoName)
+			h.AssertNil(t, err)
+			desc, err := ggcrremote.Head(ref)
+			h.AssertNil(t, err)
+			h.AssertEq(t, desc.Digest, digest)
+		})
+	})
+
+	when("#WithIndexManifestCache", func() {
+		it("reads the base index manifest from the cache", func() {
+			index, err := random.Index(1024, 1, 2)
+			h.AssertNil(t, err)
+			ref, err := name.ParseReference(repoName)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.WriteIndex(ref, index))
+			cache, err := imgutil.NewManifestCache(cacheDir, time.Hour)
+			h.AssertNil(t, err)
+
+			_, err = remote.NewIndex("some/index", imgutil.FromBaseIndex(repoName), remote.WithIndexManifestCache(cache))
+			h.AssertNil(t, err)
+			manifests, _ := requests()
+			loaded, err := remote.NewIndex("some/index", imgutil.FromBaseIndex(repoName), remote.WithIndexManifestCache(cache))
+			h.AssertNil(t, err)
+			afterManifests, _ := requests()
+			h.AssertEq(t, afterManifests, manifests)
+
+			indexManifest, err := loaded.IndexManifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(indexManifest.Manifests), 2)
+		})
+	})
+}
@@ -0,0 +1,89 @@
+package remote_test
+
+import (
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestMetrics(t *testing.T) {
+	spec.Run(t, "Metrics", testMetrics, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+type recordingHook struct {
+	mu      sync.Mutex
+	started []imgutil.Operation
+	ended   []imgutil.OperationResult
+}
+
+func (r *recordingHook) OnOperationStart(op imgutil.Operation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.started = append(r.started, op)
+}
+
+func (r *recordingHook) OnOperationEnd(_ imgutil.Operation, result imgutil.OperationResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ended = append(r.ended, result)
+}
+
+func testMetrics(t *testing.T, when spec.G, it spec.S) {
+	var host string
+
+	it.Before(func() {
+		server, _ := flakyRegistry(0)
+		it.After(server.Close)
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+	})
+
+	when("#WithMetricsHook", func() {
+		it("reports the pull of the base image and the push of each name", func() {
+			baseName := host + "/metrics/base"
+			pushRandomImage(t, baseName)
+			hook := &recordingHook{}
+
+			img, err := remote.NewImage(host+"/metrics/app", authn.DefaultKeychain,
+				remote.FromBaseImage(baseName),
+				imgutil.WithMetricsHook(hook),
+			)
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.Save(host+"/metrics/app:other"))
+
+			h.AssertEq(t, hook.started, []imgutil.Operation{
+				{Name: imgutil.OperationPull, Ref: baseName},
+				{Name: imgutil.OperationPush, Ref: host + "/metrics/app"},
+				{Name: imgutil.OperationPush, Ref: host + "/metrics/app:other"},
+			})
+			h.AssertEq(t, len(hook.ended), 3)
+			size, err := img.TotalSize()
+			h.AssertNil(t, err)
+			for _, result := range hook.ended {
+				h.AssertNil(t, result.Err)
+				h.AssertEq(t, result.Duration > 0, true)
+			}
+			h.AssertEq(t, hook.ended[1].Bytes, size)
+		})
+
+		it("reports failed operations with their error", func() {
+			hook := &recordingHook{}
+			img, err := remote.NewImage("localhost:1/metrics/app", authn.DefaultKeychain, imgutil.WithMetricsHook(hook))
+			h.AssertNil(t, err)
+			h.AssertNotNil(t, img.Save())
+
+			h.AssertEq(t, len(hook.ended), 1)
+			h.AssertNotNil(t, hook.ended[0].Err)
+			h.AssertEq(t, hook.ended[0].Bytes, int64(0))
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// mirrorReference returns the reference to the same repository and identifier as `ref`, served by `mirror`.
+// The mirror may include a path prefix, e.g. `mirror.example.com/docker-hub`.
+func mirrorReference(ref name.Reference, mirror string) string {
+	repository := strings.TrimSuffix(mirror, "/") + "/" + ref.Context().RepositoryStr()
+	if digest, ok := ref.(name.Digest); ok {
+		return repository + "@" + digest.DigestStr()
+	}
+	return repository + ":" + ref.Identifier()
+}
+
+// MirrorError is returned when an image could be fetched neither from its registry nor from any of its mirrors.
+type MirrorError struct {
+	// Err is the error returned by the registry of the image.
+	Err error
+	// MirrorErrs are the errors returned by the mirrors, in the order they were tried.
+	MirrorErrs []error
+}
+
+func (e MirrorError) Error() string {
+	messages := make([]string, len(e.MirrorErrs))
+	for idx, err := range e.MirrorErrs {
+		messages[idx] = err.Error()
+	}
+	return fmt.Sprintf("%s; mirrors failed: %s", e.Err.Error(), strings.Join(messages, "; "))
+}
+
+func (e MirrorError) Unwrap() error {
+	return e.Err
+}
+
+// imageFromMirrors tries each configured mirror in order, followed by the mirrors of the registry of `ref`,
+// and returns the first image that could be fetched and verified. When the canonical digest is known (because `ref` is a digest reference), a mirror that returns
+// a manifest with a different digest is skipped, guarding against stale or poisoned mirrors.
+// If no mirror can provide the image, it returns nil with the error of each mirror,
+// and the caller should fall back to the canonical registry.
+func imageFromMirrors(ref name.Reference, keychain authn.Keychain, platform v1.Platform, withRemoteOptions imgutil.RemoteOptions, logger imgutil.Logger) (v1.Image, []error) {
+	var errs []error
+	for _, mirrorRepoName := range mirrorRepoNames(ref, withRemoteOptions) {
+		imgutil.Debugf(logger, "fetching %s for platform %s from mirror %s", ref.Name(), platform, mirrorRepoName)
+		image, err := imageFromMirror(ref, mirrorRepoName, keychain, platform, withRemoteOptions, logger)
+		if err == nil {
+			return image, nil
+		}
+		imgutil.Debugf(logger, "skipping mirror %s: %s", mirrorRepoName, err)
+		errs = append(errs, fmt.Errorf("mirror %s: %w", mirrorRepoName, err))
+	}
+	return nil, errs
+}
+
+// mirrorRepoNames returns the references to `ref` in the configured mirrors, followed by the mirrors of the registry of `ref`.
+func mirrorRepoNames(ref name.Reference, withRemoteOptions imgutil.RemoteOptions) []string {
+	var repoNames []string
+	for _, mirror := range withRemoteOptions.Mirrors {
+		repoNames = append(repoNames, mirrorReference(ref, mirror))
+	}
+	prefix, setting := imgutil.LookupRegistrySetting(ref.String(), withRemoteOptions.RegistrySettings)
+	return append(repoNames, setting.MirrorRepoNames(ref.String(), prefix)...)
+}
+
+func imageFromMirror(ref name.Reference, mirrorRepoName string, keychain authn.Keychain, platform v1.Platform, withRemoteOptions imgutil.RemoteOptions, logger imgutil.Logger) (v1.Image, error) {
+	reg := getRegistrySetting(mirrorRepoName, withRemoteOptions.RegistrySettings)
+	mirrorRef, auth, err := referenceForRepoName(keychain, mirrorRepoName, reg)
+	if err != nil {
+		return nil, err
+	}
+
+	var desc *remote.Descriptor
+	if err = withRetry(withRemoteOptions.RetryPolicy, func() error {
+		desc, err = remote.Get(mirrorRef, retryOptions(withRemoteOptions.RetryPolicy,
+			remote.WithAuth(auth),
+			remote.WithPlatform(platform),
+			remote.WithTransport(getReadTransport(reg, withRemoteOptions, logger)),
+		)...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if canonical, ok := ref.(name.Digest); ok && desc.Digest.String() != canonical.DigestStr() {
+		return nil, fmt.Errorf("mirror %q returned digest %s for %q; expected %s", mirrorRepoName, desc.Digest, ref.Name(), canonical.DigestStr())
+	}
+	return desc.Image()
+}
@@ -0,0 +1,122 @@
+package remote_test
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestMirror(t *testing.T) {
+	spec.Run(t, "Mirror", testMirror, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func pushRandomImage(t *testing.T, repoName string) v1.Image {
+	img, err := random.Image(1024, 1)
+	h.AssertNil(t, err)
+	ref, err := name.ParseReference(repoName)
+	h.AssertNil(t, err)
+	h.AssertNil(t, ggcrremote.Write(ref, img))
+	return img
+}
+
+func testMirror(t *testing.T, when spec.G, it spec.S) {
+	var upstreamHost, mirrorHost string
+
+	it.Before(func() {
+		upstream, _ := flakyRegistry(0)
+		mirror, _ := flakyRegistry(0)
+		it.After(upstream.Close)
+		it.After(mirror.Close)
+		u, err := url.Parse(upstream.URL)
+		h.AssertNil(t, err)
+		upstreamHost = u.Host
+		u, err = url.Parse(mirror.URL)
+		h.AssertNil(t, err)
+		mirrorHost = u.Host
+	})
+
+	when("the base image is referenced by digest", func() {
+		it("uses the mirror when it serves the expected digest", func() {
+			img := pushRandomImage(t, mirrorHost+"/some/base:latest")
+			digest, err := img.Digest()
+			h.AssertNil(t, err)
+
+			baseImage, err := remote.NewV1Image(upstreamHost+"/some/base@"+digest.String(), authn.DefaultKeychain, remote.WithMirrors([]string{mirrorHost}))
+			h.AssertNil(t, err)
+
+			actual, err := baseImage.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, digest)
+		})
+
+		it("falls back to the canonical registry when the mirror serves a different digest", func() {
+			expected := pushRandomImage(t, upstreamHost+"/some/base:latest")
+			digest, err := expected.Digest()
+			h.AssertNil(t, err)
+			pushRandomImage(t, mirrorHost+"/some/base:latest")
+
+			baseImage, err := remote.NewV1Image(upstreamHost+"/some/base@"+digest.String(), authn.DefaultKeychain, remote.WithMirrors([]string{mirrorHost}))
+			h.AssertNil(t, err)
+
+			actual, err := baseImage.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, digest)
+		})
+	})
+	when("the base image is referenced by tag", func() {
+		it("tries the mirrors in order", func() {
+			emptyMirror, _ := flakyRegistry(0)
+			defer emptyMirror.Close()
+			u, err := url.Parse(emptyMirror.URL)
+			h.AssertNil(t, err)
+			img := pushRandomImage(t, mirrorHost+"/some/base:latest")
+			digest, err := img.Digest()
+			h.AssertNil(t, err)
+
+			baseImage, err := remote.NewV1Image(upstreamHost+"/some/base:latest", authn.DefaultKeychain,
+				remote.WithMirrors([]string{u.Host, mirrorHost}),
+				remote.WithRegistrySetting(mirrorHost, true),
+			)
+			h.AssertNil(t, err)
+
+			actual, err := baseImage.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, digest)
+		})
+	})
+
+	when("every source fails", func() {
+		it("reports the error of each mirror", func() {
+			failing, _ := flakyRegistry(1000)
+			defer failing.Close()
+			failingMirror, _ := flakyRegistry(1000)
+			defer failingMirror.Close()
+			u, err := url.Parse(failing.URL)
+			h.AssertNil(t, err)
+			m, err := url.Parse(failingMirror.URL)
+			h.AssertNil(t, err)
+
+			_, err = remote.NewV1Image(u.Host+"/some/base:latest", authn.DefaultKeychain,
+				remote.WithMirrors([]string{m.Host}),
+				remote.WithRetryPolicy(1, time.Millisecond),
+			)
+			var mirrorErr remote.MirrorError
+			h.AssertEq(t, errors.As(err, &mirrorErr), true)
+			h.AssertEq(t, len(mirrorErr.MirrorErrs), 1)
+			h.AssertError(t, err, "connect to repo store")
+			h.AssertError(t, err, "mirror "+m.Host+"/some/base:latest")
+		})
+	})
+}
@@ -1,11 +1,9 @@
 package remote
 
 import (
-	"io"
 	"net/http"
 	"runtime"
 	"strings"
-	"time"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
@@ -25,19 +23,65 @@ func NewImage(repoName string, keychain authn.Keychain, ops ...imgutil.ImageOpti
 	for _, op := range ops {
 		op(options)
 	}
+	if err := options.Err(); err != nil {
+		return nil, err
+	}
 
 	options.Platform = processPlatformOption(options.Platform)
 
-	var err error
-	options.PreviousImage, err = processImageOption(options.PreviousImageRepoName, keychain, options.Platform, options.RegistrySettings)
+	err := imgutil.ResolveAliases(options)
 	if err != nil {
 		return nil, err
 	}
+	if err = applyRegistriesConfig(&options.RemoteOptions); err != nil {
+		return nil, err
+	}
+	if getRegistrySetting(repoName, options.RegistrySettings).Blocked {
+		return nil, imgutil.ErrBlockedRegistry{RepoName: repoName}
+	}
+	if err = imgutil.CheckCapabilities(options, capabilities); err != nil {
+		return nil, err
+	}
 
-	options.BaseImage, err = processImageOption(options.BaseImageRepoName, keychain, options.Platform, options.RegistrySettings)
+	options.PreviousImage, err = pullImageOption(options.PreviousImageRepoName, keychain, options)
 	if err != nil {
 		return nil, err
 	}
+
+	var pinnedBaseImage *name.Digest
+	// a trusted or expected base image is read by the digest that is checked, so that moving its tag cannot swap it
+	checkBaseImage := options.TrustStore != nil || options.ExpectedDigest != (v1.Hash{}) || options.Verifier != nil
+	if (options.PinBaseImage || checkBaseImage) && options.BaseImageRepoName != "" {
+		if pinnedBaseImage, err = pinDigest(options.BaseImageRepoName, keychain, options.RemoteOptions, options.Logger); err != nil {
+			return nil, err
+		}
+		if pinnedBaseImage != nil {
+			options.BaseImageRepoName = pinnedBaseImage.String()
+		}
+	}
+
+	if err = verifyBaseImage(options.BaseImageRepoName, keychain, options.RemoteOptions, options.Logger); err != nil {
+		return nil, err
+	}
+	options.BaseImage, err = pullImageOption(options.BaseImageRepoName, keychain, options)
+	if err != nil {
+		return nil, err
+	}
+	if checkBaseImage {
+		if err = checkBaseImageDigests(options, pinnedBaseImage); err != nil {
+			return nil, err
+		}
+	}
+	layerOrigins := make(map[v1.Hash]name.Reference)
+	for _, source := range []struct {
+		repoName string
+		image    v1.Image
+	}{{options.PreviousImageRepoName, options.PreviousImage}, {options.BaseImageRepoName, options.BaseImage}} {
+		reg := getRegistrySetting(source.repoName, options.RegistrySettings)
+		if err = recordLayerOrigins(layerOrigins, source.image, source.repoName, reg); err != nil {
+			return nil, err
+		}
+	}
 	options.MediaTypes = imgutil.GetPreferredMediaTypes(*options)
 	if options.BaseImage != nil {
 		options.BaseImage, _, err = imgutil.EnsureMediaTypesAndLayers(options.BaseImage, options.MediaTypes, imgutil.PreserveLayers)
@@ -56,7 +100,17 @@ func NewImage(repoName string, keychain authn.Keychain, ops ...imgutil.ImageOpti
 		repoName:            repoName,
 		keychain:            keychain,
 		addEmptyLayerOnSave: options.AddEmptyLayerOnSave,
+		canonicalJSON:       options.CanonicalJSON,
 		registrySettings:    options.RegistrySettings,
+		retryPolicy:         options.RetryPolicy,
+		logger:              options.Logger,
+		metrics:             options.MetricsHook,
+		progressHandler:     options.ProgressHandler,
+		sbomsAsReferrers:    options.SBOMsAsReferrers,
+		validateBeforePush:  options.ValidateBeforePush,
+		remoteOptions:       options.RemoteOptions,
+		pinnedBaseImage:     pinnedBaseImage,
+		layerOrigins:        layerOrigins,
 	}, nil
 }
 
@@ -74,7 +128,26 @@ func processPlatformOption(requestedPlatform imgutil.Platform) imgutil.Platform
 	return defaultPlatform()
 }
 
-func processImageOption(repoName string, keychain authn.Keychain, withPlatform imgutil.Platform, withRegistrySettings map[string]imgutil.RegistrySetting) (v1.Image, error) {
+// pullImageOption fetches the image with processImageOption, reporting the pull to the metrics hook of the options
+// and the download of its layers to the progress handler of the options.
+func pullImageOption(repoName string, keychain authn.Keychain, options *imgutil.ImageOptions) (v1.Image, error) {
+	if repoName == "" {
+		return nil, nil
+	}
+	end := imgutil.StartOperation(options.MetricsHook, imgutil.OperationPull, repoName)
+	image, err := processImageOption(repoName, keychain, options.Platform, options.RemoteOptions, options.Logger)
+	var size int64
+	if err == nil {
+		size, _ = imgutil.ImageSize(image)
+	}
+	end(size, err)
+	if err != nil {
+		return nil, err
+	}
+	return imgutil.PulledImageWithProgress(image, options.ProgressHandler), nil
+}
+
+func processImageOption(repoName string, keychain authn.Keychain, withPlatform imgutil.Platform, withRemoteOptions imgutil.RemoteOptions, logger imgutil.Logger) (v1.Image, error) {
 	if repoName == "" {
 		return nil, nil
 	}
@@ -85,56 +158,120 @@ func processImageOption(repoName string, keychain authn.Keychain, withPlatform i
 		Variant:      withPlatform.Variant,
 		OSVersion:    withPlatform.OSVersion,
 	}
-	reg := getRegistrySetting(repoName, withRegistrySettings)
-	ref, auth, err := referenceForRepoName(keychain, repoName, reg.Insecure)
+	reg := getRegistrySetting(repoName, withRemoteOptions.RegistrySettings)
+	ref, auth, err := referenceForRepoName(keychain, repoName, reg)
 	if err != nil {
 		return nil, err
 	}
 
-	var image v1.Image
-	for i := 0; i <= maxRetries; i++ {
-		time.Sleep(100 * time.Duration(i) * time.Millisecond) // wait if retrying
-		image, err = remote.Image(ref,
-			remote.WithAuth(auth),
-			remote.WithPlatform(platform),
-			remote.WithTransport(imgutil.GetTransport(reg.Insecure)),
-		)
-		if err != nil {
-			if err == io.EOF && i != maxRetries {
-				continue // retry if EOF
-			}
-			if transportErr, ok := err.(*transport.Error); ok && len(transportErr.Errors) > 0 {
-				switch transportErr.StatusCode {
-				case http.StatusNotFound, http.StatusUnauthorized:
-					return emptyImage(withPlatform)
-				}
+	var mirrorErrs []error
+	fetch := func(platform v1.Platform) (v1.Image, error) {
+		image, errs := imageFromMirrors(ref, keychain, platform, withRemoteOptions, logger)
+		if image != nil {
+			return image, nil
+		}
+		mirrorErrs = append(mirrorErrs, errs...)
+		imgutil.Debugf(logger, "fetching %s for platform %s from %s", ref.Name(), platform, registryURL(ref))
+		err := withRetry(withRemoteOptions.RetryPolicy, func() error {
+			var err error
+			image, err = remote.Image(ref, retryOptions(withRemoteOptions.RetryPolicy,
+				remote.WithAuth(auth),
+				remote.WithPlatform(platform),
+				remote.WithTransport(getReadTransport(reg, withRemoteOptions, logger)),
+			)...)
+			return err
+		})
+		if err == nil && withRemoteOptions.LazyLayers {
+			image = newLazyImage(image, ref, auth, reg, withRemoteOptions, logger)
+		}
+		return image, err
+	}
+
+	image, err := fetch(platform)
+	if err != nil && isNoChildWithPlatform(err) && withRemoteOptions.PlatformFallback != nil {
+		for _, fallback := range withRemoteOptions.PlatformFallback(withPlatform) {
+			image, err = fetch(v1.Platform{
+				Architecture: fallback.Architecture,
+				OS:           fallback.OS,
+				Variant:      fallback.Variant,
+				OSVersion:    fallback.OSVersion,
+			})
+			if err == nil || !isNoChildWithPlatform(err) {
+				break
 			}
-			if strings.Contains(err.Error(), "no child with platform") {
+		}
+	}
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && len(transportErr.Errors) > 0 {
+			switch transportErr.StatusCode {
+			case http.StatusNotFound, http.StatusUnauthorized:
 				return emptyImage(withPlatform)
 			}
-			return nil, errors.Wrapf(err, "connect to repo store %q", repoName)
 		}
-		break
+		if isNoChildWithPlatform(err) {
+			return emptyImage(withPlatform)
+		}
+		err = errors.Wrapf(err, "connect to repo store %q", repoName)
+		if len(mirrorErrs) > 0 {
+			return nil, MirrorError{Err: err, MirrorErrs: mirrorErrs}
+		}
+		return nil, err
 	}
 	return image, nil
 }
 
+// isNoChildWithPlatform reports whether the error is due to the image being an index without an image for the requested platform.
+func isNoChildWithPlatform(err error) bool {
+	return strings.Contains(err.Error(), "no child with platform")
+}
+
+// registryURL returns the base URL of the registry of the reference, as reported to loggers.
+func registryURL(ref name.Reference) string {
+	return ref.Context().Registry.Scheme() + "://" + ref.Context().RegistryStr()
+}
+
 func getRegistrySetting(forRepoName string, givenSettings map[string]imgutil.RegistrySetting) imgutil.RegistrySetting {
-	if givenSettings == nil {
-		return imgutil.RegistrySetting{}
+	_, setting := imgutil.LookupRegistrySetting(forRepoName, givenSettings)
+	return setting
+}
+
+// applyRegistriesConfig merges the registries configuration given with WithRegistriesConfig, if any, with the registry settings.
+func applyRegistriesConfig(options *imgutil.RemoteOptions) error {
+	settings, err := imgutil.MergeRegistriesConfig(options.RegistriesConfig, options.RegistrySettings)
+	if err != nil {
+		return err
 	}
-	for prefix, r := range givenSettings {
-		if strings.HasPrefix(forRepoName, prefix) {
-			return r
-		}
+	options.RegistrySettings = settings
+	options.RegistriesConfig = ""
+	return nil
+}
+
+// newOptions applies the options given to the entry points of this package that access a registry without constructing an image.
+// It fails if one of the options was given an invalid value or the registries configuration cannot be read.
+func newOptions(ops []imgutil.ImageOption) (*imgutil.ImageOptions, error) {
+	options := &imgutil.ImageOptions{}
+	for _, op := range ops {
+		op(options)
+	}
+	if err := options.Err(); err != nil {
+		return nil, err
+	}
+	if err := applyRegistriesConfig(&options.RemoteOptions); err != nil {
+		return nil, err
 	}
-	return imgutil.RegistrySetting{}
+	return options, nil
 }
 
-func referenceForRepoName(keychain authn.Keychain, ref string, insecure bool) (name.Reference, authn.Authenticator, error) {
+// referenceForRepoName parses the image name, accessed with the setting of its registry,
+// and resolves the authenticator for its registry. It fails with an ErrBlockedRegistry if the registry is blocked.
+func referenceForRepoName(keychain authn.Keychain, ref string, reg imgutil.RegistrySetting) (name.Reference, authn.Authenticator, error) {
+	if reg.Blocked {
+		return nil, nil, imgutil.ErrBlockedRegistry{RepoName: ref}
+	}
 	var auth authn.Authenticator
 	opts := []name.Option{name.WeakValidation}
-	if insecure {
+	if reg.Insecure {
 		opts = append(opts, name.Insecure)
 	}
 	r, err := name.ParseReference(ref, opts...)
@@ -170,10 +307,37 @@ func emptyImage(platform imgutil.Platform) (v1.Image, error) {
 // (such as platform and insecure registry).
 // FIXME: this function can be deprecated in favor of remote.NewImage as this now also implements the v1.Image interface
 func NewV1Image(baseImageRepoName string, keychain authn.Keychain, ops ...func(*imgutil.ImageOptions)) (v1.Image, error) {
-	options := &imgutil.ImageOptions{}
+	imageOps := make([]imgutil.ImageOption, 0, len(ops))
 	for _, op := range ops {
-		op(options)
+		imageOps = append(imageOps, op)
+	}
+	options, err := newOptions(imageOps)
+	if err != nil {
+		return nil, err
 	}
 	options.Platform = processPlatformOption(options.Platform)
-	return processImageOption(baseImageRepoName, keychain, options.Platform, options.RegistrySettings)
+	return pullImageOption(baseImageRepoName, keychain, options)
+}
+
+// checkBaseImageDigests checks the digest of the base image, and that of the index it was selected from,
+// against the expected digest and the trust store. The base image was pinned, unless it was not found.
+func checkBaseImageDigests(options *imgutil.ImageOptions, pinnedBaseImage *name.Digest) error {
+	if options.BaseImage == nil || pinnedBaseImage == nil {
+		if err := imgutil.CheckExpectedBaseImageDigest(options); err != nil {
+			return err
+		}
+		return imgutil.CheckTrustedBaseImage(options)
+	}
+	digest, err := options.BaseImage.Digest()
+	if err != nil {
+		return err
+	}
+	digests := []v1.Hash{digest}
+	if pinned, err := v1.NewHash(pinnedBaseImage.DigestStr()); err == nil && pinned != digest {
+		digests = append(digests, pinned)
+	}
+	if err = imgutil.CheckExpectedBaseImageDigest(options, digests...); err != nil {
+		return err
+	}
+	return imgutil.CheckTrustedBaseImage(options, digests...)
 }
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/pkg/errors"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// PinnedBaseImage returns the digest reference the base image tag was resolved to when the image was created
+// with WithPinnedBaseImage, and false if the base image was not pinned (e.g. it does not exist).
+func (i *Image) PinnedBaseImage() (name.Digest, bool) {
+	if i.pinnedBaseImage == nil {
+		return name.Digest{}, false
+	}
+	return *i.pinnedBaseImage, true
+}
+
+// pinDigest resolves the reference to the digest it currently points to, with a HEAD request to the registry.
+// For a tag pointing to an index, this is the digest of the index, so the platform is still selected from it later.
+// It returns nil if the image does not exist.
+func pinDigest(repoName string, keychain authn.Keychain, withRemoteOptions imgutil.RemoteOptions, logger imgutil.Logger) (*name.Digest, error) {
+	reg := getRegistrySetting(repoName, withRemoteOptions.RegistrySettings)
+	ref, _, err := referenceForRepoName(keychain, repoName, reg)
+	if err != nil {
+		return nil, err
+	}
+	if digest, ok := ref.(name.Digest); ok {
+		return &digest, nil
+	}
+	desc, err := headDescriptor(repoName, keychain, withRemoteOptions, logger)
+	if err != nil || desc == nil {
+		return nil, err
+	}
+	digest := ref.Context().Digest(desc.Digest.String())
+	return &digest, nil
+}
+
+// headDescriptor returns the descriptor the reference currently points to, with a HEAD request to the mirrors of the registry,
+// in the order they are tried when the image is pulled, and then to the registry.
+// It returns nil if the image does not exist; other errors, such as the registry refusing the credentials, are returned.
+func headDescriptor(repoName string, keychain authn.Keychain, withRemoteOptions imgutil.RemoteOptions, logger imgutil.Logger) (*v1.Descriptor, error) {
+	reg := getRegistrySetting(repoName, withRemoteOptions.RegistrySettings)
+	ref, _, err := referenceForRepoName(keychain, repoName, reg)
+	if err != nil {
+		return nil, err
+	}
+	var mirrorErrs []error
+	for _, mirrorRepoName := range mirrorRepoNames(ref, withRemoteOptions) {
+		desc, err := head(mirrorRepoName, keychain, withRemoteOptions, logger)
+		if canonical, ok := ref.(name.Digest); ok && err == nil && desc.Digest.String() != canonical.DigestStr() {
+			err = fmt.Errorf("mirror returned digest %s; expected %s", desc.Digest, canonical.DigestStr())
+		}
+		if err == nil {
+			return desc, nil
+		}
+		mirrorErrs = append(mirrorErrs, fmt.Errorf("mirror %s: %w", mirrorRepoName, err))
+	}
+	desc, err := head(repoName, keychain, withRemoteOptions, logger)
+	if err != nil {
+		if hasStatus(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		err = errors.Wrapf(err, "resolve digest of %q", repoName)
+		if len(mirrorErrs) > 0 {
+			return nil, MirrorError{Err: err, MirrorErrs: mirrorErrs}
+		}
+		return nil, err
+	}
+	return desc, nil
+}
+
+func head(repoName string, keychain authn.Keychain, withRemoteOptions imgutil.RemoteOptions, logger imgutil.Logger) (*v1.Descriptor, error) {
+	reg := getRegistrySetting(repoName, withRemoteOptions.RegistrySettings)
+	ref, auth, err := referenceForRepoName(keychain, repoName, reg)
+	if err != nil {
+		return nil, err
+	}
+	var desc *v1.Descriptor
+	err = withRetry(withRemoteOptions.RetryPolicy, func() error {
+		desc, err = remote.Head(ref, retryOptions(withRemoteOptions.RetryPolicy,
+			remote.WithAuth(auth),
+			remote.WithTransport(getReadTransport(reg, withRemoteOptions, logger)),
+		)...)
+		return err
+	})
+	return desc, err
+}
+
+// verifyBaseImage calls the verifier, if one was provided with WithVerifier, with the descriptor of the base image,
+// before the base image is read. A base image that does not exist is not verified.
+func verifyBaseImage(repoName string, keychain authn.Keychain, withRemoteOptions imgutil.RemoteOptions, logger imgutil.Logger) error {
+	if withRemoteOptions.Verifier == nil || repoName == "" {
+		return nil
+	}
+	desc, err := headDescriptor(repoName, keychain, withRemoteOptions, logger)
+	if err != nil || desc == nil {
+		return err
+	}
+	if err = withRemoteOptions.Verifier(*desc); err != nil {
+		return imgutil.ErrVerificationFailed{Name: repoName, Digest: desc.Digest, Err: err}
+	}
+	return nil
+}
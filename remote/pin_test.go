@@ -0,0 +1,241 @@
+package remote_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestPin(t *testing.T) {
+	spec.Run(t, "Pin", testPin, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testPin(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server  *httptest.Server
+		host    string
+		baseRef name.Reference
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+		baseRef, err = name.ParseReference(host + "/pin/base:latest")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	it("resolves the base image tag once and keeps the digest when the tag moves", func() {
+		base, err := random.Image(1024, 2)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(baseRef, base))
+		baseDigest, err := base.Digest()
+		h.AssertNil(t, err)
+
+		image, err := remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+			remote.FromBaseImage(baseRef.String()),
+			remote.WithPinnedBaseImage(),
+		)
+		h.AssertNil(t, err)
+
+		moved, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(baseRef, moved))
+
+		pinned, ok := image.PinnedBaseImage()
+		h.AssertEq(t, ok, true)
+		h.AssertEq(t, pinned.DigestStr(), baseDigest.String())
+		h.AssertEq(t, pinned.Context().Name(), baseRef.Context().Name())
+
+		layers, err := image.Layers()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(layers), 2)
+		h.AssertNil(t, image.Save())
+	})
+
+	it("does not pin a base image that does not exist", func() {
+		image, err := remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+			remote.FromBaseImage(host+"/pin/missing:latest"),
+			remote.WithPinnedBaseImage(),
+		)
+		h.AssertNil(t, err)
+		_, ok := image.PinnedBaseImage()
+		h.AssertEq(t, ok, false)
+	})
+
+	it("fails when the registry refuses the credentials", func() {
+		unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"UNAUTHORIZED","message":"authentication required"}]}`))
+		}))
+		defer unauthorized.Close()
+		u, err := url.Parse(unauthorized.URL)
+		h.AssertNil(t, err)
+
+		_, err = remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+			remote.FromBaseImage(u.Host+"/pin/base:latest"),
+			remote.WithPinnedBaseImage(),
+		)
+		h.AssertError(t, err, "resolve digest of")
+		h.AssertError(t, err, "401")
+	})
+
+	it("resolves the base image tag through the mirrors", func() {
+		mirror := httptest.NewServer(registry.New())
+		defer mirror.Close()
+		u, err := url.Parse(mirror.URL)
+		h.AssertNil(t, err)
+		mirrorRef, err := name.ParseReference(u.Host + "/" + baseRef.Context().RepositoryStr() + ":latest")
+		h.AssertNil(t, err)
+		base, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(mirrorRef, base))
+		baseDigest, err := base.Digest()
+		h.AssertNil(t, err)
+
+		image, err := remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+			remote.FromBaseImage(baseRef.String()),
+			remote.WithPinnedBaseImage(),
+			remote.WithMirrors([]string{u.Host}),
+		)
+		h.AssertNil(t, err)
+		pinned, ok := image.PinnedBaseImage()
+		h.AssertEq(t, ok, true)
+		h.AssertEq(t, pinned.DigestStr(), baseDigest.String())
+	})
+
+	it("does not pin without the option", func() {
+		base, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(baseRef, base))
+
+		image, err := remote.NewImage(host+"/pin/app", authn.DefaultKeychain, remote.FromBaseImage(baseRef.String()))
+		h.AssertNil(t, err)
+		_, ok := image.PinnedBaseImage()
+		h.AssertEq(t, ok, false)
+	})
+	when("#WithExpectedDigest", func() {
+		it("creates the image if the base image resolves to the expected digest", func() {
+			base, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(baseRef, base))
+			baseDigest, err := base.Digest()
+			h.AssertNil(t, err)
+
+			image, err := remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+				remote.FromBaseImage(baseRef.String()),
+				remote.WithExpectedDigest(baseDigest),
+			)
+			h.AssertNil(t, err)
+			pinned, ok := image.PinnedBaseImage()
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, pinned.DigestStr(), baseDigest.String())
+		})
+
+		it("fails if the tag was moved to another image", func() {
+			base, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			baseDigest, err := base.Digest()
+			h.AssertNil(t, err)
+			moved, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(baseRef, moved))
+
+			_, err = remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+				remote.FromBaseImage(baseRef.String()),
+				remote.WithExpectedDigest(baseDigest),
+			)
+			var digestErr imgutil.ErrUnexpectedBaseImageDigest
+			h.AssertEq(t, errors.As(err, &digestErr), true)
+			h.AssertEq(t, digestErr.Expected, baseDigest)
+		})
+
+		it("fails if the base image does not exist", func() {
+			base, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			baseDigest, err := base.Digest()
+			h.AssertNil(t, err)
+
+			_, err = remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+				remote.FromBaseImage(host+"/pin/missing:latest"),
+				remote.WithExpectedDigest(baseDigest),
+			)
+			h.AssertError(t, err, "was not found")
+		})
+	})
+	when("#WithVerifier", func() {
+		it("verifies the descriptor of the base image before using it", func() {
+			base, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(baseRef, base))
+			baseDigest, err := base.Digest()
+			h.AssertNil(t, err)
+
+			var verified []v1.Hash
+			_, err = remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+				remote.FromBaseImage(baseRef.String()),
+				remote.WithVerifier(func(desc v1.Descriptor) error {
+					verified = append(verified, desc.Digest)
+					return nil
+				}),
+			)
+			h.AssertNil(t, err)
+			h.AssertEq(t, verified, []v1.Hash{baseDigest})
+		})
+
+		it("fails if the verifier rejects the base image", func() {
+			base, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(baseRef, base))
+			rejected := errors.New("no valid signature")
+
+			_, err = remote.NewImage(host+"/pin/app", authn.DefaultKeychain,
+				remote.FromBaseImage(baseRef.String()),
+				remote.WithVerifier(func(desc v1.Descriptor) error { return rejected }),
+			)
+			var verificationErr imgutil.ErrVerificationFailed
+			h.AssertEq(t, errors.As(err, &verificationErr), true)
+			h.AssertEq(t, errors.Is(err, rejected), true)
+		})
+
+		it("verifies the base index of NewIndex", func() {
+			image, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{Add: image})
+			h.AssertNil(t, ggcrremote.WriteIndex(baseRef, index))
+			rejected := errors.New("no valid signature")
+
+			_, err = remote.NewIndex(host+"/pin/app", imgutil.FromBaseIndex(baseRef.String()), imgutil.WithKeychain(authn.DefaultKeychain),
+				remote.WithIndexVerifier(func(desc v1.Descriptor) error {
+					h.AssertEq(t, desc.MediaType, types.OCIImageIndex)
+					return rejected
+				}),
+			)
+			h.AssertEq(t, errors.Is(err, rejected), true)
+		})
+	})
+}
@@ -0,0 +1,101 @@
+package remote_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestPlatforms(t *testing.T) {
+	spec.Run(t, "Platforms", testPlatforms, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testPlatforms(t *testing.T, when spec.G, it spec.S) {
+	var host string
+
+	it.Before(func() {
+		server := httptest.NewServer(registry.New())
+		it.After(server.Close)
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+	})
+
+	imageFor := func(platform v1.Platform) v1.Image {
+		image, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS = platform.OS
+		configFile.Architecture = platform.Architecture
+		configFile.Variant = platform.Variant
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		return image
+	}
+
+	it("returns the platform of an image", func() {
+		ref, err := name.ParseReference(host + "/some/image:latest")
+		h.AssertNil(t, err)
+		h.AssertNil(t, remote.Write(ref, imageFor(v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"})))
+
+		platforms, err := imgutil.Platforms(ref.Name(), authn.DefaultKeychain)
+		h.AssertNil(t, err)
+		h.AssertEq(t, platforms, []imgutil.Platform{{OS: "linux", Architecture: "arm64", Variant: "v8"}})
+	})
+
+	it("returns the platforms of the images in an index, skipping attestations and duplicates", func() {
+		attestation, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		index := mutate.AppendManifests(empty.Index,
+			mutate.IndexAddendum{
+				Add:        imageFor(v1.Platform{OS: "linux", Architecture: "amd64"}),
+				Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+			},
+			mutate.IndexAddendum{
+				// the platform is read from the config when it is not in the descriptor
+				Add: imageFor(v1.Platform{OS: "linux", Architecture: "arm64"}),
+			},
+			mutate.IndexAddendum{
+				Add:        imageFor(v1.Platform{OS: "linux", Architecture: "amd64"}),
+				Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+			},
+			mutate.IndexAddendum{
+				Add: attestation,
+				Descriptor: v1.Descriptor{
+					Platform:    &v1.Platform{OS: "unknown", Architecture: "unknown"},
+					Annotations: map[string]string{imgutil.AttestationReferenceTypeAnnotation: imgutil.AttestationManifestType},
+				},
+			},
+		)
+		ref, err := name.ParseReference(host + "/some/index:latest")
+		h.AssertNil(t, err)
+		h.AssertNil(t, remote.WriteIndex(ref, index))
+
+		platforms, err := imgutil.Platforms(ref.Name(), authn.DefaultKeychain)
+		h.AssertNil(t, err)
+		h.AssertEq(t, platforms, []imgutil.Platform{
+			{OS: "linux", Architecture: "amd64"},
+			{OS: "linux", Architecture: "arm64"},
+		})
+	})
+
+	it("fails when the image does not exist", func() {
+		_, err := imgutil.Platforms(host+"/some/missing:latest", authn.DefaultKeychain)
+		h.AssertError(t, err, "failed to get")
+	})
+}
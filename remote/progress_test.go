@@ -0,0 +1,97 @@
+package remote_test
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestProgress(t *testing.T) {
+	spec.Run(t, "Progress", testProgress, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testProgress(t *testing.T, when spec.G, it spec.S) {
+	when("#WithProgressHandler", func() {
+		it("reports layer uploads", func() {
+			server, _ := flakyRegistry(0)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+
+			tmpDir, err := os.MkdirTemp("", "progress-test")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(tmpDir)
+			layerPath, _, _ := h.RandomLayer(t, tmpDir)
+
+			var (
+				mu     sync.Mutex
+				events []imgutil.ProgressEvent
+			)
+			img, err := remote.NewImage(u.Host+"/progress/image", authn.DefaultKeychain,
+				remote.WithProgressHandler(func(e imgutil.ProgressEvent) {
+					mu.Lock()
+					defer mu.Unlock()
+					events = append(events, e)
+				}),
+			)
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.AddLayer(layerPath))
+			h.AssertNil(t, img.Save())
+
+			h.AssertEq(t, len(events) > 0, true)
+			last := events[len(events)-1]
+			h.AssertEq(t, last.Complete, last.Total)
+		})
+
+		it("reports layer downloads from the base image", func() {
+			server, _ := flakyRegistry(0)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			baseName := u.Host + "/progress/base"
+
+			tmpDir, err := os.MkdirTemp("", "progress-test")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(tmpDir)
+			layerPath, diffID, _ := h.RandomLayer(t, tmpDir)
+
+			base, err := remote.NewImage(baseName, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			h.AssertNil(t, base.AddLayer(layerPath))
+			h.AssertNil(t, base.Save())
+
+			var (
+				mu     sync.Mutex
+				events []imgutil.ProgressEvent
+			)
+			img, err := remote.NewImage(u.Host+"/progress/image", authn.DefaultKeychain,
+				remote.FromBaseImage(baseName),
+				remote.WithProgressHandler(func(e imgutil.ProgressEvent) {
+					mu.Lock()
+					defer mu.Unlock()
+					events = append(events, e)
+				}),
+			)
+			h.AssertNil(t, err)
+			rc, err := img.GetLayer(diffID)
+			h.AssertNil(t, err)
+			_, err = io.Copy(io.Discard, rc)
+			h.AssertNil(t, err)
+			h.AssertNil(t, rc.Close())
+
+			h.AssertEq(t, len(events) > 0, true)
+			last := events[len(events)-1]
+			h.AssertEq(t, last.Complete, last.Total)
+		})
+	})
+}
@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// withRateLimits returns the transport limited to the rates given with WithUploadRateLimit and WithDownloadRateLimit,
+// and to the budget given with WithDownloadBudget, if any.
+func withRateLimits(base http.RoundTripper, options imgutil.RemoteOptions) http.RoundTripper {
+	if options.UploadRateLimiter == nil && options.DownloadRateLimiter == nil && options.DownloadBudget == nil {
+		return base
+	}
+	return &rateLimitedTransport{
+		base:     base,
+		upload:   options.UploadRateLimiter,
+		download: options.DownloadRateLimiter,
+		budget:   options.DownloadBudget,
+	}
+}
+
+// rateLimitedTransport limits the bandwidth of the request bodies it sends, e.g. blob uploads,
+// and of the response bodies it receives, e.g. blob downloads, with shared limiters.
+// It also uses the download budget for the response bodies it receives.
+type rateLimitedTransport struct {
+	base     http.RoundTripper
+	upload   *imgutil.RateLimiter
+	download *imgutil.RateLimiter
+	budget   *imgutil.ByteBudget
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.upload != nil && req.Body != nil && req.Body != http.NoBody {
+		limited := req.Clone(req.Context())
+		limited.Body = t.limitedBody(req, req.Body)
+		if req.GetBody != nil {
+			limited.GetBody = func() (io.ReadCloser, error) {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				return t.limitedBody(req, body), nil
+			}
+		}
+		req = limited
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, err
+	}
+	if t.budget != nil {
+		if resp.ContentLength > 0 {
+			if err := t.budget.Check(resp.ContentLength); err != nil {
+				resp.Body.Close()
+				return nil, err
+			}
+		}
+		resp.Body = readCloser(t.budget.Reader(resp.Body), resp.Body)
+	}
+	if t.download != nil {
+		resp.Body = readCloser(t.download.Reader(req.Context(), resp.Body), resp.Body)
+	}
+	return resp, nil
+}
+
+func (t *rateLimitedTransport) limitedBody(req *http.Request, body io.ReadCloser) io.ReadCloser {
+	return readCloser(t.upload.Reader(req.Context(), body), body)
+}
+
+// readCloser returns a ReadCloser reading from r and closing c.
+func readCloser(r io.Reader, c io.Closer) io.ReadCloser {
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, c}
+}
@@ -0,0 +1,111 @@
+package remote
+
+import (
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// Rebase replaces the layers below the given layer with the layers of the new base.
+// When the new base is a remote image, its repository is recorded as the origin of its layers,
+// so that saving the image to another repository on the same registry mounts them from there instead of uploading them again.
+func (i *Image) Rebase(baseTopLayerDiffID string, withNewBase imgutil.Image) error {
+	if err := i.CNBImageCore.Rebase(baseTopLayerDiffID, withNewBase); err != nil {
+		return err
+	}
+	newBase, ok := withNewBase.(*Image)
+	if !ok {
+		return nil
+	}
+	reg := getRegistrySetting(newBase.repoName, newBase.registrySettings)
+	opts := []name.Option{name.WeakValidation}
+	if reg.Insecure {
+		opts = append(opts, name.Insecure)
+	}
+	origin, err := name.ParseReference(newBase.repoName, opts...)
+	if err != nil {
+		return nil // the layers are then uploaded as usual
+	}
+	layers, err := newBase.UnderlyingImage().Layers()
+	if err != nil {
+		return err
+	}
+	if i.layerOrigins == nil {
+		i.layerOrigins = make(map[v1.Hash]name.Reference)
+	}
+	for _, layer := range layers {
+		diffID, err := layer.DiffID()
+		if err != nil {
+			return err
+		}
+		i.layerOrigins[diffID] = origin
+	}
+	return nil
+}
+
+// mountableImage makes the layers of the image with a known origin on the registry the image is saved to
+// mountable from their origin repository, as remote.Write only mounts layers that are remote.MountableLayer.
+type mountableImage struct {
+	v1.Image
+	registry string
+	origins  map[v1.Hash]name.Reference
+}
+
+func withMountableLayers(image v1.Image, to name.Reference, origins map[v1.Hash]name.Reference) v1.Image {
+	if len(origins) == 0 {
+		return image
+	}
+	return &mountableImage{Image: image, registry: to.Context().RegistryStr(), origins: origins}
+}
+
+func (m *mountableImage) Layers() ([]v1.Layer, error) {
+	layers, err := m.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	mountable := make([]v1.Layer, len(layers))
+	for idx, layer := range layers {
+		if mountable[idx], err = m.mountable(layer); err != nil {
+			return nil, err
+		}
+	}
+	return mountable, nil
+}
+
+func (m *mountableImage) LayerByDigest(h v1.Hash) (v1.Layer, error) {
+	layer, err := m.Image.LayerByDigest(h)
+	if err != nil {
+		return nil, err
+	}
+	return m.mountable(layer)
+}
+
+func (m *mountableImage) LayerByDiffID(h v1.Hash) (v1.Layer, error) {
+	layer, err := m.Image.LayerByDiffID(h)
+	if err != nil {
+		return nil, err
+	}
+	return m.mountable(layer)
+}
+
+// mountable returns the layer as mountable from its recorded origin, if it is on the destination registry
+// and the layer is not already mountable from a repository on that registry, e.g. because it was fetched from a mirror.
+func (m *mountableImage) mountable(layer v1.Layer) (v1.Layer, error) {
+	diffID, err := layer.DiffID()
+	if err != nil {
+		return nil, err
+	}
+	origin, ok := m.origins[diffID]
+	if !ok || origin.Context().RegistryStr() != m.registry {
+		return layer, nil
+	}
+	if existing, ok := layer.(*remote.MountableLayer); ok {
+		if existing.Reference.Context().RegistryStr() == m.registry {
+			return layer, nil
+		}
+		layer = existing.Layer
+	}
+	return &remote.MountableLayer{Layer: layer, Reference: origin}, nil
+}
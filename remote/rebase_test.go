@@ -0,0 +1,114 @@
+package remote_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRebaseMount(t *testing.T) {
+	spec.Run(t, "RebaseMount", testRebaseMount, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// blobRequests records the repositories that blobs are requested to be mounted from.
+// As the registry stores blobs for all repositories together, blobs are reported missing from the rebased repository
+// for the uploads to happen.
+type blobRequests struct {
+	mu          sync.Mutex
+	mountedFrom []string
+}
+
+func recordingRegistry(requests *blobRequests) *httptest.Server {
+	reg := registry.New()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead && strings.HasPrefix(r.URL.Path, "/v2/app/rebased/blobs/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if from := r.URL.Query().Get("from"); r.Method == http.MethodPost && from != "" {
+			requests.mu.Lock()
+			requests.mountedFrom = append(requests.mountedFrom, from)
+			requests.mu.Unlock()
+		}
+		reg.ServeHTTP(w, r)
+	}))
+}
+
+func testRebaseMount(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server   *httptest.Server
+		requests *blobRequests
+		host     string
+	)
+
+	it.Before(func() {
+		requests = &blobRequests{}
+		server = recordingRegistry(requests)
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+
+		oldBase, err := random.Image(100, 2)
+		h.AssertNil(t, err)
+		appLayer, err := random.Layer(100, types.DockerLayer)
+		h.AssertNil(t, err)
+		app, err := mutate.AppendLayers(oldBase, appLayer)
+		h.AssertNil(t, err)
+		newBase, err := random.Image(100, 2)
+		h.AssertNil(t, err)
+		for repo, image := range map[string]v1.Image{"base/old": oldBase, "app/image": app, "base/new": newBase} {
+			ref, err := name.ParseReference(host + "/" + repo)
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.Write(ref, image))
+		}
+		requests.mountedFrom = nil
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	rebase := func(ops ...imgutil.ImageOption) {
+		img, err := remote.NewImage(host+"/app/rebased", authn.DefaultKeychain, append([]imgutil.ImageOption{remote.FromBaseImage(host + "/app/image")}, ops...)...)
+		h.AssertNil(t, err)
+		newBase, err := remote.NewImage(host+"/base/new", authn.DefaultKeychain, remote.FromBaseImage(host+"/base/new"))
+		h.AssertNil(t, err)
+
+		layers, err := img.Layers()
+		h.AssertNil(t, err)
+		oldBaseTop, err := layers[1].DiffID()
+		h.AssertNil(t, err)
+		h.AssertNil(t, img.Rebase(oldBaseTop.String(), newBase))
+		h.AssertNil(t, img.Save())
+		sort.Strings(requests.mountedFrom)
+	}
+
+	it("mounts the layers of the new base instead of uploading them", func() {
+		rebase()
+		h.AssertEq(t, requests.mountedFrom, []string{"app/image", "base/new", "base/new"})
+	})
+
+	it("mounts the layers when progress is reported", func() {
+		rebase(remote.WithProgressHandler(func(imgutil.ProgressEvent) {}))
+		h.AssertEq(t, requests.mountedFrom, []string{"app/image", "base/new", "base/new"})
+	})
+}
@@ -0,0 +1,49 @@
+package remote
+
+import (
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// capabilities are the capabilities of remote images.
+var capabilities = imgutil.Capabilities{CanRebase: true, CanSetAnnotations: true, CanPush: true}
+
+func init() {
+	imgutil.RegisterScheme(imgutil.RemoteScheme, func(name string, ops ...imgutil.ImageOption) (imgutil.Image, error) {
+		return NewImageFromRef(name, authn.DefaultKeychain, ops...)
+	}, capabilities)
+	imgutil.RegisterAccessChecker(imgutil.RemoteScheme, func(name string, scope imgutil.AccessScope) error {
+		return CheckAccess(name, authn.DefaultKeychain, scope)
+	})
+	imgutil.RegisterDescriptorGetter(getDescriptor)
+	imgutil.RegisterTransportGetter(getTransport)
+}
+
+// getDescriptor returns the descriptor of the image or index at the given reference, for imgutil.GetDescriptor,
+// fetched with the transport and retries of remote images.
+func getDescriptor(repoName string, keychain authn.Keychain, ops ...imgutil.ImageOption) (*remote.Descriptor, error) {
+	options := &imgutil.ImageOptions{}
+	for _, op := range ops {
+		op(options)
+	}
+	reg := getRegistrySetting(repoName, options.RegistrySettings)
+	ref, auth, err := referenceForRepoName(keychain, repoName, reg)
+	if err != nil {
+		return nil, err
+	}
+	httpTransport := getReadTransport(reg, options.RemoteOptions, options.Logger)
+	var desc *remote.Descriptor
+	err = withRetry(options.RetryPolicy, func() error {
+		desc, err = remote.Get(ref, retryOptions(options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(httpTransport))...)
+		return err
+	})
+	return desc, err
+}
+
+// NewImageFromRef returns the image at the given reference in a registry, which is saved back to it.
+// When the image is created through imgutil.NewImageFromRef, the default keychain is used.
+func NewImageFromRef(ref string, keychain authn.Keychain, ops ...imgutil.ImageOption) (*Image, error) {
+	return NewImage(ref, keychain, append([]imgutil.ImageOption{FromBaseImage(ref)}, ops...)...)
+}
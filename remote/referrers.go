@@ -0,0 +1,128 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// AttachArtifact pushes the artifact to the repository of the subject image, referring to the subject,
+// so that it is returned when listing the referrers of the subject (see ListReferrers).
+// The artifact type is recorded as the artifactType of artifacts with the empty config (see imgutil.NewArtifact),
+// and as the media type of the config of other artifacts, as specified by OCI 1.1.
+// For registries that do not support the Referrers API, the referrers tag schema (`sha256-<digest>`) is updated instead.
+// Registry settings and the retry policy are taken from the given options.
+func AttachArtifact(subjectRef string, artifact v1.Image, artifactType string, keychain authn.Keychain, ops ...imgutil.ImageOption) (name.Digest, error) {
+	options, err := newOptions(ops)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	reg := getRegistrySetting(subjectRef, options.RegistrySettings)
+	ref, auth, err := referenceForRepoName(keychain, subjectRef, reg)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	remoteOpts := retryOptions(options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, options.RemoteOptions, options.Logger)))
+
+	subject, err := headWithRetry(ref, options.RetryPolicy, remoteOpts)
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to get subject %s: %w", subjectRef, err)
+	}
+	return attachArtifact(ref.Context(), *subject, artifact, artifactType, options.RetryPolicy, remoteOpts)
+}
+
+// attachArtifact pushes the artifact to the repository, referring to the subject.
+func attachArtifact(repo name.Repository, subject v1.Descriptor, artifact v1.Image, artifactType string, policy imgutil.RetryPolicy, remoteOpts []remote.Option) (name.Digest, error) {
+	artifact, err := imgutil.ReferrerArtifact(artifact, artifactType, subject)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	digest, err := artifact.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	artifactRef := repo.Digest(digest.String())
+	if err = withRetry(policy, func() error {
+		return remote.Write(artifactRef, artifact, remoteOpts...)
+	}); err != nil {
+		return name.Digest{}, err
+	}
+	return artifactRef, nil
+}
+
+// ListReferrers returns the descriptors of the artifacts referring to the subject image,
+// using the Referrers API or, for registries that do not support it, the referrers tag schema.
+// The artifact type of each referrer is set in its descriptor. Registries and clients that do not read the artifactType
+// of manifests report the media type of the config instead, which is the empty media type for artifacts with the empty config;
+// the artifact type of those referrers is read from their manifest.
+func ListReferrers(subjectRef string, keychain authn.Keychain, ops ...imgutil.ImageOption) ([]v1.Descriptor, error) {
+	options, err := newOptions(ops)
+	if err != nil {
+		return nil, err
+	}
+	reg := getRegistrySetting(subjectRef, options.RegistrySettings)
+	ref, auth, err := referenceForRepoName(keychain, subjectRef, reg)
+	if err != nil {
+		return nil, err
+	}
+	remoteOpts := retryOptions(options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, options.RemoteOptions, options.Logger)))
+
+	digest, ok := ref.(name.Digest)
+	if !ok {
+		subject, err := headWithRetry(ref, options.RetryPolicy, remoteOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subject %s: %w", subjectRef, err)
+		}
+		digest = ref.Context().Digest(subject.Digest.String())
+	}
+
+	var referrers v1.ImageIndex
+	if err = withRetry(options.RetryPolicy, func() error {
+		referrers, err = remote.Referrers(digest, remoteOpts...)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	indexManifest, err := referrers.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for idx, desc := range indexManifest.Manifests {
+		if desc.ArtifactType != string(imgutil.EmptyJSONMediaType) {
+			continue
+		}
+		var manifest struct {
+			ArtifactType string `json:"artifactType"`
+		}
+		if err = withRetry(options.RetryPolicy, func() error {
+			got, err := remote.Get(ref.Context().Digest(desc.Digest.String()), remoteOpts...)
+			if err != nil {
+				return err
+			}
+			return json.Unmarshal(got.Manifest, &manifest)
+		}); err != nil {
+			return nil, fmt.Errorf("failed to get referrer %s: %w", desc.Digest, err)
+		}
+		indexManifest.Manifests[idx].ArtifactType = manifest.ArtifactType
+	}
+	return indexManifest.Manifests, nil
+}
+
+func headWithRetry(ref name.Reference, policy imgutil.RetryPolicy, remoteOpts []remote.Option) (*v1.Descriptor, error) {
+	var (
+		desc *v1.Descriptor
+		err  error
+	)
+	err = withRetry(policy, func() error {
+		desc, err = remote.Head(ref, remoteOpts...)
+		return err
+	})
+	return desc, err
+}
@@ -0,0 +1,102 @@
+package remote_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestReferrers(t *testing.T) {
+	spec.Run(t, "Referrers", testReferrers, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testReferrers(t *testing.T, when spec.G, it spec.S) {
+	const sbomType = "application/spdx+json"
+
+	for _, referrersSupport := range []bool{true, false} {
+		referrersSupport := referrersSupport
+		when("registry referrers support is "+map[bool]string{true: "enabled", false: "disabled"}[referrersSupport], func() {
+			var (
+				server     *httptest.Server
+				subjectRef string
+			)
+
+			it.Before(func() {
+				server = httptest.NewServer(registry.New(registry.WithReferrersSupport(referrersSupport)))
+				u, err := url.Parse(server.URL)
+				h.AssertNil(t, err)
+				subjectRef = u.Host + "/referrers/image:latest"
+
+				subject, err := random.Image(1024, 1)
+				h.AssertNil(t, err)
+				ref, err := name.ParseReference(subjectRef)
+				h.AssertNil(t, err)
+				h.AssertNil(t, ggcrremote.Write(ref, subject))
+			})
+
+			it.After(func() {
+				server.Close()
+			})
+
+			it("lists attached artifacts as referrers of the subject", func() {
+				sbom, err := imgutil.NewAttestationImage(imgutil.Attestation{Contents: []byte(`{"spdxVersion":"SPDX-2.3"}`)})
+				h.AssertNil(t, err)
+
+				artifactRef, err := remote.AttachArtifact(subjectRef, sbom, sbomType, authn.DefaultKeychain)
+				h.AssertNil(t, err)
+
+				referrers, err := remote.ListReferrers(subjectRef, authn.DefaultKeychain)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(referrers), 1)
+				h.AssertEq(t, referrers[0].Digest.String(), artifactRef.DigestStr())
+				h.AssertEq(t, referrers[0].ArtifactType, sbomType)
+			})
+
+			it("attaches SBOMs as referrers when the image is saved, with WithSBOMsAsReferrers", func() {
+				image, err := remote.NewImage(subjectRef, authn.DefaultKeychain, remote.WithSBOMsAsReferrers())
+				h.AssertNil(t, err)
+				h.AssertNil(t, image.AddSBOM(sbomType, strings.NewReader(`{"spdxVersion":"SPDX-2.3"}`)))
+				layers, err := image.Layers()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(layers), 0)
+				h.AssertNil(t, image.Save())
+
+				referrers, err := remote.ListReferrers(subjectRef, authn.DefaultKeychain)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(referrers), 1)
+				h.AssertEq(t, referrers[0].ArtifactType, sbomType)
+			})
+
+			it("returns no referrers for a subject without artifacts", func() {
+				referrers, err := remote.ListReferrers(subjectRef, authn.DefaultKeychain)
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(referrers), 0)
+			})
+		})
+	}
+
+	it("fails when the subject does not exist", func() {
+		server := httptest.NewServer(registry.New())
+		defer server.Close()
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+
+		artifact, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		_, err = remote.AttachArtifact(u.Host+"/referrers/missing:latest", artifact, sbomType, authn.DefaultKeychain)
+		h.AssertError(t, err, "failed to get subject")
+	})
+}
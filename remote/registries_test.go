@@ -0,0 +1,159 @@
+package remote_test
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRegistriesConfig(t *testing.T) {
+	spec.Run(t, "RegistriesConfig", testRegistriesConfig, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testRegistriesConfig(t *testing.T, when spec.G, it spec.S) {
+	var (
+		upstreamHost, mirrorHost string
+		tmpDir                   string
+	)
+
+	it.Before(func() {
+		upstream, _ := flakyRegistry(0)
+		mirror, _ := flakyRegistry(0)
+		it.After(upstream.Close)
+		it.After(mirror.Close)
+		u, err := url.Parse(upstream.URL)
+		h.AssertNil(t, err)
+		upstreamHost = u.Host
+		u, err = url.Parse(mirror.URL)
+		h.AssertNil(t, err)
+		mirrorHost = u.Host
+		tmpDir, err = os.MkdirTemp("", "registries-config")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	writeConfig := func(contents string) string {
+		path := filepath.Join(tmpDir, "registries.conf")
+		h.AssertNil(t, os.WriteFile(path, []byte(contents), 0600))
+		return path
+	}
+
+	when("#WithRegistriesConfig", func() {
+		it("reads base images from the mirrors of their registry", func() {
+			img := pushRandomImage(t, mirrorHost+"/team/base:latest")
+			digest, err := img.Digest()
+			h.AssertNil(t, err)
+			config := writeConfig(fmt.Sprintf(`
+[[registry]]
+prefix = "%s/team"
+
+[[registry.mirror]]
+location = "%s/team"
+`, upstreamHost, mirrorHost))
+
+			baseImage, err := remote.NewV1Image(upstreamHost+"/team/base:latest", authn.DefaultKeychain, remote.WithRegistriesConfig(config))
+			h.AssertNil(t, err)
+			actual, err := baseImage.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, digest)
+		})
+
+		it("only mirrors digest references with mirror-by-digest-only", func() {
+			img := pushRandomImage(t, mirrorHost+"/team/base:latest")
+			digest, err := img.Digest()
+			h.AssertNil(t, err)
+			config := writeConfig(fmt.Sprintf(`
+[[registry]]
+prefix = "%s/team"
+mirror-by-digest-only = true
+
+[[registry.mirror]]
+location = "%s/team"
+`, upstreamHost, mirrorHost))
+
+			baseImage, err := remote.NewV1Image(upstreamHost+"/team/base:latest", authn.DefaultKeychain, remote.WithRegistriesConfig(config))
+			h.AssertNil(t, err)
+			actual, err := baseImage.Digest()
+			h.AssertNil(t, err)
+			h.AssertNotEq(t, actual, digest)
+
+			baseImage, err = remote.NewV1Image(upstreamHost+"/team/base@"+digest.String(), authn.DefaultKeychain, remote.WithRegistriesConfig(config))
+			h.AssertNil(t, err)
+			actual, err = baseImage.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, actual, digest)
+		})
+
+		it("fails to access blocked registries", func() {
+			config := writeConfig(fmt.Sprintf("[[registry]]\nlocation = %q\nblocked = true\n", upstreamHost))
+
+			_, err := remote.NewImage(upstreamHost+"/team/app", authn.DefaultKeychain, remote.WithRegistriesConfig(config))
+			h.AssertEq(t, errors.As(err, &imgutil.ErrBlockedRegistry{}), true)
+
+			_, err = remote.NewImage(mirrorHost+"/team/app", authn.DefaultKeychain, remote.WithRegistriesConfig(config), remote.FromBaseImage(upstreamHost+"/team/base"))
+			h.AssertEq(t, errors.As(err, &imgutil.ErrBlockedRegistry{}), true)
+		})
+
+		it("fails if the file is not valid", func() {
+			config := writeConfig("[[registry]]\ninsecure = yes\n")
+			_, err := remote.NewImage(upstreamHost+"/team/app", authn.DefaultKeychain, remote.WithRegistriesConfig(config))
+			h.AssertError(t, err, "insecure must be true or false")
+		})
+
+		it("applies the configuration in every entry point", func() {
+			config := writeConfig(fmt.Sprintf("[[registry]]\nlocation = %q\nblocked = true\n", upstreamHost))
+			repoName := upstreamHost + "/team/app"
+
+			err := remote.CheckAccess(repoName, authn.DefaultKeychain, imgutil.PullAccess, remote.WithRegistriesConfig(config))
+			h.AssertEq(t, errors.As(err, &imgutil.ErrBlockedRegistry{}), true)
+			_, err = remote.ListReferrers(repoName, authn.DefaultKeychain, remote.WithRegistriesConfig(config))
+			h.AssertEq(t, errors.As(err, &imgutil.ErrBlockedRegistry{}), true)
+			_, err = remote.NewTrustStore(repoName, authn.DefaultKeychain, nil, remote.WithRegistriesConfig(config)).Metadata()
+			h.AssertEq(t, errors.As(err, &imgutil.ErrBlockedRegistry{}), true)
+			_, err = remote.NewIndex(mirrorHost+"/team/index", imgutil.FromBaseIndex(upstreamHost+"/team/index"),
+				remote.WithIndexRemoteOptions(remote.WithRegistriesConfig(config)))
+			h.AssertEq(t, errors.As(err, &imgutil.ErrBlockedRegistry{}), true)
+		})
+
+		it("fails in every entry point if the file is not valid", func() {
+			config := writeConfig("[[registry]]\ninsecure = yes\n")
+			repoName := upstreamHost + "/team/app"
+
+			err := remote.CheckAccess(repoName, authn.DefaultKeychain, imgutil.PullAccess, remote.WithRegistriesConfig(config))
+			h.AssertError(t, err, "insecure must be true or false")
+			_, err = remote.NewTrustStore(repoName, authn.DefaultKeychain, nil, remote.WithRegistriesConfig(config)).Metadata()
+			h.AssertError(t, err, "insecure must be true or false")
+			_, err = remote.NewIndex(repoName, remote.WithIndexRemoteOptions(remote.WithRegistriesConfig(config)))
+			h.AssertError(t, err, "insecure must be true or false")
+		})
+	})
+
+	when("imgutil#WithRegistriesConfig", func() {
+		it("fails to load indexes from blocked registries", func() {
+			config := writeConfig(fmt.Sprintf("[[registry]]\nlocation = %q\nblocked = true\n", upstreamHost))
+			_, err := remote.NewIndex(mirrorHost+"/team/index", imgutil.FromBaseIndex(upstreamHost+"/team/index"), imgutil.WithRegistriesConfig(config))
+			h.AssertEq(t, errors.As(err, &imgutil.ErrBlockedRegistry{}), true)
+		})
+
+		it("fails to push indexes to blocked registries", func() {
+			config := writeConfig(fmt.Sprintf("[[registry]]\nlocation = %q\nblocked = true\n", upstreamHost))
+			index, err := remote.NewIndex(upstreamHost+"/team/index", imgutil.WithXDGRuntimePath(tmpDir), imgutil.WithRegistriesConfig(config))
+			h.AssertNil(t, err)
+			h.AssertEq(t, errors.As(index.Push(), &imgutil.ErrBlockedRegistry{}), true)
+		})
+	})
+}
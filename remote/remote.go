@@ -16,14 +16,30 @@ import (
 	"github.com/buildpacks/imgutil"
 )
 
-const maxRetries = 2
-
 type Image struct {
 	*imgutil.CNBImageCore
 	repoName            string
 	keychain            authn.Keychain
 	addEmptyLayerOnSave bool
+	canonicalJSON       bool
 	registrySettings    map[string]imgutil.RegistrySetting
+	retryPolicy         imgutil.RetryPolicy
+	logger              imgutil.Logger
+	metrics             imgutil.MetricsHook
+	progressHandler     imgutil.ProgressHandler
+	sbomsAsReferrers    bool
+	validateBeforePush  bool
+	remoteOptions       imgutil.RemoteOptions // for the transport
+	pinnedBaseImage     *name.Digest
+	sboms               []sbom
+	// layerOrigins holds the references of the remote images that layers were taken from, to mount them when saving
+	layerOrigins map[v1.Hash]name.Reference
+}
+
+// sbom is an SBOM to be attached to the image as a referrer when it is saved.
+type sbom struct {
+	mediaType string
+	content   []byte
 }
 
 func (i *Image) Kind() string {
@@ -45,11 +61,16 @@ func (i *Image) Found() bool {
 
 func (i *Image) found() (*v1.Descriptor, error) {
 	reg := getRegistrySetting(i.repoName, i.registrySettings)
-	ref, auth, err := referenceForRepoName(i.keychain, i.repoName, reg.Insecure)
+	ref, auth, err := referenceForRepoName(i.keychain, i.repoName, reg)
 	if err != nil {
 		return nil, err
 	}
-	return remote.Head(ref, remote.WithAuth(auth), remote.WithTransport(imgutil.GetTransport(reg.Insecure)))
+	var desc *v1.Descriptor
+	err = withRetry(i.retryPolicy, func() error {
+		desc, err = remote.Head(ref, retryOptions(i.retryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, i.remoteOptions, i.logger)))...)
+		return err
+	})
+	return desc, err
 }
 
 func (i *Image) Identifier() (imgutil.Identifier, error) {
@@ -80,12 +101,15 @@ func (i *Image) Valid() bool {
 
 func (i *Image) valid() error {
 	reg := getRegistrySetting(i.repoName, i.registrySettings)
-	ref, auth, err := referenceForRepoName(i.keychain, i.repoName, reg.Insecure)
+	ref, auth, err := referenceForRepoName(i.keychain, i.repoName, reg)
 	if err != nil {
 		return err
 	}
-	desc, err := remote.Get(ref, remote.WithAuth(auth), remote.WithTransport(imgutil.GetTransport(reg.Insecure)))
-	if err != nil {
+	var desc *remote.Descriptor
+	if err = withRetry(i.retryPolicy, func() error {
+		desc, err = remote.Get(ref, retryOptions(i.retryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, i.remoteOptions, i.logger)))...)
+		return err
+	}); err != nil {
 		return err
 	}
 	if desc.MediaType == types.OCIImageIndex || desc.MediaType == types.DockerManifestList {
@@ -108,11 +132,14 @@ func (i *Image) Delete() error {
 		return err
 	}
 	reg := getRegistrySetting(i.repoName, i.registrySettings)
-	ref, auth, err := referenceForRepoName(i.keychain, id.String(), reg.Insecure)
+	ref, auth, err := referenceForRepoName(i.keychain, id.String(), reg)
 	if err != nil {
 		return err
 	}
-	return remote.Delete(ref, remote.WithAuth(auth), remote.WithTransport(imgutil.GetTransport(reg.Insecure)))
+	imgutil.Debugf(i.logger, "deleting %s from %s", ref.Name(), registryURL(ref))
+	return withRetry(i.retryPolicy, func() error {
+		return remote.Delete(ref, retryOptions(i.retryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, i.remoteOptions, i.logger)))...)
+	})
 }
 
 // extras
@@ -122,8 +149,11 @@ func (i *Image) CheckReadAccess() (bool, error) {
 	if _, err = i.found(); err == nil {
 		return true, nil
 	}
-	var canRead bool
-	if transportErr, ok := err.(*transport.Error); ok {
+	var (
+		canRead      bool
+		transportErr *transport.Error
+	)
+	if errors.As(err, &transportErr) {
 		if canRead = transportErr.StatusCode != http.StatusUnauthorized &&
 			transportErr.StatusCode != http.StatusForbidden; canRead {
 			err = nil
@@ -137,7 +167,7 @@ func (i *Image) CheckReadWriteAccess() (bool, error) {
 		return false, err
 	}
 	reg := getRegistrySetting(i.repoName, i.registrySettings)
-	ref, _, err := referenceForRepoName(i.keychain, i.repoName, reg.Insecure)
+	ref, _, err := referenceForRepoName(i.keychain, i.repoName, reg)
 	if err != nil {
 		return false, err
 	}
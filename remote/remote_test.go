@@ -1131,6 +1131,51 @@ func testImage(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#SetVolumes", func() {
+		it("sets the volumes", func() {
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.SetVolumes(map[string]struct{}{"/data": {}}))
+			h.AssertNil(t, img.Save())
+
+			configFile := h.FetchManifestImageConfigFile(t, repoName)
+			h.AssertEq(t, configFile.Config.Volumes, map[string]struct{}{"/data": {}})
+		})
+	})
+
+	when("#SetStopSignal", func() {
+		it("sets the stop signal", func() {
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.SetStopSignal("SIGQUIT"))
+			h.AssertNil(t, img.Save())
+
+			configFile := h.FetchManifestImageConfigFile(t, repoName)
+			h.AssertEq(t, configFile.Config.StopSignal, "SIGQUIT")
+		})
+	})
+
+	when("#SetUser", func() {
+		it("sets the user", func() {
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, img.SetUser("1000:1000"))
+			h.AssertNil(t, img.Save())
+
+			configFile := h.FetchManifestImageConfigFile(t, repoName)
+			h.AssertEq(t, configFile.Config.User, "1000:1000")
+
+			loaded, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.FromBaseImage(repoName))
+			h.AssertNil(t, err)
+			user, err := loaded.User()
+			h.AssertNil(t, err)
+			h.AssertEq(t, user, "1000:1000")
+		})
+	})
+
 	when("#SetWorkingDir", func() {
 		it("sets the environment", func() {
 			img, err := remote.NewImage(repoName, authn.DefaultKeychain)
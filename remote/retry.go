@@ -0,0 +1,108 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/buildpacks/imgutil"
+)
+
+const (
+	maxRetries     = 2
+	defaultBackoff = 100 * time.Millisecond
+)
+
+// RetryError is returned when a registry operation kept failing with a transient error
+// until the retry policy was exhausted.
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e RetryError) Error() string {
+	return fmt.Sprintf("failed after %d attempts: %s", e.Attempts, e.Err.Error())
+}
+
+func (e RetryError) Unwrap() error {
+	return e.Err
+}
+
+func processRetryPolicy(requestedPolicy imgutil.RetryPolicy) imgutil.RetryPolicy {
+	policy := requestedPolicy
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = maxRetries + 1
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultBackoff
+	}
+	return policy
+}
+
+// withRetry calls the provided operation until it succeeds, fails with an error that is not transient,
+// or the number of attempts allowed by the policy is exhausted.
+// Errors from operations that were attempted more than once are wrapped in a RetryError.
+func withRetry(policy imgutil.RetryPolicy, op func() error) error {
+	policy = processRetryPolicy(policy)
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if err = op(); err == nil {
+			return nil
+		}
+		if !isTransient(err) {
+			if attempt == 1 {
+				return err
+			}
+			return RetryError{Attempts: attempt, Err: err}
+		}
+		if attempt < policy.MaxAttempts {
+			wait := backoffFor(policy, attempt)
+			imgutil.Debugf(policy.Logger, "attempt %d of %d failed, retrying in %s: %s", attempt, policy.MaxAttempts, wait, err)
+			time.Sleep(wait)
+		}
+	}
+	if policy.MaxAttempts == 1 {
+		return err
+	}
+	return RetryError{Attempts: policy.MaxAttempts, Err: err}
+}
+
+// retryOptions returns the options of a registry operation retried with withRetry under the policy.
+// When a policy is set with WithRetryPolicy, the retries of go-containerregistry on failed writes and 408, 429 and 5xx responses
+// are disabled, so that the operation is attempted as many times as the policy allows rather than that many times the retries
+// of go-containerregistry; network errors it considers temporary are still retried by its transport, which cannot be disabled.
+// Without a policy, the default policy is stacked on the retries of go-containerregistry.
+func retryOptions(policy imgutil.RetryPolicy, opts ...remote.Option) []remote.Option {
+	if policy.MaxAttempts < 1 {
+		return opts
+	}
+	return append(opts, remote.WithRetryBackoff(remote.Backoff{Steps: 1}), remote.WithRetryStatusCodes())
+}
+
+// backoffFor returns the exponential backoff for the given attempt with up to 50% of random jitter added.
+func backoffFor(policy imgutil.RetryPolicy, attempt int) time.Duration {
+	wait := policy.Backoff << (attempt - 1)
+	jitter := time.Duration(rand.Int63n(int64(wait)/2 + 1)) // #nosec G404
+	return wait + jitter
+}
+
+func isTransient(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) {
+		return transportErr.Temporary()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout()
+	}
+	return false
+}
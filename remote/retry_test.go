@@ -0,0 +1,103 @@
+package remote_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestRetry(t *testing.T) {
+	spec.Run(t, "Retry", testRetry, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// flakyRegistry serves an in-memory registry that fails the first `failures` requests with an UNAVAILABLE error.
+// The error is sent with a 400 status, which go-containerregistry does not retry on its own,
+// so only the retry policy of imgutil can recover from it.
+func flakyRegistry(failures int32) (*httptest.Server, *int32) {
+	var requests int32
+	reg := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors":[{"code":"UNAVAILABLE","message":"try again"}]}`))
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	return server, &requests
+}
+
+func testRetry(t *testing.T, when spec.G, it spec.S) {
+	when("#WithRetryPolicy", func() {
+		it("retries transient failures until the operation succeeds", func() {
+			server, _ := flakyRegistry(2)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			repoName := u.Host + "/retry/image"
+
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.WithRetryPolicy(3, time.Millisecond))
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.Save())
+		})
+
+		it("does not retry when the policy allows a single attempt", func() {
+			server, requests := flakyRegistry(1)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			repoName := u.Host + "/retry/image"
+
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.WithRetryPolicy(1, time.Millisecond))
+			h.AssertNil(t, err)
+			h.AssertError(t, img.Save(), "UNAVAILABLE")
+			h.AssertEq(t, atomic.LoadInt32(requests), int32(1))
+		})
+
+		it("reports the number of attempts when the policy is exhausted", func() {
+			server, requests := flakyRegistry(100)
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			repoName := u.Host + "/retry/image"
+
+			_, err = remote.NewImage(repoName, authn.DefaultKeychain,
+				remote.FromBaseImage(repoName),
+				remote.WithRetryPolicy(4, time.Millisecond),
+			)
+			h.AssertError(t, err, "failed after 4 attempts")
+			h.AssertEq(t, atomic.LoadInt32(requests) >= 4, true)
+		})
+
+		it("does not stack the retries of go-containerregistry on the policy", func() {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+			u, err := url.Parse(server.URL)
+			h.AssertNil(t, err)
+			repoName := u.Host + "/retry/image"
+
+			_, err = remote.NewImage(repoName, authn.DefaultKeychain,
+				remote.FromBaseImage(repoName),
+				remote.WithRetryPolicy(2, time.Millisecond),
+			)
+			h.AssertError(t, err, "failed after 2 attempts")
+			h.AssertEq(t, atomic.LoadInt32(&requests), int32(2))
+		})
+	})
+}
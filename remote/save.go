@@ -3,7 +3,9 @@ package remote
 import (
 	"fmt"
 
+	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 	"github.com/google/go-containerregistry/pkg/v1/static"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -34,13 +36,38 @@ func (i *Image) SaveAs(name string, additionalNames ...string) error {
 		if err = i.AddLayerWithHistory(emptyLayer, emptyHistory); err != nil {
 			return fmt.Errorf("adding empty layer: %w", err)
 		}
+		if i.canonicalJSON {
+			if i.Image, err = imgutil.CanonicalImage(i.Image); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err = i.EncryptLayers(); err != nil {
+		return err
+	}
+	if i.validateBeforePush {
+		violations, err := imgutil.ValidateImageSpec(i.CNBImageCore)
+		if err != nil {
+			return err
+		}
+		if len(violations) > 0 {
+			return imgutil.ErrSpecViolations{Name: name, Violations: violations}
+		}
 	}
 
 	// save
 	var diagnostics []imgutil.SaveDiagnostic
 	allNames := append([]string{name}, additionalNames...)
+	var size int64
+	if i.metrics != nil {
+		size, _ = i.TotalSize()
+	}
 	for _, n := range allNames {
-		if err := i.doSave(n); err != nil {
+		end := imgutil.StartOperation(i.metrics, imgutil.OperationPush, n)
+		err := i.doSave(n)
+		end(size, err)
+		if err != nil {
 			diagnostics = append(diagnostics, imgutil.SaveDiagnostic{ImageName: n, Cause: err})
 		}
 	}
@@ -52,13 +79,50 @@ func (i *Image) SaveAs(name string, additionalNames ...string) error {
 
 func (i *Image) doSave(imageName string) error {
 	reg := getRegistrySetting(i.repoName, i.registrySettings)
-	ref, auth, err := referenceForRepoName(i.keychain, imageName, reg.Insecure)
+	ref, auth, err := referenceForRepoName(i.keychain, imageName, reg)
 	if err != nil {
 		return err
 	}
 
-	return remote.Write(ref, i.CNBImageCore,
-		remote.WithAuth(auth),
-		remote.WithTransport(imgutil.GetTransport(reg.Insecure)),
-	)
+	remoteOpts := retryOptions(i.retryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, i.remoteOptions, i.logger)))
+	if i.remoteOptions.UploadConcurrency > 0 {
+		remoteOpts = append(remoteOpts, remote.WithJobs(i.remoteOptions.UploadConcurrency))
+	}
+	image := imgutil.ImageWithProgress(withMountableLayers(i.CNBImageCore, ref, i.layerOrigins), i.progressHandler)
+	if i.logger != nil {
+		if err = i.logPush(ref, image); err != nil {
+			return err
+		}
+	}
+	if err = i.uploadLargeLayers(ref, auth, reg, image); err != nil {
+		return err
+	}
+	if err = withRetry(i.retryPolicy, func() error {
+		return remote.Write(ref, image, remoteOpts...)
+	}); err != nil {
+		return err
+	}
+	i.remoteOptions.ManifestCache.Forget(ref)
+	return i.attachSBOMs(ref, remoteOpts)
+}
+
+// logPush reports the layers of the image that are pushed, unless the registry already has them, or mounted.
+func (i *Image) logPush(ref name.Reference, image v1.Image) error {
+	imgutil.Debugf(i.logger, "pushing %s to %s", ref.Name(), registryURL(ref))
+	layers, err := image.Layers()
+	if err != nil {
+		return err
+	}
+	for _, layer := range layers {
+		desc, err := partial.Descriptor(layer)
+		if err != nil {
+			return err
+		}
+		if mountable, ok := layer.(*remote.MountableLayer); ok && mountable.Reference.Context().RegistryStr() == ref.Context().RegistryStr() {
+			imgutil.Debugf(i.logger, "mounting layer %s from %s", desc.Digest, mountable.Reference.Context().Name())
+			continue
+		}
+		imgutil.Debugf(i.logger, "pushing layer %s (%d bytes)", desc.Digest, desc.Size)
+	}
+	return nil
 }
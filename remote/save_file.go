@@ -2,8 +2,19 @@ package remote
 
 import (
 	"errors"
+	"io"
+
+	"github.com/buildpacks/imgutil"
 )
 
 func (i *Image) SaveFile() (string, error) {
 	return "", errors.New("not yet implemented")
 }
+
+// SaveTo streams the image to w as an archive of the given format, tagged with the image name.
+func (i *Image) SaveTo(w io.Writer, format imgutil.ArchiveFormat) error {
+	if err := i.SetCreatedAtAndHistory(); err != nil {
+		return err
+	}
+	return imgutil.WriteArchive(w, i.CNBImageCore, i.Name(), format)
+}
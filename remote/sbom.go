@@ -0,0 +1,56 @@
+package remote
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// AddSBOM adds the SBOM to the image as a layer or, if the image was created with WithSBOMsAsReferrers,
+// records it to be attached to the image as a referrer artifact when the image is saved.
+func (i *Image) AddSBOM(mediaType string, content io.Reader) error {
+	if !i.sbomsAsReferrers {
+		return i.CNBImageCore.AddSBOM(mediaType, content)
+	}
+	contents, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("failed to read SBOM: %w", err)
+	}
+	i.sboms = append(i.sboms, sbom{mediaType: mediaType, content: contents})
+	return nil
+}
+
+// attachSBOMs pushes the recorded SBOMs to the repository of the given reference, referring to the saved image.
+func (i *Image) attachSBOMs(ref name.Reference, remoteOpts []remote.Option) error {
+	if len(i.sboms) == 0 {
+		return nil
+	}
+	mediaType, err := i.MediaType()
+	if err != nil {
+		return err
+	}
+	digest, err := i.Digest()
+	if err != nil {
+		return err
+	}
+	size, err := i.Size()
+	if err != nil {
+		return err
+	}
+	subject := v1.Descriptor{MediaType: mediaType, Digest: digest, Size: size}
+	for _, s := range i.sboms {
+		artifact, err := imgutil.NewSBOMArtifact(s.mediaType, s.content)
+		if err != nil {
+			return err
+		}
+		if _, err = attachArtifact(ref.Context(), subject, artifact, s.mediaType, i.retryPolicy, remoteOpts); err != nil {
+			return fmt.Errorf("failed to attach SBOM %s: %w", s.mediaType, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package remote
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/buildpacks/imgutil"
+)
+
+const (
+	// SimpleSigningMediaType is the media type of the layers of a cosign signature image, holding the signed payload.
+	SimpleSigningMediaType types.MediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+
+	cosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	cosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation       = "dev.sigstore.cosign/chain"
+	cosignSignatureType         = "cosign container image signature"
+)
+
+// Signature is the result of signing the payload of an image signature.
+type Signature struct {
+	// Value is the raw signature of the payload.
+	Value []byte
+	// Certificate and Chain are the PEM-encoded signing certificate and its chain, if the signature is keyless.
+	Certificate []byte
+	Chain       []byte
+}
+
+// SignFunc signs the given payload, e.g. with a KMS key or a local private key.
+type SignFunc func(payload []byte) (Signature, error)
+
+// SignImage signs the image with the given digest reference and pushes the signature to the `sha256-<hex>.sig` tag
+// in the repository of the image, in the layout expected by cosign, so that it can be verified with `cosign verify`.
+// Signatures already pushed to the tag are kept; signing the same image twice with the same signature does nothing.
+// Image references with a tag are resolved to the digest of the image they point to.
+func SignImage(imageRef string, sign SignFunc, keychain authn.Keychain, ops ...imgutil.ImageOption) (name.Tag, error) {
+	options, err := newOptions(ops)
+	if err != nil {
+		return name.Tag{}, err
+	}
+	reg := getRegistrySetting(imageRef, options.RegistrySettings)
+	ref, auth, err := referenceForRepoName(keychain, imageRef, reg)
+	if err != nil {
+		return name.Tag{}, err
+	}
+	remoteOpts := retryOptions(options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, options.RemoteOptions, options.Logger)))
+
+	digest, ok := ref.(name.Digest)
+	if !ok {
+		desc, err := headWithRetry(ref, options.RetryPolicy, remoteOpts)
+		if err != nil {
+			return name.Tag{}, fmt.Errorf("failed to get image %s: %w", imageRef, err)
+		}
+		digest = ref.Context().Digest(desc.Digest.String())
+	}
+	hash, err := v1.NewHash(digest.DigestStr())
+	if err != nil {
+		return name.Tag{}, err
+	}
+
+	payload, err := signaturePayload(ref.Context().Name(), hash)
+	if err != nil {
+		return name.Tag{}, err
+	}
+	signature, err := sign(payload)
+	if err != nil {
+		return name.Tag{}, fmt.Errorf("failed to sign image %s: %w", digest, err)
+	}
+	annotations := map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature.Value)}
+	if len(signature.Certificate) > 0 {
+		annotations[cosignCertificateAnnotation] = string(signature.Certificate)
+	}
+	if len(signature.Chain) > 0 {
+		annotations[cosignChainAnnotation] = string(signature.Chain)
+	}
+
+	tag := ref.Context().Tag(fmt.Sprintf("%s-%s.sig", hash.Algorithm, hash.Hex))
+	err = withRetry(options.RetryPolicy, func() error {
+		signatures, err := signatureImage(tag, remoteOpts)
+		if err != nil {
+			return err
+		}
+		layer := static.NewLayer(payload, SimpleSigningMediaType)
+		if found, err := hasSignature(signatures, layer, annotations[cosignSignatureAnnotation]); err != nil || found {
+			return err
+		}
+		if signatures, err = mutate.Append(signatures, mutate.Addendum{
+			Layer:       layer,
+			MediaType:   SimpleSigningMediaType,
+			Annotations: annotations,
+		}); err != nil {
+			return err
+		}
+		return remote.Write(tag, signatures, remoteOpts...)
+	})
+	return tag, err
+}
+
+// signaturePayload returns the simple signing payload for the image, as produced by cosign.
+func signaturePayload(repoName string, digest v1.Hash) ([]byte, error) {
+	type critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	}
+	payload := struct {
+		Critical critical          `json:"critical"`
+		Optional map[string]string `json:"optional"`
+	}{}
+	payload.Critical.Identity.DockerReference = repoName
+	payload.Critical.Image.DockerManifestDigest = digest.String()
+	payload.Critical.Type = cosignSignatureType
+	return json.Marshal(payload)
+}
+
+// signatureImage returns the signatures already pushed to the tag, or an empty signature image.
+func signatureImage(tag name.Tag, remoteOpts []remote.Option) (v1.Image, error) {
+	image, err := remote.Image(tag, remoteOpts...)
+	if err == nil {
+		return image, nil
+	}
+	var terr *transport.Error
+	if !errors.As(err, &terr) || terr.StatusCode != http.StatusNotFound {
+		return nil, err
+	}
+	image = mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	return mutate.ConfigMediaType(image, types.OCIConfigJSON), nil
+}
+
+func hasSignature(signatures v1.Image, layer v1.Layer, signature string) (bool, error) {
+	digest, err := layer.Digest()
+	if err != nil {
+		return false, err
+	}
+	manifest, err := signatures.Manifest()
+	if err != nil {
+		return false, err
+	}
+	for _, desc := range manifest.Layers {
+		if desc.Digest == digest && desc.Annotations[cosignSignatureAnnotation] == signature {
+			return true, nil
+		}
+	}
+	return false, nil
+}
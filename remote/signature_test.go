@@ -0,0 +1,131 @@
+package remote_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestSignature(t *testing.T) {
+	spec.Run(t, "Signature", testSignature, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testSignature(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server     *httptest.Server
+		repoName   string
+		digest     v1.Hash
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+		sign       remote.SignFunc
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		repoName = u.Host + "/signature/image"
+
+		image, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		ref, err := name.ParseReference(repoName + ":latest")
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(ref, image))
+		digest, err = image.Digest()
+		h.AssertNil(t, err)
+
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		h.AssertNil(t, err)
+		sign = func(payload []byte) (remote.Signature, error) {
+			return remote.Signature{Value: ed25519.Sign(privateKey, payload)}, nil
+		}
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	signatureLayers := func(tag name.Tag) (*v1.Manifest, []v1.Layer) {
+		signatures, err := ggcrremote.Image(tag)
+		h.AssertNil(t, err)
+		manifest, err := signatures.Manifest()
+		h.AssertNil(t, err)
+		layers, err := signatures.Layers()
+		h.AssertNil(t, err)
+		return manifest, layers
+	}
+
+	when("#SignImage", func() {
+		it("pushes a cosign signature for the image", func() {
+			tag, err := remote.SignImage(repoName+":latest", sign, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			h.AssertEq(t, tag.TagStr(), "sha256-"+digest.Hex+".sig")
+
+			manifest, layers := signatureLayers(tag)
+			h.AssertEq(t, len(manifest.Layers), 1)
+			h.AssertEq(t, manifest.Layers[0].MediaType, remote.SimpleSigningMediaType)
+
+			rc, err := layers[0].Uncompressed()
+			h.AssertNil(t, err)
+			defer rc.Close()
+			payload, err := io.ReadAll(rc)
+			h.AssertNil(t, err)
+			var simpleSigning struct {
+				Critical struct {
+					Identity struct {
+						DockerReference string `json:"docker-reference"`
+					} `json:"identity"`
+					Image struct {
+						DockerManifestDigest string `json:"docker-manifest-digest"`
+					} `json:"image"`
+					Type string `json:"type"`
+				} `json:"critical"`
+			}
+			h.AssertNil(t, json.Unmarshal(payload, &simpleSigning))
+			h.AssertEq(t, simpleSigning.Critical.Identity.DockerReference, repoName)
+			h.AssertEq(t, simpleSigning.Critical.Image.DockerManifestDigest, digest.String())
+			h.AssertEq(t, simpleSigning.Critical.Type, "cosign container image signature")
+
+			signature, err := base64.StdEncoding.DecodeString(manifest.Layers[0].Annotations["dev.cosignproject.cosign/signature"])
+			h.AssertNil(t, err)
+			h.AssertEq(t, ed25519.Verify(publicKey, payload, signature), true)
+		})
+
+		it("keeps existing signatures and does not duplicate them", func() {
+			digestRef := repoName + "@" + digest.String()
+			tag, err := remote.SignImage(digestRef, sign, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			_, err = remote.SignImage(digestRef, sign, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			manifest, _ := signatureLayers(tag)
+			h.AssertEq(t, len(manifest.Layers), 1)
+
+			_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+			h.AssertNil(t, err)
+			_, err = remote.SignImage(digestRef, func(payload []byte) (remote.Signature, error) {
+				return remote.Signature{Value: ed25519.Sign(otherKey, payload), Certificate: []byte("some-certificate")}, nil
+			}, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			manifest, _ = signatureLayers(tag)
+			h.AssertEq(t, len(manifest.Layers), 2)
+			h.AssertEq(t, manifest.Layers[1].Annotations["dev.sigstore.cosign/certificate"], "some-certificate")
+		})
+	})
+}
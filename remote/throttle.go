@@ -0,0 +1,113 @@
+package remote
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/buildpacks/imgutil"
+)
+
+const (
+	defaultRateLimitAttempts = 3
+	defaultRateLimitWait     = time.Second
+	defaultRateLimitMaxWait  = time.Minute
+)
+
+// ErrRateLimited is returned when a registry kept answering a request with 429 Too Many Requests
+// until the rate limit policy was exhausted, or asked to wait longer than the policy allows.
+type ErrRateLimited struct {
+	Registry string
+	Attempts int
+	// RetryAfter is the wait asked for by the Retry-After header of the last response, if any.
+	RetryAfter time.Duration
+}
+
+func (e ErrRateLimited) Error() string {
+	msg := fmt.Sprintf("rate limited by registry %s after %d attempts", e.Registry, e.Attempts)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf("; retry after %s", e.RetryAfter)
+	}
+	return msg
+}
+
+func processRateLimitPolicy(requestedPolicy imgutil.RateLimitPolicy) imgutil.RateLimitPolicy {
+	policy := requestedPolicy
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = defaultRateLimitAttempts
+	}
+	if policy.MaxWait <= 0 {
+		policy.MaxWait = defaultRateLimitMaxWait
+	}
+	return policy
+}
+
+// throttledTransport sends requests rejected with 429 Too Many Requests again after the wait asked for by their
+// Retry-After header, or an exponential backoff if there is none. Requests with a body that cannot be sent again,
+// such as streamed blob uploads, are not retried. When the policy is exhausted, it fails with ErrRateLimited,
+// which is not retried by withRetry.
+type throttledTransport struct {
+	base   http.RoundTripper
+	policy imgutil.RateLimitPolicy
+	logger imgutil.Logger
+}
+
+func withRateLimitRetries(base http.RoundTripper, options imgutil.RemoteOptions, logger imgutil.Logger) http.RoundTripper {
+	return &throttledTransport{
+		base:   base,
+		policy: processRateLimitPolicy(options.RateLimitPolicy),
+		logger: logger,
+	}
+}
+
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+			return resp, err
+		}
+		resp.Body.Close()
+
+		retryAfter, hasRetryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		wait := retryAfter
+		if !hasRetryAfter {
+			wait = backoffFor(imgutil.RetryPolicy{Backoff: defaultRateLimitWait}, attempt)
+		}
+		replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if attempt >= t.policy.MaxAttempts || wait > t.policy.MaxWait || !replayable {
+			return nil, ErrRateLimited{Registry: req.URL.Host, Attempts: attempt, RetryAfter: retryAfter}
+		}
+		imgutil.Debugf(t.logger, "rate limited by registry %s, attempt %d of %d, retrying in %s", req.URL.Host, attempt, t.policy.MaxAttempts, wait)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// parseRetryAfter returns the wait asked for by a Retry-After header, given in seconds or as an HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
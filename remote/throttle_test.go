@@ -0,0 +1,103 @@
+package remote_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestThrottle(t *testing.T) {
+	spec.Run(t, "Throttle", testThrottle, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testThrottle(t *testing.T, when spec.G, it spec.S) {
+	var (
+		host        string
+		limited     int32
+		retryAfter  atomic.Value
+		rateLimited int32
+	)
+
+	it.Before(func() {
+		reg := registry.New()
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.Contains(r.URL.Path, "/manifests/") && atomic.AddInt32(&rateLimited, 1) <= atomic.LoadInt32(&limited) {
+				w.Header().Set("Retry-After", retryAfter.Load().(string))
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			reg.ServeHTTP(w, r)
+		}))
+		it.After(server.Close)
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+		pushRandomImage(t, host+"/throttle/base")
+		atomic.StoreInt32(&rateLimited, 0)
+		retryAfter.Store("0")
+	})
+
+	when("#WithRateLimitPolicy", func() {
+		it("sends rate limited requests again after the wait asked for", func() {
+			atomic.StoreInt32(&limited, 2)
+			img, err := remote.NewImage(host+"/throttle/app", authn.DefaultKeychain,
+				remote.FromBaseImage(host+"/throttle/base"),
+				remote.WithRateLimitPolicy(3, time.Second),
+			)
+			h.AssertNil(t, err)
+			_, err = img.TopLayer()
+			h.AssertNil(t, err)
+			h.AssertEq(t, atomic.LoadInt32(&rateLimited) > 2, true)
+		})
+
+		it("reports the rate limited requests to the logger of the image", func() {
+			atomic.StoreInt32(&limited, 1)
+			logger := &recordingLogger{}
+			_, err := remote.NewImage(host+"/throttle/app", authn.DefaultKeychain,
+				remote.FromBaseImage(host+"/throttle/base"),
+				remote.WithRateLimitPolicy(3, time.Second),
+				imgutil.WithLogger(logger),
+			)
+			h.AssertNil(t, err)
+			h.AssertEq(t, logger.contains("rate limited by registry "+host), true)
+		})
+
+		it("fails with ErrRateLimited when the attempts are exhausted", func() {
+			atomic.StoreInt32(&limited, 100)
+			_, err := remote.NewImage(host+"/throttle/app", authn.DefaultKeychain,
+				remote.FromBaseImage(host+"/throttle/base"),
+				remote.WithRateLimitPolicy(2, time.Second),
+			)
+			var rateLimitErr remote.ErrRateLimited
+			h.AssertEq(t, errors.As(err, &rateLimitErr), true)
+			h.AssertEq(t, rateLimitErr.Registry, host)
+			h.AssertEq(t, rateLimitErr.Attempts, 2)
+		})
+
+		it("fails without waiting when the registry asks to wait longer than allowed", func() {
+			atomic.StoreInt32(&limited, 100)
+			retryAfter.Store("3600")
+			start := time.Now()
+			_, err := remote.NewImage(host+"/throttle/app", authn.DefaultKeychain,
+				remote.FromBaseImage(host+"/throttle/base"),
+				remote.WithRateLimitPolicy(3, time.Second),
+			)
+			h.AssertError(t, err, "retry after 1h0m0s")
+			h.AssertEq(t, time.Since(start) < 10*time.Second, true)
+		})
+	})
+}
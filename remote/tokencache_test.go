@@ -0,0 +1,90 @@
+package remote_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestTokenCache(t *testing.T) {
+	spec.Run(t, "TokenCache", testTokenCache, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// tokenRegistry returns a registry that requires a bearer token, obtained from its `/token` endpoint,
+// and counts the requests for tokens.
+func tokenRegistry() (*httptest.Server, *int32) {
+	var tokenRequests int32
+	reg := registry.New()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			atomic.AddInt32(&tokenRequests, 1)
+			fmt.Fprint(w, `{"token":"some-token","expires_in":300}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer some-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reg.ServeHTTP(w, r)
+	}))
+	return server, &tokenRequests
+}
+
+func testTokenCache(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server        *httptest.Server
+		tokenRequests *int32
+		repoName      string
+	)
+
+	it.Before(func() {
+		server, tokenRequests = tokenRegistry()
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		repoName = u.Host + "/token-cache/image"
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	when("#WithTokenCache", func() {
+		it("reuses tokens across the operations sharing the cache", func() {
+			cache := imgutil.NewTokenCache()
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.WithTokenCache(cache))
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.Save(repoName+":other-tag", repoName+":another-tag"))
+			h.AssertEq(t, atomic.LoadInt32(tokenRequests), int32(1))
+
+			other, err := remote.NewImage(repoName, authn.DefaultKeychain, remote.WithTokenCache(cache))
+			h.AssertNil(t, err)
+			h.AssertNil(t, other.Save())
+			h.AssertEq(t, atomic.LoadInt32(tokenRequests), int32(1))
+
+			// tokens are scoped, so pulling needs another token
+			h.AssertEq(t, other.Found(), true)
+			h.AssertEq(t, atomic.LoadInt32(tokenRequests), int32(2))
+		})
+
+		it("authenticates for each operation without a cache", func() {
+			img, err := remote.NewImage(repoName, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			h.AssertNil(t, img.Save(repoName+":other-tag"))
+			h.AssertEq(t, atomic.LoadInt32(tokenRequests) > 1, true)
+		})
+	})
+}
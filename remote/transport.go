@@ -0,0 +1,83 @@
+package remote
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/buildpacks/imgutil"
+)
+
+// getTransport returns the transport for a registry with the given setting, which answers token requests from the token cache,
+// if one is given. It is the transport provided with WithTransport, or the default one, with the proxy of the registry,
+// the root CAs provided with WithRootCAs or WithCAFile, and without TLS verification for insecure registries;
+// only *http.Transport values can be configured so. Requests sent again because of rate limits are reported to the logger.
+func getTransport(reg imgutil.RegistrySetting, options imgutil.RemoteOptions, logger imgutil.Logger) http.RoundTripper {
+	base := options.Transport
+	customTLS := options.RootCAs != nil || options.CAFile != ""
+	if base == nil && reg.Proxy == nil && !customTLS {
+		return options.TokenCache.Transport(withRateLimitRetries(withRateLimits(imgutil.GetTransport(reg.Insecure), options), options, logger))
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if httpTransport, ok := base.(*http.Transport); ok && (reg.Insecure || reg.Proxy != nil || customTLS) {
+		httpTransport = httpTransport.Clone()
+		if reg.Proxy != nil {
+			httpTransport.Proxy = http.ProxyURL(reg.Proxy)
+		}
+		if httpTransport.TLSClientConfig == nil {
+			httpTransport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		if customTLS {
+			rootCAs, err := rootCAs(options)
+			if err != nil {
+				return errTransport{err: err}
+			}
+			httpTransport.TLSClientConfig.RootCAs = rootCAs
+		}
+		if reg.Insecure {
+			httpTransport.TLSClientConfig.InsecureSkipVerify = true // #nosec G402
+		}
+		base = httpTransport
+	}
+	return options.TokenCache.Transport(withRateLimitRetries(withRateLimits(base, options), options, logger))
+}
+
+// getReadTransport returns the transport of getTransport, which also answers requests for manifests and configs
+// from the manifest cache, if one is given. It is only used to read images, such as the base and previous images,
+// so that images are never pushed through the cache.
+func getReadTransport(reg imgutil.RegistrySetting, options imgutil.RemoteOptions, logger imgutil.Logger) http.RoundTripper {
+	return options.ManifestCache.Transport(getTransport(reg, options, logger))
+}
+
+// rootCAs returns the pool given with WithRootCAs, or the system pool with the certificates of the file given with WithCAFile.
+func rootCAs(options imgutil.RemoteOptions) (*x509.CertPool, error) {
+	if options.RootCAs != nil {
+		return options.RootCAs, nil
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	pem, err := os.ReadFile(filepath.Clean(options.CAFile))
+	if err != nil {
+		return nil, fmt.Errorf("reading CA file: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in CA file %s", options.CAFile)
+	}
+	return pool, nil
+}
+
+// errTransport fails every request, for a transport that could not be configured.
+type errTransport struct {
+	err error
+}
+
+func (t errTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, t.err
+}
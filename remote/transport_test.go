@@ -0,0 +1,269 @@
+package remote_test
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestTransport(t *testing.T) {
+	spec.Run(t, "Transport", testTransport, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+type countingTransport struct {
+	requests atomic.Int64
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func testTransport(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server *httptest.Server
+		host   string
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	when("#WithTransport", func() {
+		it("accesses the registry with the transport", func() {
+			rt := &countingTransport{}
+			image, err := remote.NewImage(host+"/transport/app", authn.DefaultKeychain, remote.WithTransport(rt))
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.Save())
+			h.AssertEq(t, rt.requests.Load() > 0, true)
+		})
+
+		it("loads and pushes indexes with the transport", func() {
+			index, err := random.Index(100, 1, 1)
+			h.AssertNil(t, err)
+			ref, err := name.ParseReference(host + "/transport/index")
+			h.AssertNil(t, err)
+			h.AssertNil(t, ggcrremote.WriteIndex(ref, index))
+
+			rt := &countingTransport{}
+			loaded, err := remote.NewIndex(ref.Name(), imgutil.FromBaseIndex(ref.Name()), imgutil.WithXDGRuntimePath(t.TempDir()),
+				remote.WithIndexRemoteOptions(remote.WithTransport(rt)))
+			h.AssertNil(t, err)
+			loads := rt.requests.Load()
+			h.AssertEq(t, loads > 0, true)
+
+			h.AssertNil(t, loaded.Push())
+			h.AssertEq(t, rt.requests.Load() > loads, true)
+		})
+
+		it("fails to create an index with invalid remote options", func() {
+			_, err := remote.NewIndex(host+"/transport/index", remote.WithIndexRemoteOptions(imgutil.WithGzipLevel(10)))
+			h.AssertError(t, err, "invalid gzip level")
+		})
+	})
+
+	when("#WithRegistryProxy", func() {
+		it("accesses the registry through the proxy", func() {
+			var (
+				proxied       atomic.Int64
+				authorization atomic.Value
+			)
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				proxied.Add(1)
+				authorization.Store(req.Header.Get("Proxy-Authorization"))
+				req.Header.Del("Proxy-Authorization")
+				server.Config.Handler.ServeHTTP(w, req)
+			}))
+			defer proxy.Close()
+			proxyURL, err := url.Parse(proxy.URL)
+			h.AssertNil(t, err)
+			proxyURL.User = url.UserPassword("user", "password")
+
+			image, err := remote.NewImage(host+"/transport/app", authn.DefaultKeychain, remote.WithRegistryProxy(host, proxyURL))
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.Save())
+			h.AssertEq(t, proxied.Load() > 0, true)
+			h.AssertEq(t, authorization.Load(), "Basic dXNlcjpwYXNzd29yZA==")
+		})
+	})
+	when("#WithUploadRateLimit", func() {
+		it("limits the bandwidth of uploads", func() {
+			image, err := remote.NewImage(host+"/transport/app", authn.DefaultKeychain, remote.WithUploadRateLimit(2<<20))
+			h.AssertNil(t, err)
+			layer, err := random.Layer(1<<20, types.OCILayer)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{}))
+
+			start := time.Now()
+			h.AssertNil(t, image.Save())
+			// 1MiB at 2MiB/s, less the initial burst of 0.2MiB
+			h.AssertEq(t, time.Since(start) > 350*time.Millisecond, true)
+		})
+	})
+
+	// saveBase saves a base image with a random layer of the given size, returning the diff ID of the layer.
+	saveBase := func(size int64) v1.Hash {
+		image, err := remote.NewImage(host+"/transport/base", authn.DefaultKeychain)
+		h.AssertNil(t, err)
+		layer, err := random.Layer(size, types.OCILayer)
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{}))
+		h.AssertNil(t, image.Save())
+		diffID, err := layer.DiffID()
+		h.AssertNil(t, err)
+		return diffID
+	}
+
+	readLayer := func(image *remote.Image, diffID v1.Hash) error {
+		rc, err := image.GetLayer(diffID.String())
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		_, err = io.Copy(io.Discard, rc)
+		return err
+	}
+
+	when("#WithUploadConcurrency", func() {
+		// saveLayers saves an image with the given number of layers to a registry that records the most blob uploads in flight
+		saveLayers := func(layerCount int, ops ...imgutil.ImageOption) int64 {
+			var inFlight, maxInFlight atomic.Int64
+			uploads := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == http.MethodPatch || (req.Method == http.MethodPut && strings.Contains(req.URL.Path, "/blobs/uploads/")) {
+					n := inFlight.Add(1)
+					for {
+						current := maxInFlight.Load()
+						if n <= current || maxInFlight.CompareAndSwap(current, n) {
+							break
+						}
+					}
+					time.Sleep(50 * time.Millisecond)
+					defer inFlight.Add(-1)
+				}
+				server.Config.Handler.ServeHTTP(w, req)
+			}))
+			defer uploads.Close()
+			u, err := url.Parse(uploads.URL)
+			h.AssertNil(t, err)
+
+			image, err := remote.NewImage(u.Host+"/transport/app", authn.DefaultKeychain, ops...)
+			h.AssertNil(t, err)
+			for idx := 0; idx < layerCount; idx++ {
+				layer, err := random.Layer(1024, types.OCILayer)
+				h.AssertNil(t, err)
+				h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{}))
+			}
+			h.AssertNil(t, image.Save())
+			return maxInFlight.Load()
+		}
+
+		it("uploads the layers in parallel", func() {
+			h.AssertEq(t, saveLayers(6, remote.WithUploadConcurrency(6)) > 1, true)
+		})
+
+		it("uploads the layers one at a time with a concurrency of one", func() {
+			h.AssertEq(t, saveLayers(6, remote.WithUploadConcurrency(1)), int64(1))
+		})
+	})
+
+	when("#WithDownloadRateLimit", func() {
+		it("limits the bandwidth of downloads", func() {
+			diffID := saveBase(1 << 20)
+			image, err := remote.NewImage(host+"/transport/app", authn.DefaultKeychain, remote.FromBaseImage(host+"/transport/base"), remote.WithDownloadRateLimit(2<<20))
+			h.AssertNil(t, err)
+
+			start := time.Now()
+			h.AssertNil(t, readLayer(image, diffID))
+			// 1MiB at 2MiB/s, less the initial burst of 0.2MiB
+			h.AssertEq(t, time.Since(start) > 350*time.Millisecond, true)
+		})
+	})
+
+	when("#WithDownloadBudget", func() {
+		it("fails downloads that would exceed the budget", func() {
+			diffID := saveBase(1 << 20)
+			image, err := remote.NewImage(host+"/transport/app", authn.DefaultKeychain, remote.FromBaseImage(host+"/transport/base"), remote.WithDownloadBudget(64<<10))
+			h.AssertNil(t, err)
+
+			var budgetErr imgutil.ErrByteBudgetExceeded
+			h.AssertEq(t, errors.As(readLayer(image, diffID), &budgetErr), true)
+			h.AssertEq(t, budgetErr.Limit, int64(64<<10))
+		})
+
+		it("allows downloads within the budget", func() {
+			diffID := saveBase(1 << 10)
+			image, err := remote.NewImage(host+"/transport/app", authn.DefaultKeychain, remote.FromBaseImage(host+"/transport/base"), remote.WithDownloadBudget(64<<10))
+			h.AssertNil(t, err)
+			h.AssertNil(t, readLayer(image, diffID))
+		})
+	})
+
+	when("#WithRootCAs", func() {
+		var (
+			tlsServer *httptest.Server
+			tlsHost   string
+		)
+
+		it.Before(func() {
+			tlsServer = httptest.NewTLSServer(registry.New())
+			u, err := url.Parse(tlsServer.URL)
+			h.AssertNil(t, err)
+			tlsHost = u.Host
+		})
+
+		it.After(func() {
+			tlsServer.Close()
+		})
+
+		it("trusts registries with certificates issued by the CAs", func() {
+			pool := x509.NewCertPool()
+			pool.AddCert(tlsServer.Certificate())
+			image, err := remote.NewImage(tlsHost+"/transport/app", authn.DefaultKeychain, remote.WithRootCAs(pool))
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.Save())
+
+			image, err = remote.NewImage(tlsHost+"/transport/app", authn.DefaultKeychain)
+			h.AssertNil(t, err)
+			h.AssertError(t, image.Save(), "certificate")
+		})
+
+		it("trusts the CAs of a CA file", func() {
+			caFile := filepath.Join(t.TempDir(), "ca.pem")
+			h.AssertNil(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}), 0600))
+			image, err := remote.NewImage(tlsHost+"/transport/app", authn.DefaultKeychain, remote.WithCAFile(caFile))
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.Save())
+		})
+	})
+}
@@ -0,0 +1,162 @@
+package remote
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	"github.com/buildpacks/imgutil"
+)
+
+const (
+	// TrustMetadataMediaType is the artifact type of trust metadata artifacts, and the media type of their single layer.
+	TrustMetadataMediaType types.MediaType = "application/vnd.buildpacks.imgutil.trust.v1+json"
+
+	trustSignatureAnnotation = "io.buildpacks.imgutil.trust.signature"
+)
+
+// TrustStore is an imgutil.TrustStore backed by a trust metadata artifact in a registry, pushed with PushTrustMetadata.
+// The artifact is fetched once, when a digest is first checked.
+type TrustStore struct {
+	ref      string
+	keychain authn.Keychain
+	verify   imgutil.TrustVerifyFunc
+	options  imgutil.RemoteOptions
+	logger   imgutil.Logger
+
+	once     sync.Once
+	metadata imgutil.TrustMetadata
+	err      error
+}
+
+// NewTrustStore returns a TrustStore backed by the trust metadata artifact with the given reference.
+// If verify is not nil, the metadata must have a valid signature.
+// Registry settings, the retry policy and the token cache are taken from the provided options.
+func NewTrustStore(ref string, keychain authn.Keychain, verify imgutil.TrustVerifyFunc, ops ...imgutil.ImageOption) *TrustStore {
+	options, err := newOptions(ops)
+	if err != nil {
+		// the store fails when its metadata is first read, as the signature of NewTrustStore cannot return the error
+		store := &TrustStore{ref: ref, keychain: keychain, verify: verify}
+		store.once.Do(func() { store.err = err })
+		return store
+	}
+	return &TrustStore{ref: ref, keychain: keychain, verify: verify, options: options.RemoteOptions, logger: options.Logger}
+}
+
+// Metadata returns the trust metadata in the artifact, once its signature is verified.
+func (s *TrustStore) Metadata() (imgutil.TrustMetadata, error) {
+	s.once.Do(func() {
+		s.metadata, s.err = s.fetch()
+	})
+	return s.metadata, s.err
+}
+
+func (s *TrustStore) Approved(repository string, digest v1.Hash) (bool, error) {
+	metadata, err := s.Metadata()
+	if err != nil {
+		return false, err
+	}
+	return metadata.IsApproved(repository, digest), nil
+}
+
+func (s *TrustStore) fetch() (imgutil.TrustMetadata, error) {
+	reg := getRegistrySetting(s.ref, s.options.RegistrySettings)
+	ref, auth, err := referenceForRepoName(s.keychain, s.ref, reg)
+	if err != nil {
+		return imgutil.TrustMetadata{}, err
+	}
+	var artifact v1.Image
+	err = withRetry(s.options.RetryPolicy, func() error {
+		artifact, err = remote.Image(ref, retryOptions(s.options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, s.options, s.logger)))...)
+		return err
+	})
+	if err != nil {
+		return imgutil.TrustMetadata{}, fmt.Errorf("failed to get trust metadata %s: %w", s.ref, err)
+	}
+	manifest, err := artifact.Manifest()
+	if err != nil {
+		return imgutil.TrustMetadata{}, err
+	}
+	if len(manifest.Layers) != 1 || manifest.Layers[0].MediaType != TrustMetadataMediaType {
+		return imgutil.TrustMetadata{}, fmt.Errorf("%s is not a trust metadata artifact", s.ref)
+	}
+	desc := manifest.Layers[0]
+	signature, err := base64.StdEncoding.DecodeString(desc.Annotations[trustSignatureAnnotation])
+	if err != nil {
+		return imgutil.TrustMetadata{}, fmt.Errorf("decoding trust metadata signature: %w", err)
+	}
+	layer, err := artifact.LayerByDigest(desc.Digest)
+	if err != nil {
+		return imgutil.TrustMetadata{}, err
+	}
+	rc, err := layer.Compressed()
+	if err != nil {
+		return imgutil.TrustMetadata{}, err
+	}
+	defer rc.Close()
+	payload, err := io.ReadAll(rc)
+	if err != nil {
+		return imgutil.TrustMetadata{}, err
+	}
+	return imgutil.ParseTrustMetadata(payload, signature, s.verify)
+}
+
+// PushTrustMetadata pushes the trust metadata as an artifact with the given reference, to be read by a TrustStore,
+// signed with sign if it is not nil. It returns the digest reference of the artifact.
+func PushTrustMetadata(ref string, metadata imgutil.TrustMetadata, sign imgutil.TrustSignFunc, keychain authn.Keychain, ops ...imgutil.ImageOption) (name.Digest, error) {
+	options, err := newOptions(ops)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	payload, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return name.Digest{}, err
+	}
+	annotations := map[string]string{}
+	if sign != nil {
+		signature, err := sign(payload)
+		if err != nil {
+			return name.Digest{}, fmt.Errorf("signing trust metadata: %w", err)
+		}
+		annotations[trustSignatureAnnotation] = base64.StdEncoding.EncodeToString(signature)
+	}
+
+	artifact := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	artifact = mutate.ConfigMediaType(artifact, TrustMetadataMediaType)
+	artifact, err = mutate.Append(artifact, mutate.Addendum{
+		Layer:       static.NewLayer(payload, TrustMetadataMediaType),
+		MediaType:   TrustMetadataMediaType,
+		Annotations: annotations,
+	})
+	if err != nil {
+		return name.Digest{}, err
+	}
+	digest, err := artifact.Digest()
+	if err != nil {
+		return name.Digest{}, err
+	}
+
+	reg := getRegistrySetting(ref, options.RegistrySettings)
+	parsed, auth, err := referenceForRepoName(keychain, ref, reg)
+	if err != nil {
+		return name.Digest{}, err
+	}
+	err = withRetry(options.RetryPolicy, func() error {
+		return remote.Write(parsed, artifact, retryOptions(options.RetryPolicy, remote.WithAuth(auth), remote.WithTransport(getTransport(reg, options.RemoteOptions, options.Logger)))...)
+	})
+	if err != nil {
+		return name.Digest{}, fmt.Errorf("failed to push trust metadata %s: %w", ref, err)
+	}
+	return parsed.Context().Digest(digest.String()), nil
+}
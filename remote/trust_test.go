@@ -0,0 +1,146 @@
+package remote_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	ggcrremote "github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/remote"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestTrust(t *testing.T) {
+	spec.Run(t, "Trust", testTrust, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testTrust(t *testing.T, when spec.G, it spec.S) {
+	var (
+		server     *httptest.Server
+		host       string
+		baseName   string
+		trustName  string
+		baseRef    name.Digest
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+		verify     imgutil.TrustVerifyFunc
+	)
+
+	it.Before(func() {
+		server = httptest.NewServer(registry.New())
+		u, err := url.Parse(server.URL)
+		h.AssertNil(t, err)
+		host = u.Host
+		baseName = host + "/trust/base:latest"
+		trustName = host + "/trust/metadata:latest"
+
+		image, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		ref, err := name.ParseReference(baseName)
+		h.AssertNil(t, err)
+		h.AssertNil(t, ggcrremote.Write(ref, image))
+		digest, err := image.Digest()
+		h.AssertNil(t, err)
+		baseRef = ref.Context().Digest(digest.String())
+
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		h.AssertNil(t, err)
+		verify = func(payload, signature []byte) error {
+			if !ed25519.Verify(publicKey, payload, signature) {
+				return errors.New("invalid signature")
+			}
+			return nil
+		}
+	})
+
+	it.After(func() {
+		server.Close()
+	})
+
+	sign := func(payload []byte) ([]byte, error) {
+		return ed25519.Sign(privateKey, payload), nil
+	}
+
+	newImage := func() (*remote.Image, error) {
+		return remote.NewImage(host+"/trust/app", authn.DefaultKeychain,
+			remote.FromBaseImage(baseName),
+			imgutil.WithTrustStore(remote.NewTrustStore(trustName, authn.DefaultKeychain, verify)),
+		)
+	}
+
+	when("the base image digest is approved", func() {
+		it("creates the image from the pinned base image", func() {
+			var metadata imgutil.TrustMetadata
+			metadata.Approve(baseRef)
+			_, err := remote.PushTrustMetadata(trustName, metadata, sign, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			image, err := newImage()
+			h.AssertNil(t, err)
+			pinned, ok := image.PinnedBaseImage()
+			h.AssertEq(t, ok, true)
+			h.AssertEq(t, pinned.String(), baseRef.String())
+		})
+	})
+
+	when("the base image digest is not approved", func() {
+		it("returns an ErrUntrustedBaseImage", func() {
+			var metadata imgutil.TrustMetadata
+			otherRef, err := name.NewDigest(baseRef.Context().Name() + "@sha256:b9d056b83bb6446fee29e89a7fcf10203c562c1f59586a6e2f39c903597bda34")
+			h.AssertNil(t, err)
+			metadata.Approve(otherRef)
+			_, err = remote.PushTrustMetadata(trustName, metadata, sign, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			_, err = newImage()
+			var untrusted imgutil.ErrUntrustedBaseImage
+			h.AssertEq(t, errors.As(err, &untrusted), true)
+			h.AssertEq(t, untrusted.Repository, baseRef.Context().Name())
+		})
+	})
+
+	when("the base image is not found", func() {
+		it("returns an ErrUntrustedBaseImage", func() {
+			var metadata imgutil.TrustMetadata
+			metadata.Approve(baseRef)
+			_, err := remote.PushTrustMetadata(trustName, metadata, sign, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			_, err = remote.NewImage(host+"/trust/app", authn.DefaultKeychain,
+				remote.FromBaseImage(host+"/trust/missing:latest"),
+				imgutil.WithTrustStore(remote.NewTrustStore(trustName, authn.DefaultKeychain, verify)),
+			)
+			var untrusted imgutil.ErrUntrustedBaseImage
+			h.AssertEq(t, errors.As(err, &untrusted), true)
+			h.AssertEq(t, len(untrusted.Digests), 0)
+			h.AssertError(t, err, "was not found")
+		})
+	})
+
+	when("the trust metadata is not signed with the expected key", func() {
+		it("returns an error", func() {
+			var metadata imgutil.TrustMetadata
+			metadata.Approve(baseRef)
+			_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+			h.AssertNil(t, err)
+			_, err = remote.PushTrustMetadata(trustName, metadata, func(payload []byte) ([]byte, error) {
+				return ed25519.Sign(otherKey, payload), nil
+			}, authn.DefaultKeychain)
+			h.AssertNil(t, err)
+
+			_, err = newImage()
+			h.AssertError(t, err, "invalid signature")
+		})
+	})
+}
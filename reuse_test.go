@@ -0,0 +1,81 @@
+package imgutil_test
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestReuseBaseImageLayers(t *testing.T) {
+	spec.Run(t, "ReuseBaseImageLayers", testReuseBaseImageLayers, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+// previousLayer marks the layers of the previous image, to tell which image a layer was taken from.
+type previousLayer struct {
+	v1.Layer
+}
+
+func testReuseBaseImageLayers(t *testing.T, when spec.G, it spec.S) {
+	var (
+		baseImage     v1.Image
+		previousImage v1.Image
+		appLayer      v1.Layer
+	)
+
+	it.Before(func() {
+		var err error
+		baseImage, err = random.Image(100, 2)
+		h.AssertNil(t, err)
+		baseLayers, err := baseImage.Layers()
+		h.AssertNil(t, err)
+		appLayer, err = random.Layer(100, types.DockerLayer)
+		h.AssertNil(t, err)
+
+		previousImage = empty.Image
+		for _, layer := range append(baseLayers, appLayer) {
+			previousImage, err = mutate.AppendLayers(previousImage, previousLayer{Layer: layer})
+			h.AssertNil(t, err)
+		}
+	})
+
+	it("takes the base image layers from the previous image", func() {
+		image, err := imgutil.NewCNBImage(imgutil.ImageOptions{BaseImage: baseImage, PreviousImage: previousImage})
+		h.AssertNil(t, err)
+		appDiffID, err := appLayer.DiffID()
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.ReuseLayer(appDiffID.String()))
+		newLayer, err := random.Layer(100, types.DockerLayer)
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.AddLayerWithHistory(newLayer, v1.History{}))
+		digestBefore, err := image.Digest()
+		h.AssertNil(t, err)
+
+		h.AssertNil(t, image.ReuseBaseImageLayers())
+
+		layers, err := image.Layers()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(layers), 4)
+		for idx, layer := range layers {
+			_, fromPrevious := layer.(previousLayer)
+			h.AssertEq(t, fromPrevious, idx < 3)
+		}
+		digestAfter, err := image.Digest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, digestAfter, digestBefore)
+	})
+
+	it("errors without a previous image", func() {
+		image, err := imgutil.NewCNBImage(imgutil.ImageOptions{BaseImage: baseImage})
+		h.AssertNil(t, err)
+		h.AssertError(t, image.ReuseBaseImageLayers(), "no previous image was provided")
+	})
+}
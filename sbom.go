@@ -0,0 +1,74 @@
+package imgutil
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// SBOMMediaTypeAnnotation is set on the descriptor of layers holding an SBOM, to the media type of the SBOM.
+	SBOMMediaTypeAnnotation = "io.buildpacks.sbom.media-type"
+	// SBOMDir is the directory of the image filesystem where SBOMs stored as layers are written, named after their digest.
+	SBOMDir = "/cnb/sbom"
+)
+
+// AddSBOM adds a layer holding the SBOM with the given media type, e.g. `application/spdx+json`,
+// to the image. The SBOM is written to SBOMDir, and the layer is annotated with SBOMMediaTypeAnnotation
+// so that it can be found without reading the layers of the image.
+// The daemon does not keep layer annotations, so images saved to the daemon only carry the SBOM file.
+func (i *CNBImageCore) AddSBOM(mediaType string, content io.Reader) error {
+	sbom, err := io.ReadAll(content)
+	if err != nil {
+		return fmt.Errorf("failed to read SBOM: %w", err)
+	}
+	sum := sha256.Sum256(sbom)
+
+	f, err := i.tempFiles.CreateTemp("imgutil.sbom.*.tar")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	if err = tw.WriteHeader(&tar.Header{
+		Name:     path.Join(SBOMDir, hex.EncodeToString(sum[:]))[1:],
+		Mode:     0644,
+		Size:     int64(len(sbom)),
+		ModTime:  NormalizedDateTime,
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	if _, err = tw.Write(sbom); err != nil {
+		return err
+	}
+	if err = tw.Close(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	layer, err := i.layerCompression.layerFromFile(f.Name(), nil, i.gzipLevel)
+	if err != nil {
+		return err
+	}
+	return i.addLayerWithHistoryAndAnnotations(layer,
+		v1.History{CreatedBy: "imgutil: sbom " + mediaType},
+		map[string]string{SBOMMediaTypeAnnotation: mediaType},
+	)
+}
+
+// NewSBOMArtifact returns an artifact holding the SBOM with the given media type, which is also its artifact type,
+// to be attached to an image as a referrer. Its config is the OCI empty descriptor; see NewArtifact.
+func NewSBOMArtifact(mediaType string, content []byte) (v1.Image, error) {
+	return NewArtifact(mediaType, static.NewLayer(bytes.Clone(content), types.MediaType(mediaType)))
+}
@@ -0,0 +1,113 @@
+package imgutil_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestSBOM(t *testing.T) {
+	spec.Run(t, "SBOM", testSBOM, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testSBOM(t *testing.T, when spec.G, it spec.S) {
+	const (
+		mediaType = "application/spdx+json"
+		contents  = `{"spdxVersion":"SPDX-2.3"}`
+	)
+
+	when("#AddSBOM", func() {
+		it("adds a layer holding the SBOM, annotated with its media type", func() {
+			image, err := imgutil.NewCNBImage(imgutil.ImageOptions{
+				Platform:   imgutil.Platform{OS: "linux", Architecture: "amd64"},
+				MediaTypes: imgutil.OCITypes,
+			})
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, image.AddSBOM(mediaType, strings.NewReader(contents)))
+
+			manifest, err := image.Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, len(manifest.Layers), 1)
+			h.AssertEq(t, manifest.Layers[0].Annotations[imgutil.SBOMMediaTypeAnnotation], mediaType)
+
+			sum := sha256.Sum256([]byte(contents))
+			sbom, err := image.ReadFile(path.Join(imgutil.SBOMDir, hex.EncodeToString(sum[:])))
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(sbom), contents)
+		})
+	})
+
+	when("#NewSBOMArtifact", func() {
+		it("returns an artifact with the SBOM as its only layer", func() {
+			artifact, err := imgutil.NewSBOMArtifact(mediaType, []byte(contents))
+			h.AssertNil(t, err)
+
+			manifest, err := artifact.Manifest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, manifest.Config.MediaType, imgutil.EmptyJSONMediaType)
+			config, err := artifact.RawConfigFile()
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(config), "{}")
+			h.AssertEq(t, manifest.Config.Digest.String(), "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a")
+			h.AssertEq(t, len(manifest.Layers), 1)
+			h.AssertEq(t, manifest.Layers[0].MediaType, types.MediaType(mediaType))
+
+			layers, err := artifact.Layers()
+			h.AssertNil(t, err)
+			rc, err := layers[0].Compressed()
+			h.AssertNil(t, err)
+			defer rc.Close()
+			sbom, err := io.ReadAll(rc)
+			h.AssertNil(t, err)
+			h.AssertEq(t, string(sbom), contents)
+
+			raw, err := artifact.RawManifest()
+			h.AssertNil(t, err)
+			var fields struct {
+				ArtifactType string `json:"artifactType"`
+			}
+			h.AssertNil(t, json.Unmarshal(raw, &fields))
+			h.AssertEq(t, fields.ArtifactType, mediaType)
+		})
+	})
+
+	when("#ReferrerArtifact", func() {
+		it("keeps the artifact type and sets the subject", func() {
+			artifact, err := imgutil.NewSBOMArtifact(mediaType, []byte(contents))
+			h.AssertNil(t, err)
+			subject := v1.Descriptor{MediaType: types.OCIManifestSchema1, Digest: v1.Hash{Algorithm: "sha256", Hex: strings.Repeat("a", 64)}, Size: 10}
+
+			referrer, err := imgutil.ReferrerArtifact(artifact, "", subject)
+			h.AssertNil(t, err)
+			raw, err := referrer.RawManifest()
+			h.AssertNil(t, err)
+			var fields struct {
+				ArtifactType string         `json:"artifactType"`
+				Subject      *v1.Descriptor `json:"subject"`
+			}
+			h.AssertNil(t, json.Unmarshal(raw, &fields))
+			h.AssertEq(t, fields.ArtifactType, mediaType)
+			h.AssertEq(t, fields.Subject.Digest, subject.Digest)
+
+			digest, err := referrer.Digest()
+			h.AssertNil(t, err)
+			expected, _, err := v1.SHA256(bytes.NewReader(raw))
+			h.AssertNil(t, err)
+			h.AssertEq(t, digest, expected)
+		})
+	})
+}
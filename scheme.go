@@ -0,0 +1,168 @@
+package imgutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ImageFactory returns an image read from the given reference, without its scheme, that is saved back to it.
+type ImageFactory func(name string, ops ...ImageOption) (Image, error)
+
+// Capabilities describes the operations that are supported by an image backend,
+// so that callers can branch on them without asserting the type of the image.
+type Capabilities struct {
+	// CanRebase reports whether the image can be rebased onto a new base image.
+	CanRebase bool
+	// CanSetAnnotations reports whether the annotations set on the image are kept when it is saved.
+	CanSetAnnotations bool
+	// CanPush reports whether saving the image pushes it to a registry.
+	CanPush bool
+}
+
+type backend struct {
+	factory      ImageFactory
+	capabilities Capabilities
+}
+
+const (
+	// LayoutScheme prefixes references to images in an OCI image layout, e.g. `oci:/path/to/layout@sha256:...`.
+	LayoutScheme = "oci"
+	// LocalScheme prefixes references to images in the docker daemon, e.g. `docker-daemon:some/image:tag`.
+	LocalScheme = "docker-daemon"
+	// RemoteScheme prefixes references to images in a registry, e.g. `docker://some/image:tag`.
+	// References without a scheme are images in a registry.
+	RemoteScheme = "docker"
+)
+
+var (
+	backendsMu sync.RWMutex
+	backends   = map[string]backend{}
+)
+
+// RegisterScheme makes an image backend with the given capabilities available to NewImage and NewImageFromRef
+// for references with the given scheme.
+// The layout, local and remote packages register their scheme when they are imported.
+func RegisterScheme(scheme string, factory ImageFactory, capabilities Capabilities) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[scheme] = backend{factory: factory, capabilities: capabilities}
+}
+
+// ParseRef splits a reference into its scheme and the name of the image for the backend of that scheme.
+// Both `scheme:name` and `scheme://name` are accepted for registered schemes, as long as `scheme:name` cannot be read
+// as an image in a registry: `docker:` must be followed by slashes, `oci:` must be followed by a path
+// (e.g. `oci:/some/layout` or `oci:./some/layout`, not `oci:some/layout`, which is read as the `oci` repository with a tag),
+// and other schemes must not be followed by a port. References without a known scheme are images in a registry.
+func ParseRef(ref string) (scheme, name string) {
+	if rest, ok := strings.CutPrefix(ref, RemoteScheme+"://"); ok {
+		return RemoteScheme, rest
+	}
+	for _, known := range append([]string{LayoutScheme, LocalScheme}, registeredSchemes()...) {
+		if known == RemoteScheme {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(ref, known+"://"); ok {
+			return known, rest
+		}
+		if rest, ok := strings.CutPrefix(ref, known+":"); ok && !isRegistryRef(known, rest) {
+			return known, rest
+		}
+	}
+	return RemoteScheme, ref
+}
+
+// isRegistryRef reports whether `scheme:rest` should be read as an image in a registry rather than with the scheme,
+// that is when `scheme` is a registry host followed by a port, or when `scheme` is the layout scheme and `rest` is not a path,
+// such as the tag of a repository named `oci`.
+func isRegistryRef(scheme, rest string) bool {
+	if port, _, _ := strings.Cut(rest, "/"); port != "" && strings.Trim(port, "0123456789") == "" {
+		return true
+	}
+	return scheme == LayoutScheme && !isPath(rest)
+}
+
+// isPath reports whether the name is an absolute path, or a path relative to the current or home directory.
+func isPath(name string) bool {
+	for _, prefix := range []string{"/", `\`, "./", "../", `.\`, `..\`, "~"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	if name == "." || name == ".." {
+		return true
+	}
+	// windows drive letters, e.g. C:\some\layout or C:/some/layout
+	return len(name) >= 3 && name[1] == ':' && (name[2] == '\\' || name[2] == '/') &&
+		strings.ContainsRune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ", rune(name[0]))
+}
+
+// NewImageFromRef returns the image at the given reference, using the backend registered for its scheme.
+// This allows callers that accept images from a layout, the daemon, or a registry to handle them in the same way.
+// The backend package must be imported for its scheme to be available.
+func NewImageFromRef(ref string, ops ...ImageOption) (Image, error) {
+	scheme, name := ParseRef(ref)
+	b, err := backendFor(scheme)
+	if err != nil {
+		return nil, err
+	}
+	return b.factory(name, ops...)
+}
+
+// NewImage returns the image at the given reference, as NewImageFromRef does, along with the capabilities of its backend.
+// References without a scheme are images in a registry, unless they are an explicit path (see isPath)
+// to an existing OCI image layout: a relative name such as `some/layout` is always an image in a registry,
+// even when a directory with that name exists, and must be given as `oci:./some/layout` or `./some/layout` instead.
+func NewImage(ref string, ops ...ImageOption) (Image, Capabilities, error) {
+	scheme, name := resolveRef(ref)
+	b, err := backendFor(scheme)
+	if err != nil {
+		return nil, Capabilities{}, err
+	}
+	image, err := b.factory(name, ops...)
+	if err != nil {
+		return nil, Capabilities{}, err
+	}
+	return image, b.capabilities, nil
+}
+
+func backendFor(scheme string) (backend, error) {
+	backendsMu.RLock()
+	b, ok := backends[scheme]
+	backendsMu.RUnlock()
+	if !ok {
+		return backend{}, fmt.Errorf("no image backend registered for scheme %q (registered: %s); import the package that provides it",
+			scheme, strings.Join(registeredSchemes(), ", "))
+	}
+	return b, nil
+}
+
+// resolveRef returns the scheme and name of the reference as ParseRef does,
+// except that references without a scheme that are explicit paths to an existing OCI image layout use the layout scheme.
+func resolveRef(ref string) (scheme, name string) {
+	scheme, name = ParseRef(ref)
+	if scheme == RemoteScheme && name == ref && isPath(ref) && isLayoutDir(ref) {
+		scheme = LayoutScheme
+	}
+	return scheme, name
+}
+
+// isLayoutDir reports whether the path is a directory containing an OCI image layout.
+func isLayoutDir(path string) bool {
+	info, err := os.Stat(filepath.Join(path, "oci-layout"))
+	return err == nil && !info.IsDir()
+}
+
+func registeredSchemes() []string {
+	backendsMu.RLock()
+	defer backendsMu.RUnlock()
+	var schemes []string
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
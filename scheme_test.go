@@ -0,0 +1,107 @@
+package imgutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	ggcrlayout "github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestScheme(t *testing.T) {
+	spec.Run(t, "Scheme", testScheme, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testScheme(t *testing.T, when spec.G, it spec.S) {
+	when("#ParseRef", func() {
+		it("splits the scheme from the name", func() {
+			for _, tc := range []struct {
+				ref, scheme, name string
+			}{
+				{"oci:/some/layout@sha256:abc", imgutil.LayoutScheme, "/some/layout@sha256:abc"},
+				{"oci:///some/layout", imgutil.LayoutScheme, "/some/layout"},
+				{"docker-daemon:some/image:tag", imgutil.LocalScheme, "some/image:tag"},
+				{"docker://some/image:tag", imgutil.RemoteScheme, "some/image:tag"},
+				{"some/image:tag", imgutil.RemoteScheme, "some/image:tag"},
+				{"docker:5000/some/image", imgutil.RemoteScheme, "docker:5000/some/image"},
+				{"oci:./some/layout", imgutil.LayoutScheme, "./some/layout"},
+				{"oci://some/layout", imgutil.LayoutScheme, "some/layout"},
+				{`oci:C:\some\layout`, imgutil.LayoutScheme, `C:\some\layout`},
+				{"oci:latest", imgutil.RemoteScheme, "oci:latest"},
+				{"oci:5000/some/image", imgutil.RemoteScheme, "oci:5000/some/image"},
+				{"docker-daemon:5000/some/image", imgutil.RemoteScheme, "docker-daemon:5000/some/image"},
+			} {
+				scheme, name := imgutil.ParseRef(tc.ref)
+				h.AssertEq(t, scheme, tc.scheme)
+				h.AssertEq(t, name, tc.name)
+			}
+		})
+	})
+
+	when("#NewImageFromRef", func() {
+		it("fails for schemes without a registered backend", func() {
+			_, err := imgutil.NewImageFromRef("some-scheme-without-backend://some/image")
+			h.AssertError(t, err, `no image backend registered for scheme "docker"`)
+		})
+
+		it("uses the backend registered for the scheme", func() {
+			imgutil.RegisterScheme("test-scheme", func(name string, _ ...imgutil.ImageOption) (imgutil.Image, error) {
+				return nil, imgutil.ErrFileNotFound{Path: name}
+			}, imgutil.Capabilities{})
+			_, err := imgutil.NewImageFromRef("test-scheme:some/path")
+			h.AssertError(t, err, `"some/path"`)
+		})
+	})
+	when("#NewImage", func() {
+		it("returns the capabilities of the backend registered for the scheme", func() {
+			capabilities := imgutil.Capabilities{CanRebase: true, CanPush: true}
+			imgutil.RegisterScheme("test-capabilities", func(_ string, _ ...imgutil.ImageOption) (imgutil.Image, error) {
+				return nil, nil
+			}, capabilities)
+			_, got, err := imgutil.NewImage("test-capabilities:some/image")
+			h.AssertNil(t, err)
+			h.AssertEq(t, got, capabilities)
+		})
+
+		it("uses the layout backend for paths of existing layouts without a scheme", func() {
+			tmpDir, err := os.MkdirTemp("", "scheme-test")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(tmpDir)
+			image, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			layoutPath, err := ggcrlayout.Write(tmpDir, empty.Index)
+			h.AssertNil(t, err)
+			h.AssertNil(t, layoutPath.AppendImage(image))
+
+			got, capabilities, err := imgutil.NewImage(tmpDir)
+			h.AssertNil(t, err)
+			h.AssertEq(t, got.Kind(), "layout")
+			h.AssertEq(t, capabilities, imgutil.Capabilities{CanRebase: true, CanSetAnnotations: true})
+		})
+
+		it("uses the registry backend for relative names of existing layouts without a path prefix", func() {
+			tmpDir, err := os.MkdirTemp(".", "scheme-test")
+			h.AssertNil(t, err)
+			defer os.RemoveAll(tmpDir)
+			image, err := random.Image(1024, 1)
+			h.AssertNil(t, err)
+			layoutPath, err := ggcrlayout.Write(tmpDir, empty.Index)
+			h.AssertNil(t, err)
+			h.AssertNil(t, layoutPath.AppendImage(image))
+
+			_, _, err = imgutil.NewImage(filepath.Base(tmpDir))
+			h.AssertError(t, err, `no image backend registered for scheme "docker"`)
+
+			got, _, err := imgutil.NewImage("./" + filepath.Base(tmpDir))
+			h.AssertNil(t, err)
+			h.AssertEq(t, got.Kind(), "layout")
+		})
+	})
+}
@@ -0,0 +1,240 @@
+package imgutil
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// specURL is the version of the OCI image spec that violations refer to.
+const specURL = "https://github.com/opencontainers/image-spec/blob/v1.1.0/"
+
+// References to the sections of the OCI image spec that are checked.
+const (
+	SpecManifestProperties   = specURL + "manifest.md#image-manifest-property-descriptions"
+	SpecIndexProperties      = specURL + "image-index.md#image-index-property-descriptions"
+	SpecConfigProperties     = specURL + "config.md#properties"
+	SpecDescriptorProperties = specURL + "descriptor.md#properties"
+	SpecAnnotationRules      = specURL + "annotations.md#rules"
+	SpecMediaTypes           = specURL + "media-types.md#compatibility-matrix"
+)
+
+// SpecViolation is a departure of an image or index from the OCI image spec.
+type SpecViolation struct {
+	// Field locates the violation, e.g. "manifest.layers[0].size".
+	Field   string
+	Message string
+	// SpecRef links to the section of the spec that is violated.
+	SpecRef string
+}
+
+func (v SpecViolation) String() string {
+	return fmt.Sprintf("%s: %s (see %s)", v.Field, v.Message, v.SpecRef)
+}
+
+// ErrSpecViolations is returned when an image or index that is checked before being pushed does not conform to the spec;
+// see remote.WithValidateBeforePush and WithValidateBeforePush.
+type ErrSpecViolations struct {
+	Name       string
+	Violations []SpecViolation
+}
+
+func (e ErrSpecViolations) Error() string {
+	var details []string
+	for _, v := range e.Violations {
+		details = append(details, v.String())
+	}
+	return fmt.Sprintf("%s does not conform to the OCI image spec: %s", e.Name, strings.Join(details, "; "))
+}
+
+// annotationKey matches annotation keys namespaced with reverse domain notation, e.g. org.opencontainers.image.created.
+var annotationKey = regexp.MustCompile(`^[a-zA-Z0-9]+(?:[._-][a-zA-Z0-9]+)*(?:\.[a-zA-Z0-9][a-zA-Z0-9._/-]*)+$`)
+
+type specViolations []SpecViolation
+
+func (vs *specViolations) add(field, specRef, format string, args ...interface{}) {
+	*vs = append(*vs, SpecViolation{Field: field, Message: fmt.Sprintf(format, args...), SpecRef: specRef})
+}
+
+func (vs *specViolations) checkAnnotations(field string, annotations map[string]string) {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !annotationKey.MatchString(k) {
+			vs.add(field, SpecAnnotationRules, "annotation key %q is not namespaced using reverse domain notation", k)
+		}
+	}
+}
+
+func (vs *specViolations) checkDescriptor(field string, desc v1.Descriptor) {
+	if desc.MediaType == "" {
+		vs.add(field+".mediaType", SpecDescriptorProperties, "media type is required")
+	}
+	if desc.Digest.Algorithm == "" || desc.Digest.Hex == "" {
+		vs.add(field+".digest", SpecDescriptorProperties, "digest is required")
+	}
+	if desc.Size <= 0 {
+		vs.add(field+".size", SpecDescriptorProperties, "size must be positive; got %d", desc.Size)
+	}
+	vs.checkAnnotations(field+".annotations", desc.Annotations)
+}
+
+// ValidateImageSpec checks that the image conforms to the OCI image spec (or to the Docker image format,
+// for images with Docker media types): the required manifest and config fields are set, the media types of the
+// manifest, config and layers are compatible, annotation keys are namespaced, and the descriptors of the config
+// and layers match their blobs. It returns every violation found, or an error if the image cannot be read.
+// Computing the digests and sizes of layers that were added to the image may compress them.
+func ValidateImageSpec(image v1.Image) ([]SpecViolation, error) {
+	manifest, err := getManifest(image)
+	if err != nil {
+		return nil, err
+	}
+	configFile, err := getConfigFile(image)
+	if err != nil {
+		return nil, err
+	}
+	var vs specViolations
+
+	if manifest.SchemaVersion != 2 {
+		vs.add("manifest.schemaVersion", SpecManifestProperties, "must be 2; got %d", manifest.SchemaVersion)
+	}
+	docker := manifest.MediaType == types.DockerManifestSchema2
+	if manifest.MediaType != "" && !manifest.MediaType.IsImage() {
+		vs.add("manifest.mediaType", SpecManifestProperties, "%s is not an image manifest media type", manifest.MediaType)
+	}
+	vs.checkAnnotations("manifest.annotations", manifest.Annotations)
+
+	vs.checkDescriptor("manifest.config", manifest.Config)
+	if docker && manifest.Config.MediaType != types.DockerConfigJSON {
+		vs.add("manifest.config.mediaType", SpecMediaTypes, "%s is not a Docker config media type", manifest.Config.MediaType)
+	}
+	if rawConfig, err := image.RawConfigFile(); err == nil {
+		configName, err := image.ConfigName()
+		if err != nil {
+			return nil, err
+		}
+		if manifest.Config.Digest != configName {
+			vs.add("manifest.config.digest", SpecDescriptorProperties, "%s does not match the config blob digest %s", manifest.Config.Digest, configName)
+		}
+		if manifest.Config.Size != int64(len(rawConfig)) {
+			vs.add("manifest.config.size", SpecDescriptorProperties, "%d does not match the config blob size %d", manifest.Config.Size, len(rawConfig))
+		}
+		if !bytes.HasPrefix(bytes.TrimSpace(rawConfig), []byte("{")) {
+			vs.add("config", SpecConfigProperties, "config is not a JSON object")
+		}
+	}
+
+	layers, err := image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	if len(layers) != len(manifest.Layers) {
+		vs.add("manifest.layers", SpecManifestProperties, "manifest has %d layers; image has %d", len(manifest.Layers), len(layers))
+	}
+	for idx, desc := range manifest.Layers {
+		field := fmt.Sprintf("manifest.layers[%d]", idx)
+		vs.checkDescriptor(field, desc)
+		mediaType := types.MediaType(strings.TrimSuffix(string(desc.MediaType), EncryptedMediaTypeSuffix))
+		switch {
+		case docker && !isDockerLayer(mediaType):
+			vs.add(field+".mediaType", SpecMediaTypes, "%s is not a Docker layer media type, as expected in a Docker manifest", desc.MediaType)
+		case !docker && manifest.Config.MediaType == types.OCIConfigJSON && !isOCILayer(mediaType):
+			vs.add(field+".mediaType", SpecMediaTypes, "%s is not an OCI layer media type, as expected in an OCI image manifest", desc.MediaType)
+		}
+		if idx >= len(layers) {
+			continue
+		}
+		digest, err := layers[idx].Digest()
+		if err != nil {
+			return nil, err
+		}
+		if digest != desc.Digest {
+			vs.add(field+".digest", SpecDescriptorProperties, "%s does not match the layer blob digest %s", desc.Digest, digest)
+		}
+		size, err := layers[idx].Size()
+		if err != nil {
+			return nil, err
+		}
+		if size != desc.Size {
+			vs.add(field+".size", SpecDescriptorProperties, "%d does not match the layer blob size %d", desc.Size, size)
+		}
+	}
+
+	if manifest.Config.MediaType == types.OCIConfigJSON || manifest.Config.MediaType == types.DockerConfigJSON {
+		if configFile.Architecture == "" {
+			vs.add("config.architecture", SpecConfigProperties, "architecture is required")
+		}
+		if configFile.OS == "" {
+			vs.add("config.os", SpecConfigProperties, "os is required")
+		}
+		if configFile.RootFS.Type != "layers" {
+			vs.add("config.rootfs.type", SpecConfigProperties, "must be \"layers\"; got %q", configFile.RootFS.Type)
+		}
+		if len(configFile.RootFS.DiffIDs) != len(manifest.Layers) {
+			vs.add("config.rootfs.diff_ids", SpecConfigProperties, "config has %d diff IDs; manifest has %d layers", len(configFile.RootFS.DiffIDs), len(manifest.Layers))
+		}
+	}
+	return vs, nil
+}
+
+// ValidateIndexSpec checks that the index conforms to the OCI image spec (or to the Docker manifest list format,
+// for indexes with Docker media types): the required fields of the index and of its manifest descriptors are set,
+// platforms have an os and architecture, media types are compatible, and annotation keys are namespaced.
+// The manifests of the index are not read. It returns every violation found, or an error if the index cannot be read.
+func ValidateIndexSpec(index v1.ImageIndex) ([]SpecViolation, error) {
+	indexManifest, err := getIndexManifest(index)
+	if err != nil {
+		return nil, err
+	}
+	var vs specViolations
+
+	if indexManifest.SchemaVersion != 2 {
+		vs.add("index.schemaVersion", SpecIndexProperties, "must be 2; got %d", indexManifest.SchemaVersion)
+	}
+	if indexManifest.MediaType != "" && !indexManifest.MediaType.IsIndex() {
+		vs.add("index.mediaType", SpecIndexProperties, "%s is not an index media type", indexManifest.MediaType)
+	}
+	docker := indexManifest.MediaType == types.DockerManifestList
+	vs.checkAnnotations("index.annotations", indexManifest.Annotations)
+
+	for idx, desc := range indexManifest.Manifests {
+		field := fmt.Sprintf("index.manifests[%d]", idx)
+		vs.checkDescriptor(field, desc)
+		if docker && desc.MediaType != types.DockerManifestSchema2 && desc.MediaType != types.DockerManifestList {
+			vs.add(field+".mediaType", SpecMediaTypes, "%s is not a Docker manifest media type, as expected in a Docker manifest list", desc.MediaType)
+		}
+		if desc.Platform != nil && !isAttestation(desc) {
+			if desc.Platform.OS == "" {
+				vs.add(field+".platform.os", SpecIndexProperties, "os is required in a platform")
+			}
+			if desc.Platform.Architecture == "" {
+				vs.add(field+".platform.architecture", SpecIndexProperties, "architecture is required in a platform")
+			}
+		}
+	}
+	return vs, nil
+}
+
+func isDockerLayer(mediaType types.MediaType) bool {
+	switch mediaType {
+	case types.DockerLayer, types.DockerUncompressedLayer, types.DockerForeignLayer:
+		return true
+	}
+	return false
+}
+
+func isOCILayer(mediaType types.MediaType) bool {
+	switch mediaType {
+	case types.OCILayer, types.OCILayerZStd, types.OCIUncompressedLayer, types.OCIRestrictedLayer, types.OCIUncompressedRestrictedLayer:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package imgutil_test
+
+import (
+	"errors"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestSpecValidation(t *testing.T) {
+	spec.Run(t, "SpecValidation", testSpecValidation, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testSpecValidation(t *testing.T, when spec.G, it spec.S) {
+	fieldsOf := func(violations []imgutil.SpecViolation) []string {
+		var fields []string
+		for _, v := range violations {
+			fields = append(fields, v.Field)
+		}
+		return fields
+	}
+
+	newImage := func(mediaTypes imgutil.MediaTypes) v1.Image {
+		image, err := random.Image(100, 1)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS = "linux"
+		configFile.Architecture = "amd64"
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		image, _, err = imgutil.EnsureMediaTypesAndLayers(image, mediaTypes, imgutil.PreserveLayers)
+		h.AssertNil(t, err)
+		return image
+	}
+
+	when("#ValidateImageSpec", func() {
+		it("reports no violation for a conforming image", func() {
+			for _, mediaTypes := range []imgutil.MediaTypes{imgutil.OCITypes, imgutil.DockerTypes} {
+				violations, err := imgutil.ValidateImageSpec(newImage(mediaTypes))
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(violations), 0)
+			}
+		})
+
+		it("reports every violation with a reference to the spec", func() {
+			image := newImage(imgutil.DockerTypes)
+			layer, err := random.Layer(100, types.OCILayer)
+			h.AssertNil(t, err)
+			image, err = mutate.Append(image, mutate.Addendum{Layer: layer, MediaType: types.OCILayer})
+			h.AssertNil(t, err)
+			image = mutate.Annotations(image, map[string]string{"unnamespaced": "value"}).(v1.Image)
+			configFile, err := image.ConfigFile()
+			h.AssertNil(t, err)
+			configFile.Architecture = ""
+			image, err = mutate.ConfigFile(image, configFile)
+			h.AssertNil(t, err)
+
+			violations, err := imgutil.ValidateImageSpec(image)
+			h.AssertNil(t, err)
+			h.AssertEq(t, fieldsOf(violations), []string{"manifest.annotations", "manifest.layers[1].mediaType", "config.architecture"})
+			h.AssertEq(t, violations[0].SpecRef, imgutil.SpecAnnotationRules)
+		})
+	})
+
+	when("#ValidateIndexSpec", func() {
+		it("reports platforms without an os or architecture", func() {
+			index := mutate.AppendManifests(empty.Index, mutate.IndexAddendum{
+				Add:        newImage(imgutil.OCITypes),
+				Descriptor: v1.Descriptor{Platform: &v1.Platform{OS: "linux"}},
+			})
+			violations, err := imgutil.ValidateIndexSpec(index)
+			h.AssertNil(t, err)
+			h.AssertEq(t, fieldsOf(violations), []string{"index.manifests[0].platform.architecture"})
+		})
+	})
+
+	when("#WithValidateBeforePush", func() {
+		it("fails to push an index with violations", func() {
+			index, err := imgutil.NewCNBIndex("some-registry.invalid/index", imgutil.IndexOptions{BaseIndex: empty.Index})
+			h.AssertNil(t, err)
+			index.ImageIndex = mutate.AppendManifests(index.ImageIndex, mutate.IndexAddendum{
+				Add:        newImage(imgutil.OCITypes),
+				Descriptor: v1.Descriptor{Platform: &v1.Platform{Architecture: "amd64"}},
+			})
+
+			err = index.Push(imgutil.WithValidateBeforePush())
+			var specErr imgutil.ErrSpecViolations
+			h.AssertEq(t, errors.As(err, &specErr), true)
+			h.AssertEq(t, fieldsOf(specErr.Violations), []string{"index.manifests[0].platform.os"})
+		})
+	})
+}
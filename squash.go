@@ -0,0 +1,157 @@
+package imgutil
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+)
+
+// SquashLayers collapses all the layers above the layer with the given diff ID into a single layer.
+// If fromDiffID is empty, all the layers of the image are collapsed into one.
+// Files that are overwritten or deleted by higher layers are dropped from the squashed layer;
+// whiteouts are kept only if they may apply to layers below the squashed ones.
+func (i *CNBImageCore) SquashLayers(fromDiffID string) error {
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return err
+	}
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return err
+	}
+
+	keep := 0 // the number of layers to keep as-is
+	if fromDiffID != "" {
+		fromHash, err := v1.NewHash(fromDiffID)
+		if err != nil {
+			return fmt.Errorf("failed to get layer hash: %w", err)
+		}
+		idx := indexOf(configFile.RootFS.DiffIDs, fromHash)
+		if idx < 0 {
+			return ErrLayerNotFound{DiffID: fromDiffID}
+		}
+		keep = idx + 1
+	}
+	if len(layers)-keep < 2 {
+		return nil
+	}
+
+	squashed, err := i.squash(layers[keep:], keep > 0)
+	if err != nil {
+		return fmt.Errorf("failed to squash layers: %w", err)
+	}
+
+	history := NormalizedHistory(configFile.History, len(layers))
+	base, err := i.withLayers(configFile, layers[:keep], history[:keep], nil)
+	if err != nil {
+		return err
+	}
+	i.Image = base
+	return i.AddLayerWithHistory(squashed, v1.History{
+		CreatedBy: fmt.Sprintf("imgutil: squashed %d layers", len(layers)-keep),
+	})
+}
+
+// withLayers returns the working image with only the provided layers, preserving its media types and config.
+// If annotations are provided, they are set on the descriptors of the corresponding layers.
+func (i *CNBImageCore) withLayers(configFile *v1.ConfigFile, layers []v1.Layer, history []v1.History, annotations []map[string]string) (v1.Image, error) {
+	manifest, err := getManifest(i.Image)
+	if err != nil {
+		return nil, err
+	}
+	configFile = configFile.DeepCopy()
+	configFile.History = []v1.History{}
+	configFile.RootFS.DiffIDs = []v1.Hash{}
+
+	image := mutate.MediaType(empty.Image, manifest.MediaType)
+	if image, err = mutate.ConfigFile(image, configFile); err != nil {
+		return nil, err
+	}
+	image = mutate.ConfigMediaType(image, manifest.Config.MediaType)
+	addendums := layersAddendum(layers, history, "")
+	for idx := range annotations {
+		addendums[idx].Annotations = annotations[idx]
+	}
+	return mutate.Append(image, addendums...)
+}
+
+// squash writes the merged contents of the given layers to a new layer.
+func (i *CNBImageCore) squash(layers []v1.Layer, hasLowerLayers bool) (v1.Layer, error) {
+	f, err := i.tempFiles.CreateTemp("imgutil.squashed.*.tar")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	if err = writeMergedLayers(tw, layers, hasLowerLayers); err != nil {
+		return nil, err
+	}
+	if err = tw.Close(); err != nil {
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	return i.layerCompression.layerFromFile(f.Name(), nil, i.gzipLevel)
+}
+
+// writeMergedLayers writes the entries of the given layers that are visible in the merged filesystem to tw.
+// The layers are read twice: once from the top to find the entries that are visible, and once from the bottom to write them.
+// Whiteouts are only written if there are lower layers they may apply to.
+func writeMergedLayers(tw *tar.Writer, layers []v1.Layer, hasLowerLayers bool) error {
+	visible := make([]map[int]bool, len(layers))
+	shadows := newShadowTracker()
+	for idx := len(layers) - 1; idx >= 0; idx-- {
+		visible[idx] = map[int]bool{}
+		err := forEachEntry(layers[idx], func(n int, hdr *tar.Header, _ io.Reader) error {
+			name := cleanEntryName(hdr.Name)
+			if !shadows.visit(name) {
+				return nil
+			}
+			switch target, kind := whiteoutTarget(name); kind {
+			case notWhiteout:
+				visible[idx][n] = true
+			case deletion:
+				// the whiteout is not needed if a higher layer re-creates the file
+				visible[idx][n] = hasLowerLayers && !shadows.seen[target]
+			case opaqueDir:
+				visible[idx][n] = hasLowerLayers
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		shadows.nextLayer()
+	}
+
+	for idx, layer := range layers {
+		err := forEachEntry(layer, func(n int, hdr *tar.Header, r io.Reader) error {
+			if !visible[idx][n] {
+				return nil
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			_, err := io.Copy(tw, r) // #nosec G110
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func indexOf(diffIDs []v1.Hash, hash v1.Hash) int {
+	for idx, diffID := range diffIDs {
+		if diffID == hash {
+			return idx
+		}
+	}
+	return -1
+}
@@ -0,0 +1,130 @@
+package imgutil_test
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestSquash(t *testing.T) {
+	spec.Run(t, "Squash", testSquash, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testSquash(t *testing.T, when spec.G, it spec.S) {
+	var (
+		image   *imgutil.CNBImageCore
+		tmpDir  string
+		diffIDs []string
+		err     error
+	)
+
+	// createLayer writes a layer tar with the given files, in order, and returns its path
+	createLayer := func(files ...string) string {
+		f, err := os.CreateTemp(tmpDir, "layer.*.tar")
+		h.AssertNil(t, err)
+		defer f.Close()
+		tw := tar.NewWriter(f)
+		for _, file := range files {
+			h.AssertNil(t, tw.WriteHeader(&tar.Header{Name: file, Mode: 0644, Size: int64(len(file))}))
+			_, err = tw.Write([]byte(file))
+			h.AssertNil(t, err)
+		}
+		h.AssertNil(t, tw.Close())
+		return f.Name()
+	}
+
+	layerContents := func(layer v1.Layer) []string {
+		rc, err := layer.Uncompressed()
+		h.AssertNil(t, err)
+		defer rc.Close()
+		var names []string
+		tr := tar.NewReader(rc)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			h.AssertNil(t, err)
+			names = append(names, filepath.ToSlash(hdr.Name))
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	it.Before(func() {
+		tmpDir, err = os.MkdirTemp("", "squash-test")
+		h.AssertNil(t, err)
+
+		image, err = imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}})
+		h.AssertNil(t, err)
+		for _, files := range [][]string{
+			{"base/file"},
+			{"app/a", "app/b", "app/dir/x"},
+			{"app/.wh.a", "app/c", "app/dir/.wh..wh..opq", "app/dir/y"},
+			{"app/b"},
+		} {
+			h.AssertNil(t, image.AddLayer(createLayer(files...)))
+		}
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		diffIDs = nil
+		for _, diffID := range configFile.RootFS.DiffIDs {
+			diffIDs = append(diffIDs, diffID.String())
+		}
+	})
+
+	it.After(func() {
+		h.AssertNil(t, image.Cleanup())
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	it("squashes the layers above the given layer, keeping whiteouts for the layers below", func() {
+		h.AssertNil(t, image.SquashLayers(diffIDs[0]))
+
+		layers, err := image.Layers()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(layers), 2)
+		h.AssertEq(t, layerContents(layers[1]), []string{"app/.wh.a", "app/b", "app/c", "app/dir/.wh..wh..opq", "app/dir/y"})
+
+		baseDiffID, err := layers[0].DiffID()
+		h.AssertNil(t, err)
+		h.AssertEq(t, baseDiffID.String(), diffIDs[0])
+
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(configFile.RootFS.DiffIDs), 2)
+		h.AssertEq(t, len(configFile.History), 2)
+	})
+
+	it("squashes all the layers when no diff ID is given", func() {
+		h.AssertNil(t, image.SquashLayers(""))
+
+		layers, err := image.Layers()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(layers), 1)
+		h.AssertEq(t, layerContents(layers[0]), []string{"app/b", "app/c", "app/dir/y", "base/file"})
+	})
+
+	it("does nothing when there is only one layer above the given layer", func() {
+		h.AssertNil(t, image.SquashLayers(diffIDs[2]))
+
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		h.AssertEq(t, len(configFile.RootFS.DiffIDs), 4)
+	})
+
+	it("errors when the layer does not exist", func() {
+		err := image.SquashLayers("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+		h.AssertError(t, err, "failed to find layer with diff ID")
+	})
+}
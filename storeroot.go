@@ -0,0 +1,114 @@
+package imgutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultProject is the project of indexes stored under a store root when no project is selected with WithProject.
+const DefaultProject = "default"
+
+const storeRootProjectsDir = "projects"
+
+// StoreRoot is a root of the XDG store shared by several projects, e.g. the builds of several tenants or repositories.
+// Each project has its own directory under the root, so that concurrent builds for different projects never save
+// indexes to the same directory, and a project can be cleaned without affecting the others.
+// Several roots can be used side by side, e.g. one per volume; each is independent of the others.
+type StoreRoot struct {
+	path string
+}
+
+// NewStoreRoot returns the store root at the provided path. The directory is created when an index is first saved to it.
+func NewStoreRoot(path string) StoreRoot {
+	return StoreRoot{path: path}
+}
+
+// Path returns the path of the store root.
+func (r StoreRoot) Path() string {
+	return r.path
+}
+
+// ProjectPath returns the directory of the project under the store root, to be used as the XDG path of its indexes,
+// aliases and caches.
+func (r StoreRoot) ProjectPath(project string) (string, error) {
+	if err := validateProject(project); err != nil {
+		return "", err
+	}
+	return filepath.Join(r.path, storeRootProjectsDir, project), nil
+}
+
+// Projects returns the names of the projects with a directory under the store root, sorted.
+func (r StoreRoot) Projects() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(r.path, storeRootProjectsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var projects []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			projects = append(projects, entry.Name())
+		}
+	}
+	sort.Strings(projects)
+	return projects, nil
+}
+
+// RemoveProject removes the directory of the project, with everything stored for it, leaving other projects untouched.
+// Removing a project that does not exist does nothing.
+func (r StoreRoot) RemoveProject(project string) error {
+	path, err := r.ProjectPath(project)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+func validateProject(project string) error {
+	if project == "" || project == "." || project == ".." || strings.ContainsAny(project, `/\`) {
+		return fmt.Errorf("invalid project name %q", project)
+	}
+	return nil
+}
+
+// WithStoreRoot saves the index under the provided store root, in the directory of the project selected with WithProject,
+// or of DefaultProject. It supersedes WithXDGRuntimePath, unless that option is provided after it.
+func WithStoreRoot(path string) func(options *IndexOptions) error {
+	return func(o *IndexOptions) error {
+		o.StoreRoot = path
+		return o.resolveStorePath()
+	}
+}
+
+// WithProject selects the project whose directory under the store root provided with WithStoreRoot holds the index.
+func WithProject(project string) func(options *IndexOptions) error {
+	return func(o *IndexOptions) error {
+		if err := validateProject(project); err != nil {
+			return err
+		}
+		o.Project = project
+		return o.resolveStorePath()
+	}
+}
+
+// resolveStorePath sets the XDG path to the directory of the active project, once a store root is provided.
+func (o *LayoutIndexOptions) resolveStorePath() error {
+	if o.StoreRoot == "" {
+		return nil
+	}
+	project := o.Project
+	if project == "" {
+		project = DefaultProject
+	}
+	path, err := NewStoreRoot(o.StoreRoot).ProjectPath(project)
+	if err != nil {
+		return err
+	}
+	o.XdgPath = path
+	return nil
+}
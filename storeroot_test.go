@@ -0,0 +1,83 @@
+package imgutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestStoreRoot(t *testing.T) {
+	spec.Run(t, "StoreRoot", testStoreRoot, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testStoreRoot(t *testing.T, when spec.G, it spec.S) {
+	var (
+		rootPath string
+		err      error
+	)
+
+	it.Before(func() {
+		rootPath, err = os.MkdirTemp("", "store-root-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(rootPath))
+	})
+
+	newIndex := func(ops ...imgutil.IndexOption) *imgutil.CNBIndex {
+		options := &imgutil.IndexOptions{}
+		for _, op := range ops {
+			h.AssertNil(t, op(options))
+		}
+		index, err := imgutil.NewCNBIndex("some/index", *options)
+		h.AssertNil(t, err)
+		return index
+	}
+
+	when("#WithStoreRoot", func() {
+		it("saves indexes of different projects to separate directories", func() {
+			first := newIndex(imgutil.WithProject("first"), imgutil.WithStoreRoot(rootPath))
+			second := newIndex(imgutil.WithStoreRoot(rootPath), imgutil.WithProject("second"))
+			h.AssertNil(t, first.SaveDir())
+			h.AssertNil(t, second.SaveDir())
+
+			h.AssertEq(t, first.XdgPath, filepath.Join(rootPath, "projects", "first"))
+			h.AssertEq(t, second.XdgPath, filepath.Join(rootPath, "projects", "second"))
+			projects, err := imgutil.NewStoreRoot(rootPath).Projects()
+			h.AssertNil(t, err)
+			h.AssertEq(t, projects, []string{"first", "second"})
+		})
+
+		it("uses the default project if none is selected", func() {
+			index := newIndex(imgutil.WithStoreRoot(rootPath))
+			h.AssertEq(t, index.XdgPath, filepath.Join(rootPath, "projects", imgutil.DefaultProject))
+		})
+
+		it("rejects project names that escape the store root", func() {
+			options := &imgutil.IndexOptions{}
+			h.AssertError(t, imgutil.WithProject("../other")(options), "invalid project name")
+		})
+	})
+
+	when("#RemoveProject", func() {
+		it("removes only the project", func() {
+			h.AssertNil(t, newIndex(imgutil.WithStoreRoot(rootPath), imgutil.WithProject("first")).SaveDir())
+			h.AssertNil(t, newIndex(imgutil.WithStoreRoot(rootPath), imgutil.WithProject("second")).SaveDir())
+
+			root := imgutil.NewStoreRoot(rootPath)
+			h.AssertNil(t, root.RemoveProject("first"))
+
+			projects, err := root.Projects()
+			h.AssertNil(t, err)
+			h.AssertEq(t, projects, []string{"second"})
+			h.AssertEq(t, newIndex(imgutil.WithStoreRoot(rootPath), imgutil.WithProject("second")).Found(), true)
+		})
+	})
+}
@@ -0,0 +1,99 @@
+package imgutil
+
+import (
+	"errors"
+	"os"
+	"sync"
+)
+
+// TempFiles creates intermediate files and directories, such as layers extracted from the daemon
+// or staged archives, and removes them when they are no longer needed.
+// The zero value (and a nil pointer) creates files in the default directory and tracks nothing.
+type TempFiles struct {
+	dir   string
+	keep  bool
+	mu    sync.Mutex
+	paths []string
+}
+
+// NewTempFiles returns a TempFiles that creates files in dir, or the default directory for temporary files if dir is empty.
+// When keep is true, Discard and Cleanup leave files in place so that they can be inspected for debugging.
+func NewTempFiles(dir string, keep bool) *TempFiles {
+	return &TempFiles{dir: dir, keep: keep}
+}
+
+// MkdirTemp creates a new temporary directory, see os.MkdirTemp.
+func (t *TempFiles) MkdirTemp(pattern string) (string, error) {
+	path, err := os.MkdirTemp(t.Dir(), pattern)
+	if err != nil {
+		return "", err
+	}
+	t.track(path)
+	return path, nil
+}
+
+// CreateTemp creates a new temporary file, see os.CreateTemp.
+func (t *TempFiles) CreateTemp(pattern string) (*os.File, error) {
+	f, err := os.CreateTemp(t.Dir(), pattern)
+	if err != nil {
+		return nil, err
+	}
+	t.track(f.Name())
+	return f, nil
+}
+
+// Discard removes the given path, which was returned by MkdirTemp or CreateTemp, unless intermediates are kept.
+// It is used to clean up after failures, when the path is known not to be referenced.
+func (t *TempFiles) Discard(path string) error {
+	if t == nil {
+		return os.RemoveAll(path)
+	}
+	if t.keep {
+		return nil
+	}
+	t.mu.Lock()
+	for idx, p := range t.paths {
+		if p == path {
+			t.paths = append(t.paths[:idx], t.paths[idx+1:]...)
+			break
+		}
+	}
+	t.mu.Unlock()
+	return os.RemoveAll(path)
+}
+
+// Cleanup removes all files and directories created so far, unless intermediates are kept.
+func (t *TempFiles) Cleanup() error {
+	if t == nil || t.keep {
+		return nil
+	}
+	t.mu.Lock()
+	paths := t.paths
+	t.paths = nil
+	t.mu.Unlock()
+
+	var errs []error
+	for _, path := range paths {
+		if err := os.RemoveAll(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Dir returns the directory in which files are created; an empty string means the default directory for temporary files.
+func (t *TempFiles) Dir() string {
+	if t == nil {
+		return ""
+	}
+	return t.dir
+}
+
+func (t *TempFiles) track(path string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.paths = append(t.paths, path)
+}
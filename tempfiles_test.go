@@ -0,0 +1,72 @@
+package imgutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestTempFiles(t *testing.T) {
+	spec.Run(t, "TempFiles", testTempFiles, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testTempFiles(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tempDir string
+		err     error
+	)
+
+	it.Before(func() {
+		tempDir, err = os.MkdirTemp("", "tempfiles-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tempDir))
+	})
+
+	it("creates files in the given directory and removes them on cleanup", func() {
+		tempFiles := imgutil.NewTempFiles(tempDir, false)
+		dir, err := tempFiles.MkdirTemp("some-dir.*")
+		h.AssertNil(t, err)
+		f, err := tempFiles.CreateTemp("some-file.*")
+		h.AssertNil(t, err)
+		h.AssertNil(t, f.Close())
+		h.AssertEq(t, filepath.Dir(dir), tempDir)
+		h.AssertEq(t, filepath.Dir(f.Name()), tempDir)
+
+		h.AssertNil(t, tempFiles.Cleanup())
+		h.AssertPathDoesNotExists(t, dir)
+		h.AssertPathDoesNotExists(t, f.Name())
+	})
+
+	it("discards a single path", func() {
+		tempFiles := imgutil.NewTempFiles(tempDir, false)
+		discarded, err := tempFiles.MkdirTemp("discarded.*")
+		h.AssertNil(t, err)
+		kept, err := tempFiles.MkdirTemp("kept.*")
+		h.AssertNil(t, err)
+
+		h.AssertNil(t, tempFiles.Discard(discarded))
+		h.AssertPathDoesNotExists(t, discarded)
+		h.AssertPathExists(t, kept)
+	})
+
+	when("intermediates are kept", func() {
+		it("leaves files in place", func() {
+			tempFiles := imgutil.NewTempFiles(tempDir, true)
+			dir, err := tempFiles.MkdirTemp("some-dir.*")
+			h.AssertNil(t, err)
+
+			h.AssertNil(t, tempFiles.Discard(dir))
+			h.AssertNil(t, tempFiles.Cleanup())
+			h.AssertPathExists(t, dir)
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package imgutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTokenLifetime is the lifetime of tokens whose response does not include `expires_in`, per the distribution spec.
+	defaultTokenLifetime = 60 * time.Second
+	// tokenExpiryMargin is subtracted from the lifetime of tokens, so that they are not used as they expire.
+	tokenExpiryMargin = 10 * time.Second
+	// pingLifetime is how long the response to the `/v2/` ping of a registry, which tells where to get tokens, is reused.
+	pingLifetime = 5 * time.Minute
+)
+
+// TokenCache caches the bearer tokens obtained from registries, keyed by registry, scope and credentials,
+// so that remote operations sharing the cache authenticate once instead of once per operation.
+// The responses to the `/v2/` ping that starts each authentication are cached as well.
+// A TokenCache is safe for concurrent use.
+type TokenCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+	realms  map[string]bool
+	now     func() time.Time
+}
+
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// NewTokenCache returns an empty token cache.
+func NewTokenCache() *TokenCache {
+	return &TokenCache{
+		entries: map[string]cachedResponse{},
+		realms:  map[string]bool{},
+		now:     time.Now,
+	}
+}
+
+// Transport returns a transport that sends requests with the inner transport, answering ping and token requests from the cache.
+// If the cache is nil, the inner transport is returned.
+func (c *TokenCache) Transport(inner http.RoundTripper) http.RoundTripper {
+	if c == nil {
+		return inner
+	}
+	return &tokenCacheTransport{cache: c, inner: inner}
+}
+
+type tokenCacheTransport struct {
+	cache *TokenCache
+	inner http.RoundTripper
+}
+
+func (t *tokenCacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	isPing := req.Method == http.MethodGet && req.URL.Path == "/v2/" && req.Header.Get("Authorization") == ""
+	if !isPing && !t.cache.isRealm(req) {
+		return t.inner.RoundTrip(req)
+	}
+
+	key, err := cacheKey(req)
+	if err != nil {
+		return nil, err
+	}
+	if cached, ok := t.cache.get(key); ok {
+		return cached.response(req), nil
+	}
+
+	resp, err := t.inner.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if isPing {
+		t.cache.recordRealm(resp)
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+			return resp, nil
+		}
+	} else if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	entry := cachedResponse{status: resp.StatusCode, header: resp.Header.Clone(), body: body}
+	if isPing {
+		entry.expires = t.cache.now().Add(pingLifetime)
+	} else {
+		entry.expires = t.cache.now().Add(tokenLifetime(body) - tokenExpiryMargin)
+	}
+	t.cache.put(key, entry)
+	return entry.response(req), nil
+}
+
+func (c *TokenCache) get(key string) (cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return cachedResponse{}, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, key)
+		return cachedResponse{}, false
+	}
+	return entry, true
+}
+
+func (c *TokenCache) put(key string, entry cachedResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+}
+
+// recordRealm records the token endpoint advertised in the challenge of a ping response,
+// so that the requests for tokens sent to it are cached.
+func (c *TokenCache) recordRealm(resp *http.Response) {
+	for _, challenge := range resp.Header.Values("WWW-Authenticate") {
+		scheme, params, _ := strings.Cut(challenge, " ")
+		if !strings.EqualFold(scheme, "bearer") {
+			continue
+		}
+		for _, param := range strings.Split(params, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "realm") {
+				c.mu.Lock()
+				c.realms[strings.Trim(value, `"`)] = true
+				c.mu.Unlock()
+			}
+		}
+	}
+}
+
+func (c *TokenCache) isRealm(req *http.Request) bool {
+	u := *req.URL
+	u.RawQuery = ""
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.realms[u.String()]
+}
+
+// cacheKey identifies a request by its URL, which includes the registry and, for token requests, the scope,
+// and by its credentials and body, which includes the scope of OAuth2 token requests.
+func cacheKey(req *http.Request) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.String() + "\n" + req.Header.Get("Authorization") + "\n"))
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return "", err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func tokenLifetime(body []byte) time.Duration {
+	var token struct {
+		ExpiresIn int `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.ExpiresIn <= 0 {
+		return defaultTokenLifetime
+	}
+	return time.Duration(token.ExpiresIn) * time.Second
+}
+
+func (e cachedResponse) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.status, http.StatusText(e.status)),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,35 @@
+package imgutil
+
+import (
+	"net/http"
+	"sync"
+)
+
+// TransportGetter returns the transport used to access the registry with the given setting, configured with the given remote options.
+type TransportGetter func(reg RegistrySetting, options RemoteOptions, logger Logger) http.RoundTripper
+
+var (
+	transportGetterMu sync.RWMutex
+	transportGetter   TransportGetter
+)
+
+// RegisterTransportGetter makes the getter used to push indexes available.
+// The remote package registers a getter with its custom transports, proxies, certificate authorities, token cache,
+// rate limit retries and bandwidth limits when it is imported.
+func RegisterTransportGetter(getter TransportGetter) {
+	transportGetterMu.Lock()
+	defer transportGetterMu.Unlock()
+	transportGetter = getter
+}
+
+// registryTransport returns the transport of the getter registered with RegisterTransportGetter,
+// or the default transport for the registry if the remote package is not imported.
+func registryTransport(reg RegistrySetting, options RemoteOptions, logger Logger) http.RoundTripper {
+	transportGetterMu.RLock()
+	getter := transportGetter
+	transportGetterMu.RUnlock()
+	if getter == nil {
+		return GetTransport(reg.Insecure)
+	}
+	return getter(reg, options, logger)
+}
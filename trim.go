@@ -0,0 +1,110 @@
+package imgutil
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// BuildOnlyLayerMarker is the history comment of layers that are only needed to build the image,
+// which are removed by TrimBuildLayers. It is kept when history is not preserved, and removed when the image is saved,
+// after which TrimBuildLayers still removes the layers it marked.
+const BuildOnlyLayerMarker = "imgutil:build-only"
+
+// BuildOnlyHistory returns the history marked as the history of a build-only layer, to add the layer with,
+// e.g., with AddLayerWithDiffIDAndHistory. The comment of the history is replaced with BuildOnlyLayerMarker.
+func BuildOnlyHistory(history v1.History) v1.History {
+	history.Comment = BuildOnlyLayerMarker
+	return history
+}
+
+func isBuildOnly(history v1.History) bool {
+	return history.Comment == BuildOnlyLayerMarker
+}
+
+// stripBuildOnlyMarkers removes the build-only marker from the normalized history of the config, so that it is not saved,
+// and records the layers it marked for TrimBuildLayers.
+func (i *CNBImageCore) stripBuildOnlyMarkers(c *v1.ConfigFile) {
+	for j := range c.History {
+		if !isBuildOnly(c.History[j]) || j >= len(c.RootFS.DiffIDs) {
+			continue
+		}
+		if i.buildOnlyDiffIDs == nil {
+			i.buildOnlyDiffIDs = make(map[v1.Hash]bool)
+		}
+		i.buildOnlyDiffIDs[c.RootFS.DiffIDs[j]] = true
+		c.History[j].Comment = ""
+	}
+}
+
+// zeroHistory returns the history recorded when history is not preserved, which only keeps the build-only marker.
+func zeroHistory(history v1.History, createdAt v1.Time) v1.History {
+	zeroed := v1.History{Created: createdAt}
+	if isBuildOnly(history) {
+		zeroed.Comment = BuildOnlyLayerMarker
+	}
+	return zeroed
+}
+
+// TrimBuildLayers removes the layers that were added with a history marked by BuildOnlyHistory,
+// producing the runtime image. The history and annotations of the other layers are kept.
+// It fails if the image has build-only layers but its history does not match its layers,
+// as the layers that are build-only cannot be told apart then.
+func (i *CNBImageCore) TrimBuildLayers() error {
+	configFile, err := getConfigFile(i.Image)
+	if err != nil {
+		return err
+	}
+	manifest, err := getManifest(i.Image)
+	if err != nil {
+		return err
+	}
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return err
+	}
+	if len(manifest.Layers) != len(layers) {
+		return fmt.Errorf("manifest has %d layers; image has %d", len(manifest.Layers), len(layers))
+	}
+
+	if n := nonEmptyHistoryCount(configFile.History); configFile.History != nil && n != len(layers) {
+		for _, history := range configFile.History {
+			if isBuildOnly(history) {
+				return fmt.Errorf("history has %d entries for non-empty layers; image has %d layers", n, len(layers))
+			}
+		}
+	}
+
+	var (
+		history     = NormalizedHistory(configFile.History, len(layers))
+		keptLayers  []v1.Layer
+		keptHistory []v1.History
+		annotations []map[string]string
+	)
+	for idx, layer := range layers {
+		if isBuildOnly(history[idx]) || (idx < len(configFile.RootFS.DiffIDs) && i.buildOnlyDiffIDs[configFile.RootFS.DiffIDs[idx]]) {
+			continue
+		}
+		keptLayers = append(keptLayers, layer)
+		keptHistory = append(keptHistory, history[idx])
+		annotations = append(annotations, manifest.Layers[idx].Annotations)
+	}
+	if len(keptLayers) == len(layers) {
+		return nil
+	}
+	i.Image, err = i.withLayers(configFile, keptLayers, keptHistory, annotations)
+	if err != nil {
+		return err
+	}
+	return i.checkInvariants("TrimBuildLayers")
+}
+
+func nonEmptyHistoryCount(history []v1.History) int {
+	var n int
+	for _, h := range history {
+		if !h.EmptyLayer {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,122 @@
+package imgutil_test
+
+import (
+	"os"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestTrim(t *testing.T) {
+	spec.Run(t, "Trim", testTrim, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testTrim(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "trim-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	addLayers := func(image *imgutil.CNBImageCore) []v1.Hash {
+		var diffIDs []v1.Hash
+		for _, history := range []v1.History{
+			{CreatedBy: "launch-1"},
+			imgutil.BuildOnlyHistory(v1.History{CreatedBy: "build"}),
+			{CreatedBy: "launch-2"},
+		} {
+			layer, err := random.Layer(100, types.DockerLayer)
+			h.AssertNil(t, err)
+			h.AssertNil(t, image.AddLayerWithHistory(layer, history))
+			diffID, err := layer.DiffID()
+			h.AssertNil(t, err)
+			diffIDs = append(diffIDs, diffID)
+		}
+		return diffIDs
+	}
+
+	for _, preserveHistory := range []bool{true, false} {
+		preserveHistory := preserveHistory
+		when(map[bool]string{true: "history is preserved", false: "history is not preserved"}[preserveHistory], func() {
+			it("removes the build-only layers and their history", func() {
+				image, err := imgutil.NewCNBImage(imgutil.ImageOptions{
+					Platform:        imgutil.Platform{OS: "linux", Architecture: "amd64"},
+					PreserveHistory: preserveHistory,
+					TempDir:         tmpDir,
+				})
+				h.AssertNil(t, err)
+				diffIDs := addLayers(image)
+				h.AssertNil(t, image.SetCreatedAtAndHistory())
+				saved, err := image.ConfigFile()
+				h.AssertNil(t, err)
+				for _, history := range saved.History {
+					h.AssertEq(t, history.Comment, "")
+				}
+
+				h.AssertNil(t, image.TrimBuildLayers())
+
+				configFile, err := image.ConfigFile()
+				h.AssertNil(t, err)
+				h.AssertEq(t, configFile.RootFS.DiffIDs, []v1.Hash{diffIDs[0], diffIDs[2]})
+				h.AssertEq(t, len(configFile.History), 2)
+				for _, history := range configFile.History {
+					h.AssertEq(t, history.Comment, "")
+				}
+				if preserveHistory {
+					h.AssertEq(t, configFile.History[0].CreatedBy, "launch-1")
+					h.AssertEq(t, configFile.History[1].CreatedBy, "launch-2")
+				}
+				layers, err := image.Layers()
+				h.AssertNil(t, err)
+				h.AssertEq(t, len(layers), 2)
+			})
+		})
+	}
+
+	it("fails when the history does not match the layers", func() {
+		image, err := imgutil.NewCNBImage(imgutil.ImageOptions{
+			Platform:        imgutil.Platform{OS: "linux", Architecture: "amd64"},
+			PreserveHistory: true,
+			TempDir:         tmpDir,
+		})
+		h.AssertNil(t, err)
+		addLayers(image)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.History = append(configFile.History, v1.History{CreatedBy: "extra"})
+		image.Image, err = mutate.ConfigFile(image.Image, configFile)
+		h.AssertNil(t, err)
+
+		h.AssertError(t, image.TrimBuildLayers(), "history has 4 entries for non-empty layers; image has 3 layers")
+	})
+
+	it("does nothing when there are no build-only layers", func() {
+		image, err := imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "linux", Architecture: "amd64"}})
+		h.AssertNil(t, err)
+		layer, err := random.Layer(100, types.DockerLayer)
+		h.AssertNil(t, err)
+		h.AssertNil(t, image.AddLayerWithHistory(layer, v1.History{}))
+		digest, err := image.Digest()
+		h.AssertNil(t, err)
+
+		h.AssertNil(t, image.TrimBuildLayers())
+
+		actual, err := image.Digest()
+		h.AssertNil(t, err)
+		h.AssertEq(t, actual, digest)
+	})
+}
@@ -0,0 +1,255 @@
+package imgutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// TrustSignatureSuffix is appended to the path of a signed trust metadata file to get the path of its detached signature.
+const TrustSignatureSuffix = ".sig"
+
+// TrustStore provides the base image digests approved for supply-chain-locked builds; see WithTrustStore.
+// FileTrustStore reads them from a file; remote.TrustStore reads them from an artifact in a registry.
+type TrustStore interface {
+	// Approved reports whether the image with the given digest may be used as a base image from the given repository,
+	// named as by name.Repository.Name (e.g. index.docker.io/library/ubuntu).
+	Approved(repository string, digest v1.Hash) (bool, error)
+}
+
+// TrustSignFunc signs serialized trust metadata, e.g. with a KMS key or a local private key.
+type TrustSignFunc func(payload []byte) ([]byte, error)
+
+// TrustVerifyFunc verifies the signature of serialized trust metadata, returning an error if it is not valid.
+type TrustVerifyFunc func(payload, signature []byte) error
+
+// TrustMetadata records the approved base image digests, by repository.
+type TrustMetadata struct {
+	Approved map[string][]string `json:"approved"`
+}
+
+// Approve adds the digest of the reference to the digests approved for its repository.
+func (m *TrustMetadata) Approve(ref name.Digest) {
+	if m.Approved == nil {
+		m.Approved = make(map[string][]string)
+	}
+	repository := ref.Context().Name()
+	for _, digest := range m.Approved[repository] {
+		if digest == ref.DigestStr() {
+			return
+		}
+	}
+	m.Approved[repository] = append(m.Approved[repository], ref.DigestStr())
+	sort.Strings(m.Approved[repository])
+}
+
+// Revoke removes the digest of the reference from the digests approved for its repository.
+func (m *TrustMetadata) Revoke(ref name.Digest) {
+	repository := ref.Context().Name()
+	digests := m.Approved[repository]
+	for idx, digest := range digests {
+		if digest == ref.DigestStr() {
+			m.Approved[repository] = append(digests[:idx:idx], digests[idx+1:]...)
+			break
+		}
+	}
+	if len(m.Approved[repository]) == 0 {
+		delete(m.Approved, repository)
+	}
+}
+
+// IsApproved reports whether the digest is approved for the repository.
+func (m TrustMetadata) IsApproved(repository string, digest v1.Hash) bool {
+	for _, approved := range m.Approved[repository] {
+		if approved == digest.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustMetadata parses serialized trust metadata, verifying its signature first if verify is not nil.
+func ParseTrustMetadata(payload, signature []byte, verify TrustVerifyFunc) (TrustMetadata, error) {
+	if verify != nil {
+		if err := verify(payload, signature); err != nil {
+			return TrustMetadata{}, fmt.Errorf("verifying trust metadata: %w", err)
+		}
+	}
+	var metadata TrustMetadata
+	if err := json.Unmarshal(payload, &metadata); err != nil {
+		return TrustMetadata{}, fmt.Errorf("parsing trust metadata: %w", err)
+	}
+	return metadata, nil
+}
+
+// FileTrustStore is a TrustStore backed by a trust metadata file, written with WriteTrustMetadata.
+// If a verifier is provided, the file must have a valid detached signature, at its path with TrustSignatureSuffix.
+// The file is read each time a digest is checked, so that revoked digests are not approved anymore.
+type FileTrustStore struct {
+	path   string
+	verify TrustVerifyFunc
+}
+
+// NewFileTrustStore returns a FileTrustStore backed by the file at the provided path.
+// If verify is nil, the file is not required to be signed.
+func NewFileTrustStore(path string, verify TrustVerifyFunc) *FileTrustStore {
+	return &FileTrustStore{path: path, verify: verify}
+}
+
+// Metadata returns the trust metadata in the file, once its signature is verified.
+// A missing file approves no digest.
+func (s *FileTrustStore) Metadata() (TrustMetadata, error) {
+	payload, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return TrustMetadata{}, nil
+		}
+		return TrustMetadata{}, fmt.Errorf("reading trust metadata: %w", err)
+	}
+	var signature []byte
+	if s.verify != nil {
+		if signature, err = os.ReadFile(s.path + TrustSignatureSuffix); err != nil {
+			return TrustMetadata{}, fmt.Errorf("reading trust metadata signature: %w", err)
+		}
+	}
+	return ParseTrustMetadata(payload, signature, s.verify)
+}
+
+func (s *FileTrustStore) Approved(repository string, digest v1.Hash) (bool, error) {
+	metadata, err := s.Metadata()
+	if err != nil {
+		return false, err
+	}
+	return metadata.IsApproved(repository, digest), nil
+}
+
+// WriteTrustMetadata replaces the trust metadata file at the provided path atomically,
+// along with its detached signature if sign is not nil.
+func WriteTrustMetadata(path string, metadata TrustMetadata, sign TrustSignFunc) error {
+	payload, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	if sign != nil {
+		signature, err := sign(payload)
+		if err != nil {
+			return fmt.Errorf("signing trust metadata: %w", err)
+		}
+		if err = writeFileAtomically(path+TrustSignatureSuffix, signature); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomically(path, payload)
+}
+
+func writeFileAtomically(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ErrUntrustedBaseImage is returned by image constructors, when a trust store is provided with WithTrustStore,
+// if the base image resolves to a digest that is not approved by the store (or is not found, in which case Digests is empty).
+type ErrUntrustedBaseImage struct {
+	Repository string
+	Digests    []v1.Hash
+}
+
+func (e ErrUntrustedBaseImage) Error() string {
+	if len(e.Digests) == 0 {
+		return fmt.Sprintf("base image from %s was not found and cannot be approved by the trust store", e.Repository)
+	}
+	return fmt.Sprintf("base image from %s with digest %v is not approved by the trust store", e.Repository, e.Digests)
+}
+
+// CheckTrustedBaseImage returns an ErrUntrustedBaseImage unless one of the digests the base image resolved to
+// (e.g. the digest of an index and that of the image selected from it) is approved by the trust store in the options.
+// It does nothing if no trust store was configured with WithTrustStore, or no base image was requested with FromBaseImage.
+func CheckTrustedBaseImage(options *ImageOptions, digests ...v1.Hash) error {
+	if options.TrustStore == nil || options.BaseImageRepoName == "" {
+		return nil
+	}
+	ref, err := name.ParseReference(options.BaseImageRepoName, name.WeakValidation)
+	if err != nil {
+		return err
+	}
+	repository := ref.Context().Name()
+	for _, digest := range digests {
+		approved, err := options.TrustStore.Approved(repository, digest)
+		if err != nil {
+			return fmt.Errorf("checking trust of base image %s: %w", options.BaseImageRepoName, err)
+		}
+		if approved {
+			return nil
+		}
+	}
+	return ErrUntrustedBaseImage{Repository: repository, Digests: digests}
+}
+
+// Verifier verifies an image or index before it is used as a base, e.g. by checking its cosign or notation signatures,
+// returning an error if it must not be used. It is given the descriptor the base image reference resolved to,
+// which is that of the index for a multi-platform base image.
+type Verifier func(desc v1.Descriptor) error
+
+// ErrVerificationFailed is returned by constructors when the Verifier rejects the base image or index.
+type ErrVerificationFailed struct {
+	Name   string
+	Digest v1.Hash
+	Err    error
+}
+
+func (e ErrVerificationFailed) Error() string {
+	return fmt.Sprintf("verification of %s with digest %s failed: %s", e.Name, e.Digest, e.Err)
+}
+
+func (e ErrVerificationFailed) Unwrap() error {
+	return e.Err
+}
+
+// ErrUnexpectedBaseImageDigest is returned by image constructors, when a digest is expected for the base image,
+// if the base image resolves to other digests (or is not found, in which case Digests is empty).
+type ErrUnexpectedBaseImageDigest struct {
+	BaseImageRepoName string
+	Expected          v1.Hash
+	Digests           []v1.Hash
+}
+
+func (e ErrUnexpectedBaseImageDigest) Error() string {
+	if len(e.Digests) == 0 {
+		return fmt.Sprintf("base image %s with expected digest %s was not found", e.BaseImageRepoName, e.Expected)
+	}
+	return fmt.Sprintf("base image %s resolved to digest %v; expected %s", e.BaseImageRepoName, e.Digests, e.Expected)
+}
+
+// CheckExpectedBaseImageDigest returns an ErrUnexpectedBaseImageDigest unless one of the digests the base image resolved to
+// (e.g. the digest of an index and that of the image selected from it) is the digest expected in the options.
+// It does nothing if no digest is expected, or no base image was requested with FromBaseImage.
+func CheckExpectedBaseImageDigest(options *ImageOptions, digests ...v1.Hash) error {
+	if options.ExpectedDigest == (v1.Hash{}) || options.BaseImageRepoName == "" {
+		return nil
+	}
+	for _, digest := range digests {
+		if digest == options.ExpectedDigest {
+			return nil
+		}
+	}
+	return ErrUnexpectedBaseImageDigest{BaseImageRepoName: options.BaseImageRepoName, Expected: options.ExpectedDigest, Digests: digests}
+}
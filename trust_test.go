@@ -0,0 +1,131 @@
+package imgutil_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestTrust(t *testing.T) {
+	spec.Run(t, "Trust", testTrust, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testTrust(t *testing.T, when spec.G, it spec.S) {
+	var (
+		tmpDir     string
+		path       string
+		ref        name.Digest
+		digest     v1.Hash
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+	)
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "trust-test")
+		h.AssertNil(t, err)
+		path = filepath.Join(tmpDir, "trust.json")
+		ref, err = name.NewDigest("some-registry.io/run@sha256:b9d056b83bb6446fee29e89a7fcf10203c562c1f59586a6e2f39c903597bda34")
+		h.AssertNil(t, err)
+		digest, err = v1.NewHash(ref.DigestStr())
+		h.AssertNil(t, err)
+		publicKey, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	sign := func(payload []byte) ([]byte, error) {
+		return ed25519.Sign(privateKey, payload), nil
+	}
+	verify := func(payload, signature []byte) error {
+		if !ed25519.Verify(publicKey, payload, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+
+	when("#TrustMetadata", func() {
+		it("approves and revokes digests by repository", func() {
+			var metadata imgutil.TrustMetadata
+			metadata.Approve(ref)
+			metadata.Approve(ref)
+			h.AssertEq(t, metadata.Approved, map[string][]string{"some-registry.io/run": {ref.DigestStr()}})
+			h.AssertEq(t, metadata.IsApproved("some-registry.io/run", digest), true)
+			h.AssertEq(t, metadata.IsApproved("some-registry.io/other", digest), false)
+
+			metadata.Revoke(ref)
+			h.AssertEq(t, metadata.IsApproved("some-registry.io/run", digest), false)
+			h.AssertEq(t, len(metadata.Approved), 0)
+		})
+	})
+
+	when("#FileTrustStore", func() {
+		it("reads signed metadata", func() {
+			var metadata imgutil.TrustMetadata
+			metadata.Approve(ref)
+			h.AssertNil(t, imgutil.WriteTrustMetadata(path, metadata, sign))
+
+			approved, err := imgutil.NewFileTrustStore(path, verify).Approved("some-registry.io/run", digest)
+			h.AssertNil(t, err)
+			h.AssertEq(t, approved, true)
+		})
+
+		it("rejects tampered metadata", func() {
+			h.AssertNil(t, imgutil.WriteTrustMetadata(path, imgutil.TrustMetadata{}, sign))
+			var metadata imgutil.TrustMetadata
+			metadata.Approve(ref)
+			h.AssertNil(t, imgutil.WriteTrustMetadata(path, metadata, nil))
+
+			_, err := imgutil.NewFileTrustStore(path, verify).Approved("some-registry.io/run", digest)
+			h.AssertError(t, err, "invalid signature")
+		})
+
+		it("approves nothing if the file does not exist", func() {
+			approved, err := imgutil.NewFileTrustStore(path, nil).Approved("some-registry.io/run", digest)
+			h.AssertNil(t, err)
+			h.AssertEq(t, approved, false)
+		})
+	})
+
+	when("#CheckTrustedBaseImage", func() {
+		var options imgutil.ImageOptions
+
+		it.Before(func() {
+			var metadata imgutil.TrustMetadata
+			metadata.Approve(ref)
+			h.AssertNil(t, imgutil.WriteTrustMetadata(path, metadata, nil))
+			options = imgutil.ImageOptions{}
+			imgutil.FromBaseImage("some-registry.io/run:latest")(&options)
+			imgutil.WithTrustStore(imgutil.NewFileTrustStore(path, nil))(&options)
+		})
+
+		it("accepts a base image resolved to an approved digest", func() {
+			other, err := v1.NewHash("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+			h.AssertNil(t, err)
+			h.AssertNil(t, imgutil.CheckTrustedBaseImage(&options, other, digest))
+		})
+
+		it("rejects a base image resolved to another digest", func() {
+			other, err := v1.NewHash("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+			h.AssertNil(t, err)
+			err = imgutil.CheckTrustedBaseImage(&options, other)
+			var untrusted imgutil.ErrUntrustedBaseImage
+			h.AssertEq(t, errors.As(err, &untrusted), true)
+			h.AssertEq(t, untrusted.Repository, "some-registry.io/run")
+		})
+	})
+}
@@ -1,8 +1,14 @@
 package imgutil
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/empty"
@@ -37,20 +43,29 @@ func GetManifest(image v1.Image) (*v1.Manifest, error) {
 // TaggableIndex any ImageIndex with RawManifest method.
 type TaggableIndex struct {
 	*v1.IndexManifest
+	// ArtifactType is the artifactType of the index manifest, which v1.IndexManifest does not have a field for.
+	ArtifactType string
+	// Canonical causes RawManifest to encode the index manifest with Canonicalize.
+	Canonical bool
 }
 
-// RawManifest returns the bytes of IndexManifest.
+// RawManifest returns the bytes of IndexManifest, with the ArtifactType if it is set.
 func (t *TaggableIndex) RawManifest() ([]byte, error) {
-	return json.Marshal(t.IndexManifest)
+	marshal := json.Marshal
+	if t.Canonical {
+		marshal = canonicalJSON
+	}
+	if t.ArtifactType == "" {
+		return marshal(t.IndexManifest)
+	}
+	return marshal(struct {
+		*v1.IndexManifest
+		ArtifactType string `json:"artifactType"`
+	}{t.IndexManifest, t.ArtifactType})
 }
 
-// Digest returns the Digest of the IndexManifest if present.
-// Else generate a new Digest.
+// Digest returns the Digest of the RawManifest.
 func (t *TaggableIndex) Digest() (v1.Hash, error) {
-	if t.IndexManifest.Subject != nil && t.IndexManifest.Subject.Digest != (v1.Hash{}) {
-		return t.IndexManifest.Subject.Digest, nil
-	}
-
 	return partial.Digest(t)
 }
 
@@ -59,13 +74,8 @@ func (t *TaggableIndex) MediaType() (types.MediaType, error) {
 	return t.IndexManifest.MediaType, nil
 }
 
-// Size returns the Size of IndexManifest if present.
-// Calculate the Size of empty.
+// Size returns the Size of the RawManifest.
 func (t *TaggableIndex) Size() (int64, error) {
-	if t.IndexManifest.Subject != nil && t.IndexManifest.Subject.Size != 0 {
-		return t.IndexManifest.Subject.Size, nil
-	}
-
 	return partial.Size(t)
 }
 
@@ -107,15 +117,146 @@ func (s *StringSet) StringSlice() (slice []string) {
 	return slice
 }
 
+// maxFileSafeNameLength keeps names well below the 255 byte limit on file name length,
+// and leaves room for the parent directories and blob paths within the 260 character MAX_PATH on Windows.
+const maxFileSafeNameLength = 100
+
+// windowsReservedNames cannot be used as file names on Windows, with or without an extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
 // MakeFileSafeName Change a reference name string into a valid file name
 // Ex: cnbs/sample-package:hello-multiarch-universe
 // to cnbs_sample-package-hello-multiarch-universe
+// The name is safe to use on Windows and on case-insensitive file systems:
+// characters Windows does not allow are replaced, reserved device names are prefixed,
+// and names that differ only in case or are too long get a suffix derived from the reference, so they never collide.
 func MakeFileSafeName(ref string) string {
+	fileName := strings.ReplaceAll(ref, ":", "-")
+	fileName = strings.ReplaceAll(fileName, "/", "_")
+	fileName = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`<>"\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, fileName)
+	// Windows silently drops trailing dots and spaces
+	if trimmed := strings.TrimRight(fileName, ". "); trimmed != fileName {
+		fileName = trimmed + "_"
+	}
+	if stem, _, _ := strings.Cut(fileName, "."); windowsReservedNames[strings.ToUpper(stem)] {
+		fileName = "_" + fileName
+	}
+
+	if fileName == strings.ToLower(fileName) && len(fileName) <= maxFileSafeNameLength {
+		return fileName
+	}
+	suffix := fmt.Sprintf("-%x", sha256.Sum256([]byte(ref)))[:9]
+	if maxLength := maxFileSafeNameLength - len(suffix); len(fileName) > maxLength {
+		// do not split a multi-byte character
+		for maxLength > 0 && !utf8.RuneStart(fileName[maxLength]) {
+			maxLength--
+		}
+		fileName = fileName[:maxLength]
+	}
+	return fileName + suffix
+}
+
+// legacyFileSafeName is the name MakeFileSafeName returned before names were made safe on every file system.
+func legacyFileSafeName(ref string) string {
 	fileName := strings.ReplaceAll(ref, ":", "-")
 	return strings.ReplaceAll(fileName, "/", "_")
 }
 
+// StorePath returns the directory of the index `ref` in the XDG store at `xdgPath`, named with MakeFileSafeName.
+// Indexes saved before MakeFileSafeName made names safe on every file system are found under their previous name
+// until they are saved again. The path is a LongPath, so that indexes with long names can be stored on Windows.
+func StorePath(xdgPath, ref string) string {
+	path := storeDir(xdgPath, ref)
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	legacyPath := LongPath(filepath.Join(xdgPath, legacyFileSafeName(ref)))
+	if legacyPath == path {
+		return path
+	}
+	if _, err := os.Stat(legacyPath); err == nil {
+		return legacyPath
+	}
+	return path
+}
+
+// removeLegacyStorePath removes the copy of the index `ref` saved under its previous name in the XDG store, if any.
+// Names returned by MakeFileSafeName never match a previous name that differs from the current one,
+// so this cannot remove another index.
+func removeLegacyStorePath(xdgPath, ref string) error {
+	if legacyFileSafeName(ref) == MakeFileSafeName(ref) {
+		return nil
+	}
+	return os.RemoveAll(LongPath(filepath.Join(xdgPath, legacyFileSafeName(ref))))
+}
+
+// storeDir returns the directory the index `ref` is saved to in the XDG store at `xdgPath`; see StorePath.
+func storeDir(xdgPath, ref string) string {
+	return LongPath(filepath.Join(xdgPath, MakeFileSafeName(ref)))
+}
+
 func NewEmptyDockerIndex() v1.ImageIndex {
 	idx := empty.Index
 	return mutate.IndexMediaType(idx, types.DockerManifestList)
 }
+
+// copyDescriptor returns a deep copy of the descriptor, so that changing the copy does not change the index it was read from.
+func copyDescriptor(desc v1.Descriptor) v1.Descriptor {
+	desc.Annotations = copyMap(desc.Annotations)
+	if desc.URLs != nil {
+		desc.URLs = append([]string{}, desc.URLs...)
+	}
+	if desc.Data != nil {
+		desc.Data = append([]byte{}, desc.Data...)
+	}
+	if desc.Platform != nil {
+		platform := *desc.Platform
+		if platform.OSFeatures != nil {
+			platform.OSFeatures = append([]string{}, platform.OSFeatures...)
+		}
+		if platform.Features != nil {
+			platform.Features = append([]string{}, platform.Features...)
+		}
+		desc.Platform = &platform
+	}
+	return desc
+}
+
+// NormalizePort returns the port in the form used for exposed ports in image configs, "port/protocol",
+// defaulting the protocol to tcp. It returns an error if the port number or protocol is invalid.
+func NormalizePort(port string) (string, error) {
+	number, protocol, found := strings.Cut(port, "/")
+	if !found {
+		protocol = "tcp"
+	}
+	protocol = strings.ToLower(protocol)
+	if n, err := strconv.Atoi(number); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port number in %q", port)
+	}
+	switch protocol {
+	case "tcp", "udp", "sctp":
+	default:
+		return "", fmt.Errorf("invalid protocol in %q: must be tcp, udp or sctp", port)
+	}
+	return number + "/" + protocol, nil
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for k, v := range m {
+		copied[k] = v
+	}
+	return copied
+}
@@ -2,7 +2,11 @@ package imgutil_test
 
 import (
 	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"unicode/utf8"
 
 	v1 "github.com/google/go-containerregistry/pkg/v1"
 	"github.com/google/go-containerregistry/pkg/v1/types"
@@ -83,6 +87,18 @@ func testUtils(t *testing.T, when spec.G, it spec.S) {
 			h.AssertNil(t, err)
 			h.AssertEq(t, digest.String(), "sha256:2375c0dfd06dd51b313fd97df5ecf3b175380e895287dd9eb2240b13eb0b5703")
 		})
+		it("should return RawManifest encoded canonically when Canonical is set", func() {
+			taggableIndex.Canonical = true
+			mfestBytes, err := taggableIndex.RawManifest()
+			h.AssertNil(t, err)
+
+			expectedMfestBytes, err := json.Marshal(indexManifest)
+			h.AssertNil(t, err)
+			expectedMfestBytes, err = imgutil.Canonicalize(expectedMfestBytes)
+			h.AssertNil(t, err)
+
+			h.AssertEq(t, mfestBytes, expectedMfestBytes)
+		})
 		it("should return expected size", func() {
 			size, err := taggableIndex.Size()
 			h.AssertNil(t, err)
@@ -156,6 +172,93 @@ func testUtils(t *testing.T, when spec.G, it spec.S) {
 		})
 	})
 
+	when("#MakeFileSafeName", func() {
+		it("replaces path separators and tag delimiters", func() {
+			h.AssertEq(t, imgutil.MakeFileSafeName("cnbs/sample-package:hello-multiarch-universe"), "cnbs_sample-package-hello-multiarch-universe")
+		})
+
+		it("does not collide for names that only differ in case", func() {
+			lower := imgutil.MakeFileSafeName("some/repo:tag")
+			upper := imgutil.MakeFileSafeName("some/repo:TAG")
+			h.AssertNotEq(t, strings.ToLower(lower), strings.ToLower(upper))
+		})
+
+		it("prefixes names reserved on windows", func() {
+			h.AssertEq(t, imgutil.MakeFileSafeName("con"), "_con")
+			h.AssertEq(t, imgutil.MakeFileSafeName("nul.tar"), "_nul.tar")
+		})
+
+		it("replaces characters and trailing dots that are invalid on windows", func() {
+			h.AssertEq(t, imgutil.MakeFileSafeName(`some\repo*?.`), "some_repo___")
+		})
+
+		it("limits the length of the name", func() {
+			name := imgutil.MakeFileSafeName("some/repo:" + strings.Repeat("a", 200))
+			h.AssertEq(t, len(name), 100)
+			h.AssertNotEq(t, name, imgutil.MakeFileSafeName("some/repo:"+strings.Repeat("a", 201)))
+		})
+
+		it("does not split multi-byte characters when limiting the length", func() {
+			for _, padding := range []int{0, 1, 2} {
+				name := imgutil.MakeFileSafeName("some/repo:" + strings.Repeat("a", padding) + strings.Repeat("é", 100))
+				h.AssertEq(t, utf8.ValidString(name), true)
+				h.AssertEq(t, len(name) <= 100, true)
+			}
+		})
+	})
+
+	when("#StorePath", func() {
+		var xdgPath string
+
+		it.Before(func() {
+			var err error
+			xdgPath, err = os.MkdirTemp("", "store-path")
+			h.AssertNil(t, err)
+		})
+
+		it.After(func() {
+			h.AssertNil(t, os.RemoveAll(xdgPath))
+		})
+
+		it("returns the path named with MakeFileSafeName", func() {
+			h.AssertEq(t, imgutil.StorePath(xdgPath, "some/Repo:TAG"), filepath.Join(xdgPath, imgutil.MakeFileSafeName("some/Repo:TAG")))
+		})
+
+		it("finds indexes saved under their previous name", func() {
+			legacyPath := filepath.Join(xdgPath, "some_Repo-TAG")
+			h.AssertNil(t, os.MkdirAll(legacyPath, 0755))
+			h.AssertEq(t, imgutil.StorePath(xdgPath, "some/Repo:TAG"), legacyPath)
+		})
+
+		it("prefers the current name", func() {
+			h.AssertNil(t, os.MkdirAll(filepath.Join(xdgPath, "some_Repo-TAG"), 0755))
+			path := filepath.Join(xdgPath, imgutil.MakeFileSafeName("some/Repo:TAG"))
+			h.AssertNil(t, os.MkdirAll(path, 0755))
+			h.AssertEq(t, imgutil.StorePath(xdgPath, "some/Repo:TAG"), path)
+		})
+	})
+
+	when("#NormalizePort", func() {
+		it("defaults the protocol to tcp", func() {
+			port, err := imgutil.NormalizePort("8080")
+			h.AssertNil(t, err)
+			h.AssertEq(t, port, "8080/tcp")
+		})
+
+		it("keeps the provided protocol", func() {
+			port, err := imgutil.NormalizePort("53/UDP")
+			h.AssertNil(t, err)
+			h.AssertEq(t, port, "53/udp")
+		})
+
+		it("errors on invalid ports", func() {
+			for _, port := range []string{"", "http", "0", "70000/tcp", "8080/icmp"} {
+				_, err := imgutil.NormalizePort(port)
+				h.AssertNotNil(t, err)
+			}
+		})
+	})
+
 	when("#NewEmptyDockerIndex", func() {
 		it("should return an empty docker index", func() {
 			idx := imgutil.NewEmptyDockerIndex()
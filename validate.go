@@ -0,0 +1,140 @@
+package imgutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// ValidationReport lists every problem found by Validate in an index or image, and in the manifests, configs and layers
+// it refers to, instead of failing on the first one.
+type ValidationReport struct {
+	Violations []SpecViolation
+}
+
+// Valid reports whether no problem was found.
+func (r ValidationReport) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+// Err returns an ErrSpecViolations listing the problems found in the named index or image, or nil if there are none.
+func (r ValidationReport) Err(name string) error {
+	if r.Valid() {
+		return nil
+	}
+	return ErrSpecViolations{Name: name, Violations: r.Violations}
+}
+
+// Validate deeply checks the index and everything it refers to. Besides the checks of ValidateIndexSpec, every manifest
+// of the index must be readable, so that there is no dangling reference, and match the digest, size and media type of its
+// descriptor; images must have a platform; and the images and nested indexes are themselves validated, with the fields
+// of their violations prefixed by the descriptor they are found through, e.g. "index.manifests[0].manifest.layers[1].size".
+// It returns an error only if the index itself cannot be read.
+func Validate(index ImageIndex) (ValidationReport, error) {
+	cnbIndex, ok := index.(interface{ v1Index() v1.ImageIndex })
+	if !ok {
+		return ValidationReport{}, errors.New("index cannot be validated: it does not expose its manifests")
+	}
+	var vs specViolations
+	if err := vs.validateIndex("", cnbIndex.v1Index()); err != nil {
+		return ValidationReport{}, err
+	}
+	return ValidationReport{Violations: vs}, nil
+}
+
+// v1Index returns the working index, also for the index types that embed a CNBIndex.
+func (h *CNBIndex) v1Index() v1.ImageIndex {
+	return h.ImageIndex
+}
+
+// Validate deeply checks the image with ValidateImageSpec, reading its config and layers, and returns every problem found.
+func (i *CNBImageCore) Validate() (ValidationReport, error) {
+	violations, err := ValidateImageSpec(i)
+	if err != nil {
+		return ValidationReport{}, err
+	}
+	return ValidationReport{Violations: violations}, nil
+}
+
+func (vs *specViolations) validateIndex(prefix string, index v1.ImageIndex) error {
+	violations, err := ValidateIndexSpec(index)
+	if err != nil {
+		return err
+	}
+	vs.addWithPrefix(prefix, violations)
+	indexManifest, err := getIndexManifest(index)
+	if err != nil {
+		return err
+	}
+	for idx, desc := range indexManifest.Manifests {
+		field := fmt.Sprintf("%sindex.manifests[%d]", prefix, idx)
+		switch {
+		case desc.MediaType.IsIndex():
+			child, err := index.ImageIndex(desc.Digest)
+			if err != nil {
+				vs.add(field, SpecIndexProperties, "index %s cannot be read: %s", desc.Digest, err)
+				continue
+			}
+			if vs.checkManifestBlob(field, desc, child) {
+				if err = vs.validateIndex(field+".", child); err != nil {
+					vs.add(field, SpecIndexProperties, "index %s cannot be read: %s", desc.Digest, err)
+				}
+			}
+		case desc.MediaType.IsImage():
+			if desc.Platform == nil && !isAttestation(desc) {
+				vs.add(field+".platform", SpecIndexProperties, "platform is required to select the image from the index")
+			}
+			image, err := index.Image(desc.Digest)
+			if err != nil {
+				vs.add(field, SpecIndexProperties, "image %s cannot be read: %s", desc.Digest, err)
+				continue
+			}
+			if vs.checkManifestBlob(field, desc, image) {
+				violations, err := ValidateImageSpec(image)
+				if err != nil {
+					vs.add(field, SpecIndexProperties, "image %s cannot be read: %s", desc.Digest, err)
+					continue
+				}
+				vs.addWithPrefix(field+".", violations)
+			}
+		}
+	}
+	return nil
+}
+
+// checkManifestBlob checks that the manifest of an index or image can be read and matches its descriptor,
+// reporting whether it could be read.
+func (vs *specViolations) checkManifestBlob(field string, desc v1.Descriptor, manifest interface {
+	RawManifest() ([]byte, error)
+	MediaType() (types.MediaType, error)
+}) bool {
+	raw, err := manifest.RawManifest()
+	if err != nil {
+		vs.add(field, SpecIndexProperties, "manifest %s cannot be read: %s", desc.Digest, err)
+		return false
+	}
+	digest, size, err := v1.SHA256(bytes.NewReader(raw))
+	if err != nil {
+		return false
+	}
+	if desc.Digest != digest {
+		vs.add(field+".digest", SpecDescriptorProperties, "%s does not match the manifest blob digest %s", desc.Digest, digest)
+	}
+	if desc.Size != size {
+		vs.add(field+".size", SpecDescriptorProperties, "%d does not match the manifest blob size %d", desc.Size, size)
+	}
+	if mediaType, err := manifest.MediaType(); err == nil && mediaType != "" && mediaType != desc.MediaType {
+		vs.add(field+".mediaType", SpecMediaTypes, "%s does not match the manifest media type %s", desc.MediaType, mediaType)
+	}
+	return true
+}
+
+func (vs *specViolations) addWithPrefix(prefix string, violations []SpecViolation) {
+	for _, v := range violations {
+		v.Field = prefix + v.Field
+		*vs = append(*vs, v)
+	}
+}
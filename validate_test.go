@@ -0,0 +1,135 @@
+package imgutil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	ggcrlayout "github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	"github.com/buildpacks/imgutil/layout"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestValidate(t *testing.T) {
+	spec.Run(t, "Validate", testValidate, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testValidate(t *testing.T, when spec.G, it spec.S) {
+	var tmpDir string
+
+	it.Before(func() {
+		var err error
+		tmpDir, err = os.MkdirTemp("", "validate-test")
+		h.AssertNil(t, err)
+	})
+
+	it.After(func() {
+		h.AssertNil(t, os.RemoveAll(tmpDir))
+	})
+
+	newImage := func(variant string) v1.Image {
+		image, err := random.Image(100, 2)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS, configFile.Architecture, configFile.Variant = "linux", "amd64", variant
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		return image
+	}
+
+	// layoutIndex returns an index read from a layout with the given descriptors.
+	layoutIndex := func(descs ...v1.Descriptor) *imgutil.CNBIndex {
+		path, err := ggcrlayout.Write(filepath.Join(tmpDir, "index"), empty.Index)
+		h.AssertNil(t, err)
+		for _, desc := range descs {
+			h.AssertNil(t, path.AppendDescriptor(desc))
+		}
+		base, err := path.ImageIndex()
+		h.AssertNil(t, err)
+		index, err := imgutil.NewCNBIndex("some/index", imgutil.IndexOptions{BaseIndex: base})
+		h.AssertNil(t, err)
+		return index
+	}
+
+	writeImage := func(image v1.Image) v1.Descriptor {
+		path, err := ggcrlayout.Write(filepath.Join(tmpDir, "index"), empty.Index)
+		h.AssertNil(t, err)
+		h.AssertNil(t, path.WriteImage(image))
+		desc, err := partial.Descriptor(image)
+		h.AssertNil(t, err)
+		desc.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+		return *desc
+	}
+
+	fields := func(report imgutil.ValidationReport) []string {
+		var fields []string
+		for _, v := range report.Violations {
+			fields = append(fields, v.Field)
+		}
+		return fields
+	}
+
+	it("finds no problem in a valid index", func() {
+		index := layoutIndex(writeImage(newImage("v1")), writeImage(newImage("v2")))
+
+		report, err := imgutil.Validate(index)
+		h.AssertNil(t, err)
+		h.AssertEq(t, fields(report), []string(nil))
+		h.AssertEq(t, report.Valid(), true)
+		h.AssertNil(t, report.Err("some/index"))
+	})
+
+	it("reports every problem of the index and its images", func() {
+		valid := writeImage(newImage("v3"))
+		wrongSize := writeImage(newImage("v4"))
+		wrongSize.Size++
+		noPlatform := writeImage(newImage("v5"))
+		noPlatform.Platform = nil
+		dangling, err := partial.Descriptor(newImage("v6"))
+		h.AssertNil(t, err)
+		dangling.Platform = &v1.Platform{OS: "linux", Architecture: "amd64"}
+		index := layoutIndex(valid, wrongSize, noPlatform, *dangling)
+
+		report, err := imgutil.Validate(index)
+		h.AssertNil(t, err)
+		h.AssertEq(t, fields(report), []string{
+			"index.manifests[1].size",
+			"index.manifests[2].platform",
+			"index.manifests[3]",
+		})
+		h.AssertError(t, report.Err("some/index"), "some/index does not conform to the OCI image spec")
+	})
+
+	it("prefixes the problems of an image with its descriptor", func() {
+		image := newImage("v7")
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS = ""
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		index := layoutIndex(writeImage(image))
+
+		report, err := imgutil.Validate(index)
+		h.AssertNil(t, err)
+		h.AssertEq(t, fields(report), []string{"index.manifests[0].config.os"})
+	})
+
+	it("validates images", func() {
+		image, err := layout.NewImage(filepath.Join(tmpDir, "image"), layout.WithDefaultPlatform(imgutil.Platform{OS: "linux", Architecture: "arm64"}))
+		h.AssertNil(t, err)
+
+		report, err := image.Validate()
+		h.AssertNil(t, err)
+		h.AssertEq(t, report.Valid(), true)
+	})
+}
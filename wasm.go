@@ -0,0 +1,58 @@
+package imgutil
+
+import (
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+const (
+	// WasmArchitecture is the architecture of WebAssembly images.
+	WasmArchitecture = "wasm"
+	// WASIP1OS is the os of images targeting the WebAssembly System Interface preview 1, as with GOOS=wasip1.
+	WASIP1OS = "wasip1"
+	// WASIP2OS is the os of images targeting the WebAssembly System Interface preview 2.
+	WASIP2OS = "wasip2"
+
+	// WasmConfigMediaType and WasmLayerMediaType are the media types of Wasm OCI artifacts,
+	// whose config records the os and architecture like an image config does.
+	WasmConfigMediaType types.MediaType = "application/vnd.wasm.config.v0+json"
+	WasmLayerMediaType  types.MediaType = "application/vnd.wasm.content.layer.v1+wasm"
+)
+
+// wasiOSAliases maps the os values that are used interchangeably for WebAssembly images to each other:
+// docker records WASI preview 1 images as "wasi".
+var wasiOSAliases = map[string]string{
+	"wasi":   WASIP1OS,
+	WASIP1OS: "wasi",
+}
+
+// wasmOSes are the os values that are valid with the wasm architecture.
+var wasmOSes = map[string]bool{
+	"wasi":   true,
+	WASIP1OS: true,
+	WASIP2OS: true,
+	"js":     true,
+}
+
+// IsWasm reports whether the platform is a WebAssembly platform.
+func (p Platform) IsWasm() bool {
+	return p.Architecture == WasmArchitecture
+}
+
+// sameOS reports whether the os values refer to the same os, taking WebAssembly os aliases into account.
+func sameOS(a, b string) bool {
+	return a == b || wasiOSAliases[a] == b
+}
+
+// validatePlatform checks that WebAssembly os values are only used with the wasm architecture, and vice versa.
+// Other combinations are not checked, as images may be built for platforms imgutil does not know about.
+func validatePlatform(os, arch string) error {
+	switch {
+	case arch == WasmArchitecture && !wasmOSes[os]:
+		return fmt.Errorf("invalid platform '%s/%s': the %s architecture requires one of the wasi, %s, %s or js os", os, arch, WasmArchitecture, WASIP1OS, WASIP2OS)
+	case arch != WasmArchitecture && wasmOSes[os] && os != "js":
+		return fmt.Errorf("invalid platform '%s/%s': the %s os requires the %s architecture", os, arch, os, WasmArchitecture)
+	}
+	return nil
+}
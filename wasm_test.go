@@ -0,0 +1,89 @@
+package imgutil_test
+
+import (
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestWasm(t *testing.T) {
+	spec.Run(t, "Wasm", testWasm, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testWasm(t *testing.T, when spec.G, it spec.S) {
+	withPlatform := func(os, arch string) v1.Image {
+		image, err := random.Image(1024, 1)
+		h.AssertNil(t, err)
+		configFile, err := image.ConfigFile()
+		h.AssertNil(t, err)
+		configFile.OS, configFile.Architecture = os, arch
+		image, err = mutate.ConfigFile(image, configFile)
+		h.AssertNil(t, err)
+		return image
+	}
+
+	when("#NewCNBImage", func() {
+		it("creates wasip1/wasm images", func() {
+			image, err := imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "wasip1", Architecture: "wasm"}})
+			h.AssertNil(t, err)
+			os, err := image.OS()
+			h.AssertNil(t, err)
+			h.AssertEq(t, os, "wasip1")
+			arch, err := image.Architecture()
+			h.AssertNil(t, err)
+			h.AssertEq(t, arch, "wasm")
+		})
+
+		it("rejects wasm os values with other architectures", func() {
+			_, err := imgutil.NewCNBImage(imgutil.ImageOptions{Platform: imgutil.Platform{OS: "wasip1", Architecture: "amd64"}})
+			h.AssertError(t, err, "invalid platform 'wasip1/amd64'")
+		})
+
+		it("rejects the wasm architecture with other os values", func() {
+			_, err := imgutil.NewCNBImage(imgutil.ImageOptions{BaseImage: withPlatform("linux", "wasm")})
+			h.AssertError(t, err, "invalid platform 'linux/wasm'")
+		})
+	})
+
+	when("index", func() {
+		var index *imgutil.CNBIndex
+
+		it.Before(func() {
+			var err error
+			index, err = imgutil.NewCNBIndex("some-index", imgutil.IndexOptions{})
+			h.AssertNil(t, err)
+		})
+
+		it("records the platform of wasm children", func() {
+			image := withPlatform("wasip1", "wasm")
+			index.AddManifest(image)
+			h.AssertEq(t, index.Valid(), true)
+
+			digest, err := image.Digest()
+			h.AssertNil(t, err)
+			child, err := imgutil.ImageFromIndex(index.ImageIndex, imgutil.Platform{OS: "wasip1", Architecture: "wasm"})
+			h.AssertNil(t, err)
+			childDigest, err := child.Digest()
+			h.AssertNil(t, err)
+			h.AssertEq(t, childDigest, digest)
+		})
+
+		it("matches wasi children for wasip1", func() {
+			index.AddManifest(withPlatform("wasi", "wasm"))
+			_, err := imgutil.ImageFromIndex(index.ImageIndex, imgutil.Platform{OS: "wasip1", Architecture: "wasm"})
+			h.AssertNil(t, err)
+		})
+
+		it("is invalid with a mismatched wasm platform", func() {
+			index.AddManifest(withPlatform("wasip2", "arm64"))
+			h.AssertEq(t, index.Valid(), false)
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package imgutil
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// Well-known annotation keys and label names, so that platforms can refer to them instead of duplicating the strings.
+// The annotations that imgutil sets for its own features are declared with those features,
+// e.g. SBOMMediaTypeAnnotation and AttestationReferenceTypeAnnotation.
+const (
+	// OCIRefNameAnnotation holds the tag of a manifest in an OCI layout or archive index.
+	OCIRefNameAnnotation = "org.opencontainers.image.ref.name"
+	// OCICreatedAnnotation holds the date and time the image was built, in RFC 3339 format.
+	OCICreatedAnnotation = "org.opencontainers.image.created"
+	// OCIBaseNameAnnotation holds the reference of the image's base image.
+	OCIBaseNameAnnotation = "org.opencontainers.image.base.name"
+	// OCIBaseDigestAnnotation holds the digest of the image's base image.
+	OCIBaseDigestAnnotation = "org.opencontainers.image.base.digest"
+
+	// LifecycleMetadataLabel holds the layers metadata written by the CNB lifecycle on export.
+	LifecycleMetadataLabel = "io.buildpacks.lifecycle.metadata"
+	// BuildMetadataLabel holds the build metadata (bill of materials, processes, buildpacks) of a CNB app image.
+	BuildMetadataLabel = "io.buildpacks.build.metadata"
+	// ProjectMetadataLabel holds the source metadata of the project a CNB app image was built from.
+	ProjectMetadataLabel = "io.buildpacks.project.metadata"
+	// StackIDLabel holds the ID of the stack of a CNB base or app image.
+	StackIDLabel = "io.buildpacks.stack.id"
+	// DistroNameLabel holds the name of the operating system distribution of a CNB base or app image.
+	DistroNameLabel = "io.buildpacks.base.distro.name"
+	// DistroVersionLabel holds the version of the operating system distribution of a CNB base or app image.
+	DistroVersionLabel = "io.buildpacks.base.distro.version"
+	// RebasableLabel is "false" for CNB app images that must not be rebased.
+	RebasableLabel = "io.buildpacks.rebasable"
+
+	// CNBReservedPrefix is the prefix of the annotation keys and label names reserved for Cloud Native Buildpacks.
+	CNBReservedPrefix = "io.buildpacks."
+	// OCIReservedPrefix is the prefix of the annotation keys reserved by the OCI image specification.
+	OCIReservedPrefix = "org.opencontainers."
+)
+
+// IsReservedKey reports if the annotation key or label name is in a namespace reserved by CNB or OCI,
+// and so should only be set with its specified meaning.
+func IsReservedKey(key string) bool {
+	return strings.HasPrefix(key, CNBReservedPrefix) || strings.HasPrefix(key, OCIReservedPrefix)
+}
+
+// ValidateAnnotationKey returns an error if the annotation key or label name is empty,
+// or contains whitespace or control characters.
+func ValidateAnnotationKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("annotation key must not be empty")
+	}
+	for _, r := range key {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("invalid annotation key %q: must not contain whitespace or control characters", key)
+		}
+	}
+	return nil
+}
+
+// IndexType returns the media type of image indexes for the media types, or "" if they are missing or default.
+func (t MediaTypes) IndexType() types.MediaType {
+	switch t {
+	case OCITypes:
+		return types.OCIImageIndex
+	case DockerTypes:
+		return types.DockerManifestList
+	default:
+		return ""
+	}
+}
+
+// MediaTypesOf returns the set of media types (OCITypes or DockerTypes) that the given manifest, index, config or layer
+// media type belongs to, or MissingTypes if it belongs to neither.
+func MediaTypesOf(mediaType types.MediaType) MediaTypes {
+	switch mediaType {
+	case types.OCIManifestSchema1, types.OCIImageIndex, types.OCIConfigJSON,
+		types.OCILayer, types.OCILayerZStd, types.OCIUncompressedLayer,
+		types.OCIRestrictedLayer, types.OCIUncompressedRestrictedLayer:
+		return OCITypes
+	case types.DockerManifestSchema2, types.DockerManifestList, types.DockerConfigJSON,
+		types.DockerLayer, types.DockerForeignLayer, types.DockerUncompressedLayer:
+		return DockerTypes
+	default:
+		return MissingTypes
+	}
+}
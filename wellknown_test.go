@@ -0,0 +1,56 @@
+package imgutil_test
+
+import (
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"github.com/sclevine/spec"
+	"github.com/sclevine/spec/report"
+
+	"github.com/buildpacks/imgutil"
+	h "github.com/buildpacks/imgutil/testhelpers"
+)
+
+func TestWellKnown(t *testing.T) {
+	spec.Run(t, "WellKnown", testWellKnown, spec.Parallel(), spec.Report(report.Terminal{}))
+}
+
+func testWellKnown(t *testing.T, when spec.G, it spec.S) {
+	when("#IsReservedKey", func() {
+		it("reports keys in the CNB and OCI namespaces", func() {
+			h.AssertEq(t, imgutil.IsReservedKey(imgutil.LifecycleMetadataLabel), true)
+			h.AssertEq(t, imgutil.IsReservedKey(imgutil.OCIRefNameAnnotation), true)
+			h.AssertEq(t, imgutil.IsReservedKey("com.example.some-key"), false)
+		})
+	})
+
+	when("#ValidateAnnotationKey", func() {
+		it("accepts well-formed keys", func() {
+			h.AssertNil(t, imgutil.ValidateAnnotationKey("com.example.some-key"))
+		})
+
+		it("rejects empty keys and keys with whitespace", func() {
+			h.AssertError(t, imgutil.ValidateAnnotationKey(""), "must not be empty")
+			h.AssertError(t, imgutil.ValidateAnnotationKey("some key"), "must not contain whitespace")
+		})
+	})
+
+	when("#MediaTypesOf", func() {
+		it("returns the set of media types a media type belongs to", func() {
+			h.AssertEq(t, imgutil.MediaTypesOf(types.OCIImageIndex), imgutil.OCITypes)
+			h.AssertEq(t, imgutil.MediaTypesOf(types.OCILayerZStd), imgutil.OCITypes)
+			h.AssertEq(t, imgutil.MediaTypesOf(types.DockerManifestSchema2), imgutil.DockerTypes)
+			h.AssertEq(t, imgutil.MediaTypesOf(imgutil.InTotoMediaType), imgutil.MissingTypes)
+		})
+
+		it("round-trips with the media types of each set", func() {
+			for _, mediaTypes := range []imgutil.MediaTypes{imgutil.OCITypes, imgutil.DockerTypes} {
+				for _, mediaType := range []types.MediaType{
+					mediaTypes.ManifestType(), mediaTypes.IndexType(), mediaTypes.ConfigType(), mediaTypes.LayerType(),
+				} {
+					h.AssertEq(t, imgutil.MediaTypesOf(mediaType), mediaTypes)
+				}
+			}
+		})
+	})
+}